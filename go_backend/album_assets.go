@@ -0,0 +1,305 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ==================== Album assets ====================
+//
+// Extensions can attach auxiliary files to an album (digital booklets, back
+// covers, liner notes) through an "assets" list in their getAlbum result.
+// Flutter hands the list back together with where each file should go: on
+// SAF targets it creates the documents and passes an OutputFD per asset,
+// otherwise the files land in OutputDir next to the tracks.
+
+const (
+	AlbumAssetBooklet = "booklet"
+	AlbumAssetArtwork = "artwork"
+	AlbumAssetOther   = "other"
+	// AlbumAssetAnimatedCover is the only type that may be a video.
+	AlbumAssetAnimatedCover = "animated_cover"
+
+	albumAssetTimeout  = 5 * time.Minute
+	maxAlbumAssetBytes = 200 << 20
+)
+
+// albumAssetExtensions lists the file types an extension may save. Anything
+// executable or playable is refused so assets cannot smuggle in tracks.
+var albumAssetExtensions = map[string]string{
+	".pdf":  "application/pdf",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+	".txt":  "text/plain",
+	".cue":  "text/plain",
+	".log":  "text/plain",
+}
+
+// ExtAlbumAsset is one auxiliary file declared by an extension.
+type ExtAlbumAsset struct {
+	Type     string `json:"type"`
+	URL      string `json:"url"`
+	Filename string `json:"filename,omitempty"`
+	Title    string `json:"title,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+}
+
+type AlbumAssetTarget struct {
+	ExtAlbumAsset
+	OutputPath string `json:"output_path,omitempty"`
+	OutputFD   int    `json:"output_fd,omitempty"`
+}
+
+type AlbumAssetsRequest struct {
+	ExtensionID string             `json:"extension_id,omitempty"`
+	AlbumName   string             `json:"album_name,omitempty"`
+	OutputDir   string             `json:"output_dir,omitempty"`
+	Overwrite   bool               `json:"overwrite"`
+	Assets      []AlbumAssetTarget `json:"assets"`
+}
+
+type AlbumAssetResult struct {
+	Type     string `json:"type"`
+	Filename string `json:"filename"`
+	FilePath string `json:"file_path,omitempty"`
+	SizeKB   int    `json:"size_kb,omitempty"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// AlbumAssetsResult doubles as the album's asset summary: HasBooklet and
+// ArtworkCount are what the collection view shows.
+type AlbumAssetsResult struct {
+	AlbumName    string             `json:"album_name,omitempty"`
+	Saved        int                `json:"saved"`
+	Skipped      int                `json:"skipped"`
+	Failed       int                `json:"failed"`
+	TotalKB      int                `json:"total_kb"`
+	HasBooklet   bool               `json:"has_booklet"`
+	ArtworkCount int                `json:"artwork_count"`
+	Assets       []AlbumAssetResult `json:"assets"`
+}
+
+// normalizeAlbumAsset fills in the type and a safe filename. The filename
+// falls back to the URL's last path segment, then to booklet.pdf.
+func normalizeAlbumAsset(asset ExtAlbumAsset) (ExtAlbumAsset, error) {
+	u, err := url.Parse(strings.TrimSpace(asset.URL))
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return asset, fmt.Errorf("asset URL must be https: %q", asset.URL)
+	}
+	asset.URL = u.String()
+
+	asset.Type = strings.ToLower(strings.TrimSpace(asset.Type))
+	switch asset.Type {
+	case AlbumAssetBooklet, AlbumAssetArtwork, AlbumAssetAnimatedCover:
+	default:
+		asset.Type = AlbumAssetOther
+	}
+
+	name := strings.TrimSpace(asset.Filename)
+	if name == "" {
+		name = path.Base(u.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "booklet.pdf"
+	}
+	name = sanitizeFilename(filepath.Base(name))
+	ext := strings.ToLower(filepath.Ext(name))
+	allowed := albumAssetExtensions
+	if asset.Type == AlbumAssetAnimatedCover {
+		allowed = animatedCoverExtensions
+	}
+	mimeType, ok := allowed[ext]
+	if !ok {
+		return asset, fmt.Errorf("unsupported asset type %q", ext)
+	}
+	asset.Filename = name
+	if asset.MimeType == "" {
+		asset.MimeType = mimeType
+	}
+	return asset, nil
+}
+
+func downloadAlbumAsset(client *http.Client, target AlbumAssetTarget, outputPath string) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, target.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", getRandomUserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch asset: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("asset returned HTTP %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxAlbumAssetBytes {
+		return 0, fmt.Errorf("asset too large (%d bytes)", resp.ContentLength)
+	}
+
+	if outputPath != "" {
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return 0, fmt.Errorf("failed to create asset directory: %w", err)
+		}
+	}
+	out, err := openOutputForWrite(outputPath, target.OutputFD)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open asset output: %w", err)
+	}
+	written, copyErr := io.Copy(out, io.LimitReader(resp.Body, maxAlbumAssetBytes+1))
+	closeErr := out.Close()
+	if copyErr == nil && written > maxAlbumAssetBytes {
+		copyErr = fmt.Errorf("asset exceeds %d MB", maxAlbumAssetBytes>>20)
+	}
+	if copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr != nil {
+		cleanupOutputOnError(outputPath, target.OutputFD)
+		return 0, copyErr
+	}
+	return written, nil
+}
+
+// albumAssetRedirectPolicy applies the extension's network permissions to
+// every redirect hop, so an allowed host cannot bounce the download to one
+// the manifest does not list.
+func albumAssetRedirectPolicy(ext *LoadedExtension) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect blocked: only https is allowed")
+		}
+		domain := req.URL.Hostname()
+		if domain == "" || !ext.manifestAllowsDomain(domain) {
+			return &RedirectBlockedError{Domain: domain}
+		}
+		if isPrivateIP(domain) {
+			return &RedirectBlockedError{Domain: domain, IsPrivate: true}
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+// DownloadAlbumAssets saves the requested assets and returns a per-file
+// report. One failing asset does not stop the others. Every OutputFD is
+// closed before it returns.
+func DownloadAlbumAssets(req AlbumAssetsRequest) (*AlbumAssetsResult, error) {
+	if len(req.Assets) == 0 {
+		return nil, fmt.Errorf("no assets to download")
+	}
+	for _, target := range req.Assets {
+		adoptOutputFD(target.OutputFD, "")
+	}
+
+	var ext *LoadedExtension
+	if req.ExtensionID != "" {
+		var err error
+		if ext, err = GetExtensionManager().GetExtension(req.ExtensionID); err != nil {
+			for _, target := range req.Assets {
+				closeOwnedOutputFD(target.OutputFD)
+			}
+			return nil, err
+		}
+	}
+
+	client := NewHTTPClientWithTimeout(albumAssetTimeout)
+	if ext != nil {
+		client.CheckRedirect = albumAssetRedirectPolicy(ext)
+	}
+	result := &AlbumAssetsResult{AlbumName: req.AlbumName, Assets: []AlbumAssetResult{}}
+	for _, target := range req.Assets {
+		asset, err := normalizeAlbumAsset(target.ExtAlbumAsset)
+		target.ExtAlbumAsset = asset
+		entry := AlbumAssetResult{Type: asset.Type, Filename: asset.Filename}
+
+		if err == nil && ext != nil {
+			if u, _ := url.Parse(asset.URL); !ext.manifestAllowsDomain(u.Hostname()) {
+				err = fmt.Errorf("domain %s is not in the extension's network permissions", u.Hostname())
+			}
+		}
+
+		outputPath := ""
+		if err == nil && !isFDOutput(target.OutputFD) {
+			outputPath = strings.TrimSpace(target.OutputPath)
+			if outputPath == "" {
+				if strings.TrimSpace(req.OutputDir) == "" {
+					err = fmt.Errorf("output_dir, output_path or output_fd is required")
+				} else {
+					outputPath = filepath.Join(req.OutputDir, asset.Filename)
+				}
+			}
+		}
+
+		if err == nil && outputPath != "" && !req.Overwrite {
+			if info, statErr := os.Stat(outputPath); statErr == nil && info.Size() > 0 {
+				entry.FilePath, entry.Skipped = outputPath, true
+				entry.SizeKB = int(info.Size() / 1024)
+			}
+		}
+
+		if err == nil && !entry.Skipped {
+			var written int64
+			written, err = downloadAlbumAsset(client, target, outputPath)
+			entry.FilePath, entry.SizeKB = outputPath, int(written/1024)
+		}
+		closeOwnedOutputFD(target.OutputFD)
+
+		switch {
+		case err != nil:
+			entry.Error = err.Error()
+			entry.FilePath = ""
+			result.Failed++
+			GoLog("[AlbumAssets] %s failed: %v\n", asset.Filename, err)
+		case entry.Skipped:
+			result.Skipped++
+		default:
+			result.Saved++
+			GoLog("[AlbumAssets] Saved %s (%d KB)\n", asset.Filename, entry.SizeKB)
+		}
+		if err == nil {
+			result.TotalKB += entry.SizeKB
+			switch asset.Type {
+			case AlbumAssetBooklet:
+				result.HasBooklet = true
+			case AlbumAssetArtwork:
+				result.ArtworkCount++
+			}
+		}
+		result.Assets = append(result.Assets, entry)
+	}
+
+	emitBackendEvent("album_assets", result)
+	return result, nil
+}
+
+func DownloadAlbumAssetsJSON(requestJSON string) (string, error) {
+	var req AlbumAssetsRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid request: %w", err)
+	}
+
+	result, err := DownloadAlbumAssets(req)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
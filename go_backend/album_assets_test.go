@@ -0,0 +1,80 @@
+package gobackend
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestNormalizeAlbumAsset(t *testing.T) {
+	asset, err := normalizeAlbumAsset(ExtAlbumAsset{Type: "Booklet", URL: "https://cdn.example.com/a/123/Digital Booklet.pdf?token=x"})
+	if err != nil {
+		t.Fatalf("normalizeAlbumAsset failed: %v", err)
+	}
+	if asset.Type != AlbumAssetBooklet || asset.Filename != "Digital Booklet.pdf" || asset.MimeType != "application/pdf" {
+		t.Errorf("unexpected asset: %+v", asset)
+	}
+
+	asset, err = normalizeAlbumAsset(ExtAlbumAsset{Type: "scan", URL: "https://cdn.example.com/x", Filename: "../../back cover.JPG"})
+	if err != nil {
+		t.Fatalf("normalizeAlbumAsset failed: %v", err)
+	}
+	if asset.Type != AlbumAssetOther || asset.Filename != "back cover.JPG" || asset.MimeType != "image/jpeg" {
+		t.Errorf("unexpected asset: %+v", asset)
+	}
+
+	for _, bad := range []ExtAlbumAsset{
+		{URL: "http://cdn.example.com/booklet.pdf"},
+		{URL: "https://cdn.example.com/track.flac"},
+		{URL: "https://cdn.example.com/setup.apk"},
+	} {
+		if _, err := normalizeAlbumAsset(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad.URL)
+		}
+	}
+}
+
+func TestDownloadAlbumAssetsReportsFailures(t *testing.T) {
+	result, err := DownloadAlbumAssets(AlbumAssetsRequest{
+		Assets: []AlbumAssetTarget{
+			{ExtAlbumAsset: ExtAlbumAsset{Type: "booklet", URL: "https://cdn.example.com/booklet.pdf"}},
+			{ExtAlbumAsset: ExtAlbumAsset{Type: "artwork", URL: "ftp://cdn.example.com/back.jpg"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DownloadAlbumAssets failed: %v", err)
+	}
+	if result.Failed != 2 || result.Saved != 0 || result.HasBooklet || len(result.Assets) != 2 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if result.Assets[0].Error == "" || result.Assets[1].Error == "" {
+		t.Errorf("expected per-asset errors, got %+v", result.Assets)
+	}
+}
+
+func TestAlbumAssetRedirectPolicy(t *testing.T) {
+	ext := &LoadedExtension{
+		ID:       "assets",
+		Manifest: &ExtensionManifest{Name: "assets", Permissions: ExtensionPermissions{Network: []string{"cdn.example.com"}}},
+		Trust:    ExtensionTrustOfficial,
+	}
+	policy := albumAssetRedirectPolicy(ext)
+
+	redirect := func(target string) error {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return policy(req, nil)
+	}
+	if err := redirect("https://cdn.example.com/booklet.pdf"); err != nil {
+		t.Fatalf("redirect to an allowed host was blocked: %v", err)
+	}
+	var blocked *RedirectBlockedError
+	if err := redirect("https://evil.example.net/booklet.pdf"); !errors.As(err, &blocked) || blocked.Domain != "evil.example.net" {
+		t.Fatalf("redirect to an unlisted host should be blocked, got %v", err)
+	}
+	if err := redirect("http://cdn.example.com/booklet.pdf"); err == nil {
+		t.Fatal("redirect to plain http should be blocked")
+	}
+}
@@ -0,0 +1,100 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ==================== Album folder reuse ====================
+//
+// Flutter builds the album folder name from whatever the current provider
+// reports, so the same album can arrive as "AM" and "AM " or "Discovery" and
+// "Discovery." depending on source and sanitization. Before a download starts
+// the backend looks for an existing sibling folder whose normalized name is
+// close enough and writes into that one instead of creating a duplicate.
+//
+// BackendConfig.AlbumFolderMatch is the strictness: 1 only merges names that
+// are identical after normalization, lower values also accept near matches
+// (Levenshtein similarity), 0 turns the lookup off.
+
+const defaultAlbumFolderMatch = 1.0
+
+// normalizeAlbumFolderName folds case, punctuation and whitespace so that
+// names differing only in sanitization compare equal.
+func normalizeAlbumFolderName(name string) string {
+	return normalizeLooseTitle(strings.TrimRight(strings.TrimSpace(name), ". "))
+}
+
+// albumFolderNumbers returns the digit runs of a normalized name. Folders
+// like "Vol. 1" and "Vol. 2" are nearly identical as strings but must never
+// be merged, so near matches require the same numbers.
+func albumFolderNumbers(name string) string {
+	var b strings.Builder
+	inRun := false
+	for _, r := range name {
+		if unicode.IsDigit(r) {
+			b.WriteRune(r)
+			inRun = true
+		} else if inRun {
+			b.WriteByte(' ')
+			inRun = false
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// findExistingAlbumDir returns the sibling of dir that best matches its name
+// at the given strictness, or "" when dir already exists or nothing matches.
+func findExistingAlbumDir(dir string, threshold float64) string {
+	if threshold <= 0 || dir == "" {
+		return ""
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return ""
+	}
+
+	parent, base := filepath.Dir(dir), filepath.Base(dir)
+	wanted := normalizeAlbumFolderName(base)
+	if wanted == "" {
+		return ""
+	}
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return ""
+	}
+
+	wantedNumbers := albumFolderNumbers(wanted)
+	best, bestScore := "", 0.0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		candidate := normalizeAlbumFolderName(entry.Name())
+		if candidate == "" || albumFolderNumbers(candidate) != wantedNumbers {
+			continue
+		}
+		score := calculateStringSimilarity(wanted, candidate)
+		if score >= threshold && score > bestScore {
+			best, bestScore = entry.Name(), score
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return filepath.Join(parent, best)
+}
+
+// applyAlbumFolderReuse points req.OutputDir at an existing album folder that
+// differs only in sanitization. Explicit output paths and SAF targets are
+// left alone; Flutter already chose those documents.
+func applyAlbumFolderReuse(req *DownloadRequest) {
+	if req == nil || req.OutputDir == "" || req.OutputPath != "" || isFDOutput(req.OutputFD) {
+		return
+	}
+	if existing := findExistingAlbumDir(req.OutputDir, GetBackendConfig().AlbumFolderMatch); existing != "" {
+		GoLog("[Download] Reusing album folder %s for %s\n", existing, req.OutputDir)
+		req.OutputDir = existing
+	}
+}
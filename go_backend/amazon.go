@@ -1,7 +1,6 @@
 package gobackend
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
@@ -320,8 +319,15 @@ func (a *AmazonDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 	if err != nil {
 		return err
 	}
+	if err := preallocateOutput(out, expectedSize); err != nil {
+		out.Close()
+		cleanupOutputOnError(outputPath, outputFD)
+		return err
+	}
 
-	bufWriter := bufio.NewWriterSize(out, 256*1024)
+	mirror := openOutputMirror(itemID)
+	bufWriter := acquireCopyWriter(hashedOutput(mirror.tee(out), itemID))
+	defer releaseCopyWriter(bufWriter)
 
 	var written int64
 	if itemID != "" {
@@ -332,7 +338,8 @@ func (a *AmazonDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 	}
 
 	flushErr := bufWriter.Flush()
-	closeErr := out.Close()
+	closeErr := closeOutput(out)
+	mirror.close()
 
 	if err != nil {
 		cleanupOutputOnError(outputPath, outputFD)
@@ -354,6 +361,7 @@ func (a *AmazonDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 		cleanupOutputOnError(outputPath, outputFD)
 		return fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
 	}
+	sealDownloadHash(itemID, outputPath, outputFD)
 
 	GoLog("[Amazon] Downloaded: %.2f MB (Complete)\n", float64(written)/(1024*1024))
 	return nil
@@ -372,6 +380,7 @@ type AmazonDownloadResult struct {
 	DiscNumber    int
 	ISRC          string
 	LyricsLRC     string
+	LyricsTags    map[string]string
 	DecryptionKey string
 }
 
@@ -436,7 +445,9 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 		}
 	}
 
+	match := startTraceSpan(req.ItemID, TraceSpanMatch, map[string]interface{}{"provider": "amazon"})
 	amazonURL, err := resolveAmazonURLForRequest(req, "Amazon")
+	match.End(err)
 	if err != nil {
 		return AmazonDownloadResult{}, err
 	}
@@ -448,7 +459,9 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 	}
 
 	// Download using AfkarXYZ API
+	streamURL := startTraceSpan(req.ItemID, TraceSpanStreamURL, map[string]interface{}{"provider": "amazon"})
 	downloadURL, afkarFileName, decryptionKey, err := downloader.downloadFromAfkarXYZ(amazonURL)
+	streamURL.End(err)
 	if err != nil {
 		return AmazonDownloadResult{}, fmt.Errorf("failed to get download URL from AfkarXYZ: %w", err)
 	}
@@ -456,13 +469,15 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 	GoLog("[Amazon] Match found: '%s' by '%s'\n", req.TrackName, req.ArtistName)
 
 	filename := buildFilenameFromTemplate(req.FilenameFormat, map[string]any{
-		"title":  req.TrackName,
-		"artist": req.ArtistName,
-		"album":  req.AlbumName,
-		"track":  req.TrackNumber,
-		"year":   extractYear(req.ReleaseDate),
-		"date":   req.ReleaseDate,
-		"disc":   req.DiscNumber,
+		"title":        req.TrackName,
+		"artist":       req.ArtistName,
+		"album":        req.AlbumName,
+		"album_artist": req.AlbumArtist,
+		"track":        req.TrackNumber,
+		"year":         extractYear(req.ReleaseDate),
+		"date":         req.ReleaseDate,
+		"disc":         req.DiscNumber,
+		"disc_total":   req.TotalDiscs,
 	})
 	var outputPath string
 	if isSafOutput {
@@ -482,49 +497,8 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 		}
 	}
 
-	// START PARALLEL: Fetch cover and lyrics while downloading audio
-	var parallelResult *ParallelDownloadResult
-	parallelDone := make(chan struct{})
-	go func() {
-		defer close(parallelDone)
-		coverURL := req.CoverURL
-		embedLyrics := req.EmbedLyrics
-		if !req.EmbedMetadata {
-			coverURL = ""
-			embedLyrics = false
-		}
-		parallelResult = FetchCoverAndLyricsParallel(
-			coverURL,
-			req.EmbedMaxQualityCover,
-			req.SpotifyID,
-			req.TrackName,
-			req.ArtistName,
-			embedLyrics,
-			int64(req.DurationMS),
-		)
-	}()
-
-	// Download audio file with item ID for progress tracking
-	if err := downloader.DownloadFile(downloadURL, outputPath, req.OutputFD, req.ItemID); err != nil {
-		if errors.Is(err, ErrDownloadCancelled) {
-			return AmazonDownloadResult{}, ErrDownloadCancelled
-		}
-		return AmazonDownloadResult{}, fmt.Errorf("download failed: %w", err)
-	}
-
 	actualOutputPath := outputPath
 	needsDecryption := strings.TrimSpace(decryptionKey) != ""
-	if needsDecryption {
-		GoLog("[Amazon] Download requires decryption; deferring decrypt to Flutter FFmpeg path\n")
-	}
-
-	// Wait for parallel operations to complete
-	<-parallelDone
-
-	if req.ItemID != "" {
-		SetItemProgress(req.ItemID, 1.0, 0, 0)
-		SetItemFinalizing(req.ItemID)
-	}
 
 	actualTrackNum := req.TrackNumber
 	actualDiscNum := req.DiscNumber
@@ -533,59 +507,50 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 	actualTitle := req.TrackName
 	actualArtist := req.ArtistName
 
-	if !needsDecryption {
-		existingMeta, metaErr := ReadMetadata(actualOutputPath)
-		if metaErr == nil && existingMeta != nil {
-			if existingMeta.TrackNumber > 0 && (req.TrackNumber == 0 || req.TrackNumber == 1) {
-				actualTrackNum = existingMeta.TrackNumber
-				GoLog("[Amazon] Using track number from file: %d (request had: %d)\n", actualTrackNum, req.TrackNumber)
-			}
-			if existingMeta.DiscNumber > 0 && (req.DiscNumber == 0 || req.DiscNumber == 1) {
-				actualDiscNum = existingMeta.DiscNumber
-				GoLog("[Amazon] Using disc number from file: %d (request had: %d)\n", actualDiscNum, req.DiscNumber)
-			}
-			if existingMeta.Date != "" && req.ReleaseDate == "" {
-				actualDate = existingMeta.Date
-				GoLog("[Amazon] Using release date from file: %s\n", actualDate)
+	// Cover and lyrics are fetched while the audio downloads.
+	pipeline := newTrackPipeline(req, true, func() error {
+		if err := downloader.DownloadFile(downloadURL, outputPath, req.OutputFD, req.ItemID); err != nil {
+			if errors.Is(err, ErrDownloadCancelled) {
+				return ErrDownloadCancelled
 			}
-			if existingMeta.Album != "" && req.AlbumName == "" {
-				actualAlbum = existingMeta.Album
-				GoLog("[Amazon] Using album from file: %s\n", actualAlbum)
-			}
-			GoLog("[Amazon] Existing metadata - Title: %s, Artist: %s, Album: %s, Date: %s\n",
-				existingMeta.Title, existingMeta.Artist, existingMeta.Album, existingMeta.Date)
+			return fmt.Errorf("download failed: %w", err)
+		}
+		if needsDecryption {
+			GoLog("[Amazon] Download requires decryption; deferring decrypt to Flutter FFmpeg path\n")
 		}
-	}
 
-	metadata := Metadata{
-		Title:       actualTitle,
-		Artist:      actualArtist,
-		Album:       actualAlbum,
-		AlbumArtist: req.AlbumArtist,
-		Date:        actualDate,
-		TrackNumber: actualTrackNum,
-		TotalTracks: req.TotalTracks,
-		DiscNumber:  actualDiscNum,
-		ISRC:        req.ISRC,
-		Genre:       req.Genre,
-		Label:       req.Label,
-		Copyright:   req.Copyright,
-	}
-
-	var coverData []byte
-	if parallelResult != nil && parallelResult.CoverData != nil && len(parallelResult.CoverData) > 0 {
-		coverData = parallelResult.CoverData
-		GoLog("[Amazon] Using parallel-fetched cover (%d bytes)\n", len(coverData))
-	} else {
-		existingCover, coverErr := ExtractCoverArt(actualOutputPath)
-		if coverErr == nil && len(existingCover) > 0 {
-			coverData = existingCover
-			GoLog("[Amazon] Using existing cover from Amazon file (%d bytes)\n", len(coverData))
-		} else {
-			GoLog("[Amazon] No cover available (parallel fetch failed and no existing cover)\n")
+		if req.ItemID != "" {
+			SetItemProgress(req.ItemID, 1.0, 0, 0)
+			SetItemFinalizing(req.ItemID)
 		}
-	}
 
+		if !needsDecryption {
+			existingMeta, metaErr := ReadMetadata(actualOutputPath)
+			if metaErr == nil && existingMeta != nil {
+				if existingMeta.TrackNumber > 0 && (req.TrackNumber == 0 || req.TrackNumber == 1) {
+					actualTrackNum = existingMeta.TrackNumber
+					GoLog("[Amazon] Using track number from file: %d (request had: %d)\n", actualTrackNum, req.TrackNumber)
+				}
+				if existingMeta.DiscNumber > 0 && (req.DiscNumber == 0 || req.DiscNumber == 1) {
+					actualDiscNum = existingMeta.DiscNumber
+					GoLog("[Amazon] Using disc number from file: %d (request had: %d)\n", actualDiscNum, req.DiscNumber)
+				}
+				if existingMeta.Date != "" && req.ReleaseDate == "" {
+					actualDate = existingMeta.Date
+					GoLog("[Amazon] Using release date from file: %s\n", actualDate)
+				}
+				if existingMeta.Album != "" && req.AlbumName == "" {
+					actualAlbum = existingMeta.Album
+					GoLog("[Amazon] Using album from file: %s\n", actualAlbum)
+				}
+				GoLog("[Amazon] Existing metadata - Title: %s, Artist: %s, Album: %s, Date: %s\n",
+					existingMeta.Title, existingMeta.Artist, existingMeta.Album, existingMeta.Date)
+			}
+		}
+		return nil
+	})
+
+	isFlacOutput := strings.HasSuffix(strings.ToLower(actualOutputPath), ".flac")
 	if isSafOutput || needsDecryption || !req.EmbedMetadata {
 		if !req.EmbedMetadata {
 			GoLog("[Amazon] Metadata embedding disabled by settings, skipping in-backend metadata/lyrics embedding\n")
@@ -593,43 +558,56 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 			GoLog("[Amazon] SAF output detected - skipping in-backend metadata/lyrics embedding (handled in Flutter)\n")
 		}
 	} else {
-		isFlacOutput := strings.HasSuffix(strings.ToLower(actualOutputPath), ".flac")
-		if isFlacOutput {
-			if err := EmbedMetadataWithCoverData(actualOutputPath, metadata, coverData); err != nil {
-				GoLog("[Amazon] Warning: failed to embed metadata: %v\n", err)
+		pipeline.Tag(func(assets *ParallelDownloadResult) error {
+			if !isFlacOutput {
+				GoLog("[Amazon] Non-FLAC output detected (%s), skipping native metadata embedding\n", filepath.Ext(actualOutputPath))
+				return nil
 			}
-		} else {
-			GoLog("[Amazon] Non-FLAC output detected (%s), skipping native metadata embedding\n", filepath.Ext(actualOutputPath))
-		}
 
-		if req.EmbedLyrics && parallelResult != nil && parallelResult.LyricsLRC != "" {
-			lyricsMode := req.LyricsMode
-			if lyricsMode == "" {
-				lyricsMode = "embed"
+			coverData := assets.CoverData
+			if len(coverData) > 0 {
+				GoLog("[Amazon] Using parallel-fetched cover (%d bytes)\n", len(coverData))
+			} else if existingCover, coverErr := ExtractCoverArt(actualOutputPath); coverErr == nil && len(existingCover) > 0 {
+				coverData = existingCover
+				GoLog("[Amazon] Using existing cover from Amazon file (%d bytes)\n", len(coverData))
+			} else {
+				GoLog("[Amazon] No cover available (parallel fetch failed and no existing cover)\n")
 			}
 
-			if lyricsMode == "external" || lyricsMode == "both" {
-				GoLog("[Amazon] Saving external LRC file...\n")
-				if lrcPath, lrcErr := SaveLRCFile(actualOutputPath, parallelResult.LyricsLRC); lrcErr != nil {
-					GoLog("[Amazon] Warning: failed to save LRC file: %v\n", lrcErr)
-				} else {
-					GoLog("[Amazon] LRC file saved: %s\n", lrcPath)
-				}
+			metadata := Metadata{
+				Title:       actualTitle,
+				Artist:      actualArtist,
+				Album:       actualAlbum,
+				AlbumArtist: req.AlbumArtist,
+				Date:        actualDate,
+				TrackNumber: actualTrackNum,
+				TotalTracks: req.TotalTracks,
+				DiscNumber:  actualDiscNum,
+				TotalDiscs:  req.TotalDiscs,
+				Compilation: req.Compilation,
+				ISRC:        req.ISRC,
+				Genre:       req.Genre,
+				Label:       req.Label,
+				Copyright:   req.Copyright,
+				Chapters:    req.Chapters,
 			}
-
-			if (lyricsMode == "embed" || lyricsMode == "both") && isFlacOutput {
-				GoLog("[Amazon] Embedding parallel-fetched lyrics (%d lines)...\n", len(parallelResult.LyricsData.Lines))
-				if embedErr := EmbedLyrics(actualOutputPath, parallelResult.LyricsLRC); embedErr != nil {
-					GoLog("[Amazon] Warning: failed to embed lyrics: %v\n", embedErr)
-				} else {
-					GoLog("[Amazon] Lyrics embedded successfully\n")
-				}
-			} else if (lyricsMode == "embed" || lyricsMode == "both") && !isFlacOutput {
+			if err := EmbedMetadataWithCoverData(actualOutputPath, metadata, coverData); err != nil {
+				GoLog("[Amazon] Warning: failed to embed metadata: %v\n", err)
+				return err
+			}
+			return nil
+		})
+		pipeline.WriteLyrics(func(lrc string, lyrics *LyricsResponse) error {
+			if !isFlacOutput {
 				GoLog("[Amazon] Skipping embedded lyrics for non-FLAC output\n")
 			}
-		} else if req.EmbedLyrics {
-			GoLog("[Amazon] No lyrics available from parallel fetch\n")
-		}
+			return writeLyricsOutputs("Amazon", actualOutputPath, lrc, lyrics, req.LyricsMode, true, isFlacOutput)
+		})
+	}
+
+	parallelResult, err := pipeline.Run()
+	if err != nil {
+		return AmazonDownloadResult{}, err
 	}
 
 	GoLog("[Amazon] Downloaded successfully from Amazon Music\n")
@@ -671,8 +649,10 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 	}
 
 	lyricsLRC := ""
+	var lyricsTags map[string]string
 	if req.EmbedMetadata && req.EmbedLyrics && parallelResult != nil && parallelResult.LyricsLRC != "" {
 		lyricsLRC = parallelResult.LyricsLRC
+		lyricsTags = parallelResult.LyricsTags
 	}
 
 	return AmazonDownloadResult{
@@ -687,6 +667,7 @@ func downloadFromAmazon(req DownloadRequest) (AmazonDownloadResult, error) {
 		DiscNumber:    actualDiscNum,
 		ISRC:          req.ISRC,
 		LyricsLRC:     lyricsLRC,
+		LyricsTags:    lyricsTags,
 		DecryptionKey: decryptionKey,
 	}, nil
 }
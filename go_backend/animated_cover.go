@@ -0,0 +1,185 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Animated covers ====================
+//
+// Some providers expose a looping video next to the still cover: Tidal's
+// album video covers, and Spotify canvases that extensions return as
+// animated_cover_url. With BackendConfig.SaveAnimatedCover on, the video is
+// saved beside the audio through the album asset machinery:
+//
+//	track scope  "<track file name>.canvas.mp4", one per track (canvases)
+//	album scope  "<album>.cover.mp4" beside the tracks, shared by the album
+//	             without clashing with other albums saved to the same folder
+//
+// For SAF downloads the response only carries the filename and URL; Flutter
+// creates the document and passes its fd to album.assets with the
+// animated_cover type.
+
+const (
+	AnimatedCoverScopeTrack = "track"
+	AnimatedCoverScopeAlbum = "album"
+
+	tidalVideoCoverURL = "https://resources.tidal.com/videos/%s/1280x1280.mp4"
+
+	// animatedCoverTTL drops covers whose download never reached
+	// attachAnimatedCover, such as provider calls outside DownloadByStrategy.
+	animatedCoverTTL = time.Hour
+)
+
+var animatedCoverExtensions = map[string]string{
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+}
+
+// AnimatedCoverResult is attached to a successful DownloadResponse.
+type AnimatedCoverResult struct {
+	URL      string `json:"url"`
+	Scope    string `json:"scope"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type"`
+	FilePath string `json:"file_path,omitempty"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type animatedCover struct {
+	url   string
+	scope string
+	added time.Time
+}
+
+var (
+	animatedCoversMu sync.Mutex
+	animatedCovers   = make(map[string]animatedCover)
+)
+
+// rememberAnimatedCover records the animated cover a provider found for
+// itemID. Nothing is kept when the setting is off.
+func rememberAnimatedCover(itemID, rawURL, scope string) {
+	rawURL = strings.TrimSpace(rawURL)
+	if itemID == "" || rawURL == "" || !GetBackendConfig().SaveAnimatedCover {
+		return
+	}
+	now := time.Now()
+	animatedCoversMu.Lock()
+	defer animatedCoversMu.Unlock()
+	for id, cover := range animatedCovers {
+		if now.Sub(cover.added) > animatedCoverTTL {
+			delete(animatedCovers, id)
+		}
+	}
+	animatedCovers[itemID] = animatedCover{url: rawURL, scope: scope, added: now}
+}
+
+func takeAnimatedCover(itemID string) (animatedCover, bool) {
+	animatedCoversMu.Lock()
+	defer animatedCoversMu.Unlock()
+	cover, ok := animatedCovers[itemID]
+	delete(animatedCovers, itemID)
+	return cover, ok
+}
+
+// forgetAnimatedCover drops an item's cover once its download has finished,
+// successfully or not.
+func forgetAnimatedCover(itemID string) {
+	takeAnimatedCover(itemID)
+}
+
+// tidalAnimatedCoverURL turns an album's videoCover id into its MP4 URL.
+func tidalAnimatedCoverURL(videoCover string) string {
+	videoCover = strings.TrimSpace(videoCover)
+	if videoCover == "" {
+		return ""
+	}
+	return fmt.Sprintf(tidalVideoCoverURL, strings.ReplaceAll(videoCover, "-", "/"))
+}
+
+// animatedCoverFilename names the video after trackPath for track scope and
+// after the album for album scope ("cover" when it is unknown), keeping the
+// URL's extension when it is a video.
+func animatedCoverFilename(trackPath, albumName string, cover animatedCover) string {
+	ext := ".mp4"
+	if u, err := url.Parse(cover.url); err == nil {
+		if candidate := strings.ToLower(path.Ext(u.Path)); animatedCoverExtensions[candidate] != "" {
+			ext = candidate
+		}
+	}
+	if cover.scope == AnimatedCoverScopeAlbum {
+		if strings.TrimSpace(albumName) != "" {
+			return sanitizeFilename(albumName) + ".cover" + ext
+		}
+		return "cover" + ext
+	}
+	base := filepath.Base(trackPath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + ".canvas" + ext
+}
+
+// attachAnimatedCover saves the item's animated cover next to a finished
+// download, or describes it for Flutter when the output is SAF. A failed
+// video download is reported in the response but never fails the track.
+func attachAnimatedCover(req DownloadRequest, respJSON string) string {
+	cover, ok := takeAnimatedCover(req.ItemID)
+	if !ok && strings.TrimSpace(req.AnimatedCoverURL) != "" && GetBackendConfig().SaveAnimatedCover {
+		cover, ok = animatedCover{url: strings.TrimSpace(req.AnimatedCoverURL), scope: AnimatedCoverScopeTrack}, true
+	}
+	if !ok {
+		return respJSON
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success || resp.AlreadyExists ||
+		strings.HasPrefix(resp.FilePath, "EXISTS:") {
+		return respJSON
+	}
+
+	isSafOutput := isFDOutput(req.OutputFD) || strings.TrimSpace(req.OutputPath) != ""
+	trackPath := resp.FilePath
+	if isSafOutput {
+		named := req
+		named.OutputPath = ""
+		trackPath = buildOutputPath(named)
+	}
+	filename := animatedCoverFilename(trackPath, firstNonEmpty(resp.Album, req.AlbumName), cover)
+	result := &AnimatedCoverResult{
+		URL:      cover.url,
+		Scope:    cover.scope,
+		Filename: filename,
+		MimeType: animatedCoverExtensions[filepath.Ext(filename)],
+	}
+
+	if !isSafOutput {
+		saved, err := DownloadAlbumAssets(AlbumAssetsRequest{
+			AlbumName: resp.Album,
+			Assets: []AlbumAssetTarget{{
+				ExtAlbumAsset: ExtAlbumAsset{Type: AlbumAssetAnimatedCover, URL: cover.url, Filename: filename},
+				OutputPath:    filepath.Join(filepath.Dir(resp.FilePath), filename),
+			}},
+		})
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case saved.Assets[0].Error != "":
+			result.Error = saved.Assets[0].Error
+		default:
+			result.FilePath = saved.Assets[0].FilePath
+			result.Skipped = saved.Assets[0].Skipped
+		}
+	}
+
+	resp.AnimatedCover = result
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return respJSON
+	}
+	return string(jsonBytes)
+}
@@ -0,0 +1,96 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnimatedCoverNaming(t *testing.T) {
+	if got := tidalAnimatedCoverURL("1a2b-3c4d"); got != "https://resources.tidal.com/videos/1a2b/3c4d/1280x1280.mp4" {
+		t.Errorf("tidal url = %s", got)
+	}
+	if got := animatedCoverFilename("/music/A - B.flac", "", animatedCover{url: "https://x/canvas.webm?t=1", scope: AnimatedCoverScopeTrack}); got != "A - B.canvas.webm" {
+		t.Errorf("track filename = %s", got)
+	}
+	if got := animatedCoverFilename("/music/A - B.flac", "First Album", animatedCover{url: "https://x/v", scope: AnimatedCoverScopeAlbum}); got != "First Album.cover.mp4" {
+		t.Errorf("album filename = %s", got)
+	}
+	if got := animatedCoverFilename("/music/A - B.flac", " ", animatedCover{url: "https://x/v", scope: AnimatedCoverScopeAlbum}); got != "cover.mp4" {
+		t.Errorf("unknown album filename = %s", got)
+	}
+
+	if _, err := normalizeAlbumAsset(ExtAlbumAsset{Type: AlbumAssetAnimatedCover, URL: "https://x/canvas.mp4"}); err != nil {
+		t.Errorf("animated cover rejected: %v", err)
+	}
+	if _, err := normalizeAlbumAsset(ExtAlbumAsset{Type: AlbumAssetArtwork, URL: "https://x/canvas.mp4"}); err == nil {
+		t.Error("video accepted as plain artwork")
+	}
+}
+
+func TestAttachAnimatedCover(t *testing.T) {
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+
+	dir := t.TempDir()
+	trackPath := filepath.Join(dir, "Artist - Song.flac")
+	respJSON := `{"success":true,"message":"ok","file_path":"` + trackPath + `"}`
+	req := DownloadRequest{ItemID: "anim-1", OutputDir: dir, AlbumName: "First Album"}
+
+	rememberAnimatedCover(req.ItemID, "https://resources.tidal.com/videos/a/b/1280x1280.mp4", AnimatedCoverScopeAlbum)
+	if got := attachAnimatedCover(req, respJSON); got != respJSON {
+		t.Fatalf("setting off should leave the response alone: %s", got)
+	}
+
+	if err := SetBackendConfigJSON(`{"save_animated_cover": true}`); err != nil {
+		t.Fatal(err)
+	}
+	// An existing cover for the same album is shared, so no request is made.
+	existing := filepath.Join(dir, "First Album.cover.mp4")
+	if err := os.WriteFile(existing, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rememberAnimatedCover(req.ItemID, "https://resources.tidal.com/videos/a/b/1280x1280.mp4", AnimatedCoverScopeAlbum)
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(attachAnimatedCover(req, respJSON)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.AnimatedCover == nil || !resp.AnimatedCover.Skipped || resp.AnimatedCover.FilePath != existing {
+		t.Fatalf("unexpected animated cover: %+v", resp.AnimatedCover)
+	}
+
+	saf := DownloadRequest{ItemID: "anim-2", OutputFD: 42, TrackName: "Song", ArtistName: "Artist", FilenameFormat: "{artist} - {title}",
+		AnimatedCoverURL: "https://canvaz.scdn.co/upload/x.mp4"}
+	resp = DownloadResponse{}
+	if err := json.Unmarshal([]byte(attachAnimatedCover(saf, `{"success":true,"message":"ok","file_path":"/proc/self/fd/42"}`)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.AnimatedCover == nil || resp.AnimatedCover.Filename != "Artist - Song.canvas.mp4" || resp.AnimatedCover.FilePath != "" {
+		t.Fatalf("unexpected SAF animated cover: %+v", resp.AnimatedCover)
+	}
+}
+
+func TestAnimatedCoverEntriesExpire(t *testing.T) {
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+	if err := SetBackendConfigJSON(`{"save_animated_cover": true}`); err != nil {
+		t.Fatal(err)
+	}
+
+	rememberAnimatedCover("anim-stale", "https://x/old.mp4", AnimatedCoverScopeTrack)
+	animatedCoversMu.Lock()
+	stale := animatedCovers["anim-stale"]
+	stale.added = stale.added.Add(-2 * animatedCoverTTL)
+	animatedCovers["anim-stale"] = stale
+	animatedCoversMu.Unlock()
+
+	rememberAnimatedCover("anim-fresh", "https://x/new.mp4", AnimatedCoverScopeTrack)
+	if _, ok := takeAnimatedCover("anim-stale"); ok {
+		t.Error("stale entry was not pruned")
+	}
+	forgetAnimatedCover("anim-fresh")
+	if _, ok := takeAnimatedCover("anim-fresh"); ok {
+		t.Error("forgotten entry is still present")
+	}
+}
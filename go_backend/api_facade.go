@@ -0,0 +1,1266 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ==================== Unified API facade ====================
+//
+// Invoke lets Flutter reach any registered method through one FFI entry point
+// instead of a dedicated gomobile export per API. Every call returns a JSON
+// envelope:
+//
+//	{"ok": true,  "result": <method result>}
+//	{"ok": false, "error": {"code": "...", "message": "..."}}
+//
+// New APIs only need a registerAPIMethod entry below; "api.methods" lists
+// the registry with its docs so the Dart side can check availability.
+
+type apiHandler func(params json.RawMessage) (interface{}, error)
+
+type apiMethod struct {
+	Name    string `json:"name"`
+	Params  string `json:"params,omitempty"`
+	Doc     string `json:"doc"`
+	handler apiHandler
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Localized is Message for the user, in the locale set by SetLocale.
+	Localized string `json:"localized,omitempty"`
+}
+
+type apiEnvelope struct {
+	OK     bool        `json:"ok"`
+	Result interface{} `json:"result,omitempty"`
+	Error  *apiError   `json:"error,omitempty"`
+}
+
+// EventSink receives backend events pushed to Flutter. gomobile generates a
+// Java/ObjC interface for it, so the app implements it natively.
+type EventSink interface {
+	OnEvent(eventType string, payloadJSON string)
+}
+
+var (
+	apiMethodsMu sync.RWMutex
+	apiMethods   = make(map[string]*apiMethod)
+)
+
+func registerAPIMethod(name, params, doc string, handler apiHandler) {
+	apiMethodsMu.Lock()
+	defer apiMethodsMu.Unlock()
+	apiMethods[name] = &apiMethod{Name: name, Params: params, Doc: doc, handler: handler}
+}
+
+// rawJSON wraps output of the existing *JSON exports so it is embedded in
+// the envelope as-is instead of being double-encoded.
+func rawJSON(s string, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(s), nil
+}
+
+func decodeAPIParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
+
+func apiErrorCode(err error) string {
+	var oversize *CoverOversizeError
+	if errors.As(err, &oversize) {
+		return "oversize"
+	}
+	if errors.Is(err, ErrCredentialsLocked) {
+		return "locked"
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.HasPrefix(msg, "unknown method"):
+		return "unknown_method"
+	case strings.HasPrefix(msg, "invalid params"):
+		return "invalid_params"
+	case strings.Contains(msg, "not found"):
+		return "not_found"
+	case strings.Contains(msg, "cancel"):
+		return "cancelled"
+	default:
+		return "internal"
+	}
+}
+
+func encodeAPIEnvelope(env apiEnvelope) (string, error) {
+	jsonBytes, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// Invoke dispatches method with paramsJSON and returns a JSON envelope.
+// Method failures are reported inside the envelope; the Go error is only set
+// when the envelope itself cannot be encoded.
+func Invoke(method string, paramsJSON string) (string, error) {
+	apiMethodsMu.RLock()
+	m, ok := apiMethods[method]
+	apiMethodsMu.RUnlock()
+
+	var (
+		result interface{}
+		err    error
+	)
+	if !ok {
+		err = fmt.Errorf("unknown method: %s", method)
+	} else {
+		params := json.RawMessage(strings.TrimSpace(paramsJSON))
+		if len(params) > 0 && !json.Valid(params) {
+			err = fmt.Errorf("invalid params: malformed JSON")
+		} else {
+			result, err = invokeAPIHandler(m, params)
+		}
+	}
+
+	if err != nil {
+		code := apiErrorCode(err)
+		return encodeAPIEnvelope(apiEnvelope{Error: &apiError{Code: code, Message: err.Error(), Localized: localizedError(code)}})
+	}
+	return encodeAPIEnvelope(apiEnvelope{OK: true, Result: result})
+}
+
+func invokeAPIHandler(m *apiMethod, params json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			GoLog("[API] Panic in %s: %v\n", m.Name, r)
+			err = fmt.Errorf("%s panicked: %v", m.Name, r)
+		}
+	}()
+	return m.handler(params)
+}
+
+// SetEventSink installs the receiver for pushed events; nil removes it.
+// Only guaranteed events (see event_bus.go) are kept while no sink is set.
+func SetEventSink(sink EventSink) {
+	backendEventBus.setSink(sink)
+	eventLoopOnce.Do(func() { go backendEventBus.run() })
+}
+
+// emitBackendEvent never blocks the producer; the bus applies the topic's
+// drop, coalesce or guaranteed policy when the sink falls behind.
+func emitBackendEvent(eventType string, payload interface{}) {
+	emitKeyedBackendEvent(eventType, "", payload)
+}
+
+// emitKeyedBackendEvent is emitBackendEvent for coalescing topics: a pending
+// event with the same key is replaced. Without a key the topic keeps one
+// pending event.
+func emitKeyedBackendEvent(eventType, key string, payload interface{}) {
+	if !backendEventBus.accepts(eventType) {
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		GoLog("[API] Failed to encode %s event: %v\n", eventType, err)
+		return
+	}
+	backendEventBus.publish(eventType, key, string(data))
+}
+
+func listAPIMethods() []apiMethod {
+	apiMethodsMu.RLock()
+	defer apiMethodsMu.RUnlock()
+
+	methods := make([]apiMethod, 0, len(apiMethods))
+	for _, m := range apiMethods {
+		methods = append(methods, apiMethod{Name: m.Name, Params: m.Params, Doc: m.Doc})
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+	return methods
+}
+
+func init() {
+	registerAPIMethod("api.methods", "", "Lists registered methods with their docs.",
+		func(json.RawMessage) (interface{}, error) {
+			return listAPIMethods(), nil
+		})
+	registerAPIMethod("api.events.dropped", "", "Number of pushed events dropped because the sink fell behind.",
+		func(json.RawMessage) (interface{}, error) {
+			return backendEventBus.dropped(), nil
+		})
+	registerAPIMethod("api.events.stats", "", "Per-topic event queue policy, backlog and delivered/dropped/coalesced counts.",
+		func(json.RawMessage) (interface{}, error) {
+			return EventBusStats(), nil
+		})
+
+	registerAPIMethod("config.get", "", "Returns the current BackendConfig.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetBackendConfig(), nil
+		})
+	registerAPIMethod("config.set", "partial BackendConfig object", "Merges and persists config fields.",
+		func(params json.RawMessage) (interface{}, error) {
+			if err := SetBackendConfigJSON(string(params)); err != nil {
+				return nil, err
+			}
+			return GetBackendConfig(), nil
+		})
+	registerAPIMethod("config.reset", "", "Restores default config.",
+		func(json.RawMessage) (interface{}, error) {
+			return nil, ResetBackendConfig()
+		})
+	registerAPIMethod("config.changes", "", "Returns and clears queued config change events.",
+		func(json.RawMessage) (interface{}, error) {
+			return rawJSON(PollConfigChangesJSON())
+		})
+
+	registerAPIMethod("download.track", "DownloadRequest", "Downloads a track using the request's routing strategy.",
+		func(params json.RawMessage) (interface{}, error) {
+			return rawJSON(DownloadByStrategy(string(params)))
+		})
+	registerAPIMethod("download.progress", "", "Returns progress of all active items.",
+		func(json.RawMessage) (interface{}, error) {
+			return json.RawMessage(GetMultiProgress()), nil
+		})
+	registerAPIMethod("download.stages", `{"item_id": string}`, "Returns the audio/cover/lyrics/tag task states of one item.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ItemID string `json:"item_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{
+				"stages":       GetItemStages(p.ItemID),
+				"failed_stage": FailedStage(p.ItemID),
+			}, nil
+		})
+	registerAPIMethod("download.events", "", "Returns and clears queued download events.",
+		func(json.RawMessage) (interface{}, error) {
+			return rawJSON(PollDownloadEventsJSON())
+		})
+	registerAPIMethod("download.metadata.update", `{"item_id": string, "patch": QueuedMetadataPatch}`,
+		"Edits a queued item's title, artist, numbering etc.; the edits are used for its filename and tags.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ItemID string          `json:"item_id"`
+				Patch  json.RawMessage `json:"patch"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return rawJSON(UpdateQueuedItemMetadata(p.ItemID, string(p.Patch)))
+		})
+	registerAPIMethod("download.metadata.get", `{"item_id": string}`, "Returns a queued item's pending metadata edits.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ItemID string `json:"item_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return rawJSON(GetQueuedItemMetadata(p.ItemID))
+		})
+	registerAPIMethod("download.metadata.clear", `{"item_id": string}`, "Discards a queued item's metadata edits.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ItemID string `json:"item_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			ClearQueuedItemMetadata(p.ItemID)
+			return nil, nil
+		})
+	registerAPIMethod("download.trace", `{"item_id": string}`, "Returns an active or recent download's spans as OTLP/JSON.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ItemID string `json:"item_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return rawJSON(GetDownloadTraceJSON(p.ItemID))
+		})
+	registerAPIMethod("download.traces", "", "Summarises recent download traces with the time spent per span.",
+		func(json.RawMessage) (interface{}, error) {
+			return rawJSON(ListDownloadTracesJSON())
+		})
+	registerAPIMethod("download.traces.export", `{"endpoint": string}`, "Debug builds: pushes finished traces to an OTLP/HTTP collector; empty stops.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Endpoint string `json:"endpoint"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return nil, SetDownloadTraceExportEndpoint(p.Endpoint)
+		})
+
+	registerAPIMethod("notifications.get", "", "Returns NotificationOptions.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetNotificationOptions(), nil
+		})
+	registerAPIMethod("notifications.set", "NotificationOptions", "Replaces NotificationOptions.",
+		func(params json.RawMessage) (interface{}, error) {
+			return nil, SetNotificationOptionsJSON(string(params))
+		})
+
+	registerAPIMethod("logs.sinks.get", "", "Returns the memory, stdout, file and logcat sink configuration.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetLogSinks(), nil
+		})
+	registerAPIMethod("logs.sinks.set", "LogSinkConfig", "Replaces the log sinks; omitted sinks are disabled, except memory and stdout.",
+		func(params json.RawMessage) (interface{}, error) {
+			return nil, SetLogSinksJSON(string(params))
+		})
+	registerAPIMethod("logs.files", "", "Lists the file sink's log files, current first.",
+		func(json.RawMessage) (interface{}, error) {
+			return LogFiles(), nil
+		})
+
+	registerAPIMethod("fds.report", "", "Reports open, leaked and double-closed SAF output descriptors with their dup lineage.",
+		func(json.RawMessage) (interface{}, error) {
+			return OutputFDReportSnapshot(), nil
+		})
+
+	registerAPIMethod("i18n.locale.get", "", "Returns the active locale and the supported ones.",
+		func(json.RawMessage) (interface{}, error) {
+			return map[string]interface{}{"locale": GetLocale(), "supported": SupportedLocales()}, nil
+		})
+	registerAPIMethod("i18n.locale.set", `{"locale": string}`, "Selects the language of localized errors and status messages.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Locale string `json:"locale"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return nil, SetLocale(p.Locale)
+		})
+	registerAPIMethod("i18n.localize", `{"key": string, "args": object}`, "Renders a catalog message; a count arg selects the plural form.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Key  string                 `json:"key"`
+				Args map[string]interface{} `json:"args"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			text := Localize(p.Key, p.Args)
+			if text == "" {
+				return nil, fmt.Errorf("message not found: %s", p.Key)
+			}
+			return text, nil
+		})
+
+	registerAPIMethod("health.providers", "", "Returns circuit breaker state per provider.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetProviderHealthTracker().Snapshot(), nil
+		})
+	registerAPIMethod("health.reset", `{"provider": string}`, "Resets one provider's breaker, or all when empty.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Provider string `json:"provider"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			ResetProviderHealth(p.Provider)
+			return nil, nil
+		})
+
+	registerAPIMethod("stats.get", `{"period": string}`, "Download statistics for all, week, month, year, YYYY or YYYY-MM, plus achievements.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Period string `json:"period"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return rawJSON(GetStatsJSON(p.Period))
+		})
+	registerAPIMethod("stats.history.import", `{"records": [DownloadHistoryRecord]}`, "Seeds the stats history with Flutter's existing downloads; duplicates are skipped.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Records json.RawMessage `json:"records"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			added, err := ImportDownloadHistoryJSON(string(p.Records))
+			if err != nil {
+				return nil, err
+			}
+			return map[string]int{"added": added}, nil
+		})
+	registerAPIMethod("stats.journal.check", "", "Checks the download job journal for damaged records, illegal transitions and history gaps.",
+		func(json.RawMessage) (interface{}, error) {
+			return CheckJobJournal()
+		})
+	registerAPIMethod("stats.journal.interrupted", "", "Downloads a crash interrupted, with their requests, until re-queued under the same item ID or acknowledged.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetInterruptedJobs(), nil
+		})
+	registerAPIMethod("stats.journal.acknowledge", `{"job_id": string}`, "Drops an interrupted download that will not be re-queued.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				JobID string `json:"job_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return nil, AcknowledgeInterruptedJob(p.JobID)
+		})
+
+	registerAPIMethod("library.retag", `{"paths": [string], "options": {"dry_run": bool, "search_online": bool, "cover": bool, "lyrics": bool, "overwrite": bool}}`,
+		"Re-tags existing files with fresh metadata, cover and lyrics; dry_run only reports the changes.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Paths   []string     `json:"paths"`
+				Options RetagOptions `json:"options"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if len(p.Paths) == 0 {
+				return nil, fmt.Errorf("paths is required")
+			}
+			return RetagFiles(p.Paths, p.Options), nil
+		})
+	registerAPIMethod("library.retag.release", `{"scratch_id": string}`,
+		"Deletes the covers a retag batch handed to FFmpeg.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ScratchID string `json:"scratch_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if !strings.HasPrefix(p.ScratchID, "retag_") {
+				return nil, fmt.Errorf("invalid scratch_id")
+			}
+			ReleaseScratchDir(p.ScratchID)
+			return nil, nil
+		})
+	registerAPIMethod("library.cue", "CueSheetRequest", "Writes a CUE sheet for a single-file album and optionally splits the FLAC into tagged tracks.",
+		func(params json.RawMessage) (interface{}, error) {
+			var req CueSheetRequest
+			if err := decodeAPIParams(params, &req); err != nil {
+				return nil, err
+			}
+			return WriteCueSheet(req)
+		})
+	registerAPIMethod("library.flac.optimize", `{"paths": [string], "reencode": bool}`,
+		"Strips oversized padding and foreign metadata from FLACs; reencode also recompresses the audio at level 8.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Paths    []string `json:"paths"`
+				Reencode bool     `json:"reencode"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if len(p.Paths) == 0 {
+				return nil, fmt.Errorf("paths is required")
+			}
+			return OptimizeFLACFiles(p.Paths, p.Reencode), nil
+		})
+	registerAPIMethod("library.qc", `{"paths": [string]}`,
+		"Decodes files and reports long leading/trailing silence, clipping and dropouts.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Paths []string `json:"paths"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if len(p.Paths) == 0 {
+				return nil, fmt.Errorf("paths is required")
+			}
+			return CheckAudioQualityFiles(p.Paths), nil
+		})
+	registerAPIMethod("library.spectrogram", `{"path": string, "width": int, "height": int}`,
+		"Renders a FLAC or WAV file's spectrogram as a base64 PNG for spotting lossy transcodes.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Path   string `json:"path"`
+				Width  int    `json:"width"`
+				Height int    `json:"height"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			data, err := GenerateSpectrogram(strings.TrimSpace(p.Path), p.Width, p.Height)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{"mime_type": "image/png", "png": data}, nil
+		})
+	registerAPIMethod("library.downconvert", `{"paths": [string], "options": DownconvertConfig}`,
+		"Converts FLACs to at most 16/44.1 or 24/48, optionally keeping the originals.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Paths   []string          `json:"paths"`
+				Options DownconvertConfig `json:"options"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if len(p.Paths) == 0 {
+				return nil, fmt.Errorf("paths is required")
+			}
+			if err := p.Options.validate(); err != nil {
+				return nil, err
+			}
+			return DownconvertFLACFiles(p.Paths, p.Options), nil
+		})
+	registerAPIMethod("library.mobile_copy", `{"paths": [string], "options": MobileCopyConfig}`,
+		"Writes Opus/AAC companions of FLAC masters into a mirrored mobile folder; options default to the configured mobile_copy.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Paths   []string          `json:"paths"`
+				Options *MobileCopyConfig `json:"options"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if len(p.Paths) == 0 {
+				return nil, fmt.Errorf("paths is required")
+			}
+			cfg := GetBackendConfig().MobileCopy
+			if p.Options != nil {
+				cfg = *p.Options
+			}
+			results := make([]map[string]interface{}, 0, len(p.Paths))
+			for _, path := range p.Paths {
+				entry := map[string]interface{}{"master": path}
+				if result, err := CreateMobileCopy(strings.TrimSpace(path), cfg); err != nil {
+					entry["error"] = err.Error()
+				} else {
+					entry["copy"] = result
+				}
+				results = append(results, entry)
+			}
+			return results, nil
+		})
+	registerAPIMethod("library.organize", "OrganizeRequest", "Moves files to match a folder/filename template; rolls back on failure.",
+		func(params json.RawMessage) (interface{}, error) {
+			var req OrganizeRequest
+			if err := decodeAPIParams(params, &req); err != nil {
+				return nil, err
+			}
+			return OrganizeLibrary(req)
+		})
+	registerAPIMethod("library.verify", "VerifyLibraryRequest", "Checks files for truncation/corruption and plans re-downloads from history.",
+		func(params json.RawMessage) (interface{}, error) {
+			var req VerifyLibraryRequest
+			if err := decodeAPIParams(params, &req); err != nil {
+				return nil, err
+			}
+			return VerifyLibrary(req)
+		})
+	registerAPIMethod("library.verify.cancel", "", "Stops a running library verification.",
+		func(json.RawMessage) (interface{}, error) {
+			CancelLibraryVerify()
+			return nil, nil
+		})
+	registerAPIMethod("album.assets", "AlbumAssetsRequest", "Saves an album's booklet and extra artwork next to its tracks.",
+		func(params json.RawMessage) (interface{}, error) {
+			var req AlbumAssetsRequest
+			if err := decodeAPIParams(params, &req); err != nil {
+				return nil, err
+			}
+			return DownloadAlbumAssets(req)
+		})
+	registerAPIMethod("archive.export", `{"collection_id": string, "output_path": string, "output_fd": int}`, "Zips a downloaded album or playlist with its cover and an m3u8 into a path or SAF fd.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				CollectionID string `json:"collection_id"`
+				OutputPath   string `json:"output_path"`
+				OutputFD     int    `json:"output_fd"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return ExportAsArchive(p.CollectionID, p.OutputPath, p.OutputFD)
+		})
+	registerAPIMethod("batch.finish", `{"batch_id": string}`, "Closes a download batch, runs post-batch integrations such as a Subsonic scan and returns the summary.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				BatchID string `json:"batch_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return FinishDownloadBatch(p.BatchID)
+		})
+	registerAPIMethod("subsonic.password.set", `{"password": string}`, "Encrypts and stores the password of the configured Subsonic server.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Password string `json:"password"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return nil, SetSubsonicPassword(p.Password)
+		})
+	registerAPIMethod("lan.start", `{"port": int}`, "Starts the LAN transfer server, announces it over mDNS and returns its URLs and session token.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Port int `json:"port"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return StartLANTransferServer(p.Port)
+		})
+	registerAPIMethod("lan.stop", "", "Stops the LAN transfer server.",
+		func(json.RawMessage) (interface{}, error) {
+			return nil, StopLANTransferServer()
+		})
+	registerAPIMethod("lan.status", "", "Returns whether the LAN transfer server is running.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetLANTransferStatus(), nil
+		})
+	registerAPIMethod("upload.status", "", "Lists recent cloud uploads, newest first.",
+		func(json.RawMessage) (interface{}, error) {
+			return CloudUploadStatus(), nil
+		})
+	registerAPIMethod("upload.credentials.set", "CloudUploadCredentials", "Encrypts and stores the WebDAV or S3 credentials used by cloud_upload.",
+		func(params json.RawMessage) (interface{}, error) {
+			var creds CloudUploadCredentials
+			if err := decodeAPIParams(params, &creds); err != nil {
+				return nil, err
+			}
+			credsJSON, _ := json.Marshal(creds)
+			return nil, SetCloudUploadCredentialsJSON(string(credsJSON))
+		})
+	registerAPIMethod("upload.retry", `{"id": string}`, "Re-queues a failed cloud upload.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ID string `json:"id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return nil, RetryCloudUpload(p.ID)
+		})
+	registerAPIMethod("listenbrainz.token.set", `{"token": string}`, "Validates a ListenBrainz user token, stores it encrypted and returns the user name.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Token string `json:"token"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			userName, err := SetListenBrainzToken(p.Token)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"user_name": userName}, nil
+		})
+	registerAPIMethod("listenbrainz.export", `{"output_path": string, "output_fd": int, "since": int}`, "Writes the recorded download listens as ListenBrainz JSON lines into a path or SAF fd.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				OutputPath string `json:"output_path"`
+				OutputFD   int    `json:"output_fd"`
+				Since      int64  `json:"since"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return ExportListenBrainzListens(p.OutputPath, p.OutputFD, p.Since)
+		})
+	registerAPIMethod("listenbrainz.submit", "", "Submits the download listens recorded since the last submission to ListenBrainz.",
+		func(json.RawMessage) (interface{}, error) {
+			return SubmitListenBrainzListens()
+		})
+	registerAPIMethod("deezer.arl.set", `{"arl": string}`, "Validates a Deezer ARL cookie, stores it encrypted and returns the account.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ARL string `json:"arl"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return SetDeezerARL(p.ARL)
+		})
+	registerAPIMethod("deezer.arl.clear", "", "Forgets the stored Deezer ARL and session.",
+		func(json.RawMessage) (interface{}, error) {
+			return nil, ClearDeezerARL()
+		})
+	registerAPIMethod("deezer.session.status", "", "Returns the Deezer session, logging in with the stored ARL if needed; expired is set when a re-login is required.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetDeezerSessionStatus(), nil
+		})
+	registerAPIMethod("deezer.session.refresh", "", "Fetches fresh Deezer user data and license token with the stored ARL.",
+		func(json.RawMessage) (interface{}, error) {
+			return RefreshDeezerSession(), nil
+		})
+	registerAPIMethod("qobuz.credentials", `{"refresh": bool, "user_auth_token": string}`, "Returns the Qobuz web player's app id and secrets; with a user token the working secret comes first.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Refresh       bool   `json:"refresh"`
+				UserAuthToken string `json:"user_auth_token"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return GetQobuzAppCredentials(p.Refresh, p.UserAuthToken)
+		})
+	registerAPIMethod("cover.prepare", `{"path": string, "format": string}`, "Rewrites a cover file to satisfy the cover_embed rule for mp3, m4a, opus or flac.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Path   string `json:"path"`
+				Format string `json:"format"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return nil, PrepareCoverForEmbedding(p.Path, p.Format)
+		})
+	registerAPIMethod("trash.list", "", "Lists trashed files, newest first.",
+		func(json.RawMessage) (interface{}, error) {
+			return ListTrash(), nil
+		})
+	registerAPIMethod("trash.move", `{"path": string, "reason": string}`, "Moves a file into the trash instead of deleting it.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Path   string `json:"path"`
+				Reason string `json:"reason"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return MoveToTrash(p.Path, p.Reason)
+		})
+	registerAPIMethod("trash.restore", `{"id": string, "output_path": string, "output_fd": int}`, "Restores a trashed file, to its original path unless an output is given.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ID         string `json:"id"`
+				OutputPath string `json:"output_path"`
+				OutputFD   int    `json:"output_fd"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if p.OutputPath != "" || p.OutputFD > 0 {
+				return RestoreFromTrashTo(p.ID, p.OutputPath, p.OutputFD)
+			}
+			return RestoreFromTrash(p.ID)
+		})
+	registerAPIMethod("trash.purge", `{"all": bool}`, "Deletes expired trash entries, or all of them.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				All bool `json:"all"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return map[string]int{"purged": PurgeTrash(p.All)}, nil
+		})
+	registerAPIMethod("links.spotify", `{"input": string}`, "Parses any Spotify URL, URI, short link or share text into {type, id, uri, url}.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Input string `json:"input"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return rawJSON(ParseSpotifyLink(p.Input))
+		})
+	registerAPIMethod("links.resolve", `{"input": string}`, "Maps an Apple Music, YouTube, Tidal, Qobuz, Deezer or Spotify track link to canonical metadata.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Input string `json:"input"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return rawJSON(ResolveMusicLink(p.Input))
+		})
+	registerAPIMethod("browse.chart", "BrowseChartRequest", "Top tracks worldwide or for a country from Deezer or Spotify, normalized to TrackMetadata.",
+		func(params json.RawMessage) (interface{}, error) {
+			var req BrowseChartRequest
+			if err := decodeAPIParams(params, &req); err != nil {
+				return nil, err
+			}
+			return GetBrowseChart(req)
+		})
+	registerAPIMethod("browse.new_releases", `{"provider": string, "country": string, "limit": int}`, "Recent albums and singles from Spotify or Deezer.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Provider string `json:"provider"`
+				Country  string `json:"country"`
+				Limit    int    `json:"limit"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return GetNewReleases(p.Provider, p.Country, p.Limit)
+		})
+	registerAPIMethod("browse.editorial", `{"genre_id": int, "limit": int}`, "Featured editorial playlists.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				GenreID int `json:"genre_id"`
+				Limit   int `json:"limit"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return GetEditorialPlaylists(p.GenreID, p.Limit)
+		})
+	registerAPIMethod("lookup.isrc", `{"isrcs": [string]}`, "Looks ISRCs up on Deezer, Qobuz and Spotify at once; results are cached.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ISRCs []string `json:"isrcs"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return LookupByISRC(p.ISRCs)
+		})
+	registerAPIMethod("lookup.upc", `{"upc": string}`, "Looks an album barcode up on Deezer and Spotify; results are cached.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				UPC string `json:"upc"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return LookupByUPC(p.UPC)
+		})
+	registerAPIMethod("import.push", `{"name": string, "content": string}`, "Queues links from a shared request file.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Name    string `json:"name"`
+				Content string `json:"content"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return PushImportFile(p.Name, p.Content)
+		})
+	registerAPIMethod("import.poll", "", "Returns and clears imported items.",
+		func(json.RawMessage) (interface{}, error) {
+			return rawJSON(PollImportedItemsJSON())
+		})
+	registerAPIMethod("import.watch", `{"dir": string, "interval_seconds": int}`, "Starts watching a folder; an empty dir stops it.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Dir             string `json:"dir"`
+				IntervalSeconds int    `json:"interval_seconds"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if p.Dir == "" {
+				StopImportWatchFolder()
+				return nil, nil
+			}
+			return nil, StartImportWatchFolder(p.Dir, p.IntervalSeconds)
+		})
+
+	registerAPIMethod("radio.start", "RadioRipOptions", "Starts recording a web radio stream, one file per track (experimental).",
+		func(params json.RawMessage) (interface{}, error) {
+			var opts RadioRipOptions
+			if err := decodeAPIParams(params, &opts); err != nil {
+				return nil, err
+			}
+			return nil, StartRadioRip(opts)
+		})
+	registerAPIMethod("radio.stop", "", "Stops the radio recording and returns its final status.",
+		func(json.RawMessage) (interface{}, error) {
+			return StopRadioRip(), nil
+		})
+	registerAPIMethod("radio.now_playing", `{"url": string}`, "Connects to a station and returns its name and current ICY title.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				URL string `json:"url"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return ProbeICYNowPlaying(p.URL)
+		})
+	registerAPIMethod("radio.status", "", "Returns the running radio recording, or the last one.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetRadioRipStatus(), nil
+		})
+
+	registerAPIMethod("sync.playlist", "PlaylistSyncRequest", "Diffs a playlist/album against the library.",
+		func(params json.RawMessage) (interface{}, error) {
+			var req PlaylistSyncRequest
+			if err := decodeAPIParams(params, &req); err != nil {
+				return nil, err
+			}
+			return SyncPlaylist(req)
+		})
+	registerAPIMethod("sync.schedules", "", "Lists scheduled re-syncs.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetPlaylistSyncSchedules(), nil
+		})
+	registerAPIMethod("releases.watch", "WatchArtistRequest", "Follows an artist for new releases, or updates auto_enqueue.",
+		func(params json.RawMessage) (interface{}, error) {
+			var req WatchArtistRequest
+			if err := decodeAPIParams(params, &req); err != nil {
+				return nil, err
+			}
+			return WatchArtist(req)
+		})
+	registerAPIMethod("releases.unwatch", `{"provider": string, "artist_id": string}`, "Stops following an artist.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Provider string `json:"provider"`
+				ArtistID string `json:"artist_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return nil, UnwatchArtist(p.Provider, p.ArtistID)
+		})
+	registerAPIMethod("releases.artists", "", "Lists followed artists.",
+		func(json.RawMessage) (interface{}, error) {
+			return ListWatchedArtists(), nil
+		})
+	registerAPIMethod("releases.check", `{"force": bool}`, "Checks due artists (or all with force) and returns new releases.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Force bool `json:"force"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return CheckNewReleases(p.Force)
+		})
+
+	registerAPIMethod("network.get", "", "Returns the last reported NetworkState.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetNetworkState(), nil
+		})
+	registerAPIMethod("network.set", `{"connected": bool, "type": string}`, "Reports a connectivity change; waiting downloads resume when allowed.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Connected bool   `json:"connected"`
+				Type      string `json:"type"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			SetNetworkState(p.Connected, p.Type)
+			return GetNetworkState(), nil
+		})
+
+	registerAPIMethod("network.transport.get", "", "Returns the connection pool and HTTP/2 tuning.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetTransportTuning(), nil
+		})
+	registerAPIMethod("network.transport.set", "partial TransportTuning object", "Merges and applies connection pool and HTTP/2 tuning.",
+		func(params json.RawMessage) (interface{}, error) {
+			if err := SetTransportTuningJSON(string(params)); err != nil {
+				return nil, err
+			}
+			return GetTransportTuning(), nil
+		})
+
+	registerAPIMethod("scratch.usage", "", "Reports scratch space usage per download.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetScratchUsage(), nil
+		})
+	registerAPIMethod("scratch.purge", "", "Removes scratch entries not owned by a running download.",
+		func(json.RawMessage) (interface{}, error) {
+			return PurgeScratch(), nil
+		})
+
+	registerAPIMethod("extensions.list", "", "Lists installed extensions.",
+		func(json.RawMessage) (interface{}, error) {
+			return rawJSON(GetInstalledExtensions())
+		})
+	registerAPIMethod("extensions.domains.get", `{"extension_id": string}`, "Returns manifest, user-approved and pending domains.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return GetAllowedDomains(p.ExtensionID)
+		})
+	registerAPIMethod("extensions.domains.approve", `{"extension_id": string, "domain": string}`, "Allows a domain or *.domain pattern for the extension.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+				Domain      string `json:"domain"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if err := ApproveExtensionDomain(p.ExtensionID, p.Domain); err != nil {
+				return nil, err
+			}
+			return GetAllowedDomains(p.ExtensionID)
+		})
+	registerAPIMethod("extensions.domains.revoke", `{"extension_id": string, "domain": string}`, "Removes a user approval, or dismisses a pending request.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+				Domain      string `json:"domain"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			DismissDomainApproval(p.ExtensionID, p.Domain)
+			if err := RevokeExtensionDomain(p.ExtensionID, p.Domain); err != nil {
+				return nil, err
+			}
+			return GetAllowedDomains(p.ExtensionID)
+		})
+	registerAPIMethod("extensions.domains.audit", `{"extension_id": string}`, "Returns denied requests, for one extension or all when empty.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return GetDomainAuditLog(p.ExtensionID), nil
+		})
+	registerAPIMethod("extensions.auth.pending", "", "Lists pending extension auth prompts, oldest first.",
+		func(json.RawMessage) (interface{}, error) {
+			return ListPendingAuthRequests(), nil
+		})
+	registerAPIMethod("extensions.auth.consume", `{"id": string}`, "Removes an auth prompt from the queue once its page was opened and returns it.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ID string `json:"id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return ConsumeAuthRequest(p.ID)
+		})
+	registerAPIMethod("extensions.auth.reject", `{"id": string, "reason": string}`, "Removes an auth prompt the user declined.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ID     string `json:"id"`
+				Reason string `json:"reason"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return nil, RejectAuthRequest(p.ID, p.Reason)
+		})
+	registerAPIMethod("extensions.auth.flow", `{"extension_id": string}`, "Returns the extension's latest auth flow: none, pending, succeeded, cancelled or expired.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return GetAuthFlowStatus(p.ExtensionID), nil
+		})
+	registerAPIMethod("extensions.auth.cancel", `{"extension_id": string}`, "Cancels the extension's pending auth flow and drops its prompt and PKCE state.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return nil, CancelAuthFlow(p.ExtensionID)
+		})
+	registerAPIMethod("extensions.errors", `{"extension_id": string}`, "Returns recent uncaught exceptions and console errors, for one extension or all when empty.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return GetExtensionErrors(p.ExtensionID), nil
+		})
+	registerAPIMethod("extensions.errors.clear", `{"extension_id": string}`, "Forgets recorded errors, for one extension or all when empty.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			ClearExtensionErrors(p.ExtensionID)
+			return nil, nil
+		})
+	registerAPIMethod("extensions.debug.start", `{"port": int}`, "Starts the localhost extension debug bridge and returns its address and session token.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Port int `json:"port"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return StartExtensionDebugServer(p.Port)
+		})
+	registerAPIMethod("extensions.debug.stop", "", "Stops the extension debug bridge.",
+		func(json.RawMessage) (interface{}, error) {
+			return nil, StopExtensionDebugServer()
+		})
+	registerAPIMethod("extensions.debug.status", "", "Returns whether the extension debug bridge is running.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetExtensionDebugStatus(), nil
+		})
+	registerAPIMethod("extensions.api_version", "", "Returns the extension runtime API versions this build can run.",
+		func(json.RawMessage) (interface{}, error) {
+			return map[string]int{
+				"current": GetRuntimeAPIVersion(),
+				"minimum": GetMinRuntimeAPIVersion(),
+			}, nil
+		})
+	registerAPIMethod("extensions.trust.get", `{"extension_id": string}`, "Returns the extension's signature trust level and whether it is restricted.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return GetExtensionTrust(p.ExtensionID)
+		})
+	registerAPIMethod("extensions.trust.override", `{"extension_id": string, "allow": bool}`, "Grants or withdraws auth and wildcard network access for an unsigned extension.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+				Allow       bool   `json:"allow"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if err := SetExtensionTrustOverride(p.ExtensionID, p.Allow); err != nil {
+				return nil, err
+			}
+			return GetExtensionTrust(p.ExtensionID)
+		})
+	registerAPIMethod("extensions.publishers.list", "", "Returns the community publisher keys the user trusts.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetTrustedPublisherKeys(), nil
+		})
+	registerAPIMethod("extensions.publishers.trust", `{"key_id": string, "publisher": string, "public_key": string}`, "Trusts a community publisher's ed25519 key (base64).",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				KeyID     string `json:"key_id"`
+				Publisher string `json:"publisher"`
+				PublicKey string `json:"public_key"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if err := TrustPublisherKey(p.KeyID, p.Publisher, p.PublicKey); err != nil {
+				return nil, err
+			}
+			return GetTrustedPublisherKeys(), nil
+		})
+	registerAPIMethod("extensions.publishers.untrust", `{"key_id": string}`, "Removes a community publisher key.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				KeyID string `json:"key_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if err := UntrustPublisherKey(p.KeyID); err != nil {
+				return nil, err
+			}
+			return GetTrustedPublisherKeys(), nil
+		})
+	registerAPIMethod("credentials.lock.status", "", "Returns whether extension credentials are locked behind the unlock prompt.",
+		func(json.RawMessage) (interface{}, error) {
+			return GetCredentialLockStatus(), nil
+		})
+	registerAPIMethod("credentials.lock.enable", `{"key": string, "ttl_seconds": int}`,
+		"Encrypts extension credentials under a keystore key that is only released through the unlock prompt.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				Key        string `json:"key"`
+				TTLSeconds int    `json:"ttl_seconds"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if err := EnableCredentialLock(p.Key, p.TTLSeconds); err != nil {
+				return nil, err
+			}
+			return GetCredentialLockStatus(), nil
+		})
+	registerAPIMethod("credentials.lock.disable", "", "Prompts once, then moves credentials back to the device-bound key.",
+		func(json.RawMessage) (interface{}, error) {
+			return nil, DisableCredentialLock()
+		})
+	registerAPIMethod("credentials.lock.lock", "", "Forgets the released key so the next credential read prompts again.",
+		func(json.RawMessage) (interface{}, error) {
+			LockCredentials()
+			return nil, nil
+		})
+	registerAPIMethod("extensions.headers.get", `{"extension_id": string}`, "Returns the extension's header profile selection and custom profiles.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return getExtensionHeaderConfig(p.ExtensionID), nil
+		})
+	registerAPIMethod("extensions.headers.set", `{"extension_id": string, "config": ExtensionHeaderConfig}`, "Replaces the extension's header profile configuration.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string          `json:"extension_id"`
+				Config      json.RawMessage `json:"config"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if err := SetExtensionHeaderConfigJSON(p.ExtensionID, string(p.Config)); err != nil {
+				return nil, err
+			}
+			return getExtensionHeaderConfig(p.ExtensionID), nil
+		})
+	registerAPIMethod("extensions.settings.get", `{"extension_id": string}`, "Returns the extension's settings schema and current values; secret values are left out.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string `json:"extension_id"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			return getExtensionSettingsView(p.ExtensionID)
+		})
+	registerAPIMethod("extensions.settings.set", `{"extension_id": string, "key": string, "value": any}`, "Validates one setting against the manifest schema, stores it and re-initializes the extension. A null value restores the default.",
+		func(params json.RawMessage) (interface{}, error) {
+			var p struct {
+				ExtensionID string          `json:"extension_id"`
+				Key         string          `json:"key"`
+				Value       json.RawMessage `json:"value"`
+			}
+			if err := decodeAPIParams(params, &p); err != nil {
+				return nil, err
+			}
+			if len(p.Value) == 0 {
+				p.Value = json.RawMessage("null")
+			}
+			if err := SetExtensionSetting(p.ExtensionID, p.Key, string(p.Value)); err != nil {
+				return nil, err
+			}
+			return getExtensionSettingsView(p.ExtensionID)
+		})
+}
@@ -0,0 +1,47 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func decodeTestEnvelope(t *testing.T, out string) map[string]json.RawMessage {
+	t.Helper()
+	var env map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(out), &env); err != nil {
+		t.Fatalf("invalid envelope %q: %v", out, err)
+	}
+	return env
+}
+
+func TestInvokeEnvelope(t *testing.T) {
+	out, err := Invoke("api.methods", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := decodeTestEnvelope(t, out)
+	if string(env["ok"]) != "true" {
+		t.Fatalf("expected ok envelope, got %s", out)
+	}
+	var methods []apiMethod
+	if err := json.Unmarshal(env["result"], &methods); err != nil || len(methods) == 0 {
+		t.Fatalf("expected method list, got %s", env["result"])
+	}
+
+	out, _ = Invoke("no.such.method", "{}")
+	env = decodeTestEnvelope(t, out)
+	if string(env["ok"]) != "false" || !json.Valid(env["error"]) {
+		t.Fatalf("expected error envelope, got %s", out)
+	}
+	var apiErr apiError
+	json.Unmarshal(env["error"], &apiErr)
+	if apiErr.Code != "unknown_method" {
+		t.Fatalf("unexpected error code: %+v", apiErr)
+	}
+
+	out, _ = Invoke("health.reset", "{not json")
+	json.Unmarshal(decodeTestEnvelope(t, out)["error"], &apiErr)
+	if apiErr.Code != "invalid_params" {
+		t.Fatalf("expected invalid_params, got %+v", apiErr)
+	}
+}
@@ -0,0 +1,291 @@
+package gobackend
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ==================== Archive export ====================
+//
+// ExportAsArchive packages the finished tracks of an album or playlist into a
+// zip: the audio files in collection order, an .m3u8 playlist and the album
+// cover when one was saved beside the tracks. Tracks belong to a collection
+// through DownloadRequest.CollectionID, which recordDownloadHistory keeps.
+//
+// The zip is streamed straight into the output, so a SAF "Save as" document
+// fd works without a temp copy. Audio and images are already compressed and
+// are stored as is; only the playlist is deflated. Stored entries carry their
+// CRC up front, which costs one extra read of each file but keeps the archive
+// readable by tools that dislike data descriptors.
+//
+// Tracks saved through SAF cannot be archived: their history path is a
+// content URI or a /proc/self/fd path whose descriptor closed with the
+// download (and may since point at an unrelated file). They are left out and
+// listed in Skipped with the reason, like files deleted since the download.
+
+// Reasons a collection track is left out of an archive.
+const (
+	ArchiveSkipSAF     = "saf"
+	ArchiveSkipMissing = "missing"
+)
+
+// ArchiveExportResult summarizes an exported archive.
+type ArchiveExportResult struct {
+	CollectionID string   `json:"collection_id"`
+	Tracks       int      `json:"tracks"`
+	Entries      []string `json:"entries"`
+	BytesWritten int64    `json:"bytes_written"`
+	// Skipped lists the collection tracks that are not in the archive.
+	Skipped []ArchiveSkippedTrack `json:"skipped,omitempty"`
+}
+
+// ArchiveSkippedTrack is a collection track left out of an archive.
+type ArchiveSkippedTrack struct {
+	Path   string `json:"path"`
+	Title  string `json:"title,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// archiveSkipReason returns why a history path cannot be archived, or "" when
+// it is a readable local file.
+func archiveSkipReason(path string) string {
+	if strings.Contains(path, "://") || strings.HasPrefix(path, "/proc/self/fd/") {
+		return ArchiveSkipSAF
+	}
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		return ArchiveSkipMissing
+	}
+	return ""
+}
+
+// collectionRecords returns the newest history record per file of the
+// collection, in playlist position, then disc and track, then download order.
+func collectionRecords(collectionID string) []DownloadHistoryRecord {
+	downloadHistoryMu.Lock()
+	all := loadDownloadHistoryLocked()
+	byPath := make(map[string]int)
+	var records []DownloadHistoryRecord
+	for _, record := range all {
+		if record.CollectionID != collectionID || record.FilePath == "" {
+			continue
+		}
+		if i, ok := byPath[record.FilePath]; ok {
+			records[i] = record
+			continue
+		}
+		byPath[record.FilePath] = len(records)
+		records = append(records, record)
+	}
+	downloadHistoryMu.Unlock()
+
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		if a.DiscNumber != b.DiscNumber {
+			return a.DiscNumber < b.DiscNumber
+		}
+		if a.TrackNumber != b.TrackNumber {
+			return a.TrackNumber < b.TrackNumber
+		}
+		return a.DownloadedAt < b.DownloadedAt
+	})
+	return records
+}
+
+// archiveEntryName returns a unique name for base within the archive.
+func archiveEntryName(used map[string]bool, base string) string {
+	name := base
+	ext := filepath.Ext(base)
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(base, ext), n, ext)
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// buildArchivePlaylist writes an extended M3U with paths relative to the
+// archive root.
+func buildArchivePlaylist(records []DownloadHistoryRecord, names []string) []byte {
+	var b bytes.Buffer
+	b.WriteString("#EXTM3U\n")
+	for i, record := range records {
+		seconds := -1
+		if record.DurationMS > 0 {
+			seconds = (record.DurationMS + 500) / 1000
+		}
+		title := record.Title
+		if record.Artist != "" {
+			title = record.Artist + " - " + title
+		}
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n%s\n", seconds, title, names[i])
+	}
+	return b.Bytes()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeStoredZipEntry copies path into zw uncompressed.
+func writeStoredZipEntry(zw *zip.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	crc := crc32.NewIEEE()
+	if _, err := io.Copy(crc, f); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	header := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		Modified:           info.ModTime(),
+		CRC32:              crc.Sum32(),
+		CompressedSize64:   uint64(info.Size()),
+		UncompressedSize64: uint64(info.Size()),
+	}
+	w, err := zw.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(w, f)
+	if err != nil {
+		return err
+	}
+	if written != info.Size() {
+		return fmt.Errorf("%s changed while archiving", filepath.Base(path))
+	}
+	return nil
+}
+
+// ExportAsArchive zips the downloaded tracks of collectionID into outputPath
+// or outputFD.
+func ExportAsArchive(collectionID, outputPath string, outputFD int) (*ArchiveExportResult, error) {
+	adoptOutputFD(outputFD, "")
+	defer closeOwnedOutputFD(outputFD)
+
+	collectionID = strings.TrimSpace(collectionID)
+	if collectionID == "" {
+		return nil, fmt.Errorf("collection_id is required")
+	}
+	if strings.TrimSpace(outputPath) == "" && !isFDOutput(outputFD) {
+		return nil, fmt.Errorf("output_path or output_fd is required")
+	}
+
+	result := &ArchiveExportResult{CollectionID: collectionID, Entries: []string{}}
+	var records []DownloadHistoryRecord
+	safSkipped := 0
+	for _, record := range collectionRecords(collectionID) {
+		if reason := archiveSkipReason(record.FilePath); reason != "" {
+			GoLog("[Archive] Skipping %s (%s): %s\n", record.Title, reason, record.FilePath)
+			result.Skipped = append(result.Skipped, ArchiveSkippedTrack{Path: record.FilePath, Title: record.Title, Reason: reason})
+			if reason == ArchiveSkipSAF {
+				safSkipped++
+			}
+			continue
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		if safSkipped > 0 {
+			return nil, fmt.Errorf("collection %s has no local files to archive: %d tracks were saved through SAF", collectionID, safSkipped)
+		}
+		return nil, fmt.Errorf("no downloaded files for collection %s", collectionID)
+	}
+
+	out, err := openOutputForWrite(outputPath, outputFD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive output: %w", err)
+	}
+	counter := &countingWriter{w: out}
+	zw := zip.NewWriter(counter)
+
+	fail := func(err error) (*ArchiveExportResult, error) {
+		zw.Close()
+		out.Close()
+		cleanupOutputOnError(outputPath, outputFD)
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	names := make([]string, len(records))
+	for i, record := range records {
+		names[i] = archiveEntryName(used, filepath.Base(record.FilePath))
+		if err := writeStoredZipEntry(zw, names[i], record.FilePath); err != nil {
+			return fail(fmt.Errorf("failed to archive %s: %w", names[i], err))
+		}
+		result.Entries = append(result.Entries, names[i])
+	}
+	result.Tracks = len(records)
+
+	coverPath := filepath.Join(filepath.Dir(records[0].FilePath), albumCoverFilename)
+	if info, err := os.Stat(coverPath); err == nil && info.Mode().IsRegular() {
+		name := archiveEntryName(used, albumCoverFilename)
+		if err := writeStoredZipEntry(zw, name, coverPath); err != nil {
+			return fail(fmt.Errorf("failed to archive cover: %w", err))
+		}
+		result.Entries = append(result.Entries, name)
+	}
+
+	playlistName := sanitizeFilename(firstNonEmpty(records[0].CollectionName, records[0].Album, collectionID))
+	name := archiveEntryName(used, playlistName+".m3u8")
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err == nil {
+		_, err = w.Write(buildArchivePlaylist(records, names))
+	}
+	if err != nil {
+		return fail(fmt.Errorf("failed to write playlist: %w", err))
+	}
+	result.Entries = append(result.Entries, name)
+
+	if err := zw.Close(); err != nil {
+		return fail(fmt.Errorf("failed to finish archive: %w", err))
+	}
+	if err := out.Close(); err != nil {
+		cleanupOutputOnError(outputPath, outputFD)
+		return nil, fmt.Errorf("failed to close archive: %w", err)
+	}
+	result.BytesWritten = counter.n
+	GoLog("[Archive] Exported %d tracks of %s (%d bytes, %d skipped)\n", result.Tracks, collectionID, result.BytesWritten, len(result.Skipped))
+	return result, nil
+}
+
+func ExportAsArchiveJSON(collectionID, outputPath string, outputFD int) (string, error) {
+	result, err := ExportAsArchive(collectionID, outputPath, outputFD)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,112 @@
+package gobackend
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportAsArchive(t *testing.T) {
+	if err := SetDownloadHistoryDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDownloadHistoryDir(t.TempDir())
+
+	albumDir := filepath.Join(t.TempDir(), "Alpha", "One")
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) string {
+		path := filepath.Join(albumDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	second := write("02 - Second.flac", "fLaC second")
+	first := write("01 - First.flac", "fLaC first")
+	write(albumCoverFilename, "jpeg")
+
+	history := []DownloadHistoryRecord{
+		{ItemID: "b", Title: "Second", Artist: "Alpha", FilePath: second, TrackNumber: 2, DurationMS: 61500, DownloadedAt: 1, CollectionID: "album:1", CollectionName: "One"},
+		{ItemID: "a", Title: "First", Artist: "Alpha", FilePath: first, TrackNumber: 1, DownloadedAt: 2, CollectionID: "album:1", CollectionName: "One"},
+		{ItemID: "gone", Title: "Gone", FilePath: filepath.Join(albumDir, "gone.flac"), TrackNumber: 3, DownloadedAt: 3, CollectionID: "album:1"},
+		{ItemID: "saf", Title: "Saf", FilePath: "content://com.android.externalstorage.documents/document/primary%3AMusic%2F04.flac", TrackNumber: 4, DownloadedAt: 3, CollectionID: "album:1"},
+		{ItemID: "fd", Title: "Fd", FilePath: "/proc/self/fd/0", TrackNumber: 5, DownloadedAt: 3, CollectionID: "album:1"},
+		{ItemID: "saf-only", Title: "Saf only", FilePath: "/proc/self/fd/1", DownloadedAt: 4, CollectionID: "album:3"},
+		{ItemID: "other", FilePath: first, DownloadedAt: 4, CollectionID: "album:2"},
+	}
+	data, _ := json.Marshal(history)
+	if _, err := ImportDownloadHistoryJSON(string(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "One.zip")
+	result, err := ExportAsArchive("album:1", archivePath, 0)
+	if err != nil {
+		t.Fatalf("ExportAsArchive: %v", err)
+	}
+	wantEntries := []string{"01 - First.flac", "02 - Second.flac", "cover.jpg", "One.m3u8"}
+	if strings.Join(result.Entries, "|") != strings.Join(wantEntries, "|") || result.Tracks != 2 || len(result.Skipped) != 3 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	for i, want := range []string{ArchiveSkipMissing, ArchiveSkipSAF, ArchiveSkipSAF} {
+		if result.Skipped[i].Reason != want {
+			t.Errorf("skipped[%d] = %+v, want reason %s", i, result.Skipped[i], want)
+		}
+	}
+
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if info, _ := os.Stat(archivePath); info.Size() != result.BytesWritten {
+		t.Errorf("bytes_written = %d, file is %d", result.BytesWritten, info.Size())
+	}
+	for _, f := range zr.File {
+		wantMethod := zip.Store
+		if strings.HasSuffix(f.Name, ".m3u8") {
+			wantMethod = zip.Deflate
+		}
+		if f.Method != wantMethod {
+			t.Errorf("%s method = %d, want %d", f.Name, f.Method, wantMethod)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		if f.Name == "One.m3u8" {
+			want := "#EXTM3U\n#EXTINF:-1,Alpha - First\n01 - First.flac\n#EXTINF:62,Alpha - Second\n02 - Second.flac\n"
+			if string(content) != want {
+				t.Errorf("playlist = %q", content)
+			}
+		}
+	}
+
+	if _, err := ExportAsArchive("album:missing", archivePath, 0); err == nil {
+		t.Error("expected error for unknown collection")
+	}
+	if _, err := ExportAsArchive("album:3", archivePath, 0); err == nil || !strings.Contains(err.Error(), "SAF") {
+		t.Errorf("expected SAF error, got %v", err)
+	}
+}
+
+func TestArchiveEntryNameDedupes(t *testing.T) {
+	used := make(map[string]bool)
+	if got := archiveEntryName(used, "Intro.flac"); got != "Intro.flac" {
+		t.Fatalf("got %q", got)
+	}
+	if got := archiveEntryName(used, "intro.flac"); got != "intro (2).flac" {
+		t.Fatalf("got %q", got)
+	}
+}
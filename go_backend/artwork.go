@@ -0,0 +1,182 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	artistImageFilename = "artist.jpg"
+	albumCoverFilename  = "cover.jpg"
+	artistImageTimeout  = 20 * time.Second
+)
+
+// FolderArtworkRequest describes where a folder-level image should be written.
+// On Android SAF targets Flutter creates the document and passes OutputFD;
+// otherwise OutputDir (or an explicit OutputPath) is used.
+type FolderArtworkRequest struct {
+	ArtistName string `json:"artist_name,omitempty"`
+	CoverURL   string `json:"cover_url,omitempty"`
+	OutputDir  string `json:"output_dir,omitempty"`
+	OutputPath string `json:"output_path,omitempty"`
+	OutputFD   int    `json:"output_fd,omitempty"`
+	MaxQuality bool   `json:"max_quality"`
+	Overwrite  bool   `json:"overwrite"`
+}
+
+type FolderArtworkResult struct {
+	Success  bool   `json:"success"`
+	FilePath string `json:"file_path,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	SizeKB   int    `json:"size_kb,omitempty"`
+}
+
+// GetArtistImageURL looks up an artist picture and applies the same CDN
+// upgrade rules used for track covers.
+func GetArtistImageURL(artistName string, maxQuality bool) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), artistImageTimeout)
+	defer cancel()
+
+	imageURL, err := GetDeezerClient().SearchArtistImage(ctx, artistName)
+	if err != nil {
+		return "", err
+	}
+	if maxQuality {
+		imageURL = upgradeToMaxQuality(imageURL)
+	}
+	return imageURL, nil
+}
+
+func resolveArtworkPath(req FolderArtworkRequest, filename string) (string, error) {
+	if isFDOutput(req.OutputFD) {
+		return "", nil
+	}
+	if path := strings.TrimSpace(req.OutputPath); path != "" {
+		return path, nil
+	}
+	dir := strings.TrimSpace(req.OutputDir)
+	if dir == "" {
+		return "", fmt.Errorf("output_dir, output_path or output_fd is required")
+	}
+	return filepath.Join(dir, filename), nil
+}
+
+func writeArtworkFile(imageURL string, req FolderArtworkRequest, filename string) (*FolderArtworkResult, error) {
+	outputPath, err := resolveArtworkPath(req, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if outputPath != "" && !req.Overwrite {
+		if info, statErr := os.Stat(outputPath); statErr == nil && info.Size() > 0 {
+			return &FolderArtworkResult{Success: true, FilePath: outputPath, ImageURL: imageURL, Skipped: true}, nil
+		}
+	}
+
+	data, err := downloadCoverToMemory(imageURL, req.MaxQuality)
+	if err != nil {
+		return nil, err
+	}
+
+	if outputPath != "" {
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create artwork directory: %w", err)
+		}
+	}
+
+	out, err := openOutputForWrite(outputPath, req.OutputFD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artwork output: %w", err)
+	}
+	_, writeErr := out.Write(data)
+	closeErr := out.Close()
+	if writeErr != nil {
+		cleanupOutputOnError(outputPath, req.OutputFD)
+		return nil, fmt.Errorf("failed to write artwork: %w", writeErr)
+	}
+	if closeErr != nil {
+		cleanupOutputOnError(outputPath, req.OutputFD)
+		return nil, fmt.Errorf("failed to close artwork file: %w", closeErr)
+	}
+
+	GoLog("[Artwork] Saved %s (%d KB)\n", filename, len(data)/1024)
+	return &FolderArtworkResult{
+		Success:  true,
+		FilePath: outputPath,
+		ImageURL: imageURL,
+		SizeKB:   len(data) / 1024,
+	}, nil
+}
+
+// SaveArtistImage writes artist.jpg into the artist folder.
+func SaveArtistImage(req FolderArtworkRequest) (*FolderArtworkResult, error) {
+	imageURL, err := GetArtistImageURL(req.ArtistName, req.MaxQuality)
+	if err != nil {
+		return nil, err
+	}
+	return writeArtworkFile(imageURL, req, artistImageFilename)
+}
+
+// SaveAlbumFolderCover writes cover.jpg into the album folder.
+func SaveAlbumFolderCover(req FolderArtworkRequest) (*FolderArtworkResult, error) {
+	if strings.TrimSpace(req.CoverURL) == "" {
+		return nil, fmt.Errorf("no cover URL provided")
+	}
+	return writeArtworkFile(req.CoverURL, req, albumCoverFilename)
+}
+
+func GetArtistImageURLJSON(artistName string, maxQuality bool) (string, error) {
+	imageURL, err := GetArtistImageURL(artistName, maxQuality)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(map[string]string{"artist_name": artistName, "image_url": imageURL})
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func SaveArtistImageJSON(requestJSON string) (string, error) {
+	var req FolderArtworkRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid request: %w", err)
+	}
+	adoptOutputFD(req.OutputFD, "")
+	defer closeOwnedOutputFD(req.OutputFD)
+
+	result, err := SaveArtistImage(req)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func SaveAlbumFolderCoverJSON(requestJSON string) (string, error) {
+	var req FolderArtworkRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid request: %w", err)
+	}
+	adoptOutputFD(req.OutputFD, "")
+	defer closeOwnedOutputFD(req.OutputFD)
+
+	result, err := SaveAlbumFolderCover(req)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,404 @@
+package gobackend
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ==================== Audio QC ====================
+//
+// VerifyLibrary only proves a file is structurally whole. A provider can
+// still hand back a stream that decodes fine but is wrong: a minute of
+// silence before the music, a hard-clipped transcode, or holes where the
+// source had gaps. The QC pass has FFmpeg decode the file to 16-bit WAV and
+// scans the samples for:
+//
+//	leading/trailing silence  longer than qcLeadingSilence/qcTrailingSilence
+//	clipping                  runs of full-scale samples
+//	dropouts                  all-zero spans between non-silent audio; a
+//	                          span cut straight out of loud audio on both
+//	                          sides fails, one the music fades into is
+//	                          intentional silence and only warns
+//
+// BackendConfig.AudioQC decides what happens after a download:
+//
+//	off         no check
+//	flag        the report is attached to the response and the history
+//	redownload  like flag, and a failed file makes DownloadWithFallback try
+//	            the next provider; the best failed candidate is kept and
+//	            used when no provider passes
+
+const (
+	AudioQCOff        = "off"
+	AudioQCFlag       = "flag"
+	AudioQCRedownload = "redownload"
+
+	QCStatusOK      = "ok"
+	QCStatusWarning = "warning"
+	QCStatusFailed  = "failed"
+
+	QCIssueLeadingSilence  = "leading_silence"
+	QCIssueTrailingSilence = "trailing_silence"
+	QCIssueSilent          = "silent"
+	QCIssueClipping        = "clipping"
+	QCIssueDropout         = "dropout"
+
+	// qcSilenceLevel is about -60 dBFS at 16 bits.
+	qcSilenceLevel    = 32
+	qcLeadingSilence  = 5 * time.Second
+	qcTrailingSilence = 10 * time.Second
+	qcMinDropout      = 250 * time.Millisecond
+	// A clip is qcClipSamples full-scale samples in a row on one channel;
+	// mastered pop peaks at 0 dBFS now and then, so a few are tolerated.
+	qcClipSamples   = 3
+	qcClipWarnRuns  = 50
+	qcDecodeTimeout = 5 * time.Minute
+)
+
+// AudioQCIssue is one finding. Clipping has no single position, so it only
+// carries Count.
+type AudioQCIssue struct {
+	Kind       string `json:"kind"`
+	Severity   string `json:"severity"`
+	StartMs    int64  `json:"start_ms,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Count      int    `json:"count,omitempty"`
+}
+
+type AudioQCReport struct {
+	Path       string         `json:"path,omitempty"`
+	Status     string         `json:"status"`
+	DurationMs int64          `json:"duration_ms"`
+	Issues     []AudioQCIssue `json:"issues,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+func audioQCPolicy() string {
+	return GetBackendConfig().AudioQC
+}
+
+// Summary lists the issue kinds for the history record.
+func (r *AudioQCReport) Summary() []string {
+	kinds := make([]string, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	return kinds
+}
+
+func (r *AudioQCReport) add(issue AudioQCIssue) {
+	r.Issues = append(r.Issues, issue)
+	if issue.Severity == QCStatusFailed || r.Status == QCStatusOK {
+		r.Status = issue.Severity
+	}
+}
+
+// readWAVHeader returns the sample rate and channel count of a 16-bit PCM
+// WAV and leaves r at the first sample. FFmpeg may leave the data size at
+// its streaming placeholder, so the data chunk is read to EOF.
+func readWAVHeader(r *bufio.Reader) (sampleRate, channels int, err error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return 0, 0, fmt.Errorf("not a WAV file")
+	}
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return 0, 0, fmt.Errorf("WAV has no data chunk")
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < 16 {
+				return 0, 0, fmt.Errorf("WAV format chunk is too short")
+			}
+			format := make([]byte, size+size&1)
+			if _, err := io.ReadFull(r, format); err != nil {
+				return 0, 0, err
+			}
+			channels = int(binary.LittleEndian.Uint16(format[2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(format[4:]))
+			if bits := binary.LittleEndian.Uint16(format[14:]); bits != 16 {
+				return 0, 0, fmt.Errorf("WAV has %d-bit samples, want 16", bits)
+			}
+		case "data":
+			if sampleRate <= 0 || channels <= 0 {
+				return 0, 0, fmt.Errorf("WAV data before its format")
+			}
+			return sampleRate, channels, nil
+		default:
+			if _, err := r.Discard(int(size + size&1)); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+}
+
+// qcZeroSpan is a run of all-zero frames [start, end). abrupt means loud
+// audio sits right before and right after it.
+type qcZeroSpan struct {
+	start, end int64
+	abrupt     bool
+}
+
+// analyzePCM scans interleaved signed 16-bit little-endian samples.
+func analyzePCM(r io.Reader, sampleRate, channels int) (*AudioQCReport, error) {
+	br := bufio.NewReaderSize(r, 1<<16)
+	frame := make([]byte, 2*channels)
+	clipRun := make([]int, channels)
+	toMs := func(frames int64) int64 { return frames * 1000 / int64(sampleRate) }
+
+	var (
+		frames           int64
+		firstLoud        int64 = -1
+		lastLoud         int64 = -1
+		zeroStart        int64 = -1
+		prevLoud         bool
+		cutIn            bool
+		clipRuns         int
+		dropouts         []qcZeroSpan
+		minDropoutFrames = int64(qcMinDropout) * int64(sampleRate) / int64(time.Second)
+	)
+	for {
+		if _, err := io.ReadFull(br, frame); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+		loud, zero := false, true
+		for ch := 0; ch < channels; ch++ {
+			s := int16(binary.LittleEndian.Uint16(frame[2*ch:]))
+			if s != 0 {
+				zero = false
+			}
+			if s > qcSilenceLevel || s < -qcSilenceLevel {
+				loud = true
+			}
+			if s == 32767 || s == -32768 {
+				clipRun[ch]++
+				if clipRun[ch] == qcClipSamples {
+					clipRuns++
+				}
+			} else {
+				clipRun[ch] = 0
+			}
+		}
+		switch {
+		case zero && zeroStart < 0:
+			zeroStart, cutIn = frames, prevLoud
+		case !zero && zeroStart >= 0:
+			if firstLoud >= 0 && frames-zeroStart >= minDropoutFrames {
+				dropouts = append(dropouts, qcZeroSpan{start: zeroStart, end: frames, abrupt: cutIn && loud})
+			}
+			zeroStart = -1
+		}
+		if loud {
+			if firstLoud < 0 {
+				firstLoud = frames
+			}
+			lastLoud = frames
+		}
+		prevLoud = loud
+		frames++
+	}
+
+	report := &AudioQCReport{Status: QCStatusOK, DurationMs: toMs(frames)}
+	if frames == 0 || firstLoud < 0 {
+		report.add(AudioQCIssue{Kind: QCIssueSilent, Severity: QCStatusFailed, DurationMs: toMs(frames)})
+		return report, nil
+	}
+	if lead := toMs(firstLoud); lead > qcLeadingSilence.Milliseconds() {
+		report.add(AudioQCIssue{Kind: QCIssueLeadingSilence, Severity: QCStatusWarning, DurationMs: lead})
+	}
+	if trail := toMs(frames - lastLoud - 1); trail > qcTrailingSilence.Milliseconds() {
+		report.add(AudioQCIssue{Kind: QCIssueTrailingSilence, Severity: QCStatusWarning, StartMs: toMs(lastLoud + 1), DurationMs: trail})
+	}
+	for _, span := range dropouts {
+		// A zero run that only quiet noise follows is the fade-out.
+		if span.end > lastLoud {
+			continue
+		}
+		severity := QCStatusWarning
+		if span.abrupt {
+			severity = QCStatusFailed
+		}
+		report.add(AudioQCIssue{Kind: QCIssueDropout, Severity: severity, StartMs: toMs(span.start), DurationMs: toMs(span.end - span.start)})
+	}
+	if clipRuns >= qcClipWarnRuns {
+		report.add(AudioQCIssue{Kind: QCIssueClipping, Severity: QCStatusWarning, Count: clipRuns})
+	}
+	return report, nil
+}
+
+func buildAudioQCDecodeCommand(inputPath, outputPath string) string {
+	return strings.Join([]string{
+		"-y", "-i", fmt.Sprintf("%q", inputPath),
+		"-map", "0:a:0", "-c:a", "pcm_s16le", "-f", "wav",
+		fmt.Sprintf("%q", outputPath),
+	}, " ")
+}
+
+// CheckAudioQuality decodes path through FFmpeg and analyzes the samples.
+func CheckAudioQuality(path string) (*AudioQCReport, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	wavPath := path + ".qc.wav"
+	defer os.Remove(wavPath)
+	cmd, err := runQueuedFFmpeg("audio_qc", buildAudioQCDecodeCommand(path, wavPath), path, wavPath, qcDecodeTimeout)
+	if err == nil && !cmd.Success {
+		err = fmt.Errorf("%s", firstNonEmpty(cmd.Error, "FFmpeg decode failed"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(wavPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, 1<<16)
+	sampleRate, channels, err := readWAVHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	report, err := analyzePCM(br, sampleRate, channels)
+	if err != nil {
+		return nil, err
+	}
+	report.Path = path
+	return report, nil
+}
+
+// CheckAudioQualityFiles runs CheckAudioQuality over paths, recording
+// failures per file instead of stopping.
+func CheckAudioQualityFiles(paths []string) []AudioQCReport {
+	reports := make([]AudioQCReport, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		report, err := CheckAudioQuality(path)
+		if err != nil {
+			GoLog("[AudioQC] %s: %v\n", filepath.Base(path), err)
+			report = &AudioQCReport{Path: path, Error: err.Error()}
+		}
+		reports = append(reports, *report)
+	}
+	return reports
+}
+
+// qcDownloadedFile checks a fresh path output. A file that cannot be
+// decoded is left alone: VerifyLibrary is the tool for broken containers.
+func qcDownloadedFile(req DownloadRequest, path string) *AudioQCReport {
+	if isFDOutput(req.OutputFD) || path == "" || strings.HasPrefix(path, "content://") {
+		return nil
+	}
+	if req.ItemID != "" {
+		SetItemFinalizing(req.ItemID)
+	}
+	report, err := CheckAudioQuality(path)
+	if err != nil {
+		GoLog("[AudioQC] %s: %v\n", filepath.Base(path), err)
+		return nil
+	}
+	if report.Status != QCStatusOK {
+		GoLog("[AudioQC] %s: %s %v\n", filepath.Base(path), report.Status, report.Summary())
+	}
+	return report
+}
+
+// qcFailureWeight orders failed reports for keeping the best candidate:
+// fewer failed issues first, then less failed audio.
+func qcFailureWeight(r *AudioQCReport) (issues int, ms int64) {
+	for _, issue := range r.Issues {
+		if issue.Severity == QCStatusFailed {
+			issues++
+			ms += max(issue.DurationMs, 1)
+		}
+	}
+	return issues, ms
+}
+
+// qcBetter reports whether a has fewer QC failures than b.
+func qcBetter(a, b *AudioQCReport) bool {
+	ai, ams := qcFailureWeight(a)
+	bi, bms := qcFailureWeight(b)
+	return ai < bi || ai == bi && ams < bms
+}
+
+// qcHeldCandidate keeps the best download that failed QC in redownload
+// mode, moved aside so the next provider can write the same path.
+type qcHeldCandidate struct {
+	service string
+	result  DownloadResult
+	report  *AudioQCReport
+	path    string
+}
+
+// keep holds result if it beats the current candidate and deletes the
+// loser. It returns false when the file could not be moved aside, in which
+// case the caller should accept it as is.
+func (h *qcHeldCandidate) keep(service string, result DownloadResult, report *AudioQCReport) bool {
+	if h.report != nil && !qcBetter(report, h.report) {
+		os.Remove(result.FilePath)
+		return true
+	}
+	h.discard()
+	heldPath := result.FilePath + ".qc-held"
+	if err := os.Rename(result.FilePath, heldPath); err != nil {
+		GoLog("[AudioQC] Failed to set %s aside: %v\n", filepath.Base(result.FilePath), err)
+		return false
+	}
+	h.service, h.result, h.report, h.path = service, result, report, heldPath
+	return true
+}
+
+// restore moves the held file back to its output path.
+func (h *qcHeldCandidate) restore() (DownloadResult, string, *AudioQCReport, bool) {
+	if h.path == "" {
+		return DownloadResult{}, "", nil, false
+	}
+	if err := os.Rename(h.path, h.result.FilePath); err != nil {
+		GoLog("[AudioQC] Failed to restore %s: %v\n", filepath.Base(h.result.FilePath), err)
+		return DownloadResult{}, "", nil, false
+	}
+	h.path = ""
+	return h.result, h.service, h.report, true
+}
+
+// discard deletes the held file, once a better download was accepted.
+func (h *qcHeldCandidate) discard() {
+	if h.path != "" {
+		os.Remove(h.path)
+	}
+	*h = qcHeldCandidate{}
+}
+
+// attachAudioQC runs the QC pass on a successful download unless the
+// fallback loop already did.
+func attachAudioQC(req DownloadRequest, respJSON string) string {
+	if audioQCPolicy() == AudioQCOff {
+		return respJSON
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success || resp.AlreadyExists || resp.QC != nil {
+		return respJSON
+	}
+	resp.QC = qcDownloadedFile(req, strings.TrimSpace(resp.FilePath))
+	if resp.QC == nil {
+		return respJSON
+	}
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return respJSON
+	}
+	return string(jsonBytes)
+}
@@ -0,0 +1,148 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPCM builds stereo 16-bit samples at 1 kHz from (value, ms) spans.
+func testPCM(spans ...[2]int) []byte {
+	var buf bytes.Buffer
+	for _, span := range spans {
+		for i := 0; i < span[1]; i++ {
+			v := int16(span[0])
+			if v != 0 && v != 32767 && i%2 == 1 {
+				v = -v
+			}
+			binary.Write(&buf, binary.LittleEndian, [2]int16{v, v})
+		}
+	}
+	return buf.Bytes()
+}
+
+func testWAV(pcm []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xffffffff))
+	buf.WriteString("WAVE")
+	buf.WriteString("LIST")
+	binary.Write(&buf, binary.LittleEndian, uint32(3))
+	buf.Write([]byte("abc\x00"))
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, []uint32{16, 2<<16 | 1, 1000, 4000, 16<<16 | 4})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xffffffff))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+func TestAnalyzePCM(t *testing.T) {
+	tests := []struct {
+		name   string
+		pcm    []byte
+		status string
+		kinds  []string
+	}{
+		{"clean", testPCM([2]int{8000, 3000}, [2]int{0, 500}), QCStatusOK, nil},
+		{"silent", testPCM([2]int{10, 3000}), QCStatusFailed, []string{QCIssueSilent}},
+		{"leading silence", testPCM([2]int{0, 6000}, [2]int{8000, 1000}), QCStatusWarning, []string{QCIssueLeadingSilence}},
+		{"trailing silence", testPCM([2]int{8000, 1000}, [2]int{5, 11000}), QCStatusWarning, []string{QCIssueTrailingSilence}},
+		{"dropout", testPCM([2]int{8000, 1000}, [2]int{0, 300}, [2]int{8000, 1000}), QCStatusFailed, []string{QCIssueDropout}},
+		{"intentional silence", testPCM([2]int{8000, 1000}, [2]int{5, 200}, [2]int{0, 2000}, [2]int{8000, 1000}), QCStatusWarning, []string{QCIssueDropout}},
+		{"short gap", testPCM([2]int{8000, 1000}, [2]int{0, 100}, [2]int{8000, 1000}), QCStatusOK, nil},
+		{"fade out", testPCM([2]int{8000, 1000}, [2]int{0, 400}, [2]int{5, 400}), QCStatusOK, nil},
+		{"clipping", bytes.Repeat(testPCM([2]int{32767, 4}, [2]int{8000, 10}), 60), QCStatusWarning, []string{QCIssueClipping}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := analyzePCM(bytes.NewReader(tt.pcm), 1000, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tt.status || len(report.Issues) != len(tt.kinds) {
+				t.Fatalf("report = %+v", report)
+			}
+			for i, kind := range tt.kinds {
+				if report.Issues[i].Kind != kind {
+					t.Errorf("issue %d = %+v, want %s", i, report.Issues[i], kind)
+				}
+			}
+		})
+	}
+
+	report, _ := analyzePCM(bytes.NewReader(testPCM([2]int{8000, 1000}, [2]int{0, 300}, [2]int{8000, 1000})), 1000, 2)
+	if issue := report.Issues[0]; issue.StartMs != 1000 || issue.DurationMs != 300 {
+		t.Errorf("dropout at %d ms for %d ms", issue.StartMs, issue.DurationMs)
+	}
+}
+
+func TestAttachAudioQC(t *testing.T) {
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+
+	wav := testWAV(testPCM([2]int{0, 6000}, [2]int{8000, 1000}))
+	fakeFFmpegWorker(t, func(cmd *FFmpegCommand) {
+		cmd.Success = os.WriteFile(cmd.OutputPath, wav, 0644) == nil
+	})
+
+	trackPath := filepath.Join(t.TempDir(), "Artist - Song.flac")
+	if err := os.WriteFile(trackPath, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	respJSON := `{"success":true,"message":"ok","file_path":"` + trackPath + `"}`
+	req := DownloadRequest{ItemID: "qc-1"}
+	if got := attachAudioQC(req, respJSON); got != respJSON {
+		t.Fatalf("audio_qc off should leave the response alone: %s", got)
+	}
+
+	if err := SetBackendConfigJSON(`{"audio_qc": "flag"}`); err != nil {
+		t.Fatal(err)
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(attachAudioQC(req, respJSON)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.QC == nil || resp.QC.Status != QCStatusWarning || resp.QC.DurationMs != 7000 || resp.QC.Issues[0].DurationMs != 6000 {
+		t.Fatalf("unexpected qc report %+v", resp.QC)
+	}
+	if _, err := os.Stat(trackPath + ".qc.wav"); !os.IsNotExist(err) {
+		t.Errorf("decoded WAV was left behind: %v", err)
+	}
+	if got := attachAudioQC(DownloadRequest{OutputFD: 42}, respJSON); got != respJSON {
+		t.Errorf("FD outputs should be skipped: %s", got)
+	}
+}
+
+func TestQCHeldCandidate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) DownloadResult {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(name), 0644)
+		return DownloadResult{FilePath: path}
+	}
+	oneDropout := &AudioQCReport{Status: QCStatusFailed, Issues: []AudioQCIssue{{Kind: QCIssueDropout, Severity: QCStatusFailed, DurationMs: 300}}}
+	twoDropouts := &AudioQCReport{Status: QCStatusFailed, Issues: []AudioQCIssue{
+		{Kind: QCIssueDropout, Severity: QCStatusFailed, DurationMs: 300},
+		{Kind: QCIssueDropout, Severity: QCStatusFailed, DurationMs: 300},
+	}}
+
+	held := &qcHeldCandidate{}
+	if !held.keep("tidal", write("a.flac"), twoDropouts) || !held.keep("qobuz", write("a.flac"), oneDropout) {
+		t.Fatal("keep failed")
+	}
+	if !held.keep("amazon", write("a.flac"), twoDropouts) {
+		t.Fatal("keep failed")
+	}
+	result, service, report, ok := held.restore()
+	if !ok || service != "qobuz" || report != oneDropout {
+		t.Fatalf("restored %s %+v %v", service, report, ok)
+	}
+	entries, _ := os.ReadDir(dir)
+	if data, _ := os.ReadFile(result.FilePath); len(entries) != 1 || string(data) != "a.flac" {
+		t.Errorf("left %d files behind", len(entries))
+	}
+}
@@ -0,0 +1,196 @@
+package gobackend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ==================== Auth flow deadlines ====================
+//
+// An auth flow starts when an extension asks for an auth page and ends when
+// the browser hands back its code or the PKCE exchange of its verifier
+// succeeds (succeeded), the app or user cancels it (cancelled), or its
+// deadline passes (expired). Token writes alone, e.g. a refresh, never end a
+// flow. A flow that ends without succeeding drops the extension's pending
+// auth URL, code and PKCE verifier and its queued auth request, so an
+// abandoned browser flow no longer lingers. Each extension has at most one
+// flow; starting another replaces it and settles the replaced prompt as
+// superseded. The status stays readable from JS through auth.getFlowStatus()
+// until the next flow or auth.clearAuth().
+
+const (
+	AuthFlowNone      = "none"
+	AuthFlowPending   = "pending"
+	AuthFlowSucceeded = "succeeded"
+	AuthFlowCancelled = "cancelled"
+	AuthFlowExpired   = "expired"
+
+	minAuthFlowTimeout = 30 * time.Second
+	maxAuthFlowTimeout = time.Hour
+)
+
+// AuthFlowStatus is the state of an extension's latest auth flow.
+type AuthFlowStatus struct {
+	ExtensionID string `json:"extension_id"`
+	Status      string `json:"status"`
+	RequestID   string `json:"request_id,omitempty"`
+	StartedAt   int64  `json:"started_at,omitempty"`
+	Deadline    int64  `json:"deadline,omitempty"`
+	EndedAt     int64  `json:"ended_at,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type authFlow struct {
+	status AuthFlowStatus
+	timer  *time.Timer
+}
+
+var (
+	authFlowsMu sync.Mutex
+	authFlows   = make(map[string]*authFlow)
+)
+
+// authFlowTimeout turns an extension's timeoutSeconds option into a flow
+// deadline, clamped to a sane range. Zero or missing means authRequestTTL.
+func authFlowTimeout(option interface{}) time.Duration {
+	seconds, ok := option.(float64)
+	if !ok {
+		if n, isInt := option.(int64); isInt {
+			seconds, ok = float64(n), true
+		}
+	}
+	if !ok || seconds <= 0 {
+		return authRequestTTL
+	}
+	return min(max(time.Duration(seconds*float64(time.Second)), minAuthFlowTimeout), maxAuthFlowTimeout)
+}
+
+// startAuthFlow queues the auth prompt for extensionID and starts a flow
+// that expires after timeout.
+func startAuthFlow(extensionID, authURL, callbackURL string, timeout time.Duration) PendingAuthRequest {
+	req := enqueueAuthRequest(extensionID, authURL, callbackURL, timeout)
+	now := time.Now()
+	flow := &authFlow{status: AuthFlowStatus{
+		ExtensionID: extensionID,
+		Status:      AuthFlowPending,
+		RequestID:   req.ID,
+		StartedAt:   now.Unix(),
+		Deadline:    req.ExpiresAt,
+	}}
+
+	authFlowsMu.Lock()
+	staleRequest := ""
+	if prev := authFlows[extensionID]; prev != nil {
+		prev.timer.Stop()
+		if prev.status.Status == AuthFlowPending && prev.status.RequestID != req.ID {
+			staleRequest = prev.status.RequestID
+		}
+	}
+	authFlows[extensionID] = flow
+	flow.timer = time.AfterFunc(max(time.Unix(req.ExpiresAt, 0).Sub(now), 0), func() {
+		endAuthFlow(extensionID, flow, AuthFlowExpired, "timed out")
+	})
+	authFlowsMu.Unlock()
+
+	if staleRequest != "" {
+		// Already gone when the app consumed it; nothing to report then.
+		settleAuthRequest(staleRequest, AuthRequestSuperseded, "")
+	}
+	return req
+}
+
+// endAuthFlow moves flow out of pending. It returns false when flow is no
+// longer the extension's pending flow.
+func endAuthFlow(extensionID string, flow *authFlow, status, reason string) bool {
+	authFlowsMu.Lock()
+	if authFlows[extensionID] != flow || flow.status.Status != AuthFlowPending {
+		authFlowsMu.Unlock()
+		return false
+	}
+	flow.timer.Stop()
+	flow.status.Status = status
+	flow.status.Reason = reason
+	flow.status.EndedAt = time.Now().Unix()
+	requestID := flow.status.RequestID
+	authFlowsMu.Unlock()
+
+	if status == AuthFlowSucceeded {
+		// The code may arrive before the app settled the prompt.
+		settleAuthRequest(requestID, AuthRequestConsumed, "")
+		return true
+	}
+
+	extensionAuthStateMu.Lock()
+	if state, ok := extensionAuthState[extensionID]; ok {
+		state.PendingAuthURL = ""
+		state.AuthCode = ""
+		state.PKCEVerifier = ""
+		state.PKCEChallenge = ""
+	}
+	extensionAuthStateMu.Unlock()
+
+	if status == AuthFlowExpired {
+		settleAuthRequest(requestID, AuthRequestExpired, reason)
+	} else {
+		settleAuthRequest(requestID, AuthRequestRejected, reason)
+	}
+	GoLog("[Extension:%s] Auth flow %s: %s\n", extensionID, status, reason)
+	return true
+}
+
+func pendingAuthFlow(extensionID string) *authFlow {
+	authFlowsMu.Lock()
+	defer authFlowsMu.Unlock()
+	if flow := authFlows[extensionID]; flow != nil && flow.status.Status == AuthFlowPending {
+		return flow
+	}
+	return nil
+}
+
+// completeAuthFlow marks the pending flow of extensionID succeeded, if any.
+func completeAuthFlow(extensionID string) {
+	if flow := pendingAuthFlow(extensionID); flow != nil {
+		endAuthFlow(extensionID, flow, AuthFlowSucceeded, "")
+	}
+}
+
+// cancelAuthFlowForRequest ends the flow that queued request id, after the
+// app rejected the prompt.
+func cancelAuthFlowForRequest(extensionID, id, reason string) {
+	if flow := pendingAuthFlow(extensionID); flow != nil && flow.status.RequestID == id {
+		endAuthFlow(extensionID, flow, AuthFlowCancelled, reason)
+	}
+}
+
+// forgetAuthFlow drops the flow of extensionID without settling anything;
+// used when its auth state is cleared.
+func forgetAuthFlow(extensionID string) {
+	authFlowsMu.Lock()
+	if flow := authFlows[extensionID]; flow != nil {
+		flow.timer.Stop()
+		delete(authFlows, extensionID)
+	}
+	authFlowsMu.Unlock()
+}
+
+// CancelAuthFlow abandons the pending auth flow of extensionID, e.g. when the
+// user closed the browser without signing in.
+func CancelAuthFlow(extensionID string) error {
+	flow := pendingAuthFlow(extensionID)
+	if flow == nil || !endAuthFlow(extensionID, flow, AuthFlowCancelled, "cancelled by user") {
+		return fmt.Errorf("no pending auth flow for %s", extensionID)
+	}
+	return nil
+}
+
+// GetAuthFlowStatus returns the latest auth flow of extensionID, with status
+// none when it never started one.
+func GetAuthFlowStatus(extensionID string) AuthFlowStatus {
+	authFlowsMu.Lock()
+	defer authFlowsMu.Unlock()
+	if flow := authFlows[extensionID]; flow != nil {
+		return flow.status
+	}
+	return AuthFlowStatus{ExtensionID: extensionID, Status: AuthFlowNone}
+}
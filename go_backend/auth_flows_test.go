@@ -0,0 +1,141 @@
+package gobackend
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func setTestAuthState(extensionID string, state *ExtensionAuthState) {
+	extensionAuthStateMu.Lock()
+	extensionAuthState[extensionID] = state
+	extensionAuthStateMu.Unlock()
+}
+
+func dropTestAuthState(extensionID string) {
+	forgetAuthFlow(extensionID)
+	ClearPendingAuthRequest(extensionID)
+	extensionAuthStateMu.Lock()
+	delete(extensionAuthState, extensionID)
+	extensionAuthStateMu.Unlock()
+}
+
+func TestAuthFlowExpires(t *testing.T) {
+	drainAuthRequestEvents(t)
+	defer dropTestAuthState("flow-expire")
+
+	setTestAuthState("flow-expire", &ExtensionAuthState{PKCEVerifier: "v", PKCEChallenge: "c"})
+	req := startAuthFlow("flow-expire", "https://accounts.example.com/x", "app://cb", time.Second)
+	if status := GetAuthFlowStatus("flow-expire"); status.Status != AuthFlowPending || status.RequestID != req.ID || status.Deadline != req.ExpiresAt {
+		t.Fatalf("status = %+v", status)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for GetAuthFlowStatus("flow-expire").Status == AuthFlowPending {
+		if time.Now().After(deadline) {
+			t.Fatal("flow never expired")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if status := GetAuthFlowStatus("flow-expire"); status.Status != AuthFlowExpired || status.EndedAt == 0 {
+		t.Errorf("status = %+v", status)
+	}
+	extensionAuthStateMu.RLock()
+	verifier := extensionAuthState["flow-expire"].PKCEVerifier
+	extensionAuthStateMu.RUnlock()
+	if verifier != "" {
+		t.Error("PKCE verifier survived an expired flow")
+	}
+	if req := GetPendingAuthRequest("flow-expire"); req != nil {
+		t.Errorf("expired prompt still queued: %+v", req)
+	}
+	if got := drainAuthRequestEvents(t); strings.Join(got, ",") != "added flow-expire,expired flow-expire" {
+		t.Errorf("events = %q", got)
+	}
+}
+
+func TestAuthFlowSucceedsAndCancels(t *testing.T) {
+	drainAuthRequestEvents(t)
+	defer dropTestAuthState("flow-ok")
+	defer dropTestAuthState("flow-cancel")
+
+	if status := GetAuthFlowStatus("flow-ok"); status.Status != AuthFlowNone {
+		t.Errorf("status before any flow = %+v", status)
+	}
+
+	startAuthFlow("flow-ok", "https://accounts.example.com/ok", "app://cb", time.Minute)
+	SetExtensionAuthCode("flow-ok", "code-123")
+	if status := GetAuthFlowStatus("flow-ok"); status.Status != AuthFlowSucceeded {
+		t.Errorf("status after code = %+v", status)
+	}
+	if err := CancelAuthFlow("flow-ok"); err == nil {
+		t.Error("cancelled a finished flow")
+	}
+
+	setTestAuthState("flow-cancel", &ExtensionAuthState{PendingAuthURL: "https://accounts.example.com/c"})
+	startAuthFlow("flow-cancel", "https://accounts.example.com/c", "", time.Minute)
+	if err := CancelAuthFlow("flow-cancel"); err != nil {
+		t.Fatal(err)
+	}
+	status := GetAuthFlowStatus("flow-cancel")
+	if status.Status != AuthFlowCancelled || status.Reason == "" {
+		t.Errorf("status after cancel = %+v", status)
+	}
+	extensionAuthStateMu.RLock()
+	waiting := extensionAuthState["flow-cancel"].PendingAuthURL
+	extensionAuthStateMu.RUnlock()
+	if waiting != "" {
+		t.Errorf("cancelled auth URL still pending: %q", waiting)
+	}
+
+	want := "added flow-ok,consumed flow-ok,added flow-cancel,rejected flow-cancel"
+	if got := drainAuthRequestEvents(t); strings.Join(got, ",") != want {
+		t.Errorf("events = %q", got)
+	}
+}
+
+func TestAuthFlowTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		option interface{}
+		want   time.Duration
+	}{
+		{nil, authRequestTTL},
+		{float64(0), authRequestTTL},
+		{float64(5), minAuthFlowTimeout},
+		{int64(120), 2 * time.Minute},
+		{float64(86400), maxAuthFlowTimeout},
+	} {
+		if got := authFlowTimeout(tc.option); got != tc.want {
+			t.Errorf("authFlowTimeout(%v) = %v, want %v", tc.option, got, tc.want)
+		}
+	}
+}
+
+func TestAuthFlowReplacedAndTokenWrites(t *testing.T) {
+	drainAuthRequestEvents(t)
+	defer dropTestAuthState("flow-replace")
+
+	first := startAuthFlow("flow-replace", "https://accounts.example.com/1", "", time.Minute)
+	second := startAuthFlow("flow-replace", "https://accounts.example.com/2", "", time.Minute)
+	if req := GetPendingAuthRequest("flow-replace"); req == nil || req.ID != second.ID {
+		t.Fatalf("pending = %+v, want %s", req, second.ID)
+	}
+	if _, err := ConsumeAuthRequest(first.ID); err == nil {
+		t.Error("replaced prompt still queued")
+	}
+
+	// A token refresh says nothing about the sign-in in the browser.
+	SetExtensionTokens("flow-replace", "access", "refresh", time.Now().Add(time.Hour))
+	if status := GetAuthFlowStatus("flow-replace"); status.Status != AuthFlowPending || status.RequestID != second.ID {
+		t.Errorf("status after token write = %+v", status)
+	}
+	SetExtensionAuthCode("flow-replace", "code")
+	if status := GetAuthFlowStatus("flow-replace"); status.Status != AuthFlowSucceeded {
+		t.Errorf("status after code = %+v", status)
+	}
+
+	want := "added flow-replace,added flow-replace,superseded flow-replace,consumed flow-replace"
+	if got := drainAuthRequestEvents(t); strings.Join(got, ",") != want {
+		t.Errorf("events = %q", got)
+	}
+}
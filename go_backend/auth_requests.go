@@ -0,0 +1,215 @@
+package gobackend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ==================== Auth request queue ====================
+//
+// Extensions ask the app to open an auth page through auth.openAuthUrl or
+// auth.startOAuthWithPKCE. Each request gets an ID and joins a FIFO, so two
+// extensions (or two flows of one) no longer overwrite each other. Flutter
+// shows the oldest prompt, then settles it with ConsumeAuthRequest once the
+// page was opened or RejectAuthRequest when the user declines. Requests
+// expire with their auth flow (see auth_flows.go), after authRequestTTL by
+// default. Starting a PKCE flow supersedes the extension's earlier prompts,
+// since only the newest flow's verifier is kept. Every change is pushed as
+// an "auth_request" event with type added, consumed, rejected, expired,
+// superseded or cleared.
+
+const defaultAuthRequestTTL = 10 * time.Minute
+
+const (
+	AuthRequestAdded      = "added"
+	AuthRequestConsumed   = "consumed"
+	AuthRequestRejected   = "rejected"
+	AuthRequestExpired    = "expired"
+	AuthRequestSuperseded = "superseded"
+	AuthRequestCleared    = "cleared"
+)
+
+type PendingAuthRequest struct {
+	ID          string `json:"id"`
+	ExtensionID string `json:"extension_id"`
+	AuthURL     string `json:"auth_url"`
+	CallbackURL string `json:"callback_url"`
+	CreatedAt   int64  `json:"created_at"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
+type authRequestEvent struct {
+	Type    string             `json:"type"`
+	Request PendingAuthRequest `json:"request"`
+	Reason  string             `json:"reason,omitempty"`
+}
+
+var (
+	pendingAuthRequestsMu sync.Mutex
+	pendingAuthRequests   []*PendingAuthRequest
+
+	// authRequestTTL is shortened by tests.
+	authRequestTTL = defaultAuthRequestTTL
+)
+
+// takeAuthRequestsLocked removes the requests matching keep == false and
+// returns copies of them; the originals are wiped.
+func takeAuthRequestsLocked(keep func(*PendingAuthRequest) bool) []PendingAuthRequest {
+	var taken []PendingAuthRequest
+	kept := pendingAuthRequests[:0]
+	for _, req := range pendingAuthRequests {
+		if keep(req) {
+			kept = append(kept, req)
+			continue
+		}
+		taken = append(taken, *req)
+		*req = PendingAuthRequest{}
+	}
+	clear(pendingAuthRequests[len(kept):])
+	pendingAuthRequests = kept
+	return taken
+}
+
+// pruneAuthRequestsLocked drops expired requests and returns them.
+func pruneAuthRequestsLocked(now time.Time) []PendingAuthRequest {
+	return takeAuthRequestsLocked(func(req *PendingAuthRequest) bool {
+		return now.Unix() < req.ExpiresAt
+	})
+}
+
+func emitAuthRequestEvents(eventType string, requests []PendingAuthRequest, reason string) {
+	for _, req := range requests {
+		emitBackendEvent("auth_request", authRequestEvent{Type: eventType, Request: req, Reason: reason})
+	}
+}
+
+// enqueueAuthRequest appends a prompt for extensionID that expires after ttl,
+// or authRequestTTL when ttl is zero. Asking again for the same URL while it
+// is pending only renews its expiry.
+func enqueueAuthRequest(extensionID, authURL, callbackURL string, ttl time.Duration) PendingAuthRequest {
+	if ttl == 0 {
+		ttl = authRequestTTL
+	}
+	now := time.Now()
+	pendingAuthRequestsMu.Lock()
+	expired := pruneAuthRequestsLocked(now)
+	var req *PendingAuthRequest
+	for _, pending := range pendingAuthRequests {
+		if pending.ExtensionID == extensionID && pending.AuthURL == authURL {
+			req = pending
+			req.CallbackURL = callbackURL
+			break
+		}
+	}
+	added := req == nil
+	if added {
+		req = &PendingAuthRequest{
+			ID:          newTraceID(8),
+			ExtensionID: extensionID,
+			AuthURL:     authURL,
+			CallbackURL: callbackURL,
+			CreatedAt:   now.Unix(),
+		}
+		pendingAuthRequests = append(pendingAuthRequests, req)
+	}
+	req.ExpiresAt = now.Add(ttl).Unix()
+	snapshot := *req
+	pendingAuthRequestsMu.Unlock()
+
+	emitAuthRequestEvents(AuthRequestExpired, expired, "")
+	if added {
+		emitAuthRequestEvents(AuthRequestAdded, []PendingAuthRequest{snapshot}, "")
+	}
+	return snapshot
+}
+
+// ListPendingAuthRequests returns the unexpired requests, oldest first.
+func ListPendingAuthRequests() []PendingAuthRequest {
+	pendingAuthRequestsMu.Lock()
+	expired := pruneAuthRequestsLocked(time.Now())
+	requests := make([]PendingAuthRequest, 0, len(pendingAuthRequests))
+	for _, req := range pendingAuthRequests {
+		requests = append(requests, *req)
+	}
+	pendingAuthRequestsMu.Unlock()
+
+	emitAuthRequestEvents(AuthRequestExpired, expired, "")
+	return requests
+}
+
+// GetPendingAuthRequest returns the oldest pending request of extensionID.
+func GetPendingAuthRequest(extensionID string) *PendingAuthRequest {
+	for _, req := range ListPendingAuthRequests() {
+		if req.ExtensionID == extensionID {
+			return &req
+		}
+	}
+	return nil
+}
+
+// dropAuthRequests removes the requests of extensionID, except the one
+// with keepID, and reports each as eventType.
+func dropAuthRequests(extensionID, keepID, eventType string) {
+	pendingAuthRequestsMu.Lock()
+	expired := pruneAuthRequestsLocked(time.Now())
+	taken := takeAuthRequestsLocked(func(req *PendingAuthRequest) bool {
+		return req.ExtensionID != extensionID || req.ID == keepID
+	})
+	pendingAuthRequestsMu.Unlock()
+
+	emitAuthRequestEvents(AuthRequestExpired, expired, "")
+	emitAuthRequestEvents(eventType, taken, "")
+}
+
+// ClearPendingAuthRequest drops every pending request of extensionID.
+func ClearPendingAuthRequest(extensionID string) {
+	dropAuthRequests(extensionID, "", AuthRequestCleared)
+}
+
+// supersedeAuthRequests drops the earlier prompts of extensionID once it
+// started a new PKCE flow: their verifier is gone, so opening one could
+// only end in a failed token exchange.
+func supersedeAuthRequests(extensionID, currentID string) {
+	dropAuthRequests(extensionID, currentID, AuthRequestSuperseded)
+}
+
+func settleAuthRequest(id, eventType, reason string) (*PendingAuthRequest, error) {
+	pendingAuthRequestsMu.Lock()
+	expired := pruneAuthRequestsLocked(time.Now())
+	taken := takeAuthRequestsLocked(func(req *PendingAuthRequest) bool {
+		return req.ID != id
+	})
+	pendingAuthRequestsMu.Unlock()
+
+	emitAuthRequestEvents(AuthRequestExpired, expired, "")
+	if len(taken) == 0 {
+		return nil, fmt.Errorf("auth request not found: %s", id)
+	}
+	emitAuthRequestEvents(eventType, taken, reason)
+	return &taken[0], nil
+}
+
+// ConsumeAuthRequest removes request id from the queue and returns it, once
+// the app has opened its auth page.
+func ConsumeAuthRequest(id string) (*PendingAuthRequest, error) {
+	return settleAuthRequest(id, AuthRequestConsumed, "")
+}
+
+// RejectAuthRequest removes request id without opening it, e.g. when the
+// user declined. The extension's pending auth URL is cleared so it stops
+// waiting for a code.
+func RejectAuthRequest(id, reason string) error {
+	req, err := settleAuthRequest(id, AuthRequestRejected, reason)
+	if err != nil {
+		return err
+	}
+	extensionAuthStateMu.Lock()
+	if state, ok := extensionAuthState[req.ExtensionID]; ok && state.PendingAuthURL == req.AuthURL {
+		state.PendingAuthURL = ""
+	}
+	extensionAuthStateMu.Unlock()
+	cancelAuthFlowForRequest(req.ExtensionID, req.ID, firstNonEmpty(reason, "rejected"))
+	GoLog("[Extension:%s] Auth request rejected: %s\n", req.ExtensionID, firstNonEmpty(reason, "no reason given"))
+	return nil
+}
@@ -0,0 +1,120 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// drainAuthRequestEvents delivers the queued events of the global bus and
+// returns the auth_request ones as "type extension_id".
+func drainAuthRequestEvents(t *testing.T) []string {
+	t.Helper()
+	sink := &recordingSink{}
+	backendEventBus.setSink(sink)
+	defer backendEventBus.setSink(nil)
+
+	var got []string
+	for _, ev := range sink.drain(t, backendEventBus) {
+		payload, ok := strings.CutPrefix(ev, "auth_request ")
+		if !ok {
+			continue
+		}
+		var event authRequestEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, event.Type+" "+event.Request.ExtensionID)
+	}
+	return got
+}
+
+func TestAuthRequestQueue(t *testing.T) {
+	drainAuthRequestEvents(t)
+	defer ClearPendingAuthRequest("spotify")
+	defer ClearPendingAuthRequest("tidal")
+
+	first := enqueueAuthRequest("spotify", "https://accounts.example.com/a", "app://cb", 0)
+	second := enqueueAuthRequest("tidal", "https://login.example.com/b", "app://cb", 0)
+	again := enqueueAuthRequest("spotify", "https://accounts.example.com/a", "app://cb2", 0)
+	third := enqueueAuthRequest("spotify", "https://accounts.example.com/c", "app://cb", 0)
+	if again.ID != first.ID || again.CallbackURL != "app://cb2" || first.ID == second.ID {
+		t.Fatalf("ids: %s %s %s", first.ID, second.ID, again.ID)
+	}
+
+	pending := ListPendingAuthRequests()
+	if len(pending) != 3 || pending[0].ID != first.ID || pending[1].ID != second.ID || pending[2].ID != third.ID {
+		t.Fatalf("pending = %+v", pending)
+	}
+	if req := GetPendingAuthRequest("spotify"); req == nil || req.ID != first.ID {
+		t.Errorf("oldest spotify request = %+v", req)
+	}
+
+	consumed, err := ConsumeAuthRequest(first.ID)
+	if err != nil || consumed.AuthURL != "https://accounts.example.com/a" {
+		t.Fatalf("consume = %+v, %v", consumed, err)
+	}
+	if _, err := ConsumeAuthRequest(first.ID); err == nil {
+		t.Error("a request was consumed twice")
+	}
+
+	extensionAuthStateMu.Lock()
+	extensionAuthState["tidal"] = &ExtensionAuthState{PendingAuthURL: second.AuthURL}
+	extensionAuthStateMu.Unlock()
+	defer func() {
+		extensionAuthStateMu.Lock()
+		delete(extensionAuthState, "tidal")
+		extensionAuthStateMu.Unlock()
+	}()
+	if err := RejectAuthRequest(second.ID, "user declined"); err != nil {
+		t.Fatal(err)
+	}
+	extensionAuthStateMu.RLock()
+	waiting := extensionAuthState["tidal"].PendingAuthURL
+	extensionAuthStateMu.RUnlock()
+	if waiting != "" {
+		t.Errorf("rejected auth URL still pending: %q", waiting)
+	}
+
+	prevTTL := authRequestTTL
+	authRequestTTL = -time.Second
+	defer func() { authRequestTTL = prevTTL }()
+	// Asking again renews the expiry, here into the past.
+	enqueueAuthRequest("spotify", third.AuthURL, "app://cb", 0)
+	enqueueAuthRequest("tidal", "https://login.example.com/d", "", 0)
+	if pending := ListPendingAuthRequests(); len(pending) != 0 {
+		t.Errorf("expired requests still pending: %+v", pending)
+	}
+
+	want := []string{
+		"added spotify", "added tidal", "added spotify",
+		"consumed spotify", "rejected tidal",
+		"expired spotify", "added tidal", "expired tidal",
+	}
+	if got := drainAuthRequestEvents(t); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %q", got)
+	}
+}
+
+func TestAuthRequestSupersedeAndClear(t *testing.T) {
+	drainAuthRequestEvents(t)
+
+	enqueueAuthRequest("pkce-ext", "https://accounts.example.com/auth?state=1", "app://cb", 0)
+	enqueueAuthRequest("other-ext", "https://login.example.com/x", "app://cb", 0)
+	latest := enqueueAuthRequest("pkce-ext", "https://accounts.example.com/auth?state=2", "app://cb", 0)
+	supersedeAuthRequests("pkce-ext", latest.ID)
+	if req := GetPendingAuthRequest("pkce-ext"); req == nil || req.ID != latest.ID {
+		t.Fatalf("pending pkce-ext request = %+v", req)
+	}
+
+	ClearPendingAuthRequest("pkce-ext")
+	ClearPendingAuthRequest("other-ext")
+	want := []string{
+		"added pkce-ext", "added other-ext", "added pkce-ext",
+		"superseded pkce-ext", "cleared pkce-ext", "cleared other-ext",
+	}
+	if got := drainAuthRequestEvents(t); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %q", got)
+	}
+}
@@ -0,0 +1,478 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	backendConfigFile       = "backend_config.json"
+	maxQueuedConfigChanges  = 50
+	minConfigTimeoutSeconds = 5
+	maxConfigTimeoutSeconds = 600
+	maxConfigConcurrency    = 16
+)
+
+var validConfigQualities = map[string]bool{
+	"LOSSLESS":        true,
+	"HI_RES":          true,
+	"HI_RES_LOSSLESS": true,
+}
+
+// BackendConfig holds settings that used to be passed piecemeal from Flutter.
+// Request fields still win; these are the defaults modules fall back to.
+type BackendConfig struct {
+	HTTPTimeoutSeconds      int                `json:"http_timeout_seconds"`
+	DownloadTimeoutSeconds  int                `json:"download_timeout_seconds"`
+	MaxConcurrentDownloads  int                `json:"max_concurrent_downloads"`
+	MaxConcurrentExtensions int                `json:"max_concurrent_extensions"`
+	WifiOnly                bool               `json:"wifi_only"`
+	DefaultQuality          string             `json:"default_quality"`
+	FilenameTemplate        string             `json:"filename_template"`
+	CoverSource             string             `json:"cover_source"`
+	EmbedMaxQualityCover    bool               `json:"embed_max_quality_cover"`
+	AlbumEdition            string             `json:"album_edition"`
+	StrictVersionMatch      bool               `json:"strict_version_match"`
+	ProxyURL                string             `json:"proxy_url,omitempty"`
+	AllowHTTP               bool               `json:"allow_http"`
+	InsecureTLS             bool               `json:"insecure_tls"`
+	TrashRetentionDays      int                `json:"trash_retention_days"`
+	ReleaseCheckHours       int                `json:"release_check_hours"`
+	AlbumFolderMatch        float64            `json:"album_folder_match"`
+	CopyBufferKB            int                `json:"copy_buffer_kb"`
+	MaxCoverMB              int                `json:"max_cover_mb"`
+	CoverEmbed              CoverEmbedRules    `json:"cover_embed"`
+	SaveAnimatedCover       bool               `json:"save_animated_cover"`
+	PreallocateOutput       bool               `json:"preallocate_output"`
+	Durability              string             `json:"durability"`
+	FLACOptimize            string             `json:"flac_optimize"`
+	AudioQC                 string             `json:"audio_qc"`
+	Downconvert             DownconvertConfig  `json:"downconvert"`
+	MobileCopy              MobileCopyConfig   `json:"mobile_copy"`
+	CloudUpload             CloudUploadConfig  `json:"cloud_upload"`
+	Subsonic                SubsonicConfig     `json:"subsonic"`
+	ListenBrainz            ListenBrainzConfig `json:"listenbrainz"`
+}
+
+// ConfigChange is queued for Flutter whenever the config changes.
+type ConfigChange struct {
+	Keys      []string `json:"keys"`
+	Version   int64    `json:"version"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+func DefaultBackendConfig() BackendConfig {
+	return BackendConfig{
+		HTTPTimeoutSeconds:      int(DefaultTimeout / time.Second),
+		DownloadTimeoutSeconds:  int(DownloadTimeout / time.Second),
+		MaxConcurrentDownloads:  1,
+		MaxConcurrentExtensions: defaultMaxConcurrentExtensions,
+		DefaultQuality:          "LOSSLESS",
+		FilenameTemplate:        "{artist} - {title}",
+		CoverSource:             CoverPreferenceLargest,
+		EmbedMaxQualityCover:    true,
+		AlbumEdition:            AlbumEditionMatch,
+		StrictVersionMatch:      true,
+		TrashRetentionDays:      defaultTrashRetentionDays,
+		ReleaseCheckHours:       defaultReleaseCheckHours,
+		AlbumFolderMatch:        defaultAlbumFolderMatch,
+		CopyBufferKB:            defaultCopyBufferKB,
+		MaxCoverMB:              defaultMaxCoverMB,
+		CoverEmbed:              defaultCoverEmbedRules(),
+		PreallocateOutput:       true,
+		Durability:              DurabilityFull,
+		FLACOptimize:            FLACOptimizeOff,
+		AudioQC:                 AudioQCOff,
+		Downconvert:             defaultDownconvertConfig(),
+		MobileCopy:              defaultMobileCopyConfig(),
+		CloudUpload:             defaultCloudUploadConfig(),
+		Subsonic:                defaultSubsonicConfig(),
+		ListenBrainz:            defaultListenBrainzConfig(),
+	}
+}
+
+func (c BackendConfig) HTTPTimeout() time.Duration {
+	return time.Duration(c.HTTPTimeoutSeconds) * time.Second
+}
+
+func (c BackendConfig) DownloadTimeout() time.Duration {
+	return time.Duration(c.DownloadTimeoutSeconds) * time.Second
+}
+
+// Proxy returns the parsed proxy URL, or nil for a direct connection.
+func (c BackendConfig) Proxy() *url.URL {
+	if c.ProxyURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(c.ProxyURL)
+	if err != nil {
+		return nil
+	}
+	return parsed
+}
+
+// Validate normalizes c in place and reports the first invalid field.
+func (c *BackendConfig) Validate() error {
+	if c.HTTPTimeoutSeconds < minConfigTimeoutSeconds || c.HTTPTimeoutSeconds > maxConfigTimeoutSeconds {
+		return fmt.Errorf("http_timeout_seconds must be between %d and %d", minConfigTimeoutSeconds, maxConfigTimeoutSeconds)
+	}
+	if c.DownloadTimeoutSeconds < minConfigTimeoutSeconds || c.DownloadTimeoutSeconds > maxConfigTimeoutSeconds {
+		return fmt.Errorf("download_timeout_seconds must be between %d and %d", minConfigTimeoutSeconds, maxConfigTimeoutSeconds)
+	}
+	if c.MaxConcurrentDownloads < 1 || c.MaxConcurrentDownloads > maxConfigConcurrency {
+		return fmt.Errorf("max_concurrent_downloads must be between 1 and %d", maxConfigConcurrency)
+	}
+	if c.MaxConcurrentExtensions < 1 || c.MaxConcurrentExtensions > maxConfigConcurrency {
+		return fmt.Errorf("max_concurrent_extensions must be between 1 and %d", maxConfigConcurrency)
+	}
+
+	c.DefaultQuality = strings.ToUpper(strings.TrimSpace(c.DefaultQuality))
+	if !validConfigQualities[c.DefaultQuality] {
+		return fmt.Errorf("unsupported default_quality: %s", c.DefaultQuality)
+	}
+
+	c.FilenameTemplate = strings.TrimSpace(c.FilenameTemplate)
+	if c.FilenameTemplate == "" {
+		return fmt.Errorf("filename_template is required")
+	}
+	if strings.Contains(c.FilenameTemplate, "..") {
+		return fmt.Errorf("filename_template must not contain '..'")
+	}
+
+	c.CoverSource = strings.ToLower(strings.TrimSpace(c.CoverSource))
+	switch c.CoverSource {
+	case CoverPreferenceLargest, CoverPreferenceSpotify, CoverPreferenceDeezer, CoverPreferenceProvider:
+	default:
+		return fmt.Errorf("unsupported cover_source: %s", c.CoverSource)
+	}
+
+	c.AlbumEdition = strings.ToLower(strings.TrimSpace(c.AlbumEdition))
+	switch c.AlbumEdition {
+	case "":
+		c.AlbumEdition = AlbumEditionMatch
+	case AlbumEditionMatch, AlbumEditionStandard, AlbumEditionDeluxe, AlbumEditionAny:
+	default:
+		return fmt.Errorf("unsupported album_edition: %s", c.AlbumEdition)
+	}
+
+	c.Durability = strings.ToLower(strings.TrimSpace(c.Durability))
+	switch c.Durability {
+	case DurabilityOff, DurabilityFile, DurabilityFull:
+	default:
+		return fmt.Errorf("unsupported durability: %s", c.Durability)
+	}
+
+	c.FLACOptimize = strings.ToLower(strings.TrimSpace(c.FLACOptimize))
+	switch c.FLACOptimize {
+	case "":
+		c.FLACOptimize = FLACOptimizeOff
+	case FLACOptimizeOff, FLACOptimizeMetadata, FLACOptimizeReencode:
+	default:
+		return fmt.Errorf("unsupported flac_optimize: %s", c.FLACOptimize)
+	}
+
+	c.AudioQC = strings.ToLower(strings.TrimSpace(c.AudioQC))
+	switch c.AudioQC {
+	case "":
+		c.AudioQC = AudioQCOff
+	case AudioQCOff, AudioQCFlag, AudioQCRedownload:
+	default:
+		return fmt.Errorf("unsupported audio_qc: %s", c.AudioQC)
+	}
+
+	if c.TrashRetentionDays < 0 || c.TrashRetentionDays > maxTrashRetentionDays {
+		return fmt.Errorf("trash_retention_days must be between 0 and %d", maxTrashRetentionDays)
+	}
+	if c.ReleaseCheckHours < 0 || c.ReleaseCheckHours > maxReleaseCheckHours {
+		return fmt.Errorf("release_check_hours must be between 0 and %d", maxReleaseCheckHours)
+	}
+	if c.AlbumFolderMatch < 0 || c.AlbumFolderMatch > 1 {
+		return fmt.Errorf("album_folder_match must be between 0 and 1")
+	}
+	if c.CopyBufferKB < minCopyBufferKB || c.CopyBufferKB > maxCopyBufferKB {
+		return fmt.Errorf("copy_buffer_kb must be between %d and %d", minCopyBufferKB, maxCopyBufferKB)
+	}
+	if c.MaxCoverMB < 1 || c.MaxCoverMB > maxMaxCoverMB {
+		return fmt.Errorf("max_cover_mb must be between 1 and %d", maxMaxCoverMB)
+	}
+	if err := c.CoverEmbed.validate(); err != nil {
+		return err
+	}
+	if err := c.Downconvert.validate(); err != nil {
+		return err
+	}
+	if err := c.MobileCopy.validate(); err != nil {
+		return err
+	}
+	if err := c.CloudUpload.validate(); err != nil {
+		return err
+	}
+	if c.CloudUpload.Enabled {
+		if err := checkCloudUploadScheme(c.CloudUpload.Endpoint, c.AllowHTTP); err != nil {
+			return err
+		}
+	}
+	if err := c.Subsonic.validate(); err != nil {
+		return err
+	}
+	if err := c.ListenBrainz.validate(); err != nil {
+		return err
+	}
+
+	c.ProxyURL = strings.TrimSpace(c.ProxyURL)
+	if c.ProxyURL != "" {
+		parsed, err := url.Parse(c.ProxyURL)
+		if err != nil || parsed.Host == "" {
+			return fmt.Errorf("proxy_url must be an absolute URL")
+		}
+		switch parsed.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy_url scheme must be http, https or socks5")
+		}
+	}
+	return nil
+}
+
+// changedConfigKeys lists the JSON names of fields that differ.
+func changedConfigKeys(old, updated BackendConfig) []string {
+	oldVal := reflect.ValueOf(old)
+	newVal := reflect.ValueOf(updated)
+	typ := oldVal.Type()
+
+	var keys []string
+	for i := 0; i < typ.NumField(); i++ {
+		if reflect.DeepEqual(oldVal.Field(i).Interface(), newVal.Field(i).Interface()) {
+			continue
+		}
+		name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+type configListener func(old, updated BackendConfig, keys []string)
+
+var (
+	backendConfigMu      sync.RWMutex
+	backendConfig        = DefaultBackendConfig()
+	backendConfigDir     string
+	backendConfigVersion int64
+
+	configListenersMu  sync.Mutex
+	configListeners    = make(map[int]configListener)
+	nextConfigListener int
+
+	configChangesMu sync.Mutex
+	configChanges   []ConfigChange
+)
+
+// GetBackendConfig returns a copy of the current config.
+func GetBackendConfig() BackendConfig {
+	backendConfigMu.RLock()
+	defer backendConfigMu.RUnlock()
+	return backendConfig
+}
+
+// SubscribeBackendConfig registers fn to run after every change. It returns
+// an id for UnsubscribeBackendConfig.
+func SubscribeBackendConfig(fn func(old, updated BackendConfig, keys []string)) int {
+	configListenersMu.Lock()
+	defer configListenersMu.Unlock()
+	nextConfigListener++
+	configListeners[nextConfigListener] = fn
+	return nextConfigListener
+}
+
+func UnsubscribeBackendConfig(id int) {
+	configListenersMu.Lock()
+	delete(configListeners, id)
+	configListenersMu.Unlock()
+}
+
+// SetBackendConfigDir loads persisted config from dir and applies it.
+// A missing or corrupt file falls back to defaults.
+func SetBackendConfigDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+	backendConfigMu.Lock()
+	err := openStore(dir, backendConfigStoreSchema)
+	backendConfigMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	loaded := DefaultBackendConfig()
+	if data, err := os.ReadFile(filepath.Join(dir, backendConfigFile)); err == nil {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			GoLog("[Config] Ignoring corrupt config file: %v\n", err)
+			loaded = DefaultBackendConfig()
+		} else if err := loaded.Validate(); err != nil {
+			GoLog("[Config] Ignoring invalid config file: %v\n", err)
+			loaded = DefaultBackendConfig()
+		}
+	}
+
+	backendConfigMu.Lock()
+	backendConfigDir = dir
+	backendConfigMu.Unlock()
+
+	return updateBackendConfig(loaded, false)
+}
+
+// UpdateBackendConfig validates, persists and applies cfg, then notifies
+// subscribers about the fields that changed.
+func UpdateBackendConfig(cfg BackendConfig) error {
+	return updateBackendConfig(cfg, true)
+}
+
+func updateBackendConfig(cfg BackendConfig, persist bool) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	backendConfigMu.Lock()
+	old := backendConfig
+	keys := changedConfigKeys(old, cfg)
+	if persist && backendConfigDir != "" {
+		if err := saveBackendConfigLocked(cfg); err != nil {
+			backendConfigMu.Unlock()
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+	}
+	backendConfig = cfg
+	if len(keys) > 0 {
+		backendConfigVersion++
+	}
+	version := backendConfigVersion
+	backendConfigMu.Unlock()
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	configChangesMu.Lock()
+	change := ConfigChange{Keys: keys, Version: version, Timestamp: time.Now().Unix()}
+	configChanges = append(configChanges, change)
+	if len(configChanges) > maxQueuedConfigChanges {
+		configChanges = configChanges[len(configChanges)-maxQueuedConfigChanges:]
+	}
+	configChangesMu.Unlock()
+	emitBackendEvent("config", change)
+
+	configListenersMu.Lock()
+	listeners := make([]configListener, 0, len(configListeners))
+	for _, fn := range configListeners {
+		listeners = append(listeners, fn)
+	}
+	configListenersMu.Unlock()
+
+	applyBackendConfig(cfg, keys)
+	for _, fn := range listeners {
+		fn(old, cfg, keys)
+	}
+
+	GoLog("[Config] Updated (v%d): %s\n", version, strings.Join(keys, ", "))
+	return nil
+}
+
+func saveBackendConfigLocked(cfg BackendConfig) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(backendConfigDir, backendConfigFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// applyBackendConfig pushes changes into modules that keep their own state.
+// Timeouts, proxy and request defaults are read from the config on use.
+func applyBackendConfig(updated BackendConfig, keys []string) {
+	changed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		changed[key] = true
+	}
+
+	if changed["max_concurrent_extensions"] {
+		GetExtensionScheduler().SetMaxConcurrent(updated.MaxConcurrentExtensions)
+	}
+	if changed["cover_source"] {
+		SetCoverSourcePreference(updated.CoverSource)
+	}
+	if changed["allow_http"] || changed["insecure_tls"] {
+		SetNetworkCompatibilityOptions(updated.AllowHTTP, updated.InsecureTLS)
+	}
+	if changed["proxy_url"] {
+		CloseIdleConnections()
+	}
+}
+
+// configuredProxy is the Proxy hook of the shared transports.
+func configuredProxy(req *http.Request) (*url.URL, error) {
+	return GetBackendConfig().Proxy(), nil
+}
+
+// applyConfigDefaults fills request fields Flutter left empty.
+func applyConfigDefaults(req *DownloadRequest) {
+	if req == nil {
+		return
+	}
+	cfg := GetBackendConfig()
+	if strings.TrimSpace(req.Quality) == "" {
+		req.Quality = cfg.DefaultQuality
+	}
+	if strings.TrimSpace(req.FilenameFormat) == "" {
+		req.FilenameFormat = cfg.FilenameTemplate
+	}
+}
+
+func GetBackendConfigJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetBackendConfig())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// SetBackendConfigJSON merges a partial JSON object into the current config.
+func SetBackendConfigJSON(configJSON string) error {
+	cfg := GetBackendConfig()
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return UpdateBackendConfig(cfg)
+}
+
+func ResetBackendConfig() error {
+	return UpdateBackendConfig(DefaultBackendConfig())
+}
+
+// PollConfigChangesJSON returns and clears config change events.
+func PollConfigChangesJSON() (string, error) {
+	configChangesMu.Lock()
+	changes := configChanges
+	configChanges = nil
+	configChangesMu.Unlock()
+
+	if changes == nil {
+		changes = []ConfigChange{}
+	}
+	jsonBytes, err := json.Marshal(changes)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
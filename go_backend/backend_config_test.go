@@ -0,0 +1,56 @@
+package gobackend
+
+import "testing"
+
+func TestBackendConfigValidate(t *testing.T) {
+	cfg := DefaultBackendConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("defaults should be valid: %v", err)
+	}
+
+	cfg.DefaultQuality = " hi_res "
+	cfg.CoverSource = "Deezer"
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DefaultQuality != "HI_RES" || cfg.CoverSource != "deezer" {
+		t.Fatalf("expected normalized values, got %q %q", cfg.DefaultQuality, cfg.CoverSource)
+	}
+
+	bad := DefaultBackendConfig()
+	bad.ProxyURL = "ftp://proxy.local:21"
+	if err := bad.Validate(); err == nil {
+		t.Fatal("expected ftp proxy to be rejected")
+	}
+
+	bad = DefaultBackendConfig()
+	bad.HTTPTimeoutSeconds = 1
+	if err := bad.Validate(); err == nil {
+		t.Fatal("expected too-short timeout to be rejected")
+	}
+}
+
+func TestBackendConfigChangeNotification(t *testing.T) {
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+
+	var got []string
+	id := SubscribeBackendConfig(func(old, updated BackendConfig, keys []string) {
+		got = keys
+	})
+	defer UnsubscribeBackendConfig(id)
+
+	if err := SetBackendConfigJSON(`{"download_timeout_seconds": 90}`); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "download_timeout_seconds" {
+		t.Fatalf("unexpected changed keys: %v", got)
+	}
+	if GetDownloadClient().Timeout.Seconds() != 90 {
+		t.Fatalf("download client should use configured timeout, got %v", GetDownloadClient().Timeout)
+	}
+
+	if err := SetBackendConfigJSON(`{"max_concurrent_downloads": 0}`); err == nil {
+		t.Fatal("expected invalid update to be rejected")
+	}
+}
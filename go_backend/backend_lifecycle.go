@@ -0,0 +1,247 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultDrainTimeout = 15 * time.Second
+	cancelGracePeriod   = 3 * time.Second
+	drainPollInterval   = 100 * time.Millisecond
+)
+
+// BackendInitOptions lists the directories Flutter resolves on startup.
+// Empty fields leave the matching subsystem untouched.
+type BackendInitOptions struct {
+	ExtensionsDir        string          `json:"extensions_dir,omitempty"`
+	DataDir              string          `json:"data_dir,omitempty"`
+	ConfigDir            string          `json:"config_dir,omitempty"`
+	DownloadDir          string          `json:"download_dir,omitempty"`
+	PlaylistSyncDir      string          `json:"playlist_sync_dir,omitempty"`
+	LibraryCoverCacheDir string          `json:"library_cover_cache_dir,omitempty"`
+	StoreCacheDir        string          `json:"store_cache_dir,omitempty"`
+	ScratchDir           string          `json:"scratch_dir,omitempty"`
+	TrashDir             string          `json:"trash_dir,omitempty"`
+	ReleaseWatchDir      string          `json:"release_watch_dir,omitempty"`
+	LookupCacheDir       string          `json:"lookup_cache_dir,omitempty"`
+	HistoryDir           string          `json:"history_dir,omitempty"`
+	CloudUploadDir       string          `json:"cloud_upload_dir,omitempty"`
+	IntegrationsDir      string          `json:"integrations_dir,omitempty"`
+	Locale               string          `json:"locale,omitempty"`
+	LoadExtensions       bool            `json:"load_extensions,omitempty"`
+	DrainTimeoutSeconds  int             `json:"drain_timeout_seconds,omitempty"`
+	Config               json.RawMessage `json:"config,omitempty"`
+}
+
+type BackendLifecycleResult struct {
+	Initialized bool     `json:"initialized"`
+	References  int      `json:"references"`
+	Cancelled   []string `json:"cancelled,omitempty"`
+	Warnings    []string `json:"warnings,omitempty"`
+}
+
+var (
+	backendLifecycleMu sync.Mutex
+	backendRefs        int
+	backendDrainAfter  = defaultDrainTimeout
+
+	// backendShuttingDown makes initDownloadCancel hand out cancelled contexts
+	// so no new download starts while ShutdownBackend drains.
+	backendShuttingDown atomic.Bool
+)
+
+func encodeLifecycleResult(result BackendLifecycleResult) (string, error) {
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// InitBackend sets up shared state once per process. Every Flutter isolate
+// may call it; later calls only take a reference, and the backend is torn
+// down when the last reference is released with ShutdownBackend.
+func InitBackend(optionsJSON string) (string, error) {
+	var opts BackendInitOptions
+	if strings.TrimSpace(optionsJSON) != "" {
+		if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+			return "", fmt.Errorf("invalid init options: %w", err)
+		}
+	}
+
+	backendLifecycleMu.Lock()
+	defer backendLifecycleMu.Unlock()
+
+	if backendRefs > 0 {
+		backendRefs++
+		GoLog("[Lifecycle] Backend already initialized (%d references)\n", backendRefs)
+		return encodeLifecycleResult(BackendLifecycleResult{References: backendRefs})
+	}
+
+	result := BackendLifecycleResult{Initialized: true}
+	warn := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		GoLog("[Lifecycle] %s\n", msg)
+		result.Warnings = append(result.Warnings, msg)
+	}
+
+	if opts.ConfigDir != "" {
+		if err := SetBackendConfigDir(opts.ConfigDir); err != nil {
+			return "", err
+		}
+	}
+	if len(opts.Config) > 0 {
+		if err := SetBackendConfigJSON(string(opts.Config)); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.ExtensionsDir != "" && opts.DataDir != "" {
+		if err := InitExtensionSystem(opts.ExtensionsDir, opts.DataDir); err != nil {
+			return "", err
+		}
+		if opts.LoadExtensions {
+			_, errs := GetExtensionManager().LoadExtensionsFromDirectory(opts.ExtensionsDir)
+			for _, err := range errs {
+				warn("extension: %v", err)
+			}
+		}
+	}
+	if opts.DownloadDir != "" {
+		if err := setDownloadDir(opts.DownloadDir); err != nil {
+			warn("download dir: %v", err)
+		}
+	}
+	if opts.PlaylistSyncDir != "" {
+		if err := SetPlaylistSyncStateDir(opts.PlaylistSyncDir); err != nil {
+			warn("playlist sync dir: %v", err)
+		}
+	}
+	if opts.LibraryCoverCacheDir != "" {
+		SetLibraryCoverCacheDir(opts.LibraryCoverCacheDir)
+	}
+	if opts.StoreCacheDir != "" {
+		InitExtensionStore(opts.StoreCacheDir)
+	}
+	if opts.ScratchDir != "" {
+		if err := SetScratchRoot(opts.ScratchDir); err != nil {
+			warn("scratch dir: %v", err)
+		}
+	}
+	if opts.TrashDir != "" {
+		if err := SetTrashDir(opts.TrashDir); err != nil {
+			warn("trash dir: %v", err)
+		}
+	}
+	if opts.LookupCacheDir != "" {
+		if err := SetCatalogLookupCacheDir(opts.LookupCacheDir); err != nil {
+			warn("lookup cache dir: %v", err)
+		}
+	}
+	if opts.HistoryDir != "" {
+		if err := SetDownloadHistoryDir(opts.HistoryDir); err != nil {
+			warn("history dir: %v", err)
+		}
+	}
+	if opts.CloudUploadDir != "" {
+		if err := SetCloudUploadDir(opts.CloudUploadDir); err != nil {
+			warn("cloud upload dir: %v", err)
+		}
+	}
+	if opts.IntegrationsDir != "" {
+		if err := SetIntegrationsDir(opts.IntegrationsDir); err != nil {
+			warn("integrations dir: %v", err)
+		}
+	}
+	if opts.Locale != "" {
+		if err := SetLocale(opts.Locale); err != nil {
+			warn("locale: %v", err)
+		}
+	}
+	if opts.ReleaseWatchDir != "" {
+		if err := SetReleaseWatchStateDir(opts.ReleaseWatchDir); err != nil {
+			warn("release watch dir: %v", err)
+		} else {
+			StartReleaseWatcher()
+		}
+	}
+
+	backendDrainAfter = defaultDrainTimeout
+	if opts.DrainTimeoutSeconds > 0 {
+		backendDrainAfter = time.Duration(opts.DrainTimeoutSeconds) * time.Second
+	}
+
+	backendShuttingDown.Store(false)
+	backendRefs = 1
+	result.References = backendRefs
+	GoLog("[Lifecycle] Backend initialized\n")
+	return encodeLifecycleResult(result)
+}
+
+// ShutdownBackend releases one InitBackend reference. The last release stops
+// background workers, waits for active downloads to finish (cancelling any
+// still running after the drain timeout) and unloads extensions so their
+// storage is flushed and their VMs are released.
+func ShutdownBackend() (string, error) {
+	backendLifecycleMu.Lock()
+	defer backendLifecycleMu.Unlock()
+
+	if backendRefs > 1 {
+		backendRefs--
+		return encodeLifecycleResult(BackendLifecycleResult{References: backendRefs})
+	}
+	if backendRefs == 0 {
+		return encodeLifecycleResult(BackendLifecycleResult{})
+	}
+
+	backendShuttingDown.Store(true)
+	defer backendShuttingDown.Store(false)
+
+	GoLog("[Lifecycle] Shutting down backend\n")
+	StopImportWatchFolder()
+	StopReleaseWatcher()
+	StopLANTransferServer()
+
+	result := BackendLifecycleResult{}
+	if !waitForDownloadsToDrain(backendDrainAfter) {
+		result.Cancelled = activeDownloadIDs()
+		for _, id := range result.Cancelled {
+			cancelDownload(id)
+		}
+		GoLog("[Lifecycle] Cancelled %d downloads still running after %s\n", len(result.Cancelled), backendDrainAfter)
+		if !waitForDownloadsToDrain(cancelGracePeriod) {
+			result.Warnings = append(result.Warnings, "some downloads did not stop after cancellation")
+		}
+	}
+
+	GetExtensionManager().UnloadAllExtensions()
+	PurgeScratch()
+	backendEventBus.setSink(nil)
+	CloseIdleConnections()
+
+	backendRefs = 0
+	GoLog("[Lifecycle] Backend shut down\n")
+	return encodeLifecycleResult(result)
+}
+
+func waitForDownloadsToDrain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for len(activeDownloadIDs()) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+	return true
+}
+
+func IsBackendInitialized() bool {
+	backendLifecycleMu.Lock()
+	defer backendLifecycleMu.Unlock()
+	return backendRefs > 0
+}
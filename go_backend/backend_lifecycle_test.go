@@ -0,0 +1,44 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBackendLifecycleReferences(t *testing.T) {
+	first, err := InitBackend(`{"drain_timeout_seconds": 1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := InitBackend("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r1, r2 BackendLifecycleResult
+	json.Unmarshal([]byte(first), &r1)
+	json.Unmarshal([]byte(second), &r2)
+	if !r1.Initialized || r2.Initialized || r2.References != 2 {
+		t.Fatalf("unexpected init results: %+v %+v", r1, r2)
+	}
+
+	ctx := initDownloadCancel("lifecycle-test")
+	done := make(chan string)
+	go func() {
+		out, _ := ShutdownBackend()
+		out, _ = ShutdownBackend()
+		done <- out
+	}()
+
+	<-ctx.Done()
+	clearDownloadCancel("lifecycle-test")
+
+	var r3 BackendLifecycleResult
+	json.Unmarshal([]byte(<-done), &r3)
+	if len(r3.Cancelled) != 1 || r3.Cancelled[0] != "lifecycle-test" {
+		t.Fatalf("expected running download to be cancelled, got %+v", r3)
+	}
+	if IsBackendInitialized() {
+		t.Fatal("backend should be shut down after last reference")
+	}
+}
@@ -0,0 +1,482 @@
+package gobackend
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	backendStateVersion    = 1
+	backendStateManifest   = "backup.json"
+	backendStateKDFRounds  = 210000
+	maxBackendStateEntry   = 64 * 1024 * 1024
+	backendStateSourceRoot = "extensions"
+	backendStateDataRoot   = "data"
+)
+
+// Only these data files are portable; .credentials.enc and .cred_salt are
+// bound to the device salt and travel in the passphrase-sealed auth section.
+var backendStateDataFiles = map[string]bool{"settings.json": true, "storage.json": true}
+
+type backendStateExtension struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+	Enabled bool   `json:"enabled"`
+}
+
+type backendStateAuth struct {
+	Credentials  map[string]interface{} `json:"credentials,omitempty"`
+	AccessToken  string                 `json:"access_token,omitempty"`
+	RefreshToken string                 `json:"refresh_token,omitempty"`
+	ExpiresAt    int64                  `json:"expires_at,omitempty"`
+}
+
+type backendStateFile struct {
+	Version        int                           `json:"version"`
+	CreatedAt      int64                         `json:"created_at"`
+	AppState       json.RawMessage               `json:"app_state,omitempty"`
+	Config         *BackendConfig                `json:"config,omitempty"`
+	Notifications  NotificationOptions           `json:"notifications"`
+	CircuitBreaker CircuitBreakerOptions         `json:"circuit_breaker"`
+	PlaylistSync   map[string]*playlistSyncEntry `json:"playlist_sync,omitempty"`
+	Extensions     []backendStateExtension       `json:"extensions"`
+	AuthSalt       []byte                        `json:"auth_salt,omitempty"`
+	Auth           []byte                        `json:"auth,omitempty"`
+}
+
+// BackendStateImportResult hands Flutter's own state (history, queue, app
+// settings) back so it can be restored on the Dart side.
+type BackendStateImportResult struct {
+	AppState           json.RawMessage `json:"app_state,omitempty"`
+	RestoredExtensions []string        `json:"restored_extensions"`
+	SkippedExtensions  []string        `json:"skipped_extensions"`
+	AuthRestored       bool            `json:"auth_restored"`
+	Warnings           []string        `json:"warnings"`
+}
+
+func backendStateKey(passphrase string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, passphrase, salt, backendStateKDFRounds, 32)
+}
+
+func sealBackendAuth(auth map[string]backendStateAuth, passphrase string) (salt, sealed []byte, err error) {
+	plaintext, err := json.Marshal(auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	salt = make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, err := backendStateKey(passphrase, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err = encryptAES(plaintext, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encrypt auth state: %w", err)
+	}
+	return salt, sealed, nil
+}
+
+func openBackendAuth(salt, sealed []byte, passphrase string) (map[string]backendStateAuth, error) {
+	key, err := backendStateKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decryptAES(sealed, key)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted backup")
+	}
+	var auth map[string]backendStateAuth
+	if err := json.Unmarshal(plaintext, &auth); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+func writeBackendStateEntry(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func addBackendStateDir(zw *zip.Writer, srcDir, prefix string) error {
+	return filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return writeBackendStateEntry(zw, prefix+"/"+filepath.ToSlash(rel), data)
+	})
+}
+
+// ExportBackendState packs installed extensions with their settings and
+// storage, backend options and Flutter's appStateJSON into a zip archive.
+// Extension credentials and tokens are included only when a passphrase is
+// given, sealed with a key derived from it so the backup stays portable.
+func ExportBackendState(appStateJSON, passphrase string) ([]byte, error) {
+	config := GetBackendConfig()
+	state := backendStateFile{
+		Version:        backendStateVersion,
+		CreatedAt:      time.Now().Unix(),
+		Config:         &config,
+		Notifications:  GetNotificationOptions(),
+		CircuitBreaker: GetProviderHealthTracker().Options(),
+		Extensions:     []backendStateExtension{},
+	}
+	if strings.TrimSpace(appStateJSON) != "" {
+		if !json.Valid([]byte(appStateJSON)) {
+			return nil, fmt.Errorf("app state must be valid JSON")
+		}
+		state.AppState = json.RawMessage(appStateJSON)
+	}
+
+	playlistSyncMu.Lock()
+	state.PlaylistSync = make(map[string]*playlistSyncEntry)
+	for key, entry := range loadPlaylistSyncStateLocked() {
+		copied := *entry
+		state.PlaylistSync[key] = &copied
+	}
+	playlistSyncMu.Unlock()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	settingsStore := GetExtensionSettingsStore()
+	auth := make(map[string]backendStateAuth)
+
+	for _, ext := range GetExtensionManager().GetAllExtensions() {
+		state.Extensions = append(state.Extensions, backendStateExtension{
+			ID:      ext.ID,
+			Version: ext.Manifest.Version,
+			Enabled: ext.Enabled,
+		})
+
+		if ext.SourceDir != "" {
+			if err := addBackendStateDir(zw, ext.SourceDir, backendStateSourceRoot+"/"+ext.ID); err != nil {
+				return nil, fmt.Errorf("failed to pack extension %s: %w", ext.ID, err)
+			}
+		}
+
+		dataPrefix := backendStateDataRoot + "/" + ext.ID + "/"
+		settingsData, err := json.Marshal(settingsStore.GetAll(ext.ID))
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBackendStateEntry(zw, dataPrefix+"settings.json", settingsData); err != nil {
+			return nil, err
+		}
+
+		var storageData []byte
+		if ext.runtime != nil {
+			storage, err := ext.runtime.loadStorage()
+			if err != nil {
+				GoLog("[BackendState] Skipping storage of %s: %v\n", ext.ID, err)
+			} else if storageData, err = json.Marshal(storage); err != nil {
+				return nil, err
+			}
+		} else if ext.DataDir != "" {
+			storageData, _ = os.ReadFile(filepath.Join(ext.DataDir, "storage.json"))
+		}
+		if storageData != nil {
+			if err := writeBackendStateEntry(zw, dataPrefix+"storage.json", storageData); err != nil {
+				return nil, err
+			}
+		}
+
+		if passphrase == "" {
+			continue
+		}
+		var entry backendStateAuth
+		if ext.runtime != nil {
+			if creds, err := ext.runtime.loadCredentials(); err == nil {
+				entry.Credentials = creds
+			} else {
+				GoLog("[BackendState] Skipping credentials of %s: %v\n", ext.ID, err)
+			}
+		}
+		extensionAuthStateMu.RLock()
+		if authState, ok := extensionAuthState[ext.ID]; ok {
+			entry.AccessToken = authState.AccessToken
+			entry.RefreshToken = authState.RefreshToken
+			if !authState.ExpiresAt.IsZero() {
+				entry.ExpiresAt = authState.ExpiresAt.Unix()
+			}
+		}
+		extensionAuthStateMu.RUnlock()
+		if len(entry.Credentials) > 0 || entry.AccessToken != "" || entry.RefreshToken != "" {
+			auth[ext.ID] = entry
+		}
+	}
+
+	if len(auth) > 0 {
+		salt, sealed, err := sealBackendAuth(auth, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		state.AuthSalt = salt
+		state.Auth = sealed
+	}
+
+	manifestData, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeBackendStateEntry(zw, backendStateManifest, manifestData); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	GoLog("[BackendState] Exported %d extensions (%d bytes, auth=%v)\n", len(state.Extensions), buf.Len(), len(auth) > 0)
+	return buf.Bytes(), nil
+}
+
+func readBackendStateEntry(file *zip.File) ([]byte, error) {
+	if file.UncompressedSize64 > maxBackendStateEntry {
+		return nil, fmt.Errorf("%s is too large", file.Name)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxBackendStateEntry))
+}
+
+// ImportBackendState restores a backup made by ExportBackendState. Extensions
+// that are already installed are left untouched so an import never clobbers a
+// newer local setup. The passphrase is only needed when the backup carries
+// auth state; a wrong one aborts before anything is written.
+// validBackendStateExtensionID rejects IDs that would leave the extensions
+// directory once joined into a path.
+func validBackendStateExtensionID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, `/\`) &&
+		!strings.ContainsRune(id, filepath.Separator)
+}
+
+// backendStateManifests maps extension IDs to their packed manifest.json.
+func backendStateManifests(zr *zip.Reader) map[string][]byte {
+	manifests := make(map[string][]byte)
+	for _, file := range zr.File {
+		parts := strings.SplitN(file.Name, "/", 3)
+		if len(parts) != 3 || parts[0] != backendStateSourceRoot || parts[2] != "manifest.json" {
+			continue
+		}
+		if data, err := readBackendStateEntry(file); err == nil {
+			manifests[parts[1]] = data
+		}
+	}
+	return manifests
+}
+
+func ImportBackendState(data []byte, passphrase string) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("invalid backup file: %w", err)
+	}
+
+	var state backendStateFile
+	found := false
+	for _, file := range zr.File {
+		if file.Name != backendStateManifest {
+			continue
+		}
+		manifestData, err := readBackendStateEntry(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read backup manifest: %w", err)
+		}
+		if err := json.Unmarshal(manifestData, &state); err != nil {
+			return "", fmt.Errorf("invalid backup manifest: %w", err)
+		}
+		found = true
+		break
+	}
+	if !found {
+		return "", fmt.Errorf("invalid backup file: %s not found", backendStateManifest)
+	}
+	if state.Version > backendStateVersion {
+		return "", fmt.Errorf("backup version %d is newer than supported version %d", state.Version, backendStateVersion)
+	}
+
+	result := BackendStateImportResult{
+		AppState:           state.AppState,
+		RestoredExtensions: []string{},
+		SkippedExtensions:  []string{},
+		Warnings:           []string{},
+	}
+
+	var auth map[string]backendStateAuth
+	if len(state.Auth) > 0 {
+		if passphrase == "" {
+			result.Warnings = append(result.Warnings, "backup contains auth state but no passphrase was given; logins were not restored")
+		} else if auth, err = openBackendAuth(state.AuthSalt, state.Auth, passphrase); err != nil {
+			return "", err
+		}
+	}
+
+	manager := GetExtensionManager()
+	manager.mu.RLock()
+	extensionsDir, dataDir := manager.extensionsDir, manager.dataDir
+	manager.mu.RUnlock()
+
+	restore := make(map[string]bool)
+	if len(state.Extensions) > 0 && (extensionsDir == "" || dataDir == "") {
+		result.Warnings = append(result.Warnings, "extension system not initialized; extensions were not restored")
+	} else {
+		manifests := backendStateManifests(zr)
+		for _, ext := range state.Extensions {
+			if !validBackendStateExtensionID(ext.ID) {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("invalid extension id in backup: %q", ext.ID))
+				continue
+			}
+			if _, err := manager.GetExtension(ext.ID); err == nil {
+				result.SkippedExtensions = append(result.SkippedExtensions, ext.ID)
+				continue
+			}
+			manifest, err := ParseManifest(manifests[ext.ID])
+			if err != nil || manifest.Name != ext.ID {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s: backup manifest is missing or does not match", ext.ID))
+				continue
+			}
+			restore[ext.ID] = true
+		}
+	}
+
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		parts := strings.SplitN(file.Name, "/", 3)
+		if len(parts) != 3 || !restore[parts[1]] {
+			continue
+		}
+		relPath := filepath.Clean(filepath.FromSlash(parts[2]))
+		if strings.HasPrefix(relPath, "..") || filepath.IsAbs(relPath) {
+			GoLog("[BackendState] Skipping unsafe path in backup: %s\n", file.Name)
+			continue
+		}
+
+		var rootDir string
+		switch parts[0] {
+		case backendStateSourceRoot:
+			rootDir = extensionsDir
+		case backendStateDataRoot:
+			if !backendStateDataFiles[relPath] {
+				continue
+			}
+			rootDir = dataDir
+		default:
+			continue
+		}
+		extDir := filepath.Join(rootDir, parts[1])
+		destPath := filepath.Join(extDir, relPath)
+		if !isPathWithinBase(rootDir, extDir) || !isPathWithinBase(extDir, destPath) {
+			GoLog("[BackendState] Skipping unsafe path in backup: %s\n", file.Name)
+			continue
+		}
+
+		content, err := readBackendStateEntry(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return "", fmt.Errorf("failed to create directory for %s: %w", file.Name, err)
+		}
+		if err := os.WriteFile(destPath, content, 0600); err != nil {
+			return "", fmt.Errorf("failed to restore %s: %w", file.Name, err)
+		}
+	}
+
+	if len(restore) > 0 {
+		if err := GetExtensionSettingsStore().SetDataDir(dataDir); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("failed to reload extension settings: %v", err))
+		}
+	}
+
+	for _, ext := range state.Extensions {
+		if !restore[ext.ID] {
+			continue
+		}
+		loaded, err := manager.loadExtensionFromDirectory(filepath.Join(extensionsDir, ext.ID))
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: %v", ext.ID, err))
+			continue
+		}
+		result.RestoredExtensions = append(result.RestoredExtensions, ext.ID)
+
+		entry, ok := auth[ext.ID]
+		if !ok {
+			continue
+		}
+		if len(entry.Credentials) > 0 && loaded.runtime != nil {
+			// Re-encrypted with this device's salt.
+			if err := loaded.runtime.saveCredentials(entry.Credentials); err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s: failed to restore credentials: %v", ext.ID, err))
+				continue
+			}
+		}
+		if entry.AccessToken != "" || entry.RefreshToken != "" {
+			var expiresAt time.Time
+			if entry.ExpiresAt > 0 {
+				expiresAt = time.Unix(entry.ExpiresAt, 0)
+			}
+			SetExtensionTokens(ext.ID, entry.AccessToken, entry.RefreshToken, expiresAt)
+		}
+		result.AuthRestored = true
+	}
+
+	if state.Config != nil {
+		if err := UpdateBackendConfig(*state.Config); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("backend config: %v", err))
+		}
+	}
+	if err := SetNotificationOptions(state.Notifications); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("notification options: %v", err))
+	}
+	GetProviderHealthTracker().SetOptions(state.CircuitBreaker)
+
+	if len(state.PlaylistSync) > 0 {
+		playlistSyncMu.Lock()
+		entries := loadPlaylistSyncStateLocked()
+		for key, entry := range state.PlaylistSync {
+			if _, exists := entries[key]; !exists && entry != nil {
+				entries[key] = entry
+			}
+		}
+		if err := savePlaylistSyncStateLocked(); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("playlist sync state: %v", err))
+		}
+		playlistSyncMu.Unlock()
+	}
+
+	GoLog("[BackendState] Imported backup: %d restored, %d skipped, auth=%v\n",
+		len(result.RestoredExtensions), len(result.SkippedExtensions), result.AuthRestored)
+
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,49 @@
+package gobackend
+
+import "testing"
+
+func TestBackendAuthSealRoundTrip(t *testing.T) {
+	auth := map[string]backendStateAuth{
+		"ext": {Credentials: map[string]interface{}{"arl": "secret"}, RefreshToken: "refresh"},
+	}
+	salt, sealed, err := sealBackendAuth(auth, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := openBackendAuth(salt, sealed, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened["ext"].Credentials["arl"] != "secret" || opened["ext"].RefreshToken != "refresh" {
+		t.Fatalf("unexpected auth after round trip: %+v", opened)
+	}
+
+	if _, err := openBackendAuth(salt, sealed, "wrong"); err == nil {
+		t.Fatal("expected wrong passphrase to fail")
+	}
+}
+
+func TestImportBackendStateRejectsInvalidData(t *testing.T) {
+	if _, err := ImportBackendState([]byte("not a zip"), ""); err == nil {
+		t.Fatal("expected invalid backup to be rejected")
+	}
+	if _, err := ExportBackendState("{broken", ""); err == nil {
+		t.Fatal("expected invalid app state JSON to be rejected")
+	}
+}
+
+func TestValidBackendStateExtensionID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"spotify-web": true,
+		"":            false,
+		".":           false,
+		"..":          false,
+		"../evil":     false,
+		`a\b`:         false,
+	} {
+		if got := validBackendStateExtensionID(id); got != want {
+			t.Errorf("validBackendStateExtensionID(%q) = %v", id, got)
+		}
+	}
+}
@@ -0,0 +1,533 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Browse / discover ====================
+//
+// Charts, new releases and editorial playlists for the app's discover tab,
+// normalized into the same TrackMetadata/SearchAlbumResult/
+// SearchPlaylistResult models search returns. Deezer needs no credentials
+// and is the default; Spotify is used for charts and new releases when
+// credentials are set. Deezer's /chart endpoint follows the caller's IP, so
+// a country chart is read from that country's "Top <Country>" playlist on the
+// Deezer Charts account. Spotify charts are its "Top 50" playlists.
+
+const (
+	browseCacheTTL       = 30 * time.Minute
+	browseDefaultLimit   = 50
+	browseMaxLimit       = 100
+	deezerChartsUserID   = 637006841 // the Deezer Charts account
+	deezerChartsMaxPages = 10
+
+	spotifyNewReleasesURL = "https://api.spotify.com/v1/browse/new-releases"
+)
+
+// deezerChartCountries maps ISO country codes to the names used in Deezer
+// Charts playlist titles.
+var deezerChartCountries = map[string][]string{
+	"US": {"USA", "United States"},
+	"GB": {"UK", "United Kingdom"},
+	"FR": {"France"},
+	"DE": {"Germany", "Deutschland"},
+	"BR": {"Brazil", "Brasil"},
+	"MX": {"Mexico", "México"},
+	"ES": {"Spain", "España"},
+	"IT": {"Italy", "Italia"},
+	"NL": {"Netherlands"},
+	"BE": {"Belgium"},
+	"CA": {"Canada"},
+	"AU": {"Australia"},
+	"JP": {"Japan"},
+	"IN": {"India"},
+	"ID": {"Indonesia"},
+	"PL": {"Poland", "Polska"},
+	"TR": {"Turkey", "Türkiye"},
+	"AR": {"Argentina"},
+	"CO": {"Colombia"},
+	"CL": {"Chile"},
+	"ZA": {"South Africa"},
+	"NG": {"Nigeria"},
+	"SE": {"Sweden"},
+	"AT": {"Austria"},
+	"CH": {"Switzerland"},
+	"PT": {"Portugal"},
+	"PH": {"Philippines"},
+}
+
+// spotifyChartPlaylists maps ISO country codes ("WW" for global) to
+// Spotify's "Top 50" chart playlists.
+var spotifyChartPlaylists = map[string]string{
+	"WW": "37i9dQZEVXbMDoHdkVkeOs",
+	"US": "37i9dQZEVXbLRQDuF5jeBp",
+	"GB": "37i9dQZEVXbLnolsZ8PSNw",
+	"DE": "37i9dQZEVXbJiZcmkrIHGU",
+	"FR": "37i9dQZEVXbIPWwFssbupI",
+	"BR": "37i9dQZEVXbMXbN3EUUhlg",
+	"MX": "37i9dQZEVXbO3qyFxbkOE1",
+	"ES": "37i9dQZEVXbNFJfN1Vw8d9",
+	"IT": "37i9dQZEVXbIQnj7RRhdSX",
+	"CA": "37i9dQZEVXbKj23U1GF4IR",
+	"AU": "37i9dQZEVXbJPcfkRz0wJ0",
+	"JP": "37i9dQZEVXbKXQ4mDTEBXq",
+	"IN": "37i9dQZEVXbLZ52XmnySJg",
+}
+
+type BrowseChartRequest struct {
+	Provider string `json:"provider,omitempty"`
+	Country  string `json:"country,omitempty"`
+	GenreID  int    `json:"genre_id,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+type BrowseChart struct {
+	Provider  string                 `json:"provider"`
+	Country   string                 `json:"country,omitempty"`
+	Title     string                 `json:"title,omitempty"`
+	Tracks    []TrackMetadata        `json:"tracks"`
+	Albums    []SearchAlbumResult    `json:"albums,omitempty"`
+	Playlists []SearchPlaylistResult `json:"playlists,omitempty"`
+}
+
+type deezerAlbumListItem struct {
+	ID          int64        `json:"id"`
+	Title       string       `json:"title"`
+	Cover       string       `json:"cover"`
+	CoverMedium string       `json:"cover_medium"`
+	CoverBig    string       `json:"cover_big"`
+	CoverXL     string       `json:"cover_xl"`
+	ReleaseDate string       `json:"release_date"`
+	RecordType  string       `json:"record_type"`
+	NbTracks    int          `json:"nb_tracks"`
+	Artist      deezerArtist `json:"artist"`
+}
+
+type deezerPlaylistListItem struct {
+	ID            int64  `json:"id"`
+	Title         string `json:"title"`
+	Picture       string `json:"picture"`
+	PictureMedium string `json:"picture_medium"`
+	PictureBig    string `json:"picture_big"`
+	PictureXL     string `json:"picture_xl"`
+	NbTracks      int    `json:"nb_tracks"`
+	User          struct {
+		Name string `json:"name"`
+	} `json:"user"`
+}
+
+var (
+	browseCacheMu sync.Mutex
+	browseCache   = make(map[string]*cacheEntry)
+)
+
+func browseCached(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	browseCacheMu.Lock()
+	if entry, ok := browseCache[key]; ok && !entry.isExpired() {
+		browseCacheMu.Unlock()
+		return entry.data, nil
+	}
+	browseCacheMu.Unlock()
+
+	data, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	browseCacheMu.Lock()
+	now := time.Now()
+	for k, entry := range browseCache {
+		if now.After(entry.expiresAt) {
+			delete(browseCache, k)
+		}
+	}
+	browseCache[key] = &cacheEntry{data: data, expiresAt: now.Add(browseCacheTTL)}
+	browseCacheMu.Unlock()
+	return data, nil
+}
+
+func clampBrowseLimit(limit int) int {
+	if limit <= 0 {
+		return browseDefaultLimit
+	}
+	return min(limit, browseMaxLimit)
+}
+
+func convertDeezerAlbumListItem(album deezerAlbumListItem) SearchAlbumResult {
+	albumType := album.RecordType
+	if albumType == "compile" {
+		albumType = "compilation"
+	}
+	return SearchAlbumResult{
+		ID:          fmt.Sprintf("deezer:%d", album.ID),
+		Name:        album.Title,
+		Artists:     album.Artist.Name,
+		Images:      firstNonEmpty(album.CoverXL, album.CoverBig, album.CoverMedium, album.Cover),
+		ReleaseDate: album.ReleaseDate,
+		TotalTracks: album.NbTracks,
+		AlbumType:   albumType,
+	}
+}
+
+func convertDeezerPlaylistListItem(playlist deezerPlaylistListItem) SearchPlaylistResult {
+	return SearchPlaylistResult{
+		ID:          fmt.Sprintf("deezer:%d", playlist.ID),
+		Name:        playlist.Title,
+		Owner:       playlist.User.Name,
+		Images:      firstNonEmpty(playlist.PictureXL, playlist.PictureBig, playlist.PictureMedium, playlist.Picture),
+		TotalTracks: playlist.NbTracks,
+	}
+}
+
+func fetchDeezerGlobalChart(ctx context.Context, genreID, limit int) (*BrowseChart, error) {
+	var resp struct {
+		Tracks    struct{ Data []deezerTrack }            `json:"tracks"`
+		Albums    struct{ Data []deezerAlbumListItem }    `json:"albums"`
+		Playlists struct{ Data []deezerPlaylistListItem } `json:"playlists"`
+	}
+	endpoint := fmt.Sprintf("%s/chart/%d?limit=%d", deezerBaseURL, genreID, limit)
+	client := GetDeezerClient()
+	if err := client.getJSON(ctx, endpoint, &resp); err != nil {
+		return nil, err
+	}
+
+	chart := &BrowseChart{Provider: ReleaseProviderDeezer, Title: "Top Worldwide"}
+	chart.Tracks = make([]TrackMetadata, 0, len(resp.Tracks.Data))
+	for _, track := range resp.Tracks.Data {
+		chart.Tracks = append(chart.Tracks, client.convertTrack(track))
+	}
+	for _, album := range resp.Albums.Data {
+		chart.Albums = append(chart.Albums, convertDeezerAlbumListItem(album))
+	}
+	for _, playlist := range resp.Playlists.Data {
+		chart.Playlists = append(chart.Playlists, convertDeezerPlaylistListItem(playlist))
+	}
+	return chart, nil
+}
+
+// deezerChartPlaylists lists every playlist of the Deezer Charts account.
+// The list changes rarely, so it is cached like any browse result.
+func deezerChartPlaylists(ctx context.Context, client *DeezerClient) ([]deezerPlaylistListItem, error) {
+	data, err := browseCached("deezer-chart-playlists", func() (interface{}, error) {
+		var playlists []deezerPlaylistListItem
+		endpoint := fmt.Sprintf("%s/user/%d/playlists?limit=100", deezerBaseURL, deezerChartsUserID)
+		for page := 0; endpoint != "" && page < deezerChartsMaxPages; page++ {
+			var resp struct {
+				Data []deezerPlaylistListItem `json:"data"`
+				Next string                   `json:"next"`
+			}
+			if err := client.getJSON(ctx, endpoint, &resp); err != nil {
+				return nil, err
+			}
+			playlists = append(playlists, resp.Data...)
+			endpoint = resp.Next
+		}
+		return playlists, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]deezerPlaylistListItem), nil
+}
+
+// findDeezerCountryChart picks the "Top <Country>" playlist from the Deezer
+// Charts account's own playlists, so an unrelated playlist with the same
+// title can never stand in for the chart.
+func findDeezerCountryChart(ctx context.Context, client *DeezerClient, country string) (*deezerPlaylistListItem, error) {
+	names, ok := deezerChartCountries[country]
+	if !ok {
+		return nil, fmt.Errorf("no chart available for country %s", country)
+	}
+	playlists, err := deezerChartPlaylists(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		for i := range playlists {
+			if strings.EqualFold(playlists[i].Title, "Top "+name) {
+				return &playlists[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no chart available for country %s", country)
+}
+
+func fetchDeezerCountryChart(ctx context.Context, client *DeezerClient, country string, limit int) (*BrowseChart, error) {
+	playlist, err := findDeezerCountryChart(ctx, client, country)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data []deezerTrack `json:"data"`
+	}
+	endpoint := fmt.Sprintf("%s/playlist/%d/tracks?limit=%d", deezerBaseURL, playlist.ID, limit)
+	if err := client.getJSON(ctx, endpoint, &resp); err != nil {
+		return nil, err
+	}
+
+	chart := &BrowseChart{Provider: ReleaseProviderDeezer, Country: country, Title: playlist.Title}
+	chart.Tracks = make([]TrackMetadata, 0, len(resp.Data))
+	for _, track := range resp.Data {
+		chart.Tracks = append(chart.Tracks, client.convertTrack(track))
+	}
+	chart.Playlists = []SearchPlaylistResult{convertDeezerPlaylistListItem(*playlist)}
+	return chart, nil
+}
+
+// spotifyChartTracks turns a chart playlist's entries into tracks, keeping
+// the chart order and at most limit of them.
+func spotifyChartTracks(entries []AlbumTrackMetadata, limit int) []TrackMetadata {
+	tracks := make([]TrackMetadata, 0, min(len(entries), limit))
+	for _, entry := range entries {
+		if len(tracks) == limit {
+			break
+		}
+		tracks = append(tracks, TrackMetadata{
+			SpotifyID:   entry.SpotifyID,
+			Artists:     entry.Artists,
+			Name:        entry.Name,
+			AlbumName:   entry.AlbumName,
+			AlbumArtist: entry.AlbumArtist,
+			DurationMS:  entry.DurationMS,
+			Images:      entry.Images,
+			ReleaseDate: entry.ReleaseDate,
+			TrackNumber: entry.TrackNumber,
+			TotalTracks: entry.TotalTracks,
+			DiscNumber:  entry.DiscNumber,
+			ExternalURL: entry.ExternalURL,
+			ISRC:        entry.ISRC,
+			AlbumType:   entry.AlbumType,
+		})
+	}
+	return tracks
+}
+
+func fetchSpotifyChart(ctx context.Context, country string, limit int) (*BrowseChart, error) {
+	if country == "" {
+		country = "WW"
+	}
+	playlistID, ok := spotifyChartPlaylists[country]
+	if !ok {
+		return nil, fmt.Errorf("no Spotify chart available for country %s", country)
+	}
+	client, err := NewSpotifyMetadataClient()
+	if err != nil {
+		return nil, err
+	}
+	token, err := client.getAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	playlist, err := client.fetchPlaylist(ctx, playlistID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	chart := &BrowseChart{
+		Provider: ReleaseProviderSpotify,
+		Title:    playlist.PlaylistInfo.Owner.Name,
+		Tracks:   spotifyChartTracks(playlist.TrackList, limit),
+	}
+	if country != "WW" {
+		chart.Country = country
+	}
+	return chart, nil
+}
+
+// GetBrowseChart returns the top tracks (and, for the global Deezer chart,
+// albums and playlists) worldwide or for one country. Spotify charts need
+// Spotify credentials; without them Deezer is used.
+func GetBrowseChart(req BrowseChartRequest) (*BrowseChart, error) {
+	req.Provider = strings.ToLower(strings.TrimSpace(req.Provider))
+	switch req.Provider {
+	case "":
+		req.Provider = ReleaseProviderDeezer
+	case ReleaseProviderDeezer:
+	case ReleaseProviderSpotify:
+		if !HasSpotifyCredentials() {
+			GoLog("[Browse] No Spotify credentials, using the Deezer chart\n")
+			req.Provider = ReleaseProviderDeezer
+		}
+	default:
+		return nil, fmt.Errorf("charts are not available from %s", req.Provider)
+	}
+	req.Country = strings.ToUpper(strings.TrimSpace(req.Country))
+	limit := clampBrowseLimit(req.Limit)
+
+	key := fmt.Sprintf("chart:%s:%s:%d:%d", req.Provider, req.Country, req.GenreID, limit)
+	data, err := browseCached(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), deezerAPITimeoutMobile)
+		defer cancel()
+		if req.Provider == ReleaseProviderSpotify {
+			return fetchSpotifyChart(ctx, req.Country, limit)
+		}
+		if req.Country == "" || req.Country == "WW" {
+			return fetchDeezerGlobalChart(ctx, req.GenreID, limit)
+		}
+		return fetchDeezerCountryChart(ctx, GetDeezerClient(), req.Country, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.(*BrowseChart), nil
+}
+
+func fetchSpotifyNewReleases(ctx context.Context, country string, limit int) ([]SearchAlbumResult, error) {
+	client, err := NewSpotifyMetadataClient()
+	if err != nil {
+		return nil, err
+	}
+	token, err := client.getAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s?limit=%d", spotifyNewReleasesURL, min(limit, 50))
+	if country != "" {
+		endpoint += "&country=" + url.QueryEscape(country)
+	}
+	var resp struct {
+		Albums struct {
+			Items []albumSimplified `json:"items"`
+		} `json:"albums"`
+	}
+	if err := client.getJSON(ctx, endpoint, token, &resp); err != nil {
+		return nil, err
+	}
+
+	albums := make([]SearchAlbumResult, 0, len(resp.Albums.Items))
+	for _, album := range resp.Albums.Items {
+		image := ""
+		if len(album.Images) > 0 {
+			image = album.Images[0].URL
+		}
+		albums = append(albums, SearchAlbumResult{
+			ID:          album.ID,
+			Name:        album.Name,
+			Artists:     joinArtists(album.Artists),
+			Images:      image,
+			ReleaseDate: album.ReleaseDate,
+			TotalTracks: album.TotalTracks,
+			AlbumType:   album.AlbumType,
+		})
+	}
+	return albums, nil
+}
+
+func fetchDeezerNewReleases(ctx context.Context, limit int) ([]SearchAlbumResult, error) {
+	var resp struct {
+		Data []deezerAlbumListItem `json:"data"`
+	}
+	endpoint := fmt.Sprintf("%s/editorial/0/releases?limit=%d", deezerBaseURL, limit)
+	if err := GetDeezerClient().getJSON(ctx, endpoint, &resp); err != nil {
+		return nil, err
+	}
+	albums := make([]SearchAlbumResult, 0, len(resp.Data))
+	for _, album := range resp.Data {
+		albums = append(albums, convertDeezerAlbumListItem(album))
+	}
+	return albums, nil
+}
+
+// GetNewReleases lists recent albums and singles. Spotify is used when asked
+// for and credentials are set, Deezer's editorial releases otherwise.
+func GetNewReleases(provider, country string, limit int) ([]SearchAlbumResult, error) {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	country = strings.ToUpper(strings.TrimSpace(country))
+	limit = clampBrowseLimit(limit)
+	if provider == ReleaseProviderSpotify && !HasSpotifyCredentials() {
+		GoLog("[Browse] No Spotify credentials, using Deezer new releases\n")
+		provider = ReleaseProviderDeezer
+	}
+
+	key := fmt.Sprintf("releases:%s:%s:%d", provider, country, limit)
+	data, err := browseCached(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), deezerAPITimeoutMobile)
+		defer cancel()
+		if provider == ReleaseProviderSpotify {
+			return fetchSpotifyNewReleases(ctx, country, limit)
+		}
+		return fetchDeezerNewReleases(ctx, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]SearchAlbumResult), nil
+}
+
+// GetEditorialPlaylists lists Deezer's featured playlists for a genre
+// (0 = all).
+func GetEditorialPlaylists(genreID, limit int) ([]SearchPlaylistResult, error) {
+	limit = clampBrowseLimit(limit)
+	key := fmt.Sprintf("editorial:%d:%d", genreID, limit)
+	data, err := browseCached(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), deezerAPITimeoutMobile)
+		defer cancel()
+
+		var resp struct {
+			Data []deezerPlaylistListItem `json:"data"`
+		}
+		endpoint := fmt.Sprintf("%s/chart/%d/playlists?limit=%d", deezerBaseURL, genreID, limit)
+		if err := GetDeezerClient().getJSON(ctx, endpoint, &resp); err != nil {
+			return nil, err
+		}
+		playlists := make([]SearchPlaylistResult, 0, len(resp.Data))
+		for _, playlist := range resp.Data {
+			playlists = append(playlists, convertDeezerPlaylistListItem(playlist))
+		}
+		return playlists, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]SearchPlaylistResult), nil
+}
+
+func GetBrowseChartJSON(requestJSON string) (string, error) {
+	var req BrowseChartRequest
+	if requestJSON != "" {
+		if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+			return "", fmt.Errorf("invalid request: %w", err)
+		}
+	}
+	chart, err := GetBrowseChart(req)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(chart)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func GetNewReleasesJSON(provider, country string, limit int) (string, error) {
+	albums, err := GetNewReleases(provider, country, limit)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(albums)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func GetEditorialPlaylistsJSON(genreID, limit int) (string, error) {
+	playlists, err := GetEditorialPlaylists(genreID, limit)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(playlists)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
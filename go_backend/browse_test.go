@@ -0,0 +1,78 @@
+package gobackend
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func resetBrowseCache() {
+	browseCacheMu.Lock()
+	browseCache = make(map[string]*cacheEntry)
+	browseCacheMu.Unlock()
+}
+
+func TestDeezerCountryChartUsesChartsAccount(t *testing.T) {
+	resetBrowseCache()
+	defer resetBrowseCache()
+
+	var requested []string
+	client := &DeezerClient{httpClient: &http.Client{Transport: declarativeRoundTripper(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.Path+"?"+req.URL.RawQuery)
+		body := `{"data": []}`
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/user/637006841/playlists") && req.URL.Query().Get("index") == "":
+			body = `{"data": [{"id": 1, "title": "Top France"}], "next": "https://api.deezer.com/2.0/user/637006841/playlists?limit=100&index=100"}`
+		case strings.HasSuffix(req.URL.Path, "/user/637006841/playlists"):
+			body = `{"data": [{"id": 2, "title": "Top Germany", "user": {"name": "Deezer Charts"}}]}`
+		case strings.HasSuffix(req.URL.Path, "/playlist/2/tracks"):
+			body = `{"data": [{"id": 10, "title": "Lied", "isrc": "DEX123", "artist": {"name": "Band"}, "album": {"title": "Album"}}]}`
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: make(http.Header)}, nil
+	})}}
+
+	chart, err := fetchDeezerCountryChart(context.Background(), client, "DE", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chart.Title != "Top Germany" || chart.Country != "DE" || len(chart.Tracks) != 1 || chart.Tracks[0].ISRC != "DEX123" {
+		t.Fatalf("chart = %+v", chart)
+	}
+	for _, path := range requested {
+		if strings.Contains(path, "/search") {
+			t.Errorf("chart lookup used text search: %s", path)
+		}
+	}
+
+	// The account listing is cached; a second country costs one request.
+	requested = nil
+	if _, err := fetchDeezerCountryChart(context.Background(), client, "FR", 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(requested) != 1 {
+		t.Errorf("requests = %q", requested)
+	}
+	if _, err := findDeezerCountryChart(context.Background(), client, "ZZ"); err == nil {
+		t.Error("found a chart for an unknown country")
+	}
+}
+
+func TestSpotifyChartTracks(t *testing.T) {
+	entries := []AlbumTrackMetadata{
+		{SpotifyID: "a", Name: "First", Artists: "X", ISRC: "US1"},
+		{SpotifyID: "b", Name: "Second", Artists: "Y"},
+		{SpotifyID: "c", Name: "Third", Artists: "Z"},
+	}
+	tracks := spotifyChartTracks(entries, 2)
+	if len(tracks) != 2 || tracks[0].SpotifyID != "a" || tracks[0].ISRC != "US1" || tracks[1].Name != "Second" {
+		t.Fatalf("tracks = %+v", tracks)
+	}
+	if _, ok := spotifyChartPlaylists["WW"]; !ok {
+		t.Error("no global Spotify chart")
+	}
+	if _, err := GetBrowseChart(BrowseChartRequest{Provider: "tidal"}); err == nil {
+		t.Error("accepted an unknown chart provider")
+	}
+}
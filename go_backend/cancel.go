@@ -10,6 +10,7 @@ import (
 var ErrDownloadCancelled = errors.New("download cancelled")
 
 type cancelEntry struct {
+	ctx      context.Context
 	cancel   context.CancelFunc
 	canceled bool
 }
@@ -24,17 +25,47 @@ func initDownloadCancel(itemID string) context.Context {
 		return context.Background()
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	if backendShuttingDown.Load() {
+		cancel()
+		return ctx
+	}
+
 	cancelMu.Lock()
 	defer cancelMu.Unlock()
 
-	ctx, cancel := context.WithCancel(context.Background())
 	cancelMap[itemID] = &cancelEntry{
+		ctx:      ctx,
 		cancel:   cancel,
 		canceled: false,
 	}
 	return ctx
 }
 
+// downloadContext returns the context of itemID's running download, so work
+// an extension starts on its behalf stops when it is cancelled. Unknown
+// items get context.Background().
+func downloadContext(itemID string) context.Context {
+	if itemID == "" {
+		return context.Background()
+	}
+
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+	entry, ok := cancelMap[itemID]
+	switch {
+	case !ok:
+		return context.Background()
+	case entry.ctx != nil:
+		return entry.ctx
+	case entry.canceled:
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return ctx
+	}
+	return context.Background()
+}
+
 func cancelDownload(itemID string) {
 	if itemID == "" {
 		return
@@ -76,3 +107,18 @@ func clearDownloadCancel(itemID string) {
 	delete(cancelMap, itemID)
 	cancelMu.Unlock()
 }
+
+// activeDownloadIDs lists downloads that registered a cancel func and have
+// not returned yet, including ones already cancelled but still unwinding.
+func activeDownloadIDs() []string {
+	cancelMu.Lock()
+	defer cancelMu.Unlock()
+
+	ids := make([]string, 0, len(cancelMap))
+	for id, entry := range cancelMap {
+		if entry.cancel != nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,501 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== ISRC / UPC lookup ====================
+//
+// LookupByISRC asks Deezer, Qobuz and (with credentials) Spotify for each
+// ISRC at once and merges the answers into one TrackMetadata: Deezer's
+// fields win, the others fill gaps, and every catalog's ID is kept. Results
+// are cached on disk so matching, re-tagging and extensions share them
+// across restarts; misses expire sooner than hits since catalogs grow.
+
+const (
+	catalogLookupCacheFile    = "catalog_lookup.json"
+	catalogLookupHitTTL       = 30 * 24 * time.Hour
+	catalogLookupMissTTL      = 24 * time.Hour
+	catalogLookupMaxEntries   = 5000
+	catalogLookupWorkers      = 4
+	catalogLookupTimeout      = 20 * time.Second
+	maxCatalogLookupBatchSize = 200
+)
+
+type ISRCLookupResult struct {
+	ISRC    string            `json:"isrc"`
+	Found   bool              `json:"found"`
+	Track   *TrackMetadata    `json:"track,omitempty"`
+	IDs     map[string]string `json:"ids,omitempty"`
+	Cached  bool              `json:"cached,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+	Fetched int64             `json:"fetched_at"`
+}
+
+type UPCLookupResult struct {
+	UPC     string                `json:"upc"`
+	Found   bool                  `json:"found"`
+	Album   *AlbumResponsePayload `json:"album,omitempty"`
+	IDs     map[string]string     `json:"ids,omitempty"`
+	Cached  bool                  `json:"cached,omitempty"`
+	Errors  map[string]string     `json:"errors,omitempty"`
+	Fetched int64                 `json:"fetched_at"`
+}
+
+type catalogLookupCache struct {
+	ISRC map[string]*ISRCLookupResult `json:"isrc"`
+	UPC  map[string]*UPCLookupResult  `json:"upc"`
+}
+
+var (
+	catalogLookupMu       sync.Mutex
+	catalogLookupCacheDir string
+	catalogLookupEntries  *catalogLookupCache
+
+	// isrcCatalogs is swapped out by tests.
+	isrcCatalogs = map[string]func(ctx context.Context, isrc string) (*TrackMetadata, error){
+		"deezer":  lookupISRCOnDeezer,
+		"qobuz":   lookupISRCOnQobuz,
+		"spotify": lookupISRCOnSpotify,
+	}
+)
+
+func SetCatalogLookupCacheDir(dir string) error {
+	catalogLookupMu.Lock()
+	defer catalogLookupMu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create lookup cache dir: %w", err)
+	}
+	catalogLookupCacheDir = dir
+	catalogLookupEntries = nil
+	return nil
+}
+
+func loadCatalogLookupCacheLocked() *catalogLookupCache {
+	if catalogLookupEntries != nil {
+		return catalogLookupEntries
+	}
+	catalogLookupEntries = &catalogLookupCache{}
+	if catalogLookupCacheDir != "" {
+		if data, err := os.ReadFile(filepath.Join(catalogLookupCacheDir, catalogLookupCacheFile)); err == nil {
+			if err := json.Unmarshal(data, catalogLookupEntries); err != nil {
+				GoLog("[Lookup] Ignoring corrupt cache file: %v\n", err)
+				catalogLookupEntries = &catalogLookupCache{}
+			}
+		}
+	}
+	if catalogLookupEntries.ISRC == nil {
+		catalogLookupEntries.ISRC = make(map[string]*ISRCLookupResult)
+	}
+	if catalogLookupEntries.UPC == nil {
+		catalogLookupEntries.UPC = make(map[string]*UPCLookupResult)
+	}
+	return catalogLookupEntries
+}
+
+// trimCatalogLookupCacheLocked drops the oldest ISRC entries over the limit.
+func trimCatalogLookupCacheLocked() {
+	cache := catalogLookupEntries
+	if len(cache.ISRC) <= catalogLookupMaxEntries {
+		return
+	}
+	keys := make([]string, 0, len(cache.ISRC))
+	for key := range cache.ISRC {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return cache.ISRC[keys[i]].Fetched < cache.ISRC[keys[j]].Fetched })
+	for _, key := range keys[:len(keys)-catalogLookupMaxEntries] {
+		delete(cache.ISRC, key)
+	}
+}
+
+func saveCatalogLookupCacheLocked() error {
+	if catalogLookupCacheDir == "" {
+		return nil
+	}
+	trimCatalogLookupCacheLocked()
+	data, err := json.Marshal(catalogLookupEntries)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(catalogLookupCacheDir, catalogLookupCacheFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func catalogLookupFresh(found bool, fetched int64) bool {
+	ttl := catalogLookupMissTTL
+	if found {
+		ttl = catalogLookupHitTTL
+	}
+	return time.Since(time.Unix(fetched, 0)) < ttl
+}
+
+func lookupISRCOnDeezer(ctx context.Context, isrc string) (*TrackMetadata, error) {
+	return GetDeezerClient().SearchByISRC(ctx, isrc)
+}
+
+func lookupISRCOnQobuz(ctx context.Context, isrc string) (*TrackMetadata, error) {
+	track, err := NewQobuzDownloader().SearchTrackByISRC(isrc)
+	if err != nil {
+		return nil, err
+	}
+	return &TrackMetadata{
+		SpotifyID:   fmt.Sprintf("qobuz:%d", track.ID),
+		Artists:     track.Performer.Name,
+		Name:        track.Title,
+		AlbumName:   track.Album.Title,
+		DurationMS:  track.Duration * 1000,
+		Images:      track.Album.Image.Large,
+		ReleaseDate: track.Album.ReleaseDate,
+		TrackNumber: track.TrackNumber,
+		ISRC:        track.ISRC,
+	}, nil
+}
+
+func lookupISRCOnSpotify(ctx context.Context, isrc string) (*TrackMetadata, error) {
+	if !HasSpotifyCredentials() {
+		return nil, nil
+	}
+	client, err := NewSpotifyMetadataClient()
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.SearchTracks(ctx, "isrc:"+isrc, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Tracks) == 0 {
+		return nil, fmt.Errorf("no track found for ISRC: %s", isrc)
+	}
+	return &result.Tracks[0], nil
+}
+
+// mergeTrackMetadata fills empty fields of dst from src.
+func mergeTrackMetadata(dst *TrackMetadata, src *TrackMetadata) {
+	fill := func(d *string, s string) {
+		if *d == "" {
+			*d = s
+		}
+	}
+	fill(&dst.Artists, src.Artists)
+	fill(&dst.Name, src.Name)
+	fill(&dst.AlbumName, src.AlbumName)
+	fill(&dst.AlbumArtist, src.AlbumArtist)
+	fill(&dst.Images, src.Images)
+	fill(&dst.ReleaseDate, src.ReleaseDate)
+	fill(&dst.ExternalURL, src.ExternalURL)
+	fill(&dst.AlbumType, src.AlbumType)
+	if dst.DurationMS == 0 {
+		dst.DurationMS = src.DurationMS
+	}
+	if dst.TrackNumber == 0 {
+		dst.TrackNumber = src.TrackNumber
+	}
+	if dst.TotalTracks == 0 {
+		dst.TotalTracks = src.TotalTracks
+	}
+	if dst.DiscNumber == 0 {
+		dst.DiscNumber = src.DiscNumber
+	}
+}
+
+// catalogPriority orders sources when merging; the first hit is the base.
+var catalogPriority = []string{"deezer", "spotify", "qobuz"}
+
+func fetchISRC(ctx context.Context, isrc string) *ISRCLookupResult {
+	type answer struct {
+		catalog string
+		track   *TrackMetadata
+		err     error
+	}
+	answers := make(chan answer, len(isrcCatalogs))
+	for name, lookup := range isrcCatalogs {
+		go func(name string, lookup func(context.Context, string) (*TrackMetadata, error)) {
+			track, err := lookup(ctx, isrc)
+			answers <- answer{name, track, err}
+		}(name, lookup)
+	}
+
+	tracks := make(map[string]*TrackMetadata)
+	result := &ISRCLookupResult{ISRC: isrc, Fetched: time.Now().Unix()}
+	for range isrcCatalogs {
+		a := <-answers
+		switch {
+		case a.err != nil:
+			if result.Errors == nil {
+				result.Errors = make(map[string]string)
+			}
+			result.Errors[a.catalog] = a.err.Error()
+		case a.track != nil:
+			tracks[a.catalog] = a.track
+		}
+	}
+
+	names := append([]string{}, catalogPriority...)
+	for name := range tracks {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		track, ok := tracks[name]
+		if !ok {
+			continue
+		}
+		if result.IDs == nil {
+			result.IDs = make(map[string]string)
+		}
+		result.IDs[name] = track.SpotifyID
+		if result.Track == nil {
+			merged := *track
+			merged.ISRC = isrc
+			result.Track = &merged
+		} else {
+			mergeTrackMetadata(result.Track, track)
+		}
+	}
+	result.Found = result.Track != nil
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupByISRC resolves ISRCs concurrently, serving fresh cache entries
+// without a network call. Results keep the order of isrcs; invalid codes
+// are reported as not found.
+func LookupByISRC(isrcs []string) ([]ISRCLookupResult, error) {
+	if len(isrcs) > maxCatalogLookupBatchSize {
+		return nil, fmt.Errorf("at most %d ISRCs per lookup", maxCatalogLookupBatchSize)
+	}
+
+	results := make([]ISRCLookupResult, len(isrcs))
+	var pending []int
+
+	catalogLookupMu.Lock()
+	cache := loadCatalogLookupCacheLocked()
+	for i, raw := range isrcs {
+		isrc := normalizeISRC(raw)
+		if isrc == "" {
+			results[i] = ISRCLookupResult{ISRC: raw, Errors: map[string]string{"input": "invalid ISRC"}}
+			continue
+		}
+		if cached, ok := cache.ISRC[isrc]; ok && catalogLookupFresh(cached.Found, cached.Fetched) {
+			results[i] = *cached
+			results[i].Cached = true
+			continue
+		}
+		results[i].ISRC = isrc
+		pending = append(pending, i)
+	}
+	catalogLookupMu.Unlock()
+
+	if len(pending) == 0 {
+		return results, nil
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(catalogLookupWorkers, len(pending)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				ctx, cancel := context.WithTimeout(context.Background(), catalogLookupTimeout)
+				results[i] = *fetchISRC(ctx, results[i].ISRC)
+				cancel()
+			}
+		}()
+	}
+	for _, i := range pending {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	catalogLookupMu.Lock()
+	for _, i := range pending {
+		// A lookup where every catalog failed is not cached as a miss.
+		if results[i].Found || len(results[i].Errors) < len(isrcCatalogs) {
+			stored := results[i]
+			stored.Errors = nil
+			cache.ISRC[stored.ISRC] = &stored
+		}
+	}
+	if err := saveCatalogLookupCacheLocked(); err != nil {
+		GoLog("[Lookup] Warning: failed to save cache: %v\n", err)
+	}
+	catalogLookupMu.Unlock()
+
+	GoLog("[Lookup] ISRC batch: %d requested, %d fetched\n", len(isrcs), len(pending))
+	return results, nil
+}
+
+// lookupISRCCached returns the merged track for one ISRC, or nil.
+func lookupISRCCached(isrc string) *TrackMetadata {
+	results, err := LookupByISRC([]string{isrc})
+	if err != nil || len(results) == 0 || !results[0].Found {
+		return nil
+	}
+	return results[0].Track
+}
+
+func fetchUPC(ctx context.Context, upc string) *UPCLookupResult {
+	result := &UPCLookupResult{UPC: upc, Fetched: time.Now().Unix()}
+	addErr := func(catalog string, err error) {
+		if result.Errors == nil {
+			result.Errors = make(map[string]string)
+		}
+		result.Errors[catalog] = err.Error()
+	}
+
+	var wg sync.WaitGroup
+	var deezerAlbum, spotifyAlbum *AlbumResponsePayload
+	var deezerErr, spotifyErr error
+	var spotifyID string
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		deezerAlbum, deezerErr = GetDeezerClient().GetAlbum(ctx, "upc:"+upc)
+	}()
+	if HasSpotifyCredentials() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			spotifyID, spotifyAlbum, spotifyErr = lookupUPCOnSpotify(ctx, upc)
+		}()
+	}
+	wg.Wait()
+
+	if deezerErr != nil {
+		addErr("deezer", deezerErr)
+	} else if deezerAlbum != nil && deezerAlbum.AlbumInfo.Name != "" {
+		result.Album = deezerAlbum
+		result.IDs = map[string]string{"deezer": "deezer:upc:" + upc}
+	}
+	if spotifyErr != nil {
+		addErr("spotify", spotifyErr)
+	} else if spotifyAlbum != nil {
+		if result.IDs == nil {
+			result.IDs = make(map[string]string)
+		}
+		result.IDs["spotify"] = spotifyID
+		if result.Album == nil {
+			result.Album = spotifyAlbum
+		}
+	}
+	result.Found = result.Album != nil
+	return result
+}
+
+func lookupUPCOnSpotify(ctx context.Context, upc string) (string, *AlbumResponsePayload, error) {
+	client, err := NewSpotifyMetadataClient()
+	if err != nil {
+		return "", nil, err
+	}
+	token, err := client.getAccessToken(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	var resp struct {
+		Albums struct {
+			Items []albumSimplified `json:"items"`
+		} `json:"albums"`
+	}
+	endpoint := fmt.Sprintf("%s?q=%s&type=album&limit=1", searchBaseURL, url.QueryEscape("upc:"+upc))
+	if err := client.getJSON(ctx, endpoint, token, &resp); err != nil {
+		return "", nil, err
+	}
+	if len(resp.Albums.Items) == 0 {
+		return "", nil, fmt.Errorf("no album found for UPC: %s", upc)
+	}
+	id := resp.Albums.Items[0].ID
+	album, err := client.fetchAlbum(ctx, id, token)
+	if err != nil {
+		return "", nil, err
+	}
+	return id, album, nil
+}
+
+// LookupByUPC resolves an album barcode on Deezer and Spotify.
+func LookupByUPC(upc string) (*UPCLookupResult, error) {
+	upc = strings.TrimSpace(upc)
+	if upc == "" || !isNumeric(upc) {
+		return nil, fmt.Errorf("invalid UPC: %q", upc)
+	}
+
+	catalogLookupMu.Lock()
+	cache := loadCatalogLookupCacheLocked()
+	if cached, ok := cache.UPC[upc]; ok && catalogLookupFresh(cached.Found, cached.Fetched) {
+		result := *cached
+		result.Cached = true
+		catalogLookupMu.Unlock()
+		return &result, nil
+	}
+	catalogLookupMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), catalogLookupTimeout)
+	result := fetchUPC(ctx, upc)
+	cancel()
+
+	if result.Found || result.Errors["deezer"] == "" {
+		catalogLookupMu.Lock()
+		stored := *result
+		stored.Errors = nil
+		cache.UPC[upc] = &stored
+		if err := saveCatalogLookupCacheLocked(); err != nil {
+			GoLog("[Lookup] Warning: failed to save cache: %v\n", err)
+		}
+		catalogLookupMu.Unlock()
+	}
+	return result, nil
+}
+
+func LookupByISRCJSON(isrcsJSON string) (string, error) {
+	var isrcs []string
+	if err := json.Unmarshal([]byte(isrcsJSON), &isrcs); err != nil {
+		return "", fmt.Errorf("invalid ISRC list: %w", err)
+	}
+	results, err := LookupByISRC(isrcs)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(results)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func LookupByUPCJSON(upc string) (string, error) {
+	result, err := LookupByUPC(upc)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,60 @@
+package gobackend
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLookupByISRCMergesAndCaches(t *testing.T) {
+	prevCatalogs := isrcCatalogs
+	defer func() { isrcCatalogs = prevCatalogs }()
+	cacheDir := t.TempDir()
+	if err := SetCatalogLookupCacheDir(cacheDir); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls atomic.Int32
+	isrcCatalogs = map[string]func(context.Context, string) (*TrackMetadata, error){
+		"deezer": func(ctx context.Context, isrc string) (*TrackMetadata, error) {
+			calls.Add(1)
+			if isrc != "USRC17607839" {
+				return nil, fmt.Errorf("no track found for ISRC: %s", isrc)
+			}
+			return &TrackMetadata{SpotifyID: "deezer:1", Name: "Song", Artists: "Artist"}, nil
+		},
+		"qobuz": func(ctx context.Context, isrc string) (*TrackMetadata, error) {
+			calls.Add(1)
+			if isrc != "USRC17607839" {
+				return nil, fmt.Errorf("no tracks found for ISRC: %s", isrc)
+			}
+			return &TrackMetadata{SpotifyID: "qobuz:2", Name: "Song (Remastered)", AlbumName: "Album", DurationMS: 180000}, nil
+		},
+	}
+
+	results, err := LookupByISRC([]string{"usrc17607839", "GBAYE0000001", "bad"})
+	if err != nil {
+		t.Fatalf("LookupByISRC failed: %v", err)
+	}
+	hit := results[0]
+	if !hit.Found || hit.Track.Name != "Song" || hit.Track.AlbumName != "Album" || hit.Track.DurationMS != 180000 {
+		t.Errorf("merged result = %+v / %+v", hit, hit.Track)
+	}
+	if hit.IDs["deezer"] != "deezer:1" || hit.IDs["qobuz"] != "qobuz:2" {
+		t.Errorf("ids = %v", hit.IDs)
+	}
+	if results[1].Found || results[2].Errors["input"] == "" {
+		t.Errorf("miss = %+v, invalid = %+v", results[1], results[2])
+	}
+
+	before := calls.Load()
+	// Reload from disk to check persistence.
+	if err := SetCatalogLookupCacheDir(cacheDir); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := LookupByISRC([]string{"USRC17607839"})
+	if !again[0].Cached || !again[0].Found || calls.Load() != before {
+		t.Errorf("second lookup was not served from cache: %+v, %d calls", again[0], calls.Load()-before)
+	}
+}
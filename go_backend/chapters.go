@@ -0,0 +1,778 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/go-flac/flacvorbis/v2"
+	"github.com/go-flac/go-flac/v2"
+)
+
+// Chapter marks a titled section of long-form audio (podcasts, audiobooks).
+type Chapter struct {
+	Title   string `json:"title"`
+	StartMS int64  `json:"start_ms"`
+	EndMS   int64  `json:"end_ms,omitempty"`
+}
+
+const maxChapters = 255 // Nero chpl stores the count in a single byte
+
+// normalizeChapters sorts chapters by start time and fills missing end times
+// from the next chapter (or totalMS for the last one).
+func normalizeChapters(chapters []Chapter, totalMS int64) []Chapter {
+	if len(chapters) == 0 {
+		return nil
+	}
+
+	result := make([]Chapter, 0, len(chapters))
+	for _, ch := range chapters {
+		if ch.StartMS < 0 {
+			continue
+		}
+		ch.Title = strings.TrimSpace(ch.Title)
+		result = append(result, ch)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].StartMS < result[j].StartMS })
+	if len(result) > maxChapters {
+		result = result[:maxChapters]
+	}
+
+	for i := range result {
+		if result[i].Title == "" {
+			result[i].Title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		if result[i].EndMS > result[i].StartMS {
+			continue
+		}
+		if i+1 < len(result) {
+			result[i].EndMS = result[i+1].StartMS
+		} else if totalMS > result[i].StartMS {
+			result[i].EndMS = totalMS
+		} else {
+			result[i].EndMS = result[i].StartMS
+		}
+	}
+	return result
+}
+
+// EmbedChapters writes chapters using the native container format:
+// Vorbis CHAPTERnnn comments for FLAC, CHAP/CTOC frames for MP3 and a Nero
+// chpl atom for MP4/M4A.
+func EmbedChapters(filePath string, chapters []Chapter) error {
+	chapters = normalizeChapters(chapters, 0)
+	if len(chapters) == 0 {
+		return nil
+	}
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".flac":
+		return embedFLACChapters(filePath, chapters)
+	case ".mp3":
+		return EmbedID3Chapters(filePath, chapters)
+	case ".m4a", ".mp4", ".m4b":
+		return EmbedMP4Chapters(filePath, chapters)
+	default:
+		return fmt.Errorf("chapters not supported for %s", filepath.Ext(filePath))
+	}
+}
+
+// ReadChapters returns the chapters stored in a file, or nil when none exist.
+func ReadChapters(filePath string) ([]Chapter, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".flac":
+		return readFLACChapters(filePath)
+	case ".mp3":
+		return ReadID3Chapters(filePath)
+	case ".m4a", ".mp4", ".m4b":
+		return ReadMP4Chapters(filePath)
+	default:
+		return nil, fmt.Errorf("chapters not supported for %s", filepath.Ext(filePath))
+	}
+}
+
+// =============================================================================
+// FLAC (Vorbis comment chapter convention)
+// =============================================================================
+
+func formatChapterTimestamp(ms int64) string {
+	h := ms / 3600000
+	m := (ms / 60000) % 60
+	s := (ms / 1000) % 60
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", h, m, s, ms%1000)
+}
+
+func parseChapterTimestamp(value string) (int64, bool) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	h, errH := strconv.ParseInt(parts[0], 10, 64)
+	m, errM := strconv.ParseInt(parts[1], 10, 64)
+	sec, errS := strconv.ParseFloat(parts[2], 64)
+	if errH != nil || errM != nil || errS != nil {
+		return 0, false
+	}
+	return h*3600000 + m*60000 + int64(sec*1000+0.5), true
+}
+
+func setVorbisChapters(cmt *flacvorbis.MetaDataBlockVorbisComment, chapters []Chapter) {
+	kept := cmt.Comments[:0]
+	for _, comment := range cmt.Comments {
+		if !strings.HasPrefix(strings.ToUpper(comment), "CHAPTER") {
+			kept = append(kept, comment)
+		}
+	}
+	cmt.Comments = kept
+
+	for i, ch := range chapters {
+		key := fmt.Sprintf("CHAPTER%03d", i+1)
+		cmt.Comments = append(cmt.Comments,
+			key+"="+formatChapterTimestamp(ch.StartMS),
+			key+"NAME="+ch.Title,
+		)
+	}
+}
+
+func readVorbisChapters(cmt *flacvorbis.MetaDataBlockVorbisComment) []Chapter {
+	starts := make(map[int]int64)
+	names := make(map[int]string)
+
+	for _, comment := range cmt.Comments {
+		eq := strings.Index(comment, "=")
+		if eq <= 0 {
+			continue
+		}
+		key := strings.ToUpper(comment[:eq])
+		if !strings.HasPrefix(key, "CHAPTER") {
+			continue
+		}
+		rest := key[len("CHAPTER"):]
+		isName := strings.HasSuffix(rest, "NAME")
+		rest = strings.TrimSuffix(rest, "NAME")
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			continue
+		}
+		if isName {
+			names[n] = comment[eq+1:]
+		} else if ms, ok := parseChapterTimestamp(comment[eq+1:]); ok {
+			starts[n] = ms
+		}
+	}
+
+	chapters := make([]Chapter, 0, len(starts))
+	for n, start := range starts {
+		chapters = append(chapters, Chapter{Title: names[n], StartMS: start})
+	}
+	return normalizeChapters(chapters, 0)
+}
+
+func embedFLACChapters(filePath string, chapters []Chapter) error {
+	f, err := flac.ParseFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse FLAC file: %w", err)
+	}
+
+	cmtIdx := -1
+	var cmt *flacvorbis.MetaDataBlockVorbisComment
+	for idx, meta := range f.Meta {
+		if meta.Type == flac.VorbisComment {
+			cmtIdx = idx
+			cmt, err = flacvorbis.ParseFromMetaDataBlock(*meta)
+			if err != nil {
+				return fmt.Errorf("failed to parse vorbis comment: %w", err)
+			}
+			break
+		}
+	}
+	if cmt == nil {
+		cmt = flacvorbis.New()
+	}
+
+	setVorbisChapters(cmt, chapters)
+
+	cmtBlock := cmt.Marshal()
+	if cmtIdx >= 0 {
+		f.Meta[cmtIdx] = &cmtBlock
+	} else {
+		f.Meta = append(f.Meta, &cmtBlock)
+	}
+	return f.Save(filePath)
+}
+
+func readFLACChapters(filePath string) ([]Chapter, error) {
+	f, err := flac.ParseFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FLAC file: %w", err)
+	}
+	for _, meta := range f.Meta {
+		if meta.Type == flac.VorbisComment {
+			cmt, err := flacvorbis.ParseFromMetaDataBlock(*meta)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse vorbis comment: %w", err)
+			}
+			return readVorbisChapters(cmt), nil
+		}
+	}
+	return nil, nil
+}
+
+// =============================================================================
+// ID3v2 CHAP / CTOC (MP3)
+// =============================================================================
+
+func encodeID3Size(size int, version byte) []byte {
+	b := make([]byte, 4)
+	if version == 4 {
+		b[0] = byte(size>>21) & 0x7F
+		b[1] = byte(size>>14) & 0x7F
+		b[2] = byte(size>>7) & 0x7F
+		b[3] = byte(size) & 0x7F
+	} else {
+		binary.BigEndian.PutUint32(b, uint32(size))
+	}
+	return b
+}
+
+func buildID3Frame(id string, payload []byte, version byte) []byte {
+	frame := make([]byte, 0, 10+len(payload))
+	frame = append(frame, id...)
+	frame = append(frame, encodeID3Size(len(payload), version)...)
+	frame = append(frame, 0, 0)
+	return append(frame, payload...)
+}
+
+// buildID3TextPayload encodes UTF-8 for v2.4 and UTF-16 with BOM for v2.3.
+func buildID3TextPayload(text string, version byte) []byte {
+	if version == 4 {
+		return append([]byte{3}, text...)
+	}
+	payload := []byte{1, 0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(text)) {
+		payload = append(payload, byte(u), byte(u>>8))
+	}
+	return payload
+}
+
+func buildID3ChapterFrames(chapters []Chapter, version byte) []byte {
+	var out bytes.Buffer
+
+	toc := []byte("toc\x00")
+	toc = append(toc, 0x03, byte(len(chapters))) // top-level + ordered
+	for i := range chapters {
+		toc = append(toc, fmt.Sprintf("chp%d", i)...)
+		toc = append(toc, 0)
+	}
+	out.Write(buildID3Frame("CTOC", toc, version))
+
+	for i, ch := range chapters {
+		payload := []byte(fmt.Sprintf("chp%d", i))
+		payload = append(payload, 0)
+		times := make([]byte, 16)
+		binary.BigEndian.PutUint32(times[0:4], uint32(ch.StartMS))
+		binary.BigEndian.PutUint32(times[4:8], uint32(ch.EndMS))
+		binary.BigEndian.PutUint32(times[8:12], 0xFFFFFFFF)
+		binary.BigEndian.PutUint32(times[12:16], 0xFFFFFFFF)
+		payload = append(payload, times...)
+		payload = append(payload, buildID3Frame("TIT2", buildID3TextPayload(ch.Title, version), version)...)
+		out.Write(buildID3Frame("CHAP", payload, version))
+	}
+
+	return out.Bytes()
+}
+
+type id3TagInfo struct {
+	version  byte
+	tagSize  int // total tag size including header
+	frames   []byte
+	hasTag   bool
+	rawFlags byte
+}
+
+func readID3TagInfo(file *os.File) (*id3TagInfo, error) {
+	header := make([]byte, 10)
+	if _, err := file.ReadAt(header, 0); err != nil || string(header[0:3]) != "ID3" {
+		return &id3TagInfo{version: 4}, nil
+	}
+
+	info := &id3TagInfo{
+		version:  header[3],
+		rawFlags: header[5],
+		hasTag:   true,
+	}
+	size := syncsafeToInt(header[6:10])
+	info.tagSize = 10 + size
+	if info.rawFlags&0x10 != 0 {
+		info.tagSize += 10
+	}
+
+	if info.version != 3 && info.version != 4 {
+		return nil, fmt.Errorf("unsupported ID3v2.%d tag", info.version)
+	}
+	if info.rawFlags&0xC0 != 0 {
+		return nil, fmt.Errorf("unsynchronised or extended ID3 headers are not supported for chapter writing")
+	}
+
+	info.frames = make([]byte, size)
+	if _, err := file.ReadAt(info.frames, 10); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// stripID3Frames drops the given frame IDs and trailing padding.
+func stripID3Frames(data []byte, version byte, drop map[string]bool) []byte {
+	var out bytes.Buffer
+	pos := 0
+	for pos+10 <= len(data) {
+		if data[pos] == 0 {
+			break
+		}
+		id := string(data[pos : pos+4])
+		var size int
+		if version == 4 {
+			size = syncsafeToInt(data[pos+4 : pos+8])
+		} else {
+			size = int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		}
+		end := pos + 10 + size
+		if size < 0 || end > len(data) {
+			break
+		}
+		if !drop[id] {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	return out.Bytes()
+}
+
+// EmbedID3Chapters replaces CHAP/CTOC frames in the MP3's ID3v2 tag, creating
+// an ID3v2.4 tag when the file has none.
+func EmbedID3Chapters(filePath string, chapters []Chapter) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	info, err := readID3TagInfo(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	frames := stripID3Frames(info.frames, info.version, map[string]bool{"CHAP": true, "CTOC": true})
+	frames = append(frames, buildID3ChapterFrames(chapters, info.version)...)
+
+	header := []byte{'I', 'D', '3', info.version, 0, 0}
+	header = append(header, encodeID3Size(len(frames), 4)...) // tag size is always syncsafe
+
+	audioOffset := int64(0)
+	if info.hasTag {
+		audioOffset = int64(info.tagSize)
+	}
+
+	err = rewriteFileRange(filePath, file, 0, audioOffset, append(header, frames...))
+	file.Close()
+	return err
+}
+
+func parseCHAPFrame(data []byte, version byte) (Chapter, bool) {
+	nul := bytes.IndexByte(data, 0)
+	if nul < 0 || nul+17 > len(data) {
+		return Chapter{}, false
+	}
+	times := data[nul+1:]
+	ch := Chapter{
+		StartMS: int64(binary.BigEndian.Uint32(times[0:4])),
+		EndMS:   int64(binary.BigEndian.Uint32(times[4:8])),
+	}
+
+	sub := times[16:]
+	pos := 0
+	for pos+10 <= len(sub) {
+		id := string(sub[pos : pos+4])
+		var size int
+		if version == 4 {
+			size = syncsafeToInt(sub[pos+4 : pos+8])
+		} else {
+			size = int(binary.BigEndian.Uint32(sub[pos+4 : pos+8]))
+		}
+		if size <= 0 || pos+10+size > len(sub) {
+			break
+		}
+		if id == "TIT2" {
+			ch.Title = firstTextValue(extractTextFrame(sub[pos+10 : pos+10+size]))
+		}
+		pos += 10 + size
+	}
+	return ch, true
+}
+
+func ReadID3Chapters(filePath string) ([]Chapter, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := readID3TagInfo(file)
+	if err != nil || !info.hasTag {
+		return nil, err
+	}
+
+	var chapters []Chapter
+	data := info.frames
+	pos := 0
+	for pos+10 <= len(data) && data[pos] != 0 {
+		id := string(data[pos : pos+4])
+		var size int
+		if info.version == 4 {
+			size = syncsafeToInt(data[pos+4 : pos+8])
+		} else {
+			size = int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		}
+		if size <= 0 || pos+10+size > len(data) {
+			break
+		}
+		if id == "CHAP" {
+			if ch, ok := parseCHAPFrame(data[pos+10:pos+10+size], info.version); ok {
+				chapters = append(chapters, ch)
+			}
+		}
+		pos += 10 + size
+	}
+	return normalizeChapters(chapters, 0), nil
+}
+
+// =============================================================================
+// MP4 Nero chapters (moov/udta/chpl)
+// =============================================================================
+
+func buildNeroChplAtom(chapters []Chapter) []byte {
+	body := []byte{1, 0, 0, 0, 0, 0, 0, 0, byte(len(chapters))}
+	for _, ch := range chapters {
+		start := make([]byte, 8)
+		binary.BigEndian.PutUint64(start, uint64(ch.StartMS)*10000) // 100ns units
+		body = append(body, start...)
+		title := ch.Title
+		if len(title) > 255 {
+			// Cut on a rune boundary so players never see half a character.
+			cut := 255
+			for cut > 0 && !utf8.RuneStart(title[cut]) {
+				cut--
+			}
+			title = title[:cut]
+		}
+		body = append(body, byte(len(title)))
+		body = append(body, title...)
+	}
+	return buildMP4Atom("chpl", body)
+}
+
+func buildMP4Atom(typ string, body []byte) []byte {
+	atom := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(atom[0:4], uint32(8+len(body)))
+	copy(atom[4:8], typ)
+	return append(atom, body...)
+}
+
+type mp4Child struct {
+	typ  string
+	data []byte // full atom including header
+}
+
+func splitMP4Children(data []byte) ([]mp4Child, error) {
+	var children []mp4Child
+	pos := 0
+	for pos+8 <= len(data) {
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		if size == 1 {
+			return nil, fmt.Errorf("64-bit atoms inside moov are not supported")
+		}
+		if size == 0 {
+			size = len(data) - pos
+		}
+		if size < 8 || pos+size > len(data) {
+			return nil, fmt.Errorf("invalid MP4 atom size")
+		}
+		children = append(children, mp4Child{typ: string(data[pos+4 : pos+8]), data: data[pos : pos+size]})
+		pos += size
+	}
+	return children, nil
+}
+
+func findTopLevelMP4Atoms(f *os.File, fileSize int64) (moov atomHeader, mdatOffset int64, err error) {
+	mdatOffset = -1
+	found := false
+	pos := int64(0)
+	for pos+8 <= fileSize {
+		header, hErr := readAtomHeaderAt(f, pos, fileSize)
+		if hErr != nil {
+			return moov, mdatOffset, hErr
+		}
+		if header.size == 0 {
+			header.size = fileSize - pos
+		}
+		if header.size < header.headerSize {
+			return moov, mdatOffset, fmt.Errorf("invalid atom size for %s", header.typ)
+		}
+		switch header.typ {
+		case "moov":
+			moov = header
+			found = true
+		case "mdat":
+			if mdatOffset < 0 {
+				mdatOffset = pos
+			}
+		}
+		pos += header.size
+	}
+	if !found {
+		return moov, mdatOffset, fmt.Errorf("moov atom not found")
+	}
+	return moov, mdatOffset, nil
+}
+
+// shiftChunkOffsets adds delta to every stco/co64 entry reachable from data.
+func shiftChunkOffsets(data []byte, delta int64) error {
+	children, err := splitMP4Children(data)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		body := child.data[8:]
+		switch child.typ {
+		case "trak", "mdia", "minf", "stbl":
+			if err := shiftChunkOffsets(body, delta); err != nil {
+				return err
+			}
+		case "stco":
+			if len(body) < 8 {
+				continue
+			}
+			count := int(binary.BigEndian.Uint32(body[4:8]))
+			for i := 0; i < count && 8+i*4+4 <= len(body); i++ {
+				p := body[8+i*4:]
+				binary.BigEndian.PutUint32(p, uint32(int64(binary.BigEndian.Uint32(p))+delta))
+			}
+		case "co64":
+			if len(body) < 8 {
+				continue
+			}
+			count := int(binary.BigEndian.Uint32(body[4:8]))
+			for i := 0; i < count && 8+i*8+8 <= len(body); i++ {
+				p := body[8+i*8:]
+				binary.BigEndian.PutUint64(p, uint64(int64(binary.BigEndian.Uint64(p))+delta))
+			}
+		}
+	}
+	return nil
+}
+
+func EmbedMP4Chapters(filePath string, chapters []Chapter) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	moov, mdatOffset, err := findTopLevelMP4Atoms(f, stat.Size())
+	if err != nil {
+		return err
+	}
+	if moov.headerSize != 8 {
+		return fmt.Errorf("64-bit moov atom is not supported")
+	}
+
+	moovData := make([]byte, moov.size)
+	if _, err := f.ReadAt(moovData, moov.offset); err != nil {
+		return fmt.Errorf("failed to read moov: %w", err)
+	}
+
+	children, err := splitMP4Children(moovData[8:])
+	if err != nil {
+		return err
+	}
+
+	chpl := buildNeroChplAtom(chapters)
+	var newBody bytes.Buffer
+	hasUdta := false
+	for _, child := range children {
+		if child.typ != "udta" {
+			newBody.Write(child.data)
+			continue
+		}
+		hasUdta = true
+		udtaChildren, err := splitMP4Children(child.data[8:])
+		if err != nil {
+			return err
+		}
+		var udtaBody bytes.Buffer
+		for _, uc := range udtaChildren {
+			if uc.typ != "chpl" {
+				udtaBody.Write(uc.data)
+			}
+		}
+		udtaBody.Write(chpl)
+		newBody.Write(buildMP4Atom("udta", udtaBody.Bytes()))
+	}
+	if !hasUdta {
+		newBody.Write(buildMP4Atom("udta", chpl))
+	}
+
+	newMoov := buildMP4Atom("moov", newBody.Bytes())
+	delta := int64(len(newMoov)) - moov.size
+	if delta != 0 && mdatOffset > moov.offset {
+		if err := shiftChunkOffsets(newMoov[8:], delta); err != nil {
+			return err
+		}
+	}
+
+	return rewriteFileRange(filePath, f, moov.offset, moov.size, newMoov)
+}
+
+func ReadMP4Chapters(filePath string) ([]Chapter, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fileSize := stat.Size()
+	moov, _, err := findTopLevelMP4Atoms(f, fileSize)
+	if err != nil {
+		return nil, err
+	}
+	udta, ok, err := findAtomInRange(f, moov.offset+moov.headerSize, moov.size-moov.headerSize, "udta", fileSize)
+	if err != nil || !ok {
+		return nil, err
+	}
+	chpl, ok, err := findAtomInRange(f, udta.offset+udta.headerSize, udta.size-udta.headerSize, "chpl", fileSize)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	body := make([]byte, chpl.size-chpl.headerSize)
+	if _, err := f.ReadAt(body, chpl.offset+chpl.headerSize); err != nil {
+		return nil, err
+	}
+	return parseNeroChpl(body), nil
+}
+
+func parseNeroChpl(body []byte) []Chapter {
+	if len(body) < 5 {
+		return nil
+	}
+	pos := 4
+	if body[0] != 0 {
+		pos += 4
+	}
+	if pos >= len(body) {
+		return nil
+	}
+	count := int(body[pos])
+	pos++
+
+	chapters := make([]Chapter, 0, count)
+	for i := 0; i < count && pos+9 <= len(body); i++ {
+		start := binary.BigEndian.Uint64(body[pos : pos+8])
+		titleLen := int(body[pos+8])
+		pos += 9
+		if pos+titleLen > len(body) {
+			break
+		}
+		chapters = append(chapters, Chapter{
+			Title:   string(body[pos : pos+titleLen]),
+			StartMS: int64(start / 10000),
+		})
+		pos += titleLen
+	}
+	return normalizeChapters(chapters, 0)
+}
+
+// =============================================================================
+// File rewrite helpers
+// =============================================================================
+
+// rewriteFileRange replaces src[start:start+length] with replacement by
+// writing a temp file next to filePath and renaming it over the original.
+func rewriteFileRange(filePath string, src *os.File, start, length int64, replacement []byte) error {
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := stat.Size()
+
+	tmpPath := filePath + ".chapters.tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	writeErr := func() error {
+		if _, err := io.Copy(tmp, io.NewSectionReader(src, 0, start)); err != nil {
+			return err
+		}
+		if _, err := tmp.Write(replacement); err != nil {
+			return err
+		}
+		tail := start + length
+		_, err := io.Copy(tmp, io.NewSectionReader(src, tail, fileSize-tail))
+		return err
+	}()
+	closeErr := tmp.Close()
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rewrite file: %w", writeErr)
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+func ReadChaptersJSON(filePath string) (string, error) {
+	chapters, err := ReadChapters(filePath)
+	if err != nil {
+		return "", err
+	}
+	if chapters == nil {
+		chapters = []Chapter{}
+	}
+	jsonBytes, err := json.Marshal(chapters)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func EmbedChaptersJSON(filePath, chaptersJSON string) error {
+	var chapters []Chapter
+	if err := json.Unmarshal([]byte(chaptersJSON), &chapters); err != nil {
+		return fmt.Errorf("invalid chapters JSON: %w", err)
+	}
+	return EmbedChapters(filePath, chapters)
+}
@@ -0,0 +1,144 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var testChapters = []Chapter{
+	{Title: "Intro", StartMS: 0},
+	{Title: "Interview", StartMS: 65000},
+	{Title: "Outro", StartMS: 3600500, EndMS: 3700000},
+}
+
+func assertChapters(t *testing.T, got []Chapter) {
+	t.Helper()
+	want := normalizeChapters(testChapters, 0)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d chapters, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i].Title != want[i].Title || got[i].StartMS != want[i].StartMS {
+			t.Fatalf("chapter %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestNormalizeChaptersFillsEndTimes(t *testing.T) {
+	chapters := normalizeChapters([]Chapter{
+		{Title: "B", StartMS: 5000},
+		{StartMS: 0},
+	}, 9000)
+
+	if chapters[0].Title != "Chapter 1" || chapters[0].EndMS != 5000 {
+		t.Fatalf("unexpected first chapter: %+v", chapters[0])
+	}
+	if chapters[1].EndMS != 9000 {
+		t.Fatalf("expected last chapter to end at total duration, got %+v", chapters[1])
+	}
+}
+
+func TestChapterTimestampRoundTrip(t *testing.T) {
+	for _, ms := range []int64{0, 1, 65000, 3600500} {
+		formatted := formatChapterTimestamp(ms)
+		parsed, ok := parseChapterTimestamp(formatted)
+		if !ok || parsed != ms {
+			t.Fatalf("timestamp %d -> %q -> %d (ok=%v)", ms, formatted, parsed, ok)
+		}
+	}
+}
+
+func TestID3ChaptersRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "episode.mp3")
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x00}, 64)
+	if err := os.WriteFile(path, audio, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EmbedID3Chapters(path, normalizeChapters(testChapters, 0)); err != nil {
+		t.Fatalf("embed failed: %v", err)
+	}
+	// Writing twice must replace, not duplicate, existing chapter frames.
+	if err := EmbedID3Chapters(path, normalizeChapters(testChapters, 0)); err != nil {
+		t.Fatalf("second embed failed: %v", err)
+	}
+
+	chapters, err := ReadID3Chapters(path)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	assertChapters(t, chapters)
+
+	data, _ := os.ReadFile(path)
+	if !bytes.HasSuffix(data, audio) {
+		t.Fatal("audio payload was not preserved")
+	}
+}
+
+func TestMP4ChaptersRoundTrip(t *testing.T) {
+	mdatPayload := []byte("audio-samples")
+
+	stcoBody := make([]byte, 12)
+	binary.BigEndian.PutUint32(stcoBody[4:8], 1)
+	stbl := buildMP4Atom("stbl", buildMP4Atom("stco", stcoBody))
+	trak := buildMP4Atom("trak", buildMP4Atom("mdia", buildMP4Atom("minf", stbl)))
+	moov := buildMP4Atom("moov", append(buildMP4Atom("mvhd", make([]byte, 100)), trak...))
+	ftyp := buildMP4Atom("ftyp", []byte("M4A \x00\x00\x00\x00"))
+
+	// Point the single chunk at the mdat payload.
+	mdatDataOffset := uint32(len(ftyp) + len(moov) + 8)
+	stcoEntry := bytes.Index(moov, []byte("stco")) + 4 + 8
+	binary.BigEndian.PutUint32(moov[stcoEntry:], mdatDataOffset)
+
+	var file bytes.Buffer
+	file.Write(ftyp)
+	file.Write(moov)
+	file.Write(buildMP4Atom("mdat", mdatPayload))
+
+	path := filepath.Join(t.TempDir(), "book.m4b")
+	if err := os.WriteFile(path, file.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EmbedMP4Chapters(path, normalizeChapters(testChapters, 0)); err != nil {
+		t.Fatalf("embed failed: %v", err)
+	}
+
+	chapters, err := ReadMP4Chapters(path)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	assertChapters(t, chapters)
+
+	data, _ := os.ReadFile(path)
+	stcoPos := bytes.Index(data, []byte("stco")) + 4 + 8
+	chunkOffset := binary.BigEndian.Uint32(data[stcoPos:])
+	if !bytes.Equal(data[chunkOffset:int(chunkOffset)+len(mdatPayload)], mdatPayload) {
+		t.Fatal("stco chunk offset was not shifted with the moov atom")
+	}
+}
+
+func TestNeroChplTruncatesOnRuneBoundary(t *testing.T) {
+	// 127 two-byte runes, so byte 255 falls in the middle of one.
+	title := strings.Repeat("é", 127) + "é"
+	atom := buildNeroChplAtom([]Chapter{{Title: title, StartMS: 0}})
+	body := atom[8:]
+	n := int(body[9+8])
+	got := string(body[9+8+1 : 9+8+1+n])
+	if n != 254 || !utf8.ValidString(got) || got != strings.Repeat("é", 127) {
+		t.Fatalf("truncated title is %d bytes, valid=%v", n, utf8.ValidString(got))
+	}
+}
+
+func TestBuildDownloadResponseCarriesRequestChapters(t *testing.T) {
+	req := DownloadRequest{TrackName: "Episode", Chapters: testChapters}
+	resp := buildDownloadSuccessResponse(req, DownloadResult{}, "tidal", "ok", "/tmp/x.flac", false)
+	if len(resp.Chapters) != len(testChapters) || resp.Chapters[1].Title != "Interview" {
+		t.Fatalf("chapters = %+v", resp.Chapters)
+	}
+}
@@ -0,0 +1,690 @@
+package gobackend
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Cloud upload ====================
+//
+// With BackendConfig.CloudUpload enabled, every finished download is queued
+// for upload to a WebDAV server or an S3-compatible bucket (MinIO, Garage,
+// R2, AWS). Uploads run one at a time in the background and never affect
+// the download's result; their progress is reported by upload.status.
+//
+// The remote path comes from path_template, split on "/" and filled per
+// segment like filename templates, plus {collection} (the playlist or album
+// the track was queued with), {filename}, {ext} and {service}. Credentials
+// are kept out of the config and stored encrypted in the cloud upload dir,
+// the same way extension credentials are, and follow the credential lock.
+// Plain http endpoints need allow_http, since basic auth and S3 keys would
+// otherwise cross the network in the clear.
+
+const (
+	CloudUploadWebDAV = "webdav"
+	CloudUploadS3     = "s3"
+
+	CloudUploadQueued    = "queued"
+	CloudUploadUploading = "uploading"
+	CloudUploadDone      = "done"
+	CloudUploadFailed    = "failed"
+
+	cloudUploadCredentialsID   = "cloud-upload"
+	cloudUploadStagingDir      = "staging"
+	defaultCloudUploadTemplate = "{album_artist}/{album}/{filename}"
+	defaultCloudUploadRetries  = 3
+	maxCloudUploadRetries      = 10
+	maxCloudUploadJobs         = 200
+	cloudUploadTimeout         = 30 * time.Minute
+	maxCloudUploadBackoff      = time.Minute
+)
+
+// CloudUploadConfig lives in BackendConfig under cloud_upload.
+type CloudUploadConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Type     string `json:"type,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	// Bucket and Region only apply to S3; buckets are addressed path-style.
+	Bucket        string `json:"bucket,omitempty"`
+	Region        string `json:"region,omitempty"`
+	PathTemplate  string `json:"path_template,omitempty"`
+	BandwidthKBps int    `json:"bandwidth_kbps,omitempty"`
+	MaxRetries    int    `json:"max_retries"`
+}
+
+func defaultCloudUploadConfig() CloudUploadConfig {
+	return CloudUploadConfig{PathTemplate: defaultCloudUploadTemplate, MaxRetries: defaultCloudUploadRetries}
+}
+
+func (c *CloudUploadConfig) validate() error {
+	c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+	c.Endpoint = strings.TrimRight(strings.TrimSpace(c.Endpoint), "/")
+	c.PathTemplate = strings.Trim(strings.TrimSpace(c.PathTemplate), "/")
+	if c.PathTemplate == "" {
+		c.PathTemplate = defaultCloudUploadTemplate
+	}
+	if strings.Contains(c.PathTemplate, "..") {
+		return fmt.Errorf("cloud_upload.path_template must not contain '..'")
+	}
+	if c.MaxRetries < 0 || c.MaxRetries > maxCloudUploadRetries {
+		return fmt.Errorf("cloud_upload.max_retries must be between 0 and %d", maxCloudUploadRetries)
+	}
+	if c.BandwidthKBps < 0 {
+		return fmt.Errorf("cloud_upload.bandwidth_kbps must not be negative")
+	}
+	if !c.Enabled {
+		return nil
+	}
+
+	switch c.Type {
+	case CloudUploadWebDAV:
+	case CloudUploadS3:
+		if strings.TrimSpace(c.Bucket) == "" {
+			return fmt.Errorf("cloud_upload.bucket is required for s3")
+		}
+		if c.Region = strings.TrimSpace(c.Region); c.Region == "" {
+			c.Region = "us-east-1"
+		}
+	default:
+		return fmt.Errorf("unsupported cloud_upload.type: %s", c.Type)
+	}
+	parsed, err := url.Parse(c.Endpoint)
+	if err != nil || parsed.Host == "" || parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return fmt.Errorf("cloud_upload.endpoint must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// checkCloudUploadScheme refuses plain http, which would send credentials in
+// the clear, unless allow_http is on.
+func checkCloudUploadScheme(endpoint string, allowHTTP bool) error {
+	if parsed, err := url.Parse(endpoint); err == nil && parsed.Scheme == "http" && !allowHTTP {
+		return fmt.Errorf("cloud_upload.endpoint uses http; enable allow_http to upload without TLS")
+	}
+	return nil
+}
+
+// CloudUploadCredentials are stored encrypted; only the fields of the
+// configured type are used.
+type CloudUploadCredentials struct {
+	Username        string `json:"username,omitempty"`
+	Password        string `json:"password,omitempty"`
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+}
+
+// CloudUploadJob is one queued or finished upload.
+type CloudUploadJob struct {
+	ID         string `json:"id"`
+	ItemID     string `json:"item_id,omitempty"`
+	FilePath   string `json:"file_path"`
+	RemotePath string `json:"remote_path"`
+	State      string `json:"state"`
+	Attempts   int    `json:"attempts"`
+	Bytes      int64  `json:"bytes,omitempty"`
+	Error      string `json:"error,omitempty"`
+	QueuedAt   int64  `json:"queued_at"`
+	FinishedAt int64  `json:"finished_at,omitempty"`
+
+	// source is the file read for the upload: FilePath itself, or a staged
+	// copy of a SAF output (staged is then set) since its descriptor is
+	// closed before the upload runs.
+	source string
+	staged bool
+}
+
+var (
+	cloudUploadMu      sync.Mutex
+	cloudUploadDir     string
+	cloudUploadJobs    []*CloudUploadJob
+	cloudUploadPending []*CloudUploadJob
+	cloudUploadRunning bool
+	cloudUploadSeq     int64
+
+	// cloudUploadBackoff and cloudUploadClient are swapped out by tests.
+	cloudUploadBackoff = func(attempt int) time.Duration {
+		return min(time.Duration(1<<attempt)*time.Second, maxCloudUploadBackoff)
+	}
+	cloudUploadClient = func() *http.Client { return NewHTTPClientWithTimeout(cloudUploadTimeout) }
+)
+
+func SetCloudUploadDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create cloud upload dir: %w", err)
+	}
+	cloudUploadMu.Lock()
+	cloudUploadDir = dir
+	cloudUploadMu.Unlock()
+	registerCredentialDir(cloudUploadCredentialsID, dir)
+	return nil
+}
+
+func getCloudUploadDir() (string, error) {
+	cloudUploadMu.Lock()
+	defer cloudUploadMu.Unlock()
+	if cloudUploadDir == "" {
+		return "", fmt.Errorf("cloud upload dir not set")
+	}
+	return cloudUploadDir, nil
+}
+
+// SetCloudUploadCredentialsJSON encrypts and stores the upload credentials.
+// An empty object removes them.
+func SetCloudUploadCredentialsJSON(credsJSON string) error {
+	var creds CloudUploadCredentials
+	if err := json.Unmarshal([]byte(credsJSON), &creds); err != nil {
+		return fmt.Errorf("invalid credentials: %w", err)
+	}
+	dir, err := getCloudUploadDir()
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(creds)
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	return writeCredentialsFile(cloudUploadCredentialsID, dir, fields)
+}
+
+func loadCloudUploadCredentials() (CloudUploadCredentials, error) {
+	var creds CloudUploadCredentials
+	dir, err := getCloudUploadDir()
+	if err != nil {
+		return creds, err
+	}
+	fields, err := readCredentialsFile(cloudUploadCredentialsID, dir)
+	if err != nil {
+		return creds, err
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return creds, err
+	}
+	err = json.Unmarshal(data, &creds)
+	return creds, err
+}
+
+// cloudUploadRemotePath fills the path template for a finished download.
+func cloudUploadRemotePath(template string, req DownloadRequest, resp DownloadResponse) string {
+	base := filepath.Base(resp.FilePath)
+	ext := strings.TrimPrefix(filepath.Ext(base), ".")
+	metadata := map[string]interface{}{
+		"title":        firstNonEmpty(resp.Title, req.TrackName),
+		"artist":       firstNonEmpty(resp.Artist, req.ArtistName),
+		"album":        firstNonEmpty(resp.Album, req.AlbumName),
+		"album_artist": firstNonEmpty(resp.AlbumArtist, req.AlbumArtist),
+		"track":        max(resp.TrackNumber, req.TrackNumber),
+		"disc":         max(resp.DiscNumber, req.DiscNumber),
+		"release_date": firstNonEmpty(resp.ReleaseDate, req.ReleaseDate),
+	}
+	extras := strings.NewReplacer(
+		"{collection}", firstNonEmpty(req.CollectionName, resp.Album, req.AlbumName),
+		"{filename}", strings.TrimSuffix(base, filepath.Ext(base)),
+		"{ext}", ext,
+		"{service}", strings.ToLower(firstNonEmpty(resp.Service, req.Service)),
+	)
+
+	var segments []string
+	for _, segment := range strings.Split(template, "/") {
+		value := buildFilenameFromTemplate(extras.Replace(segment), metadata)
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		segments = append(segments, sanitizeFilename(value))
+	}
+	if len(segments) == 0 {
+		return base
+	}
+	if !strings.Contains(template, "{ext}") && !strings.HasSuffix(strings.ToLower(segments[len(segments)-1]), "."+strings.ToLower(ext)) {
+		segments[len(segments)-1] += "." + ext
+	}
+	return strings.Join(segments, "/")
+}
+
+// enqueueCloudUpload queues a successful download for upload. SAF outputs
+// are read back through their descriptor into a staged copy first.
+func enqueueCloudUpload(req DownloadRequest, respJSON string) {
+	cfg := GetBackendConfig().CloudUpload
+	if !cfg.Enabled {
+		return
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success || resp.AlreadyExists {
+		return
+	}
+	source, err := readableOutputPath(req, strings.TrimSpace(resp.FilePath))
+	if err != nil {
+		GoLog("[CloudUpload] Skipping %s: %v\n", resp.FilePath, err)
+		return
+	}
+	if info, err := os.Stat(source); err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	staged := strings.HasPrefix(source, "/proc/self/fd/")
+	if staged {
+		if source, err = stageCloudUpload(source, filepath.Ext(resp.FilePath)); err != nil {
+			GoLog("[CloudUpload] Failed to stage %s: %v\n", resp.FilePath, err)
+			return
+		}
+	}
+
+	cloudUploadMu.Lock()
+	cloudUploadSeq++
+	job := &CloudUploadJob{
+		ID:         strconv.FormatInt(cloudUploadSeq, 10),
+		ItemID:     req.ItemID,
+		FilePath:   resp.FilePath,
+		RemotePath: cloudUploadRemotePath(cfg.PathTemplate, req, resp),
+		State:      CloudUploadQueued,
+		QueuedAt:   time.Now().Unix(),
+		source:     source,
+		staged:     staged,
+	}
+	cloudUploadJobs = append(cloudUploadJobs, job)
+	if len(cloudUploadJobs) > maxCloudUploadJobs {
+		for _, dropped := range cloudUploadJobs[:len(cloudUploadJobs)-maxCloudUploadJobs] {
+			dropped.removeStaged()
+		}
+		cloudUploadJobs = cloudUploadJobs[len(cloudUploadJobs)-maxCloudUploadJobs:]
+	}
+	startCloudUploadLocked(job)
+	cloudUploadMu.Unlock()
+	GoLog("[CloudUpload] Queued %s -> %s\n", filepath.Base(job.FilePath), job.RemotePath)
+}
+
+// stageCloudUpload copies src into the cloud upload dir.
+func stageCloudUpload(src, ext string) (string, error) {
+	dir, err := getCloudUploadDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, cloudUploadStagingDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	staged, err := os.CreateTemp(dir, "upload_*"+ext)
+	if err != nil {
+		return "", err
+	}
+	stagedPath := staged.Name()
+	staged.Close()
+	if err := copyFileToOutput(src, stagedPath, 0); err != nil {
+		os.Remove(stagedPath)
+		return "", err
+	}
+	return stagedPath, nil
+}
+
+// removeStaged deletes the staged copy of a job that will not run again.
+// The caller holds cloudUploadMu.
+func (job *CloudUploadJob) removeStaged() {
+	if job.staged && job.source != "" {
+		os.Remove(job.source)
+		job.source = ""
+	}
+}
+
+// startCloudUploadLocked queues job and starts the worker if it is idle.
+func startCloudUploadLocked(job *CloudUploadJob) {
+	cloudUploadPending = append(cloudUploadPending, job)
+	if !cloudUploadRunning {
+		cloudUploadRunning = true
+		go runCloudUploads()
+	}
+}
+
+func runCloudUploads() {
+	for {
+		cloudUploadMu.Lock()
+		if len(cloudUploadPending) == 0 {
+			cloudUploadRunning = false
+			cloudUploadMu.Unlock()
+			return
+		}
+		job := cloudUploadPending[0]
+		cloudUploadPending = cloudUploadPending[1:]
+		job.State = CloudUploadUploading
+		cloudUploadMu.Unlock()
+
+		processCloudUpload(job)
+	}
+}
+
+func processCloudUpload(job *CloudUploadJob) {
+	backendCfg := GetBackendConfig()
+	cfg := backendCfg.CloudUpload
+	if err := checkCloudUploadScheme(cfg.Endpoint, backendCfg.AllowHTTP); err != nil {
+		finishCloudUpload(job, 0, err)
+		return
+	}
+	creds, err := loadCloudUploadCredentials()
+	if err != nil {
+		finishCloudUpload(job, 0, fmt.Errorf("failed to load credentials: %w", err))
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		cloudUploadMu.Lock()
+		job.Attempts++
+		cloudUploadMu.Unlock()
+
+		written, err := uploadFileToCloud(context.Background(), cfg, creds, job.source, job.RemotePath)
+		if err == nil || attempt >= cfg.MaxRetries || !isRetryableUploadError(err) {
+			finishCloudUpload(job, written, err)
+			return
+		}
+		GoLog("[CloudUpload] Attempt %d for %s failed: %v\n", attempt+1, job.RemotePath, err)
+		time.Sleep(cloudUploadBackoff(attempt))
+	}
+}
+
+func finishCloudUpload(job *CloudUploadJob, written int64, err error) {
+	cloudUploadMu.Lock()
+	defer cloudUploadMu.Unlock()
+	job.FinishedAt = time.Now().Unix()
+	job.Bytes = written
+	if err != nil {
+		job.State, job.Error = CloudUploadFailed, err.Error()
+		GoLog("[CloudUpload] Upload of %s failed: %v\n", job.RemotePath, err)
+		return
+	}
+	job.State, job.Error = CloudUploadDone, ""
+	job.removeStaged()
+	GoLog("[CloudUpload] Uploaded %s (%d bytes)\n", job.RemotePath, written)
+}
+
+// cloudUploadStatusError is a non-2xx answer from the remote.
+type cloudUploadStatusError struct {
+	Method string
+	Status int
+	Body   string
+}
+
+func (e *cloudUploadStatusError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("%s failed: HTTP %d: %s", e.Method, e.Status, e.Body)
+	}
+	return fmt.Sprintf("%s failed: HTTP %d", e.Method, e.Status)
+}
+
+// isRetryableUploadError retries network errors, timeouts, throttling and
+// server errors; other 4xx answers (bad credentials, missing bucket) fail
+// at once.
+func isRetryableUploadError(err error) bool {
+	statusErr, ok := err.(*cloudUploadStatusError)
+	if !ok {
+		return !os.IsNotExist(err)
+	}
+	return statusErr.Status == http.StatusRequestTimeout || statusErr.Status == http.StatusTooManyRequests || statusErr.Status >= 500
+}
+
+func checkUploadResponse(method string, resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &cloudUploadStatusError{Method: method, Status: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+}
+
+// throttledReader caps reads at bytesPerSec averaged since the first read.
+type throttledReader struct {
+	r           io.Reader
+	bytesPerSec int64
+	start       time.Time
+	read        int64
+}
+
+func newThrottledReader(r io.Reader, kbps int) io.Reader {
+	if kbps <= 0 {
+		return r
+	}
+	return &throttledReader{r: r, bytesPerSec: int64(kbps) * 1024}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	// Small reads keep the sleeps short and the rate smooth.
+	if chunk := max(t.bytesPerSec/4, 1); int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+	expected := time.Duration(float64(t.read) / float64(t.bytesPerSec) * float64(time.Second))
+	if wait := expected - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// escapeRemotePath percent-encodes every segment of a slash-separated path
+// with the strict set S3 signing expects; WebDAV servers accept it too.
+func escapeRemotePath(remotePath string) string {
+	segments := strings.Split(remotePath, "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for _, c := range []byte(segment) {
+			if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		segments[i] = b.String()
+	}
+	return strings.Join(segments, "/")
+}
+
+// remoteURL joins the endpoint and a raw path, keeping the strict escaping.
+func remoteURL(endpoint, remotePath string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimRight(u.EscapedPath(), "/")
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + remotePath
+	u.RawPath = base + "/" + escapeRemotePath(remotePath)
+	return u, nil
+}
+
+func uploadFileToCloud(ctx context.Context, cfg CloudUploadConfig, creds CloudUploadCredentials, filePath, remotePath string) (int64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	body := newThrottledReader(f, cfg.BandwidthKBps)
+
+	client := cloudUploadClient()
+	switch cfg.Type {
+	case CloudUploadWebDAV:
+		err = webdavUpload(ctx, client, cfg.Endpoint, creds, remotePath, body, info.Size())
+	case CloudUploadS3:
+		err = s3Upload(ctx, client, cfg, creds, remotePath, body, info.Size(), time.Now())
+	default:
+		err = fmt.Errorf("unsupported cloud upload type: %s", cfg.Type)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// webdavUpload creates the parent collections with MKCOL, then PUTs the file.
+func webdavUpload(ctx context.Context, client *http.Client, endpoint string, creds CloudUploadCredentials, remotePath string, body io.Reader, size int64) error {
+	do := func(method, path string, body io.Reader, size int64) (*http.Response, error) {
+		u, err := remoteURL(endpoint, path)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = size
+		if creds.Username != "" || creds.Password != "" {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+		return client.Do(req)
+	}
+
+	segments := strings.Split(remotePath, "/")
+	for i := 1; i < len(segments); i++ {
+		resp, err := do("MKCOL", strings.Join(segments[:i], "/")+"/", nil, 0)
+		if err != nil {
+			return err
+		}
+		// 405 means the collection already exists.
+		if resp.StatusCode == http.StatusMethodNotAllowed {
+			resp.Body.Close()
+			continue
+		}
+		if err := checkUploadResponse("MKCOL", resp); err != nil {
+			return err
+		}
+	}
+
+	resp, err := do(http.MethodPut, remotePath, body, size)
+	if err != nil {
+		return err
+	}
+	return checkUploadResponse("PUT", resp)
+}
+
+func s3Upload(ctx context.Context, client *http.Client, cfg CloudUploadConfig, creds CloudUploadCredentials, remotePath string, body io.Reader, size int64, now time.Time) error {
+	u, err := remoteURL(cfg.Endpoint, strings.Trim(cfg.Bucket, "/")+"/"+remotePath)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	// Hashing the payload would mean reading every file twice.
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	signS3Request(req, creds, cfg.Region, now)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkUploadResponse("PUT", resp)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signS3Request adds an AWS Signature Version 4 Authorization header. It
+// signs host, content-type, range and every x-amz-* header; the payload
+// hash is taken from X-Amz-Content-Sha256.
+func signS3Request(req *http.Request, creds CloudUploadCredentials, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// CloudUploadStatus returns recent upload jobs, newest first.
+func CloudUploadStatus() []CloudUploadJob {
+	cloudUploadMu.Lock()
+	defer cloudUploadMu.Unlock()
+	jobs := make([]CloudUploadJob, 0, len(cloudUploadJobs))
+	for i := len(cloudUploadJobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, *cloudUploadJobs[i])
+	}
+	return jobs
+}
+
+func GetCloudUploadStatusJSON() (string, error) {
+	jsonBytes, err := json.Marshal(CloudUploadStatus())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// RetryCloudUpload re-queues a failed upload.
+func RetryCloudUpload(jobID string) error {
+	cloudUploadMu.Lock()
+	defer cloudUploadMu.Unlock()
+	for _, job := range cloudUploadJobs {
+		if job.ID != jobID {
+			continue
+		}
+		if job.State != CloudUploadFailed {
+			return fmt.Errorf("upload %s is %s", jobID, job.State)
+		}
+		if job.source == "" {
+			return fmt.Errorf("upload %s no longer has its file", jobID)
+		}
+		job.State, job.Error, job.Attempts, job.FinishedAt = CloudUploadQueued, "", 0, 0
+		startCloudUploadLocked(job)
+		return nil
+	}
+	return fmt.Errorf("upload not found: %s", jobID)
+}
@@ -0,0 +1,123 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const VariousArtists = "Various Artists"
+
+// Minimum number of tracks before artist spread alone marks an album as a
+// compilation; smaller releases are usually splits or collaborations.
+const minCompilationTracks = 4
+
+var variousArtistsAliases = map[string]bool{
+	"various artists":          true,
+	"various":                  true,
+	"va":                       true,
+	"v.a.":                     true,
+	"v/a":                      true,
+	"varios artistas":          true,
+	"verschiedene interpreten": true,
+	"artistes variés":          true,
+	"artisti vari":             true,
+	"vários artistas":          true,
+}
+
+func isVariousArtists(name string) bool {
+	return variousArtistsAliases[strings.ToLower(strings.TrimSpace(name))]
+}
+
+func primaryArtist(artists string) string {
+	parts := splitArtists(artists)
+	if len(parts) == 0 {
+		return strings.TrimSpace(artists)
+	}
+	return parts[0]
+}
+
+// detectCompilation reports whether an album should be tagged as a
+// compilation. Explicit signals (album type, a "Various Artists" album artist)
+// win; otherwise the album counts as one when no single primary artist
+// appears on at least half of its tracks.
+func detectCompilation(albumArtist, albumType string, trackArtists []string) bool {
+	if strings.EqualFold(strings.TrimSpace(albumType), "compilation") || isVariousArtists(albumArtist) {
+		return true
+	}
+	if len(trackArtists) < minCompilationTracks {
+		return false
+	}
+
+	counts := make(map[string]int)
+	maxCount := 0
+	for _, artists := range trackArtists {
+		key := strings.ToLower(primaryArtist(artists))
+		if key == "" {
+			continue
+		}
+		counts[key]++
+		if counts[key] > maxCount {
+			maxCount = counts[key]
+		}
+	}
+	return len(counts) > 1 && maxCount*2 < len(trackArtists)
+}
+
+// applyCompilationDetection normalises album artist and compilation flag on
+// a download request so tags and {album_artist} folders stay consistent.
+func applyCompilationDetection(req *DownloadRequest) {
+	if req == nil {
+		return
+	}
+	if detectCompilation(req.AlbumArtist, req.AlbumType, nil) {
+		req.Compilation = true
+	}
+	if req.Compilation && (req.AlbumArtist == "" || isVariousArtists(req.AlbumArtist)) {
+		req.AlbumArtist = VariousArtists
+	}
+}
+
+type CompilationInfo struct {
+	Compilation bool   `json:"compilation"`
+	AlbumArtist string `json:"album_artist"`
+}
+
+// DetectAlbumCompilation inspects a full track list so Flutter can set the
+// album artist before queueing the individual downloads.
+func DetectAlbumCompilation(tracks []AlbumTrackMetadata) CompilationInfo {
+	if len(tracks) == 0 {
+		return CompilationInfo{}
+	}
+
+	albumArtist := strings.TrimSpace(tracks[0].AlbumArtist)
+	albumType := tracks[0].AlbumType
+	trackArtists := make([]string, 0, len(tracks))
+	for _, track := range tracks {
+		trackArtists = append(trackArtists, track.Artists)
+	}
+
+	info := CompilationInfo{
+		Compilation: detectCompilation(albumArtist, albumType, trackArtists),
+		AlbumArtist: albumArtist,
+	}
+	if info.Compilation && (albumArtist == "" || isVariousArtists(albumArtist)) {
+		info.AlbumArtist = VariousArtists
+	} else if albumArtist == "" {
+		info.AlbumArtist = primaryArtist(tracks[0].Artists)
+	}
+	return info
+}
+
+func DetectAlbumCompilationJSON(tracksJSON string) (string, error) {
+	var tracks []AlbumTrackMetadata
+	if err := json.Unmarshal([]byte(tracksJSON), &tracks); err != nil {
+		return "", fmt.Errorf("invalid tracks JSON: %w", err)
+	}
+
+	jsonBytes, err := json.Marshal(DetectAlbumCompilation(tracks))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
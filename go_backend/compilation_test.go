@@ -0,0 +1,69 @@
+package gobackend
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectCompilation(t *testing.T) {
+	cases := []struct {
+		name         string
+		albumArtist  string
+		albumType    string
+		trackArtists []string
+		want         bool
+	}{
+		{"explicit album type", "Some DJ", "compilation", nil, true},
+		{"various artists alias", "V.A.", "album", nil, true},
+		{"single artist album", "Artist", "album", []string{"Artist", "Artist feat. Guest", "Artist", "Artist & Other"}, false},
+		{"mixed artists", "", "album", []string{"A", "B", "C", "D", "A"}, true},
+		{"too few tracks", "", "single", []string{"A", "B"}, false},
+	}
+
+	for _, tc := range cases {
+		if got := detectCompilation(tc.albumArtist, tc.albumType, tc.trackArtists); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestApplyCompilationDetectionNormalizesAlbumArtist(t *testing.T) {
+	req := DownloadRequest{ArtistName: "Track Artist", AlbumArtist: "various", AlbumType: "album"}
+	applyCompilationDetection(&req)
+
+	if !req.Compilation || req.AlbumArtist != VariousArtists {
+		t.Fatalf("expected compilation with %q, got compilation=%v album_artist=%q", VariousArtists, req.Compilation, req.AlbumArtist)
+	}
+
+	formatted := buildFilenameFromTemplate("{album_artist}/{artist} - {title}", map[string]interface{}{
+		"title":        "Song",
+		"artist":       req.ArtistName,
+		"album_artist": req.AlbumArtist,
+	})
+	if formatted != "Various Artists/Track Artist - Song" {
+		t.Fatalf("unexpected filename %q", formatted)
+	}
+}
+
+func TestEmbedMetadataClearsCompilation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.flac")
+	writeTestFLAC(t, path)
+
+	if err := EmbedMetadata(path, Metadata{Title: "Song", Compilation: true}, ""); err != nil {
+		t.Fatalf("EmbedMetadata failed: %v", err)
+	}
+	if meta, err := ReadMetadata(path); err != nil || !meta.Compilation {
+		t.Fatalf("expected COMPILATION to be set, got %+v (err %v)", meta, err)
+	}
+
+	if err := EmbedMetadata(path, Metadata{Title: "Song"}, ""); err != nil {
+		t.Fatalf("EmbedMetadata failed: %v", err)
+	}
+	meta, err := ReadMetadata(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Compilation {
+		t.Fatal("expected COMPILATION to be cleared on retag")
+	}
+}
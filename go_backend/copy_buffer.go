@@ -0,0 +1,66 @@
+package gobackend
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// ==================== Download copy buffers ====================
+//
+// Every audio download streams through one buffered writer between the HTTP
+// body and the output file. The writers are pooled so concurrent hi-res
+// downloads reuse the same few buffers instead of allocating a fresh one per
+// item, and BackendConfig.CopyBufferKB sizes them: low-RAM devices can drop
+// to 128 KB, fast storage benefits from up to 1 MB.
+
+const (
+	defaultCopyBufferKB = 256
+	minCopyBufferKB     = 128
+	maxCopyBufferKB     = 1024
+)
+
+var (
+	copyWriterPoolMu sync.Mutex
+	copyWriterPool   *sync.Pool
+	copyWriterSize   int
+)
+
+// currentCopyWriterPool returns the pool for the configured size, replacing
+// it when the setting changed. Writers of the old size are left to the GC.
+func currentCopyWriterPool() (*sync.Pool, int) {
+	size := GetBackendConfig().CopyBufferKB * 1024
+	if size <= 0 {
+		size = defaultCopyBufferKB * 1024
+	}
+
+	copyWriterPoolMu.Lock()
+	defer copyWriterPoolMu.Unlock()
+	if copyWriterPool == nil || copyWriterSize != size {
+		copyWriterSize = size
+		copyWriterPool = &sync.Pool{
+			New: func() interface{} { return bufio.NewWriterSize(nil, size) },
+		}
+	}
+	return copyWriterPool, size
+}
+
+// acquireCopyWriter returns a pooled buffered writer wrapping w. Callers must
+// Flush it and hand it back with releaseCopyWriter.
+func acquireCopyWriter(w io.Writer) *bufio.Writer {
+	pool, _ := currentCopyWriterPool()
+	bw := pool.Get().(*bufio.Writer)
+	bw.Reset(w)
+	return bw
+}
+
+func releaseCopyWriter(bw *bufio.Writer) {
+	if bw == nil {
+		return
+	}
+	bw.Reset(nil)
+	pool, size := currentCopyWriterPool()
+	if bw.Size() == size {
+		pool.Put(bw)
+	}
+}
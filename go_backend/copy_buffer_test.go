@@ -0,0 +1,39 @@
+package gobackend
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCopyWriterFollowsConfiguredSize(t *testing.T) {
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+
+	if err := SetBackendConfigJSON(`{"copy_buffer_kb": 128}`); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	bw := acquireCopyWriter(&out)
+	if bw.Size() != 128*1024 {
+		t.Fatalf("expected 128 KB writer, got %d", bw.Size())
+	}
+	bw.WriteString("audio")
+	bw.Flush()
+	releaseCopyWriter(bw)
+	if out.String() != "audio" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+
+	if err := SetBackendConfigJSON(`{"copy_buffer_kb": 1024}`); err != nil {
+		t.Fatal(err)
+	}
+	bw = acquireCopyWriter(&out)
+	defer releaseCopyWriter(bw)
+	if bw.Size() != 1024*1024 {
+		t.Fatalf("expected pool to switch to 1 MB writers, got %d", bw.Size())
+	}
+
+	if err := SetBackendConfigJSON(`{"copy_buffer_kb": 16}`); err == nil {
+		t.Fatal("expected undersized copy buffer to be rejected")
+	}
+}
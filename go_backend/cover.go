@@ -1,8 +1,10 @@
 package gobackend
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"regexp"
 	"strings"
@@ -12,8 +14,87 @@ const (
 	spotifySize300 = "ab67616d00001e02"
 	spotifySize640 = "ab67616d0000b273"
 	spotifySizeMax = "ab67616d000082c1"
+
+	defaultMaxCoverMB = 20
+	maxMaxCoverMB     = 100
+
+	// CoverErrorOversize is the code of CoverOversizeError.
+	CoverErrorOversize = "OVERSIZE"
 )
 
+// CoverOversizeError means a cover was larger than BackendConfig.MaxCoverMB.
+// Size is what the server announced, or what had been read when the
+// download was aborted.
+type CoverOversizeError struct {
+	URL   string
+	Size  int64
+	Limit int64
+}
+
+func (e *CoverOversizeError) Error() string {
+	return fmt.Sprintf("%s: cover exceeds %d MB limit (%d bytes)", CoverErrorOversize, e.Limit>>20, e.Size)
+}
+
+func maxCoverBytes() int64 {
+	mb := GetBackendConfig().MaxCoverMB
+	if mb <= 0 {
+		mb = defaultMaxCoverMB
+	}
+	return int64(mb) << 20
+}
+
+// coverContentTypeAllowed accepts image types and the generic types some
+// CDNs send for images; anything else (HTML error pages, JSON, audio) is
+// refused before the body is read.
+func coverContentTypeAllowed(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return true
+	case mediaType == "application/octet-stream", mediaType == "binary/octet-stream":
+		return true
+	}
+	return false
+}
+
+// readCoverBody streams a cover response into memory, aborting as soon as
+// it passes the size limit instead of buffering whatever the server sends.
+func readCoverBody(resp *http.Response, coverURL string) ([]byte, error) {
+	limit := maxCoverBytes()
+	if resp.ContentLength > limit {
+		return nil, &CoverOversizeError{URL: coverURL, Size: resp.ContentLength, Limit: limit}
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if !coverContentTypeAllowed(contentType) {
+		return nil, fmt.Errorf("cover has unexpected content type %q", contentType)
+	}
+
+	// Size the buffer from Content-Length so a 2000x2000 JPEG is read in one
+	// allocation instead of io.ReadAll's repeated growth.
+	var buf bytes.Buffer
+	if resp.ContentLength > 0 {
+		buf.Grow(int(resp.ContentLength))
+	}
+	if _, err := buf.ReadFrom(io.LimitReader(resp.Body, limit+1)); err != nil {
+		return nil, fmt.Errorf("failed to read cover data: %w", err)
+	}
+	if int64(buf.Len()) > limit {
+		return nil, &CoverOversizeError{URL: coverURL, Size: int64(buf.Len()), Limit: limit}
+	}
+
+	data := buf.Bytes()
+	if !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, fmt.Errorf("cover data is not an image")
+	}
+	return data, nil
+}
+
 // Deezer CDN supports these sizes: 56, 250, 500, 1000, 1400, 1800
 var deezerSizeRegex = regexp.MustCompile(`/(\d+)x(\d+)-\d+-\d+-\d+-\d+\.jpg$`)
 
@@ -66,9 +147,9 @@ func downloadCoverToMemory(coverURL string, maxQuality bool) ([]byte, error) {
 		return nil, fmt.Errorf("cover download failed: HTTP %d", resp.StatusCode)
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	data, err := readCoverBody(resp, downloadURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read cover data: %w", err)
+		return nil, err
 	}
 
 	sizeKB := len(data) / 1024
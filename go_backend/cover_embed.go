@@ -0,0 +1,275 @@
+package gobackend
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ==================== Cover embedding rules ====================
+//
+// Some players, car stereos in particular, refuse embedded art that is too
+// large, PNG, or progressive JPEG. Each container gets a rule that is applied
+// right before the picture is written: FLAC in buildPictureBlock, the other
+// formats through PrepareCoverForEmbedding before Flutter hands the file to
+// FFmpeg. A zero rule leaves the cover untouched.
+
+const (
+	coverEmbedQuality    = 90
+	coverEmbedMinQuality = 60
+	coverEmbedMinSide    = 300
+	maxCoverEmbedBytes   = 20 << 20
+)
+
+// CoverEmbedRule constrains embedded art for one container format.
+type CoverEmbedRule struct {
+	// MaxBytes re-encodes, then downscales, covers larger than this; 0 means no limit.
+	MaxBytes int64 `json:"max_bytes"`
+	// MaxDimension downscales covers whose longer side exceeds it; 0 means no limit.
+	MaxDimension int `json:"max_dimension"`
+	// ForceJPEG converts PNG and GIF covers to JPEG.
+	ForceJPEG bool `json:"force_jpeg"`
+	// StripProgressive re-encodes progressive JPEGs as baseline.
+	StripProgressive bool `json:"strip_progressive"`
+	// Normalize strips EXIF, ICC and text metadata and converts CMYK to sRGB.
+	Normalize bool `json:"normalize"`
+}
+
+// CoverEmbedRules holds one rule per container; it lives in BackendConfig
+// under cover_embed.
+type CoverEmbedRules struct {
+	FLAC CoverEmbedRule `json:"flac"`
+	MP3  CoverEmbedRule `json:"mp3"`
+	M4A  CoverEmbedRule `json:"m4a"`
+	Opus CoverEmbedRule `json:"opus"`
+}
+
+// defaultCoverEmbedRules only normalizes FLAC art and makes lossy files,
+// which are the ones that end up on car stereos, safe by default.
+func defaultCoverEmbedRules() CoverEmbedRules {
+	compatible := CoverEmbedRule{
+		MaxBytes:         500 << 10,
+		ForceJPEG:        true,
+		StripProgressive: true,
+		Normalize:        true,
+	}
+	return CoverEmbedRules{
+		FLAC: CoverEmbedRule{Normalize: true},
+		MP3:  compatible,
+		M4A:  compatible,
+		Opus: CoverEmbedRule{ForceJPEG: true, StripProgressive: true, Normalize: true},
+	}
+}
+
+func (r CoverEmbedRule) validate(name string) error {
+	if r.MaxBytes < 0 || r.MaxBytes > maxCoverEmbedBytes {
+		return fmt.Errorf("cover_embed.%s.max_bytes must be between 0 and %d", name, maxCoverEmbedBytes)
+	}
+	if r.MaxDimension != 0 && r.MaxDimension < coverEmbedMinSide {
+		return fmt.Errorf("cover_embed.%s.max_dimension must be 0 or at least %d", name, coverEmbedMinSide)
+	}
+	return nil
+}
+
+func (r CoverEmbedRules) validate() error {
+	for _, f := range []struct {
+		name string
+		rule CoverEmbedRule
+	}{{"flac", r.FLAC}, {"mp3", r.MP3}, {"m4a", r.M4A}, {"opus", r.Opus}} {
+		if err := f.rule.validate(f.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// coverEmbedRuleFor accepts a container name or a file path.
+func coverEmbedRuleFor(format string) (CoverEmbedRule, bool) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if ext := filepath.Ext(format); ext != "" {
+		format = ext[1:]
+	}
+	rules := GetBackendConfig().CoverEmbed
+	switch format {
+	case "flac":
+		return rules.FLAC, true
+	case "mp3":
+		return rules.MP3, true
+	case "m4a", "mp4", "aac", "alac":
+		return rules.M4A, true
+	case "opus", "ogg":
+		return rules.Opus, true
+	}
+	return CoverEmbedRule{}, false
+}
+
+// isProgressiveJPEG walks the marker segments up to the first frame header.
+func isProgressiveJPEG(data []byte) bool {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return false
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			i++
+			continue
+		case marker == 0xC2, marker == 0xC6, marker == 0xCA, marker == 0xCE:
+			return true
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			return false
+		case marker == 0xD9, marker == 0xDA:
+			return false
+		}
+		i += 2 + (int(data[i+2])<<8 | int(data[i+3]))
+	}
+	return false
+}
+
+// applyCoverEmbedRule returns data unchanged when it already satisfies rule,
+// and otherwise a baseline JPEG that meets it as far as possible. Covers that
+// cannot be decoded (WebP, truncated files) are embedded as they are.
+func applyCoverEmbedRule(data []byte, rule CoverEmbedRule) ([]byte, error) {
+	if rule.Normalize {
+		normalized, err := normalizeCover(data)
+		if err != nil {
+			return data, err
+		}
+		data = normalized
+	}
+	mime := detectCoverMIME("", data)
+	cfg, _, cfgErr := stdimage.DecodeConfig(bytes.NewReader(data))
+
+	needsWork := rule.ForceJPEG && mime != "image/jpeg" ||
+		rule.StripProgressive && mime == "image/jpeg" && isProgressiveJPEG(data) ||
+		rule.MaxBytes > 0 && int64(len(data)) > rule.MaxBytes ||
+		rule.MaxDimension > 0 && cfgErr == nil && max(cfg.Width, cfg.Height) > rule.MaxDimension
+	if !needsWork {
+		return data, nil
+	}
+
+	src, _, err := stdimage.Decode(bytes.NewReader(data))
+	if err != nil {
+		return data, fmt.Errorf("failed to decode %s cover: %w", mime, err)
+	}
+	img := flattenCover(src)
+	if rule.MaxDimension > 0 {
+		img = fitCover(img, rule.MaxDimension)
+	}
+
+	var out []byte
+	for {
+		for quality := coverEmbedQuality; quality >= coverEmbedMinQuality; quality -= 10 {
+			if out, err = encodeCoverJPEG(img, quality); err != nil {
+				return data, err
+			}
+			if rule.MaxBytes <= 0 || int64(len(out)) <= rule.MaxBytes {
+				return out, nil
+			}
+		}
+		side := max(img.Bounds().Dx(), img.Bounds().Dy()) * 3 / 4
+		if side < coverEmbedMinSide {
+			return out, nil
+		}
+		img = fitCover(img, side)
+	}
+}
+
+func encodeCoverJPEG(img stdimage.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("failed to encode cover: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// flattenCover draws src onto white so transparent PNG areas do not turn
+// black in the JPEG.
+func flattenCover(src stdimage.Image) *stdimage.RGBA {
+	b := src.Bounds()
+	dst := stdimage.NewRGBA(stdimage.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), &stdimage.Uniform{C: color.White}, stdimage.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Over)
+	return dst
+}
+
+// fitCover box-filters img down so its longer side is at most maxSide.
+func fitCover(img *stdimage.RGBA, maxSide int) *stdimage.RGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	if sw <= maxSide && sh <= maxSide {
+		return img
+	}
+	dw, dh := maxSide, sh*maxSide/sw
+	if sh > sw {
+		dw, dh = sw*maxSide/sh, maxSide
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := stdimage.NewRGBA(stdimage.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := img.Pix[sy*img.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r, g, b, a = r+int(p[0]), g+int(p[1]), b+int(p[2]), a+int(p[3])
+					n++
+				}
+			}
+			o := dst.PixOffset(x, y)
+			dst.Pix[o], dst.Pix[o+1], dst.Pix[o+2], dst.Pix[o+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// prepareEmbeddedCover applies the format's rule, falling back to the
+// original bytes when the cover cannot be converted.
+func prepareEmbeddedCover(format string, data []byte) []byte {
+	rule, ok := coverEmbedRuleFor(format)
+	if !ok || rule == (CoverEmbedRule{}) {
+		return data
+	}
+	out, err := applyCoverEmbedRule(data, rule)
+	if err != nil {
+		GoLog("[Cover] Embedding %s cover unchanged: %v\n", format, err)
+		return data
+	}
+	if len(out) != len(data) {
+		GoLog("[Cover] Adjusted %s cover for embedding: %d KB -> %d KB\n", format, len(data)/1024, len(out)/1024)
+	}
+	return out
+}
+
+// PrepareCoverForEmbedding rewrites the cover at coverPath to satisfy the
+// embedding rule of format ("mp3", "m4a", "opus", "flac" or an audio path).
+// Flutter calls it before passing the cover to FFmpeg.
+func PrepareCoverForEmbedding(coverPath, format string) error {
+	if _, ok := coverEmbedRuleFor(format); !ok {
+		return fmt.Errorf("unsupported format for cover embedding: %s", format)
+	}
+	data, err := os.ReadFile(coverPath)
+	if err != nil {
+		return fmt.Errorf("failed to read cover: %w", err)
+	}
+	out := prepareEmbeddedCover(format, data)
+	if bytes.Equal(out, data) {
+		return nil
+	}
+	if err := os.WriteFile(coverPath, out, 0644); err != nil {
+		return fmt.Errorf("failed to write cover: %w", err)
+	}
+	return nil
+}
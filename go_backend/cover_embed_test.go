@@ -0,0 +1,127 @@
+package gobackend
+
+import (
+	"bytes"
+	stdimage "image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testCoverImage(size int, noisy bool) *stdimage.RGBA {
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, size, size))
+	rng := rand.New(rand.NewSource(1))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			c := color.RGBA{uint8(x), uint8(y), 128, 255}
+			if noisy {
+				c = color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestIsProgressiveJPEG(t *testing.T) {
+	var baseline bytes.Buffer
+	if err := jpeg.Encode(&baseline, testCoverImage(32, false), nil); err != nil {
+		t.Fatal(err)
+	}
+	if isProgressiveJPEG(baseline.Bytes()) {
+		t.Error("baseline JPEG reported as progressive")
+	}
+
+	// Go only writes baseline JPEGs; swap the SOF0 marker to fake SOF2.
+	progressive := append([]byte(nil), baseline.Bytes()...)
+	if i := bytes.Index(progressive, []byte{0xFF, 0xC0}); i >= 0 {
+		progressive[i+1] = 0xC2
+	}
+	if !isProgressiveJPEG(progressive) {
+		t.Error("SOF2 JPEG not reported as progressive")
+	}
+	if isProgressiveJPEG([]byte("not a jpeg")) {
+		t.Error("non-JPEG reported as progressive")
+	}
+}
+
+func TestApplyCoverEmbedRule(t *testing.T) {
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, testCoverImage(800, true)); err != nil {
+		t.Fatal(err)
+	}
+
+	untouched, err := applyCoverEmbedRule(pngBuf.Bytes(), CoverEmbedRule{})
+	if err != nil || !bytes.Equal(untouched, pngBuf.Bytes()) {
+		t.Fatalf("zero rule changed the cover (err %v)", err)
+	}
+
+	rule := CoverEmbedRule{MaxBytes: 60 << 10, ForceJPEG: true, StripProgressive: true}
+	out, err := applyCoverEmbedRule(pngBuf.Bytes(), rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detectCoverMIME("", out) != "image/jpeg" {
+		t.Fatalf("expected JPEG, got %s", detectCoverMIME("", out))
+	}
+	if int64(len(out)) > rule.MaxBytes {
+		cfg, _, _ := stdimage.DecodeConfig(bytes.NewReader(out))
+		if cfg.Width >= coverEmbedMinSide*4/3 {
+			t.Fatalf("cover is %d bytes at %dpx, limit %d", len(out), cfg.Width, rule.MaxBytes)
+		}
+	}
+
+	out, err = applyCoverEmbedRule(pngBuf.Bytes(), CoverEmbedRule{MaxDimension: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := stdimage.DecodeConfig(bytes.NewReader(out))
+	if err != nil || cfg.Width != 500 || cfg.Height != 500 {
+		t.Fatalf("expected 500x500, got %dx%d (err %v)", cfg.Width, cfg.Height, err)
+	}
+}
+
+func TestPrepareCoverForEmbeddingUsesConfig(t *testing.T) {
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+	if err := SetBackendConfigJSON(`{"cover_embed": {"mp3": {"force_jpeg": true}}}`); err != nil {
+		t.Fatal(err)
+	}
+	if GetBackendConfig().CoverEmbed.M4A != defaultCoverEmbedRules().M4A {
+		t.Fatal("partial cover_embed update reset other formats")
+	}
+	if err := SetBackendConfigJSON(`{"cover_embed": {"flac": {"max_dimension": 10}}}`); err == nil {
+		t.Fatal("expected max_dimension below the minimum to be rejected")
+	}
+
+	var pngBuf bytes.Buffer
+	png.Encode(&pngBuf, testCoverImage(64, false))
+	path := filepath.Join(t.TempDir(), "cover.png")
+	if err := os.WriteFile(path, pngBuf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PrepareCoverForEmbedding(path, "song.flac"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if detectCoverMIME("", data) != "image/png" {
+		t.Fatal("default FLAC rule should keep PNG art")
+	}
+
+	if err := PrepareCoverForEmbedding(path, "mp3"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if detectCoverMIME("", data) != "image/jpeg" {
+		t.Fatal("mp3 rule should convert to JPEG")
+	}
+
+	if err := PrepareCoverForEmbedding(path, "wav"); err == nil {
+		t.Fatal("expected unsupported format error")
+	}
+}
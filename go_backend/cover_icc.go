@@ -0,0 +1,364 @@
+package gobackend
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// ==================== Embedded ICC profiles ====================
+//
+// Covers edited in wide-gamut or print workflows embed an ICC profile
+// (Adobe RGB, Display P3, ProPhoto...). Dropping it without converting
+// makes players read the pixels as sRGB and shifts every color, so
+// normalizeCover converts matrix/TRC RGB profiles to sRGB first. Profiles
+// built from lookup tables are kept as they are; unreadable ones are
+// treated as absent.
+
+const (
+	jpegICCMarker     = "ICC_PROFILE\x00"
+	iccHeaderSize     = 128
+	maxICCProfileSize = 4 << 20
+)
+
+// sRGB primaries adapted to the D50 PCS, as stored in the standard sRGB
+// IEC61966-2.1 profile. Columns are the red, green and blue colorants.
+var srgbD50Matrix = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// iccTransform maps 8-bit device RGB to 8-bit sRGB.
+type iccTransform struct {
+	toLinear [3][256]float64
+	matrix   [3][3]float64
+}
+
+// jpegICCProfile reassembles an ICC profile split across APP2 segments.
+func jpegICCProfile(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	chunks := map[int][]byte{}
+	total := 0
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			break
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) {
+			break
+		}
+		payload := data[i+4 : end]
+		if marker == 0xE2 && len(payload) > len(jpegICCMarker)+2 && string(payload[:len(jpegICCMarker)]) == jpegICCMarker {
+			seq, count := int(payload[len(jpegICCMarker)]), int(payload[len(jpegICCMarker)+1])
+			chunks[seq] = payload[len(jpegICCMarker)+2:]
+			total = count
+		}
+		i = end
+	}
+	if len(chunks) == 0 || len(chunks) != total {
+		return nil
+	}
+	var profile []byte
+	for seq := 1; seq <= total; seq++ {
+		chunk, ok := chunks[seq]
+		if !ok {
+			return nil
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile
+}
+
+// pngICCProfile inflates the profile stored in an iCCP chunk.
+func pngICCProfile(data []byte) []byte {
+	if len(data) < 8 || string(data[1:4]) != "PNG" {
+		return nil
+	}
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if end > len(data) || end < i {
+			return nil
+		}
+		kind := string(data[i+4 : i+8])
+		if kind == "IDAT" {
+			return nil
+		}
+		if kind == "iCCP" {
+			chunk := data[i+8 : i+8+length]
+			name := bytes.IndexByte(chunk, 0)
+			if name < 0 || name+2 > len(chunk) {
+				return nil
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(chunk[name+2:]))
+			if err != nil {
+				return nil
+			}
+			defer zr.Close()
+			profile, err := io.ReadAll(io.LimitReader(zr, maxICCProfileSize))
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		i = end
+	}
+	return nil
+}
+
+// newICCTransform reads a profile. It returns a nil transform when there is
+// nothing to convert: no profile, an unreadable one, or sRGB itself.
+// supported is false for valid profiles that are not matrix/TRC RGB; those
+// have to stay embedded.
+func newICCTransform(profile []byte) (transform *iccTransform, supported bool) {
+	if len(profile) < iccHeaderSize+4 || string(profile[36:40]) != "acsp" {
+		return nil, true
+	}
+	if size := int(binary.BigEndian.Uint32(profile)); size < iccHeaderSize+4 || size > len(profile) {
+		return nil, true
+	}
+	if string(profile[16:20]) != "RGB " || string(profile[20:24]) != "XYZ " {
+		return nil, false
+	}
+
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(profile[iccHeaderSize:]))
+	for n := 0; n < count; n++ {
+		entry := iccHeaderSize + 4 + n*12
+		if entry+12 > len(profile) {
+			return nil, true
+		}
+		offset := int(binary.BigEndian.Uint32(profile[entry+4:]))
+		size := int(binary.BigEndian.Uint32(profile[entry+8:]))
+		if offset < 0 || size < 0 || offset+size > len(profile) || offset+size < offset {
+			return nil, true
+		}
+		tags[string(profile[entry:entry+4])] = profile[offset : offset+size]
+	}
+
+	t := &iccTransform{}
+	var device [3][3]float64
+	for c, names := range [3][2]string{{"rXYZ", "rTRC"}, {"gXYZ", "gTRC"}, {"bXYZ", "bTRC"}} {
+		xyz, ok := parseICCXYZ(tags[names[0]])
+		if !ok {
+			return nil, false
+		}
+		curve, ok := parseICCCurve(tags[names[1]])
+		if !ok {
+			return nil, false
+		}
+		for row := 0; row < 3; row++ {
+			device[row][c] = xyz[row]
+		}
+		for v := 0; v < 256; v++ {
+			t.toLinear[c][v] = curve(float64(v) / 255)
+		}
+	}
+	inverse, ok := invert3x3(srgbD50Matrix)
+	if !ok {
+		return nil, false
+	}
+	t.matrix = multiply3x3(inverse, device)
+
+	if t.isSRGB() {
+		return nil, true
+	}
+	return t, true
+}
+
+func parseICCXYZ(tag []byte) ([3]float64, bool) {
+	var xyz [3]float64
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return xyz, false
+	}
+	for i := range xyz {
+		xyz[i] = s15Fixed16(tag[8+4*i:])
+	}
+	return xyz, true
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 65536
+}
+
+// parseICCCurve returns the decoding function of a curv or para tag.
+func parseICCCurve(tag []byte) (func(float64) float64, bool) {
+	if len(tag) < 12 {
+		return nil, false
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(binary.BigEndian.Uint32(tag[8:]))
+		switch {
+		case n == 0:
+			return func(x float64) float64 { return x }, true
+		case n == 1 && len(tag) >= 14:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, true
+		case n > 1 && len(tag) >= 12+2*n:
+			table := make([]float64, n)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+			}
+			return func(x float64) float64 {
+				pos := x * float64(n-1)
+				i := int(pos)
+				if i >= n-1 {
+					return table[n-1]
+				}
+				frac := pos - float64(i)
+				return table[i]*(1-frac) + table[i+1]*frac
+			}, true
+		}
+	case "para":
+		kind := binary.BigEndian.Uint16(tag[8:])
+		counts := map[uint16]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}
+		n, ok := counts[kind]
+		if !ok || len(tag) < 12+4*n {
+			return nil, false
+		}
+		var p [7]float64
+		for i := 0; i < n; i++ {
+			p[i] = s15Fixed16(tag[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		pow := func(x float64) float64 {
+			if x <= 0 {
+				return 0
+			}
+			return math.Pow(x, g)
+		}
+		switch kind {
+		case 0:
+			return pow, true
+		case 1:
+			return func(x float64) float64 {
+				if a != 0 && x >= -b/a {
+					return pow(a*x + b)
+				}
+				return 0
+			}, true
+		case 2:
+			return func(x float64) float64 {
+				if a != 0 && x >= -b/a {
+					return pow(a*x+b) + c
+				}
+				return c
+			}, true
+		case 3:
+			return func(x float64) float64 {
+				if x >= d {
+					return pow(a*x + b)
+				}
+				return c * x
+			}, true
+		case 4:
+			return func(x float64) float64 {
+				if x >= d {
+					return pow(a*x+b) + e
+				}
+				return c*x + f
+			}, true
+		}
+	}
+	return nil, false
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// isSRGB reports whether the transform would leave every pixel within
+// rounding of where it started.
+func (t *iccTransform) isSRGB() bool {
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			want := 0.0
+			if row == col {
+				want = 1
+			}
+			if math.Abs(t.matrix[row][col]-want) > 0.01 {
+				return false
+			}
+		}
+	}
+	for c := 0; c < 3; c++ {
+		for v := 0; v < 256; v++ {
+			if math.Abs(t.toLinear[c][v]-srgbToLinear(float64(v)/255)) > 0.005 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// apply converts 4-byte RGBA/NRGBA pixels in place; alpha is untouched.
+func (t *iccTransform) apply(pix []byte) {
+	const steps = 4096
+	var encode [steps + 1]uint8
+	for i := range encode {
+		encode[i] = uint8(math.Round(linearToSRGB(float64(i)/steps) * 255))
+	}
+	for i := 0; i+3 < len(pix); i += 4 {
+		r, g, b := t.toLinear[0][pix[i]], t.toLinear[1][pix[i+1]], t.toLinear[2][pix[i+2]]
+		for c := 0; c < 3; c++ {
+			v := t.matrix[c][0]*r + t.matrix[c][1]*g + t.matrix[c][2]*b
+			pix[i+c] = encode[int(math.Round(min(max(v, 0), 1)*steps))]
+		}
+	}
+}
+
+func multiply3x3(a, b [3][3]float64) [3][3]float64 {
+	var out [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				out[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return out
+}
+
+func invert3x3(m [3][3]float64) ([3][3]float64, bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-12 {
+		return [3][3]float64{}, false
+	}
+	var inv [3][3]float64
+	inv[0][0] = (m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det
+	inv[0][1] = (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det
+	inv[0][2] = (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det
+	inv[1][0] = (m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det
+	inv[1][1] = (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det
+	inv[1][2] = (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det
+	inv[2][0] = (m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det
+	inv[2][1] = (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det
+	inv[2][2] = (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det
+	return inv, true
+}
@@ -0,0 +1,144 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	"image/png"
+)
+
+// ==================== Cover normalization ====================
+//
+// CDN covers sometimes carry multi-megabyte ICC profiles, EXIF thumbnails or
+// Photoshop blocks, and a few are CMYK JPEGs that players render with
+// inverted or washed-out colors. normalizeCover drops that metadata and
+// re-encodes CMYK art as a baseline sRGB JPEG. An embedded RGB profile is
+// applied before it is dropped (see cover_icc.go), and one that cannot be
+// applied is kept.
+
+// JPEG segments kept by stripJPEGMetadata: APP0 (JFIF) and APP14 (Adobe),
+// whose transform flag decides how three-channel data is decoded.
+var keptJPEGSegments = map[byte]bool{0xE0: true, 0xEE: true}
+
+// PNG chunks dropped by stripPNGMetadata.
+var strippedPNGChunks = map[string]bool{
+	"iCCP": true, "sRGB": true, "gAMA": true, "cHRM": true,
+	"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true,
+}
+
+// stripJPEGMetadata removes APP1-APP13, APP15 and comment segments without
+// touching the image data. keepICC keeps the APP2 ICC profile segments.
+func stripJPEGMetadata(data []byte, keepICC bool) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, fmt.Errorf("not a JPEG")
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, fmt.Errorf("bad JPEG marker at %d", i)
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			// Entropy-coded data follows; copy the rest as is.
+			return append(out, data[i:]...), nil
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) {
+			return nil, fmt.Errorf("truncated JPEG segment")
+		}
+		isMetadata := marker >= 0xE0 && marker <= 0xEF && !keptJPEGSegments[marker] || marker == 0xFE
+		if keepICC && marker == 0xE2 && bytes.HasPrefix(data[i+4:end], []byte(jpegICCMarker)) {
+			isMetadata = false
+		}
+		if !isMetadata {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return nil, fmt.Errorf("JPEG has no scan data")
+}
+
+// stripPNGMetadata removes color-profile and text chunks. keepICC keeps the
+// iCCP chunk.
+func stripPNGMetadata(data []byte, keepICC bool) ([]byte, error) {
+	if len(data) < 8 || string(data[1:4]) != "PNG" {
+		return nil, fmt.Errorf("not a PNG")
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:8]...)
+	for i := 8; i < len(data); {
+		if i+12 > len(data) {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		if kind := string(data[i+4 : i+8]); !strippedPNGChunks[kind] || keepICC && kind == "iCCP" {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// normalizeCover strips metadata from JPEG and PNG covers. CMYK and
+// progressive JPEGs and covers with a non-sRGB RGB profile are re-encoded as
+// sRGB, which also drops their metadata. Other formats are returned
+// unchanged.
+func normalizeCover(data []byte) ([]byte, error) {
+	switch detectCoverMIME("", data) {
+	case "image/jpeg":
+		cfg, _, err := stdimage.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return data, fmt.Errorf("failed to read JPEG header: %w", err)
+		}
+		cmyk := cfg.ColorModel == color.CMYKModel
+		transform, supported := newICCTransform(jpegICCProfile(data))
+		if !cmyk && !supported {
+			return stripJPEGMetadata(data, true)
+		}
+		if cmyk || transform != nil || isProgressiveJPEG(data) {
+			src, _, err := stdimage.Decode(bytes.NewReader(data))
+			if err != nil {
+				return data, fmt.Errorf("failed to decode cover: %w", err)
+			}
+			img := flattenCover(src)
+			if transform != nil && !cmyk {
+				transform.apply(img.Pix)
+			}
+			return encodeCoverJPEG(img, coverEmbedQuality)
+		}
+		return stripJPEGMetadata(data, false)
+	case "image/png":
+		transform, supported := newICCTransform(pngICCProfile(data))
+		if !supported {
+			return stripPNGMetadata(data, true)
+		}
+		if transform == nil {
+			return stripPNGMetadata(data, false)
+		}
+		src, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return data, fmt.Errorf("failed to decode cover: %w", err)
+		}
+		img := stdimage.NewNRGBA(stdimage.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()))
+		draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+		transform.apply(img.Pix)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return data, fmt.Errorf("failed to encode cover: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return data, nil
+}
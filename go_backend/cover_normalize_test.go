@@ -0,0 +1,230 @@
+package gobackend
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	stdimage "image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+)
+
+func jpegSegment(marker byte, payload string) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	return append(seg, payload...)
+}
+
+func pngChunk(kind, payload string) []byte {
+	chunk := make([]byte, 4, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE([]byte(kind+payload)))
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, testCoverImage(16, false), nil); err != nil {
+		t.Fatal(err)
+	}
+	var tagged []byte
+	tagged = append(tagged, 0xFF, 0xD8)
+	tagged = append(tagged, jpegSegment(0xE1, "Exif\x00\x00camera")...)
+	tagged = append(tagged, jpegSegment(0xE2, "ICC_PROFILE\x00"+string(make([]byte, 4096)))...)
+	tagged = append(tagged, jpegSegment(0xEE, "Adobe\x00\x64\x00\x00\x00\x00\x01")...)
+	tagged = append(tagged, jpegSegment(0xFE, "comment")...)
+	tagged = append(tagged, plain.Bytes()[2:]...)
+
+	out, err := normalizeCover(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, []byte("Exif")) || bytes.Contains(out, []byte("ICC_PROFILE")) || bytes.Contains(out, []byte("comment")) {
+		t.Error("metadata segments were kept")
+	}
+	if !bytes.Contains(out, []byte("Adobe")) {
+		t.Error("Adobe segment was dropped")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("stripped JPEG does not decode: %v", err)
+	}
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	var plain bytes.Buffer
+	if err := png.Encode(&plain, testCoverImage(16, false)); err != nil {
+		t.Fatal(err)
+	}
+	raw := plain.Bytes()
+	ihdrEnd := 8 + 25
+	var tagged []byte
+	tagged = append(tagged, raw[:ihdrEnd]...)
+	tagged = append(tagged, pngChunk("iCCP", "profile\x00\x00data")...)
+	tagged = append(tagged, pngChunk("tEXt", "Software\x00editor")...)
+	tagged = append(tagged, raw[ihdrEnd:]...)
+
+	out, err := normalizeCover(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, raw) {
+		t.Errorf("expected the original PNG back, got %d bytes vs %d", len(out), len(raw))
+	}
+	if _, _, err := stdimage.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatalf("stripped PNG does not decode: %v", err)
+	}
+}
+
+type iccTestTag struct {
+	sig  string
+	data []byte
+}
+
+func iccXYZTag(x, y, z float64) []byte {
+	tag := []byte("XYZ \x00\x00\x00\x00")
+	for _, v := range []float64{x, y, z} {
+		tag = binary.BigEndian.AppendUint32(tag, uint32(int32(math.Round(v*65536))))
+	}
+	return tag
+}
+
+func iccGammaTag(gamma float64) []byte {
+	tag := []byte("curv\x00\x00\x00\x00")
+	tag = binary.BigEndian.AppendUint32(tag, 1)
+	return binary.BigEndian.AppendUint16(tag, uint16(gamma*256))
+}
+
+func iccSRGBCurveTag() []byte {
+	tag := []byte("para\x00\x00\x00\x00\x00\x03\x00\x00")
+	for _, v := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+		tag = binary.BigEndian.AppendUint32(tag, uint32(int32(math.Round(v*65536))))
+	}
+	return tag
+}
+
+func buildTestICCProfile(colorSpace string, tags []iccTestTag) []byte {
+	header := make([]byte, 128)
+	copy(header[16:], colorSpace)
+	copy(header[20:], "XYZ ")
+	copy(header[36:], "acsp")
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	offset := 128 + 4 + 12*len(tags)
+	var data []byte
+	for _, tag := range tags {
+		table = append(table, tag.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset+len(data)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag.data)))
+		data = append(data, tag.data...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	profile := append(append(header, table...), data...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+// matrixTestProfile uses the sRGB primaries with the given curve, so only
+// the transfer function differs from sRGB.
+func matrixTestProfile(curve []byte) []byte {
+	return buildTestICCProfile("RGB ", []iccTestTag{
+		{"rXYZ", iccXYZTag(0.4360747, 0.2225045, 0.0139322)},
+		{"gXYZ", iccXYZTag(0.3850649, 0.7168786, 0.0971045)},
+		{"bXYZ", iccXYZTag(0.1430804, 0.0606169, 0.7141733)},
+		{"rTRC", curve}, {"gTRC", curve}, {"bTRC", curve},
+	})
+}
+
+func uniformCoverImage(c color.RGBA) *stdimage.RGBA {
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, 16, 16))
+	draw.Draw(img, img.Bounds(), &stdimage.Uniform{C: c}, stdimage.Point{}, draw.Src)
+	return img
+}
+
+func jpegWithICC(t *testing.T, img stdimage.Image, profile []byte) []byte {
+	t.Helper()
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	out := []byte{0xFF, 0xD8}
+	out = append(out, jpegSegment(0xE2, "ICC_PROFILE\x00\x01\x01"+string(profile))...)
+	return append(out, plain.Bytes()[2:]...)
+}
+
+func TestNormalizeCoverConvertsICCProfileToSRGB(t *testing.T) {
+	// With a linear curve, 128 means 50% light, which sRGB encodes as 188.
+	linear := matrixTestProfile(iccGammaTag(1))
+	tagged := jpegWithICC(t, uniformCoverImage(color.RGBA{128, 128, 128, 255}), linear)
+
+	out, err := normalizeCover(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, []byte("ICC_PROFILE")) {
+		t.Error("profile was kept after conversion")
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, _ := img.At(8, 8).RGBA(); r>>8 < 185 || r>>8 > 191 {
+		t.Errorf("converted gray = %d, want about 188", r>>8)
+	}
+
+	var plain bytes.Buffer
+	if err := png.Encode(&plain, uniformCoverImage(color.RGBA{128, 64, 255, 255})); err != nil {
+		t.Fatal(err)
+	}
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write(linear)
+	zw.Close()
+	raw := plain.Bytes()
+	taggedPNG := append(append(append([]byte{}, raw[:33]...), pngChunk("iCCP", "linear\x00\x00"+zbuf.String())...), raw[33:]...)
+
+	out, err = normalizeCover(taggedPNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pngImg, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := color.NRGBA{188, 137, 255, 255}
+	if got := color.NRGBAModel.Convert(pngImg.At(0, 0)).(color.NRGBA); got != want {
+		t.Errorf("converted PNG pixel = %v, want %v", got, want)
+	}
+}
+
+func TestNormalizeCoverStripsSRGBProfile(t *testing.T) {
+	tagged := jpegWithICC(t, testCoverImage(16, false), matrixTestProfile(iccSRGBCurveTag()))
+	out, err := normalizeCover(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripped, err := stripJPEGMetadata(tagged, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, stripped) {
+		t.Error("an sRGB profile should be stripped without re-encoding")
+	}
+}
+
+func TestNormalizeCoverKeepsUnsupportedProfile(t *testing.T) {
+	lutOnly := buildTestICCProfile("RGB ", []iccTestTag{{"A2B0", []byte("mft2\x00\x00\x00\x00")}})
+	out, err := normalizeCover(jpegWithICC(t, testCoverImage(16, false), lutOnly))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out, []byte("ICC_PROFILE")) {
+		t.Error("a profile that cannot be applied must stay embedded")
+	}
+}
@@ -0,0 +1,293 @@
+package gobackend
+
+import (
+	"bytes"
+	"fmt"
+	stdimage "image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CoverPreferenceLargest  = "largest"
+	CoverPreferenceSpotify  = "spotify"
+	CoverPreferenceDeezer   = "deezer"
+	CoverPreferenceProvider = "provider"
+
+	coverProbeBytes    = 64 * 1024
+	coverProbeTimeout  = 10 * time.Second
+	coverProbeCacheTTL = 6 * time.Hour
+	maxCoverProbeCache = 512
+)
+
+type CoverCandidate struct {
+	Source string `json:"source"`
+	URL    string `json:"url"`
+}
+
+type CoverProbeResult struct {
+	Source string `json:"source"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+	Size   int64  `json:"size,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (r *CoverProbeResult) pixels() int {
+	return r.Width * r.Height
+}
+
+type coverProbeCacheEntry struct {
+	result    CoverProbeResult
+	expiresAt time.Time
+}
+
+var (
+	coverPreference   = CoverPreferenceLargest
+	coverPreferenceMu sync.RWMutex
+
+	coverProbeCache   = make(map[string]coverProbeCacheEntry)
+	coverProbeCacheMu sync.RWMutex
+)
+
+func SetCoverSourcePreference(preference string) {
+	preference = strings.ToLower(strings.TrimSpace(preference))
+	switch preference {
+	case CoverPreferenceSpotify, CoverPreferenceDeezer, CoverPreferenceProvider:
+	default:
+		preference = CoverPreferenceLargest
+	}
+
+	coverPreferenceMu.Lock()
+	coverPreference = preference
+	coverPreferenceMu.Unlock()
+	GoLog("[CoverSelector] Preference set to %s\n", preference)
+}
+
+func GetCoverSourcePreference() string {
+	coverPreferenceMu.RLock()
+	defer coverPreferenceMu.RUnlock()
+	return coverPreference
+}
+
+// detectCoverSource guesses the origin of a cover URL from its CDN host.
+func detectCoverSource(coverURL string) string {
+	lower := strings.ToLower(coverURL)
+	switch {
+	case strings.Contains(lower, "scdn.co") || strings.Contains(lower, "spotifycdn"):
+		return CoverPreferenceSpotify
+	case strings.Contains(lower, "dzcdn.net"):
+		return CoverPreferenceDeezer
+	default:
+		return CoverPreferenceProvider
+	}
+}
+
+func coverFormatScore(format string) int {
+	switch format {
+	case "png":
+		return 2
+	case "jpeg":
+		return 1
+	default:
+		return 0
+	}
+}
+
+func getCachedCoverProbe(coverURL string) (CoverProbeResult, bool) {
+	coverProbeCacheMu.RLock()
+	entry, ok := coverProbeCache[coverURL]
+	coverProbeCacheMu.RUnlock()
+	if !ok || time.Now().After(entry.expiresAt) {
+		return CoverProbeResult{}, false
+	}
+	return entry.result, true
+}
+
+func setCachedCoverProbe(coverURL string, result CoverProbeResult) {
+	coverProbeCacheMu.Lock()
+	defer coverProbeCacheMu.Unlock()
+
+	if len(coverProbeCache) >= maxCoverProbeCache {
+		now := time.Now()
+		for key, entry := range coverProbeCache {
+			if now.After(entry.expiresAt) {
+				delete(coverProbeCache, key)
+			}
+		}
+		if len(coverProbeCache) >= maxCoverProbeCache {
+			coverProbeCache = make(map[string]coverProbeCacheEntry)
+		}
+	}
+	coverProbeCache[coverURL] = coverProbeCacheEntry{
+		result:    result,
+		expiresAt: time.Now().Add(coverProbeCacheTTL),
+	}
+}
+
+// probeCover reads only the leading bytes of an image (Range request) and
+// decodes the header to learn its dimensions and format.
+func probeCover(client *http.Client, candidate CoverCandidate) CoverProbeResult {
+	coverURL := upgradeToMaxQuality(convertSmallToMedium(candidate.URL))
+	result := CoverProbeResult{Source: candidate.Source, URL: coverURL}
+	if result.Source == "" {
+		result.Source = detectCoverSource(coverURL)
+	}
+
+	if cached, ok := getCachedCoverProbe(coverURL); ok {
+		cached.Source = result.Source
+		return cached
+	}
+
+	req, err := http.NewRequest("GET", coverURL, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", coverProbeBytes-1))
+
+	resp, err := DoRequestWithUserAgent(client, req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		result.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		return result
+	}
+
+	if total := parseContentRangeTotal(resp.Header.Get("Content-Range")); total > 0 {
+		result.Size = total
+	} else if resp.ContentLength > 0 {
+		result.Size = resp.ContentLength
+	}
+
+	head, err := io.ReadAll(io.LimitReader(resp.Body, coverProbeBytes))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	cfg, format, err := stdimage.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		result.Error = fmt.Sprintf("cannot decode image header: %v", err)
+		return result
+	}
+	result.Width = cfg.Width
+	result.Height = cfg.Height
+	result.Format = format
+
+	setCachedCoverProbe(coverURL, result)
+	return result
+}
+
+// rankCoverResults sorts successful probes best-first: resolution, then
+// format, then byte size as a tie-breaker.
+func rankCoverResults(results []CoverProbeResult) []CoverProbeResult {
+	ranked := make([]CoverProbeResult, 0, len(results))
+	for _, r := range results {
+		if r.Error == "" && r.Width > 0 && r.Height > 0 {
+			ranked = append(ranked, r)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].pixels() != ranked[j].pixels() {
+			return ranked[i].pixels() > ranked[j].pixels()
+		}
+		if fi, fj := coverFormatScore(ranked[i].Format), coverFormatScore(ranked[j].Format); fi != fj {
+			return fi > fj
+		}
+		return ranked[i].Size > ranked[j].Size
+	})
+	return ranked
+}
+
+func pickCover(ranked []CoverProbeResult, preference string) *CoverProbeResult {
+	if len(ranked) == 0 {
+		return nil
+	}
+	if preference != CoverPreferenceLargest {
+		for i := range ranked {
+			if ranked[i].Source == preference {
+				return &ranked[i]
+			}
+		}
+	}
+	return &ranked[0]
+}
+
+// SelectBestCover probes all candidates in parallel and returns the best one
+// according to the configured preference. Falls back to "largest" when the
+// preferred source is absent or could not be probed.
+func SelectBestCover(candidates []CoverCandidate) (*CoverProbeResult, []CoverProbeResult) {
+	client := NewHTTPClientWithTimeout(coverProbeTimeout)
+	results := make([]CoverProbeResult, len(candidates))
+
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		if strings.TrimSpace(candidate.URL) == "" {
+			results[i] = CoverProbeResult{Source: candidate.Source, Error: "empty url"}
+			continue
+		}
+		wg.Add(1)
+		go func(idx int, c CoverCandidate) {
+			defer wg.Done()
+			results[idx] = probeCover(client, c)
+		}(i, candidate)
+	}
+	wg.Wait()
+
+	best := pickCover(rankCoverResults(results), GetCoverSourcePreference())
+	if best != nil {
+		GoLog("[CoverSelector] Selected %s cover %dx%d (%s)\n", best.Source, best.Width, best.Height, best.Format)
+	}
+	return best, results
+}
+
+// resolveTrackCoverURL returns the cover to embed for req: its CoverURL, or
+// the best of it and req.CoverCandidates when there are alternatives. The
+// URL comes back as given; the download applies its own quality upgrade.
+func resolveTrackCoverURL(req DownloadRequest) string {
+	candidates := make([]CoverCandidate, 0, len(req.CoverCandidates)+1)
+	if req.CoverURL != "" {
+		candidates = append(candidates, CoverCandidate{URL: req.CoverURL})
+	}
+	for _, c := range req.CoverCandidates {
+		if strings.TrimSpace(c.URL) != "" {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) <= 1 {
+		if len(candidates) == 1 {
+			return candidates[0].URL
+		}
+		return ""
+	}
+
+	best, results := SelectBestCover(candidates)
+	if best == nil {
+		return candidates[0].URL
+	}
+	for i, r := range results {
+		if r.URL == best.URL && r.Source == best.Source {
+			return candidates[i].URL
+		}
+	}
+	return candidates[0].URL
+}
+
+func ClearCoverProbeCache() {
+	coverProbeCacheMu.Lock()
+	coverProbeCache = make(map[string]coverProbeCacheEntry)
+	coverProbeCacheMu.Unlock()
+}
@@ -0,0 +1,84 @@
+package gobackend
+
+import (
+	"bytes"
+	stdimage "image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRankAndPickCover(t *testing.T) {
+	results := []CoverProbeResult{
+		{Source: CoverPreferenceSpotify, Width: 640, Height: 640, Format: "jpeg"},
+		{Source: CoverPreferenceDeezer, Width: 1000, Height: 1000, Format: "jpeg", Size: 100},
+		{Source: CoverPreferenceProvider, Width: 1000, Height: 1000, Format: "png", Size: 50},
+		{Source: "broken", Error: "HTTP 404"},
+	}
+	ranked := rankCoverResults(results)
+	if len(ranked) != 3 || ranked[0].Source != CoverPreferenceProvider || ranked[2].Source != CoverPreferenceSpotify {
+		t.Fatalf("ranked = %+v", ranked)
+	}
+	if got := pickCover(ranked, CoverPreferenceLargest); got.Source != CoverPreferenceProvider {
+		t.Errorf("largest picked %s", got.Source)
+	}
+	if got := pickCover(ranked, CoverPreferenceSpotify); got.Source != CoverPreferenceSpotify {
+		t.Errorf("spotify preference picked %s", got.Source)
+	}
+	if got := pickCover(ranked[1:2], CoverPreferenceSpotify); got.Source != CoverPreferenceDeezer {
+		t.Errorf("missing preferred source should fall back to largest, got %s", got.Source)
+	}
+	if pickCover(nil, CoverPreferenceLargest) != nil {
+		t.Error("picked a cover from nothing")
+	}
+}
+
+func TestResolveTrackCoverURL(t *testing.T) {
+	ClearCoverProbeCache()
+	defer ClearCoverProbeCache()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size := 300
+		if r.URL.Path == "/big.png" {
+			size = 1200
+		}
+		var buf bytes.Buffer
+		png.Encode(&buf, stdimage.NewGray(stdimage.Rect(0, 0, size, size)))
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	prev := GetBackendConfig()
+	defer UpdateBackendConfig(prev)
+
+	req := DownloadRequest{CoverURL: server.URL + "/small.png"}
+	if got := resolveTrackCoverURL(req); got != req.CoverURL {
+		t.Errorf("single cover = %q", got)
+	}
+
+	req.CoverCandidates = []CoverCandidate{{Source: CoverPreferenceDeezer, URL: server.URL + "/big.png"}}
+	if err := SetCoverSourcePreferenceJSON(`{"cover_source": "largest"}`); err != nil {
+		t.Fatal(err)
+	}
+	if got := resolveTrackCoverURL(req); got != server.URL+"/big.png" {
+		t.Errorf("largest = %q", got)
+	}
+
+	if err := SetCoverSourcePreferenceJSON(`{"cover_source": "provider"}`); err != nil {
+		t.Fatal(err)
+	}
+	if GetCoverSourcePreference() != CoverPreferenceProvider || GetBackendConfig().CoverSource != CoverPreferenceProvider {
+		t.Fatalf("preference = %q, config = %q", GetCoverSourcePreference(), GetBackendConfig().CoverSource)
+	}
+	// The request's own cover is detected as the provider's.
+	if got := resolveTrackCoverURL(req); got != req.CoverURL {
+		t.Errorf("provider preference = %q", got)
+	}
+
+	if err := SetCoverSourcePreferenceJSON(`{"cover_source": "tidal"}`); err == nil {
+		t.Error("accepted an unknown cover source")
+	}
+	if err := SetCoverSourcePreferenceJSON("spotify"); err == nil {
+		t.Error("accepted a bare string")
+	}
+}
@@ -0,0 +1,59 @@
+package gobackend
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func fetchTestCover(t *testing.T, contentType string, body []byte) ([]byte, error) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	return readCoverBody(resp, server.URL)
+}
+
+func TestReadCoverBodyLimits(t *testing.T) {
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+	if err := SetBackendConfigJSON(`{"max_cover_mb": 1}`); err != nil {
+		t.Fatal(err)
+	}
+
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0}, 1024)...)
+	if data, err := fetchTestCover(t, "image/jpeg", jpeg); err != nil || len(data) != len(jpeg) {
+		t.Fatalf("expected cover to be read, got %d bytes, err %v", len(data), err)
+	}
+	if _, err := fetchTestCover(t, "application/octet-stream", jpeg); err != nil {
+		t.Fatalf("octet-stream image should be sniffed and accepted: %v", err)
+	}
+
+	_, err := fetchTestCover(t, "image/jpeg", bytes.Repeat([]byte{0xFF}, 2<<20))
+	var oversize *CoverOversizeError
+	if !errors.As(err, &oversize) || oversize.Limit != 1<<20 {
+		t.Fatalf("expected CoverOversizeError, got %v", err)
+	}
+	if apiErrorCode(err) != "oversize" {
+		t.Fatalf("unexpected api error code %q", apiErrorCode(err))
+	}
+
+	if _, err := fetchTestCover(t, "text/html; charset=utf-8", []byte("<html>blocked</html>")); err == nil {
+		t.Fatal("expected HTML response to be rejected")
+	}
+	if _, err := fetchTestCover(t, "application/octet-stream", []byte("not an image at all")); err == nil {
+		t.Fatal("expected non-image bytes to be rejected")
+	}
+}
@@ -0,0 +1,428 @@
+package gobackend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ==================== Credential lock ====================
+//
+// With the lock on, extension credentials (where extensions keep their
+// OAuth tokens) and those of built-in features registered through
+// registerCredentialDir are encrypted under a key that lives in the platform
+// keystore, behind biometrics or the device passcode. The backend never
+// stores that key: when it needs to read or write credentials it asks the
+// Flutter-provided CredentialUnlocker, which shows the prompt and returns the
+// key. The key is then kept in memory for a short window and zeroed when it
+// expires or LockCredentials is called.
+
+const (
+	credentialLockFile         = "credential_lock.json"
+	lockedCredentialsMagic     = "SFLK1"
+	credentialUnlockKeySize    = 32
+	defaultCredentialUnlockTTL = 5 * time.Minute
+)
+
+var ErrCredentialsLocked = errors.New("credentials are locked")
+
+// CredentialUnlocker is implemented on the Flutter side. Unlock shows the
+// biometric/passcode prompt for reason and returns the base64 key from the
+// keystore, or an error when the user cancels.
+type CredentialUnlocker interface {
+	Unlock(reason string) (string, error)
+}
+
+type credentialLockFileData struct {
+	Enabled    bool   `json:"enabled"`
+	KeyCheck   string `json:"key_check"`
+	TTLSeconds int    `json:"ttl_seconds"`
+}
+
+type CredentialLockStatus struct {
+	Enabled     bool  `json:"enabled"`
+	Unlocked    bool  `json:"unlocked"`
+	ExpiresAt   int64 `json:"expires_at,omitempty"`
+	HasUnlocker bool  `json:"has_unlocker"`
+	TTLSeconds  int   `json:"ttl_seconds"`
+}
+
+var (
+	credentialLockMu     sync.Mutex
+	credentialLockDir    string
+	credentialLockState  credentialLockFileData
+	credentialUnlocker   CredentialUnlocker
+	credentialKey        []byte
+	credentialKeyExpires time.Time
+
+	// credentialUnlockMu serializes prompts so concurrent reads trigger one.
+	credentialUnlockMu sync.Mutex
+)
+
+func credentialKeyCheck(key []byte) string {
+	sum := sha256.Sum256(append([]byte("spotiflac-credential-lock:"), key...))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadCredentialLock(dir string) {
+	var state credentialLockFileData
+	if data, err := os.ReadFile(filepath.Join(dir, credentialLockFile)); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			GoLog("[CredentialLock] Ignoring corrupt %s: %v\n", credentialLockFile, err)
+			state = credentialLockFileData{}
+		}
+	}
+
+	credentialLockMu.Lock()
+	credentialLockDir = dir
+	credentialLockState = state
+	wipeCredentialKeyLocked()
+	credentialLockMu.Unlock()
+}
+
+func saveCredentialLockLocked() error {
+	if credentialLockDir == "" {
+		return fmt.Errorf("extension data directory not set")
+	}
+	path := filepath.Join(credentialLockDir, credentialLockFile)
+	if !credentialLockState.Enabled {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(credentialLockState)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func wipeCredentialKeyLocked() {
+	zeroBytes(credentialKey)
+	credentialKey = nil
+	credentialKeyExpires = time.Time{}
+}
+
+func credentialUnlockTTLLocked() time.Duration {
+	if credentialLockState.TTLSeconds > 0 {
+		return time.Duration(credentialLockState.TTLSeconds) * time.Second
+	}
+	return defaultCredentialUnlockTTL
+}
+
+func SetCredentialUnlocker(unlocker CredentialUnlocker) {
+	credentialLockMu.Lock()
+	credentialUnlocker = unlocker
+	credentialLockMu.Unlock()
+}
+
+func CredentialLockEnabled() bool {
+	credentialLockMu.Lock()
+	defer credentialLockMu.Unlock()
+	return credentialLockState.Enabled
+}
+
+// credentialsUnlocked reports whether a released key is still valid, wiping
+// it once its window has passed.
+func credentialsUnlocked() bool {
+	credentialLockMu.Lock()
+	defer credentialLockMu.Unlock()
+	if credentialKey != nil && time.Now().After(credentialKeyExpires) {
+		wipeCredentialKeyLocked()
+	}
+	return credentialKey != nil
+}
+
+func decodeCredentialUnlockKey(keyBase64 string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(keyBase64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unlock key: %w", err)
+	}
+	if len(key) != credentialUnlockKeySize {
+		zeroBytes(key)
+		return nil, fmt.Errorf("unlock key must be %d bytes", credentialUnlockKeySize)
+	}
+	return key, nil
+}
+
+// acquireCredentialKey returns a copy of the unlock key, asking the
+// unlocker when none is cached. Callers zero the copy when done.
+func acquireCredentialKey(reason string) ([]byte, error) {
+	credentialUnlockMu.Lock()
+	defer credentialUnlockMu.Unlock()
+
+	if credentialsUnlocked() {
+		credentialLockMu.Lock()
+		key := bytes.Clone(credentialKey)
+		credentialLockMu.Unlock()
+		return key, nil
+	}
+
+	credentialLockMu.Lock()
+	unlocker := credentialUnlocker
+	check := credentialLockState.KeyCheck
+	credentialLockMu.Unlock()
+	if unlocker == nil {
+		return nil, fmt.Errorf("%w: no unlock handler registered", ErrCredentialsLocked)
+	}
+
+	GoLog("[CredentialLock] Requesting unlock (%s)\n", reason)
+	keyBase64, err := unlocker.Unlock(reason)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCredentialsLocked, err)
+	}
+	key, err := decodeCredentialUnlockKey(keyBase64)
+	if err != nil {
+		return nil, err
+	}
+	if credentialKeyCheck(key) != check {
+		zeroBytes(key)
+		return nil, fmt.Errorf("%w: unlock key does not match", ErrCredentialsLocked)
+	}
+
+	credentialLockMu.Lock()
+	wipeCredentialKeyLocked()
+	credentialKey = key
+	credentialKeyExpires = time.Now().Add(credentialUnlockTTLLocked())
+	credentialLockMu.Unlock()
+	// Secret settings left in settings.json while locked can move now. The
+	// vault writes need this function again, so not while it is held.
+	go migrateAllSecretSettings()
+	return bytes.Clone(key), nil
+}
+
+type credentialFile struct {
+	id  string
+	dir string
+	ext *LoadedExtension
+}
+
+// credentialDirs are the credential stores of built-in features (cloud
+// upload, Deezer, ...), keyed by credentials ID. Each feature registers its
+// dir when Flutter sets it so the lock covers it too.
+var (
+	credentialDirsMu sync.Mutex
+	credentialDirs   = make(map[string]string)
+)
+
+func registerCredentialDir(id, dir string) {
+	credentialDirsMu.Lock()
+	credentialDirs[id] = dir
+	credentialDirsMu.Unlock()
+}
+
+// credentialFiles lists every credentials file the lock covers.
+func credentialFiles() []credentialFile {
+	var files []credentialFile
+	for _, ext := range GetExtensionManager().GetAllExtensions() {
+		if ext.DataDir == "" {
+			continue
+		}
+		for _, dir := range []string{ext.DataDir, extensionSecretsDir(ext.DataDir)} {
+			files = append(files, credentialFile{id: ext.ID, dir: dir, ext: ext})
+		}
+	}
+
+	credentialDirsMu.Lock()
+	ids := make([]string, 0, len(credentialDirs))
+	for id := range credentialDirs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		files = append(files, credentialFile{id: id, dir: credentialDirs[id]})
+	}
+	credentialDirsMu.Unlock()
+	return files
+}
+
+// recryptAllCredentials rewrites every credentials file for the new lock
+// state: sealed under unlockKey, or under the device-bound key when it is
+// nil. Files are replaced one by one through a temp file; if any write or
+// apply (which switches and saves the lock state) fails, the files already
+// rewritten get their old contents back and the lock state is unchanged,
+// so the current key still opens everything.
+func recryptAllCredentials(unlockKey []byte, apply func() error) error {
+	type rewrite struct {
+		file     credentialFile
+		original []byte
+		sealed   []byte
+	}
+	var rewrites []rewrite
+	for _, file := range credentialFiles() {
+		original, err := os.ReadFile(credentialsFilePath(file.dir))
+		if err != nil {
+			continue
+		}
+		creds, err := readCredentialsFile(file.id, file.dir)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.id, err)
+		}
+		sealed, err := encryptCredentials(file.id, file.dir, creds, unlockKey)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.id, err)
+		}
+		rewrites = append(rewrites, rewrite{file: file, original: original, sealed: sealed})
+	}
+
+	rollback := func(done []rewrite) {
+		for _, rw := range done {
+			if err := writeCredentialsData(rw.file.dir, rw.original); err != nil {
+				GoLog("[CredentialLock] Failed to restore %s: %v\n", rw.file.id, err)
+			}
+		}
+	}
+	for i, rw := range rewrites {
+		if err := writeCredentialsData(rw.file.dir, rw.sealed); err != nil {
+			rollback(rewrites[:i])
+			return fmt.Errorf("%s: %w", rw.file.id, err)
+		}
+	}
+	if err := apply(); err != nil {
+		rollback(rewrites)
+		return err
+	}
+
+	for _, rw := range rewrites {
+		if rw.file.ext != nil && rw.file.ext.runtime != nil {
+			rw.file.ext.runtime.dropCredentialsCache()
+		}
+	}
+	return nil
+}
+
+// switchCredentialLockLocked installs state and saves it, putting the old
+// state back when the save fails.
+func switchCredentialLockLocked(state credentialLockFileData) error {
+	previous := credentialLockState
+	credentialLockState = state
+	if err := saveCredentialLockLocked(); err != nil {
+		credentialLockState = previous
+		return err
+	}
+	return nil
+}
+
+// EnableCredentialLock turns the lock on with the keystore key Flutter just
+// created and re-encrypts all existing credentials under it. ttlSeconds is
+// how long one unlock lasts; 0 keeps the default.
+func EnableCredentialLock(keyBase64 string, ttlSeconds int) error {
+	if CredentialLockEnabled() {
+		return fmt.Errorf("credential lock is already enabled")
+	}
+	key, err := decodeCredentialUnlockKey(keyBase64)
+	if err != nil {
+		return err
+	}
+	if ttlSeconds < 0 {
+		ttlSeconds = 0
+	}
+
+	err = recryptAllCredentials(key, func() error {
+		credentialLockMu.Lock()
+		defer credentialLockMu.Unlock()
+		err := switchCredentialLockLocked(credentialLockFileData{
+			Enabled:    true,
+			KeyCheck:   credentialKeyCheck(key),
+			TTLSeconds: ttlSeconds,
+		})
+		if err != nil {
+			return err
+		}
+		wipeCredentialKeyLocked()
+		credentialKey = key
+		credentialKeyExpires = time.Now().Add(credentialUnlockTTLLocked())
+		return nil
+	})
+	if err != nil {
+		zeroBytes(key)
+		return err
+	}
+	GoLog("[CredentialLock] Enabled\n")
+	return nil
+}
+
+// DisableCredentialLock asks for one last unlock and moves all credentials
+// back to the device-bound key. The unlock key is only forgotten once every
+// file has been rewritten.
+func DisableCredentialLock() error {
+	if !CredentialLockEnabled() {
+		return nil
+	}
+	key, err := acquireCredentialKey("disable credential lock")
+	if err != nil {
+		return err
+	}
+	zeroBytes(key)
+
+	err = recryptAllCredentials(nil, func() error {
+		credentialLockMu.Lock()
+		defer credentialLockMu.Unlock()
+		if err := switchCredentialLockLocked(credentialLockFileData{}); err != nil {
+			return err
+		}
+		wipeCredentialKeyLocked()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	GoLog("[CredentialLock] Disabled\n")
+	return nil
+}
+
+// LockCredentials forgets the unlock key and every cached credential, so
+// the next read prompts again.
+func LockCredentials() {
+	credentialLockMu.Lock()
+	wipeCredentialKeyLocked()
+	credentialLockMu.Unlock()
+
+	for _, ext := range GetExtensionManager().GetAllExtensions() {
+		if ext.runtime != nil {
+			ext.runtime.dropCredentialsCache()
+		}
+	}
+}
+
+func GetCredentialLockStatus() CredentialLockStatus {
+	unlocked := credentialsUnlocked()
+	credentialLockMu.Lock()
+	defer credentialLockMu.Unlock()
+	status := CredentialLockStatus{
+		Enabled:     credentialLockState.Enabled,
+		Unlocked:    unlocked,
+		HasUnlocker: credentialUnlocker != nil,
+		TTLSeconds:  int(credentialUnlockTTLLocked() / time.Second),
+	}
+	if unlocked {
+		status.ExpiresAt = credentialKeyExpires.Unix()
+	}
+	return status
+}
+
+func GetCredentialLockStatusJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetCredentialLockStatus())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func isLockedCredentials(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(lockedCredentialsMagic))
+}
@@ -0,0 +1,143 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fakeUnlocker struct {
+	key   string
+	calls int
+	deny  bool
+}
+
+func (u *fakeUnlocker) Unlock(reason string) (string, error) {
+	u.calls++
+	if u.deny {
+		return "", fmt.Errorf("user cancelled")
+	}
+	return u.key, nil
+}
+
+func TestCredentialLockRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	extDir := filepath.Join(dir, "ext")
+	os.MkdirAll(extDir, 0755)
+	loadCredentialLock(dir)
+	defer loadCredentialLock(t.TempDir())
+	defer SetCredentialUnlocker(nil)
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, credentialUnlockKeySize))
+	unlocker := &fakeUnlocker{key: key}
+	SetCredentialUnlocker(unlocker)
+
+	if err := EnableCredentialLock(key, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCredentialsFile("ext", extDir, map[string]interface{}{"refresh_token": "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(credentialsFilePath(extDir))
+	if !isLockedCredentials(data) {
+		t.Fatal("expected credentials to be written in locked format")
+	}
+
+	LockCredentials()
+	creds, err := readCredentialsFile("ext", extDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds["refresh_token"] != "secret" || unlocker.calls != 1 {
+		t.Fatalf("expected one unlock prompt and the stored token, got %v after %d calls", creds, unlocker.calls)
+	}
+	if _, err := readCredentialsFile("ext", extDir); err != nil || unlocker.calls != 1 {
+		t.Fatalf("unlock should be reused within its window, calls=%d err=%v", unlocker.calls, err)
+	}
+
+	LockCredentials()
+	unlocker.deny = true
+	if _, err := readCredentialsFile("ext", extDir); !errors.Is(err, ErrCredentialsLocked) {
+		t.Fatalf("expected ErrCredentialsLocked when the prompt is cancelled, got %v", err)
+	}
+	unlocker.deny = false
+	unlocker.key = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{9}, credentialUnlockKeySize))
+	if _, err := readCredentialsFile("ext", extDir); !errors.Is(err, ErrCredentialsLocked) {
+		t.Fatalf("expected wrong key to be rejected, got %v", err)
+	}
+
+	unlocker.key = key
+	if err := DisableCredentialLock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, credentialLockFile)); !os.IsNotExist(err) {
+		t.Fatal("expected lock file to be removed")
+	}
+}
+
+func TestCredentialLockRecryptRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	loadCredentialLock(dir)
+	defer loadCredentialLock(t.TempDir())
+	defer SetCredentialUnlocker(nil)
+
+	m := GetExtensionManager()
+	var exts []*LoadedExtension
+	for _, id := range []string{"recrypt-a", "recrypt-b"} {
+		ext := &LoadedExtension{ID: id, Manifest: &ExtensionManifest{Name: id}, DataDir: t.TempDir()}
+		if err := writeCredentialsFile(id, ext.DataDir, map[string]interface{}{"token": id}); err != nil {
+			t.Fatal(err)
+		}
+		m.mu.Lock()
+		m.extensions[id] = ext
+		m.mu.Unlock()
+		exts = append(exts, ext)
+	}
+	defer func() {
+		m.mu.Lock()
+		for _, ext := range exts {
+			delete(m.extensions, ext.ID)
+		}
+		m.mu.Unlock()
+	}()
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, credentialUnlockKeySize))
+	SetCredentialUnlocker(&fakeUnlocker{key: key})
+	if err := EnableCredentialLock(key, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory in the way of b's temp file makes its rewrite fail.
+	blocker := credentialsFilePath(exts[1].DataDir) + ".tmp"
+	os.Mkdir(blocker, 0755)
+	if err := DisableCredentialLock(); err == nil {
+		t.Fatal("expected the blocked rewrite to fail")
+	}
+	if !CredentialLockEnabled() || !credentialsUnlocked() {
+		t.Fatal("a failed disable changed the lock state or dropped the key")
+	}
+	for _, ext := range exts {
+		data, _ := os.ReadFile(credentialsFilePath(ext.DataDir))
+		if !isLockedCredentials(data) {
+			t.Errorf("%s was not rolled back", ext.ID)
+		}
+		if creds, err := readCredentialsFile(ext.ID, ext.DataDir); err != nil || creds["token"] != ext.ID {
+			t.Errorf("%s unreadable after rollback: %v %v", ext.ID, creds, err)
+		}
+	}
+
+	os.Remove(blocker)
+	if err := DisableCredentialLock(); err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range exts {
+		data, _ := os.ReadFile(credentialsFilePath(ext.DataDir))
+		if isLockedCredentials(data) {
+			t.Errorf("%s still locked", ext.ID)
+		}
+	}
+}
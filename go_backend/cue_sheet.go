@@ -0,0 +1,446 @@
+package gobackend
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ==================== CUE sheets for single-file albums ====================
+//
+// Some sources deliver an album as one FLAC. WriteCueSheet writes a CUE
+// sheet next to it with one TRACK per entry, its INDEX 01 at the running
+// total of the track durations (or at start_ms when given). With split it
+// also cuts the FLAC into per-track files without re-encoding: each cut
+// lands on the FLAC frame nearest the INDEX point (at most half a block
+// off, about 46 ms for 4096-sample blocks at 44.1 kHz), frame numbers are
+// rewritten to start at zero and every file is tagged like a download.
+
+type CueTrack struct {
+	Title      string `json:"title"`
+	Artist     string `json:"artist,omitempty"`
+	ISRC       string `json:"isrc,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	// StartMs overrides the running total when set (track 1 starts at 0).
+	StartMs int64 `json:"start_ms,omitempty"`
+}
+
+type CueSheetRequest struct {
+	AudioPath   string     `json:"audio_path"`
+	CuePath     string     `json:"cue_path,omitempty"`
+	Album       string     `json:"album"`
+	AlbumArtist string     `json:"album_artist"`
+	Date        string     `json:"date,omitempty"`
+	Genre       string     `json:"genre,omitempty"`
+	Tracks      []CueTrack `json:"tracks"`
+	Split       bool       `json:"split"`
+	SplitDir    string     `json:"split_dir,omitempty"`
+}
+
+type CueSplitTrack struct {
+	Path       string `json:"path"`
+	StartMs    int64  `json:"start_ms"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type CueSheetResult struct {
+	CuePath string          `json:"cue_path"`
+	Tracks  []CueSplitTrack `json:"tracks,omitempty"`
+}
+
+// cueTrackStarts returns each track's start in milliseconds.
+func cueTrackStarts(tracks []CueTrack) ([]int64, error) {
+	starts := make([]int64, len(tracks))
+	var next int64
+	for i, track := range tracks {
+		start := next
+		if i == 0 {
+			start = 0
+		} else if track.StartMs > 0 {
+			start = track.StartMs
+		}
+		if i > 0 && start <= starts[i-1] {
+			return nil, fmt.Errorf("track %d starts before track %d ends", i+1, i)
+		}
+		if track.DurationMs <= 0 && i+1 < len(tracks) && tracks[i+1].StartMs <= 0 {
+			return nil, fmt.Errorf("track %d has no duration", i+1)
+		}
+		starts[i] = start
+		next = start + track.DurationMs
+	}
+	return starts, nil
+}
+
+// formatCueTime converts milliseconds to MM:SS:FF with 75 frames a second.
+func formatCueTime(ms int64) string {
+	frames := ms * 75 / 1000
+	return fmt.Sprintf("%02d:%02d:%02d", frames/(75*60), frames/75%60, frames%75)
+}
+
+func cueQuote(value string) string {
+	return `"` + strings.ReplaceAll(strings.TrimSpace(value), `"`, "'") + `"`
+}
+
+func buildCueSheet(req CueSheetRequest, starts []int64) string {
+	var b strings.Builder
+	if req.Genre != "" {
+		fmt.Fprintf(&b, "REM GENRE %s\r\n", cueQuote(req.Genre))
+	}
+	if req.Date != "" {
+		fmt.Fprintf(&b, "REM DATE %s\r\n", strings.TrimSpace(req.Date))
+	}
+	fmt.Fprintf(&b, "PERFORMER %s\r\n", cueQuote(req.AlbumArtist))
+	fmt.Fprintf(&b, "TITLE %s\r\n", cueQuote(req.Album))
+	fmt.Fprintf(&b, "FILE %s WAVE\r\n", cueQuote(filepath.Base(req.AudioPath)))
+	for i, track := range req.Tracks {
+		fmt.Fprintf(&b, "  TRACK %02d AUDIO\r\n", i+1)
+		fmt.Fprintf(&b, "    TITLE %s\r\n", cueQuote(track.Title))
+		if artist := firstNonEmpty(track.Artist, req.AlbumArtist); artist != "" {
+			fmt.Fprintf(&b, "    PERFORMER %s\r\n", cueQuote(artist))
+		}
+		if isrc := strings.TrimSpace(track.ISRC); isrc != "" {
+			fmt.Fprintf(&b, "    ISRC %s\r\n", isrc)
+		}
+		fmt.Fprintf(&b, "    INDEX 01 %s\r\n", formatCueTime(starts[i]))
+	}
+	return b.String()
+}
+
+// WriteCueSheet writes the CUE sheet for req and, with Split, the
+// per-track FLACs.
+func WriteCueSheet(req CueSheetRequest) (*CueSheetResult, error) {
+	if strings.TrimSpace(req.AudioPath) == "" {
+		return nil, fmt.Errorf("audio path is required")
+	}
+	if len(req.Tracks) == 0 {
+		return nil, fmt.Errorf("at least one track is required")
+	}
+	if len(req.Tracks) > 99 {
+		return nil, fmt.Errorf("a CUE sheet holds at most 99 tracks")
+	}
+	starts, err := cueTrackStarts(req.Tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	isFLAC := strings.EqualFold(filepath.Ext(req.AudioPath), ".flac")
+	if isFLAC {
+		quality, err := GetAudioQuality(req.AudioPath)
+		if err != nil {
+			return nil, err
+		}
+		if quality.SampleRate > 0 && quality.TotalSamples > 0 {
+			totalMs := quality.TotalSamples * 1000 / int64(quality.SampleRate)
+			if last := starts[len(starts)-1]; last >= totalMs {
+				return nil, fmt.Errorf("track %d starts at %s, after the end of the file", len(starts), formatCueTime(last))
+			}
+		}
+	} else if req.Split {
+		return nil, fmt.Errorf("splitting needs a FLAC file")
+	}
+
+	cuePath := req.CuePath
+	if cuePath == "" {
+		cuePath = strings.TrimSuffix(req.AudioPath, filepath.Ext(req.AudioPath)) + ".cue"
+	}
+	if err := os.WriteFile(cuePath, []byte(buildCueSheet(req, starts)), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write CUE sheet: %w", err)
+	}
+	GoLog("[Cue] Wrote %s (%d tracks)\n", filepath.Base(cuePath), len(req.Tracks))
+
+	result := &CueSheetResult{CuePath: cuePath}
+	if req.Split {
+		if result.Tracks, err = splitFLACAlbum(req, starts); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// ---------- FLAC splitting ----------
+
+type flacFrameRef struct {
+	offset    int64
+	sample    uint64
+	blockSize int
+}
+
+// readFLACMetadataBlocks reads the "fLaC" marker and every metadata block,
+// headers included, leaving r at the first audio frame.
+func readFLACMetadataBlocks(r io.Reader) ([][]byte, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "fLaC" {
+		return nil, fmt.Errorf("not a FLAC file")
+	}
+	var blocks [][]byte
+	for last := false; !last; {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("metadata is cut off")
+		}
+		last = header[0]&0x80 != 0
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		block := make([]byte, 4+length)
+		copy(block, header)
+		if _, err := io.ReadFull(r, block[4:]); err != nil {
+			return nil, fmt.Errorf("metadata is cut off")
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 || blocks[0][0]&0x7f != 0 || len(blocks[0]) != 4+34 {
+		return nil, fmt.Errorf("first block is not STREAMINFO")
+	}
+	return blocks, nil
+}
+
+// readFLACLayout returns the metadata blocks and the position of every
+// audio frame. Frame starts are found like verifyFLAC does: a valid header
+// where the previous frame's CRC-16 closes.
+func readFLACLayout(path string) (blocks [][]byte, frames []flacFrameRef, audioEnd int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer f.Close()
+	r := &countingReader{r: bufio.NewReaderSize(f, 1<<16)}
+
+	if blocks, err = readFLACMetadataBlocks(r); err != nil {
+		return nil, nil, 0, err
+	}
+
+	var (
+		crc     uint16
+		inFrame bool
+		sample  uint64
+	)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			break
+		}
+		if b == 0xFF && (!inFrame || crc == 0) {
+			peek, _ := r.r.Peek(15)
+			if h, ok := parseFLACFrameHeader(append([]byte{0xFF}, peek...)); ok {
+				if inFrame {
+					sample += uint64(frames[len(frames)-1].blockSize)
+				}
+				frames = append(frames, flacFrameRef{offset: r.pos - 1, sample: sample, blockSize: h.blockSize})
+				inFrame, crc = true, 0
+			}
+		}
+		crc = flacCRC16Update(crc, b)
+	}
+	if !inFrame || crc != 0 {
+		return nil, nil, 0, fmt.Errorf("FLAC audio is incomplete")
+	}
+	return blocks, frames, r.pos, nil
+}
+
+// encodeFLACFrameNumber writes n in FLAC's UTF-8-like coding.
+func encodeFLACFrameNumber(n uint64) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	extra := 1
+	for n >= 1<<(6*extra+6-extra) {
+		extra++
+	}
+	out := make([]byte, extra+1)
+	for i := extra; i > 0; i-- {
+		out[i] = 0x80 | byte(n&0x3f)
+		n >>= 6
+	}
+	out[0] = byte(0xff<<(7-extra)) | byte(n)
+	return out
+}
+
+// renumberFLACFrame returns frame with its frame (or sample) number
+// replaced and both CRCs recomputed.
+func renumberFLACFrame(frame []byte, number uint64) ([]byte, error) {
+	h, ok := parseFLACFrameHeader(frame)
+	if !ok || len(frame) < h.size+2 {
+		return nil, fmt.Errorf("invalid FLAC frame")
+	}
+	out := make([]byte, 0, len(frame)+6)
+	out = append(out, frame[:4]...)
+	out = append(out, encodeFLACFrameNumber(number)...)
+	out = append(out, frame[4+h.numberLen:h.size-1]...)
+	var crc8 uint8
+	for _, b := range out {
+		crc8 = flacCRC8Table[crc8^b]
+	}
+	out = append(out, crc8)
+	out = append(out, frame[h.size:len(frame)-2]...)
+	var crc16 uint16
+	for _, b := range out {
+		crc16 = flacCRC16Update(crc16, b)
+	}
+	return binary.BigEndian.AppendUint16(out, crc16), nil
+}
+
+// splitStreamInfo is the album STREAMINFO for a part: total samples set,
+// frame sizes and MD5 marked unknown.
+func splitStreamInfo(block []byte, samples uint64, last bool) []byte {
+	out := append([]byte(nil), block...)
+	out[0] = 0
+	if last {
+		out[0] = 0x80
+	}
+	info := out[4:]
+	clear(info[4:10])
+	info[13] = info[13]&0xf0 | byte(samples>>32&0x0f)
+	binary.BigEndian.PutUint32(info[14:18], uint32(samples))
+	clear(info[18:34])
+	return out
+}
+
+func splitFLACAlbum(req CueSheetRequest, starts []int64) ([]CueSplitTrack, error) {
+	quality, err := GetAudioQuality(req.AudioPath)
+	if err != nil {
+		return nil, err
+	}
+	blocks, frames, audioEnd, err := readFLACLayout(req.AudioPath)
+	if err != nil {
+		return nil, err
+	}
+	src, err := os.Open(req.AudioPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	dir := req.SplitDir
+	if dir == "" {
+		dir = filepath.Dir(req.AudioPath)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// Cut before the frame whose start is nearest each INDEX point.
+	rate := uint64(quality.SampleRate)
+	cuts := make([]int, len(starts)+1)
+	cuts[len(starts)] = len(frames)
+	for i := 1; i < len(starts); i++ {
+		target := uint64(starts[i]) * rate / 1000
+		j := sort.Search(len(frames), func(k int) bool { return frames[k].sample >= target })
+		if j > 0 && (j == len(frames) || target-frames[j-1].sample < frames[j].sample-target) {
+			j--
+		}
+		if j <= cuts[i-1] {
+			return nil, fmt.Errorf("track %d is shorter than one FLAC frame", i)
+		}
+		cuts[i] = j
+	}
+
+	var pictures [][]byte
+	for _, block := range blocks[1:] {
+		if block[0]&0x7f == 6 {
+			pictures = append(pictures, block)
+		}
+	}
+
+	result := make([]CueSplitTrack, 0, len(req.Tracks))
+	for i, track := range req.Tracks {
+		first, end := cuts[i], cuts[i+1]
+		startSample := frames[first].sample
+		endSample := frames[end-1].sample + uint64(frames[end-1].blockSize)
+
+		name := fmt.Sprintf("%02d - %s.flac", i+1, sanitizeFilename(track.Title))
+		path := filepath.Join(dir, name)
+		if err := writeFLACPart(path, src, blocks[0], pictures, frames[first:end], endOffset(frames, end, audioEnd), startSample, endSample-startSample); err != nil {
+			os.Remove(path)
+			return result, fmt.Errorf("track %d: %w", i+1, err)
+		}
+
+		meta := Metadata{
+			Title:       track.Title,
+			Artist:      firstNonEmpty(track.Artist, req.AlbumArtist),
+			Album:       req.Album,
+			AlbumArtist: req.AlbumArtist,
+			Date:        req.Date,
+			Genre:       req.Genre,
+			TrackNumber: i + 1,
+			TotalTracks: len(req.Tracks),
+			ISRC:        track.ISRC,
+		}
+		if err := EmbedMetadata(path, meta, ""); err != nil {
+			return result, fmt.Errorf("track %d: failed to write tags: %w", i+1, err)
+		}
+		result = append(result, CueSplitTrack{
+			Path:       path,
+			StartMs:    int64(startSample * 1000 / rate),
+			DurationMs: int64((endSample - startSample) * 1000 / rate),
+		})
+	}
+	GoLog("[Cue] Split %s into %d tracks\n", filepath.Base(req.AudioPath), len(result))
+	return result, nil
+}
+
+func endOffset(frames []flacFrameRef, end int, audioEnd int64) int64 {
+	if end < len(frames) {
+		return frames[end].offset
+	}
+	return audioEnd
+}
+
+// writeFLACPart writes frames (ending at stop in src) as a standalone FLAC
+// numbered from zero.
+func writeFLACPart(path string, src *os.File, streamInfo []byte, pictures [][]byte, frames []flacFrameRef, stop int64, startSample, samples uint64) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(out, 1<<16)
+
+	w.WriteString("fLaC")
+	w.Write(splitStreamInfo(streamInfo, samples, len(pictures) == 0))
+	for i, picture := range pictures {
+		block := append([]byte(nil), picture...)
+		block[0] = 6
+		if i == len(pictures)-1 {
+			block[0] |= 0x80
+		}
+		w.Write(block)
+	}
+
+	var buf []byte
+	for i, frame := range frames {
+		next := stop
+		if i+1 < len(frames) {
+			next = frames[i+1].offset
+		}
+		if size := int(next - frame.offset); cap(buf) < size {
+			buf = make([]byte, size)
+		} else {
+			buf = buf[:size]
+		}
+		if _, err := src.ReadAt(buf, frame.offset); err != nil {
+			out.Close()
+			return err
+		}
+		number := uint64(i)
+		if h, _ := parseFLACFrameHeader(buf); h.variable {
+			number = frame.sample - startSample
+		}
+		renumbered, err := renumberFLACFrame(buf, number)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		if _, err := w.Write(renumbered); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,89 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testFLACAlbum writes a mono 8-bit 44.1 kHz FLAC of constant subframes in
+// 4096-sample frames.
+func testFLACAlbum(t *testing.T, path string, frames int) {
+	t.Helper()
+	testFLACSpec{SampleRate: 44100, Channels: 1, BitsPerSample: 8, BlockSize: 4096, Frames: frames}.write(t, path)
+}
+
+func TestWriteCueSheetAndSplit(t *testing.T) {
+	dir := t.TempDir()
+	album := filepath.Join(dir, "Album.flac")
+	testFLACAlbum(t, album, 200) // 18.6 s
+
+	result, err := WriteCueSheet(CueSheetRequest{
+		AudioPath:   album,
+		Album:       "The Album",
+		AlbumArtist: "The Band",
+		Date:        "1999",
+		Tracks: []CueTrack{
+			{Title: "One", DurationMs: 5000, ISRC: "USAAA9900001"},
+			{Title: `Two "Live"`, Artist: "The Band feat. Guest", DurationMs: 7500},
+			{Title: "Three", DurationMs: 6000},
+		},
+		Split:    true,
+		SplitDir: filepath.Join(dir, "tracks"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cue, _ := os.ReadFile(result.CuePath)
+	for _, want := range []string{
+		`FILE "Album.flac" WAVE`,
+		"TRACK 02 AUDIO\r\n    TITLE \"Two 'Live'\"\r\n    PERFORMER \"The Band feat. Guest\"\r\n    INDEX 01 00:05:00",
+		"ISRC USAAA9900001",
+		"INDEX 01 00:12:37",
+	} {
+		if !strings.Contains(string(cue), want) {
+			t.Errorf("CUE sheet lacks %q:\n%s", want, cue)
+		}
+	}
+
+	// 5 s = 220500 samples -> frame 54 (221184); 12.5 s = 551250 -> frame 135 (552960).
+	wantFrames := []int{54, 81, 65}
+	if len(result.Tracks) != 3 {
+		t.Fatalf("split into %d tracks", len(result.Tracks))
+	}
+	for i, track := range result.Tracks {
+		check := VerifyAudioFile(track.Path)
+		if check.Status != VerifyStatusOK || check.Frames != wantFrames[i] {
+			t.Errorf("track %d: %+v", i+1, check)
+		}
+		quality, _ := GetAudioQuality(track.Path)
+		if quality.TotalSamples != int64(wantFrames[i]*4096) {
+			t.Errorf("track %d STREAMINFO has %d samples", i+1, quality.TotalSamples)
+		}
+	}
+	meta, err := ReadMetadata(result.Tracks[1].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != `Two "Live"` || meta.Artist != "The Band feat. Guest" || meta.Album != "The Album" || meta.TrackNumber != 2 {
+		t.Errorf("unexpected tags %+v", meta)
+	}
+}
+
+func TestEncodeFLACFrameNumber(t *testing.T) {
+	for _, n := range []uint64{0, 0x7f, 0x80, 0x7ff, 0x800, 0xffff, 1 << 20, 1<<36 - 1} {
+		h, ok := parseFLACFrameHeader(func() []byte {
+			frame := append([]byte{0xFF, 0xF8, 0xC9, 0x02}, encodeFLACFrameNumber(n)...)
+			var crc uint8
+			for _, b := range frame {
+				crc = flacCRC8Table[crc^b]
+			}
+			return append(frame, crc)
+		}())
+		if !ok || h.number != n {
+			t.Errorf("%d decoded as %d (%v)", n, h.number, ok)
+		}
+	}
+}
@@ -1042,6 +1042,56 @@ func (c *DeezerClient) GetTrackISRC(ctx context.Context, trackID string) (string
 	return fullTrack.ISRC, nil
 }
 
+// SearchArtistImage returns the best image for the artist whose name matches
+// artistName (case-insensitive), falling back to the top search hit.
+func (c *DeezerClient) SearchArtistImage(ctx context.Context, artistName string) (string, error) {
+	artistName = strings.TrimSpace(artistName)
+	if artistName == "" {
+		return "", fmt.Errorf("artist name is required")
+	}
+
+	cacheKey := "deezer:artist-image:" + strings.ToLower(artistName)
+	c.cacheMu.RLock()
+	if entry, ok := c.artistCache[cacheKey]; ok && !entry.isExpired() {
+		c.cacheMu.RUnlock()
+		return entry.data.(string), nil
+	}
+	c.cacheMu.RUnlock()
+
+	artistURL := fmt.Sprintf("%s/artist?q=%s&limit=5", deezerSearchURL, url.QueryEscape(artistName))
+	var artistResp struct {
+		Data []deezerArtist `json:"data"`
+	}
+	if err := c.getJSON(ctx, artistURL, &artistResp); err != nil {
+		return "", fmt.Errorf("deezer artist search failed: %w", err)
+	}
+	if len(artistResp.Data) == 0 {
+		return "", fmt.Errorf("no artist found for %q", artistName)
+	}
+
+	best := artistResp.Data[0]
+	for _, artist := range artistResp.Data {
+		if strings.EqualFold(strings.TrimSpace(artist.Name), artistName) {
+			best = artist
+			break
+		}
+	}
+
+	imageURL := c.getBestArtistImage(best)
+	if imageURL == "" {
+		return "", fmt.Errorf("artist %q has no image", best.Name)
+	}
+
+	c.cacheMu.Lock()
+	c.artistCache[cacheKey] = &cacheEntry{
+		data:      imageURL,
+		expiresAt: time.Now().Add(deezerCacheTTL),
+	}
+	c.cacheMu.Unlock()
+
+	return imageURL, nil
+}
+
 func (c *DeezerClient) getBestArtistImage(artist deezerArtist) string {
 	if artist.PictureXL != "" {
 		return artist.PictureXL
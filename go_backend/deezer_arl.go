@@ -0,0 +1,488 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Deezer ARL session ====================
+//
+// Deezer's web player authenticates with the "arl" cookie. The ARL is
+// stored encrypted in <integrations dir>/deezer and never leaves the
+// backend: the app only sees the account summary, and extensions get the
+// session tokens through the deezer binding and reach the gateway through
+// deezer.gateway, which attaches the cookie itself. The gateway only runs
+// the read-only catalog and playback methods in deezerGatewayMethods, so an
+// extension cannot change the user's account, favorites or playlists.
+//
+// The session comes from deezer.getUserData and is fetched again once it
+// is an hour old or the license token is about to expire. A USER_ID of 0
+// means Deezer stopped accepting the ARL; the session is dropped and a
+// "deezer_session" event with state "expired" asks the user to log in
+// again.
+
+const (
+	deezerCredentialsID     = "deezer"
+	deezerSessionMaxAge     = time.Hour
+	deezerLicenseMargin     = 10 * time.Minute
+	deezerGatewayTimeout    = 20 * time.Second
+	deezerGatewayAPIVersion = "1.0"
+)
+
+// deezerGatewayMethods are the gw-light methods deezer.gateway may call.
+var deezerGatewayMethods = map[string]bool{
+	"deezer.getUserData":   true,
+	"deezer.pageAlbum":     true,
+	"deezer.pageArtist":    true,
+	"deezer.pagePlaylist":  true,
+	"deezer.pageSearch":    true,
+	"deezer.pageTrack":     true,
+	"album.getData":        true,
+	"album.getDiscography": true,
+	"artist.getData":       true,
+	"artist.getTopTrack":   true,
+	"playlist.getData":     true,
+	"playlist.getSongs":    true,
+	"search.music":         true,
+	"song.getData":         true,
+	"song.getListData":     true,
+	"song.getLyrics":       true,
+}
+
+// Overridden in tests.
+var deezerGatewayURL = "https://www.deezer.com/ajax/gw-light.php"
+
+var errDeezerSessionExpired = errors.New("Deezer ARL expired, log in again")
+
+// DeezerAccount is the part of a Deezer session the app may show.
+type DeezerAccount struct {
+	UserID            int64  `json:"user_id"`
+	UserName          string `json:"user_name"`
+	Country           string `json:"country,omitempty"`
+	Offer             string `json:"offer,omitempty"`
+	CanStreamHQ       bool   `json:"can_stream_hq"`
+	CanStreamLossless bool   `json:"can_stream_lossless"`
+	LicenseExpiresAt  int64  `json:"license_expires_at,omitempty"`
+}
+
+type DeezerSessionStatus struct {
+	LoggedIn  bool           `json:"logged_in"`
+	Expired   bool           `json:"expired"`
+	Account   *DeezerAccount `json:"account,omitempty"`
+	FetchedAt int64          `json:"fetched_at,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+type deezerSession struct {
+	account      DeezerAccount
+	apiToken     string
+	licenseToken string
+	client       *http.Client
+	fetchedAt    time.Time
+}
+
+func (s *deezerSession) fresh(now time.Time) bool {
+	if now.Sub(s.fetchedAt) >= deezerSessionMaxAge {
+		return false
+	}
+	if s.account.LicenseExpiresAt > 0 && now.Add(deezerLicenseMargin).Unix() >= s.account.LicenseExpiresAt {
+		return false
+	}
+	return true
+}
+
+// deezerGatewayError is a non-empty "error" object from the gateway.
+type deezerGatewayError struct {
+	Code    string
+	Message string
+}
+
+func (e *deezerGatewayError) Error() string {
+	return fmt.Sprintf("Deezer gateway error %s: %s", e.Code, e.Message)
+}
+
+// sessionProblem reports errors a fresh api_token may fix.
+func (e *deezerGatewayError) sessionProblem() bool {
+	return e.Code == "VALID_TOKEN_REQUIRED" || e.Code == "NEED_USER_AUTH_REQUIRED"
+}
+
+var (
+	deezerSessionMu sync.Mutex
+	deezerCurrent   *deezerSession
+	deezerExpired   bool
+	// deezerFetching is closed when the running session fetch finishes.
+	deezerFetching chan struct{}
+	// deezerGeneration changes whenever the stored ARL is set or cleared, so
+	// a fetch that started with the old one does not overwrite the new state.
+	deezerGeneration uint64
+)
+
+func deezerDir() (string, error) {
+	integrationsMu.Lock()
+	dir := integrationsDir
+	integrationsMu.Unlock()
+	if dir == "" {
+		return "", fmt.Errorf("integrations dir not set")
+	}
+	dir = filepath.Join(dir, deezerCredentialsID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func loadDeezerARL() (string, error) {
+	dir, err := deezerDir()
+	if err != nil {
+		return "", err
+	}
+	creds, err := readCredentialsFile(deezerCredentialsID, dir)
+	if err != nil {
+		return "", err
+	}
+	arl, _ := creds["arl"].(string)
+	registerLogSecret(arl)
+	return arl, nil
+}
+
+func newDeezerSessionClient(arl string) (*http.Client, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	gateway, err := url.Parse(deezerGatewayURL)
+	if err != nil {
+		return nil, err
+	}
+	jar.SetCookies(gateway, []*http.Cookie{{Name: "arl", Value: arl, Path: "/"}})
+	client := NewHTTPClientWithTimeout(deezerGatewayTimeout)
+	client.Jar = jar
+	return client, nil
+}
+
+// callDeezerGateway runs one gw-light method and returns its "results".
+func callDeezerGateway(client *http.Client, apiToken, method string, params interface{}) (json.RawMessage, error) {
+	query := url.Values{
+		"method":      {method},
+		"input":       {"3"},
+		"api_version": {deezerGatewayAPIVersion},
+		"api_token":   {apiToken},
+	}
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, deezerGatewayURL+"?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", getRandomUserAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Deezer gateway returned HTTP %d", resp.StatusCode)
+	}
+
+	var envelope struct {
+		Error   json.RawMessage `json:"error"`
+		Results json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid Deezer gateway response: %w", err)
+	}
+	// An empty error is sent as [], a real one as {"CODE": "message"}.
+	var errs map[string]interface{}
+	if json.Unmarshal(envelope.Error, &errs) == nil && len(errs) > 0 {
+		codes := make([]string, 0, len(errs))
+		for code := range errs {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		return nil, &deezerGatewayError{Code: codes[0], Message: fmt.Sprint(errs[codes[0]])}
+	}
+	return envelope.Results, nil
+}
+
+// fetchDeezerSession logs in with arl. It returns errDeezerSessionExpired
+// when Deezer answers with the anonymous user.
+func fetchDeezerSession(arl string) (*deezerSession, error) {
+	client, err := newDeezerSessionClient(arl)
+	if err != nil {
+		return nil, err
+	}
+	results, err := callDeezerGateway(client, "", "deezer.getUserData", nil)
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		CheckForm string `json:"checkForm"`
+		OfferName string `json:"OFFER_NAME"`
+		Country   string `json:"COUNTRY"`
+		User      struct {
+			UserID   int64  `json:"USER_ID"`
+			BlogName string `json:"BLOG_NAME"`
+			Options  struct {
+				LicenseToken   string `json:"license_token"`
+				LicenseCountry string `json:"license_country"`
+				ExpiresAt      int64  `json:"expiration_timestamp"`
+				WebHQ          bool   `json:"web_hq"`
+				WebLossless    bool   `json:"web_lossless"`
+			} `json:"OPTIONS"`
+		} `json:"USER"`
+	}
+	if err := json.Unmarshal(results, &data); err != nil {
+		return nil, fmt.Errorf("invalid Deezer user data: %w", err)
+	}
+	if data.User.UserID == 0 {
+		return nil, errDeezerSessionExpired
+	}
+
+	registerLogSecret(data.CheckForm)
+	registerLogSecret(data.User.Options.LicenseToken)
+	return &deezerSession{
+		account: DeezerAccount{
+			UserID:            data.User.UserID,
+			UserName:          data.User.BlogName,
+			Country:           firstNonEmpty(data.User.Options.LicenseCountry, data.Country),
+			Offer:             data.OfferName,
+			CanStreamHQ:       data.User.Options.WebHQ,
+			CanStreamLossless: data.User.Options.WebLossless,
+			LicenseExpiresAt:  data.User.Options.ExpiresAt,
+		},
+		apiToken:     data.CheckForm,
+		licenseToken: data.User.Options.LicenseToken,
+		client:       client,
+		fetchedAt:    time.Now(),
+	}, nil
+}
+
+// markDeezerExpiredLocked drops the session and tells the app once per
+// expiry. Callers hold deezerSessionMu.
+func markDeezerExpiredLocked() {
+	userName := ""
+	if deezerCurrent != nil {
+		userName = deezerCurrent.account.UserName
+	}
+	deezerCurrent = nil
+	if deezerExpired {
+		return
+	}
+	deezerExpired = true
+	GoLog("[Deezer] ARL expired, re-login required\n")
+	emitBackendEvent("deezer_session", map[string]interface{}{
+		"state":     "expired",
+		"user_name": userName,
+	})
+}
+
+// currentDeezerSession returns the cached session, fetching a new one when
+// it is stale or force is set. The ARL is loaded (which may show the unlock
+// prompt) and the session fetched without holding deezerSessionMu; callers
+// that arrive meanwhile wait for that fetch instead of starting their own.
+func currentDeezerSession(force bool) (*deezerSession, error) {
+	deezerSessionMu.Lock()
+	for {
+		if !force && deezerCurrent != nil && deezerCurrent.fresh(time.Now()) {
+			session := deezerCurrent
+			deezerSessionMu.Unlock()
+			return session, nil
+		}
+		if deezerFetching == nil {
+			break
+		}
+		wait := deezerFetching
+		deezerSessionMu.Unlock()
+		<-wait
+		deezerSessionMu.Lock()
+		force = false
+	}
+	done := make(chan struct{})
+	deezerFetching = done
+	generation := deezerGeneration
+	expired := deezerExpired
+	deezerSessionMu.Unlock()
+
+	session, err := fetchStoredDeezerSession(force, expired)
+
+	deezerSessionMu.Lock()
+	defer deezerSessionMu.Unlock()
+	deezerFetching = nil
+	close(done)
+	if generation != deezerGeneration {
+		// The ARL was replaced or cleared while this fetch ran.
+		if deezerCurrent != nil {
+			return deezerCurrent, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("Deezer login changed, try again")
+		}
+		return nil, err
+	}
+	if errors.Is(err, errDeezerSessionExpired) {
+		markDeezerExpiredLocked()
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	deezerCurrent = session
+	deezerExpired = false
+	return session, nil
+}
+
+// fetchStoredDeezerSession logs in with the stored ARL. A known expiry is
+// only retried when force is set.
+func fetchStoredDeezerSession(force, expired bool) (*deezerSession, error) {
+	arl, err := loadDeezerARL()
+	if err != nil {
+		return nil, err
+	}
+	if arl == "" {
+		return nil, fmt.Errorf("no Deezer ARL stored")
+	}
+	if expired && !force {
+		return nil, errDeezerSessionExpired
+	}
+	return fetchDeezerSession(arl)
+}
+
+// SetDeezerARL validates arl against Deezer and stores it encrypted.
+func SetDeezerARL(arl string) (*DeezerAccount, error) {
+	arl = strings.TrimSpace(arl)
+	if arl == "" {
+		return nil, fmt.Errorf("arl is required")
+	}
+	registerLogSecret(arl)
+	session, err := fetchDeezerSession(arl)
+	if errors.Is(err, errDeezerSessionExpired) {
+		return nil, fmt.Errorf("invalid or expired Deezer ARL")
+	}
+	if err != nil {
+		return nil, err
+	}
+	dir, err := deezerDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCredentialsFile(deezerCredentialsID, dir, map[string]interface{}{"arl": arl}); err != nil {
+		return nil, err
+	}
+
+	deezerSessionMu.Lock()
+	deezerCurrent = session
+	deezerExpired = false
+	deezerGeneration++
+	deezerSessionMu.Unlock()
+
+	GoLog("[Deezer] Logged in as %s\n", session.account.UserName)
+	emitBackendEvent("deezer_session", map[string]interface{}{
+		"state":     "active",
+		"user_name": session.account.UserName,
+	})
+	account := session.account
+	return &account, nil
+}
+
+// ClearDeezerARL forgets the stored ARL and the cached session.
+func ClearDeezerARL() error {
+	dir, err := deezerDir()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(credentialsFilePath(dir)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	deezerSessionMu.Lock()
+	deezerCurrent = nil
+	deezerExpired = false
+	deezerGeneration++
+	deezerSessionMu.Unlock()
+	emitBackendEvent("deezer_session", map[string]interface{}{"state": "logged_out"})
+	return nil
+}
+
+func deezerStatusFor(session *deezerSession, err error) *DeezerSessionStatus {
+	if errors.Is(err, errDeezerSessionExpired) {
+		return &DeezerSessionStatus{Expired: true, Error: err.Error()}
+	}
+	if err != nil {
+		return &DeezerSessionStatus{Error: err.Error()}
+	}
+	account := session.account
+	return &DeezerSessionStatus{LoggedIn: true, Account: &account, FetchedAt: session.fetchedAt.Unix()}
+}
+
+// GetDeezerSessionStatus reports the current session, logging in with the
+// stored ARL when there is no usable one yet. A fresh cached session or a
+// missing credentials file is answered without decrypting the ARL.
+func GetDeezerSessionStatus() *DeezerSessionStatus {
+	deezerSessionMu.Lock()
+	session := deezerCurrent
+	deezerSessionMu.Unlock()
+	if session != nil && session.fresh(time.Now()) {
+		return deezerStatusFor(session, nil)
+	}
+	dir, err := deezerDir()
+	if err != nil {
+		return &DeezerSessionStatus{Error: err.Error()}
+	}
+	if _, err := os.Stat(credentialsFilePath(dir)); os.IsNotExist(err) {
+		return &DeezerSessionStatus{}
+	}
+	return deezerStatusFor(currentDeezerSession(false))
+}
+
+// RefreshDeezerSession fetches new user data and license token, and clears
+// a previous expiry if the ARL works again.
+func RefreshDeezerSession() *DeezerSessionStatus {
+	return deezerStatusFor(currentDeezerSession(true))
+}
+
+// DeezerGatewayCall runs a gw-light method with the stored session,
+// renewing the api_token once if Deezer rejects it.
+func DeezerGatewayCall(method string, params interface{}) (json.RawMessage, error) {
+	method = strings.TrimSpace(method)
+	if method == "" {
+		return nil, fmt.Errorf("method is required")
+	}
+	if !deezerGatewayMethods[method] {
+		return nil, fmt.Errorf("Deezer gateway method %q is not allowed", method)
+	}
+	session, err := currentDeezerSession(false)
+	if err != nil {
+		return nil, err
+	}
+	results, err := callDeezerGateway(session.client, session.apiToken, method, params)
+	var gwErr *deezerGatewayError
+	if errors.As(err, &gwErr) && gwErr.sessionProblem() {
+		if session, err = currentDeezerSession(true); err != nil {
+			return nil, err
+		}
+		results, err = callDeezerGateway(session.client, session.apiToken, method, params)
+	}
+	return results, err
+}
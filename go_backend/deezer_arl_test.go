@@ -0,0 +1,192 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+func TestDeezerARLSession(t *testing.T) {
+	var mu sync.Mutex
+	validARL := "arl-valid-0123456789"
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		arl, _ := r.Cookie("arl")
+		loggedIn := arl != nil && arl.Value == validARL
+		switch r.URL.Query().Get("method") {
+		case "deezer.getUserData":
+			if !loggedIn {
+				w.Write([]byte(`{"error":[],"results":{"USER":{"USER_ID":0},"checkForm":"anon"}}`))
+				return
+			}
+			logins++
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: fmt.Sprintf("sid-%d", logins), Path: "/"})
+			fmt.Fprintf(w, `{"error":[],"results":{"checkForm":"token-%d","OFFER_NAME":"Premium","USER":{"USER_ID":42,"BLOG_NAME":"alpha","OPTIONS":{"license_token":"license-%d","license_country":"FR","web_lossless":true,"web_hq":true,"expiration_timestamp":%d}}}}`,
+				logins, logins, time.Now().Add(24*time.Hour).Unix())
+		case "song.getData":
+			sid, _ := r.Cookie("sid")
+			if sid == nil || r.URL.Query().Get("api_token") != fmt.Sprintf("token-%d", logins) || sid.Value != fmt.Sprintf("sid-%d", logins) {
+				w.Write([]byte(`{"error":{"VALID_TOKEN_REQUIRED":"Invalid CSRF token"},"results":{}}`))
+				return
+			}
+			w.Write([]byte(`{"error":[],"results":{"SNG_ID":"3135556","TRACK_TOKEN":"tt"}}`))
+		}
+	}))
+	defer server.Close()
+
+	prevURL := deezerGatewayURL
+	deezerGatewayURL = server.URL + "/ajax/gw-light.php"
+	defer func() { deezerGatewayURL = prevURL }()
+	if err := SetIntegrationsDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer ClearDeezerARL()
+
+	if status := GetDeezerSessionStatus(); status.LoggedIn || status.Expired {
+		t.Fatalf("status without ARL = %+v", status)
+	}
+	if _, err := SetDeezerARL("arl-wrong"); err == nil {
+		t.Fatal("invalid ARL accepted")
+	}
+	account, err := SetDeezerARL(validARL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.UserID != 42 || account.UserName != "alpha" || !account.CanStreamLossless || account.Country != "FR" {
+		t.Fatalf("unexpected account: %+v", account)
+	}
+
+	dir, _ := deezerDir()
+	data, err := os.ReadFile(credentialsFilePath(dir))
+	if err != nil || bytes.Contains(data, []byte(validARL)) {
+		t.Fatalf("ARL not stored encrypted: %v", err)
+	}
+
+	// Drop the cache so the stored ARL is used for the next login.
+	deezerSessionMu.Lock()
+	deezerCurrent = nil
+	deezerSessionMu.Unlock()
+
+	ext := &LoadedExtension{
+		ID:       "deezer-test",
+		Manifest: &ExtensionManifest{Name: "deezer-test", Permissions: ExtensionPermissions{Network: []string{"*.deezer.com"}}},
+		DataDir:  t.TempDir(),
+		Trust:    ExtensionTrustOfficial,
+	}
+	vm := goja.New()
+	ext.VM = vm
+	NewExtensionRuntime(ext).RegisterAPIs(vm)
+	run := func(script string) goja.Value {
+		t.Helper()
+		v, err := vm.RunString(script)
+		if err != nil {
+			t.Fatalf("%s: %v", script, err)
+		}
+		return v
+	}
+
+	if got := run(`var s = deezer.getSession(); s.success && s.licenseToken + ":" + s.userId`).String(); got != "license-2:42" {
+		t.Fatalf("getSession = %q", got)
+	}
+	if run(`deezer.getSession().arl !== undefined`).ToBoolean() {
+		t.Fatal("ARL exposed to the extension")
+	}
+	if got := run(`deezer.gateway("song.getData", {SNG_ID: "3135556"}).results.TRACK_TOKEN`).String(); got != "tt" {
+		t.Fatalf("gateway = %q", got)
+	}
+
+	if got := run(`var g = deezer.gateway("favorite_song.add", {SNG_ID: "1"}); !g.success && g.error`).String(); got == "false" || got == "" {
+		t.Fatalf("gateway ran a method outside the allowlist: %q", got)
+	}
+
+	// A stale api_token is renewed once transparently.
+	mu.Lock()
+	logins++
+	mu.Unlock()
+	if got := run(`deezer.gateway("song.getData", {}).success`).ToBoolean(); !got {
+		t.Fatal("gateway did not recover from a stale api_token")
+	}
+
+	// Unpermitted extensions are refused.
+	other := &LoadedExtension{ID: "no-deezer", Manifest: &ExtensionManifest{Name: "no-deezer"}, DataDir: t.TempDir(), Trust: ExtensionTrustOfficial}
+	otherVM := goja.New()
+	NewExtensionRuntime(other).RegisterAPIs(otherVM)
+	if v, _ := otherVM.RunString(`deezer.getSession().success`); v.ToBoolean() {
+		t.Fatal("extension without Deezer permission got the session")
+	}
+
+	// Deezer stops accepting the ARL.
+	mu.Lock()
+	validARL = "arl-rotated-0123456789"
+	mu.Unlock()
+	if got := run(`var r = deezer.refresh(); !r.success && r.expired`).ToBoolean(); !got {
+		t.Fatal("expired ARL not reported to the extension")
+	}
+	if status := GetDeezerSessionStatus(); status.LoggedIn || !status.Expired {
+		t.Fatalf("status after expiry = %+v", status)
+	}
+	if _, err := SetDeezerARL(validARL); err != nil {
+		t.Fatal(err)
+	}
+	if status := GetDeezerSessionStatus(); !status.LoggedIn || status.Expired {
+		t.Fatalf("status after re-login = %+v", status)
+	}
+}
+
+func TestDeezerARLFollowsLock(t *testing.T) {
+	loadCredentialLock(t.TempDir())
+	defer loadCredentialLock(t.TempDir())
+	defer SetCredentialUnlocker(nil)
+
+	if err := SetIntegrationsDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer ClearDeezerARL()
+	dir, _ := deezerDir()
+	if err := writeCredentialsFile(deezerCredentialsID, dir, map[string]interface{}{"arl": "arl-locked-0123456789"}); err != nil {
+		t.Fatal(err)
+	}
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{6}, credentialUnlockKeySize))
+	unlocker := &fakeUnlocker{key: key}
+	SetCredentialUnlocker(unlocker)
+	if err := EnableCredentialLock(key, 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(credentialsFilePath(dir)); !isLockedCredentials(data) {
+		t.Fatal("ARL was not sealed under the lock")
+	}
+	if arl, err := loadDeezerARL(); err != nil || arl != "arl-locked-0123456789" {
+		t.Fatalf("ARL unreadable while locked: %q %v", arl, err)
+	}
+
+	// A fresh session is reported without asking for the key again.
+	LockCredentials()
+	unlocker.calls = 0
+	deezerSessionMu.Lock()
+	deezerCurrent = &deezerSession{account: DeezerAccount{UserID: 7, UserName: "cached"}, fetchedAt: time.Now()}
+	deezerSessionMu.Unlock()
+	if status := GetDeezerSessionStatus(); !status.LoggedIn || status.Account.UserName != "cached" {
+		t.Fatalf("status = %+v", status)
+	}
+	if unlocker.calls != 0 {
+		t.Errorf("status prompted for the key %d times", unlocker.calls)
+	}
+
+	if err := DisableCredentialLock(); err != nil {
+		t.Fatal(err)
+	}
+	if arl, err := loadDeezerARL(); err != nil || arl != "arl-locked-0123456789" {
+		t.Fatalf("ARL unreadable after unlocking: %q %v", arl, err)
+	}
+}
@@ -0,0 +1,260 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ==================== Downconversion ====================
+//
+// Plenty of phones, car head units and older DAPs refuse 24-bit/192 kHz
+// FLAC. BackendConfig.Downconvert.Target caps what a download is delivered
+// as:
+//
+//	off      files are kept as the provider sent them
+//	16/44.1  CD format, TPDF-dithered down to 16 bits
+//	24/48    keeps 24 bits, caps the sample rate at 48 kHz
+//
+// FFmpeg does the work with the SoX resampler at its highest precision. The
+// new frames are spliced behind the original tags and artwork, so nothing
+// but the format changes, and the response's actual_bit_depth and
+// actual_sample_rate report the delivered format. With keep_original the
+// source file is moved to originals_dir (default: a hidden .originals folder
+// next to the track, which media scanners skip).
+
+const (
+	DownconvertOff  = "off"
+	Downconvert1644 = "16/44.1"
+	Downconvert2448 = "24/48"
+
+	downconvertOriginalsDir = ".originals"
+	downconvertTimeout      = 10 * time.Minute
+)
+
+type downconvertTarget struct {
+	bitDepth   int
+	sampleRate int
+}
+
+var downconvertTargets = map[string]downconvertTarget{
+	Downconvert1644: {16, 44100},
+	Downconvert2448: {24, 48000},
+}
+
+// DownconvertConfig lives in BackendConfig under downconvert.
+type DownconvertConfig struct {
+	Target       string `json:"target"`
+	KeepOriginal bool   `json:"keep_original"`
+	OriginalsDir string `json:"originals_dir,omitempty"`
+}
+
+func defaultDownconvertConfig() DownconvertConfig {
+	return DownconvertConfig{Target: DownconvertOff}
+}
+
+func (c *DownconvertConfig) validate() error {
+	c.Target = strings.TrimSpace(c.Target)
+	if c.Target == "" {
+		c.Target = DownconvertOff
+	}
+	if _, ok := downconvertTargets[c.Target]; !ok && c.Target != DownconvertOff {
+		return fmt.Errorf("unsupported downconvert.target: %s", c.Target)
+	}
+	c.OriginalsDir = strings.TrimSpace(c.OriginalsDir)
+	return nil
+}
+
+// DownconvertResult reports the format before and after conversion.
+type DownconvertResult struct {
+	Path           string `json:"path"`
+	FromBitDepth   int    `json:"from_bit_depth"`
+	FromSampleRate int    `json:"from_sample_rate"`
+	BitDepth       int    `json:"bit_depth"`
+	SampleRate     int    `json:"sample_rate"`
+	OriginalPath   string `json:"original_path,omitempty"`
+	Skipped        bool   `json:"skipped,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+func buildDownconvertCommand(inputPath, outputPath string, bitDepth, sampleRate int, resample bool) string {
+	filter := "aresample=resampler=soxr:precision=28"
+	if resample {
+		filter += fmt.Sprintf(":out_sample_rate=%d", sampleRate)
+	}
+	sampleFormat := []string{"-sample_fmt", "s32", "-bits_per_raw_sample", "24"}
+	if bitDepth <= 16 {
+		filter += ":out_sample_fmt=s16:dither_method=triangular_hp"
+		sampleFormat = []string{"-sample_fmt", "s16"}
+	} else {
+		filter += ":out_sample_fmt=s32"
+	}
+	parts := []string{
+		"-y", "-i", fmt.Sprintf("%q", inputPath),
+		"-map", "0:a:0", "-map_metadata", "-1",
+		"-af", filter,
+		"-c:a", "flac", "-compression_level", "8",
+	}
+	parts = append(parts, sampleFormat...)
+	return strings.Join(append(parts, fmt.Sprintf("%q", outputPath)), " ")
+}
+
+// originalsPath is where a kept original of path goes. A custom originals
+// dir mirrors the path below the download dir (or the whole path outside
+// it), so same-named tracks of different albums never overwrite each other.
+func originalsPath(path, originalsDir string) string {
+	if originalsDir == "" {
+		return filepath.Join(filepath.Dir(path), downconvertOriginalsDir, filepath.Base(path))
+	}
+	if base := getDownloadDir(); base != "" && isPathWithinBase(base, path) {
+		if rel, err := filepath.Rel(base, path); err == nil {
+			return filepath.Join(originalsDir, rel)
+		}
+	}
+	rel := strings.TrimPrefix(path, filepath.VolumeName(path))
+	return filepath.Join(originalsDir, strings.TrimLeft(rel, `/\`))
+}
+
+// DownconvertFLAC converts path in place to at most the target's bit depth
+// and sample rate. A file already within the target is reported as skipped.
+func DownconvertFLAC(path string, cfg DownconvertConfig) (*DownconvertResult, error) {
+	target, ok := downconvertTargets[cfg.Target]
+	if !ok {
+		return nil, fmt.Errorf("unsupported downconvert target: %s", cfg.Target)
+	}
+	quality, err := GetAudioQuality(path)
+	if err != nil {
+		return nil, err
+	}
+	result := &DownconvertResult{
+		Path:           path,
+		FromBitDepth:   quality.BitDepth,
+		FromSampleRate: quality.SampleRate,
+		BitDepth:       min(quality.BitDepth, target.bitDepth),
+		SampleRate:     min(quality.SampleRate, target.sampleRate),
+	}
+	if quality.BitDepth <= target.bitDepth && quality.SampleRate <= target.sampleRate {
+		result.Skipped = true
+		return result, nil
+	}
+
+	convertedPath := path + ".downconvert.flac"
+	defer os.Remove(convertedPath)
+	command := buildDownconvertCommand(path, convertedPath, result.BitDepth, result.SampleRate, result.SampleRate != quality.SampleRate)
+	cmd, err := runQueuedFFmpeg("downconvert", command, path, convertedPath, downconvertTimeout)
+	if err == nil && !cmd.Success {
+		err = fmt.Errorf("%s", firstNonEmpty(cmd.Error, "FFmpeg conversion failed"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	converted, convertedBlocks, _, err := openFLACAudio(convertedPath)
+	if err != nil {
+		return nil, fmt.Errorf("converted file: %w", err)
+	}
+	defer converted.Close()
+	rate, _, bps, samples := parseStreamInfoFormat(convertedBlocks[0])
+	if rate != result.SampleRate || bps != result.BitDepth {
+		return nil, fmt.Errorf("converted file is %d-bit/%d Hz, want %d-bit/%d Hz", bps, rate, result.BitDepth, result.SampleRate)
+	}
+	// Resampling may add or drop a few samples at the edges; anything more
+	// means FFmpeg stopped early.
+	want := uint64(quality.TotalSamples) * uint64(rate) / uint64(quality.SampleRate)
+	if quality.TotalSamples > 0 && (samples+uint64(rate)/10 < want) {
+		return nil, fmt.Errorf("converted file has %d samples, want about %d", samples, want)
+	}
+
+	src, blocks, _, err := openFLACAudio(path)
+	if err != nil {
+		return nil, err
+	}
+	kept, _ := keptFLACBlocks(blocks, true)
+	src.Close()
+
+	tmpPath := path + ".downconvert.tmp"
+	if _, err := writeFLACFile(tmpPath, convertedBlocks[0], kept, converted); err != nil {
+		return nil, err
+	}
+	if stat, err := os.Stat(path); err == nil {
+		os.Chmod(tmpPath, stat.Mode().Perm())
+	}
+
+	if cfg.KeepOriginal {
+		result.OriginalPath = originalsPath(path, cfg.OriginalsDir)
+		if err := os.MkdirAll(filepath.Dir(result.OriginalPath), 0755); err != nil {
+			os.Remove(tmpPath)
+			return nil, fmt.Errorf("failed to create originals dir: %w", err)
+		}
+		if err := os.Rename(path, result.OriginalPath); err != nil {
+			os.Remove(tmpPath)
+			return nil, fmt.Errorf("failed to keep original: %w", err)
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		if cfg.KeepOriginal {
+			os.Rename(result.OriginalPath, path)
+		}
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to replace file: %w", err)
+	}
+	return result, nil
+}
+
+// DownconvertFLACFiles runs DownconvertFLAC over paths, recording failures
+// per file instead of stopping.
+func DownconvertFLACFiles(paths []string, cfg DownconvertConfig) []DownconvertResult {
+	results := make([]DownconvertResult, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		result, err := DownconvertFLAC(path, cfg)
+		if err != nil {
+			GoLog("[Downconvert] %s: %v\n", filepath.Base(path), err)
+			result = &DownconvertResult{Path: path, Error: err.Error()}
+		}
+		results = append(results, *result)
+	}
+	return results
+}
+
+// downconvertCompletedDownload applies the configured target to a
+// successful FLAC path output and updates the reported format. A failed
+// conversion leaves the original in place.
+func downconvertCompletedDownload(req DownloadRequest, respJSON string) string {
+	cfg := GetBackendConfig().Downconvert
+	if cfg.Target == DownconvertOff || isFDOutput(req.OutputFD) {
+		return respJSON
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success || resp.AlreadyExists {
+		return respJSON
+	}
+	path := strings.TrimSpace(resp.FilePath)
+	if !strings.EqualFold(filepath.Ext(path), ".flac") || strings.HasPrefix(path, "content://") {
+		return respJSON
+	}
+	if req.ItemID != "" {
+		SetItemFinalizing(req.ItemID)
+	}
+	result, err := DownconvertFLAC(path, cfg)
+	if err != nil {
+		GoLog("[Downconvert] %s: %v\n", filepath.Base(path), err)
+		return respJSON
+	}
+	if result.Skipped {
+		return respJSON
+	}
+	GoLog("[Downconvert] %s: %d-bit/%d Hz -> %d-bit/%d Hz\n", filepath.Base(path),
+		result.FromBitDepth, result.FromSampleRate, result.BitDepth, result.SampleRate)
+	resp.ActualBitDepth = result.BitDepth
+	resp.ActualSampleRate = result.SampleRate
+	resp.Downconverted = result
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return respJSON
+	}
+	return string(jsonBytes)
+}
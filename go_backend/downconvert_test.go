@@ -0,0 +1,114 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownconvertFLAC(t *testing.T) {
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+
+	dir := t.TempDir()
+	tone := testSine(0, 4096, 1000, 8000)
+	frames := []testFLACFrame{
+		{1, tone, tone, [2]string{"verbatim", "verbatim"}},
+		{1, tone, tone, [2]string{"verbatim", "verbatim"}},
+	}
+	encodedPath := filepath.Join(dir, "encoded.flac")
+	testFLACStream(t, encodedPath, frames)
+	encoded, _ := os.ReadFile(encodedPath)
+
+	var commands []string
+	fakeFFmpegWorker(t, func(cmd *FFmpegCommand) {
+		commands = append(commands, cmd.Command)
+		cmd.Success = os.WriteFile(cmd.OutputPath, encoded, 0644) == nil
+	})
+
+	// The source claims 24-bit/88.2 kHz with twice the samples; the frames
+	// are never decoded.
+	path := filepath.Join(dir, "track.flac")
+	testFLACStream(t, path, frames)
+	bloatFLAC(t, path, make([]byte, 16))
+	data, _ := os.ReadFile(path)
+	binary.BigEndian.PutUint64(data[8+10:], uint64(88200)<<44|uint64(1)<<41|uint64(23)<<36|uint64(4*4096))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetBackendConfigJSON(`{"downconvert": {"target": "16/44.1", "keep_original": true}}`); err != nil {
+		t.Fatal(err)
+	}
+	respJSON := `{"success":true,"message":"ok","file_path":"` + path + `","actual_bit_depth":24,"actual_sample_rate":88200}`
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(downconvertCompletedDownload(DownloadRequest{}, respJSON)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ActualBitDepth != 16 || resp.ActualSampleRate != 44100 || resp.Downconverted == nil {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if len(commands) != 1 || !strings.Contains(commands[0], "out_sample_rate=44100:out_sample_fmt=s16:dither_method=triangular_hp") {
+		t.Errorf("commands = %q", commands)
+	}
+
+	kept := filepath.Join(dir, ".originals", "track.flac")
+	if resp.Downconverted.OriginalPath != kept {
+		t.Errorf("original kept at %q", resp.Downconverted.OriginalPath)
+	}
+	if got, _ := os.ReadFile(kept); !bytes.Equal(got, data) {
+		t.Error("kept original differs from the source")
+	}
+	quality, err := GetAudioQuality(path)
+	if err != nil || quality.BitDepth != 16 || quality.SampleRate != 44100 {
+		t.Fatalf("converted quality = %+v, %v", quality, err)
+	}
+	if types := flacBlockTypes(t, path); !bytes.Equal(types, []byte{0x00, 0x04, 0x81}) {
+		t.Errorf("block types = % x", types)
+	}
+
+	// Already within the target: nothing runs and the response is untouched.
+	converted := `{"success":true,"message":"ok","file_path":"` + path + `"}`
+	if got := downconvertCompletedDownload(DownloadRequest{}, converted); got != converted || len(commands) != 1 {
+		t.Errorf("second pass changed the response: %s", got)
+	}
+}
+
+func TestDownconvertConfigValidate(t *testing.T) {
+	cfg := DownconvertConfig{Target: " 24/48 "}
+	if err := cfg.validate(); err != nil || cfg.Target != Downconvert2448 {
+		t.Fatalf("validate = %v, %q", err, cfg.Target)
+	}
+	cfg = DownconvertConfig{}
+	if err := cfg.validate(); err != nil || cfg.Target != DownconvertOff {
+		t.Fatalf("empty target = %v, %q", err, cfg.Target)
+	}
+	cfg = DownconvertConfig{Target: "8/22"}
+	if err := cfg.validate(); err == nil {
+		t.Fatal("expected an error for an unknown target")
+	}
+}
+
+func TestOriginalsPathMirrorsDownloadDir(t *testing.T) {
+	prev := getDownloadDir()
+	defer setDownloadDir(prev)
+	root := t.TempDir()
+	setDownloadDir(root)
+	originals := filepath.Join(t.TempDir(), "originals")
+
+	a := originalsPath(filepath.Join(root, "Artist", "Album A", "01 Intro.flac"), originals)
+	b := originalsPath(filepath.Join(root, "Artist", "Album B", "01 Intro.flac"), originals)
+	if a == b {
+		t.Fatalf("same-named tracks share %q", a)
+	}
+	if want := filepath.Join(originals, "Artist", "Album A", "01 Intro.flac"); a != want {
+		t.Errorf("originalsPath = %q, want %q", a, want)
+	}
+	if got := originalsPath(filepath.Join(root, "x.flac"), ""); got != filepath.Join(root, ".originals", "x.flac") {
+		t.Errorf("default originalsPath = %q", got)
+	}
+}
@@ -0,0 +1,172 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Download batches ====================
+//
+// The download queue lives in Flutter, so the backend only learns what
+// belongs together through DownloadRequest.BatchID. Every finished download
+// with a batch ID is recorded here; when Flutter's queue drains it calls
+// FinishDownloadBatch, which runs the post-batch integrations (a Subsonic
+// library scan, ListenBrainz submission) and returns the summary. The summary is also emitted as a
+// "batch" event.
+
+const maxBatchTracks = 1000
+
+// BatchTrack is one download of a batch.
+type BatchTrack struct {
+	ItemID        string `json:"item_id,omitempty"`
+	Title         string `json:"title,omitempty"`
+	Artist        string `json:"artist,omitempty"`
+	Album         string `json:"album,omitempty"`
+	FilePath      string `json:"file_path,omitempty"`
+	AlreadyExists bool   `json:"already_exists,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// IntegrationStatus reports what a post-batch integration did.
+type IntegrationStatus struct {
+	Name          string   `json:"name"`
+	Status        string   `json:"status"`
+	ScanStarted   bool     `json:"scan_started,omitempty"`
+	ScanCompleted bool     `json:"scan_completed,omitempty"`
+	Verified      int      `json:"verified,omitempty"`
+	Submitted     int      `json:"submitted,omitempty"`
+	Missing       []string `json:"missing,omitempty"`
+	Error         string   `json:"error,omitempty"`
+}
+
+const (
+	IntegrationOK      = "ok"
+	IntegrationPartial = "partial"
+	IntegrationFailed  = "failed"
+)
+
+type BatchSummary struct {
+	BatchID      string              `json:"batch_id"`
+	Completed    int                 `json:"completed"`
+	Existing     int                 `json:"existing"`
+	Failed       int                 `json:"failed"`
+	Message      string              `json:"message,omitempty"`
+	Tracks       []BatchTrack        `json:"tracks"`
+	StartedAt    int64               `json:"started_at,omitempty"`
+	FinishedAt   int64               `json:"finished_at"`
+	Integrations []IntegrationStatus `json:"integrations,omitempty"`
+}
+
+type downloadBatch struct {
+	tracks    []BatchTrack
+	startedAt time.Time
+}
+
+var (
+	downloadBatchesMu sync.Mutex
+	downloadBatches   = make(map[string]*downloadBatch)
+)
+
+// recordBatchDownload adds a finished download to its batch. Cancelled
+// items are left out; Flutter removed them from the queue.
+func recordBatchDownload(req DownloadRequest, respJSON string) {
+	batchID := strings.TrimSpace(req.BatchID)
+	if batchID == "" {
+		return
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success && resp.ErrorType == "cancelled" {
+		return
+	}
+	track := BatchTrack{
+		ItemID: req.ItemID,
+		Title:  firstNonEmpty(resp.Title, req.TrackName),
+		Artist: firstNonEmpty(resp.Artist, req.ArtistName),
+		Album:  firstNonEmpty(resp.Album, req.AlbumName),
+	}
+	if resp.Success {
+		track.FilePath = strings.TrimPrefix(resp.FilePath, "EXISTS:")
+		track.AlreadyExists = resp.AlreadyExists || strings.HasPrefix(resp.FilePath, "EXISTS:")
+	} else {
+		track.Error = firstNonEmpty(resp.Error, "download failed")
+	}
+
+	downloadBatchesMu.Lock()
+	defer downloadBatchesMu.Unlock()
+	batch := downloadBatches[batchID]
+	if batch == nil {
+		batch = &downloadBatch{startedAt: time.Now()}
+		downloadBatches[batchID] = batch
+	}
+	// A retried item replaces its earlier result.
+	for i := range batch.tracks {
+		if req.ItemID != "" && batch.tracks[i].ItemID == req.ItemID {
+			batch.tracks[i] = track
+			return
+		}
+	}
+	if len(batch.tracks) < maxBatchTracks {
+		batch.tracks = append(batch.tracks, track)
+	}
+}
+
+// FinishDownloadBatch closes batchID, runs the post-batch integrations and
+// returns its summary. Finishing an unknown batch returns an empty summary
+// so Flutter can call it unconditionally when its queue drains.
+func FinishDownloadBatch(batchID string) (*BatchSummary, error) {
+	batchID = strings.TrimSpace(batchID)
+	if batchID == "" {
+		return nil, fmt.Errorf("batch_id is required")
+	}
+	downloadBatchesMu.Lock()
+	batch := downloadBatches[batchID]
+	delete(downloadBatches, batchID)
+	downloadBatchesMu.Unlock()
+
+	summary := &BatchSummary{BatchID: batchID, Tracks: []BatchTrack{}, FinishedAt: time.Now().Unix()}
+	if batch == nil {
+		return summary, nil
+	}
+	summary.Tracks = batch.tracks
+	summary.StartedAt = batch.startedAt.Unix()
+	for _, track := range batch.tracks {
+		switch {
+		case track.Error != "":
+			summary.Failed++
+		case track.AlreadyExists:
+			summary.Existing++
+		default:
+			summary.Completed++
+		}
+	}
+	summary.Message = Localize("status.tracks_downloaded", map[string]interface{}{"count": summary.Completed})
+	if summary.Failed > 0 {
+		summary.Message += ", " + Localize("status.tracks_failed", map[string]interface{}{"count": summary.Failed})
+	}
+
+	if status := runSubsonicIntegration(summary); status != nil {
+		summary.Integrations = append(summary.Integrations, *status)
+	}
+	if status := runListenBrainzIntegration(summary); status != nil {
+		summary.Integrations = append(summary.Integrations, *status)
+	}
+
+	GoLog("[Batch] %s finished: %d completed, %d existing, %d failed\n", batchID, summary.Completed, summary.Existing, summary.Failed)
+	emitBackendEvent("batch", summary)
+	return summary, nil
+}
+
+func FinishDownloadBatchJSON(batchID string) (string, error) {
+	summary, err := FinishDownloadBatch(batchID)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(summary)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,178 @@
+package gobackend
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFinishDownloadBatchSummary(t *testing.T) {
+	record := func(itemID, respJSON string) {
+		recordBatchDownload(DownloadRequest{BatchID: "batch-1", ItemID: itemID, TrackName: itemID}, respJSON)
+	}
+	record("a", `{"success":true,"file_path":"/m/a.flac"}`)
+	record("b", `{"success":false,"error":"not found"}`)
+	record("c", `{"success":true,"file_path":"EXISTS:/m/c.flac"}`)
+	record("d", `{"success":false,"error_type":"cancelled"}`)
+	// b is retried and succeeds.
+	record("b", `{"success":true,"file_path":"/m/b.flac"}`)
+	recordBatchDownload(DownloadRequest{ItemID: "no-batch"}, `{"success":true}`)
+
+	summary, err := FinishDownloadBatch("batch-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Completed != 2 || summary.Existing != 1 || summary.Failed != 0 || len(summary.Tracks) != 3 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if summary.Tracks[2].FilePath != "/m/c.flac" || !summary.Tracks[2].AlreadyExists {
+		t.Errorf("existing track = %+v", summary.Tracks[2])
+	}
+	if summary.Message != "2 tracks downloaded" {
+		t.Errorf("message = %q", summary.Message)
+	}
+
+	again, _ := FinishDownloadBatch("batch-1")
+	if len(again.Tracks) != 0 {
+		t.Errorf("finished batch should be forgotten, got %+v", again)
+	}
+}
+
+func TestSubsonicIntegrationScansAndVerifies(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	scanPolls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		q := r.URL.Query()
+		token := md5.Sum([]byte("hunter2" + q.Get("s")))
+		if q.Get("u") != "me" || q.Get("t") != hex.EncodeToString(token[:]) {
+			fmt.Fprint(w, `{"subsonic-response":{"status":"failed","error":{"code":40,"message":"Wrong username or password"}}}`)
+			return
+		}
+		method := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/rest/"), ".view")
+		calls = append(calls, method)
+		switch method {
+		case "startScan":
+			fmt.Fprint(w, `{"subsonic-response":{"status":"ok","scanStatus":{"scanning":true}}}`)
+		case "getScanStatus":
+			scanPolls++
+			fmt.Fprintf(w, `{"subsonic-response":{"status":"ok","scanStatus":{"scanning":%v}}}`, scanPolls < 2)
+		case "search3":
+			songs := ""
+			if q.Get("query") == "Found" {
+				songs = `{"title":"found","artist":"Alpha & Beta"}`
+			}
+			fmt.Fprintf(w, `{"subsonic-response":{"status":"ok","searchResult3":{"song":[%s]}}}`, songs)
+		}
+	}))
+	defer server.Close()
+
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+	prevPoll := subsonicPollInterval
+	subsonicPollInterval = time.Millisecond
+	defer func() { subsonicPollInterval = prevPoll }()
+
+	if err := SetIntegrationsDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSubsonicPassword("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	cfg := original
+	cfg.Subsonic = SubsonicConfig{Enabled: true, ServerURL: server.URL + "/", Username: "me", Verify: true, ScanTimeoutSeconds: 5}
+	if err := UpdateBackendConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	status := runSubsonicIntegration(&BatchSummary{Completed: 2, Tracks: []BatchTrack{
+		{Title: "Found", Artist: "Alpha"},
+		{Title: "Lost", Artist: "Gamma"},
+		{Title: "Old", AlreadyExists: true},
+	}})
+	if status == nil || status.Status != IntegrationPartial || !status.ScanStarted || !status.ScanCompleted ||
+		status.Verified != 1 || strings.Join(status.Missing, ",") != "Gamma - Lost" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	mu.Lock()
+	got := strings.Join(calls, ",")
+	mu.Unlock()
+	if got != "startScan,getScanStatus,getScanStatus,search3,search3" {
+		t.Errorf("calls = %s", got)
+	}
+
+	if err := SetSubsonicPassword("wrong"); err != nil {
+		t.Fatal(err)
+	}
+	status = runSubsonicIntegration(&BatchSummary{Completed: 1})
+	if status.Status != IntegrationFailed || !strings.Contains(status.Error, "Wrong username") {
+		t.Fatalf("expected auth failure, got %+v", status)
+	}
+	if runSubsonicIntegration(&BatchSummary{Existing: 3}) != nil {
+		t.Error("a batch without new tracks should not trigger a scan")
+	}
+}
+
+func TestSubsonicWaitForScanIgnoresIdleBeforeStart(t *testing.T) {
+	// The server reports idle until the scan it was asked for begins.
+	statuses := []bool{false, false, true, true, false}
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scanning := statuses[min(polls, len(statuses)-1)]
+		polls++
+		fmt.Fprintf(w, `{"subsonic-response":{"status":"ok","scanStatus":{"scanning":%v}}}`, scanning)
+	}))
+	defer server.Close()
+
+	prevPoll, prevGrace := subsonicPollInterval, subsonicScanStartGrace
+	subsonicPollInterval, subsonicScanStartGrace = time.Millisecond, time.Minute
+	defer func() { subsonicPollInterval, subsonicScanStartGrace = prevPoll, prevGrace }()
+
+	client := &subsonicClient{cfg: SubsonicConfig{ServerURL: server.URL, Username: "me"}, client: server.Client()}
+	done, err := client.waitForScan(nil, 5*time.Second)
+	if err != nil || !done {
+		t.Fatalf("waitForScan = %v, %v", done, err)
+	}
+	if polls != len(statuses) {
+		t.Errorf("finished after %d polls, want %d", polls, len(statuses))
+	}
+}
+
+func TestSubsonicPasswordFollowsLock(t *testing.T) {
+	loadCredentialLock(t.TempDir())
+	defer loadCredentialLock(t.TempDir())
+	defer SetCredentialUnlocker(nil)
+
+	if err := SetIntegrationsDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSubsonicPassword("hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, credentialUnlockKeySize))
+	SetCredentialUnlocker(&fakeUnlocker{key: key})
+	if err := EnableCredentialLock(key, 0); err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := subsonicCredentialsDir()
+	if data, _ := os.ReadFile(credentialsFilePath(dir)); !isLockedCredentials(data) {
+		t.Fatal("subsonic password was not sealed under the lock")
+	}
+	if err := DisableCredentialLock(); err != nil {
+		t.Fatal(err)
+	}
+	if password, err := loadSubsonicPassword(); err != nil || password != "hunter2" {
+		t.Fatalf("password unreadable after unlocking: %q %v", password, err)
+	}
+}
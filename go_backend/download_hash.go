@@ -0,0 +1,182 @@
+package gobackend
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Download hashing ====================
+//
+// MD5 and SHA-256 are computed while the provider stream is written to the
+// output, so multi-hundred-MB hi-res files are not read a second time. When
+// the write finishes the provider seals the hasher with the file's size and
+// modification time. The finalize step reuses the streamed hashes when the
+// finished file still matches that snapshot, and re-reads it only when a
+// later step (tag embedding, downconvert, optimizeFLAC) rewrote it. SAF
+// outputs are read back through their descriptor; when the provider refuses
+// reads no hashes are attached. The hashes are kept in the history record and
+// sent with the completion event for dedupe and integrity checks.
+
+// DownloadHashes is what gets attached to a finished download.
+type DownloadHashes struct {
+	MD5    string `json:"md5"`
+	SHA256 string `json:"sha256"`
+	Bytes  int64  `json:"bytes"`
+}
+
+type downloadHasher struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+	bytes  int64
+
+	// Set by sealDownloadHash once the output is complete.
+	sealed  bool
+	path    string
+	modTime time.Time
+}
+
+func newDownloadHasher() *downloadHasher {
+	return &downloadHasher{md5: md5.New(), sha256: sha256.New()}
+}
+
+func (h *downloadHasher) Write(p []byte) (int, error) {
+	h.md5.Write(p)
+	h.sha256.Write(p)
+	h.bytes += int64(len(p))
+	return len(p), nil
+}
+
+func (h *downloadHasher) Sum() DownloadHashes {
+	return DownloadHashes{
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+		Bytes:  h.bytes,
+	}
+}
+
+var (
+	downloadHashersMu sync.Mutex
+	downloadHashers   = make(map[string]*downloadHasher)
+)
+
+// hashedOutput tees what is written to w into a fresh hasher for itemID,
+// replacing one left by an earlier attempt or provider.
+func hashedOutput(w io.Writer, itemID string) io.Writer {
+	if itemID == "" {
+		return w
+	}
+	h := newDownloadHasher()
+	downloadHashersMu.Lock()
+	downloadHashers[itemID] = h
+	downloadHashersMu.Unlock()
+	return io.MultiWriter(w, h)
+}
+
+// sealDownloadHash records the state of a completed output so the finalize
+// step can tell whether it was rewritten since. A hasher whose byte count
+// does not match the file is dropped.
+func sealDownloadHash(itemID, outputPath string, outputFD int) {
+	if itemID == "" {
+		return
+	}
+	downloadHashersMu.Lock()
+	defer downloadHashersMu.Unlock()
+	h, ok := downloadHashers[itemID]
+	if !ok {
+		return
+	}
+	path, err := readableOutputPath(DownloadRequest{OutputFD: outputFD}, strings.TrimSpace(outputPath))
+	if err != nil {
+		delete(downloadHashers, itemID)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != h.bytes {
+		delete(downloadHashers, itemID)
+		return
+	}
+	h.sealed, h.path, h.modTime = true, path, info.ModTime()
+}
+
+// forgetDownloadHash drops an item's hasher once its download has finished,
+// successfully or not.
+func forgetDownloadHash(itemID string) {
+	downloadHashersMu.Lock()
+	delete(downloadHashers, itemID)
+	downloadHashersMu.Unlock()
+}
+
+// streamedDownloadHashes returns the hashes recorded while writing the output
+// of req, provided the file at path is still the one that was written.
+func streamedDownloadHashes(req DownloadRequest, path string) (DownloadHashes, bool) {
+	downloadHashersMu.Lock()
+	h, ok := downloadHashers[req.ItemID]
+	delete(downloadHashers, req.ItemID)
+	downloadHashersMu.Unlock()
+	if !ok || !h.sealed {
+		return DownloadHashes{}, false
+	}
+	path, err := readableOutputPath(req, path)
+	if err != nil || path != h.path {
+		return DownloadHashes{}, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != h.bytes || !info.ModTime().Equal(h.modTime) {
+		return DownloadHashes{}, false
+	}
+	return h.Sum(), true
+}
+
+// hashDownloadedFile hashes the finished output of req at path.
+func hashDownloadedFile(req DownloadRequest, path string) (DownloadHashes, error) {
+	path, err := readableOutputPath(req, path)
+	if err != nil {
+		return DownloadHashes{}, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return DownloadHashes{}, err
+	}
+	defer file.Close()
+
+	h := newDownloadHasher()
+	if _, err := io.Copy(h, file); err != nil {
+		return DownloadHashes{}, err
+	}
+	return h.Sum(), nil
+}
+
+// attachDownloadHashes adds the hashes of the finished file to a successful
+// response. It runs after every step that rewrites the output.
+func attachDownloadHashes(req DownloadRequest, respJSON string) string {
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success || resp.AlreadyExists {
+		forgetDownloadHash(req.ItemID)
+		return respJSON
+	}
+	path := strings.TrimSpace(resp.FilePath)
+	hashes, ok := streamedDownloadHashes(req, path)
+	if !ok {
+		var err error
+		if hashes, err = hashDownloadedFile(req, path); err != nil {
+			GoLog("[Hash] Skipping hashes for %s: %v\n", filepath.Base(resp.FilePath), err)
+			return respJSON
+		}
+	}
+	resp.MD5 = hashes.MD5
+	resp.SHA256 = hashes.SHA256
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return respJSON
+	}
+	return string(jsonBytes)
+}
@@ -0,0 +1,83 @@
+package gobackend
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttachDownloadHashesHashesFinishedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.flac")
+	payload := []byte(strings.Repeat("flac-frame", 4096))
+	if err := os.WriteFile(path, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	respJSON := attachDownloadHashes(DownloadRequest{}, `{"success":true,"file_path":"`+path+`"}`)
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil {
+		t.Fatal(err)
+	}
+	md5Sum := md5.Sum(payload)
+	shaSum := sha256.Sum256(payload)
+	if resp.MD5 != hex.EncodeToString(md5Sum[:]) || resp.SHA256 != hex.EncodeToString(shaSum[:]) {
+		t.Fatalf("unexpected hashes md5=%s sha256=%s", resp.MD5, resp.SHA256)
+	}
+}
+
+func TestAttachDownloadHashesSkipsFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "partial.flac")
+	os.WriteFile(path, []byte("partial"), 0644)
+
+	failed := `{"success":false,"error":"interrupted","file_path":"` + path + `"}`
+	if got := attachDownloadHashes(DownloadRequest{}, failed); got != failed {
+		t.Fatalf("failed response must pass through, got %s", got)
+	}
+	missing := `{"success":true,"file_path":"content://media/1"}`
+	if got := attachDownloadHashes(DownloadRequest{}, missing); got != missing {
+		t.Fatalf("unreadable output must pass through, got %s", got)
+	}
+}
+
+func TestAttachDownloadHashesUsesStreamedHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.flac")
+	streamed := []byte(strings.Repeat("A", 4096))
+	onDisk := []byte(strings.Repeat("B", 4096))
+	hashOf := func(data []byte) string {
+		sum := md5.Sum(data)
+		return hex.EncodeToString(sum[:])
+	}
+	attach := func() string {
+		var resp DownloadResponse
+		json.Unmarshal([]byte(attachDownloadHashes(DownloadRequest{ItemID: "hash-1"}, `{"success":true,"file_path":"`+path+`"}`)), &resp)
+		return resp.MD5
+	}
+
+	// A sealed output that was not touched since is not read again: the
+	// streamed bytes differ from the file here only to prove that.
+	hashedOutput(io.Discard, "hash-1").Write(streamed)
+	if err := os.WriteFile(path, onDisk, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sealDownloadHash("hash-1", path, 0)
+	if got := attach(); got != hashOf(streamed) {
+		t.Errorf("md5 = %s, want the streamed hash", got)
+	}
+
+	// A later rewrite makes the finalize step hash the file itself.
+	hashedOutput(io.Discard, "hash-1").Write(streamed)
+	sealDownloadHash("hash-1", path, 0)
+	rewritten := append(onDisk, "tags"...)
+	if err := os.WriteFile(path, rewritten, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := attach(); got != hashOf(rewritten) {
+		t.Errorf("md5 = %s, want the hash of the rewritten file", got)
+	}
+}
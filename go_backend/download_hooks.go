@@ -0,0 +1,277 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const (
+	DownloadHookTimeout = 30 * time.Second
+	userHookID          = "user-download-hook"
+)
+
+// DownloadHookResult is what an onDownloadComplete hook may return. Returning
+// nothing means the file was left as-is; new_file_path reports a rename/move.
+type DownloadHookResult struct {
+	NewFilePath string `json:"new_file_path,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// UserDownloadHookConfig is a user-provided JS snippet that defines
+// `function onDownloadComplete(track, filePath) { ... }`. It runs in the same
+// sandbox as extensions, limited to the listed network domains and, when
+// File is set, the download directories.
+type UserDownloadHookConfig struct {
+	Script  string   `json:"script"`
+	Network []string `json:"network,omitempty"`
+	File    bool     `json:"file,omitempty"`
+}
+
+var (
+	userDownloadHookMu sync.Mutex
+	userDownloadHook   *LoadedExtension
+)
+
+func buildDownloadHookTrack(resp DownloadResponse) map[string]interface{} {
+	return map[string]interface{}{
+		"title":        resp.Title,
+		"artist":       resp.Artist,
+		"album":        resp.Album,
+		"album_artist": resp.AlbumArtist,
+		"release_date": resp.ReleaseDate,
+		"track_number": resp.TrackNumber,
+		"disc_number":  resp.DiscNumber,
+		"isrc":         resp.ISRC,
+		"genre":        resp.Genre,
+		"label":        resp.Label,
+		"cover_url":    resp.CoverURL,
+		"service":      resp.Service,
+		"bit_depth":    resp.ActualBitDepth,
+		"sample_rate":  resp.ActualSampleRate,
+	}
+}
+
+func runDownloadHookScript(vm *goja.Runtime, ownerID, fnExpr string, track map[string]interface{}, filePath string) (*DownloadHookResult, error) {
+	trackJSON, err := json.Marshal(track)
+	if err != nil {
+		return nil, err
+	}
+
+	script := fmt.Sprintf(`
+		(function() {
+			if (typeof %s === 'function') {
+				return %s(%s, %q);
+			}
+			return null;
+		})()
+	`, fnExpr, fnExpr, string(trackJSON), filePath)
+
+	result, err := RunWithTimeoutAndRecover(vm, script, DownloadHookTimeout)
+	if err != nil {
+		if IsTimeoutError(err) {
+			return nil, fmt.Errorf("onDownloadComplete timeout for %s", ownerID)
+		}
+		return nil, err
+	}
+
+	if result == nil || goja.IsUndefined(result) || goja.IsNull(result) {
+		return &DownloadHookResult{}, nil
+	}
+
+	jsonBytes, err := json.Marshal(result.Export())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal hook result: %w", err)
+	}
+	var hookResult DownloadHookResult
+	if err := json.Unmarshal(jsonBytes, &hookResult); err != nil {
+		// Hooks returning true/strings are fine; only objects carry data.
+		return &DownloadHookResult{}, nil
+	}
+	return &hookResult, nil
+}
+
+func (p *ExtensionProviderWrapper) OnDownloadComplete(track map[string]interface{}, filePath string) (*DownloadHookResult, error) {
+	if !p.extension.Manifest.HasDownloadCompleteHook() || !p.extension.Enabled {
+		return nil, nil
+	}
+
+	release := acquireExtensionVM(p.extension)
+	defer release()
+
+	return runDownloadHookScript(p.vm, p.extension.ID, "extension.onDownloadComplete", track, filePath)
+}
+
+func (m *ExtensionManager) GetDownloadHookProviders() []*ExtensionProviderWrapper {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var providers []*ExtensionProviderWrapper
+	for _, ext := range m.extensions {
+		if ext.Enabled && ext.Error == "" && ext.Manifest.HasDownloadCompleteHook() {
+			providers = append(providers, NewExtensionProviderWrapper(ext))
+		}
+	}
+	return providers
+}
+
+// applyDownloadHookResult accepts a new path only if it exists, so a buggy
+// hook cannot make Flutter register a file that is not there.
+func applyDownloadHookResult(ownerID string, result *DownloadHookResult, filePath string) string {
+	if result == nil {
+		return filePath
+	}
+	if result.Error != "" {
+		GoLog("[DownloadHook] %s reported error: %s\n", ownerID, result.Error)
+	}
+	newPath := strings.TrimSpace(result.NewFilePath)
+	if newPath == "" || newPath == filePath {
+		return filePath
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		GoLog("[DownloadHook] %s returned missing file %s, keeping original path\n", ownerID, newPath)
+		return filePath
+	}
+	GoLog("[DownloadHook] %s moved file to %s\n", ownerID, newPath)
+	return newPath
+}
+
+// runDownloadCompleteHooks runs extension hooks and then the user script for a
+// successful download, returning the (possibly updated) response JSON. Hooks
+// run sequentially so each sees the path left by the previous one.
+func runDownloadCompleteHooks(respJSON string) string {
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success || resp.AlreadyExists {
+		return respJSON
+	}
+	if resp.FilePath == "" || strings.HasPrefix(resp.FilePath, "content://") {
+		return respJSON
+	}
+
+	providers := GetExtensionManager().GetDownloadHookProviders()
+	userHook := getUserDownloadHook()
+	if len(providers) == 0 && userHook == nil {
+		return respJSON
+	}
+
+	filePath := resp.FilePath
+	for _, provider := range providers {
+		result, err := provider.OnDownloadComplete(buildDownloadHookTrack(resp), filePath)
+		if err != nil {
+			GoLog("[DownloadHook] %s failed: %v\n", provider.extension.ID, err)
+			continue
+		}
+		filePath = applyDownloadHookResult(provider.extension.ID, result, filePath)
+	}
+
+	if userHook != nil {
+		userHook.VMMu.Lock()
+		result, err := runDownloadHookScript(userHook.VM, userHookID, "onDownloadComplete", buildDownloadHookTrack(resp), filePath)
+		userHook.VMMu.Unlock()
+		if err != nil {
+			GoLog("[DownloadHook] user script failed: %v\n", err)
+		} else {
+			filePath = applyDownloadHookResult(userHookID, result, filePath)
+		}
+	}
+
+	if filePath == resp.FilePath {
+		return respJSON
+	}
+	resp.FilePath = filePath
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return respJSON
+	}
+	return string(jsonBytes)
+}
+
+func getUserDownloadHook() *LoadedExtension {
+	userDownloadHookMu.Lock()
+	defer userDownloadHookMu.Unlock()
+	return userDownloadHook
+}
+
+// SetUserDownloadHook compiles a user script in a fresh sandboxed VM. An
+// empty script removes the hook.
+func SetUserDownloadHook(config UserDownloadHookConfig) error {
+	script := strings.TrimSpace(config.Script)
+	if script == "" {
+		userDownloadHookMu.Lock()
+		userDownloadHook = nil
+		userDownloadHookMu.Unlock()
+		GoLog("[DownloadHook] User script removed\n")
+		return nil
+	}
+
+	manager := GetExtensionManager()
+	manager.mu.RLock()
+	dataDir := manager.dataDir
+	manager.mu.RUnlock()
+	if dataDir == "" {
+		dataDir = os.TempDir()
+	}
+
+	ext := &LoadedExtension{
+		ID: userHookID,
+		Manifest: &ExtensionManifest{
+			Name:        userHookID,
+			DisplayName: "User download hook",
+			Permissions: ExtensionPermissions{
+				Network: config.Network,
+				Storage: true,
+				File:    config.File,
+			},
+		},
+		Enabled: true,
+		DataDir: filepath.Join(dataDir, userHookID),
+	}
+	if err := os.MkdirAll(ext.DataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create hook data dir: %w", err)
+	}
+
+	vm := goja.New()
+	ext.VM = vm
+	runtime := NewExtensionRuntime(ext)
+	ext.runtime = runtime
+	runtime.RegisterAPIs(vm)
+
+	console := vm.NewObject()
+	console.Set("log", func(call goja.FunctionCall) goja.Value {
+		args := make([]interface{}, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			args[i] = arg.Export()
+		}
+		GoLog("[DownloadHook:user] %v\n", args)
+		return goja.Undefined()
+	})
+	vm.Set("console", console)
+
+	if _, err := RunWithTimeoutAndRecover(vm, script, DefaultJSTimeout); err != nil {
+		return fmt.Errorf("failed to evaluate hook script: %w", err)
+	}
+	fn, err := vm.RunString("typeof onDownloadComplete")
+	if err != nil || fn.String() != "function" {
+		return fmt.Errorf("hook script must define function onDownloadComplete(track, filePath)")
+	}
+
+	userDownloadHookMu.Lock()
+	userDownloadHook = ext
+	userDownloadHookMu.Unlock()
+	GoLog("[DownloadHook] User script installed (network=%v file=%v)\n", config.Network, config.File)
+	return nil
+}
+
+func SetUserDownloadHookJSON(configJSON string) error {
+	var config UserDownloadHookConfig
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return fmt.Errorf("invalid hook config: %w", err)
+	}
+	return SetUserDownloadHook(config)
+}
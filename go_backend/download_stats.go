@@ -0,0 +1,553 @@
+package gobackend
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Download statistics ====================
+//
+// Every successful download is appended to download_history.jsonl in the
+// history dir. Flutter seeds it once with its own history through
+// ImportDownloadHistoryJSON, after which GetStatsJSON derives the numbers
+// for the stats / "wrapped" screen and the achievement list from it.
+//
+// Periods: "all" (or empty), "week", "month" and "year" are trailing
+// windows ending now; "2025" and "2025-03" select a calendar year or month.
+
+const (
+	downloadHistoryFile = "download_history.jsonl"
+
+	QualityHiRes    = "hires"
+	QualityLossless = "lossless"
+	QualityLossy    = "lossy"
+)
+
+// DownloadHistoryRecord is one finished download.
+type DownloadHistoryRecord struct {
+	ItemID       string `json:"item_id,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Artist       string `json:"artist,omitempty"`
+	Album        string `json:"album,omitempty"`
+	ISRC         string `json:"isrc,omitempty"`
+	Service      string `json:"service,omitempty"`
+	FilePath     string `json:"file_path,omitempty"`
+	SizeBytes    int64  `json:"size_bytes,omitempty"`
+	BitDepth     int    `json:"bit_depth,omitempty"`
+	SampleRate   int    `json:"sample_rate,omitempty"`
+	Format       string `json:"format,omitempty"`
+	DownloadedAt int64  `json:"downloaded_at"`
+
+	// Album or playlist the track was downloaded as part of, for exports.
+	CollectionID   string `json:"collection_id,omitempty"`
+	CollectionName string `json:"collection_name,omitempty"`
+	Position       int    `json:"position,omitempty"`
+	TrackNumber    int    `json:"track_number,omitempty"`
+	DiscNumber     int    `json:"disc_number,omitempty"`
+	DurationMS     int    `json:"duration_ms,omitempty"`
+
+	// Audio QC outcome when the pass ran; see audio_qc.go.
+	QCStatus string   `json:"qc_status,omitempty"`
+	QCIssues []string `json:"qc_issues,omitempty"`
+
+	// Hashes of the finished file, for dedupe and integrity checks.
+	MD5    string `json:"md5,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+type ProviderStats struct {
+	Service string `json:"service"`
+	Tracks  int    `json:"tracks"`
+	Bytes   int64  `json:"bytes"`
+}
+
+type ArtistStats struct {
+	Artist string `json:"artist"`
+	Tracks int    `json:"tracks"`
+}
+
+type BusiestDay struct {
+	Date   string `json:"date"`
+	Tracks int    `json:"tracks"`
+}
+
+type QualityStats struct {
+	HiRes             int     `json:"hires"`
+	Lossless          int     `json:"lossless"`
+	Lossy             int     `json:"lossy"`
+	AverageBitDepth   float64 `json:"average_bit_depth,omitempty"`
+	AverageSampleRate float64 `json:"average_sample_rate,omitempty"`
+}
+
+// Achievement is unlocked once Progress reaches Target; UnlockedAt is when
+// the download that crossed the target finished.
+type Achievement struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Progress    int64  `json:"progress"`
+	Target      int64  `json:"target"`
+	Unlocked    bool   `json:"unlocked"`
+	UnlockedAt  int64  `json:"unlocked_at,omitempty"`
+}
+
+type DownloadStats struct {
+	Period       string          `json:"period"`
+	From         int64           `json:"from,omitempty"`
+	To           int64           `json:"to"`
+	TotalTracks  int             `json:"total_tracks"`
+	TotalBytes   int64           `json:"total_bytes"`
+	TotalGB      float64         `json:"total_gb"`
+	Artists      int             `json:"artists"`
+	Albums       int             `json:"albums"`
+	Providers    []ProviderStats `json:"providers"`
+	TopArtists   []ArtistStats   `json:"top_artists"`
+	BusiestDay   *BusiestDay     `json:"busiest_day,omitempty"`
+	Quality      QualityStats    `json:"quality"`
+	Achievements []Achievement   `json:"achievements"`
+}
+
+var (
+	downloadHistoryMu      sync.Mutex
+	downloadHistoryDir     string
+	downloadHistoryRecords []DownloadHistoryRecord
+	downloadHistoryLoaded  bool
+
+	// statsNow is swapped out by tests.
+	statsNow = time.Now
+)
+
+func SetDownloadHistoryDir(dir string) error {
+	downloadHistoryMu.Lock()
+	defer downloadHistoryMu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create history dir: %w", err)
+	}
+	if err := openStore(dir, downloadHistoryStoreSchema); err != nil {
+		return err
+	}
+	downloadHistoryDir = dir
+	downloadHistoryRecords = nil
+	downloadHistoryLoaded = false
+	if err := recoverJobJournalLocked(); err != nil {
+		GoLog("[Journal] Recovery failed, journal disabled: %v\n", err)
+	}
+	return nil
+}
+
+func loadDownloadHistoryLocked() []DownloadHistoryRecord {
+	if downloadHistoryLoaded {
+		return downloadHistoryRecords
+	}
+	downloadHistoryLoaded = true
+	if downloadHistoryDir == "" {
+		return downloadHistoryRecords
+	}
+
+	f, err := os.Open(filepath.Join(downloadHistoryDir, downloadHistoryFile))
+	if err != nil {
+		return downloadHistoryRecords
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	skipped := 0
+	for scanner.Scan() {
+		var record DownloadHistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			skipped++
+			continue
+		}
+		downloadHistoryRecords = append(downloadHistoryRecords, record)
+	}
+	if skipped > 0 {
+		GoLog("[Stats] Skipped %d corrupt history lines\n", skipped)
+	}
+	return downloadHistoryRecords
+}
+
+func appendDownloadHistoryLocked(records []DownloadHistoryRecord) error {
+	loadDownloadHistoryLocked()
+	downloadHistoryRecords = append(downloadHistoryRecords, records...)
+	if downloadHistoryDir == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(downloadHistoryDir, downloadHistoryFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			continue
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func audioFormatFromPath(path string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+}
+
+// recordDownloadHistory appends a successful, newly written download.
+func recordDownloadHistory(req DownloadRequest, respJSON string) {
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success || resp.AlreadyExists {
+		return
+	}
+	if strings.HasPrefix(resp.FilePath, "EXISTS:") {
+		return
+	}
+
+	record := DownloadHistoryRecord{
+		ItemID:       req.ItemID,
+		Title:        firstNonEmpty(resp.Title, req.TrackName),
+		Artist:       firstNonEmpty(resp.Artist, req.ArtistName),
+		Album:        firstNonEmpty(resp.Album, req.AlbumName),
+		ISRC:         firstNonEmpty(resp.ISRC, req.ISRC),
+		Service:      strings.ToLower(firstNonEmpty(resp.Service, req.Service)),
+		FilePath:     resp.FilePath,
+		BitDepth:     resp.ActualBitDepth,
+		SampleRate:   resp.ActualSampleRate,
+		Format:       audioFormatFromPath(firstNonEmpty(resp.FilePath, req.OutputExt)),
+		DownloadedAt: statsNow().Unix(),
+
+		CollectionID:   strings.TrimSpace(req.CollectionID),
+		CollectionName: strings.TrimSpace(req.CollectionName),
+		Position:       req.CollectionPosition,
+		TrackNumber:    req.TrackNumber,
+		DiscNumber:     req.DiscNumber,
+		DurationMS:     max(resp.DurationMS, req.DurationMS),
+
+		MD5:    resp.MD5,
+		SHA256: resp.SHA256,
+	}
+	// SAF outputs are content URIs; their size is read through the fd.
+	if path, err := readableOutputPath(req, resp.FilePath); err == nil {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			record.SizeBytes = info.Size()
+		}
+	}
+	if resp.QC != nil {
+		record.QCStatus = resp.QC.Status
+		record.QCIssues = resp.QC.Summary()
+	}
+
+	downloadHistoryMu.Lock()
+	defer downloadHistoryMu.Unlock()
+	// Journaled first so a kill before the append is replayed on recovery.
+	appendJobJournal(JobJournalRecord{JobID: req.ItemID, State: JobCompleted, History: &record})
+	if err := appendDownloadHistoryLocked([]DownloadHistoryRecord{record}); err != nil {
+		GoLog("[Stats] Failed to record download: %v\n", err)
+	}
+}
+
+// ImportDownloadHistoryJSON merges Flutter's existing history (a JSON array
+// of DownloadHistoryRecord) into the store. Records already present, by item
+// ID or by file path and time, are skipped. Returns how many were added.
+func ImportDownloadHistoryJSON(recordsJSON string) (int, error) {
+	var records []DownloadHistoryRecord
+	if err := json.Unmarshal([]byte(recordsJSON), &records); err != nil {
+		return 0, fmt.Errorf("invalid history: %w", err)
+	}
+
+	downloadHistoryMu.Lock()
+	defer downloadHistoryMu.Unlock()
+
+	seen := make(map[string]bool)
+	key := func(r DownloadHistoryRecord) string {
+		if r.ItemID != "" {
+			return "id:" + r.ItemID
+		}
+		return "path:" + r.FilePath + "@" + strconv.FormatInt(r.DownloadedAt, 10)
+	}
+	for _, record := range loadDownloadHistoryLocked() {
+		seen[key(record)] = true
+	}
+
+	var added []DownloadHistoryRecord
+	for _, record := range records {
+		if record.DownloadedAt <= 0 || seen[key(record)] {
+			continue
+		}
+		record.Service = strings.ToLower(strings.TrimSpace(record.Service))
+		if record.Format == "" {
+			record.Format = audioFormatFromPath(record.FilePath)
+		}
+		seen[key(record)] = true
+		added = append(added, record)
+	}
+	if len(added) == 0 {
+		return 0, nil
+	}
+	if err := appendDownloadHistoryLocked(added); err != nil {
+		return 0, fmt.Errorf("failed to save history: %w", err)
+	}
+	GoLog("[Stats] Imported %d history records\n", len(added))
+	return len(added), nil
+}
+
+// statsPeriodRange returns the inclusive window of a period; from is zero
+// for "all".
+func statsPeriodRange(period string, now time.Time) (time.Time, time.Time, error) {
+	switch period {
+	case "", "all":
+		return time.Time{}, now, nil
+	case "week":
+		return now.AddDate(0, 0, -7), now, nil
+	case "month":
+		return now.AddDate(0, -1, 0), now, nil
+	case "year":
+		return now.AddDate(-1, 0, 0), now, nil
+	}
+	if t, err := time.ParseInLocation("2006", period, now.Location()); err == nil {
+		return t, t.AddDate(1, 0, 0).Add(-time.Second), nil
+	}
+	if t, err := time.ParseInLocation("2006-01", period, now.Location()); err == nil {
+		return t, t.AddDate(0, 1, 0).Add(-time.Second), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown period: %q", period)
+}
+
+func recordQuality(r DownloadHistoryRecord) string {
+	switch r.Format {
+	case "flac", "wav", "aiff", "alac":
+	case "m4a":
+		// AAC and ALAC share the container; only ALAC reports a bit depth.
+		if r.BitDepth == 0 {
+			return QualityLossy
+		}
+	default:
+		return QualityLossy
+	}
+	if r.BitDepth > 16 || r.SampleRate > 48000 {
+		return QualityHiRes
+	}
+	return QualityLossless
+}
+
+func computeDownloadStats(records []DownloadHistoryRecord, period string, from, to time.Time) DownloadStats {
+	stats := DownloadStats{
+		Period:     firstNonEmpty(period, "all"),
+		To:         to.Unix(),
+		Providers:  []ProviderStats{},
+		TopArtists: []ArtistStats{},
+	}
+	if !from.IsZero() {
+		stats.From = from.Unix()
+	}
+
+	providers := make(map[string]*ProviderStats)
+	artists := make(map[string]*ArtistStats)
+	albums := make(map[string]bool)
+	days := make(map[string]int)
+	var bitDepthSum, sampleRateSum, qualityCount int64
+
+	for _, r := range records {
+		at := time.Unix(r.DownloadedAt, 0).In(to.Location())
+		if (!from.IsZero() && at.Before(from)) || at.After(to) {
+			continue
+		}
+		stats.TotalTracks++
+		stats.TotalBytes += r.SizeBytes
+
+		service := firstNonEmpty(r.Service, "unknown")
+		p := providers[service]
+		if p == nil {
+			p = &ProviderStats{Service: service}
+			providers[service] = p
+		}
+		p.Tracks++
+		p.Bytes += r.SizeBytes
+
+		if artist := strings.TrimSpace(r.Artist); artist != "" {
+			key := strings.ToLower(artist)
+			a := artists[key]
+			if a == nil {
+				a = &ArtistStats{Artist: artist}
+				artists[key] = a
+			}
+			a.Tracks++
+		}
+		if album := strings.TrimSpace(r.Album); album != "" {
+			albums[strings.ToLower(r.Artist+"\x00"+album)] = true
+		}
+		days[at.Format("2006-01-02")]++
+
+		switch recordQuality(r) {
+		case QualityHiRes:
+			stats.Quality.HiRes++
+		case QualityLossless:
+			stats.Quality.Lossless++
+		default:
+			stats.Quality.Lossy++
+		}
+		if r.BitDepth > 0 && r.SampleRate > 0 {
+			bitDepthSum += int64(r.BitDepth)
+			sampleRateSum += int64(r.SampleRate)
+			qualityCount++
+		}
+	}
+
+	stats.TotalGB = float64(stats.TotalBytes*100/(1<<30)) / 100
+	stats.Artists = len(artists)
+	stats.Albums = len(albums)
+	if qualityCount > 0 {
+		stats.Quality.AverageBitDepth = float64(bitDepthSum*10/qualityCount) / 10
+		stats.Quality.AverageSampleRate = float64(sampleRateSum / qualityCount)
+	}
+
+	for _, p := range providers {
+		stats.Providers = append(stats.Providers, *p)
+	}
+	sort.Slice(stats.Providers, func(i, j int) bool {
+		if stats.Providers[i].Tracks != stats.Providers[j].Tracks {
+			return stats.Providers[i].Tracks > stats.Providers[j].Tracks
+		}
+		return stats.Providers[i].Service < stats.Providers[j].Service
+	})
+
+	for _, a := range artists {
+		stats.TopArtists = append(stats.TopArtists, *a)
+	}
+	sort.Slice(stats.TopArtists, func(i, j int) bool {
+		if stats.TopArtists[i].Tracks != stats.TopArtists[j].Tracks {
+			return stats.TopArtists[i].Tracks > stats.TopArtists[j].Tracks
+		}
+		return stats.TopArtists[i].Artist < stats.TopArtists[j].Artist
+	})
+	if len(stats.TopArtists) > 10 {
+		stats.TopArtists = stats.TopArtists[:10]
+	}
+
+	for date, n := range days {
+		if stats.BusiestDay == nil || n > stats.BusiestDay.Tracks || (n == stats.BusiestDay.Tracks && date < stats.BusiestDay.Date) {
+			stats.BusiestDay = &BusiestDay{Date: date, Tracks: n}
+		}
+	}
+	return stats
+}
+
+type achievementDef struct {
+	id, title, description string
+	target                 int64
+	// progress returns the running value after r has been counted.
+	progress func(r DownloadHistoryRecord) int64
+}
+
+// achievementDefs builds fresh counters; achievements always cover the
+// whole history, whatever period the stats are for.
+func achievementDefs(loc *time.Location) []achievementDef {
+	var tracks, bytes, hires int64
+	services := make(map[string]bool)
+	var lastDay time.Time
+	var streak, bestStreak int64
+
+	countTrack := func(DownloadHistoryRecord) int64 { tracks++; return tracks }
+	trackCounter := func(DownloadHistoryRecord) int64 { return tracks }
+
+	return []achievementDef{
+		{"first_download", "First Light", "Download your first track", 1, countTrack},
+		{"tracks_100", "Crate Digger", "Download 100 tracks", 100, trackCounter},
+		{"tracks_1000", "Archivist", "Download 1,000 tracks", 1000, trackCounter},
+		{"gigabytes_10", "Heavy Lifter", "Download 10 GB of music", 10 << 30, func(r DownloadHistoryRecord) int64 {
+			bytes += r.SizeBytes
+			return bytes
+		}},
+		{"hires_50", "Golden Ears", "Download 50 hi-res tracks", 50, func(r DownloadHistoryRecord) int64 {
+			if recordQuality(r) == QualityHiRes {
+				hires++
+			}
+			return hires
+		}},
+		{"providers_3", "Explorer", "Download from 3 different providers", 3, func(r DownloadHistoryRecord) int64 {
+			if r.Service != "" {
+				services[r.Service] = true
+			}
+			return int64(len(services))
+		}},
+		{"streak_7", "Week Streak", "Download something 7 days in a row", 7, func(r DownloadHistoryRecord) int64 {
+			t := time.Unix(r.DownloadedAt, 0).In(loc)
+			day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+			switch {
+			case lastDay.IsZero() || day.After(lastDay.AddDate(0, 0, 1)):
+				streak = 1
+			case day.Equal(lastDay.AddDate(0, 0, 1)):
+				streak++
+			}
+			lastDay = day
+			if streak > bestStreak {
+				bestStreak = streak
+			}
+			return bestStreak
+		}},
+	}
+}
+
+func computeAchievements(records []DownloadHistoryRecord, loc *time.Location) []Achievement {
+	sorted := append([]DownloadHistoryRecord(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].DownloadedAt < sorted[j].DownloadedAt })
+
+	defs := achievementDefs(loc)
+	achievements := make([]Achievement, len(defs))
+	for i, def := range defs {
+		achievements[i] = Achievement{ID: def.id, Title: def.title, Description: def.description, Target: def.target}
+	}
+	for _, r := range sorted {
+		for i, def := range defs {
+			a := &achievements[i]
+			a.Progress = def.progress(r)
+			if !a.Unlocked && a.Progress >= a.Target {
+				a.Unlocked = true
+				a.UnlockedAt = r.DownloadedAt
+			}
+		}
+	}
+	for i := range achievements {
+		if achievements[i].Progress > achievements[i].Target {
+			achievements[i].Progress = achievements[i].Target
+		}
+	}
+	return achievements
+}
+
+// GetStatsJSON returns DownloadStats for period along with all achievements.
+func GetStatsJSON(period string) (string, error) {
+	period = strings.ToLower(strings.TrimSpace(period))
+	now := statsNow()
+	from, to, err := statsPeriodRange(period, now)
+	if err != nil {
+		return "", err
+	}
+
+	downloadHistoryMu.Lock()
+	records := append([]DownloadHistoryRecord(nil), loadDownloadHistoryLocked()...)
+	downloadHistoryMu.Unlock()
+
+	stats := computeDownloadStats(records, period, from, to)
+	stats.Achievements = computeAchievements(records, now.Location())
+
+	jsonBytes, err := json.Marshal(stats)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
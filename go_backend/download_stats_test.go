@@ -0,0 +1,107 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadStats(t *testing.T) {
+	dir := t.TempDir()
+	if err := SetDownloadHistoryDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDownloadHistoryDir(t.TempDir())
+
+	now := time.Date(2026, 3, 20, 12, 0, 0, 0, time.UTC)
+	prevNow := statsNow
+	statsNow = func() time.Time { return now }
+	defer func() { statsNow = prevNow }()
+
+	day := func(d int) int64 { return time.Date(2026, 3, d, 10, 0, 0, 0, time.UTC).Unix() }
+	history := []DownloadHistoryRecord{
+		{ItemID: "a", Artist: "Alpha", Album: "One", Service: "Tidal", FilePath: "/m/a.flac", SizeBytes: 30 << 20, BitDepth: 24, SampleRate: 96000, DownloadedAt: day(10)},
+		{ItemID: "b", Artist: "Alpha", Album: "One", Service: "tidal", FilePath: "/m/b.flac", SizeBytes: 20 << 20, BitDepth: 16, SampleRate: 44100, DownloadedAt: day(11)},
+		{ItemID: "c", Artist: "Beta", Album: "Two", Service: "qobuz", FilePath: "/m/c.mp3", SizeBytes: 8 << 20, DownloadedAt: day(11)},
+		{ItemID: "old", Artist: "Gamma", Service: "amazon", FilePath: "/m/old.flac", BitDepth: 16, SampleRate: 44100, DownloadedAt: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC).Unix()},
+	}
+	data, _ := json.Marshal(history)
+	if added, err := ImportDownloadHistoryJSON(string(data)); err != nil || added != 4 {
+		t.Fatalf("import = %d, %v", added, err)
+	}
+	if added, _ := ImportDownloadHistoryJSON(string(data)); added != 0 {
+		t.Errorf("re-import added %d duplicates", added)
+	}
+
+	// A finished download is appended, and the store survives a reload.
+	recordDownloadHistory(DownloadRequest{ItemID: "d", ArtistName: "Beta", Service: "qobuz"},
+		`{"success": true, "file_path": "/m/d.flac", "actual_bit_depth": 24, "actual_sample_rate": 48000}`)
+	recordDownloadHistory(DownloadRequest{ItemID: "e"}, `{"success": true, "file_path": "EXISTS:/m/a.flac"}`)
+	SetDownloadHistoryDir(dir)
+
+	var stats DownloadStats
+	raw, err := GetStatsJSON("month")
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.Unmarshal([]byte(raw), &stats)
+	if stats.TotalTracks != 4 || stats.TotalBytes != 58<<20 || stats.Artists != 2 || stats.Albums != 2 {
+		t.Errorf("totals = %d tracks, %d bytes, %d artists, %d albums", stats.TotalTracks, stats.TotalBytes, stats.Artists, stats.Albums)
+	}
+	if got := fmt.Sprint(stats.Providers); got != "[{qobuz 2 8388608} {tidal 2 52428800}]" {
+		t.Errorf("providers = %s", got)
+	}
+	if stats.BusiestDay == nil || stats.BusiestDay.Date != "2026-03-11" || stats.BusiestDay.Tracks != 2 {
+		t.Errorf("busiest day = %+v", stats.BusiestDay)
+	}
+	if q := stats.Quality; q.HiRes != 2 || q.Lossless != 1 || q.Lossy != 1 || q.AverageBitDepth != 21.3 {
+		t.Errorf("quality = %+v", q)
+	}
+
+	raw, _ = GetStatsJSON("2025")
+	json.Unmarshal([]byte(raw), &stats)
+	if stats.TotalTracks != 1 || stats.Providers[0].Service != "amazon" {
+		t.Errorf("2025 stats = %+v", stats)
+	}
+
+	unlocked := map[string]bool{}
+	for _, a := range stats.Achievements {
+		unlocked[a.ID] = a.Unlocked
+	}
+	if !unlocked["first_download"] || !unlocked["providers_3"] || unlocked["tracks_100"] || unlocked["streak_7"] {
+		t.Errorf("achievements = %+v", stats.Achievements)
+	}
+
+	if _, err := GetStatsJSON("fortnight"); err == nil {
+		t.Error("expected unknown period to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, downloadHistoryFile)); err != nil {
+		t.Errorf("history file not written: %v", err)
+	}
+}
+
+func TestDownloadHistorySizeFromOutputFD(t *testing.T) {
+	if err := SetDownloadHistoryDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDownloadHistoryDir(t.TempDir())
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "saf.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write(make([]byte, 4096))
+
+	recordDownloadHistory(DownloadRequest{ItemID: "saf", OutputFD: int(f.Fd())},
+		`{"success": true, "file_path": "content://media/tree/doc/saf.flac", "md5": "m", "sha256": "s"}`)
+	downloadHistoryMu.Lock()
+	records := loadDownloadHistoryLocked()
+	downloadHistoryMu.Unlock()
+	if len(records) != 1 || records[0].SizeBytes != 4096 || records[0].MD5 != "m" || records[0].SHA256 != "s" {
+		t.Errorf("records = %+v, want one of 4096 bytes", records)
+	}
+}
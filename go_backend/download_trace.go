@@ -0,0 +1,411 @@
+package gobackend
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ==================== Download tracing ====================
+//
+// Every download started through DownloadByStrategy records a trace keyed by
+// its item ID: a root "download" span and one child span per step, so a slow
+// download shows where its time went:
+//
+//	search      metadata lookups (extension enrichment, Deezer by ISRC)
+//	match       finding the track at a provider (one span per attempt)
+//	stream_url  resolving the provider's stream URL
+//	fetch       the audio transfer (audio task, or an extension's download)
+//	cover, lyrics, tag, lyrics_write   the other track tasks
+//	finalize    queued metadata, hashes and completion hooks
+//
+// GetDownloadTraceJSON returns a trace as an OTLP/JSON ExportTraceServiceRequest,
+// so it can be loaded into any OpenTelemetry viewer as is. Debug builds can
+// also push finished traces to an OTLP/HTTP collector, see
+// download_trace_otlp.go.
+
+const (
+	TraceSpanDownload  = "download"
+	TraceSpanSearch    = "search"
+	TraceSpanMatch     = "match"
+	TraceSpanStreamURL = "stream_url"
+	TraceSpanFetch     = "fetch"
+	TraceSpanFinalize  = "finalize"
+
+	maxRecentDownloadTraces = 50
+	downloadTraceScope      = "spotiflac.download"
+)
+
+// OTLP status codes.
+const (
+	traceStatusOK    = 1
+	traceStatusError = 2
+)
+
+type traceSpan struct {
+	trace    *downloadTrace
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	status   int
+	message  string
+}
+
+type downloadTrace struct {
+	itemID  string
+	traceID string
+	root    *traceSpan
+	spans   []*traceSpan
+	mu      sync.Mutex
+}
+
+var (
+	downloadTraceMu     sync.Mutex
+	activeDownloadTrace = make(map[string]*downloadTrace)
+	recentDownloadTrace []*downloadTrace
+)
+
+func newTraceID(bytes int) string {
+	b := make([]byte, bytes)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%0*x", bytes*2, time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// startDownloadTrace opens the root span for itemID, replacing a trace left
+// over from an earlier attempt at the same item.
+func startDownloadTrace(itemID string, attrs map[string]interface{}) *traceSpan {
+	if itemID == "" {
+		return nil
+	}
+	trace := &downloadTrace{itemID: itemID, traceID: newTraceID(16)}
+	trace.root = &traceSpan{
+		trace:  trace,
+		spanID: newTraceID(8),
+		name:   TraceSpanDownload,
+		start:  time.Now(),
+		attrs:  map[string]interface{}{"item.id": itemID},
+	}
+	for k, v := range attrs {
+		trace.root.attrs[k] = v
+	}
+	trace.spans = []*traceSpan{trace.root}
+
+	downloadTraceMu.Lock()
+	activeDownloadTrace[itemID] = trace
+	downloadTraceMu.Unlock()
+	return trace.root
+}
+
+// startTraceSpan opens a child of itemID's root span. Without an active trace
+// it returns nil, and every traceSpan method is a no-op on nil.
+func startTraceSpan(itemID, name string, attrs map[string]interface{}) *traceSpan {
+	if itemID == "" {
+		return nil
+	}
+	downloadTraceMu.Lock()
+	trace := activeDownloadTrace[itemID]
+	downloadTraceMu.Unlock()
+	if trace == nil {
+		return nil
+	}
+
+	span := &traceSpan{
+		trace:    trace,
+		spanID:   newTraceID(8),
+		parentID: trace.root.spanID,
+		name:     name,
+		start:    time.Now(),
+		attrs:    make(map[string]interface{}, len(attrs)),
+	}
+	for k, v := range attrs {
+		span.attrs[k] = v
+	}
+	trace.mu.Lock()
+	trace.spans = append(trace.spans, span)
+	trace.mu.Unlock()
+	return span
+}
+
+func (s *traceSpan) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	s.attrs[key] = value
+	s.trace.mu.Unlock()
+}
+
+// End closes the span with an error status when err is set. Ending twice
+// keeps the first result.
+func (s *traceSpan) End(err error) {
+	if s == nil {
+		return
+	}
+	s.trace.mu.Lock()
+	defer s.trace.mu.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.status = traceStatusError
+		s.message = err.Error()
+	} else {
+		s.status = traceStatusOK
+	}
+}
+
+// finishDownloadTrace ends the root span of itemID, moves the trace to the
+// recent list and hands it to the exporter.
+func finishDownloadTrace(itemID string, err error) {
+	downloadTraceMu.Lock()
+	trace := activeDownloadTrace[itemID]
+	if trace == nil {
+		downloadTraceMu.Unlock()
+		return
+	}
+	delete(activeDownloadTrace, itemID)
+	recentDownloadTrace = append(recentDownloadTrace, trace)
+	if len(recentDownloadTrace) > maxRecentDownloadTraces {
+		recentDownloadTrace = recentDownloadTrace[len(recentDownloadTrace)-maxRecentDownloadTraces:]
+	}
+	downloadTraceMu.Unlock()
+
+	// Spans left open by an early return end with the download.
+	trace.mu.Lock()
+	spans := append([]*traceSpan{}, trace.spans...)
+	trace.mu.Unlock()
+	for _, span := range spans {
+		if span != trace.root {
+			span.End(nil)
+		}
+	}
+	trace.root.End(err)
+
+	exportDownloadTrace(trace)
+}
+
+// finishDownloadTraceJSON ends itemID's trace from a DownloadResponse JSON.
+func finishDownloadTraceJSON(itemID, respJSON string, respErr error) {
+	err := respErr
+	if err == nil {
+		var resp DownloadResponse
+		if json.Unmarshal([]byte(respJSON), &resp) == nil && !resp.Success {
+			err = fmt.Errorf("%s", resp.Error)
+		}
+	}
+	finishDownloadTrace(itemID, err)
+}
+
+func findDownloadTrace(itemID string) *downloadTrace {
+	downloadTraceMu.Lock()
+	defer downloadTraceMu.Unlock()
+	if trace := activeDownloadTrace[itemID]; trace != nil {
+		return trace
+	}
+	for i := len(recentDownloadTrace) - 1; i >= 0; i-- {
+		if recentDownloadTrace[i].itemID == itemID {
+			return recentDownloadTrace[i]
+		}
+	}
+	return nil
+}
+
+// ---- OTLP/JSON encoding ----
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpValue(v interface{}) otlpAnyValue {
+	switch val := v.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &val}
+	case bool:
+		return otlpAnyValue{BoolValue: &val}
+	case int:
+		s := strconv.Itoa(val)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(val, 10)
+		return otlpAnyValue{IntValue: &s}
+	case float64:
+		return otlpAnyValue{DoubleValue: &val}
+	}
+	s := fmt.Sprint(v)
+	return otlpAnyValue{StringValue: &s}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, otlpKeyValue{Key: k, Value: otlpValue(attrs[k])})
+	}
+	return out
+}
+
+func otlpTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func (t *downloadTrace) otlp() otlpTraceRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = downloadTraceScope
+	for _, span := range t.spans {
+		attrs := span.attrs
+		if !span.end.IsZero() {
+			attrs = make(map[string]interface{}, len(span.attrs)+1)
+			for k, v := range span.attrs {
+				attrs[k] = v
+			}
+			attrs["duration_ms"] = span.end.Sub(span.start).Milliseconds()
+		}
+		scope.Spans = append(scope.Spans, otlpSpan{
+			TraceID:           t.traceID,
+			SpanID:            span.spanID,
+			ParentSpanID:      span.parentID,
+			Name:              span.name,
+			Kind:              1, // SPAN_KIND_INTERNAL
+			StartTimeUnixNano: otlpTimestamp(span.start),
+			EndTimeUnixNano:   otlpTimestamp(span.end),
+			Attributes:        otlpAttributes(attrs),
+			Status:            otlpStatus{Code: span.status, Message: span.message},
+		})
+	}
+
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = otlpAttributes(map[string]interface{}{"service.name": "spotiflac"})
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{resource}}
+}
+
+// GetDownloadTraceJSON returns the trace of an active or recent download as
+// OTLP/JSON.
+func GetDownloadTraceJSON(itemID string) (string, error) {
+	trace := findDownloadTrace(itemID)
+	if trace == nil {
+		return "", fmt.Errorf("no trace for item %s", itemID)
+	}
+	jsonBytes, err := json.Marshal(trace.otlp())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// DownloadTraceSummary is one entry of ListDownloadTracesJSON.
+type DownloadTraceSummary struct {
+	ItemID     string           `json:"item_id"`
+	TraceID    string           `json:"trace_id"`
+	StartedAt  int64            `json:"started_at"`
+	DurationMs int64            `json:"duration_ms,omitempty"`
+	Finished   bool             `json:"finished"`
+	Error      string           `json:"error,omitempty"`
+	Spans      map[string]int64 `json:"span_ms,omitempty"`
+}
+
+// ListDownloadTracesJSON summarises recent traces, newest first, with the
+// total milliseconds spent per span name.
+func ListDownloadTracesJSON() (string, error) {
+	downloadTraceMu.Lock()
+	traces := make([]*downloadTrace, 0, len(recentDownloadTrace)+len(activeDownloadTrace))
+	for i := len(recentDownloadTrace) - 1; i >= 0; i-- {
+		traces = append(traces, recentDownloadTrace[i])
+	}
+	for _, trace := range activeDownloadTrace {
+		traces = append(traces, trace)
+	}
+	downloadTraceMu.Unlock()
+
+	summaries := make([]DownloadTraceSummary, 0, len(traces))
+	for _, trace := range traces {
+		trace.mu.Lock()
+		summary := DownloadTraceSummary{
+			ItemID:    trace.itemID,
+			TraceID:   trace.traceID,
+			StartedAt: trace.root.start.UnixMilli(),
+			Finished:  !trace.root.end.IsZero(),
+			Error:     trace.root.message,
+			Spans:     make(map[string]int64),
+		}
+		if summary.Finished {
+			summary.DurationMs = trace.root.end.Sub(trace.root.start).Milliseconds()
+		}
+		for _, span := range trace.spans {
+			if span != trace.root && !span.end.IsZero() {
+				summary.Spans[span.name] += span.end.Sub(span.start).Milliseconds()
+			}
+		}
+		trace.mu.Unlock()
+		summaries = append(summaries, summary)
+	}
+
+	jsonBytes, err := json.Marshal(summaries)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,72 @@
+//go:build debug
+
+package gobackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Debug builds (go build -tags debug) can push every finished download trace
+// to an OTLP/HTTP collector such as the OpenTelemetry Collector or Jaeger.
+
+var (
+	traceExportMu       sync.Mutex
+	traceExportEndpoint string
+)
+
+// SetDownloadTraceExportEndpoint sets the collector base URL, e.g.
+// http://192.168.1.10:4318. Traces are POSTed to its /v1/traces unless the
+// URL already has a path. An empty endpoint stops exporting.
+func SetDownloadTraceExportEndpoint(endpoint string) error {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint != "" {
+		parsed, err := url.Parse(endpoint)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid OTLP endpoint: %s", endpoint)
+		}
+		if parsed.Path == "" || parsed.Path == "/" {
+			parsed.Path = "/v1/traces"
+		}
+		endpoint = parsed.String()
+	}
+
+	traceExportMu.Lock()
+	traceExportEndpoint = endpoint
+	traceExportMu.Unlock()
+	if endpoint != "" {
+		GoLog("[Trace] Exporting download traces to %s\n", endpoint)
+	}
+	return nil
+}
+
+func exportDownloadTrace(trace *downloadTrace) {
+	traceExportMu.Lock()
+	endpoint := traceExportEndpoint
+	traceExportMu.Unlock()
+	if endpoint == "" {
+		return
+	}
+
+	payload, err := json.Marshal(trace.otlp())
+	if err != nil {
+		return
+	}
+	go func() {
+		client := NewHTTPClientWithTimeout(10 * time.Second)
+		resp, err := client.Post(endpoint, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			GoLog("[Trace] OTLP export failed: %v\n", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			GoLog("[Trace] OTLP export rejected: HTTP %d\n", resp.StatusCode)
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+//go:build !debug
+
+package gobackend
+
+import "errors"
+
+func SetDownloadTraceExportEndpoint(endpoint string) error {
+	return errors.New("OTLP trace export is only available in debug builds")
+}
+
+func exportDownloadTrace(trace *downloadTrace) {}
@@ -0,0 +1,91 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDownloadTrace_SpansAndOTLPShape(t *testing.T) {
+	const itemID = "trace-item"
+	defer clearItemStages(itemID)
+
+	startDownloadTrace(itemID, map[string]interface{}{"service": "tidal"})
+	match := startTraceSpan(itemID, TraceSpanMatch, map[string]interface{}{"provider": "qobuz"})
+	match.End(errors.New("track not found"))
+	startTraceSpan(itemID, TraceSpanMatch, map[string]interface{}{"provider": "tidal"}).End(nil)
+
+	g := newTrackTaskGraph(itemID)
+	g.add(&trackTask{name: TrackStageAudio, run: func() error { return nil }})
+	g.add(&trackTask{name: TrackStageTag, requires: []string{TrackStageAudio}, optional: true, run: func() error { return nil }})
+	if err := g.run(); err != nil {
+		t.Fatal(err)
+	}
+	startTraceSpan(itemID, TraceSpanFinalize, nil) // left open, closed by finish
+	finishDownloadTrace(itemID, nil)
+
+	if span := startTraceSpan(itemID, TraceSpanFetch, nil); span != nil {
+		t.Error("span started after the trace finished")
+	}
+
+	raw, err := GetDownloadTraceJSON(itemID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req otlpTraceRequest
+	if err := json.Unmarshal([]byte(raw), &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected OTLP layout: %s", raw)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+
+	var root otlpSpan
+	names := []string{}
+	for _, span := range spans {
+		names = append(names, span.Name)
+		if span.Name == TraceSpanDownload {
+			root = span
+		}
+	}
+	if got := strings.Join(names, ","); got != "download,match,match,fetch,tag,finalize" {
+		t.Errorf("spans = %s", got)
+	}
+	if len(root.TraceID) != 32 || len(root.SpanID) != 16 || root.ParentSpanID != "" || root.Status.Code != traceStatusOK {
+		t.Errorf("bad root span: %+v", root)
+	}
+	for _, span := range spans[1:] {
+		if span.TraceID != root.TraceID || span.ParentSpanID != root.SpanID {
+			t.Errorf("%s is not a child of the root span", span.Name)
+		}
+		if span.EndTimeUnixNano == "0" || span.EndTimeUnixNano < span.StartTimeUnixNano {
+			t.Errorf("%s has no end time", span.Name)
+		}
+	}
+	if spans[1].Status.Code != traceStatusError || spans[1].Status.Message != "track not found" {
+		t.Errorf("failed match status = %+v", spans[1].Status)
+	}
+
+	var summaries []DownloadTraceSummary
+	listJSON, _ := ListDownloadTracesJSON()
+	if err := json.Unmarshal([]byte(listJSON), &summaries); err != nil || len(summaries) == 0 {
+		t.Fatalf("list: %v %s", err, listJSON)
+	}
+	if s := summaries[0]; s.ItemID != itemID || !s.Finished {
+		t.Errorf("newest summary = %+v", s)
+	}
+	if _, ok := summaries[0].Spans[TraceSpanFetch]; !ok {
+		t.Errorf("summary lacks fetch timing: %+v", summaries[0].Spans)
+	}
+}
+
+func TestDownloadTrace_NoActiveTrace(t *testing.T) {
+	span := startTraceSpan("untraced-item", TraceSpanFetch, nil)
+	span.SetAttr("bytes", 1)
+	span.End(nil)
+	if _, err := GetDownloadTraceJSON("untraced-item"); err == nil {
+		t.Error("expected an error for an unknown item")
+	}
+}
@@ -0,0 +1,105 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ==================== Download durability ====================
+//
+// Some vendor filesystems keep freshly written files in the page cache for a
+// long time; if the process dies right after "done" the user finds a
+// zero-byte track. BackendConfig.Durability decides what is flushed before a
+// download is reported complete:
+//
+//	off   nothing, the kernel writes back whenever it likes
+//	file  fsync the audio file (detached SAF fds are synced before close)
+//	full  also fsync the parent directory so the new entry survives
+
+const (
+	DurabilityOff  = "off"
+	DurabilityFile = "file"
+	DurabilityFull = "full"
+)
+
+func durabilityPolicy() string {
+	return GetBackendConfig().Durability
+}
+
+// syncFileAt flushes the file at path. Linux accepts fsync on a read-only
+// descriptor, so the file does not have to be writable.
+func syncFileAt(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// syncDir flushes directory metadata. Filesystems that cannot sync
+// directories (FUSE, Windows) report EINVAL or similar, which is ignored.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !isUnsupportedSyncError(err) {
+		return err
+	}
+	return nil
+}
+
+func isUnsupportedSyncError(err error) bool {
+	return errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTSUP) ||
+		errors.Is(err, syscall.EROFS) || errors.Is(err, syscall.EACCES) || errors.Is(err, os.ErrPermission)
+}
+
+// syncCompletedDownload applies the durability policy to a successful path
+// output. FD outputs are synced in closeOwnedOutputFD instead, since the
+// descriptor is gone by the time the response is built.
+func syncCompletedDownload(req DownloadRequest, respJSON string) {
+	policy := durabilityPolicy()
+	if policy == DurabilityOff || isFDOutput(req.OutputFD) {
+		return
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success || resp.AlreadyExists {
+		return
+	}
+	syncOutputPath(strings.TrimSpace(resp.FilePath))
+}
+
+// syncOutputPath fsyncs a finished local output, and its directory under the
+// full policy.
+func syncOutputPath(path string) {
+	policy := durabilityPolicy()
+	if policy == DurabilityOff || path == "" || strings.HasPrefix(path, "EXISTS:") || strings.HasPrefix(path, "content://") {
+		return
+	}
+	if err := syncFileAt(path); err != nil {
+		GoLog("[Durability] fsync of %s failed: %v\n", path, err)
+		return
+	}
+	if policy == DurabilityFull && !strings.HasPrefix(path, "/proc/self/fd/") {
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			GoLog("[Durability] fsync of %s failed: %v\n", filepath.Dir(path), err)
+		}
+	}
+}
+
+// syncOutputFDBeforeClose flushes a detached output fd; any policy other
+// than off applies, as a SAF document has no directory we could sync.
+func syncOutputFDBeforeClose(fd int) {
+	if durabilityPolicy() == DurabilityOff {
+		return
+	}
+	if err := syncFD(fd); err != nil && !isBadFD(err) && !isUnsupportedSyncError(err) {
+		GoLog("[Durability] fsync of fd %d failed: %v\n", fd, err)
+	}
+}
@@ -0,0 +1,44 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDurabilityConfigValidate(t *testing.T) {
+	cfg := DefaultBackendConfig()
+	cfg.Durability = " FILE "
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.Durability != DurabilityFile {
+		t.Fatalf("durability = %q, want %q", cfg.Durability, DurabilityFile)
+	}
+	cfg.Durability = "sometimes"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected unsupported durability to be rejected")
+	}
+}
+
+func TestSyncCompletedDownload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "track.flac")
+	if err := os.WriteFile(path, []byte("fLaC"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncFileAt(path); err != nil {
+		t.Fatalf("syncFileAt: %v", err)
+	}
+	if err := syncDir(dir); err != nil {
+		t.Fatalf("syncDir: %v", err)
+	}
+	if err := syncFileAt(filepath.Join(dir, "missing.flac")); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+
+	resp, _ := json.Marshal(DownloadResponse{Success: true, FilePath: path})
+	syncCompletedDownload(DownloadRequest{}, string(resp))
+	syncCompletedDownload(DownloadRequest{}, `{"success":false}`)
+}
@@ -0,0 +1,275 @@
+package gobackend
+
+import (
+	"sort"
+	"sync"
+)
+
+// ==================== Event bus ====================
+//
+// Pushed events go through one bus to the EventSink. Every event type is a
+// topic with its own bounded queue and a delivery policy:
+//
+//	drop        keeps the newest events up to the topic's capacity; the
+//	            oldest are dropped when the sink falls behind
+//	coalesce    keeps one pending event per key (the item ID the producer
+//	            passes, or one per topic without one) and replaces it in
+//	            place, so a slow sink sees the latest progress instead of
+//	            a backlog
+//	guaranteed  never dropped while the sink keeps up, and held while no
+//	            sink is set; used for auth prompts and completions
+//
+// Guaranteed topics are delivered before the others, each group in emit
+// order. Producers never block. Only guaranteed events are queued while no
+// sink is set; the rest are discarded as before. An event counts as
+// delivered once OnEvent returned; a guaranteed event whose sink was removed
+// or replaced during OnEvent is queued again for the next sink.
+
+const (
+	EventDrop       = "drop"
+	EventCoalesce   = "coalesce"
+	EventGuaranteed = "guaranteed"
+
+	defaultEventCapacity = 64
+	// maxGuaranteedEvents only guards memory when a sink never shows up.
+	maxGuaranteedEvents = 4096
+)
+
+type eventTopic struct {
+	policy   string
+	capacity int
+}
+
+var eventTopics = map[string]eventTopic{
+	"progress":     {EventCoalesce, 256},
+	"stream_title": {EventCoalesce, 16},
+	"network":      {EventCoalesce, 1},
+	"verify":       {EventCoalesce, 1},
+	"retag":        {EventCoalesce, 1},
+	"organize":     {EventCoalesce, 1},
+	"log":          {EventDrop, 256},
+
+	"auth_request":     {EventGuaranteed, maxGuaranteedEvents},
+	"deezer_session":   {EventGuaranteed, maxGuaranteedEvents},
+	"extension_domain": {EventGuaranteed, maxGuaranteedEvents},
+	"download":         {EventGuaranteed, maxGuaranteedEvents},
+	"batch":            {EventGuaranteed, maxGuaranteedEvents},
+	"album_assets":     {EventGuaranteed, maxGuaranteedEvents},
+	"release":          {EventGuaranteed, maxGuaranteedEvents},
+	"import":           {EventGuaranteed, maxGuaranteedEvents},
+	"radio_rip":        {EventGuaranteed, maxGuaranteedEvents},
+	"config":           {EventGuaranteed, maxGuaranteedEvents},
+}
+
+func eventTopicFor(name string) eventTopic {
+	if topic, ok := eventTopics[name]; ok {
+		return topic
+	}
+	return eventTopic{EventDrop, defaultEventCapacity}
+}
+
+// EventTopicStats reports one topic's queue.
+type EventTopicStats struct {
+	Topic     string `json:"topic"`
+	Policy    string `json:"policy"`
+	Capacity  int    `json:"capacity"`
+	Pending   int    `json:"pending"`
+	Delivered int64  `json:"delivered"`
+	Dropped   int64  `json:"dropped"`
+	Coalesced int64  `json:"coalesced"`
+}
+
+type pendingEvent struct {
+	seq     uint64
+	key     string
+	topic   string
+	payload string
+}
+
+type eventQueue struct {
+	topic  eventTopic
+	events []*pendingEvent
+	byKey  map[string]*pendingEvent
+	stats  EventTopicStats
+}
+
+type eventBus struct {
+	mu     sync.Mutex
+	sink   EventSink
+	queues map[string]*eventQueue
+	seq    uint64
+	wake   chan struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{queues: make(map[string]*eventQueue), wake: make(chan struct{}, 1)}
+}
+
+var (
+	backendEventBus = newEventBus()
+	eventLoopOnce   sync.Once
+)
+
+func (b *eventBus) signal() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// setSink installs sink. Removing it discards everything but guaranteed
+// events, which wait for the next sink.
+func (b *eventBus) setSink(sink EventSink) {
+	b.mu.Lock()
+	b.sink = sink
+	if sink == nil {
+		for _, q := range b.queues {
+			if q.topic.policy != EventGuaranteed {
+				q.events, q.byKey = nil, nil
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.signal()
+}
+
+// accepts reports whether an event on topic would be queued, so callers can
+// skip encoding the payload.
+func (b *eventBus) accepts(topic string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sink != nil || eventTopicFor(topic).policy == EventGuaranteed
+}
+
+func (b *eventBus) queueLocked(topic string) *eventQueue {
+	q := b.queues[topic]
+	if q == nil {
+		t := eventTopicFor(topic)
+		q = &eventQueue{topic: t, stats: EventTopicStats{Topic: topic, Policy: t.policy, Capacity: t.capacity}}
+		b.queues[topic] = q
+	}
+	return q
+}
+
+// publish queues payload on topic; key groups coalescing events.
+func (b *eventBus) publish(topic, key, payload string) {
+	b.mu.Lock()
+	q := b.queueLocked(topic)
+	if b.sink == nil && q.topic.policy != EventGuaranteed {
+		b.mu.Unlock()
+		return
+	}
+	ev := &pendingEvent{topic: topic, payload: payload}
+	if q.topic.policy == EventCoalesce {
+		ev.key = key
+		if existing := q.byKey[ev.key]; existing != nil {
+			existing.payload = payload
+			q.stats.Coalesced++
+			b.mu.Unlock()
+			return
+		}
+	}
+	if len(q.events) >= q.topic.capacity {
+		delete(q.byKey, q.events[0].key)
+		q.events = q.events[1:]
+		q.stats.Dropped++
+	}
+	b.seq++
+	ev.seq = b.seq
+	q.events = append(q.events, ev)
+	if q.topic.policy == EventCoalesce {
+		if q.byKey == nil {
+			q.byKey = make(map[string]*pendingEvent)
+		}
+		q.byKey[ev.key] = ev
+	}
+	b.mu.Unlock()
+	b.signal()
+}
+
+// pop removes the next event to deliver and returns it with the sink to
+// deliver it to, or nil when nothing can be delivered yet.
+func (b *eventBus) pop() (*pendingEvent, EventSink) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.sink == nil {
+		return nil, nil
+	}
+	var next *eventQueue
+	for _, q := range b.queues {
+		if len(q.events) == 0 {
+			continue
+		}
+		if next == nil {
+			next = q
+			continue
+		}
+		guaranteed, nextGuaranteed := q.topic.policy == EventGuaranteed, next.topic.policy == EventGuaranteed
+		if guaranteed && !nextGuaranteed || guaranteed == nextGuaranteed && q.events[0].seq < next.events[0].seq {
+			next = q
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	ev := next.events[0]
+	next.events = next.events[1:]
+	if next.byKey != nil {
+		delete(next.byKey, ev.key)
+	}
+	return ev, b.sink
+}
+
+// delivered settles ev after sink.OnEvent returned. A guaranteed event goes
+// back to the front of its queue when sink is no longer the current sink,
+// since a removed sink may not have handed it on.
+func (b *eventBus) delivered(ev *pendingEvent, sink EventSink) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.queueLocked(ev.topic)
+	if q.topic.policy == EventGuaranteed && b.sink != sink {
+		q.events = append([]*pendingEvent{ev}, q.events...)
+		return
+	}
+	q.stats.Delivered++
+}
+
+func (b *eventBus) run() {
+	for {
+		ev, sink := b.pop()
+		if ev == nil {
+			<-b.wake
+			continue
+		}
+		sink.OnEvent(ev.topic, ev.payload)
+		b.delivered(ev, sink)
+	}
+}
+
+func (b *eventBus) stats() []EventTopicStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := make([]EventTopicStats, 0, len(b.queues))
+	for _, q := range b.queues {
+		s := q.stats
+		s.Pending = len(q.events)
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Topic < stats[j].Topic })
+	return stats
+}
+
+func (b *eventBus) dropped() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var total int64
+	for _, q := range b.queues {
+		total += q.stats.Dropped
+	}
+	return total
+}
+
+// EventBusStats lists per-topic queue state and counters.
+func EventBusStats() []EventTopicStats {
+	return backendEventBus.stats()
+}
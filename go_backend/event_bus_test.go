@@ -0,0 +1,173 @@
+package gobackend
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []string
+	gate   chan struct{}
+}
+
+func (s *recordingSink) OnEvent(eventType, payloadJSON string) {
+	if s.gate != nil {
+		<-s.gate
+	}
+	s.mu.Lock()
+	s.events = append(s.events, eventType+" "+payloadJSON)
+	s.mu.Unlock()
+}
+
+func (s *recordingSink) drain(t *testing.T, b *eventBus) []string {
+	t.Helper()
+	for {
+		ev, sink := b.pop()
+		if ev == nil {
+			break
+		}
+		sink.OnEvent(ev.topic, ev.payload)
+		b.delivered(ev, sink)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events
+}
+
+func TestEventBusPolicies(t *testing.T) {
+	b := newEventBus()
+
+	// Without a sink only guaranteed events are kept.
+	b.publish("deezer_session", "", `{"state":"expired"}`)
+	b.publish("progress", "a", `{"item_id":"a","progress":0.1}`)
+	b.publish("log", "", `{"message":"lost"}`)
+	if !b.accepts("download") || b.accepts("log") {
+		t.Error("accepts ignores the topic policy")
+	}
+
+	sink := &recordingSink{}
+	b.setSink(sink)
+	for i := 1; i <= 5; i++ {
+		b.publish("progress", "a", fmt.Sprintf(`{"item_id":"a","progress":0.%d}`, i))
+		b.publish("progress", "b", fmt.Sprintf(`{"item_id":"b","progress":0.%d}`, i))
+	}
+	for i := 0; i < 300; i++ {
+		b.publish("log", "", fmt.Sprintf(`{"message":"line %d"}`, i))
+	}
+	b.publish("download", "a", `{"item_id":"a","status":"completed"}`)
+
+	events := sink.drain(t, b)
+	want := []string{
+		`deezer_session {"state":"expired"}`,
+		`download {"item_id":"a","status":"completed"}`,
+		`progress {"item_id":"a","progress":0.5}`,
+		`progress {"item_id":"b","progress":0.5}`,
+		`log {"message":"line 44"}`,
+	}
+	for i, w := range want {
+		if i >= len(events) || events[i] != w {
+			t.Fatalf("event %d = %q, want %q", i, events[min(i, len(events)-1)], w)
+		}
+	}
+	if len(events) != 4+256 || events[len(events)-1] != `log {"message":"line 299"}` {
+		t.Errorf("got %d events, last %q", len(events), events[len(events)-1])
+	}
+
+	stats := make(map[string]EventTopicStats)
+	for _, s := range b.stats() {
+		stats[s.Topic] = s
+	}
+	if s := stats["progress"]; s.Coalesced != 8 || s.Delivered != 2 || s.Pending != 0 {
+		t.Errorf("progress stats = %+v", s)
+	}
+	if s := stats["log"]; s.Dropped != 44 || s.Delivered != 256 || s.Policy != EventDrop {
+		t.Errorf("log stats = %+v", s)
+	}
+	if b.dropped() != 44 {
+		t.Errorf("dropped = %d", b.dropped())
+	}
+}
+
+func TestEventBusSlowSink(t *testing.T) {
+	b := newEventBus()
+	sink := &recordingSink{gate: make(chan struct{})}
+	b.setSink(sink)
+	go b.run()
+
+	// The first event blocks in the sink while the rest pile up.
+	b.publish("progress", "x", `{"item_id":"x","progress":0}`)
+	time.Sleep(20 * time.Millisecond)
+	for i := 1; i <= 100; i++ {
+		b.publish("progress", "x", fmt.Sprintf(`{"item_id":"x","progress":%d}`, i))
+	}
+	b.publish("extension_domain", "", `{"type":"approval_needed"}`)
+
+	close(sink.gate)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		sink.mu.Lock()
+		got := strings.Join(sink.events, "\n")
+		sink.mu.Unlock()
+		if strings.Count(got, "\n") == 2 {
+			want := "progress {\"item_id\":\"x\",\"progress\":0}\n" +
+				"extension_domain {\"type\":\"approval_needed\"}\n" +
+				"progress {\"item_id\":\"x\",\"progress\":100}"
+			if got != want {
+				t.Fatalf("delivered:\n%s", got)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivered so far:\n%s", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEventBusRemovingSinkKeepsGuaranteed(t *testing.T) {
+	b := newEventBus()
+	b.setSink(&recordingSink{})
+	b.publish("network", "", `{"connected":false}`)
+	b.publish("batch", "", `{"batch_id":"1"}`)
+	b.setSink(nil)
+
+	sink := &recordingSink{}
+	b.setSink(sink)
+	if events := sink.drain(t, b); len(events) != 1 || events[0] != `batch {"batch_id":"1"}` {
+		t.Errorf("events = %q", events)
+	}
+}
+
+func TestEventBusRequeuesGuaranteedInFlight(t *testing.T) {
+	b := newEventBus()
+	first := &recordingSink{}
+	b.setSink(first)
+	b.publish("download", "", `{"item_id":"a"}`)
+	b.publish("progress", "a", `{"item_id":"a"}`)
+
+	// The sink goes away while OnEvent runs.
+	ev, sink := b.pop()
+	b.setSink(nil)
+	sink.OnEvent(ev.topic, ev.payload)
+	b.delivered(ev, sink)
+	for _, s := range b.stats() {
+		if s.Topic == "download" && (s.Delivered != 0 || s.Pending != 1) {
+			t.Errorf("in-flight event settled as %+v", s)
+		}
+	}
+
+	second := &recordingSink{}
+	b.setSink(second)
+	if events := second.drain(t, b); len(events) != 1 || events[0] != `download {"item_id":"a"}` {
+		t.Errorf("events = %q", events)
+	}
+	for _, s := range b.stats() {
+		if s.Topic == "download" && s.Delivered != 1 {
+			t.Errorf("download stats = %+v", s)
+		}
+	}
+}
@@ -181,10 +181,19 @@ type DownloadRequest struct {
 	ArtistName           string `json:"artist_name"`
 	AlbumName            string `json:"album_name"`
 	AlbumArtist          string `json:"album_artist"`
+	AlbumType            string `json:"album_type,omitempty"`
+	Compilation          bool   `json:"compilation,omitempty"`
 	CoverURL             string `json:"cover_url"`
+	AnimatedCoverURL     string `json:"animated_cover_url,omitempty"`
 	OutputDir            string `json:"output_dir"`
 	OutputPath           string `json:"output_path,omitempty"`
 	OutputFD             int    `json:"output_fd,omitempty"`
+	MirrorPath           string `json:"mirror_path,omitempty"`
+	MirrorFD             int    `json:"mirror_fd,omitempty"`
+	CollectionID         string `json:"collection_id,omitempty"`
+	CollectionName       string `json:"collection_name,omitempty"`
+	CollectionPosition   int    `json:"collection_position,omitempty"`
+	BatchID              string `json:"batch_id,omitempty"`
 	OutputExt            string `json:"output_ext,omitempty"`
 	FilenameFormat       string `json:"filename_format"`
 	Quality              string `json:"quality"`
@@ -193,6 +202,8 @@ type DownloadRequest struct {
 	EmbedMaxQualityCover bool   `json:"embed_max_quality_cover"`
 	TrackNumber          int    `json:"track_number"`
 	DiscNumber           int    `json:"disc_number"`
+	TotalDiscs           int    `json:"total_discs,omitempty"`
+	DiscSubfolders       bool   `json:"disc_subfolders,omitempty"`
 	TotalTracks          int    `json:"total_tracks"`
 	ReleaseDate          string `json:"release_date"`
 	ItemID               string `json:"item_id"`
@@ -208,6 +219,20 @@ type DownloadRequest struct {
 	UseExtensions        bool   `json:"use_extensions,omitempty"`
 	UseFallback          bool   `json:"use_fallback,omitempty"`
 	SongLinkRegion       string `json:"songlink_region,omitempty"`
+	// MediaType "video" routes an extension download through the music
+	// video pipeline instead of the audio one.
+	MediaType string `json:"media_type,omitempty"`
+
+	Chapters []Chapter `json:"chapters,omitempty"`
+
+	// CoverCandidates are covers of the same release from other sources;
+	// with any set, the cover is picked by the cover_source preference.
+	CoverCandidates []CoverCandidate `json:"cover_candidates,omitempty"`
+
+	// The provider's names from before queue edits; see matchTitle.
+	matchTrackName  string
+	matchArtistName string
+	matchAlbumName  string
 }
 
 type DownloadResponse struct {
@@ -235,6 +260,23 @@ type DownloadResponse struct {
 	SkipMetadataEnrichment bool   `json:"skip_metadata_enrichment,omitempty"`
 	LyricsLRC              string `json:"lyrics_lrc,omitempty"`
 	DecryptionKey          string `json:"decryption_key,omitempty"`
+	Compilation            bool   `json:"compilation,omitempty"`
+	MediaType              string `json:"media_type,omitempty"`
+	DurationMS             int    `json:"duration_ms,omitempty"`
+	MD5                    string `json:"md5,omitempty"`
+	SHA256                 string `json:"sha256,omitempty"`
+	LocalizedError         string `json:"localized_error,omitempty"`
+	LocalizedMessage       string `json:"localized_message,omitempty"`
+
+	// LyricsTags are the secondary lyrics tags (LYRICS:ROMAJI etc.) for Dart
+	// to write next to lyrics_lrc when it tags a non-FLAC file.
+	LyricsTags    map[string]string    `json:"lyrics_tags,omitempty"`
+	Chapters      []Chapter            `json:"chapters,omitempty"`
+	AnimatedCover *AnimatedCoverResult `json:"animated_cover,omitempty"`
+	Mirror        *OutputMirrorResult  `json:"mirror,omitempty"`
+	QC            *AudioQCReport       `json:"qc,omitempty"`
+	Downconverted *DownconvertResult   `json:"downconverted,omitempty"`
+	MobileCopy    *MobileCopyResult    `json:"mobile_copy,omitempty"`
 }
 
 type DownloadResult struct {
@@ -252,6 +294,7 @@ type DownloadResult struct {
 	Label         string
 	Copyright     string
 	LyricsLRC     string
+	LyricsTags    map[string]string
 	DecryptionKey string
 }
 
@@ -313,7 +356,7 @@ func buildDownloadSuccessResponse(
 		copyright = req.Copyright
 	}
 
-	return DownloadResponse{
+	resp := DownloadResponse{
 		Success:          true,
 		Message:          message,
 		FilePath:         filePath,
@@ -334,8 +377,16 @@ func buildDownloadSuccessResponse(
 		Label:            label,
 		Copyright:        copyright,
 		LyricsLRC:        result.LyricsLRC,
+		LyricsTags:       result.LyricsTags,
 		DecryptionKey:    result.DecryptionKey,
+		Compilation:      req.Compilation,
+		Chapters:         req.Chapters,
 	}
+	// Providers report their own names; the user's queue edits win.
+	if patch := getQueuedMetadataPatch(req.ItemID); patch != nil {
+		patch.applyToResponse(&resp)
+	}
+	return resp
 }
 
 func shouldSkipQualityProbe(filePath string) bool {
@@ -416,13 +467,41 @@ func applySongLinkRegionFromRequest(req *DownloadRequest) {
 	SetSongLinkRegion(req.SongLinkRegion)
 }
 
-func DownloadTrack(requestJSON string) (string, error) {
+// applyDiscSubfolder moves directory-based output of multi-disc albums into a
+// per-disc folder (CD1/, CD2/, ...). SAF and explicit output paths are left
+// untouched because Flutter already chose the destination document.
+func applyDiscSubfolder(req *DownloadRequest) {
+	if req == nil || !req.DiscSubfolders || req.TotalDiscs <= 1 || req.DiscNumber <= 0 {
+		return
+	}
+	if req.OutputPath != "" || isFDOutput(req.OutputFD) || req.OutputDir == "" {
+		return
+	}
+
+	subfolder := discSubfolderName(req.DiscNumber)
+	if strings.EqualFold(filepath.Base(req.OutputDir), subfolder) {
+		return
+	}
+	req.OutputDir = filepath.Join(req.OutputDir, subfolder)
+	if err := os.MkdirAll(req.OutputDir, 0755); err != nil {
+		GoLog("[Download] Warning: failed to create disc folder %s: %v\n", req.OutputDir, err)
+	}
+}
+
+func DownloadTrack(requestJSON string) (respJSON string, respErr error) {
 	var req DownloadRequest
 	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
 		return errorResponse("Invalid request: " + err.Error())
 	}
+	if journalJobStarted(req.ItemID, requestJSON) {
+		defer func() { finishJournaledJob(req.ItemID, respJSON, respErr) }()
+	}
 	applySongLinkRegionFromRequest(&req)
+	applyConfigDefaults(&req)
+	applyQueuedMetadataPatch(&req)
+	adoptOutputFD(req.OutputFD, req.ItemID)
 	defer closeOwnedOutputFD(req.OutputFD)
+	defer ReleaseScratchDir(req.ItemID)
 
 	req.TrackName = strings.TrimSpace(req.TrackName)
 	req.ArtistName = strings.TrimSpace(req.ArtistName)
@@ -431,10 +510,15 @@ func DownloadTrack(requestJSON string) (string, error) {
 	req.OutputDir = strings.TrimSpace(req.OutputDir)
 	req.OutputPath = strings.TrimSpace(req.OutputPath)
 	req.OutputExt = strings.TrimSpace(req.OutputExt)
+	applyAlbumFolderReuse(&req)
+	replaced := trashReplacedOutput(&req)
+	defer func() { replaced.settle(respJSON, respErr) }()
 
 	if req.OutputPath == "" && req.OutputFD <= 0 && req.OutputDir != "" {
 		AddAllowedDownloadDir(req.OutputDir)
 	}
+	applyCompilationDetection(&req)
+	applyDiscSubfolder(&req)
 
 	enrichRequestExtendedMetadata(&req)
 
@@ -457,6 +541,7 @@ func DownloadTrack(requestJSON string) (string, error) {
 				DiscNumber:  tidalResult.DiscNumber,
 				ISRC:        tidalResult.ISRC,
 				LyricsLRC:   tidalResult.LyricsLRC,
+				LyricsTags:  tidalResult.LyricsTags,
 			}
 		}
 		err = tidalErr
@@ -475,6 +560,7 @@ func DownloadTrack(requestJSON string) (string, error) {
 				DiscNumber:  qobuzResult.DiscNumber,
 				ISRC:        qobuzResult.ISRC,
 				LyricsLRC:   qobuzResult.LyricsLRC,
+				LyricsTags:  qobuzResult.LyricsTags,
 			}
 		}
 		err = qobuzErr
@@ -493,6 +579,7 @@ func DownloadTrack(requestJSON string) (string, error) {
 				DiscNumber:    amazonResult.DiscNumber,
 				ISRC:          amazonResult.ISRC,
 				LyricsLRC:     amazonResult.LyricsLRC,
+				LyricsTags:    amazonResult.LyricsTags,
 				DecryptionKey: amazonResult.DecryptionKey,
 			}
 		}
@@ -512,6 +599,7 @@ func DownloadTrack(requestJSON string) (string, error) {
 				DiscNumber:  youtubeResult.DiscNumber,
 				ISRC:        youtubeResult.ISRC,
 				LyricsLRC:   youtubeResult.LyricsLRC,
+				LyricsTags:  youtubeResult.LyricsTags,
 			}
 		}
 		err = youtubeErr
@@ -556,11 +644,58 @@ func DownloadTrack(requestJSON string) (string, error) {
 
 // DownloadByStrategy routes a unified download request to the appropriate flow.
 // Routing priority: YouTube service > extension fallback > built-in fallback > direct service.
-func DownloadByStrategy(requestJSON string) (string, error) {
+func DownloadByStrategy(requestJSON string) (respJSON string, err error) {
 	var req DownloadRequest
 	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
 		return errorResponse("Invalid request: " + err.Error())
 	}
+	startDownloadTrace(req.ItemID, map[string]interface{}{
+		"service": req.Service,
+		"track":   req.TrackName,
+		"artist":  req.ArtistName,
+		"isrc":    req.ISRC,
+		"quality": req.Quality,
+	})
+	journaled := journalJobStarted(req.ItemID, requestJSON)
+	registerOutputMirror(req.ItemID, req.MirrorPath, req.MirrorFD)
+	adoptOutputFD(req.MirrorFD, req.ItemID)
+	defer closeOwnedOutputFD(req.MirrorFD)
+	defer forgetAnimatedCover(req.ItemID)
+	defer forgetDownloadHash(req.ItemID)
+	defer func() {
+		if err == nil {
+			finalize := startTraceSpan(req.ItemID, TraceSpanFinalize, nil)
+			journalJobState(req.ItemID, JobFinalizing)
+			respJSON = finishQueuedMetadata(req.ItemID, respJSON)
+			respJSON = downconvertCompletedDownload(req, respJSON)
+			optimizeCompletedFLAC(req, respJSON)
+			respJSON = attachDownloadHashes(req, respJSON)
+			respJSON = attachAudioQC(req, respJSON)
+			respJSON = attachMobileCopy(req, respJSON)
+			respJSON = attachAnimatedCover(req, respJSON)
+			respJSON = runDownloadCompleteHooks(respJSON)
+			respJSON = finishOutputMirror(req, respJSON)
+			syncCompletedDownload(req, respJSON)
+			enqueueCloudUpload(req, respJSON)
+			notifyDownloadFinished(req, respJSON)
+			recordDownloadHistory(req, respJSON)
+			recordListenBrainzDownload(req, respJSON)
+			recordBatchDownload(req, respJSON)
+			finalize.End(nil)
+		}
+		if journaled {
+			finishJournaledJob(req.ItemID, respJSON, err)
+		}
+		if target := takeOutputMirror(req.ItemID); target != nil && target.opened {
+			cleanupOutputOnError(target.path, target.fd)
+		}
+		respJSON = localizeDownloadResponseJSON(respJSON)
+		finishDownloadTraceJSON(req.ItemID, respJSON, err)
+	}()
+
+	if err := waitForDownloadNetwork(req.ItemID); err != nil {
+		return errorResponse(err.Error())
+	}
 
 	serviceRaw := strings.TrimSpace(req.Service)
 	serviceNormalized := strings.ToLower(serviceRaw)
@@ -600,13 +735,20 @@ func DownloadByStrategy(requestJSON string) (string, error) {
 	return DownloadTrack(normalizedJSON)
 }
 
-func DownloadWithFallback(requestJSON string) (string, error) {
+func DownloadWithFallback(requestJSON string) (respJSON string, respErr error) {
 	var req DownloadRequest
 	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
 		return errorResponse("Invalid request: " + err.Error())
 	}
+	if journalJobStarted(req.ItemID, requestJSON) {
+		defer func() { finishJournaledJob(req.ItemID, respJSON, respErr) }()
+	}
 	applySongLinkRegionFromRequest(&req)
+	applyConfigDefaults(&req)
+	applyQueuedMetadataPatch(&req)
+	adoptOutputFD(req.OutputFD, req.ItemID)
 	defer closeOwnedOutputFD(req.OutputFD)
+	defer ReleaseScratchDir(req.ItemID)
 
 	req.TrackName = strings.TrimSpace(req.TrackName)
 	req.ArtistName = strings.TrimSpace(req.ArtistName)
@@ -615,12 +757,19 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 	req.OutputDir = strings.TrimSpace(req.OutputDir)
 	req.OutputPath = strings.TrimSpace(req.OutputPath)
 	req.OutputExt = strings.TrimSpace(req.OutputExt)
+	applyAlbumFolderReuse(&req)
+	replaced := trashReplacedOutput(&req)
+	defer func() { replaced.settle(respJSON, respErr) }()
 
 	if req.OutputPath == "" && req.OutputFD <= 0 && req.OutputDir != "" {
 		AddAllowedDownloadDir(req.OutputDir)
 	}
+	applyCompilationDetection(&req)
+	applyDiscSubfolder(&req)
 
+	search := startTraceSpan(req.ItemID, TraceSpanSearch, map[string]interface{}{"source": "deezer"})
 	enrichRequestExtendedMetadata(&req)
+	search.End(nil)
 
 	allServices := []string{"tidal", "qobuz", "amazon"}
 	preferredService := req.Service
@@ -640,8 +789,18 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 	GoLog("[DownloadWithFallback] Service order: %v\n", services)
 
 	var lastErr error
+	health := GetProviderHealthTracker()
+	// held is the best download that failed audio QC; it is used when no
+	// provider passes, so a track is never lost to QC alone.
+	held := &qcHeldCandidate{}
+	defer held.discard()
 
 	for _, service := range services {
+		if !health.Allow(service) {
+			GoLog("[DownloadWithFallback] Skipping %s (circuit open)\n", service)
+			continue
+		}
+
 		GoLog("[DownloadWithFallback] Trying service: %s\n", service)
 		req.Service = service
 
@@ -664,6 +823,7 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 					DiscNumber:  tidalResult.DiscNumber,
 					ISRC:        tidalResult.ISRC,
 					LyricsLRC:   tidalResult.LyricsLRC,
+					LyricsTags:  tidalResult.LyricsTags,
 				}
 			} else if !errors.Is(tidalErr, ErrDownloadCancelled) {
 				GoLog("[DownloadWithFallback] Tidal error: %v\n", tidalErr)
@@ -684,6 +844,7 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 					DiscNumber:  qobuzResult.DiscNumber,
 					ISRC:        qobuzResult.ISRC,
 					LyricsLRC:   qobuzResult.LyricsLRC,
+					LyricsTags:  qobuzResult.LyricsTags,
 				}
 			} else if !errors.Is(qobuzErr, ErrDownloadCancelled) {
 				GoLog("[DownloadWithFallback] Qobuz error: %v\n", qobuzErr)
@@ -704,6 +865,7 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 					DiscNumber:    amazonResult.DiscNumber,
 					ISRC:          amazonResult.ISRC,
 					LyricsLRC:     amazonResult.LyricsLRC,
+					LyricsTags:    amazonResult.LyricsTags,
 					DecryptionKey: amazonResult.DecryptionKey,
 				}
 			} else if !errors.Is(amazonErr, ErrDownloadCancelled) {
@@ -712,6 +874,8 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 			err = amazonErr
 		}
 
+		health.RecordOutcome(service, err)
+
 		if err != nil && errors.Is(err, ErrDownloadCancelled) {
 			return errorResponse("Download cancelled")
 		}
@@ -733,6 +897,20 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 				return string(jsonBytes), nil
 			}
 
+			var qc *AudioQCReport
+			if audioQCPolicy() == AudioQCRedownload {
+				qc = qcDownloadedFile(req, result.FilePath)
+				if qc != nil && qc.Status == QCStatusFailed {
+					lastErr = fmt.Errorf("%s failed audio QC: %s", service, strings.Join(qc.Summary(), ", "))
+					if held.keep(service, result, qc) {
+						GoLog("[DownloadWithFallback] %s failed audio QC, trying next service\n", service)
+						continue
+					}
+					GoLog("[DownloadWithFallback] %s failed audio QC but could not be set aside; keeping it\n", service)
+				}
+			}
+			held.discard()
+
 			enrichResultQualityFromFile(&result)
 
 			resp := buildDownloadSuccessResponse(
@@ -743,6 +921,7 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 				result.FilePath,
 				false,
 			)
+			resp.QC = qc
 			jsonBytes, _ := json.Marshal(resp)
 			return string(jsonBytes), nil
 		}
@@ -750,6 +929,18 @@ func DownloadWithFallback(requestJSON string) (string, error) {
 		lastErr = err
 	}
 
+	if result, service, qc, ok := held.restore(); ok {
+		GoLog("[DownloadWithFallback] No service passed audio QC, keeping the best file from %s\n", service)
+		enrichResultQualityFromFile(&result)
+		resp := buildDownloadSuccessResponse(req, result, service, "Downloaded from "+service+" (failed audio QC)", result.FilePath, false)
+		resp.QC = qc
+		jsonBytes, _ := json.Marshal(resp)
+		return string(jsonBytes), nil
+	}
+
+	if lastErr == nil {
+		return errorResponse("All services temporarily unavailable (circuit breaker open)")
+	}
 	return errorResponse("All services failed. Last error: " + lastErr.Error())
 }
 
@@ -797,6 +988,8 @@ func ReadFileMetadata(filePath string) (string, error) {
 		"date":         "",
 		"track_number": 0,
 		"disc_number":  0,
+		"disc_total":   0,
+		"compilation":  false,
 		"isrc":         "",
 		"lyrics":       "",
 		"genre":        "",
@@ -819,6 +1012,8 @@ func ReadFileMetadata(filePath string) (string, error) {
 		result["date"] = metadata.Date
 		result["track_number"] = metadata.TrackNumber
 		result["disc_number"] = metadata.DiscNumber
+		result["disc_total"] = metadata.TotalDiscs
+		result["compilation"] = metadata.Compilation
 		result["isrc"] = metadata.ISRC
 		result["lyrics"] = metadata.Lyrics
 		result["genre"] = metadata.Genre
@@ -888,6 +1083,12 @@ func ReadFileMetadata(filePath string) (string, error) {
 		return "", fmt.Errorf("unsupported file format: %s", filePath)
 	}
 
+	if !isOgg {
+		if chapters, err := ReadChapters(filePath); err == nil && len(chapters) > 0 {
+			result["chapters"] = chapters
+		}
+	}
+
 	jsonBytes, err := json.Marshal(result)
 	if err != nil {
 		return "", err
@@ -1054,7 +1255,7 @@ func GetLyricsLRC(spotifyID, trackName, artistName string, filePath string, dura
 		return "[instrumental:true]", nil
 	}
 
-	lrcContent := convertToLRCWithMetadata(lyricsData, trackName, artistName)
+	lrcContent, _ := renderLyricsForEmbed(lyricsData, trackName, artistName)
 	return lrcContent, nil
 }
 
@@ -1096,10 +1297,11 @@ func GetLyricsLRCWithSource(spotifyID, trackName, artistName string, filePath st
 	}
 
 	lrcContent := ""
+	var extraTags map[string]string
 	if lyricsData.Instrumental {
 		lrcContent = "[instrumental:true]"
 	} else {
-		lrcContent = convertToLRCWithMetadata(lyricsData, trackName, artistName)
+		lrcContent, extraTags = renderLyricsForEmbed(lyricsData, trackName, artistName)
 	}
 
 	result := map[string]interface{}{
@@ -1108,6 +1310,9 @@ func GetLyricsLRCWithSource(spotifyID, trackName, artistName string, filePath st
 		"sync_type":    lyricsData.SyncType,
 		"instrumental": lyricsData.Instrumental,
 	}
+	if len(extraTags) > 0 {
+		result["lyrics_tags"] = extraTags
+	}
 	jsonBytes, err := json.Marshal(result)
 	if err != nil {
 		return "", err
@@ -1588,13 +1793,20 @@ func errorResponse(msg string) (string, error) {
 	return string(jsonBytes), nil
 }
 
-func DownloadFromYouTube(requestJSON string) (string, error) {
+func DownloadFromYouTube(requestJSON string) (respJSON string, respErr error) {
 	var req DownloadRequest
 	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
 		return errorResponse("Invalid request: " + err.Error())
 	}
+	if journalJobStarted(req.ItemID, requestJSON) {
+		defer func() { finishJournaledJob(req.ItemID, respJSON, respErr) }()
+	}
 	applySongLinkRegionFromRequest(&req)
+	applyConfigDefaults(&req)
+	applyQueuedMetadataPatch(&req)
+	adoptOutputFD(req.OutputFD, req.ItemID)
 	defer closeOwnedOutputFD(req.OutputFD)
+	defer ReleaseScratchDir(req.ItemID)
 
 	req.TrackName = strings.TrimSpace(req.TrackName)
 	req.ArtistName = strings.TrimSpace(req.ArtistName)
@@ -1603,10 +1815,15 @@ func DownloadFromYouTube(requestJSON string) (string, error) {
 	req.OutputDir = strings.TrimSpace(req.OutputDir)
 	req.OutputPath = strings.TrimSpace(req.OutputPath)
 	req.OutputExt = strings.TrimSpace(req.OutputExt)
+	applyAlbumFolderReuse(&req)
+	replaced := trashReplacedOutput(&req)
+	defer func() { replaced.settle(respJSON, respErr) }()
 
 	if req.OutputPath == "" && req.OutputFD <= 0 && req.OutputDir != "" {
 		AddAllowedDownloadDir(req.OutputDir)
 	}
+	applyCompilationDetection(&req)
+	applyDiscSubfolder(&req)
 
 	youtubeResult, err := downloadFromYouTube(req)
 	if err != nil {
@@ -1626,6 +1843,7 @@ func DownloadFromYouTube(requestJSON string) (string, error) {
 		DiscNumber:  youtubeResult.DiscNumber,
 		ISRC:        youtubeResult.ISRC,
 		LyricsLRC:   youtubeResult.LyricsLRC,
+		LyricsTags:  youtubeResult.LyricsTags,
 		CoverURL:    req.CoverURL,
 		Genre:       req.Genre,
 		Label:       req.Label,
@@ -1662,6 +1880,47 @@ func DownloadCoverToFile(coverURL string, outputPath string, maxQuality bool) er
 	return nil
 }
 
+// SelectBestCoverJSON probes each candidate cover and returns the selected one
+// plus the per-candidate probe results.
+// candidatesJSON: [{"source":"spotify","url":"..."}, ...]
+func SelectBestCoverJSON(candidatesJSON string) (string, error) {
+	var candidates []CoverCandidate
+	if err := json.Unmarshal([]byte(candidatesJSON), &candidates); err != nil {
+		return "", fmt.Errorf("invalid candidates: %w", err)
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no cover candidates provided")
+	}
+
+	best, results := SelectBestCover(candidates)
+	response := map[string]interface{}{
+		"candidates": results,
+	}
+	if best != nil {
+		response["selected"] = best
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// SetCoverSourcePreferenceJSON sets the cover_source config value from
+// {"cover_source": "largest"|"spotify"|"deezer"|"provider"}.
+func SetCoverSourcePreferenceJSON(preferenceJSON string) error {
+	var p struct {
+		CoverSource string `json:"cover_source"`
+	}
+	if err := json.Unmarshal([]byte(preferenceJSON), &p); err != nil {
+		return fmt.Errorf("invalid cover preference: %w", err)
+	}
+	cfg := GetBackendConfig()
+	cfg.CoverSource = p.CoverSource
+	return UpdateBackendConfig(cfg)
+}
+
 func ExtractCoverToFile(audioPath string, outputPath string) error {
 	lower := strings.ToLower(audioPath)
 
@@ -1703,7 +1962,7 @@ func FetchAndSaveLyrics(trackName, artistName, spotifyID string, durationMs int6
 		return fmt.Errorf("track is instrumental, no lyrics available")
 	}
 
-	lrcContent := convertToLRCWithMetadata(lyrics, trackName, artistName)
+	lrcContent, _ := renderLyricsForEmbed(lyrics, trackName, artistName)
 	if lrcContent == "" {
 		return fmt.Errorf("failed to generate LRC content")
 	}
@@ -1949,7 +2208,7 @@ func ReEnrichFile(requestJSON string) (string, error) {
 			// MP3/Opus requires a real image file path for Dart FFmpeg.
 			// FLAC uses in-memory embed and does not require temp files.
 			if !isFlac {
-				tmpFile, err := os.CreateTemp("", "reenrich_cover_*.jpg")
+				tmpFile, err := createScratchTemp("reenrich_cover_*.jpg")
 				if err != nil {
 					fallbackDir := filepath.Dir(req.FilePath)
 					if fallbackDir == "" || fallbackDir == "." {
@@ -1989,6 +2248,7 @@ func ReEnrichFile(requestJSON string) (string, error) {
 
 	// Fetch lyrics
 	var lyricsLRC string
+	var lyricsTags map[string]string
 	if req.EmbedLyrics {
 		client := NewLyricsClient()
 		durationSec := float64(req.DurationMs) / 1000.0
@@ -1996,7 +2256,7 @@ func ReEnrichFile(requestJSON string) (string, error) {
 		if err != nil {
 			GoLog("[ReEnrich] Lyrics not found: %v\n", err)
 		} else if !lyrics.Instrumental {
-			lyricsLRC = convertToLRCWithMetadata(lyrics, req.TrackName, req.ArtistName)
+			lyricsLRC, lyricsTags = renderLyricsForEmbed(lyrics, req.TrackName, req.ArtistName)
 			GoLog("[ReEnrich] Lyrics fetched: %d lines\n", len(lyrics.Lines))
 		} else {
 			GoLog("[ReEnrich] Track is instrumental\n")
@@ -2047,6 +2307,11 @@ func ReEnrichFile(requestJSON string) (string, error) {
 				return "", fmt.Errorf("failed to embed metadata: %w", err)
 			}
 		}
+		if len(lyricsTags) > 0 {
+			if err := EmbedLyricsTags(req.FilePath, lyricsTags); err != nil {
+				GoLog("[ReEnrich] Failed to embed secondary lyrics: %v\n", err)
+			}
+		}
 		if len(coverDataBytes) > 0 {
 			embeddedCover, err := ExtractCoverArt(req.FilePath)
 			if err != nil || len(embeddedCover) == 0 {
@@ -2103,6 +2368,9 @@ func ReEnrichFile(requestJSON string) (string, error) {
 		result["metadata"].(map[string]string)["LYRICS"] = lyricsLRC
 		result["metadata"].(map[string]string)["UNSYNCEDLYRICS"] = lyricsLRC
 	}
+	for tag, value := range lyricsTags {
+		result["metadata"].(map[string]string)[tag] = value
+	}
 
 	jsonBytes, _ := json.Marshal(result)
 	return string(jsonBytes), nil
@@ -2283,12 +2551,18 @@ func SetExtensionSettingsJSON(extensionID, settingsJSON string) error {
 		return err
 	}
 
+	manager := GetExtensionManager()
+	if ext, err := manager.GetExtension(extensionID); err == nil {
+		if err := moveSecretSettings(ext, settings, false); err != nil {
+			return err
+		}
+	}
+
 	store := GetExtensionSettingsStore()
 	if err := store.SetAll(extensionID, settings); err != nil {
 		return err
 	}
 
-	manager := GetExtensionManager()
 	return manager.InitializeExtension(extensionID, settings)
 }
 
@@ -2307,13 +2581,20 @@ func SearchTracksWithExtensionsJSON(query string, limit int) (string, error) {
 	return string(jsonBytes), nil
 }
 
-func DownloadWithExtensionsJSON(requestJSON string) (string, error) {
+func DownloadWithExtensionsJSON(requestJSON string) (respJSON string, respErr error) {
 	var req DownloadRequest
 	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
 		return "", fmt.Errorf("invalid request: %w", err)
 	}
+	if journalJobStarted(req.ItemID, requestJSON) {
+		defer func() { finishJournaledJob(req.ItemID, respJSON, respErr) }()
+	}
 	applySongLinkRegionFromRequest(&req)
+	applyConfigDefaults(&req)
+	applyQueuedMetadataPatch(&req)
+	adoptOutputFD(req.OutputFD, req.ItemID)
 	defer closeOwnedOutputFD(req.OutputFD)
+	defer ReleaseScratchDir(req.ItemID)
 
 	req.TrackName = strings.TrimSpace(req.TrackName)
 	req.ArtistName = strings.TrimSpace(req.ArtistName)
@@ -2322,11 +2603,22 @@ func DownloadWithExtensionsJSON(requestJSON string) (string, error) {
 	req.OutputDir = strings.TrimSpace(req.OutputDir)
 	req.OutputPath = strings.TrimSpace(req.OutputPath)
 	req.OutputExt = strings.TrimSpace(req.OutputExt)
+	applyAlbumFolderReuse(&req)
+	replaced := trashReplacedOutput(&req)
+	defer func() { replaced.settle(respJSON, respErr) }()
 	if req.OutputPath == "" && req.OutputFD <= 0 && req.OutputDir != "" {
 		AddAllowedDownloadDir(req.OutputDir)
 	}
+	applyCompilationDetection(&req)
+	applyDiscSubfolder(&req)
 
-	result, err := DownloadWithExtensionFallback(req)
+	var result *DownloadResponse
+	var err error
+	if req.MediaType == MediaTypeVideo {
+		result, err = downloadVideoWithExtension(req)
+	} else {
+		result, err = DownloadWithExtensionFallback(req)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -2344,6 +2636,18 @@ func CleanupExtensions() {
 	manager.UnloadAllExtensions()
 }
 
+func SetMaxConcurrentExtensions(max int) {
+	GetExtensionScheduler().SetMaxConcurrent(max)
+}
+
+func GetMaxConcurrentExtensions() int {
+	return GetExtensionScheduler().MaxConcurrent()
+}
+
+func GetExtensionSchedulerStatsJSON() (string, error) {
+	return GetExtensionScheduler().StatsJSON()
+}
+
 func InvokeExtensionActionJSON(extensionID, actionName string) (string, error) {
 	manager := GetExtensionManager()
 	result, err := manager.InvokeAction(extensionID, actionName)
@@ -2365,13 +2669,7 @@ func GetExtensionPendingAuthJSON(extensionID string) (string, error) {
 		return "", nil
 	}
 
-	result := map[string]interface{}{
-		"extension_id": req.ExtensionID,
-		"auth_url":     req.AuthURL,
-		"callback_url": req.CallbackURL,
-	}
-
-	jsonBytes, err := json.Marshal(result)
+	jsonBytes, err := json.Marshal(req)
 	if err != nil {
 		return "", err
 	}
@@ -2411,24 +2709,35 @@ func IsExtensionAuthenticatedByID(extensionID string) bool {
 	return state.IsAuthenticated
 }
 
+// GetAllPendingAuthRequestsJSON lists pending auth prompts, oldest first.
 func GetAllPendingAuthRequestsJSON() (string, error) {
-	pendingAuthRequestsMu.RLock()
-	defer pendingAuthRequestsMu.RUnlock()
-
-	requests := make([]map[string]interface{}, 0, len(pendingAuthRequests))
-	for _, req := range pendingAuthRequests {
-		requests = append(requests, map[string]interface{}{
-			"extension_id": req.ExtensionID,
-			"auth_url":     req.AuthURL,
-			"callback_url": req.CallbackURL,
-		})
+	jsonBytes, err := json.Marshal(ListPendingAuthRequests())
+	if err != nil {
+		return "", err
 	}
 
-	jsonBytes, err := json.Marshal(requests)
+	return string(jsonBytes), nil
+}
+
+// ConsumeAuthRequestJSON takes request id off the auth queue and returns it.
+func ConsumeAuthRequestJSON(id string) (string, error) {
+	req, err := ConsumeAuthRequest(id)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(req)
 	if err != nil {
 		return "", err
 	}
+	return string(jsonBytes), nil
+}
 
+// GetAuthFlowStatusJSON returns the latest auth flow of extensionID.
+func GetAuthFlowStatusJSON(extensionID string) (string, error) {
+	jsonBytes, err := json.Marshal(GetAuthFlowStatus(extensionID))
+	if err != nil {
+		return "", err
+	}
 	return string(jsonBytes), nil
 }
 
@@ -2660,6 +2969,9 @@ func HandleURLWithExtensionJSON(url string) (string, error) {
 			"album_type":   result.Album.AlbumType,
 			"provider_id":  result.Album.ProviderID,
 		}
+		if len(result.Album.Assets) > 0 {
+			response["album"].(map[string]interface{})["assets"] = result.Album.Assets
+		}
 	}
 
 	if result.Artist != nil {
@@ -2800,6 +3112,9 @@ func GetAlbumWithExtensionJSON(extensionID, albumID string) (string, error) {
 		"tracks":       tracks,
 		"provider_id":  album.ProviderID,
 	}
+	if len(album.Assets) > 0 {
+		response["assets"] = album.Assets
+	}
 
 	jsonBytes, err := json.Marshal(response)
 	if err != nil {
@@ -3195,10 +3510,11 @@ func callExtensionFunctionJSON(extensionID, functionName string, timeout time.Du
 		return "", fmt.Errorf("extension '%s' is disabled", extensionID)
 	}
 
-	// Goja runtime is not thread-safe; guard direct extension.*() calls with VMMu
-	// to avoid races with other provider calls (e.g. getAlbum/getPlaylist).
-	ext.VMMu.Lock()
-	defer ext.VMMu.Unlock()
+	// Goja runtime is not thread-safe; go through the scheduler so direct
+	// extension.*() calls are serialized with other provider calls (e.g.
+	// getAlbum/getPlaylist) on the same VM.
+	release := acquireExtensionVM(ext)
+	defer release()
 
 	script := fmt.Sprintf(`
 		(function() {
@@ -0,0 +1,94 @@
+package gobackend
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Extension runtime API version ====================
+//
+// Extensions declare the runtime API they were written against with
+// "apiVersion" in manifest.json; a manifest without it targets version 1.
+// The runtime accepts anything from minExtensionRuntimeAPIVersion up to its
+// own version and keeps shims for the older ones, so the app and the store
+// can hide packages this build cannot run instead of failing at install.
+//
+// Versions:
+//
+//	1  extensions assigned a global `extension` object
+//	2  extensions must call registerExtension(); gobackend.apiVersion added
+
+const (
+	ExtensionRuntimeAPIVersion    = 2
+	minExtensionRuntimeAPIVersion = 1
+)
+
+// GetRuntimeAPIVersion returns the newest extension API this build runs.
+func GetRuntimeAPIVersion() int {
+	return ExtensionRuntimeAPIVersion
+}
+
+// GetMinRuntimeAPIVersion returns the oldest extension API still shimmed.
+func GetMinRuntimeAPIVersion() int {
+	return minExtensionRuntimeAPIVersion
+}
+
+// isExtensionAPIVersionSupported reports whether a manifest or store entry
+// targeting version can run here. 0 means undeclared, i.e. version 1.
+func isExtensionAPIVersionSupported(version int) bool {
+	if version == 0 {
+		version = 1
+	}
+	return version >= minExtensionRuntimeAPIVersion && version <= ExtensionRuntimeAPIVersion
+}
+
+// TargetAPIVersion is the declared apiVersion, defaulting to 1.
+func (m *ExtensionManifest) TargetAPIVersion() int {
+	if m.APIVersion == 0 {
+		return 1
+	}
+	return m.APIVersion
+}
+
+func validateExtensionAPIVersion(version int) error {
+	if version < 0 {
+		return &ManifestValidationError{Field: "apiVersion", Message: "apiVersion must be positive"}
+	}
+	if !isExtensionAPIVersionSupported(version) {
+		return &ManifestValidationError{
+			Field: "apiVersion",
+			Message: fmt.Sprintf("extension targets runtime API v%d, this app supports v%d to v%d",
+				version, minExtensionRuntimeAPIVersion, ExtensionRuntimeAPIVersion),
+		}
+	}
+	return nil
+}
+
+// registerAPIVersion exposes both versions to the extension so code shared
+// across versions can feature-test.
+func (r *ExtensionRuntime) registerAPIVersion(vm *goja.Runtime) {
+	obj := vm.Get("gobackend")
+	if obj == nil || goja.IsUndefined(obj) {
+		return
+	}
+	gobackendObj := obj.ToObject(vm)
+	gobackendObj.Set("apiVersion", r.manifest.TargetAPIVersion())
+	gobackendObj.Set("runtimeApiVersion", ExtensionRuntimeAPIVersion)
+}
+
+// legacyRegisteredExtension is the v1 shim: before registerExtension()
+// existed, index.js assigned the extension object to a global.
+func legacyRegisteredExtension(vm *goja.Runtime, manifest *ExtensionManifest) goja.Value {
+	if manifest.TargetAPIVersion() >= 2 {
+		return nil
+	}
+	value := vm.Get("extension")
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return nil
+	}
+	if _, ok := value.(*goja.Object); !ok {
+		return nil
+	}
+	return value
+}
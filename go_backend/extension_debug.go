@@ -0,0 +1,350 @@
+package gobackend
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Extension debug bridge ====================
+//
+// An opt-in HTTP server on 127.0.0.1 that lets an extension developer poke a
+// running runtime from their desktop (adb forward tcp:PORT tcp:PORT). There
+// are no breakpoints; it offers:
+//
+//	GET  /extensions                  loaded extensions and their state
+//	POST /eval     {extension_id, expression}
+//	GET  /vars?extension_id=ID        globals and the extension object's members
+//	GET  /errors?extension_id=ID      GetExtensionErrors
+//	GET  /logs?extension_id=ID        server-sent events, one log entry each
+//
+// Every request needs the session token, as "Authorization: Bearer TOKEN" or
+// ?token=TOKEN. Eval runs inside the extension's sandbox under its VM lock,
+// exactly like a provider call.
+
+const (
+	defaultExtensionDebugPort = 9229
+	maxDebugEvalBytes         = 64 << 10
+	maxDebugPreviewLength     = 200
+)
+
+type ExtensionDebugStatus struct {
+	Running bool   `json:"running"`
+	Address string `json:"address,omitempty"`
+	Token   string `json:"token,omitempty"`
+	Started int64  `json:"started,omitempty"`
+}
+
+var (
+	extensionDebugMu      sync.Mutex
+	extensionDebugServer  *http.Server
+	extensionDebugStatus  ExtensionDebugStatus
+	extensionDebugLogging bool
+)
+
+func newDebugToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// StartExtensionDebugServer listens on 127.0.0.1:port (0 picks the default)
+// and returns the address and session token. Logging is switched on while
+// the bridge runs so /logs sees everything.
+func StartExtensionDebugServer(port int) (*ExtensionDebugStatus, error) {
+	if port == 0 {
+		port = defaultExtensionDebugPort
+	}
+	if port < 1024 || port > 65535 {
+		return nil, fmt.Errorf("debug port must be between 1024 and 65535")
+	}
+
+	extensionDebugMu.Lock()
+	defer extensionDebugMu.Unlock()
+	if extensionDebugServer != nil {
+		return nil, fmt.Errorf("extension debug bridge is already running on %s", extensionDebugStatus.Address)
+	}
+
+	token, err := newDebugToken()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start debug bridge: %w", err)
+	}
+
+	server := &http.Server{
+		Handler:           newExtensionDebugHandler(token),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	extensionDebugServer = server
+	extensionDebugStatus = ExtensionDebugStatus{
+		Running: true,
+		Address: listener.Addr().String(),
+		Token:   token,
+		Started: time.Now().Unix(),
+	}
+	extensionDebugLogging = GetLogBuffer().IsLoggingEnabled()
+	GetLogBuffer().SetLoggingEnabled(true)
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			GoLog("[ExtensionDebug] Server stopped: %v\n", err)
+		}
+	}()
+	GoLog("[ExtensionDebug] Listening on %s\n", extensionDebugStatus.Address)
+
+	status := extensionDebugStatus
+	return &status, nil
+}
+
+func StopExtensionDebugServer() error {
+	extensionDebugMu.Lock()
+	server := extensionDebugServer
+	extensionDebugServer = nil
+	extensionDebugStatus = ExtensionDebugStatus{}
+	restoreLogging := extensionDebugLogging
+	extensionDebugMu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	GetLogBuffer().SetLoggingEnabled(restoreLogging)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		// /logs streams never finish on their own.
+		return server.Close()
+	}
+	GoLog("[ExtensionDebug] Stopped\n")
+	return nil
+}
+
+func GetExtensionDebugStatus() ExtensionDebugStatus {
+	extensionDebugMu.Lock()
+	defer extensionDebugMu.Unlock()
+	return extensionDebugStatus
+}
+
+func newExtensionDebugHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /extensions", debugListExtensions)
+	mux.HandleFunc("POST /eval", debugEval)
+	mux.HandleFunc("GET /vars", debugVars)
+	mux.HandleFunc("GET /errors", func(w http.ResponseWriter, r *http.Request) {
+		writeDebugJSON(w, http.StatusOK, GetExtensionErrors(r.URL.Query().Get("extension_id")))
+	})
+	mux.HandleFunc("GET /logs", debugStreamLogs)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			provided = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			writeDebugJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid debug token"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeDebugJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func debugListExtensions(w http.ResponseWriter, r *http.Request) {
+	type info struct {
+		ID      string         `json:"id"`
+		Version string         `json:"version"`
+		Enabled bool           `json:"enabled"`
+		Error   string         `json:"error,omitempty"`
+		Trust   ExtensionTrust `json:"trust"`
+	}
+	list := []info{}
+	for _, ext := range GetExtensionManager().GetAllExtensions() {
+		list = append(list, info{ext.ID, ext.Manifest.Version, ext.Enabled, ext.Error, ext.Trust})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	writeDebugJSON(w, http.StatusOK, list)
+}
+
+func debugExtension(w http.ResponseWriter, id string) *LoadedExtension {
+	ext, err := GetExtensionManager().GetExtension(id)
+	if err == nil && ext.VM == nil {
+		err = fmt.Errorf("extension has no running VM")
+	}
+	if err != nil {
+		writeDebugJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return nil
+	}
+	return ext
+}
+
+func debugEval(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ExtensionID string `json:"extension_id"`
+		Expression  string `json:"expression"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDebugEvalBytes)).Decode(&req); err != nil {
+		writeDebugJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request: " + err.Error()})
+		return
+	}
+	ext := debugExtension(w, req.ExtensionID)
+	if ext == nil {
+		return
+	}
+
+	release := acquireExtensionVM(ext)
+	defer release()
+
+	logExtension(ext.ID, "DEBUG", "debug eval: "+req.Expression)
+	value, err := RunWithTimeoutAndRecover(ext.VM, req.Expression, DefaultJSTimeout)
+	if err != nil {
+		writeDebugJSON(w, http.StatusOK, map[string]interface{}{"ok": false, "error": err.Error()})
+		return
+	}
+	writeDebugJSON(w, http.StatusOK, map[string]interface{}{
+		"ok":     true,
+		"type":   debugTypeOf(value),
+		"result": debugExport(value),
+	})
+}
+
+func debugTypeOf(v goja.Value) string {
+	switch {
+	case v == nil || goja.IsUndefined(v):
+		return "undefined"
+	case goja.IsNull(v):
+		return "null"
+	}
+	if obj, ok := v.(*goja.Object); ok {
+		if _, isFn := goja.AssertFunction(obj); isFn {
+			return "function"
+		}
+		return "object"
+	}
+	switch v.Export().(type) {
+	case int64, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	}
+	return "other"
+}
+
+// debugExport returns v as something encoding/json can write. Values that
+// do not round-trip (functions, cycles, Go objects) come back as a preview.
+func debugExport(v goja.Value) interface{} {
+	if v == nil || goja.IsUndefined(v) || goja.IsNull(v) {
+		return nil
+	}
+	exported := v.Export()
+	if _, err := json.Marshal(exported); err == nil {
+		return exported
+	}
+	return debugPreview(v)
+}
+
+func debugPreview(v goja.Value) string {
+	if debugTypeOf(v) == "function" {
+		return "[function]"
+	}
+	s := v.String()
+	if len(s) > maxDebugPreviewLength {
+		s = s[:maxDebugPreviewLength] + "…"
+	}
+	return s
+}
+
+type debugVariable struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Preview string `json:"preview"`
+}
+
+func debugDumpObject(obj *goja.Object) []debugVariable {
+	keys := obj.Keys()
+	sort.Strings(keys)
+	vars := make([]debugVariable, 0, len(keys))
+	for _, key := range keys {
+		value := obj.Get(key)
+		vars = append(vars, debugVariable{Name: key, Type: debugTypeOf(value), Preview: debugPreview(value)})
+	}
+	return vars
+}
+
+func debugVars(w http.ResponseWriter, r *http.Request) {
+	ext := debugExtension(w, r.URL.Query().Get("extension_id"))
+	if ext == nil {
+		return
+	}
+
+	release := acquireExtensionVM(ext)
+	defer release()
+
+	result := map[string]interface{}{
+		"globals": debugDumpObject(ext.VM.GlobalObject()),
+	}
+	if value := ext.VM.Get("extension"); value != nil && !goja.IsUndefined(value) && !goja.IsNull(value) {
+		result["extension"] = debugDumpObject(value.ToObject(ext.VM))
+	}
+	writeDebugJSON(w, http.StatusOK, result)
+}
+
+// debugStreamLogs sends new log entries as server-sent events until the
+// client disconnects or the bridge stops.
+func debugStreamLogs(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeDebugJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming unsupported"})
+		return
+	}
+	extensionID := r.URL.Query().Get("extension_id")
+
+	entries, unsubscribe := GetLogBuffer().Subscribe(256)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case entry, ok := <-entries:
+			if !ok {
+				return
+			}
+			if extensionID != "" && entry.Extension != extensionID {
+				continue
+			}
+			data, _ := json.Marshal(entry)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
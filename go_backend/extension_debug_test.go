@@ -0,0 +1,77 @@
+package gobackend
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExtensionDebugBridge(t *testing.T) {
+	ext, err := loadErrorTestExtension(t, "debug-ext", `var counter = 41;
+registerExtension({ bump: function () { counter++; return counter; } });`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext.Enabled = true
+	manager := GetExtensionManager()
+	manager.mu.Lock()
+	manager.extensions[ext.ID] = ext
+	manager.mu.Unlock()
+	defer func() {
+		manager.mu.Lock()
+		delete(manager.extensions, ext.ID)
+		manager.mu.Unlock()
+	}()
+
+	server := httptest.NewServer(newExtensionDebugHandler("secret"))
+	defer server.Close()
+	defer server.CloseClientConnections()
+
+	do := func(method, path, body string) (*http.Response, map[string]interface{}) {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp, out
+	}
+
+	if resp, err := http.Get(server.URL + "/extensions"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("request without token must be rejected, got %v %v", resp.StatusCode, err)
+	}
+
+	_, out := do("POST", "/eval", `{"extension_id":"debug-ext","expression":"extension.bump()"}`)
+	if out["ok"] != true || out["result"] != float64(42) {
+		t.Fatalf("eval returned %v", out)
+	}
+
+	_, out = do("GET", "/vars?extension_id=debug-ext", "")
+	globals, _ := json.Marshal(out["globals"])
+	if !strings.Contains(string(globals), `{"name":"counter","preview":"42","type":"number"}`) {
+		t.Errorf("counter missing from globals: %s", globals)
+	}
+
+	logging := GetLogBuffer().IsLoggingEnabled()
+	GetLogBuffer().SetLoggingEnabled(true)
+	defer GetLogBuffer().SetLoggingEnabled(logging)
+
+	req, _ := http.NewRequest("GET", server.URL+"/logs?extension_id=debug-ext&token=secret", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	logExtension("other-ext", "INFO", "not for this stream")
+	logExtension("debug-ext", "INFO", "hello from debug-ext")
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	if !strings.HasPrefix(line, "data: ") || !strings.Contains(line, "hello from debug-ext") {
+		t.Errorf("unexpected log event %q", line)
+	}
+}
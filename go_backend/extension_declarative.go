@@ -0,0 +1,552 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Declarative providers ====================
+//
+// Many sources are just "search endpoint + stream URL template + headers".
+// Such an extension can ship provider.json instead of index.js and the
+// runtime builds the extension object natively:
+//
+//	{
+//	  "headers": {"Accept": "application/json"},
+//	  "auth": {"header": "Authorization", "value": "Bearer {setting.token}"},
+//	  "search": {
+//	    "url": "https://api.example.com/search?q={query}&limit={limit}",
+//	    "results": "$.data.tracks[*]",
+//	    "fields": {"id": "$.id", "name": "$.title", "artists": "$.artists[*].name"}
+//	  },
+//	  "track": {"url": "https://api.example.com/tracks/{id}", "results": "$.data", "fields": {...}},
+//	  "download": {"url": "https://cdn.example.com/{id}/{quality}.flac", "format": "flac"}
+//	}
+//
+// Templates take {query}, {limit}, {id}, {quality}, {setting.KEY} and
+// {credential.KEY}; values are URL-escaped inside URLs. Paths use the same
+// JSONPath subset as http.fetchJSON, plus [*] to collect every element of an
+// array. Requests go through the same domain sandbox, trust gate and header
+// profiles as http.get from JS.
+
+const (
+	declarativeProviderFile    = "provider.json"
+	maxDeclarativeResponseSize = 8 << 20
+)
+
+type DeclarativeProvider struct {
+	Headers  map[string]string    `json:"headers,omitempty"`
+	Auth     *DeclarativeAuth     `json:"auth,omitempty"`
+	Search   *DeclarativeEndpoint `json:"search,omitempty"`
+	Track    *DeclarativeEndpoint `json:"track,omitempty"`
+	Download *DeclarativeDownload `json:"download,omitempty"`
+}
+
+// DeclarativeAuth injects one header whose value comes from settings or
+// credentials. It is left out while any placeholder in Value is empty.
+type DeclarativeAuth struct {
+	Header string `json:"header"`
+	Value  string `json:"value"`
+}
+
+type DeclarativeEndpoint struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Results string            `json:"results,omitempty"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// DeclarativeDownload either templates the stream URL directly or, with
+// Resolve, fetches it from an endpoint whose fields map to url, format,
+// bit_depth and sample_rate.
+type DeclarativeDownload struct {
+	URL        string               `json:"url,omitempty"`
+	Resolve    *DeclarativeEndpoint `json:"resolve,omitempty"`
+	Headers    map[string]string    `json:"headers,omitempty"`
+	Format     string               `json:"format,omitempty"`
+	BitDepth   int                  `json:"bit_depth,omitempty"`
+	SampleRate int                  `json:"sample_rate,omitempty"`
+}
+
+func ParseDeclarativeProvider(data []byte) (*DeclarativeProvider, error) {
+	var def DeclarativeProvider
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", declarativeProviderFile, err)
+	}
+	if err := def.Validate(); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+func (d *DeclarativeProvider) Validate() error {
+	if d.Search == nil && d.Track == nil && d.Download == nil {
+		return fmt.Errorf("%s must define search, track or download", declarativeProviderFile)
+	}
+	if d.Auth != nil && (d.Auth.Header == "" || d.Auth.Value == "") {
+		return fmt.Errorf("auth needs both header and value")
+	}
+	for name, ep := range map[string]*DeclarativeEndpoint{"search": d.Search, "track": d.Track} {
+		if ep == nil {
+			continue
+		}
+		if err := ep.validate(name); err != nil {
+			return err
+		}
+		if ep.Fields["id"] == "" || ep.Fields["name"] == "" {
+			return fmt.Errorf("%s.fields must map at least id and name", name)
+		}
+	}
+	if d.Download != nil {
+		switch {
+		case d.Download.URL == "" && d.Download.Resolve == nil:
+			return fmt.Errorf("download needs url or resolve")
+		case d.Download.URL != "" && d.Download.Resolve != nil:
+			return fmt.Errorf("download takes url or resolve, not both")
+		case d.Download.Resolve != nil:
+			if err := d.Download.Resolve.validate("download.resolve"); err != nil {
+				return err
+			}
+			if d.Download.Resolve.Fields["url"] == "" {
+				return fmt.Errorf("download.resolve.fields must map url")
+			}
+		}
+	}
+	return nil
+}
+
+func (e *DeclarativeEndpoint) validate(name string) error {
+	if !strings.HasPrefix(e.URL, "https://") {
+		return fmt.Errorf("%s.url must be an https URL", name)
+	}
+	paths := []string{e.Results}
+	for _, p := range e.Fields {
+		paths = append(paths, p)
+	}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if !strings.HasPrefix(p, "$") {
+			return fmt.Errorf("%s: path %q must start with $", name, p)
+		}
+	}
+	return nil
+}
+
+// loadDeclarativeProvider returns nil when the extension has no
+// provider.json or also ships index.js, which then takes precedence.
+func loadDeclarativeProvider(sourceDir string) (*DeclarativeProvider, error) {
+	if _, err := os.Stat(filepath.Join(sourceDir, "index.js")); err == nil {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(sourceDir, declarativeProviderFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseDeclarativeProvider(data)
+}
+
+// ==================== Templates ====================
+
+// renderTemplate substitutes {name} placeholders. It reports whether any
+// placeholder resolved to an empty string.
+func (r *ExtensionRuntime) renderTemplate(tmpl string, vars map[string]string, escape func(string) string) (string, bool, error) {
+	var sb strings.Builder
+	empty := false
+	for {
+		start := strings.IndexByte(tmpl, '{')
+		if start < 0 {
+			sb.WriteString(tmpl)
+			break
+		}
+		end := strings.IndexByte(tmpl[start:], '}')
+		if end < 0 {
+			return "", false, fmt.Errorf("unterminated placeholder in %q", tmpl)
+		}
+		end += start
+		sb.WriteString(tmpl[:start])
+
+		value, err := r.templateValue(tmpl[start+1:end], vars)
+		if err != nil {
+			return "", false, err
+		}
+		if value == "" {
+			empty = true
+		}
+		if escape != nil {
+			value = escape(value)
+		}
+		sb.WriteString(value)
+		tmpl = tmpl[end+1:]
+	}
+	return sb.String(), empty, nil
+}
+
+func (r *ExtensionRuntime) templateValue(name string, vars map[string]string) (string, error) {
+	switch {
+	case strings.HasPrefix(name, "setting."):
+		if v, ok := r.settings[strings.TrimPrefix(name, "setting.")]; ok && v != nil {
+			return fmt.Sprintf("%v", v), nil
+		}
+		return "", nil
+	case strings.HasPrefix(name, "credential."):
+		if err := r.ensureCredentialsLoaded(); err != nil {
+			return "", err
+		}
+		r.credentialsMu.RLock()
+		v, ok := r.credentialsCache[strings.TrimPrefix(name, "credential.")]
+		r.credentialsMu.RUnlock()
+		if ok && v != nil {
+			return fmt.Sprintf("%v", v), nil
+		}
+		return "", nil
+	}
+	if v, ok := vars[name]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown placeholder {%s}", name)
+}
+
+func (r *ExtensionRuntime) declarativeHeaders(def *DeclarativeProvider, extra map[string]string, vars map[string]string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, set := range []map[string]string{def.Headers, extra} {
+		for k, v := range set {
+			rendered, _, err := r.renderTemplate(v, vars, nil)
+			if err != nil {
+				return nil, err
+			}
+			headers[k] = rendered
+		}
+	}
+	if def.Auth != nil {
+		value, empty, err := r.renderTemplate(def.Auth.Value, vars, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			headers[def.Auth.Header] = value
+		}
+	}
+	return headers, nil
+}
+
+// ==================== Field paths ====================
+
+// evalJSONPath returns the value at path (segments as parsed by
+// parseJSONPath), or nil when it does not exist. A [*] segment yields a list
+// with one entry per element.
+func evalJSONPath(doc interface{}, path string) interface{} {
+	return walkJSONPath(doc, parseJSONPath(path))
+}
+
+func walkJSONPath(node interface{}, segments []string) interface{} {
+	if len(segments) == 0 || node == nil {
+		return node
+	}
+	seg := segments[0]
+	switch v := node.(type) {
+	case []interface{}:
+		if seg == "*" {
+			out := make([]interface{}, 0, len(v))
+			for _, item := range v {
+				if value := walkJSONPath(item, segments[1:]); value != nil {
+					out = append(out, value)
+				}
+			}
+			return out
+		}
+		index, err := strconv.Atoi(seg)
+		if err != nil || index < 0 || index >= len(v) {
+			return nil
+		}
+		return walkJSONPath(v[index], segments[1:])
+	case map[string]interface{}:
+		return walkJSONPath(v[seg], segments[1:])
+	}
+	return nil
+}
+
+// mapDeclarativeItem builds one result object from fields, skipping paths
+// that resolve to nothing.
+func mapDeclarativeItem(item interface{}, fields map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(fields))
+	for key, path := range fields {
+		if value := evalJSONPath(item, path); value != nil {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// mapDeclarativeResults applies ep.Results and ep.Fields to a decoded
+// response. A Results path with [*] (or one pointing at an array) gives a
+// list, anything else a single object.
+func mapDeclarativeResults(doc interface{}, ep *DeclarativeEndpoint) (interface{}, error) {
+	root := doc
+	if ep.Results != "" {
+		if root = evalJSONPath(doc, ep.Results); root == nil {
+			return nil, fmt.Errorf("results path %s not found in response", ep.Results)
+		}
+	}
+
+	list, isList := root.([]interface{})
+	if !isList {
+		return mapDeclarativeItem(root, ep.Fields), nil
+	}
+	items := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		items = append(items, mapDeclarativeItem(item, ep.Fields))
+	}
+	return items, nil
+}
+
+// ==================== Runtime ====================
+
+func (r *ExtensionRuntime) declarativeFetch(def *DeclarativeProvider, ep *DeclarativeEndpoint, vars map[string]string) (interface{}, error) {
+	urlStr, _, err := r.renderTemplate(ep.URL, vars, url.QueryEscape)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.validateDomain(urlStr); err != nil {
+		return nil, err
+	}
+	headers, err := r.declarativeHeaders(def, ep.Headers, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	applyHeaderProfile(r.extensionID, req, defaultExtensionUserAgent)
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("HTTP error: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDeclarativeResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxDeclarativeResponseSize {
+		return nil, fmt.Errorf("response exceeds %d MB", maxDeclarativeResponseSize>>20)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("response is not JSON: %w", err)
+	}
+	return mapDeclarativeResults(doc, ep)
+}
+
+func (r *ExtensionRuntime) declarativeDownloadURL(def *DeclarativeProvider, trackID, quality string) (map[string]interface{}, error) {
+	dl := def.Download
+	vars := map[string]string{"id": trackID, "quality": quality}
+	result := map[string]interface{}{"format": dl.Format}
+	if dl.BitDepth > 0 {
+		result["bit_depth"] = dl.BitDepth
+	}
+	if dl.SampleRate > 0 {
+		result["sample_rate"] = dl.SampleRate
+	}
+
+	if dl.Resolve == nil {
+		urlStr, _, err := r.renderTemplate(dl.URL, vars, url.QueryEscape)
+		if err != nil {
+			return nil, err
+		}
+		result["url"] = urlStr
+		return result, nil
+	}
+
+	resolved, err := r.declarativeFetch(def, dl.Resolve, vars)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := resolved.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("download.resolve must produce a single object")
+	}
+	if u, _ := fields["url"].(string); u == "" {
+		return nil, fmt.Errorf("download.resolve returned no url")
+	}
+	for k, v := range fields {
+		result[k] = v
+	}
+	return result, nil
+}
+
+// declarativeAvailability answers checkAvailability from search results: an
+// ISRC match wins, otherwise the first result whose title and primary artist
+// both match.
+func declarativeAvailability(tracks []interface{}, isrc, trackName, artistName string) map[string]interface{} {
+	var byName string
+	for _, item := range tracks {
+		track, _ := item.(map[string]interface{})
+		if track == nil || track["id"] == nil {
+			continue
+		}
+		id := fmt.Sprintf("%v", track["id"])
+		if candidate, _ := track["isrc"].(string); isrc != "" && strings.EqualFold(candidate, isrc) {
+			return map[string]interface{}{"available": true, "track_id": id}
+		}
+		if name, _ := track["name"].(string); byName == "" && artistName != "" && strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(trackName)) &&
+			compareArtistLists(mapArtists(track), []string{artistName}).PrimaryMatch {
+			byName = id
+		}
+	}
+	if byName != "" {
+		return map[string]interface{}{"available": true, "track_id": byName}
+	}
+	return map[string]interface{}{"available": false, "reason": "no matching track"}
+}
+
+// registerDeclarativeProvider installs the native extension object for def.
+// Failures are thrown as JS errors so the provider wrappers report them the
+// same way as a throwing index.js.
+func (r *ExtensionRuntime) registerDeclarativeProvider(vm *goja.Runtime, def *DeclarativeProvider) {
+	fail := func(err error) {
+		panic(vm.NewGoError(err))
+	}
+	arg := func(call goja.FunctionCall, i int) string {
+		if v := call.Argument(i); !goja.IsUndefined(v) && !goja.IsNull(v) {
+			return v.String()
+		}
+		return ""
+	}
+
+	obj := vm.NewObject()
+	obj.Set("initialize", func(call goja.FunctionCall) goja.Value {
+		if settings, ok := call.Argument(0).Export().(map[string]interface{}); ok {
+			r.SetSettings(settings)
+		}
+		return goja.Undefined()
+	})
+
+	if def.Search != nil {
+		obj.Set("searchTracks", func(call goja.FunctionCall) goja.Value {
+			limit := call.Argument(1).ToInteger()
+			if limit <= 0 {
+				limit = 20
+			}
+			vars := map[string]string{"query": arg(call, 0), "limit": strconv.FormatInt(limit, 10)}
+			result, err := r.declarativeFetch(def, def.Search, vars)
+			if err != nil {
+				fail(err)
+			}
+			tracks, ok := result.([]interface{})
+			if !ok {
+				tracks = []interface{}{result}
+			}
+			if int64(len(tracks)) > limit {
+				tracks = tracks[:limit]
+			}
+			return vm.ToValue(map[string]interface{}{"tracks": tracks, "total": len(tracks)})
+		})
+	}
+
+	if def.Search != nil && def.Download != nil {
+		// Fallback asks every provider whether it has the track; answer from
+		// a title search, preferring an ISRC match.
+		obj.Set("checkAvailability", func(call goja.FunctionCall) goja.Value {
+			isrc, trackName, artistName := arg(call, 0), arg(call, 1), arg(call, 2)
+			result, err := r.declarativeFetch(def, def.Search, map[string]string{"query": trackName, "limit": "20"})
+			if err != nil {
+				fail(err)
+			}
+			tracks, _ := result.([]interface{})
+			return vm.ToValue(declarativeAvailability(tracks, isrc, trackName, artistName))
+		})
+	}
+
+	if def.Track != nil {
+		obj.Set("getTrack", func(call goja.FunctionCall) goja.Value {
+			result, err := r.declarativeFetch(def, def.Track, map[string]string{"id": arg(call, 0)})
+			if err != nil {
+				fail(err)
+			}
+			if list, ok := result.([]interface{}); ok {
+				if len(list) == 0 {
+					return goja.Null()
+				}
+				result = list[0]
+			}
+			return vm.ToValue(result)
+		})
+	}
+
+	if def.Download != nil {
+		obj.Set("getDownloadUrl", func(call goja.FunctionCall) goja.Value {
+			result, err := r.declarativeDownloadURL(def, arg(call, 0), arg(call, 1))
+			if err != nil {
+				fail(err)
+			}
+			return vm.ToValue(result)
+		})
+		obj.Set("download", func(call goja.FunctionCall) goja.Value {
+			trackID, quality, outputPath := arg(call, 0), arg(call, 1), arg(call, 2)
+			resolved, err := r.declarativeDownloadURL(def, trackID, quality)
+			if err != nil {
+				return vm.ToValue(map[string]interface{}{"success": false, "error_message": err.Error(), "error_type": "resolve_failed"})
+			}
+			headers, err := r.declarativeHeaders(def, def.Download.Headers, map[string]string{"id": trackID, "quality": quality})
+			if err != nil {
+				return vm.ToValue(map[string]interface{}{"success": false, "error_message": err.Error(), "error_type": "resolve_failed"})
+			}
+
+			// fileDownload reads headers as a JS object, i.e. map[string]interface{}.
+			headerValues := make(map[string]interface{}, len(headers))
+			for k, v := range headers {
+				headerValues[k] = v
+			}
+			options := map[string]interface{}{"headers": headerValues}
+			if progress, ok := goja.AssertFunction(call.Argument(3)); ok {
+				options["onProgress"] = func(c goja.FunctionCall) goja.Value {
+					written, total := c.Argument(0).ToInteger(), c.Argument(1).ToInteger()
+					if total > 0 {
+						progress(goja.Undefined(), vm.ToValue(written*100/total))
+					}
+					return goja.Undefined()
+				}
+			}
+
+			downloaded := r.fileDownload(goja.FunctionCall{Arguments: []goja.Value{
+				vm.ToValue(resolved["url"]), vm.ToValue(outputPath), vm.ToValue(options),
+			}}).Export().(map[string]interface{})
+			if ok, _ := downloaded["success"].(bool); !ok {
+				return vm.ToValue(map[string]interface{}{"success": false, "error_message": downloaded["error"], "error_type": "download_failed"})
+			}
+
+			result := map[string]interface{}{"success": true, "file_path": downloaded["path"]}
+			for _, key := range []string{"bit_depth", "sample_rate"} {
+				if v, ok := resolved[key]; ok {
+					result[key] = v
+				}
+			}
+			return vm.ToValue(result)
+		})
+	}
+
+	vm.Set("extension", obj)
+}
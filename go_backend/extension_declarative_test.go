@@ -0,0 +1,204 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDeclarativeProvider = `{
+  "headers": {"Accept": "application/json"},
+  "auth": {"header": "Authorization", "value": "Bearer {setting.token}"},
+  "search": {
+    "url": "https://api.example.com/search?q={query}&limit={limit}",
+    "results": "$.data.tracks[*]",
+    "fields": {"id": "$.id", "name": "$.title", "artists": "$.artists[*].name", "duration_ms": "$.length"}
+  },
+  "download": {"url": "https://cdn.example.com/{id}/{quality}.flac", "format": "flac", "bit_depth": 16}
+}`
+
+func loadDeclarativeTestExtension(t *testing.T, provider string) (*LoadedExtension, error) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, declarativeProviderFile), []byte(provider), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ext := &LoadedExtension{
+		ID:        "decl-ext",
+		Manifest:  &ExtensionManifest{Name: "decl-ext", APIVersion: ExtensionRuntimeAPIVersion},
+		DataDir:   t.TempDir(),
+		SourceDir: dir,
+	}
+	m := &ExtensionManager{extensions: make(map[string]*LoadedExtension)}
+	err := m.initializeVM(ext)
+	t.Cleanup(func() {
+		unregisterExtensionVM(ext.VM)
+		ClearExtensionErrors(ext.ID)
+	})
+	return ext, err
+}
+
+func TestDeclarativeProviderMapsResults(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"data":{"tracks":[
+		{"id":"t1","title":"One","artists":[{"name":"A"},{"name":"B"}],"length":1000},
+		{"id":"t2","title":"Two","artists":[{"name":"C"}]}
+	]}}`), &doc)
+
+	def, err := ParseDeclarativeProvider([]byte(testDeclarativeProvider))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := mapDeclarativeResults(doc, def.Search)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{
+		map[string]interface{}{"id": "t1", "name": "One", "artists": []interface{}{"A", "B"}, "duration_ms": float64(1000)},
+		map[string]interface{}{"id": "t2", "name": "Two", "artists": []interface{}{"C"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v\nwant %#v", got, want)
+	}
+
+	if _, err := mapDeclarativeResults(doc, &DeclarativeEndpoint{Results: "$.missing", Fields: def.Search.Fields}); err == nil {
+		t.Error("expected error for missing results path")
+	}
+}
+
+func TestDeclarativeProviderTemplates(t *testing.T) {
+	ext, err := loadDeclarativeTestExtension(t, testDeclarativeProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := ext.runtime
+	def, _ := ParseDeclarativeProvider([]byte(testDeclarativeProvider))
+
+	url, _, err := r.renderTemplate(def.Search.URL, map[string]string{"query": "a&b c", "limit": "5"}, nil)
+	if err != nil || url != "https://api.example.com/search?q=a&b c&limit=5" {
+		t.Errorf("unescaped render = %q, %v", url, err)
+	}
+	if _, _, err := r.renderTemplate("https://x/{nope}", nil, nil); err == nil {
+		t.Error("expected unknown placeholder error")
+	}
+
+	headers, err := r.declarativeHeaders(def, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := headers["Authorization"]; ok || headers["Accept"] != "application/json" {
+		t.Errorf("auth header must be skipped without a token: %v", headers)
+	}
+
+	RunWithTimeoutAndRecover(ext.VM, `extension.initialize({token: "abc"})`, DefaultJSTimeout)
+	headers, _ = r.declarativeHeaders(def, nil, nil)
+	if headers["Authorization"] != "Bearer abc" {
+		t.Errorf("Authorization = %q, want Bearer abc", headers["Authorization"])
+	}
+}
+
+func TestDeclarativeProviderLoadsAsExtension(t *testing.T) {
+	ext, err := loadDeclarativeTestExtension(t, testDeclarativeProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := RunWithTimeoutAndRecover(ext.VM, `extension.getDownloadUrl("id 1", "lossless")`, DefaultJSTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urlResult ExtDownloadURLResult
+	data, _ := json.Marshal(result.Export())
+	json.Unmarshal(data, &urlResult)
+	want := ExtDownloadURLResult{URL: "https://cdn.example.com/id+1/lossless.flac", Format: "flac", BitDepth: 16}
+	if urlResult != want {
+		t.Errorf("getDownloadUrl = %+v, want %+v", urlResult, want)
+	}
+
+	// The manifest allows no domains, so the sandbox must refuse the request.
+	if _, err := RunWithTimeoutAndRecover(ext.VM, `extension.searchTracks("x", 5)`, DefaultJSTimeout); err == nil || !strings.Contains(err.Error(), "network access denied") {
+		t.Errorf("expected sandbox denial, got %v", err)
+	}
+	if errs := GetExtensionErrors("decl-ext"); len(errs) != 1 || errs[0].Kind != "exception" {
+		t.Errorf("expected one recorded exception, got %+v", errs)
+	}
+}
+
+func TestDeclarativeProviderValidation(t *testing.T) {
+	for _, tc := range []struct{ name, provider string }{
+		{"empty", `{}`},
+		{"http", `{"search": {"url": "http://api.example.com/?q={query}", "fields": {"id": "$.id", "name": "$.name"}}}`},
+		{"no id", `{"search": {"url": "https://api.example.com/?q={query}", "fields": {"name": "$.name"}}}`},
+		{"bad path", `{"track": {"url": "https://api.example.com/{id}", "fields": {"id": "id", "name": "$.name"}}}`},
+		{"download both", `{"download": {"url": "https://a.example.com/{id}", "resolve": {"url": "https://a.example.com", "fields": {"url": "$.u"}}}}`},
+		{"auth", `{"auth": {"header": "Authorization"}, "download": {"url": "https://a.example.com/{id}"}}`},
+	} {
+		if _, err := ParseDeclarativeProvider([]byte(tc.provider)); err == nil {
+			t.Errorf("%s: expected validation error", tc.name)
+		}
+	}
+
+	if _, err := loadDeclarativeTestExtension(t, `{}`); err == nil {
+		t.Error("invalid provider.json must fail to load")
+	}
+}
+
+func TestDeclarativeAvailabilityPrefersISRC(t *testing.T) {
+	tracks := []interface{}{
+		map[string]interface{}{"id": "c", "name": "Song", "artists": []interface{}{"Cover Band"}},
+		map[string]interface{}{"id": "a", "name": "Song", "isrc": "XX1", "artists": []interface{}{"Artist"}},
+		map[string]interface{}{"id": "b", "name": "Other", "isrc": "XX2"},
+	}
+	if got := declarativeAvailability(tracks, "xx2", "Song", "Artist"); got["track_id"] != "b" {
+		t.Errorf("ISRC match = %v, want b", got)
+	}
+	if got := declarativeAvailability(tracks, "", " song ", "artist"); got["track_id"] != "a" {
+		t.Errorf("name match = %v, want a", got)
+	}
+	if got := declarativeAvailability(tracks, "", "Song", "Someone Else"); got["available"] != false {
+		t.Errorf("title match by another artist counted: %v", got)
+	}
+	if got := declarativeAvailability(tracks, "", "Song", ""); got["available"] != false {
+		t.Errorf("title match without an artist counted: %v", got)
+	}
+	if got := declarativeAvailability(tracks, "", "missing", "Artist"); got["available"] != false {
+		t.Errorf("expected unavailable, got %v", got)
+	}
+}
+
+type declarativeRoundTripper func(*http.Request) (*http.Response, error)
+
+func (f declarativeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestDeclarativeDownloadSendsHeaders(t *testing.T) {
+	ext, err := loadDeclarativeTestExtension(t, testDeclarativeProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext.Manifest.Permissions = ExtensionPermissions{Network: []string{"cdn.example.com"}, File: true}
+
+	var got http.Header
+	ext.runtime.httpClient.Transport = declarativeRoundTripper(func(req *http.Request) (*http.Response, error) {
+		got = req.Header.Clone()
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("fLaC")), Header: http.Header{}, Request: req}, nil
+	})
+
+	RunWithTimeoutAndRecover(ext.VM, `extension.initialize({token: "abc"})`, DefaultJSTimeout)
+	result, err := RunWithTimeoutAndRecover(ext.VM, `extension.download("t1", "lossless", "out.flac")`, DefaultJSTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := result.Export().(map[string]interface{})["success"].(bool); !ok {
+		t.Fatalf("download failed: %v", result.Export())
+	}
+	if got.Get("Authorization") != "Bearer abc" || got.Get("Accept") != "application/json" {
+		t.Errorf("request headers = %v", got)
+	}
+}
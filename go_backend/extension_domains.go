@@ -0,0 +1,307 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// ==================== Extension domain access ====================
+//
+// An extension may reach the domains in its manifest plus any the user
+// approved later. A request to anything else is denied, written to the audit
+// log and, the first time, announced with an "extension_domain" event so the
+// app can ask the user. Approvals belong to an installed extension and are
+// dropped when it is uninstalled.
+
+const (
+	approvedDomainsFile   = "approved_domains.json"
+	maxDomainAuditEntries = 200
+)
+
+// DomainDenial is one audit log entry. URL has its query string removed
+// since it commonly carries tokens.
+type DomainDenial struct {
+	Time          int64  `json:"time"`
+	ExtensionID   string `json:"extension_id"`
+	Domain        string `json:"domain"`
+	URL           string `json:"url"`
+	Reason        string `json:"reason"`
+	NeedsApproval bool   `json:"needs_approval"`
+}
+
+// AllowedDomains lists where an extension may connect.
+type AllowedDomains struct {
+	ExtensionID string   `json:"extension_id"`
+	Manifest    []string `json:"manifest"`
+	Approved    []string `json:"approved"`
+	Pending     []string `json:"pending"`
+}
+
+var (
+	domainAccessMu     sync.RWMutex
+	approvedDomains    = make(map[string][]string)
+	pendingApprovals   = make(map[string]map[string]bool)
+	domainAuditLog     []DomainDenial
+	approvedDomainsDir string
+)
+
+// matchDomainPattern matches a hostname against "example.com" (exact) or
+// "*.example.com" (any subdomain).
+func matchDomainPattern(pattern, domain string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if pattern == domain {
+		return true
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(domain, pattern[1:])
+	}
+	return false
+}
+
+// normalizeDomainPattern rejects patterns broader than one registrable
+// domain's subdomains, such as "*.co.uk" or "*.github.io".
+func normalizeDomainPattern(pattern string) (string, error) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	host := strings.TrimPrefix(pattern, "*.")
+	if host == "" || strings.ContainsAny(host, "*/:@ ") || !strings.Contains(host, ".") {
+		return "", fmt.Errorf("invalid domain pattern %q", pattern)
+	}
+	if suffix, _ := publicsuffix.PublicSuffix(host); suffix == host {
+		return "", fmt.Errorf("domain pattern %q covers a public suffix", pattern)
+	}
+	return pattern, nil
+}
+
+func isDomainApproved(extensionID, domain string) bool {
+	domainAccessMu.RLock()
+	defer domainAccessMu.RUnlock()
+	for _, pattern := range approvedDomains[extensionID] {
+		if matchDomainPattern(pattern, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordDomainDenial appends to the audit log and, for domains the user
+// could approve, emits one approval request per domain until it is handled.
+func recordDomainDenial(extensionID, rawURL, domain, reason string, needsApproval bool) {
+	entry := DomainDenial{
+		Time:          time.Now().UnixMilli(),
+		ExtensionID:   extensionID,
+		Domain:        strings.ToLower(domain),
+		URL:           rawURL,
+		Reason:        reason,
+		NeedsApproval: needsApproval,
+	}
+	if parsed, err := url.Parse(rawURL); err == nil {
+		parsed.RawQuery, parsed.Fragment, parsed.User = "", "", nil
+		entry.URL = parsed.String()
+	}
+
+	domainAccessMu.Lock()
+	domainAuditLog = append(domainAuditLog, entry)
+	if len(domainAuditLog) > maxDomainAuditEntries {
+		domainAuditLog = domainAuditLog[len(domainAuditLog)-maxDomainAuditEntries:]
+	}
+	emit := false
+	if needsApproval {
+		if pendingApprovals[extensionID] == nil {
+			pendingApprovals[extensionID] = make(map[string]bool)
+		}
+		emit = !pendingApprovals[extensionID][entry.Domain]
+		pendingApprovals[extensionID][entry.Domain] = true
+	}
+	domainAccessMu.Unlock()
+
+	GoLog("[Extension:%s] Denied %s: %s\n", extensionID, entry.Domain, reason)
+	if emit {
+		emitBackendEvent("extension_domain", map[string]interface{}{
+			"type":         "approval_needed",
+			"extension_id": extensionID,
+			"domain":       entry.Domain,
+			"url":          entry.URL,
+		})
+	}
+}
+
+func GetAllowedDomains(extensionID string) (*AllowedDomains, error) {
+	ext, err := GetExtensionManager().GetExtension(extensionID)
+	if err != nil {
+		return nil, err
+	}
+
+	domainAccessMu.RLock()
+	defer domainAccessMu.RUnlock()
+
+	result := &AllowedDomains{
+		ExtensionID: extensionID,
+		Manifest:    append([]string{}, ext.Manifest.Permissions.Network...),
+		Approved:    append([]string{}, approvedDomains[extensionID]...),
+		Pending:     []string{},
+	}
+	for domain := range pendingApprovals[extensionID] {
+		result.Pending = append(result.Pending, domain)
+	}
+	sort.Strings(result.Pending)
+	return result, nil
+}
+
+func GetAllowedDomainsJSON(extensionID string) (string, error) {
+	result, err := GetAllowedDomains(extensionID)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ApproveExtensionDomain lets the installed extension extensionID reach
+// pattern ("cdn.example.com" or "*.example.com") and persists the approval.
+func ApproveExtensionDomain(extensionID, pattern string) error {
+	if _, err := GetExtensionManager().GetExtension(extensionID); err != nil {
+		return err
+	}
+	pattern, err := normalizeDomainPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	domainAccessMu.Lock()
+	for _, existing := range approvedDomains[extensionID] {
+		if existing == pattern {
+			domainAccessMu.Unlock()
+			return nil
+		}
+	}
+	approvedDomains[extensionID] = append(approvedDomains[extensionID], pattern)
+	for domain := range pendingApprovals[extensionID] {
+		if matchDomainPattern(pattern, domain) {
+			delete(pendingApprovals[extensionID], domain)
+		}
+	}
+	err = saveApprovedDomainsLocked()
+	domainAccessMu.Unlock()
+
+	GoLog("[Extension:%s] Domain approved: %s\n", extensionID, pattern)
+	return err
+}
+
+// RevokeExtensionDomain removes a user approval. Manifest domains cannot be
+// revoked here.
+func RevokeExtensionDomain(extensionID, pattern string) error {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+	domainAccessMu.Lock()
+	defer domainAccessMu.Unlock()
+
+	kept := approvedDomains[extensionID][:0]
+	for _, existing := range approvedDomains[extensionID] {
+		if existing != pattern {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) == 0 {
+		delete(approvedDomains, extensionID)
+	} else {
+		approvedDomains[extensionID] = kept
+	}
+	return saveApprovedDomainsLocked()
+}
+
+// forgetExtensionDomains drops every approval and pending request of an
+// uninstalled extension, so a later extension with the same ID starts
+// without them.
+func forgetExtensionDomains(extensionID string) error {
+	domainAccessMu.Lock()
+	defer domainAccessMu.Unlock()
+	delete(pendingApprovals, extensionID)
+	if _, ok := approvedDomains[extensionID]; !ok {
+		return nil
+	}
+	delete(approvedDomains, extensionID)
+	return saveApprovedDomainsLocked()
+}
+
+// DismissDomainApproval drops a pending request without approving it, so
+// the next denial asks again.
+func DismissDomainApproval(extensionID, domain string) {
+	domainAccessMu.Lock()
+	delete(pendingApprovals[extensionID], strings.ToLower(domain))
+	domainAccessMu.Unlock()
+}
+
+// GetDomainAuditLog returns denials, newest last. An empty extensionID
+// returns every extension's entries.
+func GetDomainAuditLog(extensionID string) []DomainDenial {
+	domainAccessMu.RLock()
+	defer domainAccessMu.RUnlock()
+
+	entries := []DomainDenial{}
+	for _, entry := range domainAuditLog {
+		if extensionID == "" || entry.ExtensionID == extensionID {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func GetDomainAuditLogJSON(extensionID string) (string, error) {
+	jsonBytes, err := json.Marshal(GetDomainAuditLog(extensionID))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func ClearDomainAuditLog() {
+	domainAccessMu.Lock()
+	domainAuditLog = nil
+	domainAccessMu.Unlock()
+}
+
+// loadApprovedDomains reads persisted approvals from dir. A missing or
+// corrupt file leaves no approvals.
+func loadApprovedDomains(dir string) {
+	loaded := make(map[string][]string)
+	if data, err := os.ReadFile(filepath.Join(dir, approvedDomainsFile)); err == nil {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			GoLog("[Extension] Ignoring corrupt %s: %v\n", approvedDomainsFile, err)
+			loaded = make(map[string][]string)
+		}
+	}
+
+	domainAccessMu.Lock()
+	approvedDomainsDir = dir
+	approvedDomains = loaded
+	domainAccessMu.Unlock()
+}
+
+func saveApprovedDomainsLocked() error {
+	if approvedDomainsDir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(approvedDomains, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(approvedDomainsDir, approvedDomainsFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
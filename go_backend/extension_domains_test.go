@@ -0,0 +1,95 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtensionDomainApproval(t *testing.T) {
+	dir := t.TempDir()
+	loadApprovedDomains(dir)
+	defer loadApprovedDomains("")
+	defer ClearDomainAuditLog()
+
+	const extID = "domain-test"
+	if err := ApproveExtensionDomain(extID, "cdn.example.com"); err == nil {
+		t.Fatal("approved a domain for an extension that is not installed")
+	}
+	m := GetExtensionManager()
+	m.mu.Lock()
+	m.extensions[extID] = &LoadedExtension{ID: extID, Manifest: &ExtensionManifest{Name: extID}}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.extensions, extID)
+		m.mu.Unlock()
+	}()
+
+	if isDomainApproved(extID, "cdn.example.com") {
+		t.Fatal("domain approved before any approval")
+	}
+
+	recordDomainDenial(extID, "https://cdn.example.com/a?token=secret", "cdn.example.com", "not in allowed list", true)
+	recordDomainDenial(extID, "https://cdn.example.com/b", "cdn.example.com", "not in allowed list", true)
+
+	log := GetDomainAuditLog(extID)
+	if len(log) != 2 {
+		t.Fatalf("audit log has %d entries, want 2", len(log))
+	}
+	if strings.Contains(log[0].URL, "secret") {
+		t.Errorf("audit log kept the query string: %s", log[0].URL)
+	}
+	if len(GetDomainAuditLog("other")) != 0 {
+		t.Error("audit log leaked entries across extensions")
+	}
+
+	if err := ApproveExtensionDomain(extID, "*.Example.com"); err != nil {
+		t.Fatalf("ApproveExtensionDomain failed: %v", err)
+	}
+	if !isDomainApproved(extID, "cdn.example.com") || isDomainApproved(extID, "example.org") {
+		t.Error("wildcard approval matched the wrong domains")
+	}
+	if len(pendingApprovals[extID]) != 0 {
+		t.Error("approval did not clear the pending request")
+	}
+
+	loadApprovedDomains(dir)
+	if !isDomainApproved(extID, "a.example.com") {
+		t.Error("approval was not persisted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, approvedDomainsFile)); err != nil {
+		t.Errorf("approvals file missing: %v", err)
+	}
+
+	if err := RevokeExtensionDomain(extID, "*.example.com"); err != nil {
+		t.Fatalf("RevokeExtensionDomain failed: %v", err)
+	}
+	if isDomainApproved(extID, "cdn.example.com") {
+		t.Error("revoked approval still matches")
+	}
+
+	// Uninstalling drops the extension's approvals from disk as well.
+	if err := ApproveExtensionDomain(extID, "api.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.RemoveExtension(extID); err != nil {
+		t.Fatal(err)
+	}
+	loadApprovedDomains(dir)
+	if isDomainApproved(extID, "api.example.com") {
+		t.Error("approval survived uninstall")
+	}
+}
+
+func TestNormalizeDomainPattern(t *testing.T) {
+	for _, bad := range []string{"", "*", "*.com", "*.co.uk", "co.uk", "*.github.io", "example.com/path", "a.*.com", "localhost"} {
+		if _, err := normalizeDomainPattern(bad); err == nil {
+			t.Errorf("normalizeDomainPattern(%q) should fail", bad)
+		}
+	}
+	if got, err := normalizeDomainPattern(" *.CDN.Example.com "); err != nil || got != "*.cdn.example.com" {
+		t.Errorf("normalizeDomainPattern = %q, %v", got, err)
+	}
+}
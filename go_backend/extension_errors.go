@@ -0,0 +1,219 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Extension console and errors ====================
+//
+// console.* and log.* from an extension land in the log buffer as entries
+// attributed to that extension, at the level the script asked for. Uncaught
+// exceptions, load failures, timeouts and console.error calls are also kept
+// per extension (the last maxExtensionErrors) so the app can show what went
+// wrong without digging through the shared log. index.js is compiled under
+// its own name, so stack positions point into the extension's source.
+
+const (
+	maxExtensionErrors  = 50
+	maxExtensionStack   = 20
+	extensionScriptName = "index.js"
+)
+
+type ExtensionError struct {
+	Time        int64    `json:"time"`
+	ExtensionID string   `json:"extension_id"`
+	Kind        string   `json:"kind"` // exception, load, timeout, console
+	Message     string   `json:"message"`
+	Source      string   `json:"source,omitempty"`
+	Stack       []string `json:"stack,omitempty"`
+}
+
+var (
+	extensionErrorsMu sync.Mutex
+	extensionErrors   = make(map[string][]ExtensionError)
+
+	// extensionVMOwners maps each extension VM to its extension ID so errors
+	// from the shared RunWithTimeout path can be attributed.
+	extensionVMOwners sync.Map
+)
+
+func registerExtensionVM(vm *goja.Runtime, extensionID string) {
+	extensionVMOwners.Store(vm, extensionID)
+}
+
+func unregisterExtensionVM(vm *goja.Runtime) {
+	if vm != nil {
+		extensionVMOwners.Delete(vm)
+	}
+}
+
+func extensionIDForVM(vm *goja.Runtime) string {
+	if id, ok := extensionVMOwners.Load(vm); ok {
+		return id.(string)
+	}
+	return ""
+}
+
+// logExtension writes one attributed entry to the log buffer.
+func logExtension(extensionID, level, message string) {
+	GetLogBuffer().AddFor(level, "Extension:"+extensionID, extensionID, message)
+}
+
+func recordExtensionError(entry ExtensionError) {
+	entry.Time = time.Now().UnixMilli()
+	entry.Message = truncateLogMessage(sanitizeSensitiveLogText(entry.Message))
+
+	extensionErrorsMu.Lock()
+	list := append(extensionErrors[entry.ExtensionID], entry)
+	if len(list) > maxExtensionErrors {
+		list = list[len(list)-maxExtensionErrors:]
+	}
+	extensionErrors[entry.ExtensionID] = list
+	extensionErrorsMu.Unlock()
+
+	if entry.Kind == "console" {
+		return
+	}
+	msg := entry.Kind + ": " + entry.Message
+	if entry.Source != "" {
+		msg += " (" + entry.Source + ")"
+	}
+	logExtension(entry.ExtensionID, "ERROR", msg)
+}
+
+// formatJSStack renders frames as "fn (index.js:12:5)" and returns the
+// first position inside the extension's own code. Positions are already
+// mapped when the extension ships a source map.
+func formatJSStack(frames []goja.StackFrame) ([]string, string) {
+	var stack []string
+	source := ""
+	for i := range frames {
+		if len(stack) == maxExtensionStack {
+			break
+		}
+		frame := &frames[i]
+		pos := frame.Position()
+		if pos.Filename == "" && pos.Line == 0 {
+			stack = append(stack, frame.FuncName())
+			continue
+		}
+		name := pos.Filename
+		if name == "" {
+			name = "<eval>"
+		}
+		location := fmt.Sprintf("%s:%d:%d", name, pos.Line, pos.Column)
+		stack = append(stack, fmt.Sprintf("%s (%s)", frame.FuncName(), location))
+		if source == "" && pos.Filename != "" {
+			source = location
+		}
+	}
+	return stack, source
+}
+
+// reportJSError records err from running script on an extension VM. Errors
+// that are not JS exceptions or timeouts are left to the caller.
+func reportJSError(vm *goja.Runtime, kind string, err error) {
+	extensionID := extensionIDForVM(vm)
+	if extensionID == "" || err == nil {
+		return
+	}
+
+	entry := ExtensionError{ExtensionID: extensionID, Kind: kind}
+	var exc *goja.Exception
+	var interrupted *goja.InterruptedError
+	switch {
+	case IsTimeoutError(err) || errors.As(err, &interrupted):
+		entry.Kind = "timeout"
+		entry.Message = err.Error()
+	case errors.As(err, &exc):
+		entry.Message = exceptionMessage(exc)
+		entry.Stack, entry.Source = formatJSStack(exc.Stack())
+	default:
+		if kind != "load" {
+			return
+		}
+		entry.Message = err.Error()
+	}
+	recordExtensionError(entry)
+}
+
+func exceptionMessage(exc *goja.Exception) string {
+	if v := exc.Value(); v != nil {
+		if obj, ok := v.(*goja.Object); ok {
+			if msg := obj.Get("message"); msg != nil && !goja.IsUndefined(msg) {
+				if name := obj.Get("name"); name != nil && !goja.IsUndefined(name) {
+					return name.String() + ": " + msg.String()
+				}
+				return msg.String()
+			}
+		}
+		return v.String()
+	}
+	return exc.Error()
+}
+
+// registerConsole installs console.log/info/warn/error/debug for the
+// extension's VM.
+func (r *ExtensionRuntime) registerConsole(vm *goja.Runtime) {
+	console := vm.NewObject()
+	levels := map[string]string{
+		"log":   "INFO",
+		"info":  "INFO",
+		"debug": "DEBUG",
+		"warn":  "WARN",
+		"error": "ERROR",
+	}
+	for method, level := range levels {
+		console.Set(method, func(call goja.FunctionCall) goja.Value {
+			msg := r.formatLogArgs(call.Arguments)
+			logExtension(r.extensionID, level, msg)
+			if level == "ERROR" {
+				recordExtensionError(ExtensionError{ExtensionID: r.extensionID, Kind: "console", Message: msg})
+			}
+			return goja.Undefined()
+		})
+	}
+	vm.Set("console", console)
+}
+
+// GetExtensionErrors returns the recorded errors for extensionID, oldest
+// first. An empty ID returns every extension's errors.
+func GetExtensionErrors(extensionID string) []ExtensionError {
+	extensionErrorsMu.Lock()
+	defer extensionErrorsMu.Unlock()
+
+	result := []ExtensionError{}
+	if extensionID != "" {
+		return append(result, extensionErrors[extensionID]...)
+	}
+	for _, list := range extensionErrors {
+		result = append(result, list...)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time < result[j].Time })
+	return result
+}
+
+func GetExtensionErrorsJSON(extensionID string) (string, error) {
+	jsonBytes, err := json.Marshal(GetExtensionErrors(extensionID))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func ClearExtensionErrors(extensionID string) {
+	extensionErrorsMu.Lock()
+	defer extensionErrorsMu.Unlock()
+	if extensionID == "" {
+		extensionErrors = make(map[string][]ExtensionError)
+		return
+	}
+	delete(extensionErrors, extensionID)
+}
@@ -0,0 +1,142 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadErrorTestExtension(t *testing.T, id, script string) (*LoadedExtension, error) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.js"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ext := &LoadedExtension{
+		ID:        id,
+		Manifest:  &ExtensionManifest{Name: id, APIVersion: ExtensionRuntimeAPIVersion},
+		DataDir:   t.TempDir(),
+		SourceDir: dir,
+	}
+	m := &ExtensionManager{extensions: make(map[string]*LoadedExtension)}
+	err := m.initializeVM(ext)
+	t.Cleanup(func() {
+		unregisterExtensionVM(ext.VM)
+		ClearExtensionErrors(id)
+	})
+	return ext, err
+}
+
+func TestExtensionErrorsRecordUncaughtException(t *testing.T) {
+	ext, err := loadErrorTestExtension(t, "err-ext", `registerExtension({
+  search: function () {
+    return helper();
+  }
+});
+function helper() {
+  throw new TypeError("bad response");
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RunWithTimeoutAndRecover(ext.VM, "extension.search()", DefaultJSTimeout); err == nil {
+		t.Fatal("expected exception")
+	}
+
+	errs := GetExtensionErrors("err-ext")
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors, want 1", len(errs))
+	}
+	got := errs[0]
+	if got.Kind != "exception" || got.Message != "TypeError: bad response" {
+		t.Errorf("unexpected error entry: %+v", got)
+	}
+	if got.Source != "index.js:7:9" {
+		t.Errorf("source = %q, want index.js:7:9", got.Source)
+	}
+	if len(got.Stack) < 2 || !strings.HasPrefix(got.Stack[0], "helper (index.js:7") {
+		t.Errorf("unexpected stack: %v", got.Stack)
+	}
+	if len(GetExtensionErrors("other-ext")) != 0 {
+		t.Error("errors leaked across extensions")
+	}
+}
+
+func TestExtensionErrorsRecordLoadFailureAndConsole(t *testing.T) {
+	if _, err := loadErrorTestExtension(t, "broken-ext", "console.error('token expired');\nundefinedCall();"); err == nil {
+		t.Fatal("expected load failure")
+	}
+
+	errs := GetExtensionErrors("broken-ext")
+	if len(errs) != 2 {
+		t.Fatalf("got %d errors, want 2: %+v", len(errs), errs)
+	}
+	if errs[0].Kind != "console" || errs[0].Message != "token expired" {
+		t.Errorf("unexpected console entry: %+v", errs[0])
+	}
+	if errs[1].Kind != "load" || !strings.HasPrefix(errs[1].Source, "index.js:2:") {
+		t.Errorf("unexpected load entry: %+v", errs[1])
+	}
+
+	ClearExtensionErrors("broken-ext")
+	if len(GetExtensionErrors("broken-ext")) != 0 {
+		t.Error("errors not cleared")
+	}
+}
+
+func TestExtensionErrorsUseSourceMap(t *testing.T) {
+	const script = `registerExtension({search:function(){throw new Error("boom")}});`
+	const sourceMap = `{"version":3,"file":"index.js","sources":["src/app.js"],"names":[],"mappings":"AAAA,qCAKI,wBACJ"}`
+
+	for _, tc := range []struct {
+		name     string
+		script   string
+		manifest string
+	}{
+		{"comment", script + "\n//# sourceMappingURL=index.js.map\n", ""},
+		{"manifest", script, "index.js.map"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, "index.js"), []byte(tc.script), 0644)
+			os.WriteFile(filepath.Join(dir, "index.js.map"), []byte(sourceMap), 0644)
+			ext := &LoadedExtension{
+				ID:        "mapped-ext",
+				Manifest:  &ExtensionManifest{Name: "mapped-ext", APIVersion: ExtensionRuntimeAPIVersion, SourceMap: tc.manifest},
+				DataDir:   t.TempDir(),
+				SourceDir: dir,
+			}
+			m := &ExtensionManager{extensions: make(map[string]*LoadedExtension)}
+			if err := m.initializeVM(ext); err != nil {
+				t.Fatal(err)
+			}
+			defer unregisterExtensionVM(ext.VM)
+			defer ClearExtensionErrors("mapped-ext")
+
+			RunWithTimeoutAndRecover(ext.VM, "extension.search()", DefaultJSTimeout)
+			errs := GetExtensionErrors("mapped-ext")
+			if len(errs) != 1 || !strings.HasPrefix(errs[0].Source, "src/app.js:6:") {
+				t.Fatalf("expected mapped position in src/app.js:6, got %+v", errs)
+			}
+		})
+	}
+}
+
+func TestSourceMapStaysInsideExtension(t *testing.T) {
+	dir := t.TempDir()
+	for _, ref := range []string{"../secret.map", "/etc/passwd", "https://example.com/x.map", "file:///etc/passwd"} {
+		if p := sourceMapPath(dir, ref); p != "" {
+			t.Errorf("sourceMapPath(%q) = %q, want rejection", ref, p)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "index.js"), []byte("registerExtension({});\n//# sourceMappingURL=../missing.map\n"), 0644)
+	ext := &LoadedExtension{ID: "unmapped-ext", Manifest: &ExtensionManifest{Name: "unmapped-ext", APIVersion: ExtensionRuntimeAPIVersion}, DataDir: t.TempDir(), SourceDir: dir}
+	m := &ExtensionManager{extensions: make(map[string]*LoadedExtension)}
+	if err := m.initializeVM(ext); err != nil {
+		t.Fatalf("unusable source map must not block loading: %v", err)
+	}
+	unregisterExtensionVM(ext.VM)
+}
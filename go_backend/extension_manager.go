@@ -49,11 +49,13 @@ type LoadedExtension struct {
 	VM        *goja.Runtime      `json:"-"`
 	VMMu      sync.Mutex         `json:"-"`
 	runtime   *ExtensionRuntime
-	Enabled   bool   `json:"enabled"`
-	Error     string `json:"error,omitempty"`
-	DataDir   string `json:"data_dir"`
-	SourceDir string `json:"source_dir"`
-	IconPath  string `json:"icon_path"`
+	Enabled   bool           `json:"enabled"`
+	Error     string         `json:"error,omitempty"`
+	DataDir   string         `json:"data_dir"`
+	SourceDir string         `json:"source_dir"`
+	IconPath  string         `json:"icon_path"`
+	Trust     ExtensionTrust `json:"trust"`
+	Publisher string         `json:"publisher,omitempty"`
 }
 
 type ExtensionManager struct {
@@ -90,6 +92,10 @@ func (m *ExtensionManager) SetDirectories(extensionsDir, dataDir string) error {
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return fmt.Errorf("failed to create data directory: %w", err)
 	}
+	loadApprovedDomains(dataDir)
+	loadHeaderProfiles(dataDir)
+	loadCredentialLock(dataDir)
+	loadExtensionTrust(dataDir)
 
 	return nil
 }
@@ -120,7 +126,7 @@ func (m *ExtensionManager) LoadExtensionFromFile(filePath string) (*LoadedExtens
 				return nil, fmt.Errorf("failed to read manifest.json: %w", err)
 			}
 		}
-		if name == "index.js" {
+		if name == "index.js" || name == declarativeProviderFile {
 			hasIndexJS = true
 		}
 	}
@@ -130,7 +136,7 @@ func (m *ExtensionManager) LoadExtensionFromFile(filePath string) (*LoadedExtens
 	}
 
 	if !hasIndexJS {
-		return nil, fmt.Errorf("Invalid extension package: index.js not found")
+		return nil, fmt.Errorf("Invalid extension package: index.js or provider.json not found")
 	}
 
 	manifest, err := ParseManifest(manifestData)
@@ -160,6 +166,11 @@ func (m *ExtensionManager) LoadExtensionFromFile(filePath string) (*LoadedExtens
 		}
 	}
 
+	trust, publisher, err := verifyExtensionArchive(zipReader.File)
+	if err != nil {
+		return nil, err
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -219,6 +230,8 @@ func (m *ExtensionManager) LoadExtensionFromFile(filePath string) (*LoadedExtens
 		Enabled:   false, // New extensions start disabled
 		DataDir:   extDataDir,
 		SourceDir: extDir,
+		Trust:     trust,
+		Publisher: publisher,
 	}
 
 	if err := m.initializeVM(ext); err != nil {
@@ -237,27 +250,34 @@ func (m *ExtensionManager) initializeVM(ext *LoadedExtension) error {
 	vm := goja.New()
 	ext.VM = vm
 
-	indexPath := filepath.Join(ext.SourceDir, "index.js")
-	jsCode, err := os.ReadFile(indexPath)
+	declarative, err := loadDeclarativeProvider(ext.SourceDir)
 	if err != nil {
-		return fmt.Errorf("failed to read index.js: %w", err)
+		return err
+	}
+	var jsCode []byte
+	if declarative == nil {
+		indexPath := filepath.Join(ext.SourceDir, "index.js")
+		jsCode, err = os.ReadFile(indexPath)
+		if err != nil {
+			return fmt.Errorf("failed to read index.js: %w", err)
+		}
 	}
 
 	runtime := NewExtensionRuntime(ext)
 	ext.runtime = runtime
 	runtime.RegisterAPIs(vm)
 	runtime.RegisterGoBackendAPIs(vm)
+	runtime.registerAPIVersion(vm)
 
-	console := vm.NewObject()
-	console.Set("log", func(call goja.FunctionCall) goja.Value {
-		args := make([]interface{}, len(call.Arguments))
-		for i, arg := range call.Arguments {
-			args[i] = arg.Export()
-		}
-		GoLog("[Extension:%s] %v\n", ext.ID, args)
-		return goja.Undefined()
-	})
-	vm.Set("console", console)
+	runtime.registerConsole(vm)
+	migrateSecretSettings(ext)
+	runtime.injectSettings(vm, vmExtensionSettings(ext, GetExtensionSettingsStore().GetAll(ext.ID)))
+	registerExtensionVM(vm, ext.ID)
+
+	if declarative != nil {
+		runtime.registerDeclarativeProvider(vm, declarative)
+		return nil
+	}
 
 	var registeredExtension goja.Value
 	vm.Set("registerExtension", func(call goja.FunctionCall) goja.Value {
@@ -268,11 +288,18 @@ func (m *ExtensionManager) initializeVM(ext *LoadedExtension) error {
 		return goja.Undefined()
 	})
 
-	_, err = vm.RunString(string(jsCode))
+	program, err := compileExtensionScript(ext, string(jsCode))
+	if err == nil {
+		_, err = vm.RunProgram(program)
+	}
 	if err != nil {
+		reportJSError(vm, "load", err)
 		return fmt.Errorf("failed to execute extension code: %w", err)
 	}
 
+	if registeredExtension == nil || goja.IsUndefined(registeredExtension) {
+		registeredExtension = legacyRegisteredExtension(vm, ext.Manifest)
+	}
 	if registeredExtension == nil || goja.IsUndefined(registeredExtension) {
 		return fmt.Errorf("extension did not call registerExtension()")
 	}
@@ -304,6 +331,7 @@ func (m *ExtensionManager) UnloadExtension(extensionID string) error {
 		ext.runtime.closeStorageFlusher()
 		ext.runtime = nil
 	}
+	unregisterExtensionVM(ext.VM)
 
 	delete(m.extensions, extensionID)
 	GoLog("[Extension] Unloaded extension: %s\n", extensionID)
@@ -409,7 +437,9 @@ func (m *ExtensionManager) loadExtensionFromDirectory(dirPath string) (*LoadedEx
 
 	indexPath := filepath.Join(dirPath, "index.js")
 	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("Extension is missing index.js file")
+		if _, err := os.Stat(filepath.Join(dirPath, declarativeProviderFile)); os.IsNotExist(err) {
+			return nil, fmt.Errorf("Extension is missing index.js file")
+		}
 	}
 
 	if existing, exists := m.extensions[manifest.Name]; exists {
@@ -422,12 +452,21 @@ func (m *ExtensionManager) loadExtensionFromDirectory(dirPath string) (*LoadedEx
 		return nil, fmt.Errorf("failed to create extension data directory: %w", err)
 	}
 
+	// A folder that no longer matches its signature loads as unsigned.
+	trust, publisher, err := verifyExtensionDir(dirPath)
+	if err != nil {
+		GoLog("[Extension] %s: %v, loading as unsigned\n", manifest.Name, err)
+		trust, publisher = ExtensionTrustUnsigned, ""
+	}
+
 	ext := &LoadedExtension{
 		ID:        manifest.Name,
 		Manifest:  manifest,
 		Enabled:   false, // Will be restored from settings store
 		DataDir:   extDataDir,
 		SourceDir: dirPath,
+		Trust:     trust,
+		Publisher: publisher,
 	}
 
 	// Restore enabled state from settings store
@@ -466,6 +505,12 @@ func (m *ExtensionManager) RemoveExtension(extensionID string) error {
 			GoLog("[Extension] Warning: failed to remove source dir: %v\n", err)
 		}
 	}
+	if err := forgetExtensionDomains(extensionID); err != nil {
+		GoLog("[Extension] Warning: failed to remove domain approvals: %v\n", err)
+	}
+	if err := forgetExtensionHeaderConfig(extensionID); err != nil {
+		GoLog("[Extension] Warning: failed to remove header profiles: %v\n", err)
+	}
 
 	// Optionally remove data directory (keep for now to preserve settings)
 	// if ext.DataDir != "" {
@@ -503,7 +548,7 @@ func (m *ExtensionManager) UpgradeExtension(filePath string) (*LoadedExtension,
 				return nil, fmt.Errorf("failed to read manifest.json: %w", err)
 			}
 		}
-		if name == "index.js" {
+		if name == "index.js" || name == declarativeProviderFile {
 			hasIndexJS = true
 		}
 	}
@@ -513,7 +558,7 @@ func (m *ExtensionManager) UpgradeExtension(filePath string) (*LoadedExtension,
 	}
 
 	if !hasIndexJS {
-		return nil, fmt.Errorf("Invalid extension package: index.js not found")
+		return nil, fmt.Errorf("Invalid extension package: index.js or provider.json not found")
 	}
 
 	newManifest, err := ParseManifest(manifestData)
@@ -538,6 +583,11 @@ func (m *ExtensionManager) UpgradeExtension(filePath string) (*LoadedExtension,
 		return nil, fmt.Errorf("Extension is already at version %s", existing.Manifest.Version)
 	}
 
+	trust, publisher, err := verifyExtensionArchive(zipReader.File)
+	if err != nil {
+		return nil, err
+	}
+
 	GoLog("[Extension] Upgrading %s from v%s to v%s\n", newManifest.DisplayName, existing.Manifest.Version, newManifest.Version)
 
 	// Save data directory path and enabled state (we want to preserve them)
@@ -599,6 +649,8 @@ func (m *ExtensionManager) UpgradeExtension(filePath string) (*LoadedExtension,
 		Enabled:   wasEnabled, // Preserve enabled state from before upgrade
 		DataDir:   extDataDir,
 		SourceDir: extDir,
+		Trust:     trust,
+		Publisher: publisher,
 	}
 
 	// Initialize Goja VM
@@ -727,6 +779,10 @@ func (m *ExtensionManager) GetInstalledExtensionsJSON() (string, error) {
 		TrackMatching          *TrackMatchingConfig   `json:"track_matching,omitempty"`
 		PostProcessing         *PostProcessingConfig  `json:"post_processing,omitempty"`
 		Capabilities           map[string]interface{} `json:"capabilities,omitempty"`
+		APIVersion             int                    `json:"api_version"`
+		Trust                  ExtensionTrust         `json:"trust"`
+		Publisher              string                 `json:"publisher,omitempty"`
+		Restricted             bool                   `json:"restricted"`
 	}
 
 	infos := make([]ExtensionInfo, len(extensions))
@@ -785,6 +841,10 @@ func (m *ExtensionManager) GetInstalledExtensionsJSON() (string, error) {
 			TrackMatching:          ext.Manifest.TrackMatching,
 			PostProcessing:         ext.Manifest.PostProcessing,
 			Capabilities:           ext.Manifest.Capabilities,
+			APIVersion:             ext.Manifest.TargetAPIVersion(),
+			Trust:                  ext.Trust,
+			Publisher:              ext.Publisher,
+			Restricted:             extensionRestricted(ext.ID, ext.Trust),
 		}
 	}
 
@@ -809,6 +869,10 @@ func (m *ExtensionManager) InitializeExtension(extensionID string, settings map[
 		return fmt.Errorf("Extension failed to load. Please reinstall the extension")
 	}
 
+	settings = vmExtensionSettings(ext, settings)
+	if ext.runtime != nil {
+		ext.runtime.injectSettings(ext.VM, settings)
+	}
 	settingsJSON, err := json.Marshal(settings)
 	if err != nil {
 		return fmt.Errorf("Failed to save settings")
@@ -831,6 +895,7 @@ func (m *ExtensionManager) InitializeExtension(extensionID string, settings map[
 
 	result, err := ext.VM.RunString(script)
 	if err != nil {
+		reportJSError(ext.VM, "exception", err)
 		ext.Error = fmt.Sprintf("initialize failed: %v", err)
 		ext.Enabled = false
 		GoLog("[Extension] Initialize error for %s: %v\n", extensionID, err)
@@ -886,6 +951,7 @@ func (m *ExtensionManager) CleanupExtension(extensionID string) error {
 
 	result, err := ext.VM.RunString(script)
 	if err != nil {
+		reportJSError(ext.VM, "exception", err)
 		GoLog("[Extension] Cleanup error for %s: %v\n", extensionID, err)
 		return err
 	}
@@ -115,6 +115,8 @@ type ExtensionManifest struct {
 	Settings               []ExtensionSetting     `json:"settings,omitempty"`
 	QualityOptions         []QualityOption        `json:"qualityOptions,omitempty"`
 	MinAppVersion          string                 `json:"minAppVersion,omitempty"`
+	APIVersion             int                    `json:"apiVersion,omitempty"`
+	SourceMap              string                 `json:"sourceMap,omitempty"`
 	SkipMetadataEnrichment bool                   `json:"skipMetadataEnrichment,omitempty"`
 	SkipBuiltInFallback    bool                   `json:"skipBuiltInFallback,omitempty"`
 	SearchBehavior         *SearchBehaviorConfig  `json:"searchBehavior,omitempty"`
@@ -163,6 +165,14 @@ func (m *ExtensionManifest) Validate() error {
 		return &ManifestValidationError{Field: "description", Message: "description is required"}
 	}
 
+	if err := validateExtensionAPIVersion(m.APIVersion); err != nil {
+		return err
+	}
+
+	if m.SourceMap != "" && sourceMapPath("", m.SourceMap) == "" {
+		return &ManifestValidationError{Field: "sourceMap", Message: "sourceMap must be a relative path inside the package"}
+	}
+
 	if len(m.Types) == 0 {
 		return &ManifestValidationError{Field: "type", Message: "at least one type is required"}
 	}
@@ -205,6 +215,33 @@ func (m *ExtensionManifest) Validate() error {
 				Message: "button type requires action (JS function name)",
 			}
 		}
+
+		if strings.HasPrefix(setting.Key, "_") {
+			return &ManifestValidationError{
+				Field:   fmt.Sprintf("settings[%d].key", i),
+				Message: "setting keys starting with '_' are reserved",
+			}
+		}
+
+		if findExtensionSetting(m, setting.Key) != &m.Settings[i] {
+			return &ManifestValidationError{
+				Field:   fmt.Sprintf("settings[%d].key", i),
+				Message: fmt.Sprintf("duplicate setting key: %s", setting.Key),
+			}
+		}
+
+		switch setting.Type {
+		case SettingTypeString, SettingTypeNumber, SettingTypeBool, SettingTypeSelect:
+			if setting.Default == nil {
+				break
+			}
+			if _, err := checkSettingValue(setting, setting.Default); err != nil {
+				return &ManifestValidationError{
+					Field:   fmt.Sprintf("settings[%d].default", i),
+					Message: err.Error(),
+				}
+			}
+		}
 	}
 
 	return nil
@@ -232,18 +269,10 @@ func (m *ExtensionManifest) IsLyricsProvider() bool {
 }
 
 func (m *ExtensionManifest) IsDomainAllowed(domain string) bool {
-	domain = strings.ToLower(strings.TrimSpace(domain))
 	for _, allowed := range m.Permissions.Network {
-		allowed = strings.ToLower(strings.TrimSpace(allowed))
-		if allowed == domain {
-			return true
-		}
 		// Support wildcard subdomains (e.g., *.example.com)
-		if strings.HasPrefix(allowed, "*.") {
-			suffix := allowed[1:]
-			if strings.HasSuffix(domain, suffix) {
-				return true
-			}
+		if matchDomainPattern(allowed, domain) {
+			return true
 		}
 	}
 	return false
@@ -261,6 +290,66 @@ func (m *ExtensionManifest) HasPostProcessing() bool {
 	return m.PostProcessing != nil && m.PostProcessing.Enabled
 }
 
+// HasDownloadCompleteHook reports whether the extension opted into
+// extension.onDownloadComplete via "capabilities": {"onDownloadComplete": true}.
+func (m *ExtensionManifest) HasDownloadCompleteHook() bool {
+	enabled, ok := m.Capabilities["onDownloadComplete"].(bool)
+	return ok && enabled
+}
+
+// HasLyricsSource reports whether the extension exports getLyrics(track) via
+// "capabilities": {"getLyrics": true}. Unlike lyrics_provider extensions it
+// does not need the lyrics type and is ranked alongside the built-in sources.
+func (m *ExtensionManifest) HasLyricsSource() bool {
+	enabled, ok := m.Capabilities["getLyrics"].(bool)
+	return ok && enabled
+}
+
+// HasVideoDownload reports whether the extension can return music videos
+// through getVideoStreams, opted into via "capabilities": {"video": true}.
+func (m *ExtensionManifest) HasVideoDownload() bool {
+	enabled, ok := m.Capabilities["video"].(bool)
+	return ok && enabled
+}
+
+// TLSFingerprintHosts returns the hosts the extension wants reached with the
+// uTLS Chrome fingerprint. "capabilities": {"tlsFingerprint": true} covers
+// every network permission; a list of domains narrows it down.
+func (m *ExtensionManifest) TLSFingerprintHosts() []string {
+	switch v := m.Capabilities["tlsFingerprint"].(type) {
+	case bool:
+		if v {
+			return normalizeHostList(m.Permissions.Network)
+		}
+	case []interface{}:
+		var hosts []string
+		for _, item := range v {
+			if host, ok := item.(string); ok {
+				hosts = append(hosts, host)
+			}
+		}
+		return normalizeHostList(hosts)
+	}
+	return nil
+}
+
+// DecryptionSchemes returns the stream decryption schemes the extension
+// declared via "capabilities": {"decryption": "name" | ["name", ...]}.
+func (m *ExtensionManifest) DecryptionSchemes() []string {
+	var schemes []string
+	switch v := m.Capabilities["decryption"].(type) {
+	case string:
+		schemes = append(schemes, strings.ToLower(v))
+	case []interface{}:
+		for _, item := range v {
+			if name, ok := item.(string); ok {
+				schemes = append(schemes, strings.ToLower(name))
+			}
+		}
+	}
+	return schemes
+}
+
 func (m *ExtensionManifest) HasURLHandler() bool {
 	return m.URLHandler != nil && m.URLHandler.Enabled && len(m.URLHandler.Patterns) > 0
 }
@@ -27,6 +27,7 @@ type ExtTrackMetadata struct {
 	TrackNumber int    `json:"track_number,omitempty"`
 	DiscNumber  int    `json:"disc_number,omitempty"`
 	ISRC        string `json:"isrc,omitempty"`
+	Explicit    bool   `json:"explicit,omitempty"`
 	ProviderID  string `json:"provider_id"`
 	ItemType    string `json:"item_type,omitempty"`
 	AlbumType   string `json:"album_type,omitempty"`
@@ -40,6 +41,10 @@ type ExtTrackMetadata struct {
 	Label     string `json:"label,omitempty"`
 	Copyright string `json:"copyright,omitempty"`
 	Genre     string `json:"genre,omitempty"`
+
+	Chapters []Chapter `json:"chapters,omitempty"`
+	// AnimatedCoverURL is a looping MP4/WebM cover, such as a Spotify canvas.
+	AnimatedCoverURL string `json:"animated_cover_url,omitempty"`
 }
 
 func (t *ExtTrackMetadata) ResolvedCoverURL() string {
@@ -60,6 +65,7 @@ type ExtAlbumMetadata struct {
 	AlbumType   string             `json:"album_type,omitempty"`
 	Tracks      []ExtTrackMetadata `json:"tracks"`
 	ProviderID  string             `json:"provider_id"`
+	Assets      []ExtAlbumAsset    `json:"assets,omitempty"`
 }
 
 type ExtArtistMetadata struct {
@@ -108,11 +114,23 @@ type ExtDownloadResult struct {
 	ReleaseDate string `json:"release_date,omitempty"`
 	CoverURL    string `json:"cover_url,omitempty"`
 	ISRC        string `json:"isrc,omitempty"`
+
+	Chapters         []Chapter `json:"chapters,omitempty"`
+	AnimatedCoverURL string    `json:"animated_cover_url,omitempty"`
+
+	// Set instead of FilePath to have the backend download a YouTube
+	// video's audio (see youtube_audio.go).
+	YouTubeVideoID           string          `json:"youtube_video_id,omitempty"`
+	YouTubeInvidiousInstance string          `json:"youtube_invidious_instance,omitempty"`
+	YouTubePlayerResponse    json.RawMessage `json:"youtube_player_response,omitempty"`
 }
 
 type ExtensionProviderWrapper struct {
 	extension *LoadedExtension
 	vm        *goja.Runtime
+	// itemID, when set, lets transfers Go runs for the extension notice
+	// a cancelled download.
+	itemID string
 }
 
 func NewExtensionProviderWrapper(ext *LoadedExtension) *ExtensionProviderWrapper {
@@ -131,8 +149,8 @@ func (p *ExtensionProviderWrapper) SearchTracks(query string, limit int) (*ExtSe
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	script := fmt.Sprintf(`
 		(function() {
@@ -156,6 +174,18 @@ func (p *ExtensionProviderWrapper) SearchTracks(query string, limit int) (*ExtSe
 	}
 
 	exported := result.Export()
+	switch v := exported.(type) {
+	case []interface{}:
+		if exported, err = normalizeExtensionTrackList(p.extension.ID, v, "tracks"); err != nil {
+			return nil, fmt.Errorf("searchTracks returned malformed tracks: %w", err)
+		}
+	case map[string]interface{}:
+		if list, ok := v["tracks"].([]interface{}); ok {
+			if v["tracks"], err = normalizeExtensionTrackList(p.extension.ID, list, "tracks"); err != nil {
+				return nil, fmt.Errorf("searchTracks returned malformed tracks: %w", err)
+			}
+		}
+	}
 	jsonBytes, err := json.Marshal(exported)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal result: %w", err)
@@ -190,8 +220,8 @@ func (p *ExtensionProviderWrapper) GetTrack(trackID string) (*ExtTrackMetadata,
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	script := fmt.Sprintf(`
 		(function() {
@@ -214,8 +244,11 @@ func (p *ExtensionProviderWrapper) GetTrack(trackID string) (*ExtTrackMetadata,
 		return nil, fmt.Errorf("getTrack returned null")
 	}
 
-	exported := result.Export()
-	jsonBytes, err := json.Marshal(exported)
+	normalized, err := normalizeExtensionTrack(result.Export(), "")
+	if err != nil {
+		return nil, fmt.Errorf("getTrack returned malformed track: %w", err)
+	}
+	jsonBytes, err := json.Marshal(normalized.wireObject())
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal result: %w", err)
 	}
@@ -238,8 +271,8 @@ func (p *ExtensionProviderWrapper) GetAlbum(albumID string) (*ExtAlbumMetadata,
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	script := fmt.Sprintf(`
 		(function() {
@@ -289,8 +322,8 @@ func (p *ExtensionProviderWrapper) GetArtist(artistID string) (*ExtArtistMetadat
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	script := fmt.Sprintf(`
 		(function() {
@@ -337,8 +370,8 @@ func (p *ExtensionProviderWrapper) EnrichTrack(track *ExtTrackMetadata) (*ExtTra
 		return track, nil
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	trackJSON, err := json.Marshal(track)
 	if err != nil {
@@ -370,8 +403,12 @@ func (p *ExtensionProviderWrapper) EnrichTrack(track *ExtTrackMetadata) (*ExtTra
 		return track, nil
 	}
 
-	exported := result.Export()
-	jsonBytes, err := json.Marshal(exported)
+	normalized, err := normalizeExtensionTrack(result.Export(), "")
+	if err != nil {
+		GoLog("[Extension] EnrichTrack: %s returned malformed track: %v\n", p.extension.ID, err)
+		return track, nil
+	}
+	jsonBytes, err := json.Marshal(normalized.wireObject())
 	if err != nil {
 		GoLog("[Extension] EnrichTrack: failed to marshal result: %v\n", err)
 		return track, nil
@@ -397,8 +434,8 @@ func (p *ExtensionProviderWrapper) CheckAvailability(isrc, trackName, artistName
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	script := fmt.Sprintf(`
 		(function() {
@@ -444,8 +481,8 @@ func (p *ExtensionProviderWrapper) GetDownloadURL(trackID, quality string) (*Ext
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	script := fmt.Sprintf(`
 		(function() {
@@ -493,8 +530,8 @@ func (p *ExtensionProviderWrapper) Download(trackID, quality, outputPath string,
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := sync.OnceFunc(acquireExtensionDownloadVM(p.extension))
+	defer release()
 
 	p.vm.Set("__onProgress", func(call goja.FunctionCall) goja.Value {
 		if len(call.Arguments) > 0 {
@@ -563,6 +600,10 @@ func (p *ExtensionProviderWrapper) Download(trackID, quality, outputPath string,
 		}, nil
 	}
 
+	if downloadResult.Success && downloadResult.FilePath == "" && downloadResult.YouTubeVideoID != "" {
+		return p.downloadYouTubeHandback(&downloadResult, outputPath, onProgress, release), nil
+	}
+
 	return &downloadResult, nil
 }
 
@@ -598,16 +639,29 @@ func (m *ExtensionManager) SearchTracksWithExtensions(query string, limit int) (
 		return nil, nil
 	}
 
+	// Each provider runs on its own goroutine; the scheduler serializes calls
+	// per VM and caps how many extensions execute at once.
+	results := make([][]ExtTrackMetadata, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(idx int, p *ExtensionProviderWrapper) {
+			defer wg.Done()
+			result, err := p.SearchTracks(query, limit)
+			if err != nil {
+				GoLog("[Extension] Search error from %s: %v\n", p.extension.ID, err)
+				return
+			}
+			if result != nil {
+				results[idx] = result.Tracks
+			}
+		}(i, provider)
+	}
+	wg.Wait()
+
 	var allTracks []ExtTrackMetadata
-	for _, provider := range providers {
-		result, err := provider.SearchTracks(query, limit)
-		if err != nil {
-			GoLog("[Extension] Search error from %s: %v\n", provider.extension.ID, err)
-			continue
-		}
-		if result != nil {
-			allTracks = append(allTracks, result.Tracks...)
-		}
+	for _, tracks := range results {
+		allTracks = append(allTracks, tracks...)
 	}
 
 	return allTracks, nil
@@ -698,6 +752,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 
 	var lastErr error
 	var skipBuiltIn bool
+	health := GetProviderHealthTracker()
 
 	if req.Source != "" && !isBuiltInProvider(strings.ToLower(req.Source)) {
 		ext, err := extManager.GetExtension(req.Source)
@@ -707,9 +762,9 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			provider := NewExtensionProviderWrapper(ext)
 			trackMeta := &ExtTrackMetadata{
 				ID:          req.SpotifyID,
-				Name:        req.TrackName,
-				Artists:     req.ArtistName,
-				AlbumName:   req.AlbumName,
+				Name:        req.matchTitle(),
+				Artists:     req.matchArtist(),
+				AlbumName:   req.matchAlbum(),
 				DurationMS:  req.DurationMS,
 				ISRC:        req.ISRC,
 				ReleaseDate: req.ReleaseDate,
@@ -718,7 +773,9 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 				ProviderID:  req.Source,
 			}
 
+			search := startTraceSpan(req.ItemID, TraceSpanSearch, map[string]interface{}{"source": req.Source})
 			enrichedTrack, err := provider.EnrichTrack(trackMeta)
+			search.End(err)
 			if err == nil && enrichedTrack != nil {
 				if enrichedTrack.ISRC != "" && enrichedTrack.ISRC != req.ISRC {
 					GoLog("[DownloadWithExtensionFallback] ISRC enriched: %s -> %s\n", req.ISRC, enrichedTrack.ISRC)
@@ -758,9 +815,13 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 					GoLog("[DownloadWithExtensionFallback] ReleaseDate from enrichment: %s\n", enrichedTrack.ReleaseDate)
 					req.ReleaseDate = enrichedTrack.ReleaseDate
 				}
+				if enrichedTrack.AnimatedCoverURL != "" && req.AnimatedCoverURL == "" {
+					req.AnimatedCoverURL = enrichedTrack.AnimatedCoverURL
+				}
 			}
 		}
 	}
+	applyQueuedMetadataPatch(&req)
 
 	if req.Source != "" &&
 		!isBuiltInProvider(strings.ToLower(req.Source)) &&
@@ -772,6 +833,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			skipBuiltIn = ext.Manifest.SkipBuiltInFallback
 
 			provider := NewExtensionProviderWrapper(ext)
+			provider.itemID = req.ItemID
 
 			trackID := req.SpotifyID
 
@@ -782,6 +844,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 				StartItemProgress(req.ItemID)
 			}
 
+			fetch := startTraceSpan(req.ItemID, TraceSpanFetch, map[string]interface{}{"provider": req.Source})
 			result, err := provider.Download(trackID, req.Quality, outputPath, func(percent int) {
 				if req.ItemID != "" {
 					normalized := float64(percent) / 100.0
@@ -794,6 +857,11 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 					SetItemProgress(req.ItemID, normalized, 0, 0)
 				}
 			})
+			fetchErr := err
+			if fetchErr == nil && result != nil && !result.Success && result.ErrorMessage != "" {
+				fetchErr = fmt.Errorf("%s", result.ErrorMessage)
+			}
+			fetch.End(fetchErr)
 			if req.ItemID != "" {
 				if err == nil && result != nil && result.Success {
 					CompleteItemProgress(req.ItemID)
@@ -803,6 +871,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			}
 
 			if err == nil && result.Success {
+				rememberAnimatedCover(req.ItemID, result.AnimatedCoverURL, AnimatedCoverScopeTrack)
 				resp := &DownloadResponse{
 					Success:          true,
 					Message:          "Downloaded from " + req.Source,
@@ -823,6 +892,21 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 					}
 				}
 
+				chapters := result.Chapters
+				if len(chapters) == 0 {
+					chapters = req.Chapters
+				}
+				if len(chapters) > 0 {
+					resp.Chapters = chapters
+					if req.EmbedMetadata {
+						if err := EmbedChapters(result.FilePath, chapters); err != nil {
+							GoLog("[DownloadWithExtensionFallback] Warning: failed to embed chapters: %v\n", err)
+						} else {
+							GoLog("[DownloadWithExtensionFallback] Embedded %d chapters\n", len(chapters))
+						}
+					}
+				}
+
 				if ext.Manifest.SkipMetadataEnrichment {
 					resp.SkipMetadataEnrichment = true
 					if result.Title != "" {
@@ -901,14 +985,22 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			continue
 		}
 
+		// A locked provider is always attempted; the breaker only reorders fallback chains.
+		if !strictMode && !health.Allow(providerIDNormalized) {
+			GoLog("[DownloadWithExtensionFallback] Skipping %s (circuit open)\n", providerID)
+			continue
+		}
+
 		GoLog("[DownloadWithExtensionFallback] Trying provider: %s\n", providerID)
 
 		if isBuiltInProvider(providerIDNormalized) {
 			if (req.Genre == "" || req.Label == "") && req.ISRC != "" {
 				GoLog("[DownloadWithExtensionFallback] Enriching extended metadata from Deezer for ISRC: %s\n", req.ISRC)
 				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				search := startTraceSpan(req.ItemID, TraceSpanSearch, map[string]interface{}{"source": "deezer"})
 				deezerClient := GetDeezerClient()
 				extMeta, err := deezerClient.GetExtendedMetadataByISRC(ctx, req.ISRC)
+				search.End(err)
 				cancel()
 				if err == nil && extMeta != nil {
 					if req.Genre == "" && extMeta.Genre != "" {
@@ -925,6 +1017,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			}
 
 			result, err := tryBuiltInProvider(providerIDNormalized, req)
+			health.RecordOutcome(providerIDNormalized, err)
 			if err == nil && result.Success {
 				result.Service = providerIDNormalized
 				if req.Label != "" {
@@ -965,12 +1058,23 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 			}
 
 			provider := NewExtensionProviderWrapper(ext)
+			provider.itemID = req.ItemID
 
-			availability, err := provider.CheckAvailability(req.ISRC, req.TrackName, req.ArtistName)
+			match := startTraceSpan(req.ItemID, TraceSpanMatch, map[string]interface{}{"provider": providerID})
+			availability, err := provider.CheckAvailability(req.ISRC, req.matchTitle(), req.matchArtist())
+			if err == nil && !availability.Available {
+				match.SetAttr("available", false)
+			}
+			match.End(err)
+			// Only the download itself counts as a success: a cheap availability
+			// check passing must not close a half-open circuit.
 			if err != nil || !availability.Available {
 				GoLog("[DownloadWithExtensionFallback] %s: not available\n", providerID)
 				if err != nil {
+					health.RecordOutcome(providerIDNormalized, err)
 					lastErr = err
+				} else {
+					health.ReleaseProbe(providerIDNormalized)
 				}
 				continue
 			}
@@ -980,6 +1084,7 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 				StartItemProgress(req.ItemID)
 			}
 
+			fetch := startTraceSpan(req.ItemID, TraceSpanFetch, map[string]interface{}{"provider": providerID})
 			result, err := provider.Download(availability.TrackID, req.Quality, outputPath, func(percent int) {
 				if req.ItemID != "" {
 					normalized := float64(percent) / 100.0
@@ -1000,7 +1105,15 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 				}
 			}
 
+			downloadErr := err
+			if downloadErr == nil && result != nil && !result.Success && result.ErrorMessage != "" {
+				downloadErr = fmt.Errorf("%s", result.ErrorMessage)
+			}
+			fetch.End(downloadErr)
+			health.RecordOutcome(providerIDNormalized, downloadErr)
+
 			if err == nil && result.Success {
+				rememberAnimatedCover(req.ItemID, result.AnimatedCoverURL, AnimatedCoverScopeTrack)
 				resp := &DownloadResponse{
 					Success:          true,
 					Message:          "Downloaded from " + providerID,
@@ -1021,6 +1134,21 @@ func DownloadWithExtensionFallback(req DownloadRequest) (*DownloadResponse, erro
 					}
 				}
 
+				chapters := result.Chapters
+				if len(chapters) == 0 {
+					chapters = req.Chapters
+				}
+				if len(chapters) > 0 {
+					resp.Chapters = chapters
+					if req.EmbedMetadata {
+						if err := EmbedChapters(result.FilePath, chapters); err != nil {
+							GoLog("[DownloadWithExtensionFallback] Warning: failed to embed chapters: %v\n", err)
+						} else {
+							GoLog("[DownloadWithExtensionFallback] Embedded %d chapters\n", len(chapters))
+						}
+					}
+				}
+
 				if ext.Manifest.SkipMetadataEnrichment {
 					resp.SkipMetadataEnrichment = true
 					if result.Title != "" {
@@ -1143,6 +1271,7 @@ func tryBuiltInProvider(providerID string, req DownloadRequest) (*DownloadRespon
 				DiscNumber:    amazonResult.DiscNumber,
 				ISRC:          amazonResult.ISRC,
 				LyricsLRC:     amazonResult.LyricsLRC,
+				LyricsTags:    amazonResult.LyricsTags,
 				DecryptionKey: amazonResult.DecryptionKey,
 			}
 		}
@@ -1172,6 +1301,7 @@ func tryBuiltInProvider(providerID string, req DownloadRequest) (*DownloadRespon
 		Label:            req.Label,
 		Copyright:        req.Copyright,
 		LyricsLRC:        result.LyricsLRC,
+		LyricsTags:       result.LyricsTags,
 		DecryptionKey:    result.DecryptionKey,
 	}, nil
 }
@@ -1190,6 +1320,7 @@ func buildOutputPath(req DownloadRequest) string {
 		"track_number": req.TrackNumber,
 		"disc":         req.DiscNumber,
 		"disc_number":  req.DiscNumber,
+		"disc_total":   req.TotalDiscs,
 		"year":         extractYear(req.ReleaseDate),
 		"date":         req.ReleaseDate,
 		"release_date": req.ReleaseDate,
@@ -1220,8 +1351,8 @@ func (p *ExtensionProviderWrapper) CustomSearch(query string, options map[string
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	if options == nil {
 		options = map[string]interface{}{}
@@ -1261,6 +1392,11 @@ func (p *ExtensionProviderWrapper) CustomSearch(query string, options map[string
 	}
 
 	exported := result.Export()
+	if list, ok := exported.([]interface{}); ok {
+		if exported, err = normalizeExtensionTrackList(p.extension.ID, list, "results"); err != nil {
+			return nil, fmt.Errorf("customSearch returned malformed results: %w", err)
+		}
+	}
 	jsonBytes, err := json.Marshal(exported)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal result: %w", err)
@@ -1301,8 +1437,8 @@ func (p *ExtensionProviderWrapper) HandleURL(url string) (*ExtURLHandleResult, e
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	script := fmt.Sprintf(`
 		(function() {
@@ -1380,8 +1516,8 @@ func (p *ExtensionProviderWrapper) MatchTrack(sourceTrack map[string]interface{}
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	sourceJSON, _ := json.Marshal(sourceTrack)
 	candidatesJSON, _ := json.Marshal(candidates)
@@ -1450,8 +1586,8 @@ func (p *ExtensionProviderWrapper) PostProcess(filePath string, metadata map[str
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	metadataJSON, _ := json.Marshal(metadata)
 
@@ -1512,8 +1648,8 @@ func (p *ExtensionProviderWrapper) PostProcessV2(input PostProcessInput, metadat
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	metadataJSON, _ := json.Marshal(metadata)
 	inputJSON, _ := json.Marshal(input)
@@ -1777,8 +1913,8 @@ func (p *ExtensionProviderWrapper) FetchLyrics(trackName, artistName, albumName
 		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
 	}
 
-	p.extension.VMMu.Lock()
-	defer p.extension.VMMu.Unlock()
+	release := acquireExtensionVM(p.extension)
+	defer release()
 
 	// Use global variables to avoid JS injection issues with special characters in track/artist names
 	const trackVar = "__sf_lyrics_track"
@@ -1818,8 +1954,56 @@ func (p *ExtensionProviderWrapper) FetchLyrics(trackName, artistName, albumName
 		return nil, fmt.Errorf("fetchLyrics returned null")
 	}
 
-	exported := result.Export()
-	jsonBytes, err := json.Marshal(exported)
+	return p.parseLyricsResult(result)
+}
+
+// GetLyrics calls the extension's optional getLyrics(track) export. track
+// carries id, name, artists, album_name, duration_ms and isrc when known.
+func (p *ExtensionProviderWrapper) GetLyrics(track map[string]interface{}) (*LyricsResponse, error) {
+	if !p.extension.Manifest.HasLyricsSource() {
+		return nil, fmt.Errorf("extension '%s' does not export getLyrics", p.extension.ID)
+	}
+
+	if !p.extension.Enabled {
+		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
+	}
+
+	release := acquireExtensionVM(p.extension)
+	defer release()
+
+	const trackVar = "__sf_get_lyrics_track"
+	global := p.vm.GlobalObject()
+	_ = global.Set(trackVar, track)
+	defer global.Delete(trackVar)
+
+	const script = `
+		(function() {
+			if (typeof extension !== 'undefined' && typeof extension.getLyrics === 'function') {
+				return extension.getLyrics(__sf_get_lyrics_track);
+			}
+			return null;
+		})()
+	`
+
+	result, err := RunWithTimeoutAndRecover(p.vm, script, DefaultJSTimeout)
+	if err != nil {
+		if IsTimeoutError(err) {
+			return nil, fmt.Errorf("getLyrics timeout: extension took too long to respond")
+		}
+		return nil, fmt.Errorf("getLyrics failed: %w", err)
+	}
+
+	if result == nil || goja.IsUndefined(result) || goja.IsNull(result) {
+		return nil, fmt.Errorf("getLyrics returned null")
+	}
+
+	return p.parseLyricsResult(result)
+}
+
+// parseLyricsResult converts a fetchLyrics/getLyrics return value into a
+// LyricsResponse attributed to this extension.
+func (p *ExtensionProviderWrapper) parseLyricsResult(result goja.Value) (*LyricsResponse, error) {
+	jsonBytes, err := json.Marshal(result.Export())
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal lyrics result: %w", err)
 	}
@@ -1867,14 +2051,15 @@ func (p *ExtensionProviderWrapper) FetchLyrics(trackName, artistName, albumName
 	return response, nil
 }
 
-// GetLyricsProviders returns all enabled extensions that provide lyrics
+// GetLyricsProviders returns all enabled extensions that provide lyrics,
+// either as a lyrics_provider or through the getLyrics capability.
 func (m *ExtensionManager) GetLyricsProviders() []*ExtensionProviderWrapper {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	var providers []*ExtensionProviderWrapper
 	for _, ext := range m.extensions {
-		if ext.Enabled && ext.Manifest.IsLyricsProvider() && ext.Error == "" {
+		if ext.Enabled && (ext.Manifest.IsLyricsProvider() || ext.Manifest.HasLyricsSource()) && ext.Error == "" {
 			providers = append(providers, NewExtensionProviderWrapper(ext))
 		}
 	}
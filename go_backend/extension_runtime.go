@@ -30,27 +30,12 @@ type ExtensionAuthState struct {
 	PKCEChallenge   string
 }
 
-type PendingAuthRequest struct {
-	ExtensionID string
-	AuthURL     string
-	CallbackURL string
-}
-
-var (
-	pendingAuthRequests   = make(map[string]*PendingAuthRequest)
-	pendingAuthRequestsMu sync.RWMutex
-)
-
-func GetPendingAuthRequest(extensionID string) *PendingAuthRequest {
-	pendingAuthRequestsMu.RLock()
-	defer pendingAuthRequestsMu.RUnlock()
-	return pendingAuthRequests[extensionID]
-}
-
-func ClearPendingAuthRequest(extensionID string) {
-	pendingAuthRequestsMu.Lock()
-	defer pendingAuthRequestsMu.Unlock()
-	delete(pendingAuthRequests, extensionID)
+// wipe clears every secret the state holds. Go strings cannot be overwritten
+// in place, so this drops the state's references to them; buffers the
+// backend owns (PKCE randomness, token responses) are zeroed where they are
+// used.
+func (s *ExtensionAuthState) wipe() {
+	*s = ExtensionAuthState{}
 }
 
 func SetExtensionAuthCode(extensionID string, authCode string) {
@@ -63,6 +48,9 @@ func SetExtensionAuthCode(extensionID string, authCode string) {
 		extensionAuthState[extensionID] = state
 	}
 	state.AuthCode = authCode
+	if authCode != "" {
+		completeAuthFlow(extensionID)
+	}
 }
 
 func SetExtensionTokens(extensionID string, accessToken, refreshToken string, expiresAt time.Time) {
@@ -83,6 +71,7 @@ func SetExtensionTokens(extensionID string, accessToken, refreshToken string, ex
 type ExtensionRuntime struct {
 	extensionID string
 	manifest    *ExtensionManifest
+	trust       ExtensionTrust
 	settings    map[string]interface{}
 	httpClient  *http.Client
 	cookieJar   http.CookieJar
@@ -101,6 +90,9 @@ type ExtensionRuntime struct {
 	credentialsCache  map[string]interface{}
 	credentialsLoaded bool
 	storageFlushDelay time.Duration
+
+	secretsMu    sync.Mutex
+	secretsCache map[string]string
 }
 
 type privateIPCacheEntry struct {
@@ -125,6 +117,7 @@ func NewExtensionRuntime(ext *LoadedExtension) *ExtensionRuntime {
 	runtime := &ExtensionRuntime{
 		extensionID:       ext.ID,
 		manifest:          ext.Manifest,
+		trust:             ext.Trust,
 		settings:          make(map[string]interface{}),
 		cookieJar:         jar,
 		dataDir:           ext.DataDir,
@@ -135,9 +128,17 @@ func NewExtensionRuntime(ext *LoadedExtension) *ExtensionRuntime {
 	// Extension sandbox enforces HTTPS-only domains. Do not apply global
 	// allow_http scheme downgrade here, because some extension APIs (e.g.
 	// spotify-web) will redirect http -> https and can end up in 301 loops.
-	// We still reuse sharedTransport so insecure TLS compatibility mode remains effective.
+	// We still reuse the shared pool so insecure TLS compatibility mode and
+	// transport tuning remain effective.
+	transport := &hostPolicyTransport{
+		pool:      sharedPool,
+		utlsHosts: ext.Manifest.TLSFingerprintHosts(),
+	}
+	if len(transport.utlsHosts) > 0 {
+		GoLog("[Extension:%s] Using TLS fingerprint for %v\n", ext.ID, transport.utlsHosts)
+	}
 	client := &http.Client{
-		Transport: sharedTransport,
+		Transport: newContentDecodingTransport(transport),
 		Timeout:   30 * time.Second,
 		Jar:       jar,
 	}
@@ -152,7 +153,7 @@ func NewExtensionRuntime(ext *LoadedExtension) *ExtensionRuntime {
 			GoLog("[Extension:%s] Redirect blocked: missing hostname\n", ext.ID)
 			return fmt.Errorf("redirect blocked: hostname is required")
 		}
-		if !ext.Manifest.IsDomainAllowed(domain) {
+		if !runtime.manifestAllowsDomain(domain) {
 			GoLog("[Extension:%s] Redirect blocked: domain '%s' not in allowed list\n", ext.ID, domain)
 			return &RedirectBlockedError{Domain: domain}
 		}
@@ -316,7 +317,11 @@ func (r *ExtensionRuntime) RegisterAPIs(vm *goja.Runtime) {
 	httpObj.Set("delete", r.httpDelete)
 	httpObj.Set("patch", r.httpPatch)
 	httpObj.Set("request", r.httpRequest)
+	httpObj.Set("fetchJSON", r.httpFetchJSON)
 	httpObj.Set("clearCookies", r.httpClearCookies)
+	httpObj.Set("setProfile", r.httpSetProfile)
+	httpObj.Set("defineProfile", r.httpDefineProfile)
+	httpObj.Set("listProfiles", r.httpListProfiles)
 	vm.Set("http", httpObj)
 
 	storageObj := vm.NewObject()
@@ -332,21 +337,55 @@ func (r *ExtensionRuntime) RegisterAPIs(vm *goja.Runtime) {
 	credentialsObj.Set("has", r.credentialsHas)
 	vm.Set("credentials", credentialsObj)
 
+	secretsObj := vm.NewObject()
+	secretsObj.Set("get", r.secretsGet)
+	secretsObj.Set("set", r.secretsSet)
+	secretsObj.Set("remove", r.secretsRemove)
+	secretsObj.Set("has", r.secretsHas)
+	secretsObj.Set("keys", r.secretsKeys)
+	vm.Set("secrets", secretsObj)
+
+	deezerObj := vm.NewObject()
+	deezerObj.Set("isLoggedIn", r.gateDeezer(r.deezerIsLoggedIn))
+	deezerObj.Set("getSession", r.gateDeezer(r.deezerGetSession))
+	deezerObj.Set("refresh", r.gateDeezer(r.deezerRefresh))
+	deezerObj.Set("gateway", r.gateDeezer(r.deezerGateway))
+	vm.Set("deezer", deezerObj)
+
+	qobuzObj := vm.NewObject()
+	qobuzObj.Set("signRequest", r.qobuzSignRequest)
+	qobuzObj.Set("getAppCredentials", r.qobuzGetAppCredentials)
+	vm.Set("qobuz", qobuzObj)
+
+	tidalObj := vm.NewObject()
+	tidalObj.Set("startDeviceLogin", r.gateTidalAuth(r.tidalStartDeviceLogin))
+	tidalObj.Set("pollDeviceLogin", r.gateTidalAuth(r.tidalPollDeviceLogin))
+	tidalObj.Set("refreshToken", r.gateTidalAuth(r.tidalRefreshToken))
+	tidalObj.Set("decodeManifest", r.tidalDecodeManifest)
+	vm.Set("tidal", tidalObj)
+
+	youtubeObj := vm.NewObject()
+	youtubeObj.Set("getAudioFormats", r.youtubeGetAudioFormats)
+	vm.Set("youtube", youtubeObj)
+
 	authObj := vm.NewObject()
-	authObj.Set("openAuthUrl", r.authOpenUrl)
-	authObj.Set("getAuthCode", r.authGetCode)
-	authObj.Set("setAuthCode", r.authSetCode)
-	authObj.Set("clearAuth", r.authClear)
-	authObj.Set("isAuthenticated", r.authIsAuthenticated)
-	authObj.Set("getTokens", r.authGetTokens)
-	authObj.Set("generatePKCE", r.authGeneratePKCE)
-	authObj.Set("getPKCE", r.authGetPKCE)
-	authObj.Set("startOAuthWithPKCE", r.authStartOAuthWithPKCE)
-	authObj.Set("exchangeCodeWithPKCE", r.authExchangeCodeWithPKCE)
+	authObj.Set("openAuthUrl", r.gateAuth(r.authOpenUrl))
+	authObj.Set("getAuthCode", r.gateAuth(r.authGetCode))
+	authObj.Set("setAuthCode", r.gateAuth(r.authSetCode))
+	authObj.Set("clearAuth", r.gateAuth(r.authClear))
+	authObj.Set("isAuthenticated", r.gateAuth(r.authIsAuthenticated))
+	authObj.Set("getTokens", r.gateAuth(r.authGetTokens))
+	authObj.Set("generatePKCE", r.gateAuth(r.authGeneratePKCE))
+	authObj.Set("getPKCE", r.gateAuth(r.authGetPKCE))
+	authObj.Set("startOAuthWithPKCE", r.gateAuth(r.authStartOAuthWithPKCE))
+	authObj.Set("exchangeCodeWithPKCE", r.gateAuth(r.authExchangeCodeWithPKCE))
+	authObj.Set("getFlowStatus", r.gateAuth(r.authGetFlowStatus))
 	vm.Set("auth", authObj)
 
 	fileObj := vm.NewObject()
 	fileObj.Set("download", r.fileDownload)
+	fileObj.Set("downloadStream", r.fileDownloadStream)
+	fileObj.Set("decrypt", r.fileDecrypt)
 	fileObj.Set("exists", r.fileExists)
 	fileObj.Set("delete", r.fileDelete)
 	fileObj.Set("read", r.fileRead)
@@ -366,8 +405,28 @@ func (r *ExtensionRuntime) RegisterAPIs(vm *goja.Runtime) {
 	matchingObj.Set("compareStrings", r.matchingCompareStrings)
 	matchingObj.Set("compareDuration", r.matchingCompareDuration)
 	matchingObj.Set("normalizeString", r.matchingNormalizeString)
+	matchingObj.Set("bestMatch", r.matchingBestMatch)
+	matchingObj.Set("compareArtists", r.matchingCompareArtists)
+	matchingObj.Set("matchAlbum", r.matchingMatchAlbum)
+	matchingObj.Set("detectVersion", r.matchingDetectVersion)
+	matchingObj.Set("buildQueries", r.matchingBuildQueries)
 	vm.Set("matching", matchingObj)
 
+	coversObj := vm.NewObject()
+	coversObj.Set("getArtistImage", r.coversGetArtistImage)
+	coversObj.Set("upgradeURL", r.coversUpgradeURL)
+	vm.Set("covers", coversObj)
+
+	spotifyObj := vm.NewObject()
+	spotifyObj.Set("getToken", r.spotifyGetToken)
+	spotifyObj.Set("invalidateToken", r.spotifyInvalidateToken)
+	vm.Set("spotify", spotifyObj)
+
+	lookupObj := vm.NewObject()
+	lookupObj.Set("isrc", r.lookupISRC)
+	lookupObj.Set("upc", r.lookupUPC)
+	vm.Set("lookup", lookupObj)
+
 	utilsObj := vm.NewObject()
 	utilsObj.Set("base64Encode", r.base64Encode)
 	utilsObj.Set("base64Decode", r.base64Decode)
@@ -68,6 +68,12 @@ func (r *ExtensionRuntime) authOpenUrl(call goja.FunctionCall) goja.Value {
 	if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) {
 		callbackURL = call.Arguments[1].String()
 	}
+	var timeoutOption interface{}
+	if len(call.Arguments) > 2 {
+		if options, ok := call.Arguments[2].Export().(map[string]interface{}); ok {
+			timeoutOption = options["timeoutSeconds"]
+		}
+	}
 
 	if err := validateExtensionAuthURL(authURL); err != nil {
 		return r.vm.ToValue(map[string]interface{}{
@@ -76,13 +82,7 @@ func (r *ExtensionRuntime) authOpenUrl(call goja.FunctionCall) goja.Value {
 		})
 	}
 
-	pendingAuthRequestsMu.Lock()
-	pendingAuthRequests[r.extensionID] = &PendingAuthRequest{
-		ExtensionID: r.extensionID,
-		AuthURL:     authURL,
-		CallbackURL: callbackURL,
-	}
-	pendingAuthRequestsMu.Unlock()
+	req := startAuthFlow(r.extensionID, authURL, callbackURL, authFlowTimeout(timeoutOption))
 
 	extensionAuthStateMu.Lock()
 	state, exists := extensionAuthState[r.extensionID]
@@ -99,6 +99,7 @@ func (r *ExtensionRuntime) authOpenUrl(call goja.FunctionCall) goja.Value {
 	return r.vm.ToValue(map[string]interface{}{
 		"success": true,
 		"message": "Auth URL will be opened by the app",
+		"flowId":  req.ID,
 	})
 }
 
@@ -130,12 +131,17 @@ func (r *ExtensionRuntime) authSetCode(call goja.FunctionCall) goja.Value {
 		extensionAuthState[r.extensionID] = state
 	}
 
+	// Only a code comes back from the browser; token writes may just be a
+	// refresh and say nothing about a pending sign-in.
+	codeArrived := false
 	switch v := arg.(type) {
 	case string:
 		state.AuthCode = v
+		codeArrived = v != ""
 	case map[string]interface{}:
 		if code, ok := v["code"].(string); ok {
 			state.AuthCode = code
+			codeArrived = code != ""
 		}
 		if accessToken, ok := v["access_token"].(string); ok {
 			state.AccessToken = accessToken
@@ -148,23 +154,50 @@ func (r *ExtensionRuntime) authSetCode(call goja.FunctionCall) goja.Value {
 			state.ExpiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
 		}
 	}
+	if codeArrived {
+		completeAuthFlow(r.extensionID)
+	}
 
 	return r.vm.ToValue(true)
 }
 
 func (r *ExtensionRuntime) authClear(call goja.FunctionCall) goja.Value {
 	extensionAuthStateMu.Lock()
+	if state, ok := extensionAuthState[r.extensionID]; ok {
+		state.wipe()
+	}
 	delete(extensionAuthState, r.extensionID)
 	extensionAuthStateMu.Unlock()
 
-	pendingAuthRequestsMu.Lock()
-	delete(pendingAuthRequests, r.extensionID)
-	pendingAuthRequestsMu.Unlock()
+	forgetAuthFlow(r.extensionID)
+	ClearPendingAuthRequest(r.extensionID)
+	r.dropTidalDeviceLogin()
 
 	GoLog("[Extension:%s] Auth state cleared\n", r.extensionID)
 	return r.vm.ToValue(true)
 }
 
+// authGetFlowStatus reports the latest auth flow: none, pending, succeeded,
+// cancelled or expired.
+func (r *ExtensionRuntime) authGetFlowStatus(call goja.FunctionCall) goja.Value {
+	flow := GetAuthFlowStatus(r.extensionID)
+	result := map[string]interface{}{
+		"status": flow.Status,
+	}
+	if flow.Status != AuthFlowNone {
+		result["flowId"] = flow.RequestID
+		result["startedAt"] = flow.StartedAt
+		result["deadline"] = flow.Deadline
+	}
+	if flow.EndedAt != 0 {
+		result["endedAt"] = flow.EndedAt
+	}
+	if flow.Reason != "" {
+		result["reason"] = flow.Reason
+	}
+	return r.vm.ToValue(result)
+}
+
 func (r *ExtensionRuntime) authIsAuthenticated(call goja.FunctionCall) goja.Value {
 	extensionAuthStateMu.RLock()
 	defer extensionAuthStateMu.RUnlock()
@@ -217,6 +250,7 @@ func generatePKCEVerifier(length int) (string, error) {
 	}
 
 	bytes := make([]byte, length)
+	defer zeroBytes(bytes)
 	if _, err := rand.Read(bytes); err != nil {
 		return "", err
 	}
@@ -231,11 +265,19 @@ func generatePKCEVerifier(length int) (string, error) {
 }
 
 func generatePKCEChallenge(verifier string) string {
-	hash := sha256.Sum256([]byte(verifier))
+	raw := []byte(verifier)
+	defer zeroBytes(raw)
+	hash := sha256.Sum256(raw)
+	defer zeroBytes(hash[:])
 	// Base64url encode without padding (RFC 7636)
 	return base64.RawURLEncoding.EncodeToString(hash[:])
 }
 
+// zeroBytes overwrites a buffer that held secret material.
+func zeroBytes(b []byte) {
+	clear(b)
+}
+
 func (r *ExtensionRuntime) authGeneratePKCE(call goja.FunctionCall) goja.Value {
 	length := 64
 	if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) {
@@ -373,19 +415,15 @@ func (r *ExtensionRuntime) authStartOAuthWithPKCE(call goja.FunctionCall) goja.V
 	parsedURL.RawQuery = query.Encode()
 	fullAuthURL := parsedURL.String()
 
-	pendingAuthRequestsMu.Lock()
-	pendingAuthRequests[r.extensionID] = &PendingAuthRequest{
-		ExtensionID: r.extensionID,
-		AuthURL:     fullAuthURL,
-		CallbackURL: redirectURI,
-	}
-	pendingAuthRequestsMu.Unlock()
+	req := startAuthFlow(r.extensionID, fullAuthURL, redirectURI, authFlowTimeout(config["timeoutSeconds"]))
+	supersedeAuthRequests(r.extensionID, req.ID)
 
 	GoLog("[Extension:%s] PKCE OAuth started: %s\n", r.extensionID, summarizeURLForLog(fullAuthURL))
 
 	return r.vm.ToValue(map[string]interface{}{
 		"success": true,
 		"authUrl": fullAuthURL,
+		"flowId":  req.ID,
 		"pkce": map[string]interface{}{
 			"verifier":  verifier,
 			"challenge": challenge,
@@ -473,7 +511,7 @@ func (r *ExtensionRuntime) authExchangeCodeWithPKCE(call goja.FunctionCall) goja
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("User-Agent", "SpotiFLAC-Extension/1.0")
+	applyHeaderProfile(r.extensionID, req, defaultExtensionUserAgent)
 
 	resp, err := r.httpClient.Do(req)
 	if err != nil {
@@ -491,6 +529,7 @@ func (r *ExtensionRuntime) authExchangeCodeWithPKCE(call goja.FunctionCall) goja
 			"error":   err.Error(),
 		})
 	}
+	defer zeroBytes(body)
 	bodyPreview := sanitizeSensitiveLogText(string(body))
 	if len(bodyPreview) > 1000 {
 		bodyPreview = bodyPreview[:1000] + "...[truncated]"
@@ -541,6 +580,7 @@ func (r *ExtensionRuntime) authExchangeCodeWithPKCE(call goja.FunctionCall) goja
 	state.PKCEVerifier = ""
 	state.PKCEChallenge = ""
 	extensionAuthStateMu.Unlock()
+	completeAuthFlow(r.extensionID)
 
 	GoLog("[Extension:%s] PKCE token exchange successful\n", r.extensionID)
 
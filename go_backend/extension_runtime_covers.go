@@ -0,0 +1,35 @@
+// Package gobackend provides Cover/Artwork API for extension runtime
+package gobackend
+
+import (
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Covers API ====================
+
+func (r *ExtensionRuntime) coversGetArtistImage(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return goja.Null()
+	}
+
+	artistName := strings.TrimSpace(call.Arguments[0].String())
+	if artistName == "" {
+		return goja.Null()
+	}
+
+	imageURL, err := GetArtistImageURL(artistName, true)
+	if err != nil {
+		GoLog("[Extension:%s] covers.getArtistImage failed for %q: %v\n", r.extensionID, artistName, err)
+		return goja.Null()
+	}
+	return r.vm.ToValue(imageURL)
+}
+
+func (r *ExtensionRuntime) coversUpgradeURL(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return r.vm.ToValue("")
+	}
+	return r.vm.ToValue(GetCoverFromSpotify(call.Arguments[0].String(), true))
+}
@@ -0,0 +1,99 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Deezer binding ====================
+//
+// deezer.isLoggedIn/getSession/refresh/gateway share the app's ARL session
+// (see deezer_arl.go) so extensions do not ask for the cookie themselves.
+// The ARL is never handed out; getSession returns the api and license
+// tokens, and gateway calls gw-light with the cookie attached. Only signed
+// (or user-trusted) extensions that declare Deezer network access get it.
+
+const deezerBindingDomain = "www.deezer.com"
+
+func (r *ExtensionRuntime) gateDeezer(fn func(goja.FunctionCall) goja.Value) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		msg := ""
+		if extensionRestricted(r.extensionID, r.trust) {
+			msg = "deezer API is not available to unsigned extensions"
+		} else if !r.manifestAllowsDomain(deezerBindingDomain) {
+			msg = "deezer API requires network permission for " + deezerBindingDomain
+		}
+		if msg != "" {
+			GoLog("[Extension:%s] Deezer API denied: %s\n", r.extensionID, msg)
+			return r.vm.ToValue(map[string]interface{}{"success": false, "error": msg})
+		}
+		return fn(call)
+	}
+}
+
+func (r *ExtensionRuntime) deezerSessionValue(session *deezerSession, err error) goja.Value {
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"expired": errors.Is(err, errDeezerSessionExpired),
+			"error":   err.Error(),
+		})
+	}
+	return r.vm.ToValue(map[string]interface{}{
+		"success":           true,
+		"userId":            session.account.UserID,
+		"userName":          session.account.UserName,
+		"country":           session.account.Country,
+		"offer":             session.account.Offer,
+		"canStreamHQ":       session.account.CanStreamHQ,
+		"canStreamLossless": session.account.CanStreamLossless,
+		"apiToken":          session.apiToken,
+		"licenseToken":      session.licenseToken,
+		"licenseExpiresAt":  session.account.LicenseExpiresAt,
+	})
+}
+
+func (r *ExtensionRuntime) deezerIsLoggedIn(call goja.FunctionCall) goja.Value {
+	_, err := currentDeezerSession(false)
+	return r.vm.ToValue(err == nil)
+}
+
+func (r *ExtensionRuntime) deezerGetSession(call goja.FunctionCall) goja.Value {
+	return r.deezerSessionValue(currentDeezerSession(false))
+}
+
+func (r *ExtensionRuntime) deezerRefresh(call goja.FunctionCall) goja.Value {
+	return r.deezerSessionValue(currentDeezerSession(true))
+}
+
+// deezerGateway is deezer.gateway(method, params).
+func (r *ExtensionRuntime) deezerGateway(call goja.FunctionCall) goja.Value {
+	fail := func(err error) goja.Value {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"expired": errors.Is(err, errDeezerSessionExpired),
+			"error":   err.Error(),
+		})
+	}
+	if len(call.Arguments) < 1 {
+		return fail(errors.New("method is required"))
+	}
+	var params interface{}
+	if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) && !goja.IsNull(call.Arguments[1]) {
+		params = call.Arguments[1].Export()
+	}
+	raw, err := DeezerGatewayCall(call.Arguments[0].String(), params)
+	if err != nil {
+		GoLog("[Extension:%s] Deezer gateway error: %v\n", r.extensionID, err)
+		return fail(err)
+	}
+	var results interface{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &results); err != nil {
+			return fail(err)
+		}
+	}
+	return r.vm.ToValue(map[string]interface{}{"success": true, "results": results})
+}
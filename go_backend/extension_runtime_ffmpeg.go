@@ -54,63 +54,74 @@ func ClearFFmpegCommand(commandID string) {
 	delete(ffmpegCommands, commandID)
 }
 
-func (r *ExtensionRuntime) ffmpegExecute(call goja.FunctionCall) goja.Value {
-	if len(call.Arguments) < 1 {
-		return r.vm.ToValue(map[string]interface{}{
-			"success": false,
-			"error":   "command is required",
-		})
-	}
-
-	command := call.Arguments[0].String()
-
+// runQueuedFFmpeg queues a command for Flutter's FFmpeg and waits until it
+// reports back or timeout passes. The returned command is a completed copy.
+func runQueuedFFmpeg(ownerID, command, inputPath, outputPath string, timeout time.Duration) (*FFmpegCommand, error) {
 	ffmpegCommandsMu.Lock()
 	ffmpegCommandID++
-	cmdID := fmt.Sprintf("%s_%d", r.extensionID, ffmpegCommandID)
+	cmdID := fmt.Sprintf("%s_%d", ownerID, ffmpegCommandID)
 	ffmpegCommands[cmdID] = &FFmpegCommand{
-		ExtensionID: r.extensionID,
+		ExtensionID: ownerID,
 		Command:     command,
+		InputPath:   inputPath,
+		OutputPath:  outputPath,
 		Completed:   false,
 	}
 	ffmpegCommandsMu.Unlock()
+	defer ClearFFmpegCommand(cmdID)
 
-	GoLog("[Extension:%s] FFmpeg command queued: %s\n", r.extensionID, cmdID)
+	GoLog("[Extension:%s] FFmpeg command queued: %s\n", ownerID, cmdID)
 
-	timeout := 5 * time.Minute
 	start := time.Now()
 	for {
 		ffmpegCommandsMu.RLock()
 		cmd := ffmpegCommands[cmdID]
-		completed := cmd != nil && cmd.Completed
+		var done *FFmpegCommand
+		if cmd != nil && cmd.Completed {
+			copied := *cmd
+			done = &copied
+		}
 		ffmpegCommandsMu.RUnlock()
 
-		if completed {
-			ffmpegCommandsMu.RLock()
-			result := map[string]interface{}{
-				"success": cmd.Success,
-				"output":  cmd.Output,
-			}
-			if cmd.Error != "" {
-				result["error"] = cmd.Error
-			}
-			ffmpegCommandsMu.RUnlock()
-
-			ClearFFmpegCommand(cmdID)
-			return r.vm.ToValue(result)
+		if done != nil {
+			return done, nil
 		}
-
 		if time.Since(start) > timeout {
-			ClearFFmpegCommand(cmdID)
-			return r.vm.ToValue(map[string]interface{}{
-				"success": false,
-				"error":   "FFmpeg command timed out",
-			})
+			return nil, fmt.Errorf("FFmpeg command timed out")
 		}
 
 		time.Sleep(100 * time.Millisecond)
 	}
 }
 
+func (r *ExtensionRuntime) ffmpegExecute(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   "command is required",
+		})
+	}
+
+	command := call.Arguments[0].String()
+
+	cmd, err := runQueuedFFmpeg(r.extensionID, command, "", "", 5*time.Minute)
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	result := map[string]interface{}{
+		"success": cmd.Success,
+		"output":  cmd.Output,
+	}
+	if cmd.Error != "" {
+		result["error"] = cmd.Error
+	}
+	return r.vm.ToValue(result)
+}
+
 func (r *ExtensionRuntime) ffmpegGetInfo(call goja.FunctionCall) goja.Value {
 	if len(call.Arguments) < 1 {
 		return r.vm.ToValue(map[string]interface{}{
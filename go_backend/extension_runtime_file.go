@@ -2,6 +2,8 @@
 package gobackend
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
@@ -137,6 +139,7 @@ func (r *ExtensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 
 	var onProgress goja.Callable
 	var headers map[string]string
+	var decrypt *DecryptionParams
 	if len(call.Arguments) > 2 && !goja.IsUndefined(call.Arguments[2]) && !goja.IsNull(call.Arguments[2]) {
 		optionsObj := call.Arguments[2].Export()
 		if opts, ok := optionsObj.(map[string]interface{}); ok {
@@ -151,6 +154,14 @@ func (r *ExtensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 					onProgress = callable
 				}
 			}
+			if d, ok := opts["decrypt"]; ok && d != nil {
+				if decrypt, err = r.decryptionParams(d); err != nil {
+					return r.vm.ToValue(map[string]interface{}{
+						"success": false,
+						"error":   err.Error(),
+					})
+				}
+			}
 		}
 	}
 
@@ -173,9 +184,7 @@ func (r *ExtensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
-	if req.Header.Get("User-Agent") == "" {
-		req.Header.Set("User-Agent", "SpotiFLAC-Extension/1.0")
-	}
+	applyHeaderProfile(r.extensionID, req, defaultExtensionUserAgent)
 
 	resp, err := r.httpClient.Do(req)
 	if err != nil {
@@ -204,10 +213,21 @@ func (r *ExtensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 
 	contentLength := resp.ContentLength
 
+	var body io.Reader = resp.Body
+	if decrypt != nil {
+		if body, err = newDecryptingReader(resp.Body, *decrypt); err != nil {
+			return r.vm.ToValue(map[string]interface{}{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+	}
+
 	var written int64
+	hasher := newDownloadHasher()
 	buf := make([]byte, 32*1024)
 	for {
-		nr, er := resp.Body.Read(buf)
+		nr, er := body.Read(buf)
 		if nr > 0 {
 			nw, ew := out.Write(buf[0:nr])
 			if nw < 0 || nr < nw {
@@ -217,6 +237,7 @@ func (r *ExtensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 				}
 			}
 			written += int64(nw)
+			hasher.Write(buf[0:nw])
 			if ew != nil {
 				return r.vm.ToValue(map[string]interface{}{
 					"success": false,
@@ -246,11 +267,250 @@ func (r *ExtensionRuntime) fileDownload(call goja.FunctionCall) goja.Value {
 	}
 
 	GoLog("[Extension:%s] Downloaded %d bytes to %s\n", r.extensionID, written, fullPath)
+	hashes := hasher.Sum()
 
 	return r.vm.ToValue(map[string]interface{}{
 		"success": true,
 		"path":    fullPath,
 		"size":    written,
+		"md5":     hashes.MD5,
+		"sha256":  hashes.SHA256,
+	})
+}
+
+// decryptionParams converts a JS {scheme, key, iv, keyEncoding, chunkSize,
+// interval} object and checks the scheme against the manifest.
+func (r *ExtensionRuntime) decryptionParams(v interface{}) (*DecryptionParams, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("decrypt must be an object")
+	}
+	params := &DecryptionParams{}
+	params.Scheme, _ = obj["scheme"].(string)
+	params.Key, _ = obj["key"].(string)
+	params.IV, _ = obj["iv"].(string)
+	params.KeyEncoding, _ = obj["keyEncoding"].(string)
+	params.ChunkSize, _ = exportInt(obj["chunkSize"])
+	params.Interval, _ = exportInt(obj["interval"])
+
+	scheme := strings.ToLower(params.Scheme)
+	for _, declared := range r.manifest.DecryptionSchemes() {
+		if declared == scheme {
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("decryption scheme %q is not declared in the extension manifest", params.Scheme)
+}
+
+// fileDecrypt decrypts a downloaded file into another sandboxed path:
+// file.decrypt(inputPath, outputPath, {scheme, key, iv, ...})
+func (r *ExtensionRuntime) fileDecrypt(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 3 {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   "input path, output path and decryption options are required",
+		})
+	}
+
+	inputPath, err := r.validatePath(call.Arguments[0].String())
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	outputPath, err := r.validatePath(call.Arguments[1].String())
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if inputPath == outputPath {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   "input and output must be different files",
+		})
+	}
+	params, err := r.decryptionParams(call.Arguments[2].Export())
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("failed to open input: %v", err),
+		})
+	}
+	defer in.Close()
+
+	plain, err := newDecryptingReader(in, *params)
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("failed to create file: %v", err),
+		})
+	}
+	written, err := io.Copy(out, plain)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("decryption failed: %v", err),
+		})
+	}
+
+	GoLog("[Extension:%s] Decrypted %d bytes (%s) to %s\n", r.extensionID, written, params.Scheme, outputPath)
+
+	return r.vm.ToValue(map[string]interface{}{
+		"success": true,
+		"path":    outputPath,
+		"size":    written,
+	})
+}
+
+// decodeStreamKey accepts a 16-byte key as hex (optionally 0x-prefixed) or
+// base64.
+func decodeStreamKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")); err == nil {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key must be hex or base64")
+}
+
+// fileDownloadStream downloads an HLS or DASH manifest into a single file:
+// file.downloadStream(manifestUrl, outputPath, {type, headers, key, keys, itemId, onProgress})
+func (r *ExtensionRuntime) fileDownloadStream(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 2 {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   "manifest URL and output path are required",
+		})
+	}
+
+	manifestURL := call.Arguments[0].String()
+	outputPath := call.Arguments[1].String()
+
+	if err := r.validateDomain(manifestURL); err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	fullPath, err := r.validatePath(outputPath)
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	opts := StreamDownloadOptions{
+		ManifestURL: manifestURL,
+		OutputPath:  fullPath,
+		Headers:     make(map[string]string),
+		Keys:        make(map[string][]byte),
+		AllowURL:    r.validateDomain,
+		PrepareRequest: func(req *http.Request) {
+			applyHeaderProfile(r.extensionID, req, defaultExtensionUserAgent)
+		},
+	}
+
+	var onProgress goja.Callable
+	if len(call.Arguments) > 2 && !goja.IsUndefined(call.Arguments[2]) && !goja.IsNull(call.Arguments[2]) {
+		if o, ok := call.Arguments[2].Export().(map[string]interface{}); ok {
+			if kind, ok := o["type"].(string); ok {
+				opts.Kind = kind
+			}
+			if itemID, ok := o["itemId"].(string); ok {
+				opts.ItemID = itemID
+			}
+			if h, ok := o["headers"].(map[string]interface{}); ok {
+				for k, v := range h {
+					opts.Headers[k] = fmt.Sprintf("%v", v)
+				}
+			}
+			if k, ok := o["key"].(string); ok && k != "" {
+				if opts.Key, err = decodeStreamKey(k); err != nil {
+					return r.vm.ToValue(map[string]interface{}{
+						"success": false,
+						"error":   err.Error(),
+					})
+				}
+			}
+			if keys, ok := o["keys"].(map[string]interface{}); ok {
+				for uri, v := range keys {
+					key, err := decodeStreamKey(fmt.Sprintf("%v", v))
+					if err != nil {
+						return r.vm.ToValue(map[string]interface{}{
+							"success": false,
+							"error":   fmt.Sprintf("keys[%q]: %v", uri, err),
+						})
+					}
+					opts.Keys[uri] = key
+				}
+			}
+			if progressVal, ok := o["onProgress"]; ok {
+				if callable, ok := goja.AssertFunction(r.vm.ToValue(progressVal)); ok {
+					onProgress = callable
+				}
+			}
+		}
+	}
+	if onProgress != nil {
+		opts.OnSegment = func(done, total int, written int64) {
+			_, _ = onProgress(goja.Undefined(), r.vm.ToValue(done), r.vm.ToValue(total), r.vm.ToValue(written))
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   fmt.Sprintf("failed to create directory: %v", err),
+		})
+	}
+
+	result, err := downloadManifestStream(downloadContext(opts.ItemID), r.httpClient, opts)
+	if err != nil {
+		cleanupOutputOnError(fullPath, 0)
+		GoLog("[Extension:%s] Stream download failed: %v\n", r.extensionID, err)
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	GoLog("[Extension:%s] Downloaded %d segments (%d bytes) to %s\n", r.extensionID, result.Segments, result.Bytes, fullPath)
+
+	return r.vm.ToValue(map[string]interface{}{
+		"success":   true,
+		"path":      fullPath,
+		"size":      result.Bytes,
+		"segments":  result.Segments,
+		"container": result.Container,
+		"codecs":    result.Codecs,
 	})
 }
 
@@ -42,11 +42,13 @@ func (r *ExtensionRuntime) validateDomain(urlStr string) error {
 	}
 
 	if isPrivateIP(domain) {
+		recordDomainDenial(r.extensionID, urlStr, domain, "private network", false)
 		return fmt.Errorf("network access denied: private/local network '%s' not allowed", domain)
 	}
 
-	if !r.manifest.IsDomainAllowed(domain) {
-		return fmt.Errorf("network access denied: domain '%s' not in allowed list", domain)
+	if !r.manifestAllowsDomain(domain) && !isDomainApproved(r.extensionID, domain) {
+		recordDomainDenial(r.extensionID, urlStr, domain, "not in allowed list", true)
+		return fmt.Errorf("network access denied: domain '%s' not in allowed list (approval requested)", domain)
 	}
 
 	return nil
@@ -89,9 +91,7 @@ func (r *ExtensionRuntime) httpGet(call goja.FunctionCall) goja.Value {
 		req.Header.Set(k, v)
 	}
 
-	if req.Header.Get("User-Agent") == "" {
-		req.Header.Set("User-Agent", "Spotiflac-Extension/1.0")
-	}
+	applyHeaderProfile(r.extensionID, req, extensionHTTPUserAgent)
 
 	resp, err := r.httpClient.Do(req)
 	if err != nil {
@@ -182,9 +182,7 @@ func (r *ExtensionRuntime) httpPost(call goja.FunctionCall) goja.Value {
 		req.Header.Set(k, v)
 	}
 
-	if req.Header.Get("User-Agent") == "" {
-		req.Header.Set("User-Agent", "Spotiflac-Extension/1.0")
-	}
+	applyHeaderProfile(r.extensionID, req, extensionHTTPUserAgent)
 	if req.Header.Get("Content-Type") == "" {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -290,9 +288,7 @@ func (r *ExtensionRuntime) httpRequest(call goja.FunctionCall) goja.Value {
 		req.Header.Set(k, v)
 	}
 
-	if req.Header.Get("User-Agent") == "" {
-		req.Header.Set("User-Agent", "Spotiflac-Extension/1.0")
-	}
+	applyHeaderProfile(r.extensionID, req, extensionHTTPUserAgent)
 	if bodyStr != "" && req.Header.Get("Content-Type") == "" {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -414,9 +410,7 @@ func (r *ExtensionRuntime) httpMethodShortcut(method string, call goja.FunctionC
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
-	if req.Header.Get("User-Agent") == "" {
-		req.Header.Set("User-Agent", "Spotiflac-Extension/1.0")
-	}
+	applyHeaderProfile(r.extensionID, req, extensionHTTPUserAgent)
 	if bodyStr != "" && req.Header.Get("Content-Type") == "" {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -464,3 +458,90 @@ func (r *ExtensionRuntime) httpClearCookies(call goja.FunctionCall) goja.Value {
 	}
 	return r.vm.ToValue(false)
 }
+
+// httpSetProfile selects a header profile for all requests, or for one host
+// (and its subdomains) with {host: "api.example.com"}.
+func (r *ExtensionRuntime) httpSetProfile(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   "profile name is required",
+		})
+	}
+	name := call.Arguments[0].String()
+
+	host := ""
+	if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) && !goja.IsNull(call.Arguments[1]) {
+		if opts, ok := call.Arguments[1].Export().(map[string]interface{}); ok {
+			host, _ = opts["host"].(string)
+		}
+	}
+
+	config := getExtensionHeaderConfig(r.extensionID)
+	if host != "" {
+		config.HostProfiles[host] = name
+	} else {
+		config.Profile = name
+	}
+	if err := setExtensionHeaderConfig(r.extensionID, config); err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	GoLog("[Extension:%s] Header profile %s selected (host=%q)\n", r.extensionID, name, host)
+	return r.vm.ToValue(map[string]interface{}{
+		"success": true,
+	})
+}
+
+// httpDefineProfile registers a custom profile:
+// http.defineProfile(name, {userAgent, headers})
+func (r *ExtensionRuntime) httpDefineProfile(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 2 {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   "profile name and options are required",
+		})
+	}
+	name := strings.TrimSpace(call.Arguments[0].String())
+	if name == "" {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   "profile name is required",
+		})
+	}
+
+	var profile HeaderProfile
+	if opts, ok := call.Arguments[1].Export().(map[string]interface{}); ok {
+		profile.UserAgent, _ = opts["userAgent"].(string)
+		if h, ok := opts["headers"].(map[string]interface{}); ok {
+			profile.Headers = make(map[string]string, len(h))
+			for k, v := range h {
+				profile.Headers[k] = fmt.Sprintf("%v", v)
+			}
+		}
+	}
+
+	config := getExtensionHeaderConfig(r.extensionID)
+	config.Custom[name] = profile
+	if err := setExtensionHeaderConfig(r.extensionID, config); err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	return r.vm.ToValue(map[string]interface{}{
+		"success": true,
+	})
+}
+
+func (r *ExtensionRuntime) httpListProfiles(call goja.FunctionCall) goja.Value {
+	config := getExtensionHeaderConfig(r.extensionID)
+	return r.vm.ToValue(map[string]interface{}{
+		"profiles":     headerProfileNames(r.extensionID),
+		"active":       config.Profile,
+		"hostProfiles": config.HostProfiles,
+	})
+}
@@ -0,0 +1,323 @@
+// Package gobackend provides streaming JSON fetch for extension runtime
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Streaming JSON API ====================
+//
+// http.fetchJSON(url, {jsonPath, offset, limit, method, headers, body})
+// decodes the response as a stream and only materializes the selected
+// subtree. When the selection is an array, at most `limit` elements starting
+// at `offset` are returned together with paging info, so a 10k-entry
+// playlist never exists as one giant JS string or object.
+
+const (
+	defaultFetchJSONLimit = 500
+	maxFetchJSONLimit     = 5000
+)
+
+type jsonSelection struct {
+	Found   bool
+	IsArray bool
+	Value   interface{}
+	Items   []interface{}
+	Total   int
+}
+
+// parseJSONPath turns "$.data.items[0].tracks" into ["data", "items", "0",
+// "tracks"]. An empty path selects the document root.
+func parseJSONPath(path string) []string {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+
+	var segments []string
+	for _, seg := range strings.Split(path, ".") {
+		seg = strings.Trim(strings.TrimSpace(seg), `"'`)
+		if seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// skipJSONValue consumes the next value from dec without buffering it.
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// descendJSONPath advances dec to the start of the value at path. It reports
+// false when the path does not exist.
+func descendJSONPath(dec *json.Decoder, path []string) (bool, error) {
+	for _, seg := range path {
+		tok, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+		delim, ok := tok.(json.Delim)
+		if !ok {
+			return false, nil
+		}
+
+		switch delim {
+		case '{':
+			found := false
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return false, err
+				}
+				if key, _ := keyTok.(string); key == seg {
+					found = true
+					break
+				}
+				if err := skipJSONValue(dec); err != nil {
+					return false, err
+				}
+			}
+			if !found {
+				return false, nil
+			}
+		case '[':
+			index, err := strconv.Atoi(seg)
+			if err != nil || index < 0 {
+				return false, nil
+			}
+			for i := 0; i < index; i++ {
+				if !dec.More() {
+					return false, nil
+				}
+				if err := skipJSONValue(dec); err != nil {
+					return false, err
+				}
+			}
+			if !dec.More() {
+				return false, nil
+			}
+		default:
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// streamSelectJSON reads r and returns the value at path. Arrays are paged:
+// only elements in [offset, offset+limit) are decoded, the rest are skipped
+// but still counted so the caller learns the total.
+func streamSelectJSON(r io.Reader, path []string, offset, limit int) (*jsonSelection, error) {
+	dec := json.NewDecoder(r)
+
+	found, err := descendJSONPath(dec, path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if !found {
+		return &jsonSelection{}, nil
+	}
+
+	// Peek at the selected value: arrays are paged, anything else is
+	// decoded whole.
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	delim, isDelim := tok.(json.Delim)
+	if !isDelim {
+		return &jsonSelection{Found: true, Value: tok}, nil
+	}
+
+	if delim == '{' {
+		obj := make(map[string]interface{})
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON: %w", err)
+			}
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return nil, fmt.Errorf("invalid JSON: %w", err)
+			}
+			obj[keyTok.(string)] = v
+		}
+		return &jsonSelection{Found: true, Value: obj}, nil
+	}
+
+	sel := &jsonSelection{Found: true, IsArray: true, Items: []interface{}{}}
+	for i := 0; dec.More(); i++ {
+		if i >= offset && len(sel.Items) < limit {
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return nil, fmt.Errorf("invalid JSON at index %d: %w", i, err)
+			}
+			sel.Items = append(sel.Items, v)
+		} else if err := skipJSONValue(dec); err != nil {
+			return nil, fmt.Errorf("invalid JSON at index %d: %w", i, err)
+		}
+		sel.Total++
+	}
+	return sel, nil
+}
+
+func exportInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	case int:
+		return n, true
+	}
+	return 0, false
+}
+
+func (r *ExtensionRuntime) httpFetchJSON(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return r.vm.ToValue(map[string]interface{}{
+			"error": "URL is required",
+		})
+	}
+
+	urlStr := call.Arguments[0].String()
+
+	if err := r.validateDomain(urlStr); err != nil {
+		GoLog("[Extension:%s] HTTP blocked: %v\n", r.extensionID, err)
+		return r.vm.ToValue(map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	method := "GET"
+	jsonPath := ""
+	offset := 0
+	limit := defaultFetchJSONLimit
+	var bodyStr string
+	headers := make(map[string]string)
+
+	if len(call.Arguments) > 1 && !goja.IsUndefined(call.Arguments[1]) && !goja.IsNull(call.Arguments[1]) {
+		if opts, ok := call.Arguments[1].Export().(map[string]interface{}); ok {
+			if m, ok := opts["method"].(string); ok {
+				method = strings.ToUpper(m)
+			}
+			if p, ok := opts["jsonPath"].(string); ok {
+				jsonPath = p
+			}
+			if n, ok := exportInt(opts["offset"]); ok && n > 0 {
+				offset = n
+			}
+			if n, ok := exportInt(opts["limit"]); ok && n > 0 {
+				limit = min(n, maxFetchJSONLimit)
+			}
+			if bodyArg, ok := opts["body"]; ok && bodyArg != nil {
+				switch v := bodyArg.(type) {
+				case string:
+					bodyStr = v
+				default:
+					jsonBytes, err := json.Marshal(v)
+					if err != nil {
+						return r.vm.ToValue(map[string]interface{}{
+							"error": fmt.Sprintf("failed to stringify body: %v", err),
+						})
+					}
+					bodyStr = string(jsonBytes)
+				}
+			}
+			if h, ok := opts["headers"].(map[string]interface{}); ok {
+				for k, v := range h {
+					headers[k] = fmt.Sprintf("%v", v)
+				}
+			}
+		}
+	}
+
+	var reqBody io.Reader
+	if bodyStr != "" {
+		reqBody = strings.NewReader(bodyStr)
+	}
+
+	req, err := http.NewRequest(method, urlStr, reqBody)
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	applyHeaderProfile(r.extensionID, req, extensionHTTPUserAgent)
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+	if bodyStr != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return r.vm.ToValue(map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	defer resp.Body.Close()
+
+	result := map[string]interface{}{
+		"statusCode": resp.StatusCode,
+		"status":     resp.StatusCode,
+		"ok":         resp.StatusCode >= 200 && resp.StatusCode < 300,
+	}
+
+	sel, err := streamSelectJSON(resp.Body, parseJSONPath(jsonPath), offset, limit)
+	if err != nil {
+		result["ok"] = false
+		result["error"] = err.Error()
+		return r.vm.ToValue(result)
+	}
+
+	result["found"] = sel.Found
+	if !sel.IsArray {
+		result["data"] = sel.Value
+		return r.vm.ToValue(result)
+	}
+
+	nextOffset := offset + len(sel.Items)
+	hasMore := nextOffset < sel.Total
+	result["items"] = sel.Items
+	result["offset"] = offset
+	result["limit"] = limit
+	result["total"] = sel.Total
+	result["hasMore"] = hasMore
+	if hasMore {
+		// Pass `next` back as the options' offset/limit to get the next page.
+		result["next"] = map[string]interface{}{"offset": nextOffset, "limit": limit}
+	} else {
+		result["next"] = nil
+	}
+	return r.vm.ToValue(result)
+}
@@ -0,0 +1,54 @@
+package gobackend
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	got := parseJSONPath(`$.data["items"][2].tracks`)
+	want := []string{"data", "items", "2", "tracks"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseJSONPath = %q, want %q", got, want)
+	}
+	if got := parseJSONPath(""); len(got) != 0 {
+		t.Fatalf("empty path should select root, got %q", got)
+	}
+}
+
+func TestStreamSelectJSONPagesArrays(t *testing.T) {
+	body := `{"meta":{"skip":[1,2,{"x":[3]}]},"data":{"items":[{"n":0},{"n":1},{"n":2},{"n":3},{"n":4}]}}`
+
+	sel, err := streamSelectJSON(strings.NewReader(body), parseJSONPath("data.items"), 1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !sel.Found || !sel.IsArray || sel.Total != 5 || len(sel.Items) != 2 {
+		t.Fatalf("unexpected selection: %+v", sel)
+	}
+	if first := sel.Items[0].(map[string]interface{}); first["n"] != float64(1) {
+		t.Fatalf("page should start at offset 1, got %v", first)
+	}
+}
+
+func TestStreamSelectJSONSubtreeAndMissing(t *testing.T) {
+	body := `{"a":[{"b":{"c":"deep"}},{"b":{"c":"other"}}]}`
+
+	sel, err := streamSelectJSON(strings.NewReader(body), parseJSONPath("a[1].b"), 0, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obj, ok := sel.Value.(map[string]interface{}); !ok || obj["c"] != "other" {
+		t.Fatalf("unexpected subtree: %#v", sel.Value)
+	}
+
+	sel, err = streamSelectJSON(strings.NewReader(body), parseJSONPath("a[5]"), 0, 10)
+	if err != nil || sel.Found {
+		t.Fatalf("missing index should not be found, got %+v (%v)", sel, err)
+	}
+
+	if _, err := streamSelectJSON(strings.NewReader(`{"a":[1,`), parseJSONPath("a"), 0, 10); err == nil {
+		t.Fatal("expected error for truncated JSON")
+	}
+}
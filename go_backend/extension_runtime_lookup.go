@@ -0,0 +1,65 @@
+// Package gobackend provides the ISRC/UPC lookup API for extension runtime
+package gobackend
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Lookup API ====================
+
+// jsonValue hands v to JS with its JSON field names.
+func (r *ExtensionRuntime) jsonValue(v interface{}) goja.Value {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return goja.Null()
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return goja.Null()
+	}
+	return r.vm.ToValue(decoded)
+}
+
+// lookupISRC implements lookup.isrc(isrc | [isrc...]) and returns the list
+// of ISRCLookupResult objects.
+func (r *ExtensionRuntime) lookupISRC(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return goja.Null()
+	}
+
+	var isrcs []string
+	switch v := call.Arguments[0].Export().(type) {
+	case string:
+		isrcs = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				isrcs = append(isrcs, s)
+			}
+		}
+	default:
+		return goja.Null()
+	}
+
+	results, err := LookupByISRC(isrcs)
+	if err != nil {
+		GoLog("[Extension:%s] lookup.isrc failed: %v\n", r.extensionID, err)
+		return goja.Null()
+	}
+	return r.jsonValue(results)
+}
+
+func (r *ExtensionRuntime) lookupUPC(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return goja.Null()
+	}
+	result, err := LookupByUPC(strings.TrimSpace(call.Arguments[0].String()))
+	if err != nil {
+		GoLog("[Extension:%s] lookup.upc failed: %v\n", r.extensionID, err)
+		return goja.Null()
+	}
+	return r.jsonValue(result)
+}
@@ -2,7 +2,11 @@
 package gobackend
 
 import (
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/dop251/goja"
 )
@@ -56,55 +60,700 @@ func (r *ExtensionRuntime) matchingNormalizeString(call goja.FunctionCall) goja.
 	return r.vm.ToValue(normalized)
 }
 
+// matchingBestMatch ranks candidates against target in one call:
+// matching.bestMatch(target, candidates, {minScore, limit, key,
+// allowVersionMismatch}). Candidates are strings or objects whose `key`
+// field (default "title", then "name") holds the string to compare.
+// Candidates whose live/remix/sped-up tags differ from target are dropped
+// unless allowVersionMismatch is set or strict_version_match is off.
+func (r *ExtensionRuntime) matchingBestMatch(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 2 {
+		return goja.Null()
+	}
+
+	target := strings.ToLower(strings.TrimSpace(call.Arguments[0].String()))
+	rawCandidates, ok := call.Arguments[1].Export().([]interface{})
+	if !ok {
+		return goja.Null()
+	}
+
+	minScore := 0.0
+	limit := 0
+	key := ""
+	strictVersions := GetBackendConfig().StrictVersionMatch
+	if len(call.Arguments) > 2 && !goja.IsUndefined(call.Arguments[2]) && !goja.IsNull(call.Arguments[2]) {
+		if opts, ok := call.Arguments[2].Export().(map[string]interface{}); ok {
+			if v, ok := opts["minScore"].(float64); ok {
+				minScore = v
+			} else if v, ok := opts["minScore"].(int64); ok {
+				minScore = float64(v)
+			}
+			if v, ok := opts["limit"].(int64); ok {
+				limit = int(v)
+			} else if v, ok := opts["limit"].(float64); ok {
+				limit = int(v)
+			}
+			key, _ = opts["key"].(string)
+			if v, ok := opts["allowVersionMismatch"].(bool); ok {
+				strictVersions = !v
+			}
+		}
+	}
+
+	candidates := make([]string, len(rawCandidates))
+	for i, c := range rawCandidates {
+		candidates[i] = strings.ToLower(strings.TrimSpace(matchCandidateString(c, key)))
+	}
+
+	ranked := rankStringMatches(target, candidates, minScore)
+	if strictVersions {
+		kept := ranked[:0]
+		for _, m := range ranked {
+			if len(versionMismatch(target, candidates[m.Index])) == 0 {
+				kept = append(kept, m)
+			}
+		}
+		ranked = kept
+	}
+	if limit > 0 && len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	results := make([]map[string]interface{}, len(ranked))
+	for i, m := range ranked {
+		results[i] = map[string]interface{}{
+			"index":     m.Index,
+			"candidate": rawCandidates[m.Index],
+			"score":     m.Score,
+		}
+	}
+
+	response := map[string]interface{}{
+		"best":   nil,
+		"ranked": results,
+	}
+	if len(results) > 0 {
+		response["best"] = results[0]
+	}
+	return r.vm.ToValue(response)
+}
+
+// matchingDetectVersion returns the version tags (live, remix, sped_up...)
+// found in a title's qualifiers.
+func (r *ExtensionRuntime) matchingDetectVersion(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return r.vm.ToValue([]string{})
+	}
+	return r.vm.ToValue(detectVersionTags(call.Arguments[0].String()))
+}
+
+// matchingCompareArtists scores two artist lists (arrays or joined
+// strings) order-insensitively, weighting the primary artist.
+func (r *ExtensionRuntime) matchingCompareArtists(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 2 {
+		return r.vm.ToValue(ArtistMatchResult{})
+	}
+	a := exportArtistList(call.Arguments[0])
+	b := exportArtistList(call.Arguments[1])
+	result := compareArtistLists(a, b)
+	return r.vm.ToValue(map[string]interface{}{
+		"score":        result.Score,
+		"primaryScore": result.PrimaryScore,
+		"primaryMatch": result.PrimaryMatch,
+		"matched":      result.Matched,
+		"total":        result.Total,
+	})
+}
+
+func exportArtistList(value goja.Value) []string {
+	if goja.IsUndefined(value) || goja.IsNull(value) {
+		return nil
+	}
+	switch v := value.Export().(type) {
+	case []interface{}:
+		artists := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				artists = append(artists, s)
+			} else if m, ok := item.(map[string]interface{}); ok {
+				if name, ok := m["name"].(string); ok {
+					artists = append(artists, name)
+				}
+			}
+		}
+		return artists
+	case string:
+		return []string{v}
+	}
+	return nil
+}
+
+const (
+	artistPrimaryWeight   = 0.6
+	artistMatchThreshold  = 0.85
+	artistSimilarityFloor = 0.5
+)
+
+type ArtistMatchResult struct {
+	Score        float64 `json:"score"`
+	PrimaryScore float64 `json:"primary_score"`
+	PrimaryMatch bool    `json:"primary_match"`
+	Matched      int     `json:"matched"`
+	Total        int     `json:"total"`
+}
+
+var artistListSeparators = strings.NewReplacer(
+	" featuring ", "|", " with ", "|", "; ", "|", " / ", "|", " vs. ", "|", " vs ", "|",
+	"(feat. ", "|", "(ft. ", "|", "(featuring ", "|", "[feat. ", "|",
+)
+
+// expandArtistList splits joined credits ("A feat. B", "A & B", "A x B")
+// into individual normalized names, dropping duplicates but keeping order so
+// the first entry stays the primary artist.
+func expandArtistList(artists []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, artist := range artists {
+		lowered := strings.ToLower(strings.TrimSpace(artist))
+		lowered = artistListSeparators.Replace(lowered)
+		for _, chunk := range strings.Split(lowered, "|") {
+			for _, name := range splitArtists(strings.Trim(chunk, " )]")) {
+				normalized := normalizeLooseTitle(name)
+				if normalized == "" {
+					normalized = name
+				}
+				if !seen[normalized] {
+					seen[normalized] = true
+					result = append(result, normalized)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func artistNameSimilarity(a, b string) float64 {
+	if a == b || sameWordsUnordered(a, b) {
+		return 1.0
+	}
+	return calculateStringSimilarity(a, b)
+}
+
+func bestArtistSimilarity(name string, others []string) float64 {
+	best := 0.0
+	for _, other := range others {
+		best = max(best, artistNameSimilarity(name, other))
+	}
+	return best
+}
+
+// compareArtistLists combines how well the primary artists match with how
+// much of the shorter credit list is found in the longer one, so a missing
+// featured artist costs less than a different main artist.
+func compareArtistLists(a, b []string) ArtistMatchResult {
+	listA := expandArtistList(a)
+	listB := expandArtistList(b)
+	if len(listA) == 0 || len(listB) == 0 {
+		return ArtistMatchResult{}
+	}
+
+	primary := (bestArtistSimilarity(listA[0], listB) + bestArtistSimilarity(listB[0], listA)) / 2
+
+	shorter, longer := listA, listB
+	if len(shorter) > len(longer) {
+		shorter, longer = longer, shorter
+	}
+	coverage := 0.0
+	matched := 0
+	for _, name := range shorter {
+		sim := bestArtistSimilarity(name, longer)
+		if sim >= artistMatchThreshold {
+			matched++
+		}
+		if sim >= artistSimilarityFloor {
+			coverage += sim
+		}
+	}
+	coverage /= float64(len(shorter))
+
+	return ArtistMatchResult{
+		Score:        artistPrimaryWeight*primary + (1-artistPrimaryWeight)*coverage,
+		PrimaryScore: primary,
+		PrimaryMatch: primary >= artistMatchThreshold,
+		Matched:      matched,
+		Total:        len(shorter),
+	}
+}
+
+// matchingMatchAlbum scores a candidate album against the requested one:
+// matching.matchAlbum(target, candidate, {edition}). Albums are objects with
+// title/name, artists/artist, trackCount/total_tracks, durationMs and
+// year/releaseDate; missing fields are left out of the score.
+func (r *ExtensionRuntime) matchingMatchAlbum(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 2 {
+		return goja.Null()
+	}
+	target, ok := call.Arguments[0].Export().(map[string]interface{})
+	if !ok {
+		return goja.Null()
+	}
+	candidate, ok := call.Arguments[1].Export().(map[string]interface{})
+	if !ok {
+		return goja.Null()
+	}
+
+	edition := GetBackendConfig().AlbumEdition
+	if len(call.Arguments) > 2 && !goja.IsUndefined(call.Arguments[2]) && !goja.IsNull(call.Arguments[2]) {
+		if opts, ok := call.Arguments[2].Export().(map[string]interface{}); ok {
+			if v, ok := opts["edition"].(string); ok && v != "" {
+				edition = strings.ToLower(v)
+			}
+		}
+	}
+
+	result := compareAlbums(albumMatchInputFromMap(target), albumMatchInputFromMap(candidate), edition)
+	return r.vm.ToValue(map[string]interface{}{
+		"score":            result.Score,
+		"titleScore":       result.TitleScore,
+		"artistScore":      result.ArtistScore,
+		"trackCountScore":  result.TrackCountScore,
+		"durationScore":    result.DurationScore,
+		"yearScore":        result.YearScore,
+		"targetEdition":    result.TargetEdition,
+		"candidateEdition": result.CandidateEdition,
+		"editionMismatch":  result.EditionMismatch,
+	})
+}
+
+const (
+	AlbumEditionMatch    = "match"
+	AlbumEditionStandard = "standard"
+	AlbumEditionDeluxe   = "deluxe"
+	AlbumEditionAny      = "any"
+
+	albumEditionPenalty = 0.75
+)
+
+// AlbumMatchInput is the subset of album metadata used for scoring. Zero
+// values mean "unknown".
+type AlbumMatchInput struct {
+	Title      string
+	Artists    []string
+	TrackCount int
+	DurationMs int64
+	Year       int
+}
+
+type AlbumMatchResult struct {
+	Score            float64 `json:"score"`
+	TitleScore       float64 `json:"title_score"`
+	ArtistScore      float64 `json:"artist_score"`
+	TrackCountScore  float64 `json:"track_count_score"`
+	DurationScore    float64 `json:"duration_score"`
+	YearScore        float64 `json:"year_score"`
+	TargetEdition    string  `json:"target_edition"`
+	CandidateEdition string  `json:"candidate_edition"`
+	EditionMismatch  bool    `json:"edition_mismatch"`
+}
+
+func mapInt(m map[string]interface{}, keys ...string) int64 {
+	for _, key := range keys {
+		switch v := m[key].(type) {
+		case int64:
+			return v
+		case float64:
+			return int64(v)
+		case int:
+			return int64(v)
+		case string:
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+func mapString(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := m[key].(string); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// mapArtists reads "artists" (array of names or {name} objects, or a joined
+// string) and falls back to "artist".
+func mapArtists(m map[string]interface{}) []string {
+	var artists []string
+	switch v := m["artists"].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				artists = append(artists, s)
+			} else if obj, ok := item.(map[string]interface{}); ok {
+				if name, ok := obj["name"].(string); ok {
+					artists = append(artists, name)
+				}
+			}
+		}
+	case string:
+		artists = []string{v}
+	}
+	if len(artists) == 0 {
+		if v := mapString(m, "artist", "artistName", "artist_name"); v != "" {
+			artists = []string{v}
+		}
+	}
+	return artists
+}
+
+func albumMatchInputFromMap(m map[string]interface{}) AlbumMatchInput {
+	input := AlbumMatchInput{
+		TrackCount: int(mapInt(m, "trackCount", "track_count", "total_tracks", "totalTracks")),
+		DurationMs: mapInt(m, "durationMs", "duration_ms", "totalDurationMs"),
+		Year:       int(mapInt(m, "year")),
+	}
+	input.Title = mapString(m, "title", "name", "album")
+	input.Artists = mapArtists(m)
+	if input.Year == 0 {
+		for _, key := range []string{"releaseDate", "release_date"} {
+			if v, ok := m[key].(string); ok && len(v) >= 4 {
+				if year, err := strconv.Atoi(v[:4]); err == nil {
+					input.Year = year
+					break
+				}
+			}
+		}
+	}
+	return input
+}
+
+var albumEditionMarkers = []string{
+	"deluxe", "expanded", "anniversary", "special edition", "collector",
+	"bonus track", "complete edition", "extended edition", "tour edition",
+}
+
+var albumEditionSuffix = regexp.MustCompile(`\s*[\(\[][^\)\]]*[\)\]]\s*$|\s+-\s+[^-]+$`)
+
+// albumEdition classifies a title as "deluxe" when it carries any of the
+// usual expanded-release markers, "standard" otherwise.
+func albumEdition(title string) string {
+	lower := strings.ToLower(title)
+	for _, marker := range albumEditionMarkers {
+		if strings.Contains(lower, marker) {
+			return AlbumEditionDeluxe
+		}
+	}
+	return AlbumEditionStandard
+}
+
+// albumBaseTitle strips trailing "(Deluxe Edition)" / "- 2011 Remaster"
+// style qualifiers so editions of one album compare equal by title.
+func albumBaseTitle(title string) string {
+	base := strings.TrimSpace(title)
+	for {
+		stripped := albumEditionSuffix.ReplaceAllString(base, "")
+		if stripped == base || stripped == "" {
+			break
+		}
+		base = strings.TrimSpace(stripped)
+	}
+	return normalizeStringForMatching(base)
+}
+
+func ratioScore(a, b float64, exact, zero float64) float64 {
+	if a <= 0 || b <= 0 {
+		return -1
+	}
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	rel := diff / max(a, b)
+	switch {
+	case rel <= exact:
+		return 1
+	case rel >= zero:
+		return 0
+	default:
+		return 1 - (rel-exact)/(zero-exact)
+	}
+}
+
+// compareAlbums weighs title and artists most, then track count and total
+// duration (which is what tells editions apart), then release year. A
+// candidate whose edition contradicts the preference is penalized.
+func compareAlbums(target, candidate AlbumMatchInput, edition string) AlbumMatchResult {
+	result := AlbumMatchResult{
+		TargetEdition:    albumEdition(target.Title),
+		CandidateEdition: albumEdition(candidate.Title),
+	}
+
+	var total, weights float64
+	add := func(score, weight float64) float64 {
+		if score < 0 {
+			return 0
+		}
+		total += score * weight
+		weights += weight
+		return score
+	}
+
+	titleA, titleB := albumBaseTitle(target.Title), albumBaseTitle(candidate.Title)
+	if titleA != "" && titleB != "" {
+		sim := 1.0
+		if titleA != titleB {
+			sim = calculateStringSimilarity(titleA, titleB)
+		}
+		result.TitleScore = add(sim, 0.35)
+	}
+	if len(target.Artists) > 0 && len(candidate.Artists) > 0 {
+		result.ArtistScore = add(compareArtistLists(target.Artists, candidate.Artists).Score, 0.25)
+	}
+	result.TrackCountScore = add(ratioScore(float64(target.TrackCount), float64(candidate.TrackCount), 0, 0.5), 0.15)
+	result.DurationScore = add(ratioScore(float64(target.DurationMs), float64(candidate.DurationMs), 0.02, 0.25), 0.15)
+	if target.Year > 0 && candidate.Year > 0 {
+		yearDiff := target.Year - candidate.Year
+		if yearDiff < 0 {
+			yearDiff = -yearDiff
+		}
+		switch yearDiff {
+		case 0:
+			result.YearScore = add(1, 0.10)
+		case 1:
+			result.YearScore = add(0.5, 0.10)
+		default:
+			add(0, 0.10)
+		}
+	}
+	if weights > 0 {
+		result.Score = total / weights
+	}
+
+	switch edition {
+	case AlbumEditionAny:
+	case AlbumEditionStandard, AlbumEditionDeluxe:
+		result.EditionMismatch = result.CandidateEdition != edition
+	default:
+		result.EditionMismatch = result.CandidateEdition != result.TargetEdition
+	}
+	if result.EditionMismatch {
+		result.Score *= albumEditionPenalty
+	}
+	return result
+}
+
+// matchingBuildQueries returns progressively simpler search strings for a
+// track object ({title|name, artists|artist}) so every extension degrades
+// its searches the same way the built-in providers do.
+func (r *ExtensionRuntime) matchingBuildQueries(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return r.vm.ToValue([]string{})
+	}
+	track, ok := call.Arguments[0].Export().(map[string]interface{})
+	if !ok {
+		return r.vm.ToValue([]string{})
+	}
+	return r.vm.ToValue(buildSearchQueries(mapString(track, "title", "name", "trackName", "track_name"), mapArtists(track)))
+}
+
+// buildSearchQueries orders queries from most to least specific:
+//
+//	all artists + title, normalized primary artist + title,
+//	primary artist + title without qualifiers, title, title without
+//	qualifiers, and romaji variants for Japanese text.
+//
+// Duplicates (case-insensitive) and empty queries are dropped.
+func buildSearchQueries(title string, artists []string) []string {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return []string{}
+	}
+
+	expanded := make([]string, 0, len(artists))
+	for _, artist := range artists {
+		for _, name := range strings.Split(artistListSeparators.Replace(strings.TrimSpace(artist)), "|") {
+			if name = strings.TrimSpace(name); name != "" {
+				expanded = append(expanded, name)
+			}
+		}
+	}
+	primary := ""
+	if len(expanded) > 0 {
+		primary = expanded[0]
+	}
+	coreTitle := extractCoreTitle(title)
+
+	var queries []string
+	seen := make(map[string]bool)
+	add := func(parts ...string) {
+		query := strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+		key := strings.ToLower(query)
+		if query == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		queries = append(queries, query)
+	}
+
+	add(strings.Join(expanded, " "), title)
+	add(normalizeStringForMatching(primary), normalizeStringForMatching(title))
+	add(primary, coreTitle)
+	add(title)
+	add(coreTitle)
+
+	if ContainsJapanese(title) || ContainsJapanese(primary) {
+		romajiTitle := CleanToASCII(JapaneseToRomaji(coreTitle))
+		romajiArtist := CleanToASCII(JapaneseToRomaji(primary))
+		if romajiTitle != "" {
+			add(romajiArtist, romajiTitle)
+			add(romajiTitle)
+		}
+	}
+	return queries
+}
+
+func matchCandidateString(candidate interface{}, key string) string {
+	switch v := candidate.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		keys := []string{"title", "name"}
+		if key != "" {
+			keys = []string{key}
+		}
+		for _, k := range keys {
+			if s, ok := v[k].(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+type stringMatch struct {
+	Index int
+	Score float64
+}
+
+// matchScoreEpsilon absorbs float error, e.g. (1-0.9)*10 = 0.9999999999999998,
+// so a score exactly at minScore is kept.
+const matchScoreEpsilon = 1e-9
+
+// rankStringMatches scores every candidate against target and returns those
+// reaching minScore, best first. minScore is turned into a distance bound so
+// hopeless candidates bail out early.
+func rankStringMatches(target string, candidates []string, minScore float64) []stringMatch {
+	targetRunes := []rune(target)
+	buf := levenshteinBufPool.Get().(*[]int)
+	defer levenshteinBufPool.Put(buf)
+
+	matches := make([]stringMatch, 0, len(candidates))
+	for i, candidate := range candidates {
+		candidateRunes := []rune(candidate)
+		maxLen := max(len(targetRunes), len(candidateRunes))
+
+		var score float64
+		switch {
+		case maxLen == 0:
+			score = 1.0
+		case len(targetRunes) == 0 || len(candidateRunes) == 0:
+			score = 0.0
+		default:
+			maxDist := maxLen
+			if minScore > 0 {
+				maxDist = int((1-minScore)*float64(maxLen) + matchScoreEpsilon)
+			}
+			distance := levenshteinRunes(targetRunes, candidateRunes, maxDist, buf)
+			if distance > maxDist {
+				continue
+			}
+			score = 1.0 - float64(distance)/float64(maxLen)
+		}
+		if score+matchScoreEpsilon >= minScore {
+			matches = append(matches, stringMatch{Index: i, Score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].Score > matches[b].Score })
+	return matches
+}
+
 func calculateStringSimilarity(s1, s2 string) float64 {
-	if len(s1) == 0 && len(s2) == 0 {
+	r1, r2 := []rune(s1), []rune(s2)
+	if len(r1) == 0 && len(r2) == 0 {
 		return 1.0
 	}
-	if len(s1) == 0 || len(s2) == 0 {
+	if len(r1) == 0 || len(r2) == 0 {
 		return 0.0
 	}
 
-	distance := levenshteinDistance(s1, s2)
-	maxLen := len(s1)
-	if len(s2) > maxLen {
-		maxLen = len(s2)
-	}
+	buf := levenshteinBufPool.Get().(*[]int)
+	defer levenshteinBufPool.Put(buf)
 
+	maxLen := max(len(r1), len(r2))
+	distance := levenshteinRunes(r1, r2, maxLen, buf)
 	return 1.0 - float64(distance)/float64(maxLen)
 }
 
+var levenshteinBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]int, 0, 128)
+		return &buf
+	},
+}
+
 func levenshteinDistance(s1, s2 string) int {
-	if len(s1) == 0 {
-		return len(s2)
+	r1, r2 := []rune(s1), []rune(s2)
+	buf := levenshteinBufPool.Get().(*[]int)
+	defer levenshteinBufPool.Put(buf)
+	return levenshteinRunes(r1, r2, max(len(r1), len(r2)), buf)
+}
+
+// levenshteinRunes computes the edit distance with two rolling rows taken
+// from buf. Once every cell of a row exceeds maxDist the final distance must
+// too, so it returns maxDist+1 early.
+func levenshteinRunes(a, b []rune, maxDist int, buf *[]int) int {
+	if len(a) < len(b) {
+		a, b = b, a
 	}
-	if len(s2) == 0 {
-		return len(s1)
+	if len(b) == 0 {
+		return len(a)
+	}
+	if len(a)-len(b) > maxDist {
+		return maxDist + 1
 	}
 
-	matrix := make([][]int, len(s1)+1)
-	for i := range matrix {
-		matrix[i] = make([]int, len(s2)+1)
-		matrix[i][0] = i
+	width := len(b) + 1
+	if cap(*buf) < 2*width {
+		*buf = make([]int, 2*width)
 	}
-	for j := range matrix[0] {
-		matrix[0][j] = j
+	rows := (*buf)[:2*width]
+	prev, curr := rows[:width], rows[width:]
+	for j := range prev {
+		prev[j] = j
 	}
 
-	for i := 1; i <= len(s1); i++ {
-		for j := 1; j <= len(s2); j++ {
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
 			cost := 1
-			if s1[i-1] == s2[j-1] {
+			if a[i-1] == b[j-1] {
 				cost = 0
 			}
-			matrix[i][j] = min(
-				matrix[i-1][j]+1,
-				matrix[i][j-1]+1,
-				matrix[i-1][j-1]+cost,
-			)
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > maxDist {
+			return maxDist + 1
 		}
+		prev, curr = curr, prev
 	}
 
-	return matrix[len(s1)][len(s2)]
+	return prev[len(b)]
 }
 
 func normalizeStringForMatching(s string) string {
@@ -0,0 +1,125 @@
+package gobackend
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLevenshteinRunes(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+		{"café", "cafe", 1},
+		{"東京", "東京都", 1},
+	}
+	for _, c := range cases {
+		if got := levenshteinDistance(c.a, c.b); got != c.want {
+			t.Errorf("levenshteinDistance(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+
+	buf := make([]int, 0)
+	if got := levenshteinRunes([]rune("abcdef"), []rune("uvwxyz"), 2, &buf); got != 3 {
+		t.Errorf("expected early exit at maxDist+1, got %d", got)
+	}
+}
+
+func TestRankStringMatches(t *testing.T) {
+	candidates := []string{"hello world", "yellow world", "something else", "hello world"}
+	ranked := rankStringMatches("hello world", candidates, 0.5)
+	if len(ranked) != 3 {
+		t.Fatalf("expected 3 matches above threshold, got %+v", ranked)
+	}
+	if ranked[0].Index != 0 || ranked[0].Score != 1.0 || ranked[1].Index != 3 || ranked[2].Index != 1 {
+		t.Fatalf("unexpected ranking: %+v", ranked)
+	}
+
+	// One edit in ten scores exactly 0.9, which must pass a 0.9 threshold.
+	if ranked := rankStringMatches("abcdefghij", []string{"abcdefghiX"}, 0.9); len(ranked) != 1 {
+		t.Fatalf("candidate at the threshold dropped: %+v", ranked)
+	}
+}
+
+func TestCompareArtistLists(t *testing.T) {
+	same := compareArtistLists([]string{"Daft Punk feat. Pharrell Williams"}, []string{"Pharrell Williams", "Daft Punk"})
+	if want := (ArtistMatchResult{Score: 1, PrimaryScore: 1, PrimaryMatch: true, Matched: 2, Total: 2}); same != want {
+		t.Fatalf("featuring split vs reordered list = %+v, want %+v", same, want)
+	}
+
+	missingFeature := compareArtistLists([]string{"Calvin Harris & Dua Lipa"}, []string{"Calvin Harris"})
+	if want := (ArtistMatchResult{Score: 1, PrimaryScore: 1, PrimaryMatch: true, Matched: 1, Total: 1}); missingFeature != want {
+		t.Fatalf("missing featured artist = %+v, want %+v", missingFeature, want)
+	}
+
+	different := compareArtistLists([]string{"Metallica"}, []string{"Madonna"})
+	if different.PrimaryMatch || different.Matched != 0 || different.Total != 1 ||
+		math.Abs(different.Score-0.2) > 1e-9 || math.Abs(different.PrimaryScore-1.0/3) > 1e-9 {
+		t.Fatalf("different artists = %+v, want score 0.2 and primary score 1/3", different)
+	}
+}
+
+func TestCompareAlbumsPrefersRequestedEdition(t *testing.T) {
+	standard := AlbumMatchInput{Title: "1989", Artists: []string{"Taylor Swift"}, TrackCount: 13, DurationMs: 2922000, Year: 2014}
+	deluxe := AlbumMatchInput{Title: "1989 (Deluxe Edition)", Artists: []string{"Taylor Swift"}, TrackCount: 16, DurationMs: 3411000, Year: 2014}
+
+	same := compareAlbums(standard, standard, AlbumEditionMatch)
+	other := compareAlbums(standard, deluxe, AlbumEditionMatch)
+	if same.Score < 0.99 {
+		t.Fatalf("identical album should score ~1, got %+v", same)
+	}
+	if !other.EditionMismatch || other.Score >= same.Score {
+		t.Fatalf("deluxe candidate should lose to standard, got %+v", other)
+	}
+	if other.TitleScore != 1 {
+		t.Fatalf("edition qualifiers should be ignored in title score, got %v", other.TitleScore)
+	}
+
+	preferDeluxe := compareAlbums(standard, deluxe, AlbumEditionDeluxe)
+	if preferDeluxe.EditionMismatch {
+		t.Fatalf("deluxe preference should accept deluxe candidate, got %+v", preferDeluxe)
+	}
+}
+
+func TestPickTidalAlbumMatchFollowsEdition(t *testing.T) {
+	var standard, deluxe TidalTrack
+	standard.Album.Title = "1989"
+	standard.Artist.Name = "Taylor Swift"
+	deluxe.Album.Title = "1989 (Deluxe Edition)"
+	deluxe.Artist.Name = "Taylor Swift"
+	tracks := []*TidalTrack{&deluxe, &standard}
+
+	if got := pickTidalAlbumMatch(tracks, "1989", "Taylor Swift"); got != &standard {
+		t.Fatalf("expected the standard release, got %q", got.Album.Title)
+	}
+	if got := pickTidalAlbumMatch(tracks, "1989 (Deluxe Edition)", "Taylor Swift"); got != &deluxe {
+		t.Fatalf("expected the deluxe release, got %q", got.Album.Title)
+	}
+	if got := pickTidalAlbumMatch(tracks, "", "Taylor Swift"); got != &deluxe {
+		t.Fatalf("without an album name the first match should win, got %q", got.Album.Title)
+	}
+}
+
+func TestBuildSearchQueriesDegradesInOrder(t *testing.T) {
+	got := buildSearchQueries("Get Lucky (feat. Pharrell Williams) [Radio Edit]", []string{"Daft Punk", "Pharrell Williams"})
+	want := []string{
+		"Daft Punk Pharrell Williams Get Lucky (feat. Pharrell Williams) [Radio Edit]",
+		"daft punk get lucky",
+		"Get Lucky (feat. Pharrell Williams) [Radio Edit]",
+		"Get Lucky",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("query %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if qs := buildSearchQueries("Hello", nil); len(qs) != 1 || qs[0] != "Hello" {
+		t.Fatalf("title-only track should yield one query, got %q", qs)
+	}
+}
@@ -0,0 +1,99 @@
+package gobackend
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Qobuz binding ====================
+//
+// qobuz.signRequest({endpoint, params, appId, appSecret, timestamp}) signs
+// a protected API call; appId/appSecret default to the credentials
+// discovered from the web player. qobuz.getAppCredentials({refresh,
+// userAuthToken}) returns those credentials.
+
+func qobuzParamString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (r *ExtensionRuntime) qobuzSignRequest(call goja.FunctionCall) goja.Value {
+	fail := func(err error) goja.Value {
+		return r.vm.ToValue(map[string]interface{}{"success": false, "error": err.Error()})
+	}
+	if len(call.Arguments) < 1 {
+		return fail(fmt.Errorf("options are required"))
+	}
+	opts, ok := call.Arguments[0].Export().(map[string]interface{})
+	if !ok {
+		return fail(fmt.Errorf("options must be an object"))
+	}
+
+	params := make(map[string]string)
+	if raw, ok := opts["params"].(map[string]interface{}); ok {
+		for key, value := range raw {
+			params[key] = qobuzParamString(value)
+		}
+	}
+	appID := qobuzParamString(opts["appId"])
+	secret := qobuzParamString(opts["appSecret"])
+	if appID == "" || secret == "" {
+		creds, err := discoverQobuzCredentials(false, "")
+		if err != nil {
+			GoLog("[Extension:%s] Qobuz credential discovery failed: %v\n", r.extensionID, err)
+			return fail(err)
+		}
+		if appID == "" {
+			appID = creds.AppID
+		}
+		if secret == "" {
+			secret = creds.Secrets[0]
+		}
+	}
+
+	signed, err := SignQobuzRequest(qobuzParamString(opts["endpoint"]), params, appID, secret, qobuzParamString(opts["timestamp"]))
+	if err != nil {
+		return fail(err)
+	}
+	return r.vm.ToValue(map[string]interface{}{
+		"success":   true,
+		"appId":     signed.AppID,
+		"timestamp": signed.Timestamp,
+		"signature": signed.Signature,
+		"params":    signed.Params,
+		"query":     signed.Query,
+		"url":       signed.URL,
+	})
+}
+
+func (r *ExtensionRuntime) qobuzGetAppCredentials(call goja.FunctionCall) goja.Value {
+	refresh := false
+	userToken := ""
+	if len(call.Arguments) > 0 {
+		if opts, ok := call.Arguments[0].Export().(map[string]interface{}); ok {
+			refresh, _ = opts["refresh"].(bool)
+			userToken = qobuzParamString(opts["userAuthToken"])
+		}
+	}
+	creds, err := GetQobuzAppCredentials(refresh, userToken)
+	if err != nil {
+		GoLog("[Extension:%s] Qobuz credential discovery failed: %v\n", r.extensionID, err)
+		return r.vm.ToValue(map[string]interface{}{"success": false, "error": err.Error()})
+	}
+	return r.vm.ToValue(map[string]interface{}{
+		"success":   true,
+		"appId":     creds.AppID,
+		"secrets":   creds.Secrets,
+		"validated": creds.Validated,
+	})
+}
@@ -0,0 +1,246 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Secrets vault ====================
+//
+// secrets.get/set/remove/has/keys is where extensions keep API keys, ARLs
+// and session tokens. The vault is encrypted like credentials (and follows
+// the credential lock) but lives in its own file under <data dir>/secrets,
+// so it never mixes with storage or settings. Manifest settings marked
+// "secret" are kept here too instead of settings.json. Every value the
+// vault hands out or stores is also scrubbed from log output.
+
+const (
+	extensionSecretsDirName = "secrets"
+	// Shorter values would redact ordinary words from the logs.
+	minRedactedSecretLength = 6
+)
+
+var (
+	knownSecretsMu sync.RWMutex
+	knownSecrets   = make(map[string]struct{})
+
+	// extensionSecretsLocks serializes read-modify-write of one extension's
+	// vault, from the VM and from the settings UI alike.
+	extensionSecretsLocks sync.Map
+)
+
+func lockExtensionSecrets(extensionID string) func() {
+	mu, _ := extensionSecretsLocks.LoadOrStore(extensionID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+func extensionSecretsDir(dataDir string) string {
+	return filepath.Join(dataDir, extensionSecretsDirName)
+}
+
+// registerLogSecret makes sanitizeSensitiveLogText replace value.
+func registerLogSecret(value string) {
+	if len(value) < minRedactedSecretLength {
+		return
+	}
+	knownSecretsMu.Lock()
+	knownSecrets[value] = struct{}{}
+	knownSecretsMu.Unlock()
+}
+
+func redactKnownSecrets(message string) string {
+	knownSecretsMu.RLock()
+	defer knownSecretsMu.RUnlock()
+	for secret := range knownSecrets {
+		if strings.Contains(message, secret) {
+			message = strings.ReplaceAll(message, secret, "[SECRET]")
+		}
+	}
+	return message
+}
+
+// readExtensionSecrets decrypts an extension's vault. Values are always
+// strings; anything else in the file is dropped.
+func readExtensionSecrets(extensionID, dataDir string) (map[string]string, error) {
+	creds, err := readCredentialsFile(extensionID, extensionSecretsDir(dataDir))
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string]string, len(creds))
+	for key, value := range creds {
+		if s, ok := value.(string); ok {
+			secrets[key] = s
+			registerLogSecret(s)
+		}
+	}
+	return secrets, nil
+}
+
+func writeExtensionSecrets(extensionID, dataDir string, secrets map[string]string) error {
+	dir := extensionSecretsDir(dataDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	creds := make(map[string]interface{}, len(secrets))
+	for key, value := range secrets {
+		creds[key] = value
+		registerLogSecret(value)
+	}
+	return writeCredentialsFile(extensionID, dir, creds)
+}
+
+// updateExtensionSecrets applies change to ext's vault and drops the
+// runtime's cached copy.
+func updateExtensionSecrets(ext *LoadedExtension, change func(map[string]string)) error {
+	unlock := lockExtensionSecrets(ext.ID)
+	defer unlock()
+	secrets, err := readExtensionSecrets(ext.ID, ext.DataDir)
+	if err != nil {
+		return err
+	}
+	change(secrets)
+	if err := writeExtensionSecrets(ext.ID, ext.DataDir, secrets); err != nil {
+		return err
+	}
+	if ext.runtime != nil {
+		ext.runtime.dropCredentialsCache()
+	}
+	return nil
+}
+
+// vaultReadable reports whether the vault can be read without prompting
+// the user for the credential lock.
+func vaultReadable() bool {
+	return !CredentialLockEnabled() || credentialsUnlocked()
+}
+
+func (r *ExtensionRuntime) loadSecrets() (map[string]string, error) {
+	if CredentialLockEnabled() && !credentialsUnlocked() {
+		r.dropCredentialsCache()
+	}
+
+	r.secretsMu.Lock()
+	defer r.secretsMu.Unlock()
+	if r.secretsCache == nil {
+		secrets, err := readExtensionSecrets(r.extensionID, r.dataDir)
+		if err != nil {
+			return nil, err
+		}
+		r.secretsCache = secrets
+	}
+	result := make(map[string]string, len(r.secretsCache))
+	for k, v := range r.secretsCache {
+		result[k] = v
+	}
+	return result, nil
+}
+
+func (r *ExtensionRuntime) saveSecrets(secrets map[string]string) error {
+	if err := writeExtensionSecrets(r.extensionID, r.dataDir, secrets); err != nil {
+		return err
+	}
+	r.secretsMu.Lock()
+	r.secretsCache = secrets
+	r.secretsMu.Unlock()
+	return nil
+}
+
+func (r *ExtensionRuntime) secretsGet(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return goja.Undefined()
+	}
+	secrets, err := r.loadSecrets()
+	if err != nil {
+		GoLog("[Extension:%s] Secrets load error: %v\n", r.extensionID, err)
+		return goja.Undefined()
+	}
+	value, ok := secrets[call.Arguments[0].String()]
+	if !ok {
+		if len(call.Arguments) > 1 {
+			return call.Arguments[1]
+		}
+		return goja.Undefined()
+	}
+	return r.vm.ToValue(value)
+}
+
+// secretsSet stores a string; an empty string removes the key.
+func (r *ExtensionRuntime) secretsSet(call goja.FunctionCall) goja.Value {
+	fail := func(msg string) goja.Value {
+		return r.vm.ToValue(map[string]interface{}{"success": false, "error": msg})
+	}
+	if len(call.Arguments) < 2 {
+		return fail("key and value are required")
+	}
+	value, ok := call.Arguments[1].Export().(string)
+	if !ok {
+		return fail("secret values must be strings")
+	}
+	unlock := lockExtensionSecrets(r.extensionID)
+	defer unlock()
+	secrets, err := r.loadSecrets()
+	if err != nil {
+		GoLog("[Extension:%s] Secrets load error: %v\n", r.extensionID, err)
+		return fail(err.Error())
+	}
+	key := call.Arguments[0].String()
+	if value == "" {
+		delete(secrets, key)
+	} else {
+		secrets[key] = value
+	}
+	if err := r.saveSecrets(secrets); err != nil {
+		GoLog("[Extension:%s] Secrets save error: %v\n", r.extensionID, err)
+		return fail(err.Error())
+	}
+	return r.vm.ToValue(map[string]interface{}{"success": true})
+}
+
+func (r *ExtensionRuntime) secretsRemove(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return r.vm.ToValue(false)
+	}
+	unlock := lockExtensionSecrets(r.extensionID)
+	defer unlock()
+	secrets, err := r.loadSecrets()
+	if err != nil {
+		return r.vm.ToValue(false)
+	}
+	delete(secrets, call.Arguments[0].String())
+	if err := r.saveSecrets(secrets); err != nil {
+		GoLog("[Extension:%s] Secrets save error: %v\n", r.extensionID, err)
+		return r.vm.ToValue(false)
+	}
+	return r.vm.ToValue(true)
+}
+
+func (r *ExtensionRuntime) secretsHas(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return r.vm.ToValue(false)
+	}
+	secrets, err := r.loadSecrets()
+	if err != nil {
+		return r.vm.ToValue(false)
+	}
+	_, ok := secrets[call.Arguments[0].String()]
+	return r.vm.ToValue(ok)
+}
+
+func (r *ExtensionRuntime) secretsKeys(call goja.FunctionCall) goja.Value {
+	secrets, err := r.loadSecrets()
+	if err != nil {
+		return r.vm.ToValue([]string{})
+	}
+	keys := make([]string, 0, len(secrets))
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return r.vm.ToValue(keys)
+}
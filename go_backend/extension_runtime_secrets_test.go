@@ -0,0 +1,208 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+func TestExtensionSecretsVault(t *testing.T) {
+	ext := &LoadedExtension{
+		ID:       "secrets-test",
+		Manifest: &ExtensionManifest{Name: "secrets-test"},
+		DataDir:  t.TempDir(),
+	}
+	vm := goja.New()
+	ext.VM = vm
+	runtime := NewExtensionRuntime(ext)
+	runtime.RegisterAPIs(vm)
+
+	run := func(script string) goja.Value {
+		t.Helper()
+		v, err := vm.RunString(script)
+		if err != nil {
+			t.Fatalf("%s: %v", script, err)
+		}
+		return v
+	}
+
+	if !run(`secrets.set("arl", "arl-0123456789").success`).ToBoolean() {
+		t.Fatal("secrets.set failed")
+	}
+	if run(`secrets.set("n", 42).success`).ToBoolean() {
+		t.Fatal("non-string secret accepted")
+	}
+	if got := run(`secrets.get("arl")`).String(); got != "arl-0123456789" {
+		t.Fatalf("secrets.get = %q", got)
+	}
+	if got := run(`secrets.get("missing", "fallback")`).String(); got != "fallback" {
+		t.Fatalf("default not returned: %q", got)
+	}
+
+	data, err := os.ReadFile(credentialsFilePath(extensionSecretsDir(ext.DataDir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("arl-0123456789")) {
+		t.Fatal("vault is not encrypted")
+	}
+	if _, err := os.Stat(filepath.Join(ext.DataDir, ".credentials.enc")); !os.IsNotExist(err) {
+		t.Fatal("secret written to the credentials store")
+	}
+
+	// A fresh runtime reads the vault back from disk.
+	runtime.dropCredentialsCache()
+	if !run(`secrets.has("arl") && secrets.keys().join() === "arl"`).ToBoolean() {
+		t.Fatal("vault not reloaded")
+	}
+
+	if got := sanitizeSensitiveLogText("sending arl-0123456789 upstream"); strings.Contains(got, "arl-0123456789") {
+		t.Fatalf("secret leaked into log text: %q", got)
+	}
+
+	if !run(`secrets.remove("arl")`).ToBoolean() || run(`secrets.has("arl")`).ToBoolean() {
+		t.Fatal("secrets.remove did not remove")
+	}
+}
+
+func TestSecretSettingsLiveInVault(t *testing.T) {
+	if err := GetExtensionSettingsStore().SetDataDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.js"), []byte(`registerExtension({
+  token: function () { return settings.token + ":" + secrets.get("token"); }
+});`), 0644)
+	manifest := &ExtensionManifest{Name: "secret-settings", Settings: []ExtensionSetting{
+		{Key: "token", Type: SettingTypeString, Secret: true},
+		{Key: "region", Type: SettingTypeString},
+	}}
+	ext := &LoadedExtension{ID: "secret-settings", Manifest: manifest, DataDir: t.TempDir(), SourceDir: dir}
+
+	// Written by an older build straight into settings.json.
+	GetExtensionSettingsStore().SetAll(ext.ID, map[string]interface{}{"token": "legacy-token", "region": "us"})
+
+	m := GetExtensionManager()
+	if err := m.initializeVM(ext); err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.extensions[ext.ID] = ext
+	m.mu.Unlock()
+	t.Cleanup(func() {
+		m.mu.Lock()
+		delete(m.extensions, ext.ID)
+		m.mu.Unlock()
+		unregisterExtensionVM(ext.VM)
+		GetExtensionSettingsStore().RemoveAll(ext.ID)
+	})
+
+	raw, _ := GetExtensionSettingsJSON(ext.ID)
+	if strings.Contains(raw, "legacy-token") || !strings.Contains(raw, `"region":"us"`) {
+		t.Fatalf("secret not migrated out of settings: %s", raw)
+	}
+
+	// A settings form that only saw the masked value must not wipe it.
+	if err := SetExtensionSettingsJSON(ext.ID, `{"token": "", "region": "eu"}`); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := RunWithTimeoutAndRecover(ext.VM, "extension.token()", DefaultJSTimeout)
+	if got.String() != "legacy-token:legacy-token" {
+		t.Fatalf("extension saw %q", got.String())
+	}
+
+	if err := SetExtensionSetting(ext.ID, "token", `"new-token"`); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ = GetExtensionSettingsJSON(ext.ID)
+	view, _ := GetExtensionSettings(ext.ID)
+	if strings.Contains(raw, "new-token") || strings.Contains(view, "new-token") || !strings.Contains(view, `"secrets_set":["token"]`) {
+		t.Fatalf("secret exposed to the settings UI: %s / %s", raw, view)
+	}
+	got, _ = RunWithTimeoutAndRecover(ext.VM, "extension.token()", DefaultJSTimeout)
+	if got.String() != "new-token:new-token" {
+		t.Fatalf("extension saw %q", got.String())
+	}
+}
+
+func TestSecretSettingsMigrateOnUnlock(t *testing.T) {
+	if err := GetExtensionSettingsStore().SetDataDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	loadCredentialLock(t.TempDir())
+	defer loadCredentialLock(t.TempDir())
+	defer SetCredentialUnlocker(nil)
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{5}, credentialUnlockKeySize))
+	SetCredentialUnlocker(&fakeUnlocker{key: key})
+	if err := EnableCredentialLock(key, 0); err != nil {
+		t.Fatal(err)
+	}
+	LockCredentials()
+
+	manifest := &ExtensionManifest{Name: "locked-secrets", Settings: []ExtensionSetting{
+		{Key: "token", Type: SettingTypeString, Secret: true},
+	}}
+	ext := &LoadedExtension{ID: "locked-secrets", Manifest: manifest, DataDir: t.TempDir()}
+	m := GetExtensionManager()
+	m.mu.Lock()
+	m.extensions[ext.ID] = ext
+	m.mu.Unlock()
+	t.Cleanup(func() {
+		m.mu.Lock()
+		delete(m.extensions, ext.ID)
+		m.mu.Unlock()
+		GetExtensionSettingsStore().RemoveAll(ext.ID)
+	})
+	GetExtensionSettingsStore().SetAll(ext.ID, map[string]interface{}{"token": "legacy-token"})
+
+	migrateSecretSettings(ext)
+	if raw, _ := GetExtensionSettingsJSON(ext.ID); !strings.Contains(raw, "legacy-token") {
+		t.Fatalf("migrated while locked: %s", raw)
+	}
+
+	if _, err := acquireCredentialKey("test"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		raw, _ := GetExtensionSettingsJSON(ext.ID)
+		if !strings.Contains(raw, "legacy-token") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("secret still in settings after unlock: %s", raw)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	secrets, err := readExtensionSecrets(ext.ID, ext.DataDir)
+	if err != nil || secrets["token"] != "legacy-token" {
+		t.Fatalf("vault = %v, err = %v", secrets, err)
+	}
+}
+
+func TestUpdateExtensionSecretsSerializes(t *testing.T) {
+	ext := &LoadedExtension{ID: "secrets-race", Manifest: &ExtensionManifest{Name: "secrets-race"}, DataDir: t.TempDir()}
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			updateExtensionSecrets(ext, func(secrets map[string]string) {
+				secrets[fmt.Sprintf("key-%d", i)] = "value"
+			})
+		}(i)
+	}
+	wg.Wait()
+	secrets, err := readExtensionSecrets(ext.ID, ext.DataDir)
+	if err != nil || len(secrets) != 16 {
+		t.Fatalf("kept %d of 16 secrets (err = %v)", len(secrets), err)
+	}
+}
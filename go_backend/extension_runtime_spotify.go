@@ -0,0 +1,52 @@
+// Package gobackend provides the Spotify token API for extension runtime
+package gobackend
+
+import (
+	"context"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Spotify API ====================
+
+// spotifyGetToken implements spotify.getToken({force}) and returns null when
+// no token could be obtained.
+func (r *ExtensionRuntime) spotifyGetToken(call goja.FunctionCall) goja.Value {
+	force := false
+	if len(call.Arguments) > 0 && !goja.IsUndefined(call.Arguments[0]) && !goja.IsNull(call.Arguments[0]) {
+		if opts, ok := call.Arguments[0].Export().(map[string]interface{}); ok {
+			force, _ = opts["force"].(bool)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	token, err := GetSpotifyAnonToken(ctx, force)
+	if err != nil {
+		GoLog("[Extension:%s] spotify.getToken failed: %v\n", r.extensionID, err)
+		return goja.Null()
+	}
+
+	return r.vm.ToValue(map[string]interface{}{
+		"access_token": token.AccessToken,
+		"client_id":    token.ClientID,
+		"expires_at":   token.ExpiresAt.Unix(),
+	})
+}
+
+// spotifyInvalidateToken implements spotify.invalidateToken(token, status,
+// retryAfterSeconds), called when Spotify answered 401 or 429.
+func (r *ExtensionRuntime) spotifyInvalidateToken(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 2 {
+		return r.vm.ToValue(false)
+	}
+	accessToken := call.Arguments[0].String()
+	status := int(call.Arguments[1].ToInteger())
+	var retryAfter time.Duration
+	if len(call.Arguments) > 2 {
+		retryAfter = time.Duration(call.Arguments[2].ToInteger()) * time.Second
+	}
+	InvalidateSpotifyAnonToken(accessToken, status, retryAfter)
+	return r.vm.ToValue(true)
+}
@@ -257,16 +257,16 @@ func (r *ExtensionRuntime) storageRemove(call goja.FunctionCall) goja.Value {
 	return r.vm.ToValue(true)
 }
 
-func (r *ExtensionRuntime) getCredentialsPath() string {
-	return filepath.Join(r.dataDir, ".credentials.enc")
+func credentialsFilePath(dataDir string) string {
+	return filepath.Join(dataDir, ".credentials.enc")
 }
 
-func (r *ExtensionRuntime) getSaltPath() string {
-	return filepath.Join(r.dataDir, ".cred_salt")
+func credentialsSaltPath(dataDir string) string {
+	return filepath.Join(dataDir, ".cred_salt")
 }
 
-func (r *ExtensionRuntime) getOrCreateSalt() ([]byte, error) {
-	saltPath := r.getSaltPath()
+func getOrCreateCredentialsSalt(dataDir string) ([]byte, error) {
+	saltPath := credentialsSaltPath(dataDir)
 
 	salt, err := os.ReadFile(saltPath)
 	if err == nil && len(salt) == 32 {
@@ -285,64 +285,156 @@ func (r *ExtensionRuntime) getOrCreateSalt() ([]byte, error) {
 	return salt, nil
 }
 
-func (r *ExtensionRuntime) getEncryptionKey() ([]byte, error) {
-	salt, err := r.getOrCreateSalt()
+// credentialsKey derives the file key from the extension ID and the device
+// salt, mixed with the unlock key when the credential lock is on.
+func credentialsKey(extensionID, dataDir string, unlockKey []byte) ([]byte, error) {
+	salt, err := getOrCreateCredentialsSalt(dataDir)
 	if err != nil {
 		return nil, err
 	}
 
-	combined := append([]byte(r.extensionID), salt...)
+	combined := append([]byte(extensionID), salt...)
+	combined = append(combined, unlockKey...)
+	defer zeroBytes(combined)
 	hash := sha256.Sum256(combined)
 	return hash[:], nil
 }
 
-func (r *ExtensionRuntime) ensureCredentialsLoaded() error {
-	r.credentialsMu.RLock()
-	if r.credentialsLoaded {
-		r.credentialsMu.RUnlock()
-		return nil
-	}
-	r.credentialsMu.RUnlock()
-
-	r.credentialsMu.Lock()
-	defer r.credentialsMu.Unlock()
-	if r.credentialsLoaded {
-		return nil
-	}
-
-	credPath := r.getCredentialsPath()
-	data, err := os.ReadFile(credPath)
+// readCredentialsFile decrypts an extension's credentials. Locked files
+// need the unlock key, which may prompt the user through the unlocker.
+func readCredentialsFile(extensionID, dataDir string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(credentialsFilePath(dataDir))
 	if err != nil {
 		if os.IsNotExist(err) {
-			r.credentialsCache = make(map[string]interface{})
-			r.credentialsLoaded = true
-			return nil
+			return make(map[string]interface{}), nil
 		}
-		return err
+		return nil, err
 	}
 
-	key, err := r.getEncryptionKey()
+	var unlockKey []byte
+	if isLockedCredentials(data) {
+		if unlockKey, err = acquireCredentialKey("extension:" + extensionID); err != nil {
+			return nil, err
+		}
+		defer zeroBytes(unlockKey)
+		data = data[len(lockedCredentialsMagic):]
+	}
+
+	key, err := credentialsKey(extensionID, dataDir, unlockKey)
 	if err != nil {
-		return fmt.Errorf("failed to get encryption key: %w", err)
+		return nil, fmt.Errorf("failed to get encryption key: %w", err)
 	}
+	defer zeroBytes(key)
 	decrypted, err := decryptAES(data, key)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt credentials: %w", err)
+		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
 	}
+	defer zeroBytes(decrypted)
 
 	var creds map[string]interface{}
 	if err := json.Unmarshal(decrypted, &creds); err != nil {
-		return err
+		return nil, err
 	}
 	if creds == nil {
 		creds = make(map[string]interface{})
 	}
+	return creds, nil
+}
 
+// encryptCredentials seals creds for dataDir, under unlockKey when it is
+// set.
+func encryptCredentials(extensionID, dataDir string, creds map[string]interface{}, unlockKey []byte) ([]byte, error) {
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(data)
+
+	key, err := credentialsKey(extensionID, dataDir, unlockKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key: %w", err)
+	}
+	defer zeroBytes(key)
+	encrypted, err := encryptAES(data, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	if unlockKey != nil {
+		encrypted = append([]byte(lockedCredentialsMagic), encrypted...)
+	}
+	return encrypted, nil
+}
+
+// writeCredentialsData replaces dataDir's credentials file atomically, so a
+// failed write never leaves a half-written file.
+func writeCredentialsData(dataDir string, data []byte) error {
+	path := credentialsFilePath(dataDir)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// writeCredentialsFile encrypts creds, under the unlock key when the
+// credential lock is on.
+func writeCredentialsFile(extensionID, dataDir string, creds map[string]interface{}) error {
+	var unlockKey []byte
+	if CredentialLockEnabled() {
+		var err error
+		if unlockKey, err = acquireCredentialKey("extension:" + extensionID); err != nil {
+			return err
+		}
+		defer zeroBytes(unlockKey)
+	}
+
+	encrypted, err := encryptCredentials(extensionID, dataDir, creds, unlockKey)
+	if err != nil {
+		return err
+	}
+	return writeCredentialsData(dataDir, encrypted)
+}
+
+func (r *ExtensionRuntime) ensureCredentialsLoaded() error {
+	// A cache filled while unlocked must not outlive the unlock.
+	if CredentialLockEnabled() && !credentialsUnlocked() {
+		r.dropCredentialsCache()
+	}
+
+	r.credentialsMu.RLock()
+	if r.credentialsLoaded {
+		r.credentialsMu.RUnlock()
+		return nil
+	}
+	r.credentialsMu.RUnlock()
+
+	r.credentialsMu.Lock()
+	defer r.credentialsMu.Unlock()
+	if r.credentialsLoaded {
+		return nil
+	}
+
+	creds, err := readCredentialsFile(r.extensionID, r.dataDir)
+	if err != nil {
+		return err
+	}
 	r.credentialsCache = creds
 	r.credentialsLoaded = true
 	return nil
 }
 
+func (r *ExtensionRuntime) dropCredentialsCache() {
+	r.credentialsMu.Lock()
+	r.credentialsCache = nil
+	r.credentialsLoaded = false
+	r.credentialsMu.Unlock()
+
+	r.secretsMu.Lock()
+	r.secretsCache = nil
+	r.secretsMu.Unlock()
+}
+
 func (r *ExtensionRuntime) loadCredentials() (map[string]interface{}, error) {
 	if err := r.ensureCredentialsLoaded(); err != nil {
 		return nil, err
@@ -354,22 +446,7 @@ func (r *ExtensionRuntime) loadCredentials() (map[string]interface{}, error) {
 }
 
 func (r *ExtensionRuntime) saveCredentials(creds map[string]interface{}) error {
-	data, err := json.Marshal(creds)
-	if err != nil {
-		return err
-	}
-
-	key, err := r.getEncryptionKey()
-	if err != nil {
-		return fmt.Errorf("failed to get encryption key: %w", err)
-	}
-	encrypted, err := encryptAES(data, key)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt credentials: %w", err)
-	}
-
-	credPath := r.getCredentialsPath()
-	if err := os.WriteFile(credPath, encrypted, 0600); err != nil {
+	if err := writeCredentialsFile(r.extensionID, r.dataDir, creds); err != nil {
 		return err
 	}
 
@@ -0,0 +1,194 @@
+package gobackend
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Tidal binding ====================
+//
+// tidal.startDeviceLogin/pollDeviceLogin/refreshToken run the device-code
+// login with the preconfigured TV profile (see tidal_device_auth.go) and
+// keep the tokens in the extension's auth state, so auth.getTokens and
+// auth.isAuthenticated work as after any other login. They are auth APIs:
+// unsigned extensions and extensions without auth.tidal.com access are
+// refused. tidal.decodeManifest needs no permission.
+
+type pendingTidalDeviceLogin struct {
+	profile    tidalDeviceProfile
+	deviceCode string
+	expiresAt  time.Time
+}
+
+var (
+	tidalDeviceLoginsMu sync.Mutex
+	tidalDeviceLogins   = make(map[string]*pendingTidalDeviceLogin)
+)
+
+func (r *ExtensionRuntime) gateTidalAuth(fn func(goja.FunctionCall) goja.Value) func(goja.FunctionCall) goja.Value {
+	return r.gateAuth(func(call goja.FunctionCall) goja.Value {
+		if !r.manifestAllowsDomain(tidalAuthDomain) {
+			GoLog("[Extension:%s] Tidal auth denied: %s not in allowed list\n", r.extensionID, tidalAuthDomain)
+			return r.vm.ToValue(map[string]interface{}{
+				"success": false,
+				"error":   "tidal auth requires network permission for " + tidalAuthDomain,
+			})
+		}
+		return fn(call)
+	})
+}
+
+// tidalProfileFromArgs applies {clientId, clientSecret, scope} overrides.
+func tidalProfileFromArgs(call goja.FunctionCall) tidalDeviceProfile {
+	profile := defaultTidalDeviceProfile()
+	if len(call.Arguments) == 0 {
+		return profile
+	}
+	opts, ok := call.Arguments[0].Export().(map[string]interface{})
+	if !ok {
+		return profile
+	}
+	if clientID, _ := opts["clientId"].(string); clientID != "" {
+		profile.ClientID = clientID
+		profile.ClientSecret, _ = opts["clientSecret"].(string)
+	}
+	if scope, _ := opts["scope"].(string); scope != "" {
+		profile.Scope = scope
+	}
+	return profile
+}
+
+func (r *ExtensionRuntime) tidalFail(err error) goja.Value {
+	return r.vm.ToValue(map[string]interface{}{"success": false, "error": err.Error()})
+}
+
+// tidalTokenValue stores authorized tokens in the auth state.
+func (r *ExtensionRuntime) tidalTokenValue(result *TidalTokenResult) goja.Value {
+	if result.Status != "authorized" {
+		return r.vm.ToValue(map[string]interface{}{"success": true, "status": result.Status})
+	}
+	var expiresAt time.Time
+	if result.ExpiresIn > 0 {
+		expiresAt = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	SetExtensionTokens(r.extensionID, result.AccessToken, result.RefreshToken, expiresAt)
+	return r.vm.ToValue(map[string]interface{}{
+		"success":       true,
+		"status":        result.Status,
+		"access_token":  result.AccessToken,
+		"refresh_token": result.RefreshToken,
+		"expires_in":    result.ExpiresIn,
+		"userId":        result.UserID,
+		"countryCode":   result.CountryCode,
+		"username":      result.Username,
+	})
+}
+
+func (r *ExtensionRuntime) tidalStartDeviceLogin(call goja.FunctionCall) goja.Value {
+	profile := tidalProfileFromArgs(call)
+	auth, err := startTidalDeviceAuthorization(profile)
+	if err != nil {
+		GoLog("[Extension:%s] Tidal device login failed: %v\n", r.extensionID, err)
+		return r.tidalFail(err)
+	}
+
+	tidalDeviceLoginsMu.Lock()
+	tidalDeviceLogins[r.extensionID] = &pendingTidalDeviceLogin{
+		profile:    profile,
+		deviceCode: auth.DeviceCode,
+		expiresAt:  time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second),
+	}
+	tidalDeviceLoginsMu.Unlock()
+
+	GoLog("[Extension:%s] Tidal device login started, user code %s\n", r.extensionID, auth.UserCode)
+	return r.vm.ToValue(map[string]interface{}{
+		"success":                 true,
+		"userCode":                auth.UserCode,
+		"verificationUri":         auth.VerificationURI,
+		"verificationUriComplete": auth.VerificationURIComplete,
+		"expiresIn":               auth.ExpiresIn,
+		"interval":                auth.Interval,
+	})
+}
+
+// tidalPollDeviceLogin checks the login started by startDeviceLogin once;
+// the extension calls it every interval seconds until status is not
+// "pending".
+func (r *ExtensionRuntime) tidalPollDeviceLogin(call goja.FunctionCall) goja.Value {
+	tidalDeviceLoginsMu.Lock()
+	pending := tidalDeviceLogins[r.extensionID]
+	tidalDeviceLoginsMu.Unlock()
+	if pending == nil {
+		return r.tidalFail(fmt.Errorf("no device login in progress, call startDeviceLogin first"))
+	}
+	if time.Now().After(pending.expiresAt) {
+		r.dropTidalDeviceLogin()
+		return r.vm.ToValue(map[string]interface{}{"success": true, "status": "expired"})
+	}
+
+	result, err := pollTidalDeviceToken(pending.profile, pending.deviceCode)
+	if err != nil {
+		GoLog("[Extension:%s] Tidal device login poll failed: %v\n", r.extensionID, err)
+		return r.tidalFail(err)
+	}
+	if result.Status != "pending" && result.Status != "slow_down" {
+		r.dropTidalDeviceLogin()
+	}
+	if result.Status == "authorized" {
+		GoLog("[Extension:%s] Tidal device login completed\n", r.extensionID)
+	}
+	return r.tidalTokenValue(result)
+}
+
+func (r *ExtensionRuntime) dropTidalDeviceLogin() {
+	tidalDeviceLoginsMu.Lock()
+	delete(tidalDeviceLogins, r.extensionID)
+	tidalDeviceLoginsMu.Unlock()
+}
+
+// tidalRefreshToken refreshes the stored tokens; it takes the same profile
+// overrides as startDeviceLogin.
+func (r *ExtensionRuntime) tidalRefreshToken(call goja.FunctionCall) goja.Value {
+	extensionAuthStateMu.RLock()
+	refreshToken := ""
+	if state, ok := extensionAuthState[r.extensionID]; ok {
+		refreshToken = state.RefreshToken
+	}
+	extensionAuthStateMu.RUnlock()
+	if refreshToken == "" {
+		return r.tidalFail(fmt.Errorf("no refresh token, log in first"))
+	}
+
+	result, err := refreshTidalToken(tidalProfileFromArgs(call), refreshToken)
+	if err != nil {
+		GoLog("[Extension:%s] Tidal token refresh failed: %v\n", r.extensionID, err)
+		return r.tidalFail(err)
+	}
+	return r.tidalTokenValue(result)
+}
+
+func (r *ExtensionRuntime) tidalDecodeManifest(call goja.FunctionCall) goja.Value {
+	if len(call.Arguments) < 1 {
+		return r.tidalFail(fmt.Errorf("manifest is required"))
+	}
+	manifest, err := DecodeTidalManifest(call.Arguments[0].String())
+	if err != nil {
+		return r.tidalFail(err)
+	}
+	return r.vm.ToValue(map[string]interface{}{
+		"success":        true,
+		"type":           manifest.Type,
+		"mimeType":       manifest.MimeType,
+		"codec":          manifest.Codec,
+		"quality":        manifest.Quality,
+		"encryptionType": manifest.EncryptionType,
+		"sampleRate":     manifest.SampleRate,
+		"bandwidth":      manifest.Bandwidth,
+		"urls":           manifest.URLs,
+		"initUrl":        manifest.InitURL,
+		"segmentUrls":    manifest.SegmentURLs,
+	})
+}
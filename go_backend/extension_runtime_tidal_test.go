@@ -0,0 +1,134 @@
+package gobackend
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+func TestDecodeTidalManifest(t *testing.T) {
+	bts := base64.StdEncoding.EncodeToString([]byte(`{"mimeType":"audio/flac","codecs":"flac","encryptionType":"NONE","urls":["https://example.test/a.flac"]}`))
+	got, err := DecodeTidalManifest(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != "bts" || got.Codec != "flac" || got.Quality != "LOSSLESS" || len(got.URLs) != 1 {
+		t.Fatalf("unexpected BTS manifest: %+v", got)
+	}
+
+	dash := base64.StdEncoding.EncodeToString([]byte(`<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011"><Period><AdaptationSet mimeType="audio/mp4">
+<Representation codecs="flac" bandwidth="2400000" audioSamplingRate="96000">
+<SegmentTemplate initialization="https://example.test/0.mp4?a=1&amp;b=2" media="https://example.test/$Number$.mp4">
+<SegmentTimeline><S d="176128" r="2"/><S d="40000"/></SegmentTimeline>
+</SegmentTemplate></Representation></AdaptationSet></Period></MPD>`))
+	got, err = DecodeTidalManifest(dash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != "dash" || got.Quality != "HI_RES_LOSSLESS" || got.SampleRate != 96000 || got.MimeType != "audio/mp4" {
+		t.Fatalf("unexpected DASH manifest: %+v", got)
+	}
+	if got.InitURL != "https://example.test/0.mp4?a=1&b=2" || len(got.SegmentURLs) != 4 || got.SegmentURLs[3] != "https://example.test/4.mp4" {
+		t.Fatalf("unexpected DASH URLs: %q %q", got.InitURL, got.SegmentURLs)
+	}
+
+	if q := tidalQualityForCodec("mp4a.40.2", 44100, 320000); q != "HIGH" {
+		t.Fatalf("AAC 320 quality = %q", q)
+	}
+	if _, err := DecodeTidalManifest("not base64!"); err == nil {
+		t.Fatal("invalid manifest accepted")
+	}
+}
+
+func TestTidalDeviceLogin(t *testing.T) {
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/device_authorization":
+			if r.Form.Get("client_id") == "" || r.Form.Get("scope") != tidalDefaultScope {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"deviceCode":"dev-1","userCode":"ABCDE","verificationUri":"link.tidal.com","verificationUriComplete":"link.tidal.com/ABCDE","expiresIn":300,"interval":2}`))
+		case "/token":
+			if _, _, ok := r.BasicAuth(); !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch r.Form.Get("grant_type") {
+			case tidalDeviceGrantType:
+				polls++
+				if polls == 1 {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"status":400,"error":"authorization_pending","sub_status":1002}`))
+					return
+				}
+				w.Write([]byte(`{"access_token":"tidal-access-1","refresh_token":"tidal-refresh-1","expires_in":604800,"user":{"userId":7,"countryCode":"NO","username":"alpha"}}`))
+			case "refresh_token":
+				if r.Form.Get("refresh_token") != "tidal-refresh-1" {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"error":"invalid_grant"}`))
+					return
+				}
+				w.Write([]byte(`{"access_token":"tidal-access-2","expires_in":604800}`))
+			}
+		}
+	}))
+	defer server.Close()
+
+	prev := tidalAuthBaseURL
+	tidalAuthBaseURL = server.URL
+	defer func() { tidalAuthBaseURL = prev }()
+
+	ext := &LoadedExtension{
+		ID:       "tidal-test",
+		Manifest: &ExtensionManifest{Name: "tidal-test", Permissions: ExtensionPermissions{Network: []string{"auth.tidal.com"}}},
+		DataDir:  t.TempDir(),
+		Trust:    ExtensionTrustOfficial,
+	}
+	vm := goja.New()
+	NewExtensionRuntime(ext).RegisterAPIs(vm)
+	defer vm.RunString(`auth.clearAuth()`)
+	run := func(script string) string {
+		t.Helper()
+		v, err := vm.RunString(script)
+		if err != nil {
+			t.Fatalf("%s: %v", script, err)
+		}
+		return v.String()
+	}
+
+	if got := run(`var s = tidal.startDeviceLogin(); s.success + ":" + s.userCode + ":" + s.verificationUriComplete`); got != "true:ABCDE:https://link.tidal.com/ABCDE" {
+		t.Fatalf("startDeviceLogin = %q", got)
+	}
+	if got := run(`tidal.pollDeviceLogin().status`); got != "pending" {
+		t.Fatalf("first poll = %q", got)
+	}
+	if got := run(`var p = tidal.pollDeviceLogin(); p.status + ":" + p.userId + ":" + p.countryCode`); got != "authorized:7:NO" {
+		t.Fatalf("second poll = %q", got)
+	}
+	if got := run(`auth.isAuthenticated() + ":" + auth.getTokens().access_token`); got != "true:tidal-access-1" {
+		t.Fatalf("auth state = %q", got)
+	}
+	if got := run(`tidal.pollDeviceLogin().success`); got != "false" {
+		t.Fatal("poll after completion did not fail")
+	}
+	if got := run(`var f = tidal.refreshToken(); f.access_token + ":" + auth.getTokens().refresh_token`); got != "tidal-access-2:tidal-refresh-1" {
+		t.Fatalf("refreshToken = %q", got)
+	}
+
+	other := goja.New()
+	NewExtensionRuntime(&LoadedExtension{ID: "tidal-denied", Manifest: &ExtensionManifest{Name: "tidal-denied"}, DataDir: t.TempDir(), Trust: ExtensionTrustOfficial}).RegisterAPIs(other)
+	if v, _ := other.RunString(`tidal.startDeviceLogin().success`); v.ToBoolean() {
+		t.Fatal("extension without auth.tidal.com access started a login")
+	}
+}
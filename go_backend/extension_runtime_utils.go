@@ -254,25 +254,25 @@ func (r *ExtensionRuntime) randomUserAgent(call goja.FunctionCall) goja.Value {
 
 func (r *ExtensionRuntime) logDebug(call goja.FunctionCall) goja.Value {
 	msg := r.formatLogArgs(call.Arguments)
-	GoLog("[Extension:%s:DEBUG] %s\n", r.extensionID, msg)
+	logExtension(r.extensionID, "DEBUG", msg)
 	return goja.Undefined()
 }
 
 func (r *ExtensionRuntime) logInfo(call goja.FunctionCall) goja.Value {
 	msg := r.formatLogArgs(call.Arguments)
-	GoLog("[Extension:%s:INFO] %s\n", r.extensionID, msg)
+	logExtension(r.extensionID, "INFO", msg)
 	return goja.Undefined()
 }
 
 func (r *ExtensionRuntime) logWarn(call goja.FunctionCall) goja.Value {
 	msg := r.formatLogArgs(call.Arguments)
-	GoLog("[Extension:%s:WARN] %s\n", r.extensionID, msg)
+	logExtension(r.extensionID, "WARN", msg)
 	return goja.Undefined()
 }
 
 func (r *ExtensionRuntime) logError(call goja.FunctionCall) goja.Value {
 	msg := r.formatLogArgs(call.Arguments)
-	GoLog("[Extension:%s:ERROR] %s\n", r.extensionID, msg)
+	logExtension(r.extensionID, "ERROR", msg)
 	return goja.Undefined()
 }
 
@@ -0,0 +1,173 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== YouTube binding ====================
+//
+// The download side is a handback from extension.download (see
+// youtube_audio.go); youtube.getAudioFormats(videoId, {invidiousInstance})
+// lets an extension look at the available streams first, e.g. in
+// checkAvailability. Both need network permission for the player source.
+
+// youtubeURLAllowed applies the extension's network rules to a player or
+// stream URL: the host must be allowed for its trust tier and must not be a
+// private address.
+func youtubeURLAllowed(allows func(domain string) bool, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" || parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return fmt.Errorf("invalid YouTube URL %q", summarizeURLForLog(rawURL))
+	}
+	host := parsed.Hostname()
+	if youtubeIsPrivateHost(host) {
+		return fmt.Errorf("network access denied: private/local network '%s' not allowed", host)
+	}
+	if !allows(host) {
+		return fmt.Errorf("network access denied: domain '%s' not in allowed list", host)
+	}
+	return nil
+}
+
+func youtubeSourceAllowed(allows func(domain string) bool, videoID, invidiousInstance string) error {
+	return youtubeURLAllowed(allows, youtubePlayerSourceURL(videoID, invidiousInstance))
+}
+
+// extensionHook wraps extension.<name>(string) as a Go function, or
+// returns nil when the extension does not define it. Callers hold the VM.
+func (p *ExtensionProviderWrapper) extensionHook(name string) func(string) (string, error) {
+	check := fmt.Sprintf(`typeof extension !== 'undefined' && typeof extension.%s === 'function'`, name)
+	if has, err := RunWithTimeoutAndRecover(p.vm, check, youtubeHookTimeout); err != nil || !has.ToBoolean() {
+		return nil
+	}
+	return func(value string) (string, error) {
+		result, err := RunWithTimeoutAndRecover(p.vm, fmt.Sprintf("extension.%s(%q)", name, value), youtubeHookTimeout)
+		if err != nil {
+			return "", err
+		}
+		if result == nil || goja.IsUndefined(result) || goja.IsNull(result) || result.String() == "" {
+			return "", fmt.Errorf("%s returned nothing", name)
+		}
+		return result.String(), nil
+	}
+}
+
+// downloadYouTubeHandback downloads the video the extension handed back
+// and fills in result.FilePath. The caller holds the VM for the decipher
+// hooks; release is called once the stream URL is resolved so the transfer
+// does not block the extension.
+func (p *ExtensionProviderWrapper) downloadYouTubeHandback(result *ExtDownloadResult, outputPath string, onProgress func(percent int), release func()) *ExtDownloadResult {
+	fail := func(err error) *ExtDownloadResult {
+		GoLog("[YouTube] %s: %v\n", p.extension.ID, err)
+		errType := "youtube_error"
+		if errors.Is(err, ErrDownloadCancelled) {
+			errType = "cancelled"
+		}
+		return &ExtDownloadResult{Success: false, ErrorMessage: err.Error(), ErrorType: errType}
+	}
+	allows := p.extension.manifestAllowsDomain
+
+	videoID := strings.TrimSpace(result.YouTubeVideoID)
+	var info *YouTubePlayerInfo
+	var err error
+	if raw := result.YouTubePlayerResponse; len(raw) > 0 && string(raw) != "null" {
+		// Accept the response as an object or as a JSON string.
+		var text string
+		if json.Unmarshal(raw, &text) == nil {
+			raw = json.RawMessage(text)
+		}
+		info, err = parseYouTubePlayerResponse(raw)
+	} else {
+		if err := youtubeSourceAllowed(allows, videoID, result.YouTubeInvidiousInstance); err != nil {
+			return fail(err)
+		}
+		info, err = fetchYouTubePlayerInfo(videoID, result.YouTubeInvidiousInstance)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	format := selectYouTubeAudioFormat(info.Formats)
+	streamURL, err := resolveYouTubeFormatURL(format, youtubeHooks{
+		decipher:   p.extensionHook("youtubeDecipher"),
+		transformN: p.extensionHook("youtubeTransformN"),
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if err := youtubeURLAllowed(allows, streamURL); err != nil {
+		return fail(err)
+	}
+	release()
+
+	path := youtubeOutputPath(outputPath, format)
+	GoLog("[YouTube] %s: downloading %s itag %d (%s, %d bps)\n", p.extension.ID, videoID, format.Itag, format.Codec, format.Bitrate)
+	cancelled := func() bool { return isDownloadCancelled(p.itemID) }
+	if err := downloadYouTubeStream(streamURL, format.ContentLength, path, onProgress, cancelled); err != nil {
+		return fail(err)
+	}
+
+	result.FilePath = path
+	if result.SampleRate == 0 {
+		result.SampleRate = format.SampleRate
+	}
+	if result.Title == "" {
+		result.Title = info.Title
+	}
+	if result.Artist == "" {
+		result.Artist = info.Author
+	}
+	return result
+}
+
+func (r *ExtensionRuntime) youtubeGetAudioFormats(call goja.FunctionCall) goja.Value {
+	fail := func(err error) goja.Value {
+		return r.vm.ToValue(map[string]interface{}{"success": false, "error": err.Error()})
+	}
+	if len(call.Arguments) < 1 {
+		return fail(fmt.Errorf("video id is required"))
+	}
+	videoID := strings.TrimSpace(call.Arguments[0].String())
+	instance := ""
+	if len(call.Arguments) > 1 {
+		if opts, ok := call.Arguments[1].Export().(map[string]interface{}); ok {
+			instance, _ = opts["invidiousInstance"].(string)
+		}
+	}
+	if err := youtubeSourceAllowed(r.manifestAllowsDomain, videoID, instance); err != nil {
+		return fail(err)
+	}
+	info, err := fetchYouTubePlayerInfo(videoID, instance)
+	if err != nil {
+		GoLog("[Extension:%s] YouTube player request failed: %v\n", r.extensionID, err)
+		return fail(err)
+	}
+
+	formats := make([]map[string]interface{}, 0, len(info.Formats))
+	for _, f := range info.Formats {
+		formats = append(formats, map[string]interface{}{
+			"itag":          f.Itag,
+			"mimeType":      f.MimeType,
+			"codec":         f.Codec,
+			"container":     f.Container,
+			"bitrate":       f.Bitrate,
+			"sampleRate":    f.SampleRate,
+			"contentLength": f.ContentLength,
+			"ciphered":      f.URL == "",
+		})
+	}
+	return r.vm.ToValue(map[string]interface{}{
+		"success":     true,
+		"videoId":     info.VideoID,
+		"title":       info.Title,
+		"author":      info.Author,
+		"durationSec": info.DurationSec,
+		"formats":     formats,
+	})
+}
@@ -0,0 +1,196 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+const defaultMaxConcurrentExtensions = 4
+
+// ExtensionScheduler lets different extensions run on separate goroutines at
+// the same time while keeping calls into any single Goja VM serialized.
+//
+// Each call first takes the extension's VMMu, so at most one caller per VM can
+// ever be waiting for a global slot. Global slots are then handed out in FIFO
+// order, which makes slot allocation round-robin across extensions: a slow
+// extension can only ever hold one slot and cannot starve the others.
+//
+// Downloads hold their VM for up to ExtDownloadTimeout, so they draw from a
+// pool of their own (of the same size). A few long downloads therefore cannot
+// take the slots that search and metadata calls on other extensions need.
+type ExtensionScheduler struct {
+	mu            sync.Mutex
+	maxConcurrent int
+	calls         extensionSlots
+	downloads     extensionSlots
+	active        map[string]int
+	queued        map[string]int
+}
+
+// extensionSlots is one pool of global slots, guarded by the scheduler's mu.
+type extensionSlots struct {
+	running int
+	waiters []chan struct{}
+}
+
+type ExtensionSchedulerStats struct {
+	MaxConcurrent    int            `json:"max_concurrent"`
+	Running          int            `json:"running"`
+	Waiting          int            `json:"waiting"`
+	DownloadsRunning int            `json:"downloads_running"`
+	DownloadsWaiting int            `json:"downloads_waiting"`
+	Active           map[string]int `json:"active"`
+	Queued           map[string]int `json:"queued"`
+}
+
+var (
+	globalExtScheduler     *ExtensionScheduler
+	globalExtSchedulerOnce sync.Once
+)
+
+func GetExtensionScheduler() *ExtensionScheduler {
+	globalExtSchedulerOnce.Do(func() {
+		globalExtScheduler = &ExtensionScheduler{
+			maxConcurrent: defaultMaxConcurrentExtensions,
+			active:        make(map[string]int),
+			queued:        make(map[string]int),
+		}
+	})
+	return globalExtScheduler
+}
+
+func (s *ExtensionScheduler) SetMaxConcurrent(max int) {
+	if max < 1 {
+		max = 1
+	}
+
+	s.mu.Lock()
+	s.maxConcurrent = max
+	s.grantLocked()
+	s.mu.Unlock()
+
+	GoLog("[ExtensionScheduler] Max concurrent extensions set to %d\n", max)
+}
+
+func (s *ExtensionScheduler) MaxConcurrent() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxConcurrent
+}
+
+// Acquire blocks until the extension's VM is free and a global slot is
+// available. The returned function must be called exactly once to release both.
+func (s *ExtensionScheduler) Acquire(ext *LoadedExtension) func() {
+	return s.acquire(ext, &s.calls)
+}
+
+// AcquireDownload is Acquire for extension downloads, which take a slot from
+// the download pool instead.
+func (s *ExtensionScheduler) AcquireDownload(ext *LoadedExtension) func() {
+	return s.acquire(ext, &s.downloads)
+}
+
+func (s *ExtensionScheduler) acquire(ext *LoadedExtension, pool *extensionSlots) func() {
+	s.mu.Lock()
+	s.queued[ext.ID]++
+	s.mu.Unlock()
+
+	ext.VMMu.Lock()
+	s.acquireSlot(pool)
+
+	s.mu.Lock()
+	s.decrementLocked(s.queued, ext.ID)
+	s.active[ext.ID]++
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.decrementLocked(s.active, ext.ID)
+			pool.running--
+			s.grantLocked()
+			s.mu.Unlock()
+
+			ext.VMMu.Unlock()
+		})
+	}
+}
+
+func (s *ExtensionScheduler) acquireSlot(pool *extensionSlots) {
+	s.mu.Lock()
+	if pool.running < s.maxConcurrent && len(pool.waiters) == 0 {
+		pool.running++
+		s.mu.Unlock()
+		return
+	}
+
+	ch := make(chan struct{})
+	pool.waiters = append(pool.waiters, ch)
+	s.mu.Unlock()
+
+	<-ch
+}
+
+// grantLocked hands free slots to waiters in arrival order. The slot is
+// counted as running before the waiter wakes up.
+func (s *ExtensionScheduler) grantLocked() {
+	for _, pool := range []*extensionSlots{&s.calls, &s.downloads} {
+		for pool.running < s.maxConcurrent && len(pool.waiters) > 0 {
+			ch := pool.waiters[0]
+			pool.waiters[0] = nil
+			pool.waiters = pool.waiters[1:]
+			pool.running++
+			close(ch)
+		}
+	}
+}
+
+func (s *ExtensionScheduler) decrementLocked(counts map[string]int, extensionID string) {
+	if counts[extensionID] <= 1 {
+		delete(counts, extensionID)
+		return
+	}
+	counts[extensionID]--
+}
+
+func (s *ExtensionScheduler) Stats() ExtensionSchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := ExtensionSchedulerStats{
+		MaxConcurrent:    s.maxConcurrent,
+		Running:          s.calls.running,
+		Waiting:          len(s.calls.waiters),
+		DownloadsRunning: s.downloads.running,
+		DownloadsWaiting: len(s.downloads.waiters),
+		Active:           make(map[string]int, len(s.active)),
+		Queued:           make(map[string]int, len(s.queued)),
+	}
+	for id, n := range s.active {
+		stats.Active[id] = n
+	}
+	for id, n := range s.queued {
+		stats.Queued[id] = n
+	}
+	return stats
+}
+
+func (s *ExtensionScheduler) StatsJSON() (string, error) {
+	jsonBytes, err := json.Marshal(s.Stats())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// acquireExtensionVM is the entry point used by provider wrappers before
+// calling into an extension VM.
+func acquireExtensionVM(ext *LoadedExtension) func() {
+	return GetExtensionScheduler().Acquire(ext)
+}
+
+// acquireExtensionDownloadVM is acquireExtensionVM for download calls.
+func acquireExtensionDownloadVM(ext *LoadedExtension) func() {
+	return GetExtensionScheduler().AcquireDownload(ext)
+}
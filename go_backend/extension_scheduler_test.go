@@ -0,0 +1,127 @@
+package gobackend
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestScheduler(max int) *ExtensionScheduler {
+	return &ExtensionScheduler{
+		maxConcurrent: max,
+		active:        make(map[string]int),
+		queued:        make(map[string]int),
+	}
+}
+
+func TestExtensionScheduler_SerializesSameVM(t *testing.T) {
+	s := newTestScheduler(4)
+	ext := &LoadedExtension{ID: "ext-a"}
+
+	var inFlight, maxSeen int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := s.Acquire(ext)
+			defer release()
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				old := atomic.LoadInt32(&maxSeen)
+				if n <= old || atomic.CompareAndSwapInt32(&maxSeen, old, n) {
+					break
+				}
+			}
+			time.Sleep(2 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}()
+	}
+	wg.Wait()
+
+	if maxSeen != 1 {
+		t.Fatalf("expected calls into one VM to be serialized, saw %d concurrent", maxSeen)
+	}
+}
+
+func TestExtensionScheduler_LimitsConcurrentExtensions(t *testing.T) {
+	s := newTestScheduler(2)
+
+	var inFlight, maxSeen int32
+	var wg sync.WaitGroup
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		ext := &LoadedExtension{ID: id}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := s.Acquire(ext)
+			defer release()
+			n := atomic.AddInt32(&inFlight, 1)
+			for {
+				old := atomic.LoadInt32(&maxSeen)
+				if n <= old || atomic.CompareAndSwapInt32(&maxSeen, old, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&inFlight, -1)
+		}()
+	}
+	wg.Wait()
+
+	if maxSeen > 2 {
+		t.Fatalf("expected at most 2 concurrent extensions, saw %d", maxSeen)
+	}
+	if stats := s.Stats(); stats.Running != 0 || stats.Waiting != 0 {
+		t.Fatalf("expected scheduler to be idle, got %+v", stats)
+	}
+}
+
+func TestExtensionScheduler_RaisingLimitWakesWaiters(t *testing.T) {
+	s := newTestScheduler(1)
+	first := s.Acquire(&LoadedExtension{ID: "slow"})
+
+	done := make(chan struct{})
+	go func() {
+		release := s.Acquire(&LoadedExtension{ID: "fast"})
+		release()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("second extension should wait while the only slot is held")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	s.SetMaxConcurrent(2)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("raising the limit should wake the waiting extension")
+	}
+	first()
+}
+
+func TestExtensionScheduler_DownloadsDoNotStarveCalls(t *testing.T) {
+	s := newTestScheduler(1)
+	download := s.AcquireDownload(&LoadedExtension{ID: "downloader"})
+	defer download()
+
+	done := make(chan struct{})
+	go func() {
+		release := s.Acquire(&LoadedExtension{ID: "search"})
+		release()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a running download took the only call slot")
+	}
+
+	if stats := s.Stats(); stats.DownloadsRunning != 1 || stats.Running != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+
+	"github.com/dop251/goja"
 )
 
 type ExtensionSettingsStore struct {
@@ -41,8 +44,10 @@ func (s *ExtensionSettingsStore) SetDataDir(dataDir string) error {
 	return s.loadAllSettings()
 }
 
+const extensionSettingsFile = "settings.json"
+
 func (s *ExtensionSettingsStore) getSettingsPath(extensionID string) string {
-	return filepath.Join(s.dataDir, extensionID, "settings.json")
+	return filepath.Join(s.dataDir, extensionID, extensionSettingsFile)
 }
 
 func (s *ExtensionSettingsStore) loadAllSettings() error {
@@ -57,6 +62,10 @@ func (s *ExtensionSettingsStore) loadAllSettings() error {
 	for _, entry := range entries {
 		if entry.IsDir() {
 			extensionID := entry.Name()
+			if err := openStore(filepath.Join(s.dataDir, extensionID), extensionSettingsStoreSchema); err != nil {
+				GoLog("[ExtensionSettings] Failed to open settings for %s: %v\n", extensionID, err)
+				continue
+			}
 			settings, err := s.loadSettings(extensionID)
 			if err != nil {
 				GoLog("[ExtensionSettings] Failed to load settings for %s: %v\n", extensionID, err)
@@ -196,3 +205,264 @@ func (s *ExtensionSettingsStore) GetAllExtensionSettingsJSON() (string, error) {
 
 	return string(data), nil
 }
+
+// ==================== Settings schema ====================
+//
+// Extensions declare their settings in manifest.settings: boolean, number,
+// string (secret when "secret": true), select (an enum over options) and
+// button. Values are checked against that schema before they are stored,
+// and the VM sees the result as a global `settings` object with manifest
+// defaults filled in. Secret settings are kept in the secrets vault, not in
+// settings.json. Keys starting with "_" belong to the backend.
+
+// ExtensionSettingsView is what GetExtensionSettings returns to Flutter.
+// Secret values are never sent back; SecretsSet lists the ones stored.
+type ExtensionSettingsView struct {
+	ExtensionID string                 `json:"extension_id"`
+	Schema      []ExtensionSetting     `json:"schema"`
+	Values      map[string]interface{} `json:"values"`
+	SecretsSet  []string               `json:"secrets_set"`
+}
+
+func findExtensionSetting(manifest *ExtensionManifest, key string) *ExtensionSetting {
+	for i := range manifest.Settings {
+		if manifest.Settings[i].Key == key {
+			return &manifest.Settings[i]
+		}
+	}
+	return nil
+}
+
+// checkSettingValue returns value in the type setting declares. JSON numbers
+// arrive as float64, so number settings accept those only.
+func checkSettingValue(setting ExtensionSetting, value interface{}) (interface{}, error) {
+	switch setting.Type {
+	case SettingTypeBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case SettingTypeNumber:
+		if n, ok := value.(float64); ok {
+			return n, nil
+		}
+	case SettingTypeString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case SettingTypeSelect:
+		if s, ok := value.(string); ok {
+			for _, option := range setting.Options {
+				if s == option {
+					return s, nil
+				}
+			}
+			return nil, fmt.Errorf("%s must be one of %v", setting.Key, setting.Options)
+		}
+	case SettingTypeButton:
+		return nil, fmt.Errorf("%s is a button and has no value", setting.Key)
+	default:
+		return nil, fmt.Errorf("%s has unknown type %q", setting.Key, setting.Type)
+	}
+	return nil, fmt.Errorf("%s must be a %s", setting.Key, setting.Type)
+}
+
+// effectiveExtensionSettings merges stored values over manifest defaults and
+// drops the backend's own keys.
+func effectiveExtensionSettings(manifest *ExtensionManifest, stored map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	if manifest != nil {
+		for _, setting := range manifest.Settings {
+			if setting.Default != nil && setting.Type != SettingTypeButton {
+				result[setting.Key] = setting.Default
+			}
+		}
+	}
+	for key, value := range stored {
+		if !strings.HasPrefix(key, "_") {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// injectSettings exposes settings to the VM as the global `settings`. The
+// object is a copy; extensions change settings through the app.
+func (r *ExtensionRuntime) injectSettings(vm *goja.Runtime, settings map[string]interface{}) {
+	r.SetSettings(settings)
+	obj := vm.NewObject()
+	for k, v := range settings {
+		obj.Set(k, v)
+	}
+	vm.Set("settings", obj)
+}
+
+func getExtensionSettingsView(extensionID string) (*ExtensionSettingsView, error) {
+	ext, err := GetExtensionManager().GetExtension(extensionID)
+	if err != nil {
+		return nil, err
+	}
+	view := ExtensionSettingsView{
+		ExtensionID: extensionID,
+		Schema:      ext.Manifest.Settings,
+		Values:      effectiveExtensionSettings(ext.Manifest, GetExtensionSettingsStore().GetAll(extensionID)),
+		SecretsSet:  []string{},
+	}
+	if view.Schema == nil {
+		view.Schema = []ExtensionSetting{}
+	}
+	var secrets map[string]string
+	if hasSecretSettings(ext.Manifest) && vaultReadable() {
+		secrets, _ = readExtensionSecrets(ext.ID, ext.DataDir)
+	}
+	for _, setting := range ext.Manifest.Settings {
+		if !setting.Secret {
+			continue
+		}
+		if secrets[setting.Key] != "" {
+			view.SecretsSet = append(view.SecretsSet, setting.Key)
+		}
+		delete(view.Values, setting.Key)
+	}
+	return &view, nil
+}
+
+func hasSecretSettings(manifest *ExtensionManifest) bool {
+	for _, setting := range manifest.Settings {
+		if setting.Secret {
+			return true
+		}
+	}
+	return false
+}
+
+// moveSecretSettings takes the manifest's secret settings out of settings
+// and into the extension's secrets vault. Empty values clear the secret only
+// with clearEmpty; a settings form that never saw the masked value sends
+// them back empty.
+func moveSecretSettings(ext *LoadedExtension, settings map[string]interface{}, clearEmpty bool) error {
+	moved := make(map[string]string)
+	for _, setting := range ext.Manifest.Settings {
+		value, ok := settings[setting.Key]
+		if !setting.Secret || !ok {
+			continue
+		}
+		delete(settings, setting.Key)
+		if s, _ := value.(string); s != "" || clearEmpty {
+			moved[setting.Key] = s
+		}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	return updateExtensionSecrets(ext, func(secrets map[string]string) {
+		for key, value := range moved {
+			if value == "" {
+				delete(secrets, key)
+			} else {
+				secrets[key] = value
+			}
+		}
+	})
+}
+
+// vmExtensionSettings is what the VM sees: effective settings plus the
+// secret settings, when the vault can be read without a prompt.
+func vmExtensionSettings(ext *LoadedExtension, stored map[string]interface{}) map[string]interface{} {
+	settings := effectiveExtensionSettings(ext.Manifest, stored)
+	if ext.Manifest == nil || !hasSecretSettings(ext.Manifest) || !vaultReadable() {
+		return settings
+	}
+	secrets, err := readExtensionSecrets(ext.ID, ext.DataDir)
+	if err != nil {
+		GoLog("[ExtensionSettings] Failed to read secrets for %s: %v\n", ext.ID, err)
+		return settings
+	}
+	for _, setting := range ext.Manifest.Settings {
+		if value, ok := secrets[setting.Key]; setting.Secret && ok {
+			settings[setting.Key] = value
+		}
+	}
+	return settings
+}
+
+// migrateSecretSettings moves secret settings saved to settings.json by
+// older builds into the vault. While the credential lock is closed it does
+// nothing; migrateAllSecretSettings retries once the user unlocks.
+func migrateSecretSettings(ext *LoadedExtension) {
+	if ext.Manifest == nil || !hasSecretSettings(ext.Manifest) || !vaultReadable() {
+		return
+	}
+	store := GetExtensionSettingsStore()
+	stored := store.GetAll(ext.ID)
+	before := len(stored)
+	if err := moveSecretSettings(ext, stored, false); err != nil {
+		GoLog("[ExtensionSettings] Failed to move secrets for %s: %v\n", ext.ID, err)
+		return
+	}
+	if len(stored) != before {
+		if err := store.SetAll(ext.ID, stored); err != nil {
+			GoLog("[ExtensionSettings] Failed to save settings for %s: %v\n", ext.ID, err)
+		}
+	}
+}
+
+// migrateAllSecretSettings runs migrateSecretSettings for every loaded
+// extension, e.g. for those that loaded while the vault was locked.
+func migrateAllSecretSettings() {
+	for _, ext := range GetExtensionManager().GetAllExtensions() {
+		migrateSecretSettings(ext)
+	}
+}
+
+// GetExtensionSettings returns the extension's settings schema and current
+// values as JSON.
+func GetExtensionSettings(extensionID string) (string, error) {
+	view, err := getExtensionSettingsView(extensionID)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(view)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// SetExtensionSetting validates and stores one setting, then re-initializes
+// the extension with the new values. valueJSON null resets the setting to
+// its manifest default.
+func SetExtensionSetting(extensionID, key, valueJSON string) error {
+	manager := GetExtensionManager()
+	ext, err := manager.GetExtension(extensionID)
+	if err != nil {
+		return err
+	}
+	setting := findExtensionSetting(ext.Manifest, key)
+	if setting == nil {
+		return fmt.Errorf("extension '%s' has no setting '%s'", extensionID, key)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(valueJSON), &value); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	if value != nil {
+		if value, err = checkSettingValue(*setting, value); err != nil {
+			return err
+		}
+	}
+
+	store := GetExtensionSettingsStore()
+	switch {
+	case setting.Secret:
+		err = moveSecretSettings(ext, map[string]interface{}{key: value}, true)
+	case value == nil:
+		err = store.Remove(extensionID, key)
+	default:
+		err = store.Set(extensionID, key, value)
+	}
+	if err != nil {
+		return err
+	}
+	return manager.InitializeExtension(extensionID, store.GetAll(extensionID))
+}
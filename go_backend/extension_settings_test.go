@@ -0,0 +1,108 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtensionSettingsSchema(t *testing.T) {
+	if err := GetExtensionSettingsStore().SetDataDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	script := `registerExtension({
+  initialize: function (s) { this.seen = s.quality + ":" + settings.hires; },
+  describe: function () { return this.seen + ":" + settings.token; }
+});
+var loadedQuality = settings.quality;`
+	if err := os.WriteFile(filepath.Join(dir, "index.js"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := ParseManifest([]byte(`{
+  "name": "settings-ext", "version": "1.0.0", "author": "a", "description": "d",
+  "type": ["metadata_provider"],
+  "settings": [
+    {"key": "hires", "type": "boolean", "label": "Hi-res", "default": false},
+    {"key": "quality", "type": "select", "label": "Quality", "options": ["low", "high"], "default": "high"},
+    {"key": "token", "type": "string", "label": "Token", "secret": true}
+  ]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := &LoadedExtension{ID: "settings-ext", Manifest: manifest, DataDir: t.TempDir(), SourceDir: dir}
+	m := GetExtensionManager()
+	if err := m.initializeVM(ext); err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.extensions[ext.ID] = ext
+	m.mu.Unlock()
+	t.Cleanup(func() {
+		m.mu.Lock()
+		delete(m.extensions, ext.ID)
+		m.mu.Unlock()
+		unregisterExtensionVM(ext.VM)
+		GetExtensionSettingsStore().RemoveAll(ext.ID)
+	})
+
+	if got := ext.VM.Get("loadedQuality").String(); got != "high" {
+		t.Fatalf("settings global at load = %q, want manifest default", got)
+	}
+
+	if err := SetExtensionSetting(ext.ID, "quality", `"ultra"`); err == nil {
+		t.Fatal("value outside options accepted")
+	}
+	if err := SetExtensionSetting(ext.ID, "hires", `"yes"`); err == nil {
+		t.Fatal("string accepted for boolean")
+	}
+	if err := SetExtensionSetting(ext.ID, "missing", `1`); err == nil {
+		t.Fatal("unknown key accepted")
+	}
+	for key, value := range map[string]string{"hires": `true`, "quality": `"low"`, "token": `"s3cret"`} {
+		if err := SetExtensionSetting(ext.ID, key, value); err != nil {
+			t.Fatalf("SetExtensionSetting(%s): %v", key, err)
+		}
+	}
+	if got, _ := RunWithTimeoutAndRecover(ext.VM, "extension.describe()", DefaultJSTimeout); got.String() != "low:true:s3cret" {
+		t.Fatalf("extension saw %q", got.String())
+	}
+
+	raw, err := GetExtensionSettings(ext.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(raw, "s3cret") {
+		t.Fatal("secret value returned to the app")
+	}
+	var view ExtensionSettingsView
+	json.Unmarshal([]byte(raw), &view)
+	if len(view.Schema) != 3 || view.Values["quality"] != "low" || view.Values["hires"] != true || len(view.SecretsSet) != 1 {
+		t.Fatalf("unexpected view: %+v", view)
+	}
+
+	if err := SetExtensionSetting(ext.ID, "quality", `null`); err != nil {
+		t.Fatal(err)
+	}
+	if got := ext.VM.Get("settings").ToObject(ext.VM).Get("quality").String(); got != "high" {
+		t.Fatalf("reset setting = %q, want default", got)
+	}
+}
+
+func TestManifestSettingsValidation(t *testing.T) {
+	base := `{"name": "x", "version": "1", "author": "a", "description": "d", "type": ["metadata_provider"], "settings": %s}`
+	for _, settings := range []string{
+		`[{"key": "_enabled", "type": "boolean"}]`,
+		`[{"key": "a", "type": "string"}, {"key": "a", "type": "number"}]`,
+		`[{"key": "a", "type": "select", "options": ["x"], "default": "y"}]`,
+		`[{"key": "a", "type": "boolean", "default": "true"}]`,
+	} {
+		if _, err := ParseManifest([]byte(strings.Replace(base, "%s", settings, 1))); err == nil {
+			t.Errorf("manifest with settings %s accepted", settings)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package gobackend
+
+import (
+	"archive/zip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Extension signing and trust ====================
+//
+// A package may carry signature.json: an ed25519 signature by a publisher key
+// over the SHA-256 of every other file in the archive. The signature is
+// checked at install and again when the extracted folder is loaded, and the
+// result is the extension's trust level:
+//
+//	official   signed with a key built into the app
+//	community  signed with a key the user chose to trust
+//	unsigned   no signature, or one from an unknown key
+//
+// A signature that fails against a known key rejects the install. Unsigned
+// extensions run without the auth API and without wildcard network
+// permissions until the user overrides that for the extension.
+
+type ExtensionTrust string
+
+const (
+	ExtensionTrustOfficial  ExtensionTrust = "official"
+	ExtensionTrustCommunity ExtensionTrust = "community"
+	ExtensionTrustUnsigned  ExtensionTrust = "unsigned"
+)
+
+const (
+	extensionSignatureFile = "signature.json"
+	extensionTrustFile     = "extension_trust.json"
+	extensionSigningPrefix = "spotiflac-ext-sig-v1\n"
+)
+
+// officialPublisherKeys maps key IDs to base64 ed25519 public keys of the
+// app's own extension publisher. They ship in official_publishers.json,
+// {"key-id": {"publisher": "...", "public_key": "<base64>"}}, next to this
+// file; release builds add the publisher's key there.
+var officialPublisherKeys = parseOfficialPublisherKeys(officialPublishersJSON)
+
+//go:embed official_publishers.json
+var officialPublishersJSON []byte
+
+// parseOfficialPublisherKeys decodes the embedded key list, dropping entries
+// that are not valid ed25519 public keys.
+func parseOfficialPublisherKeys(data []byte) map[string]PublisherKey {
+	var keys map[string]PublisherKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		GoLog("[Extension] Ignoring invalid official publisher keys: %v\n", err)
+		return map[string]PublisherKey{}
+	}
+	for id, key := range keys {
+		if raw, err := base64.StdEncoding.DecodeString(key.PublicKey); err != nil || len(raw) != ed25519.PublicKeySize {
+			GoLog("[Extension] Ignoring official publisher key %s: not an ed25519 public key\n", id)
+			delete(keys, id)
+		}
+	}
+	if keys == nil {
+		keys = map[string]PublisherKey{}
+	}
+	return keys
+}
+
+type PublisherKey struct {
+	Publisher string `json:"publisher"`
+	PublicKey string `json:"public_key"`
+}
+
+type extensionSignature struct {
+	Publisher string `json:"publisher"`
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"`
+}
+
+type extensionTrustFileData struct {
+	Publishers map[string]PublisherKey `json:"publishers"`
+	Overrides  map[string]bool         `json:"overrides"`
+}
+
+// ExtensionTrustInfo is what the app shows on the extension's detail page.
+type ExtensionTrustInfo struct {
+	ExtensionID string         `json:"extension_id"`
+	Trust       ExtensionTrust `json:"trust"`
+	Publisher   string         `json:"publisher,omitempty"`
+	Override    bool           `json:"override"`
+	Restricted  bool           `json:"restricted"`
+}
+
+var (
+	extensionTrustMu     sync.RWMutex
+	extensionTrustDir    string
+	communityPublishers  = make(map[string]PublisherKey)
+	extensionTrustAllows = make(map[string]bool)
+)
+
+func loadExtensionTrust(dir string) {
+	var state extensionTrustFileData
+	if data, err := os.ReadFile(filepath.Join(dir, extensionTrustFile)); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			GoLog("[Extension] Ignoring corrupt %s: %v\n", extensionTrustFile, err)
+			state = extensionTrustFileData{}
+		}
+	}
+	if state.Publishers == nil {
+		state.Publishers = make(map[string]PublisherKey)
+	}
+	if state.Overrides == nil {
+		state.Overrides = make(map[string]bool)
+	}
+
+	extensionTrustMu.Lock()
+	extensionTrustDir = dir
+	communityPublishers = state.Publishers
+	extensionTrustAllows = state.Overrides
+	extensionTrustMu.Unlock()
+}
+
+func saveExtensionTrustLocked() error {
+	if extensionTrustDir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(extensionTrustFileData{
+		Publishers: communityPublishers,
+		Overrides:  extensionTrustAllows,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(extensionTrustDir, extensionTrustFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func decodePublisherKey(key PublisherKey) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// lookupPublisherKey returns the key for keyID and the trust it grants.
+func lookupPublisherKey(keyID string) (PublisherKey, ExtensionTrust, bool) {
+	if key, ok := officialPublisherKeys[keyID]; ok {
+		return key, ExtensionTrustOfficial, true
+	}
+	extensionTrustMu.RLock()
+	defer extensionTrustMu.RUnlock()
+	if key, ok := communityPublishers[keyID]; ok {
+		return key, ExtensionTrustCommunity, true
+	}
+	return PublisherKey{}, ExtensionTrustUnsigned, false
+}
+
+// TrustPublisherKey adds a community publisher key. Extensions it signed are
+// re-evaluated on their next install or load.
+func TrustPublisherKey(keyID, publisher, publicKeyBase64 string) error {
+	keyID = strings.TrimSpace(keyID)
+	if keyID == "" {
+		return fmt.Errorf("key_id is required")
+	}
+	if _, ok := officialPublisherKeys[keyID]; ok {
+		return fmt.Errorf("key %s is already an official key", keyID)
+	}
+	key := PublisherKey{Publisher: strings.TrimSpace(publisher), PublicKey: strings.TrimSpace(publicKeyBase64)}
+	if _, err := decodePublisherKey(key); err != nil {
+		return err
+	}
+
+	extensionTrustMu.Lock()
+	defer extensionTrustMu.Unlock()
+	communityPublishers[keyID] = key
+	GoLog("[Extension] Trusted publisher key %s (%s)\n", keyID, key.Publisher)
+	return saveExtensionTrustLocked()
+}
+
+func UntrustPublisherKey(keyID string) error {
+	extensionTrustMu.Lock()
+	defer extensionTrustMu.Unlock()
+	delete(communityPublishers, keyID)
+	return saveExtensionTrustLocked()
+}
+
+func GetTrustedPublisherKeys() map[string]PublisherKey {
+	extensionTrustMu.RLock()
+	defer extensionTrustMu.RUnlock()
+	keys := make(map[string]PublisherKey, len(communityPublishers))
+	for id, key := range communityPublishers {
+		keys[id] = key
+	}
+	return keys
+}
+
+// extensionSigningPayload is the signed message: one "<sha256> <path>" line
+// per file, sorted by path, signature.json excluded.
+func extensionSigningPayload(fileHashes map[string]string) []byte {
+	names := make([]string, 0, len(fileHashes))
+	for name := range fileHashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(extensionSigningPrefix)
+	for _, name := range names {
+		b.WriteString(fileHashes[name])
+		b.WriteByte(' ')
+		b.WriteString(name)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// signingPath returns the slash-separated name a file is signed under, or ""
+// for entries that are not extracted.
+func signingPath(name string) string {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if clean == "." || strings.HasPrefix(clean, "..") || strings.HasPrefix(clean, "/") {
+		return ""
+	}
+	return clean
+}
+
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyExtensionSignature checks sigData against the file hashes. A missing
+// signature or unknown key is unsigned; a bad signature is an error.
+func verifyExtensionSignature(sigData []byte, fileHashes map[string]string) (ExtensionTrust, string, error) {
+	if sigData == nil {
+		return ExtensionTrustUnsigned, "", nil
+	}
+	var sig extensionSignature
+	if err := json.Unmarshal(sigData, &sig); err != nil {
+		return "", "", fmt.Errorf("invalid %s: %w", extensionSignatureFile, err)
+	}
+	key, trust, ok := lookupPublisherKey(sig.KeyID)
+	if !ok {
+		GoLog("[Extension] Signature by unknown key %q (%s), treating as unsigned\n", sig.KeyID, sig.Publisher)
+		return ExtensionTrustUnsigned, "", nil
+	}
+	publicKey, err := decodePublisherKey(key)
+	if err != nil {
+		return "", "", fmt.Errorf("publisher key %s: %w", sig.KeyID, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil || !ed25519.Verify(publicKey, extensionSigningPayload(fileHashes), signature) {
+		return "", "", fmt.Errorf("extension signature does not match publisher key %s", sig.KeyID)
+	}
+	return trust, key.Publisher, nil
+}
+
+func verifyExtensionArchive(files []*zip.File) (ExtensionTrust, string, error) {
+	fileHashes := make(map[string]string)
+	var sigData []byte
+	for _, file := range files {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		name := signingPath(file.Name)
+		if name == "" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to open %s: %w", file.Name, err)
+		}
+		if name == extensionSignatureFile {
+			sigData, err = io.ReadAll(rc)
+		} else {
+			fileHashes[name], err = hashReader(rc)
+		}
+		rc.Close()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+	}
+	return verifyExtensionSignature(sigData, fileHashes)
+}
+
+func verifyExtensionDir(dir string) (ExtensionTrust, string, error) {
+	fileHashes := make(map[string]string)
+	var sigData []byte
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == extensionSignatureFile {
+			sigData, err = os.ReadFile(p)
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fileHashes[name], err = hashReader(f)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return verifyExtensionSignature(sigData, fileHashes)
+}
+
+// extensionRestricted reports whether sensitive capabilities are withheld
+// from extensionID at the given trust level.
+func extensionRestricted(extensionID string, trust ExtensionTrust) bool {
+	if trust == ExtensionTrustOfficial || trust == ExtensionTrustCommunity {
+		return false
+	}
+	extensionTrustMu.RLock()
+	defer extensionTrustMu.RUnlock()
+	return !extensionTrustAllows[extensionID]
+}
+
+// SetExtensionTrustOverride lets the user grant an unsigned extension the
+// restricted capabilities, or take them back.
+func SetExtensionTrustOverride(extensionID string, allow bool) error {
+	if _, err := GetExtensionManager().GetExtension(extensionID); err != nil {
+		return err
+	}
+	extensionTrustMu.Lock()
+	defer extensionTrustMu.Unlock()
+	if allow {
+		extensionTrustAllows[extensionID] = true
+	} else {
+		delete(extensionTrustAllows, extensionID)
+	}
+	GoLog("[Extension:%s] Trust override %v\n", extensionID, allow)
+	return saveExtensionTrustLocked()
+}
+
+func GetExtensionTrust(extensionID string) (*ExtensionTrustInfo, error) {
+	ext, err := GetExtensionManager().GetExtension(extensionID)
+	if err != nil {
+		return nil, err
+	}
+	extensionTrustMu.RLock()
+	override := extensionTrustAllows[extensionID]
+	extensionTrustMu.RUnlock()
+	return &ExtensionTrustInfo{
+		ExtensionID: extensionID,
+		Trust:       ext.Trust,
+		Publisher:   ext.Publisher,
+		Override:    override,
+		Restricted:  extensionRestricted(extensionID, ext.Trust),
+	}, nil
+}
+
+// restrictedDomainAllowed applies the unsigned-extension network rule:
+// only exact manifest hosts count, wildcard entries are ignored.
+func restrictedDomainAllowed(m *ExtensionManifest, domain string) bool {
+	for _, allowed := range m.Permissions.Network {
+		if !strings.Contains(allowed, "*") && matchDomainPattern(allowed, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// extensionAllowsDomain is IsDomainAllowed with the extension's trust
+// applied. Every extension domain check goes through it.
+func extensionAllowsDomain(extensionID string, trust ExtensionTrust, m *ExtensionManifest, domain string) bool {
+	if m == nil {
+		return false
+	}
+	if extensionRestricted(extensionID, trust) {
+		return restrictedDomainAllowed(m, domain)
+	}
+	return m.IsDomainAllowed(domain)
+}
+
+// manifestAllowsDomain is IsDomainAllowed with the runtime's trust applied.
+func (r *ExtensionRuntime) manifestAllowsDomain(domain string) bool {
+	return extensionAllowsDomain(r.extensionID, r.trust, r.manifest, domain)
+}
+
+// manifestAllowsDomain is the same check for code running outside the VM.
+func (ext *LoadedExtension) manifestAllowsDomain(domain string) bool {
+	return extensionAllowsDomain(ext.ID, ext.Trust, ext.Manifest, domain)
+}
+
+// gateAuth wraps an auth API function so unsigned extensions get an error
+// instead, checked per call so an override applies without a reload.
+func (r *ExtensionRuntime) gateAuth(fn func(goja.FunctionCall) goja.Value) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		if extensionRestricted(r.extensionID, r.trust) {
+			GoLog("[Extension:%s] Auth API denied: extension is unsigned\n", r.extensionID)
+			return r.vm.ToValue(map[string]interface{}{
+				"success": false,
+				"error":   "auth API is not available to unsigned extensions",
+			})
+		}
+		return fn(call)
+	}
+}
@@ -0,0 +1,160 @@
+package gobackend
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func signedTestPackage(t *testing.T, priv ed25519.PrivateKey, keyID string, files map[string]string) *zip.Reader {
+	t.Helper()
+	hashes := make(map[string]string)
+	for name, content := range files {
+		sum := sha256.Sum256([]byte(content))
+		hashes[name] = hex.EncodeToString(sum[:])
+	}
+	sig, _ := json.Marshal(extensionSignature{
+		Publisher: "Test Publisher",
+		KeyID:     keyID,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, extensionSigningPayload(hashes))),
+	})
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	w, _ := zw.Create(extensionSignatureFile)
+	w.Write(sig)
+	zw.Close()
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestExtensionSignatureTrustLevels(t *testing.T) {
+	loadExtensionTrust(t.TempDir())
+	defer loadExtensionTrust("")
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	files := map[string]string{"manifest.json": `{"name":"x"}`, "index.js": "registerExtension({})"}
+
+	trust, _, err := verifyExtensionArchive(signedTestPackage(t, priv, "k1", files).File)
+	if err != nil || trust != ExtensionTrustUnsigned {
+		t.Fatalf("unknown key: trust=%q err=%v, want unsigned", trust, err)
+	}
+
+	if err := TrustPublisherKey("k1", "Test Publisher", base64.StdEncoding.EncodeToString(pub)); err != nil {
+		t.Fatal(err)
+	}
+	trust, publisher, err := verifyExtensionArchive(signedTestPackage(t, priv, "k1", files).File)
+	if err != nil || trust != ExtensionTrustCommunity || publisher != "Test Publisher" {
+		t.Fatalf("trusted key: trust=%q publisher=%q err=%v", trust, publisher, err)
+	}
+
+	official := officialPublisherKeys
+	officialPublisherKeys = map[string]PublisherKey{"official-1": {Publisher: "App", PublicKey: base64.StdEncoding.EncodeToString(pub)}}
+	defer func() { officialPublisherKeys = official }()
+	if trust, _, _ := verifyExtensionArchive(signedTestPackage(t, priv, "official-1", files).File); trust != ExtensionTrustOfficial {
+		t.Fatalf("official key: trust=%q", trust)
+	}
+
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	if _, _, err := verifyExtensionArchive(signedTestPackage(t, otherPriv, "k1", files).File); err == nil {
+		t.Fatal("signature from the wrong key must be rejected")
+	}
+}
+
+func TestExtensionSignatureDetectsTamperedFolder(t *testing.T) {
+	loadExtensionTrust(t.TempDir())
+	defer loadExtensionTrust("")
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	if err := TrustPublisherKey("k1", "Test Publisher", base64.StdEncoding.EncodeToString(pub)); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	zr := signedTestPackage(t, priv, "k1", map[string]string{"manifest.json": "{}", "lib/util.js": "1"})
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		var buf bytes.Buffer
+		buf.ReadFrom(rc)
+		rc.Close()
+		dest := filepath.Join(dir, filepath.FromSlash(f.Name))
+		os.MkdirAll(filepath.Dir(dest), 0755)
+		os.WriteFile(dest, buf.Bytes(), 0644)
+	}
+
+	if trust, _, err := verifyExtensionDir(dir); err != nil || trust != ExtensionTrustCommunity {
+		t.Fatalf("extracted folder: trust=%q err=%v", trust, err)
+	}
+	os.WriteFile(filepath.Join(dir, "lib", "util.js"), []byte("2"), 0644)
+	if _, _, err := verifyExtensionDir(dir); err == nil {
+		t.Fatal("modified file must fail verification")
+	}
+}
+
+func TestUnsignedExtensionRestrictions(t *testing.T) {
+	loadExtensionTrust(t.TempDir())
+	defer loadExtensionTrust("")
+
+	manifest := &ExtensionManifest{Permissions: ExtensionPermissions{Network: []string{"api.example.com", "*.cdn.example.com"}}}
+	r := &ExtensionRuntime{extensionID: "unsigned-ext", manifest: manifest, trust: ExtensionTrustUnsigned}
+
+	if !r.manifestAllowsDomain("api.example.com") {
+		t.Error("exact manifest host must stay allowed")
+	}
+	if r.manifestAllowsDomain("a.cdn.example.com") {
+		t.Error("wildcard host must be withheld from unsigned extensions")
+	}
+
+	extensionTrustMu.Lock()
+	extensionTrustAllows["unsigned-ext"] = true
+	extensionTrustMu.Unlock()
+	if !r.manifestAllowsDomain("a.cdn.example.com") {
+		t.Error("override must restore wildcard access")
+	}
+
+	// Album assets are fetched outside the VM with the same check.
+	ext := &LoadedExtension{ID: "unsigned-assets", Manifest: manifest, Trust: ExtensionTrustUnsigned}
+	if ext.manifestAllowsDomain("a.cdn.example.com") || !ext.manifestAllowsDomain("api.example.com") {
+		t.Error("album assets ignore the unsigned restrictions")
+	}
+
+	signed := &ExtensionRuntime{extensionID: "signed-ext", manifest: manifest, trust: ExtensionTrustCommunity}
+	if extensionRestricted(signed.extensionID, signed.trust) || !signed.manifestAllowsDomain("a.cdn.example.com") {
+		t.Error("signed extension must not be restricted")
+	}
+}
+
+func TestParseOfficialPublisherKeys(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	data, _ := json.Marshal(map[string]PublisherKey{
+		"good":  {Publisher: "App", PublicKey: base64.StdEncoding.EncodeToString(pub)},
+		"short": {Publisher: "App", PublicKey: base64.StdEncoding.EncodeToString(pub[:16])},
+		"junk":  {Publisher: "App", PublicKey: "not base64!"},
+	})
+	keys := parseOfficialPublisherKeys(data)
+	if len(keys) != 1 || keys["good"].Publisher != "App" {
+		t.Errorf("keys = %+v", keys)
+	}
+	if keys := parseOfficialPublisherKeys([]byte("{")); keys == nil || len(keys) != 0 {
+		t.Errorf("corrupt list = %+v", keys)
+	}
+	if keys := parseOfficialPublisherKeys(officialPublishersJSON); keys == nil {
+		t.Error("embedded key list did not parse")
+	}
+}
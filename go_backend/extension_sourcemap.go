@@ -0,0 +1,90 @@
+package gobackend
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/parser"
+)
+
+// ==================== Extension source maps ====================
+//
+// Bundled or minified extensions can ship a source map, either referenced by
+// a trailing "//# sourceMappingURL=" comment in index.js (a file in the
+// package or an inline data: URL) or named by "sourceMap" in the manifest.
+// With a map loaded, goja reports stack positions in the original files, so
+// GetExtensionErrors shows "src/api.ts:42:7" instead of "index.js:1:18342".
+//
+// Maps are only read from inside the extension's own folder. A missing or
+// broken map never stops the extension from loading; it just runs unmapped.
+
+const maxSourceMapBytes = 10 << 20
+
+// sourceMapPath resolves a map reference to a file inside sourceDir, or ""
+// when it points anywhere else.
+func sourceMapPath(sourceDir, ref string) string {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return ""
+	}
+	rel := path.Clean(u.Path)
+	if rel == "." || path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return ""
+	}
+	return filepath.Join(sourceDir, filepath.FromSlash(rel))
+}
+
+func readSourceMap(sourceDir, ref string) ([]byte, error) {
+	p := sourceMapPath(sourceDir, ref)
+	if p == "" {
+		return nil, fmt.Errorf("source map %q is outside the extension", ref)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxSourceMapBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSourceMapBytes {
+		return nil, fmt.Errorf("source map %s exceeds %d MB", ref, maxSourceMapBytes>>20)
+	}
+	return data, nil
+}
+
+// withManifestSourceMap appends a sourceMappingURL comment for a map named in
+// the manifest, unless the script already references one.
+func withManifestSourceMap(code string, manifest *ExtensionManifest) string {
+	if manifest == nil || manifest.SourceMap == "" || strings.Contains(code, "//# sourceMappingURL=") {
+		return code
+	}
+	return strings.TrimRight(code, "\r\n") + "\n//# sourceMappingURL=" + manifest.SourceMap + "\n"
+}
+
+// compileExtensionScript compiles index.js under its own name with source
+// maps limited to the extension folder, falling back to an unmapped compile
+// when the map cannot be used.
+func compileExtensionScript(ext *LoadedExtension, code string) (*goja.Program, error) {
+	loader := func(ref string) ([]byte, error) {
+		return readSourceMap(ext.SourceDir, ref)
+	}
+
+	ast, err := goja.Parse(extensionScriptName, withManifestSourceMap(code, ext.Manifest), parser.WithSourceMapLoader(loader))
+	if err != nil {
+		fallback, fallbackErr := goja.Parse(extensionScriptName, code, parser.WithDisableSourceMaps)
+		if fallbackErr != nil {
+			return nil, err
+		}
+		GoLog("[Extension:%s] Ignoring source map: %v\n", ext.ID, err)
+		ast = fallback
+	}
+	return goja.CompileAST(ast, false)
+}
@@ -34,10 +34,12 @@ type StoreExtension struct {
 	Downloads        int      `json:"downloads"`
 	UpdatedAt        string   `json:"updated_at"`
 	MinAppVersion    string   `json:"min_app_version,omitempty"`
+	APIVersion       int      `json:"api_version,omitempty"`
 	DisplayNameAlt   string   `json:"displayName,omitempty"`
 	DownloadURLAlt   string   `json:"downloadUrl,omitempty"`
 	IconURLAlt       string   `json:"iconUrl,omitempty"`
 	MinAppVersionAlt string   `json:"minAppVersion,omitempty"`
+	APIVersionAlt    int      `json:"apiVersion,omitempty"`
 }
 
 func (e *StoreExtension) getDisplayName() string {
@@ -71,6 +73,13 @@ func (e *StoreExtension) getMinAppVersion() string {
 	return e.MinAppVersionAlt
 }
 
+func (e *StoreExtension) getAPIVersion() int {
+	if e.APIVersion != 0 {
+		return e.APIVersion
+	}
+	return e.APIVersionAlt
+}
+
 type StoreRegistry struct {
 	Version    int              `json:"version"`
 	UpdatedAt  string           `json:"updated_at"`
@@ -91,6 +100,8 @@ type StoreExtensionResponse struct {
 	Downloads        int      `json:"downloads"`
 	UpdatedAt        string   `json:"updated_at"`
 	MinAppVersion    string   `json:"min_app_version,omitempty"`
+	APIVersion       int      `json:"api_version"`
+	Compatible       bool     `json:"compatible"`
 	IsInstalled      bool     `json:"is_installed"`
 	InstalledVersion string   `json:"installed_version,omitempty"`
 	HasUpdate        bool     `json:"has_update"`
@@ -111,6 +122,8 @@ func (e *StoreExtension) ToResponse() StoreExtensionResponse {
 		Downloads:     e.Downloads,
 		UpdatedAt:     e.UpdatedAt,
 		MinAppVersion: e.getMinAppVersion(),
+		APIVersion:    max(e.getAPIVersion(), 1),
+		Compatible:    isExtensionAPIVersionSupported(e.getAPIVersion()),
 	}
 }
 
@@ -303,6 +316,10 @@ func (s *ExtensionStore) DownloadExtension(extensionID string, destPath string)
 		return fmt.Errorf("extension %s not found in store", extensionID)
 	}
 
+	if !isExtensionAPIVersionSupported(ext.getAPIVersion()) {
+		return fmt.Errorf("%s needs extension API v%d, this app supports up to v%d", ext.getDisplayName(), ext.getAPIVersion(), ExtensionRuntimeAPIVersion)
+	}
+
 	if err := requireHTTPSURL(ext.getDownloadURL(), "extension download"); err != nil {
 		return err
 	}
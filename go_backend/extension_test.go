@@ -1,6 +1,9 @@
 package gobackend
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -71,6 +74,61 @@ func TestParseManifest_MissingType(t *testing.T) {
 	}
 }
 
+func TestParseManifest_APIVersion(t *testing.T) {
+	manifestWithAPI := func(version int) string {
+		return fmt.Sprintf(`{
+			"name": "test-provider",
+			"version": "1.0.0",
+			"author": "Test Author",
+			"description": "A test extension",
+			"type": ["metadata_provider"],
+			"apiVersion": %d
+		}`, version)
+	}
+
+	manifest, err := ParseManifest([]byte(manifestWithAPI(0)))
+	if err != nil {
+		t.Fatalf("Expected manifest without apiVersion to parse, got error: %v", err)
+	}
+	if manifest.TargetAPIVersion() != 1 {
+		t.Errorf("Expected undeclared apiVersion to target 1, got %d", manifest.TargetAPIVersion())
+	}
+
+	if _, err := ParseManifest([]byte(manifestWithAPI(ExtensionRuntimeAPIVersion))); err != nil {
+		t.Errorf("Expected current apiVersion to parse, got error: %v", err)
+	}
+	if _, err := ParseManifest([]byte(manifestWithAPI(ExtensionRuntimeAPIVersion + 1))); err == nil {
+		t.Error("Expected error for apiVersion newer than the runtime")
+	}
+}
+
+func TestInitializeVM_LegacyGlobalExtension(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.js"), []byte("var extension = { name: 'legacy', apiVersion: gobackend.apiVersion };"), 0644)
+
+	newExt := func(apiVersion int) *LoadedExtension {
+		return &LoadedExtension{
+			ID:        "legacy",
+			Manifest:  &ExtensionManifest{Name: "legacy", APIVersion: apiVersion},
+			DataDir:   t.TempDir(),
+			SourceDir: dir,
+		}
+	}
+	m := &ExtensionManager{extensions: make(map[string]*LoadedExtension)}
+
+	ext := newExt(0)
+	if err := m.initializeVM(ext); err != nil {
+		t.Fatalf("Expected v1 shim to accept global extension, got error: %v", err)
+	}
+	if v := ext.VM.Get("extension").ToObject(ext.VM).Get("apiVersion").ToInteger(); v != 1 {
+		t.Errorf("Expected gobackend.apiVersion 1, got %d", v)
+	}
+
+	if err := m.initializeVM(newExt(2)); err == nil {
+		t.Error("Expected v2 extension without registerExtension() to fail")
+	}
+}
+
 func TestIsDomainAllowed(t *testing.T) {
 	manifest := &ExtensionManifest{
 		Permissions: ExtensionPermissions{
@@ -108,6 +166,7 @@ func TestExtensionRuntime_NetworkSandbox(t *testing.T) {
 			},
 		},
 		DataDir: t.TempDir(),
+		Trust:   ExtensionTrustCommunity,
 	}
 
 	runtime := NewExtensionRuntime(ext)
@@ -312,3 +371,35 @@ func TestIsPrivateIP(t *testing.T) {
 		}
 	}
 }
+
+func TestUserDownloadHook(t *testing.T) {
+	defer SetUserDownloadHook(UserDownloadHookConfig{})
+
+	if err := SetUserDownloadHook(UserDownloadHookConfig{Script: "var x = 1;"}); err == nil {
+		t.Fatal("expected error for script without onDownloadComplete")
+	}
+
+	filePath := filepath.Join(t.TempDir(), "song.flac")
+	if err := os.WriteFile(filePath, []byte("fLaC"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	script := `function onDownloadComplete(track, filePath) {
+		if (track.title !== "Song") { throw new Error("bad track"); }
+		return { new_file_path: filePath + ".missing" };
+	}`
+	if err := SetUserDownloadHook(UserDownloadHookConfig{Script: script}); err != nil {
+		t.Fatalf("failed to install hook: %v", err)
+	}
+
+	respJSON, _ := json.Marshal(DownloadResponse{Success: true, FilePath: filePath, Title: "Song"})
+	out := runDownloadCompleteHooks(string(respJSON))
+
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.FilePath != filePath {
+		t.Fatalf("hook pointing at a missing file must not change the path, got %q", resp.FilePath)
+	}
+}
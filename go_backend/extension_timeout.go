@@ -92,6 +92,7 @@ func RunWithTimeout(vm *goja.Runtime, script string, timeout time.Duration) (goj
 // This should be used when you want to continue using the VM after a timeout
 func RunWithTimeoutAndRecover(vm *goja.Runtime, script string, timeout time.Duration) (goja.Value, error) {
 	result, err := RunWithTimeout(vm, script, timeout)
+	reportJSError(vm, "exception", err)
 
 	// Clear any interrupt state so VM can be reused
 	vm.ClearInterrupt()
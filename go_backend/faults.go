@@ -0,0 +1,31 @@
+package gobackend
+
+// ==================== Fault injection ====================
+//
+// Builds tagged "faultinject" get a chaos injector for validating retry,
+// fallback and resume (go test -tags faultinject ./...). Normal builds
+// compile the hooks below to no-ops, see faults_off.go.
+//
+// Stages and the faults each accepts:
+//
+//	request  timeout, reset          before the HTTP round trip
+//	body     timeout, reset, slow    while reading a response body
+//	output   fd, nospace             opening the download output
+//
+// Rules are set with setFaultInjection or, for a whole app run, as JSON in
+// the SPOTIFLAC_FAULTS environment variable:
+//
+//	{"seed": 1, "rules": [
+//	  {"stage": "body", "kind": "reset", "probability": 0.2, "after_bytes": 65536},
+//	  {"stage": "request", "kind": "timeout", "probability": 0.1, "match": "qobuz"}
+//	]}
+
+type faultStage string
+
+const (
+	faultStageRequest faultStage = "request"
+	faultStageBody    faultStage = "body"
+	faultStageOutput  faultStage = "output"
+)
+
+const faultInjectionEnv = "SPOTIFLAC_FAULTS"
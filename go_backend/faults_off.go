@@ -0,0 +1,13 @@
+//go:build !faultinject
+
+package gobackend
+
+import "io"
+
+func injectFault(stage faultStage, target string) error {
+	return nil
+}
+
+func wrapFaultBody(target string, body io.ReadCloser) io.ReadCloser {
+	return body
+}
@@ -0,0 +1,199 @@
+//go:build faultinject
+
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type faultRule struct {
+	Stage       faultStage `json:"stage"`
+	Kind        string     `json:"kind"`
+	Probability float64    `json:"probability"`
+	// Match limits the rule to hosts (request, body) or paths (output)
+	// containing this string.
+	Match string `json:"match,omitempty"`
+	// AfterBytes delays a body fault until this much has been read.
+	AfterBytes int64 `json:"after_bytes,omitempty"`
+	// DelayMS is the pause per read for slow bodies and before a request
+	// timeout fires.
+	DelayMS int `json:"delay_ms,omitempty"`
+}
+
+type faultConfig struct {
+	Seed  int64       `json:"seed,omitempty"`
+	Rules []faultRule `json:"rules"`
+}
+
+var (
+	faultMu     sync.Mutex
+	faultRules  []faultRule
+	faultRand   *rand.Rand
+	faultCounts = make(map[string]int)
+)
+
+func init() {
+	if raw := os.Getenv(faultInjectionEnv); raw != "" {
+		if err := setFaultInjection(raw); err != nil {
+			GoLog("[Faults] Ignoring %s: %v\n", faultInjectionEnv, err)
+		}
+	}
+}
+
+var faultKinds = map[faultStage][]string{
+	faultStageRequest: {"timeout", "reset"},
+	faultStageBody:    {"timeout", "reset", "slow"},
+	faultStageOutput:  {"fd", "nospace"},
+}
+
+// setFaultInjection replaces the active rules. An empty string clears them.
+func setFaultInjection(configJSON string) error {
+	var cfg faultConfig
+	if strings.TrimSpace(configJSON) != "" {
+		if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+			return fmt.Errorf("invalid fault config: %w", err)
+		}
+	}
+	for i, rule := range cfg.Rules {
+		kinds, ok := faultKinds[rule.Stage]
+		if !ok {
+			return fmt.Errorf("rules[%d]: unknown stage %q", i, rule.Stage)
+		}
+		valid := false
+		for _, kind := range kinds {
+			valid = valid || kind == rule.Kind
+		}
+		if !valid {
+			return fmt.Errorf("rules[%d]: stage %s does not support %q", i, rule.Stage, rule.Kind)
+		}
+		if rule.Probability < 0 || rule.Probability > 1 {
+			return fmt.Errorf("rules[%d]: probability must be between 0 and 1", i)
+		}
+	}
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	faultMu.Lock()
+	defer faultMu.Unlock()
+	faultRules = cfg.Rules
+	faultRand = rand.New(rand.NewSource(seed))
+	faultCounts = make(map[string]int)
+	if len(cfg.Rules) > 0 {
+		GoLog("[Faults] %d rule(s) active, seed %d\n", len(cfg.Rules), seed)
+	}
+	return nil
+}
+
+// faultInjectionCounts returns how often each "stage/kind" fired.
+func faultInjectionCounts() map[string]int {
+	faultMu.Lock()
+	defer faultMu.Unlock()
+	out := make(map[string]int, len(faultCounts))
+	for k, v := range faultCounts {
+		out[k] = v
+	}
+	return out
+}
+
+// pickFault rolls every rule for stage that matches target and returns the
+// first one that fires.
+func pickFault(stage faultStage, target string) (faultRule, bool) {
+	faultMu.Lock()
+	defer faultMu.Unlock()
+	for _, rule := range faultRules {
+		if rule.Stage != stage || (rule.Match != "" && !strings.Contains(target, rule.Match)) {
+			continue
+		}
+		if faultRand.Float64() < rule.Probability {
+			faultCounts[string(stage)+"/"+rule.Kind]++
+			return rule, true
+		}
+	}
+	return faultRule{}, false
+}
+
+// faultTimeoutError looks like a dial or read deadline to net.Error checks.
+type faultTimeoutError struct{ stage faultStage }
+
+func (e *faultTimeoutError) Error() string   { return "injected " + string(e.stage) + " timeout" }
+func (e *faultTimeoutError) Timeout() bool   { return true }
+func (e *faultTimeoutError) Temporary() bool { return true }
+
+func faultError(rule faultRule, op, target string) error {
+	switch rule.Kind {
+	case "timeout":
+		if rule.DelayMS > 0 {
+			time.Sleep(time.Duration(rule.DelayMS) * time.Millisecond)
+		}
+		return &net.OpError{Op: op, Net: "tcp", Err: &faultTimeoutError{stage: rule.Stage}}
+	case "reset":
+		return &net.OpError{Op: op, Net: "tcp", Err: os.NewSyscallError(op, syscall.ECONNRESET)}
+	case "fd":
+		return &os.PathError{Op: "open", Path: target, Err: syscall.EBADF}
+	case "nospace":
+		return &os.PathError{Op: "write", Path: target, Err: syscall.ENOSPC}
+	}
+	return nil
+}
+
+func injectFault(stage faultStage, target string) error {
+	rule, ok := pickFault(stage, target)
+	if !ok {
+		return nil
+	}
+	GoLog("[Faults] Injecting %s/%s for %s\n", stage, rule.Kind, target)
+	return faultError(rule, "dial", target)
+}
+
+func wrapFaultBody(target string, body io.ReadCloser) io.ReadCloser {
+	if body == nil {
+		return body
+	}
+	rule, ok := pickFault(faultStageBody, target)
+	if !ok {
+		return body
+	}
+	GoLog("[Faults] Injecting body/%s for %s after %d bytes\n", rule.Kind, target, rule.AfterBytes)
+	return &faultBody{ReadCloser: body, rule: rule, target: target}
+}
+
+type faultBody struct {
+	io.ReadCloser
+	rule   faultRule
+	target string
+	read   int64
+}
+
+func (b *faultBody) Read(p []byte) (int, error) {
+	if b.rule.Kind == "slow" {
+		if len(p) > 4096 {
+			p = p[:4096]
+		}
+		time.Sleep(time.Duration(b.rule.DelayMS) * time.Millisecond)
+		n, err := b.ReadCloser.Read(p)
+		b.read += int64(n)
+		return n, err
+	}
+
+	if b.read >= b.rule.AfterBytes {
+		return 0, faultError(b.rule, "read", b.target)
+	}
+	if remaining := b.rule.AfterBytes - b.read; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
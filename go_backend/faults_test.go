@@ -0,0 +1,101 @@
+//go:build faultinject
+
+package gobackend
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func faultTestClient(t *testing.T, configJSON string) (*http.Client, string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	t.Cleanup(server.Close)
+	if err := setFaultInjection(configJSON); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { setFaultInjection("") })
+	return &http.Client{Transport: &hostPolicyTransport{pool: sharedPool}}, server.URL
+}
+
+func TestFaultInjectionRequestTimeout(t *testing.T) {
+	client, url := faultTestClient(t, `{"seed": 1, "rules": [{"stage": "request", "kind": "timeout", "probability": 1}]}`)
+
+	_, err := client.Get(url)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if got := faultInjectionCounts()["request/timeout"]; got != 1 {
+		t.Errorf("request/timeout fired %d times, want 1", got)
+	}
+}
+
+func TestFaultInjectionBodyReset(t *testing.T) {
+	client, url := faultTestClient(t, `{"seed": 1, "rules": [{"stage": "body", "kind": "reset", "probability": 1, "after_bytes": 100}]}`)
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if len(data) != 100 || !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("read %d bytes, err %v; want 100 bytes then ECONNRESET", len(data), err)
+	}
+}
+
+func TestFaultInjectionMatchAndProbability(t *testing.T) {
+	client, url := faultTestClient(t, `{"seed": 1, "rules": [
+		{"stage": "request", "kind": "reset", "probability": 1, "match": "other.example"},
+		{"stage": "request", "kind": "reset", "probability": 0}
+	]}`)
+
+	for i := 0; i < 20; i++ {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("unexpected fault: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if len(faultInjectionCounts()) != 0 {
+		t.Errorf("no rule should have fired: %v", faultInjectionCounts())
+	}
+}
+
+func TestFaultInjectionOutputFD(t *testing.T) {
+	faultTestClient(t, `{"rules": [{"stage": "output", "kind": "fd", "probability": 1, "match": "track.flac"}]}`)
+
+	dir := t.TempDir()
+	if _, err := openOutputForWrite(filepath.Join(dir, "track.flac"), 0); !errors.Is(err, syscall.EBADF) {
+		t.Errorf("expected EBADF, got %v", err)
+	}
+	f, err := openOutputForWrite(filepath.Join(dir, "cover.jpg"), 0)
+	if err != nil {
+		t.Fatalf("unmatched path failed: %v", err)
+	}
+	f.Close()
+}
+
+func TestFaultInjectionRejectsBadRules(t *testing.T) {
+	for _, cfg := range []string{
+		`{"rules": [{"stage": "dns", "kind": "timeout", "probability": 1}]}`,
+		`{"rules": [{"stage": "output", "kind": "slow", "probability": 1}]}`,
+		`{"rules": [{"stage": "body", "kind": "reset", "probability": 2}]}`,
+		`not json`,
+	} {
+		if err := setFaultInjection(cfg); err == nil {
+			t.Errorf("expected %s to be rejected", cfg)
+		}
+	}
+	setFaultInjection("")
+}
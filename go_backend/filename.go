@@ -50,15 +50,18 @@ func buildFilenameFromTemplate(template string, metadata map[string]interface{})
 	}
 
 	placeholders := map[string]string{
-		"{title}":     getString(metadata, "title"),
-		"{artist}":    getString(metadata, "artist"),
-		"{album}":     getString(metadata, "album"),
-		"{track}":     formatTrackNumber(getInt(metadata, "track")),
-		"{track_raw}": formatRawNumber(getInt(metadata, "track")),
-		"{year}":      yearValue,
-		"{date}":      dateValue,
-		"{disc}":      formatDiscNumber(getInt(metadata, "disc")),
-		"{disc_raw}":  formatRawNumber(getInt(metadata, "disc")),
+		"{title}":        getString(metadata, "title"),
+		"{artist}":       getString(metadata, "artist"),
+		"{album_artist}": getAlbumArtistValue(metadata),
+		"{album}":        getString(metadata, "album"),
+		"{track}":        formatTrackNumber(getInt(metadata, "track")),
+		"{track_raw}":    formatRawNumber(getInt(metadata, "track")),
+		"{year}":         yearValue,
+		"{date}":         dateValue,
+		"{disc}":         formatDiscNumber(getInt(metadata, "disc")),
+		"{disc_raw}":     formatRawNumber(getInt(metadata, "disc")),
+		"{disc_number}":  formatDiscNumber(getInt(metadata, "disc")),
+		"{disc_total}":   formatDiscNumber(getInt(metadata, "disc_total")),
 	}
 
 	for placeholder, value := range placeholders {
@@ -110,6 +113,15 @@ func getDateValue(metadata map[string]interface{}) string {
 	return getString(metadata, "year")
 }
 
+// getAlbumArtistValue falls back to the track artist so {album_artist}
+// templates still work for sources that do not report one.
+func getAlbumArtistValue(metadata map[string]interface{}) string {
+	if albumArtist := getString(metadata, "album_artist"); albumArtist != "" {
+		return albumArtist
+	}
+	return getString(metadata, "artist")
+}
+
 func getString(m map[string]interface{}, key string) string {
 	if v, ok := m[key]; ok {
 		switch value := v.(type) {
@@ -133,6 +145,8 @@ func getInt(m map[string]interface{}, key string) int {
 		candidateKeys = append(candidateKeys, "track_number")
 	case "disc":
 		candidateKeys = append(candidateKeys, "disc_number")
+	case "disc_total":
+		candidateKeys = append(candidateKeys, "total_discs")
 	}
 
 	for _, candidate := range candidateKeys {
@@ -170,6 +184,11 @@ func formatDiscNumber(n int) string {
 	return fmt.Sprintf("%d", n)
 }
 
+// discSubfolderName returns the per-disc folder used for multi-disc albums.
+func discSubfolderName(disc int) string {
+	return fmt.Sprintf("CD%d", disc)
+}
+
 func formatRawNumber(n int) string {
 	if n <= 0 {
 		return ""
@@ -1,6 +1,10 @@
 package gobackend
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestBuildFilenameFromTemplate_WithRawTrackAndDisc(t *testing.T) {
 	metadata := map[string]interface{}{
@@ -83,3 +87,75 @@ func TestBuildFilenameFromTemplate_DateStrftimeFormattingWithYearOnly(t *testing
 		t.Fatalf("expected %q, got %q", expected, formatted)
 	}
 }
+
+func TestBuildFilenameFromTemplate_DiscNumberAndTotal(t *testing.T) {
+	metadata := map[string]interface{}{
+		"title":       "Song Name",
+		"disc_number": 2,
+		"total_discs": 3,
+	}
+
+	formatted := buildFilenameFromTemplate("{disc_number}of{disc_total} {title}", metadata)
+	expected := "2of3 Song Name"
+	if formatted != expected {
+		t.Fatalf("expected %q, got %q", expected, formatted)
+	}
+}
+
+func TestApplyDiscSubfolder(t *testing.T) {
+	base := t.TempDir()
+
+	req := DownloadRequest{OutputDir: base, DiscNumber: 2, TotalDiscs: 2, DiscSubfolders: true}
+	applyDiscSubfolder(&req)
+	expected := filepath.Join(base, "CD2")
+	if req.OutputDir != expected {
+		t.Fatalf("expected %q, got %q", expected, req.OutputDir)
+	}
+	if info, err := os.Stat(expected); err != nil || !info.IsDir() {
+		t.Fatalf("expected disc folder to be created: %v", err)
+	}
+
+	// Applying again must not nest CD2/CD2.
+	applyDiscSubfolder(&req)
+	if req.OutputDir != expected {
+		t.Fatalf("expected %q after second apply, got %q", expected, req.OutputDir)
+	}
+
+	single := DownloadRequest{OutputDir: base, DiscNumber: 1, TotalDiscs: 1, DiscSubfolders: true}
+	applyDiscSubfolder(&single)
+	if single.OutputDir != base {
+		t.Fatalf("single-disc album should stay in %q, got %q", base, single.OutputDir)
+	}
+}
+
+func TestFindExistingAlbumDir(t *testing.T) {
+	base := t.TempDir()
+	for _, name := range []string{"AM", "Greatest Hits Vol. 1", "Random Access Memories"} {
+		os.MkdirAll(filepath.Join(base, name), 0755)
+	}
+
+	cases := []struct {
+		dir       string
+		threshold float64
+		expected  string
+	}{
+		{"AM ", 1, "AM"},
+		{"am.", 1, "AM"},
+		{"Greatest Hits Vol 1", 1, "Greatest Hits Vol. 1"},
+		{"Greatest Hits Vol. 2", 0.8, ""},
+		{"Random Acces Memories", 1, ""},
+		{"Random Acces Memories", 0.9, "Random Access Memories"},
+		{"AM ", 0, ""},
+		{"AM", 1, ""},
+	}
+	for _, tc := range cases {
+		got := findExistingAlbumDir(filepath.Join(base, tc.dir), tc.threshold)
+		want := ""
+		if tc.expected != "" {
+			want = filepath.Join(base, tc.expected)
+		}
+		if got != want {
+			t.Errorf("findExistingAlbumDir(%q, %v) = %q, want %q", tc.dir, tc.threshold, got, want)
+		}
+	}
+}
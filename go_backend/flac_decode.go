@@ -0,0 +1,366 @@
+package gobackend
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+)
+
+// ==================== FLAC decoding ====================
+//
+// A small FLAC decoder for analysis work that must not depend on FFmpeg
+// (spectrograms). It handles every subframe type and channel decorrelation
+// mode of the format but skips the frame CRC-16; VerifyLibrary checks that.
+
+// flacBitReader reads MSB-first bits. Bytes are pulled one at a time, so
+// after alignment the underlying reader sits exactly at the next byte.
+type flacBitReader struct {
+	r   *bufio.Reader
+	buf uint64
+	n   uint
+}
+
+func (b *flacBitReader) fill(k uint) error {
+	for b.n < k {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && b.n > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		b.buf |= uint64(c) << (56 - b.n)
+		b.n += 8
+	}
+	return nil
+}
+
+func (b *flacBitReader) readBits(k uint) (uint64, error) {
+	if k == 0 {
+		return 0, nil
+	}
+	if err := b.fill(k); err != nil {
+		return 0, err
+	}
+	v := b.buf >> (64 - k)
+	b.buf <<= k
+	b.n -= k
+	return v, nil
+}
+
+func (b *flacBitReader) readSigned(k uint) (int64, error) {
+	v, err := b.readBits(k)
+	if err != nil || k == 0 {
+		return 0, err
+	}
+	return int64(v<<(64-k)) >> (64 - k), nil
+}
+
+// readUnary counts zero bits up to the next one bit.
+func (b *flacBitReader) readUnary() (uint64, error) {
+	var q uint64
+	for {
+		if b.n == 0 {
+			if err := b.fill(8); err != nil {
+				return 0, err
+			}
+		}
+		zeros := uint(bits.LeadingZeros64(b.buf))
+		if zeros < b.n {
+			b.buf <<= zeros + 1
+			b.n -= zeros + 1
+			return q + uint64(zeros), nil
+		}
+		q += uint64(b.n)
+		b.buf, b.n = 0, 0
+	}
+}
+
+func (b *flacBitReader) align() {
+	b.buf <<= b.n % 8
+	b.n -= b.n % 8
+}
+
+// flacDecoder yields one frame of per-channel samples at a time.
+type flacDecoder struct {
+	f          *os.File
+	br         flacBitReader
+	sampleRate int
+	channels   int
+	bps        int
+	total      uint64
+}
+
+func openFLACDecoder(path string) (*flacDecoder, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReaderSize(f, 1<<16)
+	blocks, err := readFLACMetadataBlocks(r)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d := &flacDecoder{f: f, br: flacBitReader{r: r}}
+	d.sampleRate, d.channels, d.bps, d.total = parseStreamInfoFormat(blocks[0])
+	if d.sampleRate == 0 {
+		f.Close()
+		return nil, fmt.Errorf("STREAMINFO has no sample rate")
+	}
+	return d, nil
+}
+
+// parseStreamInfoFormat unpacks the audio format of a STREAMINFO block,
+// header included.
+func parseStreamInfoFormat(block []byte) (sampleRate, channels, bps int, total uint64) {
+	packed := binary.BigEndian.Uint64(block[4+10 : 4+18])
+	return int(packed >> 44), int(packed>>41&0x07) + 1, int(packed>>36&0x1f) + 1, packed & (1<<36 - 1)
+}
+
+func (d *flacDecoder) Close() error {
+	return d.f.Close()
+}
+
+var flacSampleSizes = [8]int{0, 8, 12, 0, 16, 20, 24, 32}
+
+// next decodes the following frame, returning io.EOF after the last one.
+func (d *flacDecoder) next() ([][]int32, error) {
+	header, err := d.br.r.Peek(16)
+	if len(header) == 0 {
+		return nil, io.EOF
+	}
+	h, ok := parseFLACFrameHeader(header)
+	if !ok {
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("lost FLAC frame sync")
+	}
+	assignment := int(header[3] >> 4)
+	bps := flacSampleSizes[header[3]>>1&0x07]
+	if bps == 0 {
+		bps = d.bps
+	}
+	d.br.r.Discard(h.size)
+
+	channels := assignment + 1
+	if assignment >= 8 {
+		channels = 2
+	}
+	samples := make([][]int32, channels)
+	for ch := range samples {
+		sideBits := bps
+		if (assignment == 8 && ch == 1) || (assignment == 9 && ch == 0) || (assignment == 10 && ch == 1) {
+			sideBits++
+		}
+		if samples[ch], err = d.subframe(h.blockSize, uint(sideBits)); err != nil {
+			return nil, err
+		}
+	}
+	d.br.align()
+	if _, err := d.br.readBits(16); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	switch assignment {
+	case 8: // left, side
+		for i, side := range samples[1] {
+			samples[1][i] = samples[0][i] - side
+		}
+	case 9: // side, right
+		for i, side := range samples[0] {
+			samples[0][i] = samples[1][i] + side
+		}
+	case 10: // mid, side
+		for i, side := range samples[1] {
+			mid := int64(samples[0][i])<<1 | int64(side)&1
+			samples[0][i] = int32((mid + int64(side)) >> 1)
+			samples[1][i] = int32((mid - int64(side)) >> 1)
+		}
+	}
+	return samples, nil
+}
+
+func (d *flacDecoder) subframe(blockSize int, bps uint) ([]int32, error) {
+	br := &d.br
+	header, err := br.readBits(8)
+	if err != nil {
+		return nil, err
+	}
+	if header&0x80 != 0 {
+		return nil, fmt.Errorf("bad subframe padding")
+	}
+	kind := header >> 1 & 0x3f
+	wasted := uint(0)
+	if header&1 != 0 {
+		k, err := br.readUnary()
+		if err != nil {
+			return nil, err
+		}
+		wasted = uint(k) + 1
+		bps -= wasted
+	}
+
+	out := make([]int32, blockSize)
+	switch {
+	case kind == 0:
+		v, err := br.readSigned(bps)
+		if err != nil {
+			return nil, err
+		}
+		for i := range out {
+			out[i] = int32(v)
+		}
+	case kind == 1:
+		for i := range out {
+			v, err := br.readSigned(bps)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = int32(v)
+		}
+	case kind >= 8 && kind <= 12:
+		order := int(kind - 8)
+		if err := d.warmup(out, order, bps); err != nil {
+			return nil, err
+		}
+		if err := d.residual(out, order); err != nil {
+			return nil, err
+		}
+		restoreFixedPrediction(out, order)
+	case kind >= 32:
+		order := int(kind-32) + 1
+		if err := d.warmup(out, order, bps); err != nil {
+			return nil, err
+		}
+		precision, err := br.readBits(4)
+		if err != nil || precision == 15 {
+			return nil, fmt.Errorf("bad LPC precision")
+		}
+		shift, err := br.readSigned(5)
+		if err != nil || shift < 0 {
+			return nil, fmt.Errorf("bad LPC shift")
+		}
+		coefs := make([]int64, order)
+		for i := range coefs {
+			if coefs[i], err = br.readSigned(uint(precision) + 1); err != nil {
+				return nil, err
+			}
+		}
+		if err := d.residual(out, order); err != nil {
+			return nil, err
+		}
+		for i := order; i < len(out); i++ {
+			var sum int64
+			for j, c := range coefs {
+				sum += c * int64(out[i-1-j])
+			}
+			out[i] += int32(sum >> uint(shift))
+		}
+	default:
+		return nil, fmt.Errorf("reserved subframe type %d", kind)
+	}
+
+	if wasted > 0 {
+		for i := range out {
+			out[i] <<= wasted
+		}
+	}
+	return out, nil
+}
+
+func (d *flacDecoder) warmup(out []int32, order int, bps uint) error {
+	if order > len(out) {
+		return fmt.Errorf("predictor order %d exceeds block size", order)
+	}
+	for i := 0; i < order; i++ {
+		v, err := d.br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		out[i] = int32(v)
+	}
+	return nil
+}
+
+// residual reads the Rice-coded residual after the warm-up samples.
+func (d *flacDecoder) residual(out []int32, order int) error {
+	br := &d.br
+	method, err := br.readBits(2)
+	if err != nil || method > 1 {
+		return fmt.Errorf("bad residual coding method")
+	}
+	paramBits, escape := uint(4), uint64(15)
+	if method == 1 {
+		paramBits, escape = 5, 31
+	}
+	partitionOrder, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	perPartition := len(out) >> partitionOrder
+	if perPartition < order {
+		return fmt.Errorf("bad residual partition order")
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		count := perPartition
+		if p == 0 {
+			count -= order
+		}
+		param, err := br.readBits(paramBits)
+		if err != nil {
+			return err
+		}
+		if param == escape {
+			raw, err := br.readBits(5)
+			if err != nil {
+				return err
+			}
+			for ; count > 0; count-- {
+				v, err := br.readSigned(uint(raw))
+				if err != nil {
+					return err
+				}
+				out[i] = int32(v)
+				i++
+			}
+			continue
+		}
+		for ; count > 0; count-- {
+			q, err := br.readUnary()
+			if err != nil {
+				return err
+			}
+			low, err := br.readBits(uint(param))
+			if err != nil {
+				return err
+			}
+			v := q<<param | low
+			out[i] = int32(v>>1) ^ -int32(v&1)
+			i++
+		}
+	}
+	return nil
+}
+
+func restoreFixedPrediction(out []int32, order int) {
+	for i := order; i < len(out); i++ {
+		switch order {
+		case 1:
+			out[i] += out[i-1]
+		case 2:
+			out[i] += 2*out[i-1] - out[i-2]
+		case 3:
+			out[i] += 3*out[i-1] - 3*out[i-2] + out[i-3]
+		case 4:
+			out[i] += 4*out[i-1] - 6*out[i-2] + 4*out[i-3] - out[i-4]
+		}
+	}
+}
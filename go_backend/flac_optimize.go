@@ -0,0 +1,306 @@
+package gobackend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ==================== FLAC optimization ====================
+//
+// Provider FLACs are encoded at whatever level the label picked and often
+// carry tens of KiB of padding or APPLICATION blocks from their mastering
+// tools. BackendConfig.FLACOptimize decides what happens to a finished
+// download:
+//
+//	off       the file is left as delivered
+//	metadata  oversized padding and foreign blocks are dropped
+//	reencode  also decode and re-encode the audio at level 8 via FFmpeg
+//
+// Re-encoding is lossless: the new STREAMINFO MD5 of the decoded audio must
+// match the original's, otherwise the original is kept. A file without an MD5
+// cannot be checked that way, so it only gets the metadata pass. The
+// encoder's seek table replaces the original one. The file is only replaced
+// when the result is actually smaller.
+
+const (
+	FLACOptimizeOff      = "off"
+	FLACOptimizeMetadata = "metadata"
+	FLACOptimizeReencode = "reencode"
+)
+
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockPadding       = 1
+	flacBlockSeekTable     = 3
+	flacBlockVorbisComment = 4
+	flacBlockCueSheet      = 5
+	flacBlockPicture       = 6
+
+	// flacKeptPadding leaves room to edit tags in place later.
+	flacKeptPadding     = 8 << 10
+	flacReencodeTimeout = 10 * time.Minute
+)
+
+// FLACOptimizeResult describes what OptimizeFLAC did to one file.
+type FLACOptimizeResult struct {
+	Path          string `json:"path"`
+	BytesBefore   int64  `json:"bytes_before"`
+	BytesAfter    int64  `json:"bytes_after"`
+	RemovedBlocks int    `json:"removed_blocks"`
+	Reencoded     bool   `json:"reencoded"`
+	Replaced      bool   `json:"replaced"`
+	Error         string `json:"error,omitempty"`
+}
+
+// keptFLACBlocks filters a file's metadata blocks. Tags, pictures and cue
+// sheets stay; a seek table only survives when the frames are not replaced,
+// since its offsets would point into the old audio. reencodeFLAC supplies
+// the new one.
+func keptFLACBlocks(blocks [][]byte, reencode bool) (kept [][]byte, removed int) {
+	padding := 0
+	for _, block := range blocks[1:] {
+		switch block[0] & 0x7f {
+		case flacBlockVorbisComment, flacBlockPicture, flacBlockCueSheet:
+			kept = append(kept, block)
+			continue
+		case flacBlockSeekTable:
+			if !reencode {
+				kept = append(kept, block)
+				continue
+			}
+		case flacBlockPadding:
+			padding += len(block) - 4
+		}
+		removed++
+	}
+	if padding > 0 {
+		size := min(padding, flacKeptPadding)
+		block := make([]byte, 4+size)
+		block[0] = flacBlockPadding
+		block[1], block[2], block[3] = byte(size>>16), byte(size>>8), byte(size)
+		kept = append(kept, block)
+		if padding <= flacKeptPadding {
+			removed--
+		}
+	}
+	return kept, removed
+}
+
+// streamInfoSignature returns the total sample count and MD5 of a
+// STREAMINFO block.
+func streamInfoSignature(block []byte) (uint64, []byte) {
+	info := block[4:]
+	samples := uint64(info[13]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(info[14:18]))
+	return samples, info[18:34]
+}
+
+// openFLACAudio reads the metadata of path and returns the file positioned
+// at its first frame.
+func openFLACAudio(path string) (*os.File, [][]byte, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	r := &countingReader{r: bufio.NewReaderSize(f, 1<<16)}
+	blocks, err := readFLACMetadataBlocks(r)
+	if err != nil {
+		f.Close()
+		return nil, nil, 0, err
+	}
+	if _, err := f.Seek(r.pos, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, 0, err
+	}
+	return f, blocks, r.pos, nil
+}
+
+func buildFLACReencodeCommand(inputPath, outputPath string) string {
+	return strings.Join([]string{
+		"-y", "-i", fmt.Sprintf("%q", inputPath),
+		"-map", "0:a:0", "-map_metadata", "-1",
+		"-c:a", "flac", "-compression_level", "8",
+		fmt.Sprintf("%q", outputPath),
+	}, " ")
+}
+
+// reencodeFLAC has FFmpeg re-encode path and checks the result decodes to
+// the same audio. streamInfo must carry an MD5. It returns the encoded file
+// positioned at its first frame, its STREAMINFO and its seek table, if any.
+func reencodeFLAC(path string, streamInfo []byte, encodedPath string) (*os.File, []byte, []byte, error) {
+	cmd, err := runQueuedFFmpeg("flac_optimize", buildFLACReencodeCommand(path, encodedPath), path, encodedPath, flacReencodeTimeout)
+	if err == nil && !cmd.Success {
+		err = fmt.Errorf("%s", firstNonEmpty(cmd.Error, "FFmpeg re-encode failed"))
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	encoded, blocks, _, err := openFLACAudio(encodedPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("re-encoded file: %w", err)
+	}
+	wantSamples, wantMD5 := streamInfoSignature(streamInfo)
+	gotSamples, gotMD5 := streamInfoSignature(blocks[0])
+	if wantSamples != 0 && gotSamples != wantSamples {
+		encoded.Close()
+		return nil, nil, nil, fmt.Errorf("re-encoded file has %d samples, want %d", gotSamples, wantSamples)
+	}
+	if !bytes.Equal(gotMD5, wantMD5) {
+		encoded.Close()
+		return nil, nil, nil, fmt.Errorf("re-encoded audio MD5 does not match the original")
+	}
+	var seekTable []byte
+	for _, block := range blocks[1:] {
+		if block[0]&0x7f == flacBlockSeekTable {
+			seekTable = block
+			break
+		}
+	}
+	return encoded, blocks[0], seekTable, nil
+}
+
+// OptimizeFLAC strips oversized padding and foreign metadata from a FLAC
+// and, with reencode, recompresses its audio at level 8. The original is
+// kept when anything fails or the result is not smaller.
+func OptimizeFLAC(path string, reencode bool) (*FLACOptimizeResult, error) {
+	result := &FLACOptimizeResult{Path: path}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	result.BytesBefore, result.BytesAfter = stat.Size(), stat.Size()
+
+	src, blocks, _, err := openFLACAudio(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if _, md5 := streamInfoSignature(blocks[0]); reencode && bytes.Equal(md5, make([]byte, 16)) {
+		GoLog("[FLACOptimize] %s has no STREAMINFO MD5, skipping re-encode\n", filepath.Base(path))
+		reencode = false
+	}
+	kept, removed := keptFLACBlocks(blocks, reencode)
+	if removed == 0 && !reencode {
+		return result, nil
+	}
+
+	streamInfo, audio := blocks[0], io.Reader(src)
+	if reencode {
+		encodedPath := path + ".reencode.flac"
+		defer os.Remove(encodedPath)
+		encoded, encodedInfo, seekTable, err := reencodeFLAC(path, streamInfo, encodedPath)
+		if err != nil {
+			return nil, err
+		}
+		defer encoded.Close()
+		streamInfo, audio = encodedInfo, encoded
+		if seekTable != nil {
+			kept = append([][]byte{seekTable}, kept...)
+		}
+		result.Reencoded = true
+	}
+	result.RemovedBlocks = removed
+
+	tmpPath := path + ".optimize.tmp"
+	size, err := writeFLACFile(tmpPath, streamInfo, kept, audio)
+	if err != nil {
+		return nil, err
+	}
+	if size >= result.BytesBefore {
+		os.Remove(tmpPath)
+		return result, nil
+	}
+	os.Chmod(tmpPath, stat.Mode().Perm())
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to replace file: %w", err)
+	}
+	result.BytesAfter, result.Replaced = size, true
+	return result, nil
+}
+
+// writeFLACFile writes STREAMINFO, the other blocks and the frames read from
+// audio to path and returns its size. The file is removed on failure.
+func writeFLACFile(path string, streamInfo []byte, blocks [][]byte, audio io.Reader) (int64, error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	counter := &countingWriter{w: out}
+	writeErr := func() error {
+		w := bufio.NewWriterSize(counter, 1<<16)
+		w.WriteString("fLaC")
+		for i, block := range append([][]byte{streamInfo}, blocks...) {
+			header := block[0] & 0x7f
+			if i == len(blocks) {
+				header |= 0x80
+			}
+			w.WriteByte(header)
+			w.Write(block[1:])
+		}
+		if _, err := io.Copy(w, audio); err != nil {
+			return err
+		}
+		return w.Flush()
+	}()
+	closeErr := out.Close()
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(path)
+		return 0, fmt.Errorf("failed to rewrite file: %w", writeErr)
+	}
+	return counter.n, nil
+}
+
+// OptimizeFLACFiles runs OptimizeFLAC over paths, recording failures per
+// file instead of stopping.
+func OptimizeFLACFiles(paths []string, reencode bool) []FLACOptimizeResult {
+	results := make([]FLACOptimizeResult, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		result, err := OptimizeFLAC(path, reencode)
+		if err != nil {
+			GoLog("[FLACOptimize] %s: %v\n", filepath.Base(path), err)
+			result = &FLACOptimizeResult{Path: path, Error: err.Error()}
+		}
+		results = append(results, *result)
+	}
+	return results
+}
+
+// optimizeCompletedFLAC applies the FLACOptimize policy to a successful
+// FLAC path output. Failures only cost the saving, so they are logged.
+func optimizeCompletedFLAC(req DownloadRequest, respJSON string) {
+	policy := GetBackendConfig().FLACOptimize
+	if policy == FLACOptimizeOff || isFDOutput(req.OutputFD) {
+		return
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success || resp.AlreadyExists {
+		return
+	}
+	path := strings.TrimSpace(resp.FilePath)
+	if !strings.EqualFold(filepath.Ext(path), ".flac") || strings.HasPrefix(path, "content://") {
+		return
+	}
+	if policy == FLACOptimizeReencode && req.ItemID != "" {
+		SetItemFinalizing(req.ItemID)
+	}
+	result, err := OptimizeFLAC(path, policy == FLACOptimizeReencode)
+	if err != nil {
+		GoLog("[FLACOptimize] %s: %v\n", filepath.Base(path), err)
+		return
+	}
+	if result.Replaced {
+		GoLog("[FLACOptimize] %s: %d -> %d bytes\n", filepath.Base(path), result.BytesBefore, result.BytesAfter)
+	}
+}
@@ -0,0 +1,201 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bloatFLAC rewrites a test album with an APPLICATION block, tags and 64 KiB
+// of padding after STREAMINFO, and sets the STREAMINFO MD5 to md5.
+func bloatFLAC(t *testing.T, path string, md5 []byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(data[8+18:8+34], md5)
+	data[4] = 0
+
+	comment := binary.LittleEndian.AppendUint32(nil, 6)
+	comment = append(comment, "vendor"...)
+	comment = binary.LittleEndian.AppendUint32(comment, 1)
+	comment = binary.LittleEndian.AppendUint32(comment, 11)
+	comment = append(comment, "TITLE=Track"...)
+	comment = append([]byte{0x04, 0, 0, byte(len(comment))}, comment...)
+	application := append([]byte{0x02, 0, 0, 8}, "TOOL0000"...)
+	padding := append([]byte{0x81, 0x01, 0x00, 0x00}, make([]byte, 64<<10)...)
+
+	var out bytes.Buffer
+	out.Write(data[:8+34])
+	out.Write(application)
+	out.Write(comment)
+	out.Write(padding)
+	out.Write(data[8+34:])
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeFFmpegWorker completes queued FFmpeg commands the way the Dart side
+// would, calling encode to produce each output file.
+func fakeFFmpegWorker(t *testing.T, encode func(cmd *FFmpegCommand)) {
+	t.Helper()
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+			ffmpegCommandsMu.Lock()
+			for _, cmd := range ffmpegCommands {
+				if !cmd.Completed {
+					encode(cmd)
+					cmd.Completed = true
+				}
+			}
+			ffmpegCommandsMu.Unlock()
+		}
+	}()
+}
+
+func flacBlockTypes(t *testing.T, path string) []byte {
+	t.Helper()
+	f, blocks, _, err := openFLACAudio(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	var types []byte
+	for _, block := range blocks {
+		types = append(types, block[0])
+	}
+	return types
+}
+
+func TestOptimizeFLAC_StripsPaddingAndForeignBlocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.flac")
+	testFLACAlbum(t, path, 20)
+	bloatFLAC(t, path, make([]byte, 16))
+
+	result, err := OptimizeFLAC(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Replaced || result.Reencoded || result.RemovedBlocks != 2 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	stat, _ := os.Stat(path)
+	if stat.Size() != result.BytesAfter || result.BytesBefore-result.BytesAfter != 64<<10-flacKeptPadding+12 {
+		t.Errorf("sizes %d -> %d, file is %d", result.BytesBefore, result.BytesAfter, stat.Size())
+	}
+	if types := flacBlockTypes(t, path); !bytes.Equal(types, []byte{0x00, 0x04, 0x81}) {
+		t.Errorf("block types = % x", types)
+	}
+	if v := VerifyAudioFile(path); v.Status != VerifyStatusOK {
+		t.Errorf("optimized file does not verify: %+v", v)
+	}
+
+	again, err := OptimizeFLAC(path, false)
+	if err != nil || again.Replaced || again.RemovedBlocks != 0 {
+		t.Errorf("second pass = %+v, %v", again, err)
+	}
+}
+
+func TestOptimizeFLAC_Reencode(t *testing.T) {
+	dir := t.TempDir()
+	encodedPath := filepath.Join(dir, "encoded.flac")
+	testFLACAlbum(t, encodedPath, 20)
+	encoded, _ := os.ReadFile(encodedPath)
+
+	md5 := bytes.Repeat([]byte{0xab}, 16)
+	copy(encoded[8+18:8+34], md5)
+	// FFmpeg writes its own seek table after STREAMINFO.
+	seekTable := append([]byte{0x80 | flacBlockSeekTable, 0, 0, 18}, make([]byte, 18)...)
+	encoded[4] &^= 0x80
+	encoded = append(encoded[:8+34], append(seekTable, encoded[8+34:]...)...)
+	var encodedMu sync.Mutex
+	fakeFFmpegWorker(t, func(cmd *FFmpegCommand) {
+		if !strings.Contains(cmd.Command, "-compression_level 8") {
+			cmd.Error = "unexpected command " + cmd.Command
+			return
+		}
+		encodedMu.Lock()
+		defer encodedMu.Unlock()
+		cmd.Success = os.WriteFile(cmd.OutputPath, encoded, 0644) == nil
+	})
+
+	path := filepath.Join(dir, "track.flac")
+	testFLACAlbum(t, path, 20)
+	bloatFLAC(t, path, md5)
+
+	result, err := OptimizeFLAC(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Replaced || !result.Reencoded {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if types := flacBlockTypes(t, path); !bytes.Equal(types, []byte{0x00, 0x03, 0x04, 0x81}) {
+		t.Errorf("block types = % x", types)
+	}
+	if _, err := os.Stat(path + ".reencode.flac"); !os.IsNotExist(err) {
+		t.Errorf("encoder output was left behind: %v", err)
+	}
+
+	// An encode that does not decode to the same audio keeps the original.
+	encodedMu.Lock()
+	copy(encoded[8+18:8+34], bytes.Repeat([]byte{0xcd}, 16))
+	encodedMu.Unlock()
+	before, _ := os.ReadFile(path)
+	if _, err := OptimizeFLAC(path, true); err == nil || !strings.Contains(err.Error(), "MD5") {
+		t.Fatalf("expected MD5 mismatch, got %v", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Error("original changed after a failed re-encode")
+	}
+}
+
+func TestBackendConfig_FLACOptimize(t *testing.T) {
+	cfg := DefaultBackendConfig()
+	if cfg.FLACOptimize != FLACOptimizeOff {
+		t.Fatalf("default = %q", cfg.FLACOptimize)
+	}
+	cfg.FLACOptimize = " ReEncode "
+	if err := cfg.Validate(); err != nil || cfg.FLACOptimize != FLACOptimizeReencode {
+		t.Fatalf("validate = %v, %q", err, cfg.FLACOptimize)
+	}
+	cfg.FLACOptimize = "level12"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected an error for an unknown mode")
+	}
+}
+
+func TestOptimizeFLAC_SkipsReencodeWithoutMD5(t *testing.T) {
+	fakeFFmpegWorker(t, func(cmd *FFmpegCommand) {
+		cmd.Error = "unexpected command " + cmd.Command
+	})
+
+	path := filepath.Join(t.TempDir(), "track.flac")
+	testFLACAlbum(t, path, 20)
+	bloatFLAC(t, path, make([]byte, 16))
+
+	result, err := OptimizeFLAC(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reencoded || !result.Replaced {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if types := flacBlockTypes(t, path); !bytes.Equal(types, []byte{0x00, 0x04, 0x81}) {
+		t.Errorf("block types = % x", types)
+	}
+}
@@ -0,0 +1,97 @@
+package gobackendtest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// Fixtures are byte-for-byte deterministic: the same track always produces
+// the same file, so tests can compare sizes and hashes across runs. The audio
+// payload is filler, not decodable sound; headers are real enough for format
+// sniffing, quality detection and tag embedding.
+
+const (
+	defaultFixtureSize = 256 << 10
+	mp3FrameSize       = 417 // MPEG-1 Layer III, 128 kbps, 44.1 kHz, no padding
+)
+
+// fillerBytes returns n pseudo-random bytes seeded by seed.
+func fillerBytes(seed string, n int) []byte {
+	out := make([]byte, 0, n+sha256.Size)
+	block := sha256.Sum256([]byte(seed))
+	for len(out) < n {
+		out = append(out, block[:]...)
+		block = sha256.Sum256(block[:])
+	}
+	return out[:n]
+}
+
+// FLACFixture builds a FLAC file with a single STREAMINFO block followed by
+// size bytes of filler frames.
+func FLACFixture(seed string, sampleRate, bitDepth, size int) []byte {
+	if sampleRate <= 0 {
+		sampleRate = 44100
+	}
+	if bitDepth <= 0 {
+		bitDepth = 16
+	}
+	if size < 2 {
+		size = defaultFixtureSize
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	buf.Write([]byte{0x80, 0, 0, 34}) // last block, STREAMINFO, 34 bytes
+
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint16(info[0:], 4096)
+	binary.BigEndian.PutUint16(info[2:], 4096)
+	const channels = 2
+	totalSamples := uint64(sampleRate) * 180
+	packed := uint64(sampleRate)<<44 | uint64(channels-1)<<41 | uint64(bitDepth-1)<<36 | totalSamples
+	binary.BigEndian.PutUint64(info[10:], packed)
+	md5 := sha256.Sum256([]byte("md5:" + seed))
+	copy(info[18:], md5[:16])
+	buf.Write(info)
+
+	frames := fillerBytes(seed, size)
+	frames[0], frames[1] = 0xFF, 0xF8 // frame sync code
+	buf.Write(frames)
+	return buf.Bytes()
+}
+
+// MP3Fixture builds an MP3 of constant-bitrate frames with filler payloads,
+// at least size bytes long.
+func MP3Fixture(seed string, size int) []byte {
+	if size <= 0 {
+		size = defaultFixtureSize
+	}
+	frames := (size + mp3FrameSize - 1) / mp3FrameSize
+	payload := fillerBytes(seed, frames*(mp3FrameSize-4))
+
+	out := make([]byte, 0, frames*mp3FrameSize)
+	for i := 0; i < frames; i++ {
+		out = append(out, 0xFF, 0xFB, 0x90, 0x64)
+		out = append(out, payload[i*(mp3FrameSize-4):(i+1)*(mp3FrameSize-4)]...)
+	}
+	return out
+}
+
+// CoverFixture returns a small solid-colour JPEG whose colour depends on seed.
+func CoverFixture(seed string) []byte {
+	sum := sha256.Sum256([]byte("cover:" + seed))
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	c := color.RGBA{R: sum[0], G: sum[1], B: sum[2], A: 0xFF}
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	return buf.Bytes()
+}
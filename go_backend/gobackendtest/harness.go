@@ -0,0 +1,292 @@
+package gobackendtest
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	gobackend "github.com/zarz/spotiflac_android/go_backend"
+)
+
+// Harness wires mock providers into the backend for one test. It changes
+// process-wide state (extension system, proxy, TLS verification, provider
+// priority) and restores it on cleanup, so tests using it must not run in
+// parallel with each other.
+type Harness struct {
+	t         testing.TB
+	Dir       string
+	OutputDir string
+
+	proxy *httptest.Server
+
+	mu        sync.Mutex
+	providers map[string]*MockProvider
+	installed []string
+}
+
+func NewHarness(t testing.TB) *Harness {
+	t.Helper()
+	dir := t.TempDir()
+	h := &Harness{
+		t:         t,
+		Dir:       dir,
+		OutputDir: filepath.Join(dir, "downloads"),
+		providers: make(map[string]*MockProvider),
+	}
+	for _, sub := range []string{"extensions", "data", "packages", "downloads"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gobackend.InitExtensionSystem(filepath.Join(dir, "extensions"), filepath.Join(dir, "data")); err != nil {
+		t.Fatalf("init extension system: %v", err)
+	}
+	gobackend.AddAllowedDownloadDir(h.OutputDir)
+
+	h.proxy = httptest.NewServer(http.HandlerFunc(h.serveConnect))
+
+	prevConfig := gobackend.GetBackendConfig()
+	prevNetwork := gobackend.GetNetworkCompatibilityOptions()
+	prevPriority := gobackend.GetProviderPriority()
+
+	cfg := prevConfig
+	cfg.ProxyURL = h.proxy.URL
+	if err := gobackend.UpdateBackendConfig(cfg); err != nil {
+		t.Fatalf("set proxy: %v", err)
+	}
+	// The mocks use httptest's self-signed certificate.
+	gobackend.SetNetworkCompatibilityOptions(prevNetwork.AllowHTTP, true)
+
+	t.Cleanup(func() {
+		for _, id := range h.installed {
+			gobackend.RemoveExtensionByID(id)
+		}
+		gobackend.SetProviderPriority(prevPriority)
+		gobackend.SetNetworkCompatibilityOptions(prevNetwork.AllowHTTP, prevNetwork.InsecureTLS)
+		gobackend.UpdateBackendConfig(prevConfig)
+		h.proxy.Close()
+		h.mu.Lock()
+		for _, m := range h.providers {
+			m.Close()
+		}
+		h.mu.Unlock()
+	})
+	return h
+}
+
+// serveConnect tunnels CONNECT requests for installed mock hosts and refuses
+// everything else, so a test can never reach the real network through it.
+func (h *Harness) serveConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "mock proxy only tunnels CONNECT", http.StatusForbidden)
+		return
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	h.mu.Lock()
+	m := h.providers[host]
+	h.mu.Unlock()
+	if m == nil {
+		http.Error(w, "unknown mock host "+host, http.StatusForbidden)
+		return
+	}
+
+	upstream, err := net.Dial("tcp", m.Addr())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "hijacking unsupported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	go func() {
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	io.Copy(client, upstream)
+	client.Close()
+}
+
+// Install packages m as a declarative extension with the same ID and loads
+// it. The harness closes m on cleanup.
+func (h *Harness) Install(m *MockProvider) {
+	h.t.Helper()
+	h.mu.Lock()
+	h.providers[m.Host] = m
+	h.mu.Unlock()
+
+	manifest := map[string]interface{}{
+		"name":        m.ID,
+		"displayName": m.ID,
+		"version":     "1.0.0",
+		"author":      "gobackendtest",
+		"description": "Mock provider",
+		"apiVersion":  gobackend.ExtensionRuntimeAPIVersion,
+		"type":        []string{"metadata_provider", "download_provider"},
+		"permissions": map[string]interface{}{
+			"network": []string{m.Host},
+			"file":    true,
+		},
+	}
+
+	pkg := filepath.Join(h.Dir, "packages", m.ID+".spotiflac-ext")
+	if err := writePackage(pkg, map[string]interface{}{
+		"manifest.json": manifest,
+		"provider.json": m.providerDefinition(),
+	}); err != nil {
+		h.t.Fatalf("package %s: %v", m.ID, err)
+	}
+	if _, err := gobackend.LoadExtensionFromPath(pkg); err != nil {
+		h.t.Fatalf("install %s: %v", m.ID, err)
+	}
+	if err := gobackend.SetExtensionEnabledByID(m.ID, true); err != nil {
+		h.t.Fatalf("enable %s: %v", m.ID, err)
+	}
+	h.mu.Lock()
+	h.installed = append(h.installed, m.ID)
+	h.mu.Unlock()
+}
+
+func writePackage(path string, files map[string]interface{}) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		data, err := json.Marshal(content)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// SetPriority sets the download provider order. Keep it to mock IDs so
+// fallback never reaches a built-in service.
+func (h *Harness) SetPriority(providerIDs ...string) {
+	gobackend.SetProviderPriority(providerIDs)
+}
+
+// Request builds a download request for a track of m with fallback enabled
+// and m as the source.
+func (h *Harness) Request(m *MockProvider, trackID string) gobackend.DownloadRequest {
+	h.t.Helper()
+	t, ok := m.Track(trackID)
+	if !ok {
+		h.t.Fatalf("%s has no track %q", m.ID, trackID)
+	}
+	return gobackend.DownloadRequest{
+		ItemID:         m.ID + ":" + t.ID,
+		Source:         m.ID,
+		SpotifyID:      t.ID,
+		TrackName:      t.Title,
+		ArtistName:     t.Artist,
+		AlbumName:      t.Album,
+		ISRC:           t.ISRC,
+		TrackNumber:    t.TrackNumber,
+		DurationMS:     t.DurationMS,
+		CoverURL:       m.URL("/covers/" + t.ID + ".jpg"),
+		OutputDir:      h.OutputDir,
+		OutputExt:      "." + t.Format,
+		FilenameFormat: "{artist} - {title}",
+		Quality:        "LOSSLESS",
+		UseExtensions:  true,
+		UseFallback:    true,
+	}
+}
+
+// Download runs req through the extension download path.
+func (h *Harness) Download(req gobackend.DownloadRequest) (*gobackend.DownloadResponse, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	respJSON, err := gobackend.DownloadWithExtensionsJSON(string(data))
+	if err != nil {
+		return nil, err
+	}
+	var resp gobackend.DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &resp, nil
+}
+
+// QueueResult is the outcome of one queued request.
+type QueueResult struct {
+	Request  gobackend.DownloadRequest
+	Response *gobackend.DownloadResponse
+	Err      error
+}
+
+// RunQueue downloads reqs with at most concurrency in flight, the way the
+// app's queue drives the backend, and returns results in request order.
+func (h *Harness) RunQueue(reqs []gobackend.DownloadRequest, concurrency int) []QueueResult {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	results := make([]QueueResult, len(reqs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req gobackend.DownloadRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if req.ItemID != "" {
+				gobackend.InitItemProgress(req.ItemID)
+				defer gobackend.ClearItemProgress(req.ItemID)
+			}
+			resp, err := h.Download(req)
+			results[i] = QueueResult{Request: req, Response: resp, Err: err}
+		}(i, req)
+	}
+	wg.Wait()
+	return results
+}
+
+// Tag embeds t's metadata and the provider's cover fixture into a
+// downloaded FLAC file.
+func (h *Harness) Tag(path string, m *MockProvider, trackID string) error {
+	t, ok := m.Track(trackID)
+	if !ok {
+		return fmt.Errorf("%s has no track %q", m.ID, trackID)
+	}
+	return gobackend.EmbedMetadataWithCoverData(path, gobackend.Metadata{
+		Title:       t.Title,
+		Artist:      t.Artist,
+		Album:       t.Album,
+		ISRC:        t.ISRC,
+		TrackNumber: t.TrackNumber,
+	}, CoverFixture(m.ID+"/"+t.ID))
+}
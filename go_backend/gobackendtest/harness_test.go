@@ -0,0 +1,98 @@
+package gobackendtest
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	gobackend "github.com/zarz/spotiflac_android/go_backend"
+)
+
+var testTrack = Track{
+	ID:          "trk-1",
+	Title:       "First Light",
+	Artist:      "Mock Artist",
+	Album:       "Fixtures",
+	ISRC:        "XX0000000001",
+	TrackNumber: 1,
+	DurationMS:  180000,
+	SampleRate:  48000,
+	BitDepth:    24,
+	Size:        64 << 10,
+}
+
+func TestFixturesAreDeterministic(t *testing.T) {
+	if !bytes.Equal(FLACFixture("a", 0, 0, 1000), FLACFixture("a", 0, 0, 1000)) {
+		t.Error("FLAC fixture differs between calls")
+	}
+	if bytes.Equal(FLACFixture("a", 0, 0, 1000), FLACFixture("b", 0, 0, 1000)) {
+		t.Error("FLAC fixture ignores seed")
+	}
+	if mp3 := MP3Fixture("a", 1000); len(mp3)%mp3FrameSize != 0 || mp3[0] != 0xFF {
+		t.Errorf("MP3 fixture is not whole frames: %d bytes", len(mp3))
+	}
+	if !bytes.Equal(CoverFixture("a"), CoverFixture("a")) {
+		t.Error("cover fixture differs between calls")
+	}
+}
+
+func TestHarnessFallbackAndTagging(t *testing.T) {
+	h := NewHarness(t)
+	primary := NewMockProvider("mock-a", testTrack)
+	secondary := NewMockProvider("mock-b", testTrack)
+	h.Install(primary)
+	h.Install(secondary)
+	h.SetPriority("mock-a", "mock-b")
+
+	primary.Fail(Failure{Path: "/stream/", Status: 503})
+
+	results := h.RunQueue([]gobackend.DownloadRequest{h.Request(primary, testTrack.ID)}, 1)
+	res := results[0]
+	if res.Err != nil || res.Response == nil || !res.Response.Success {
+		t.Fatalf("download failed: %+v %v", res.Response, res.Err)
+	}
+	if res.Response.Service != "mock-b" {
+		t.Errorf("service = %q, want fallback to mock-b", res.Response.Service)
+	}
+
+	got, err := os.ReadFile(res.Response.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := secondary.Fixture(testTrack.ID)
+	if !bytes.Equal(got, want) {
+		t.Errorf("downloaded %d bytes, want the %d-byte fixture", len(got), len(want))
+	}
+
+	if err := h.Tag(res.Response.FilePath, secondary, testTrack.ID); err != nil {
+		t.Fatalf("tag: %v", err)
+	}
+	meta, err := gobackend.ReadMetadata(res.Response.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != testTrack.Title || meta.Artist != testTrack.Artist || meta.ISRC != testTrack.ISRC {
+		t.Errorf("tags not written: %+v", meta)
+	}
+}
+
+func TestMockProviderTruncatesResponses(t *testing.T) {
+	h := NewHarness(t)
+	m := NewMockProvider("mock-r", testTrack)
+	h.Install(m)
+	h.SetPriority("mock-r")
+
+	m.Fail(Failure{Path: "/stream/", Truncate: 1000})
+	req := h.Request(m, testTrack.ID)
+	if resp, err := h.Download(req); err == nil && resp.Success {
+		t.Fatal("expected truncated download to fail")
+	}
+
+	resp, err := h.Download(req)
+	if err != nil || !resp.Success {
+		t.Fatalf("retry failed: %+v %v", resp, err)
+	}
+	if n := len(m.Requests()); n < 2 {
+		t.Errorf("expected at least 2 stream requests, got %d", n)
+	}
+}
@@ -0,0 +1,355 @@
+// Package gobackendtest provides an in-process mock provider and helpers for
+// end-to-end tests of the download pipeline (fallback, resume, tagging)
+// without touching real services.
+//
+// A MockProvider is an HTTPS server for a made-up hostname. A Harness routes
+// that hostname to the server through a local CONNECT proxy set as the
+// backend's proxy_url, and installs each provider as a declarative extension
+// (provider.json), so requests take the same sandboxed path as a real
+// extension's.
+package gobackendtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Track is one catalogue entry served by a MockProvider.
+type Track struct {
+	ID          string
+	Title       string
+	Artist      string
+	Album       string
+	ISRC        string
+	TrackNumber int
+	DurationMS  int
+	// Format is "flac" (default) or "mp3".
+	Format     string
+	SampleRate int
+	BitDepth   int
+	// Size of the audio payload in bytes; defaults to 256 KiB.
+	Size int
+}
+
+// Failure makes the next Times requests whose path starts with Path fail.
+// With Status set the request is answered with that status; otherwise the
+// response is cut off after Truncate bytes of body.
+type Failure struct {
+	Path     string
+	Status   int
+	Truncate int
+	Times    int
+}
+
+// Request records one request the mock received.
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Range  string
+}
+
+type MockProvider struct {
+	ID   string
+	Host string
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	tracks   map[string]Track
+	order    []string
+	failures []*Failure
+	throttle int
+	requests []Request
+}
+
+// NewMockProvider starts a provider serving tracks under the hostname
+// "<id>.mock.test". Call Close when done, or let Harness.Install do it.
+//
+// Routes:
+//
+//	GET /search?q=&limit=   {"tracks": [...]}, matched on title or artist
+//	GET /tracks/{id}        one track
+//	GET /stream/{id}        audio fixture, Range requests supported
+//	GET /covers/{id}.jpg    cover fixture
+func NewMockProvider(id string, tracks ...Track) *MockProvider {
+	m := &MockProvider{
+		ID:     id,
+		Host:   id + ".mock.test",
+		tracks: make(map[string]Track),
+	}
+	for _, t := range tracks {
+		m.AddTrack(t)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search", m.handleSearch)
+	mux.HandleFunc("GET /tracks/{id}", m.handleTrack)
+	mux.HandleFunc("GET /stream/{id}", m.handleStream)
+	mux.HandleFunc("GET /covers/{file}", m.handleCover)
+
+	m.server = httptest.NewUnstartedServer(m.middleware(mux))
+	m.server.StartTLS()
+	return m
+}
+
+func (m *MockProvider) Close() {
+	m.server.Close()
+}
+
+// Addr is the listener address the harness proxy tunnels to.
+func (m *MockProvider) Addr() string {
+	return m.server.Listener.Addr().String()
+}
+
+// URL returns the https URL for path on the provider's virtual host.
+func (m *MockProvider) URL(path string) string {
+	return "https://" + m.Host + path
+}
+
+func (m *MockProvider) AddTrack(t Track) {
+	if t.Format == "" {
+		t.Format = "flac"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.tracks[t.ID]; !exists {
+		m.order = append(m.order, t.ID)
+	}
+	m.tracks[t.ID] = t
+}
+
+func (m *MockProvider) Track(id string) (Track, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tracks[id]
+	return t, ok
+}
+
+// Fail queues a failure rule. Rules are consumed in the order added.
+func (m *MockProvider) Fail(f Failure) {
+	if f.Times <= 0 {
+		f.Times = 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = append(m.failures, &f)
+}
+
+// SetThrottle limits response bodies to bytesPerSecond; 0 removes the limit.
+func (m *MockProvider) SetThrottle(bytesPerSecond int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.throttle = bytesPerSecond
+}
+
+// Requests returns every request received so far, oldest first.
+func (m *MockProvider) Requests() []Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Request(nil), m.requests...)
+}
+
+// Fixture returns the exact bytes /stream/{id} serves.
+func (m *MockProvider) Fixture(id string) ([]byte, bool) {
+	t, ok := m.Track(id)
+	if !ok {
+		return nil, false
+	}
+	return fixtureFor(m.ID, t), true
+}
+
+func fixtureFor(providerID string, t Track) []byte {
+	seed := providerID + "/" + t.ID
+	if t.Format == "mp3" {
+		return MP3Fixture(seed, t.Size)
+	}
+	return FLACFixture(seed, t.SampleRate, t.BitDepth, t.Size)
+}
+
+func (m *MockProvider) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.requests = append(m.requests, Request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Range:  r.Header.Get("Range"),
+		})
+		var failure Failure
+		for _, f := range m.failures {
+			if f.Times > 0 && strings.HasPrefix(r.URL.Path, f.Path) {
+				f.Times--
+				failure = *f
+				break
+			}
+		}
+		throttle := m.throttle
+		m.mu.Unlock()
+
+		if failure.Status != 0 {
+			http.Error(w, http.StatusText(failure.Status), failure.Status)
+			return
+		}
+		if failure.Truncate > 0 || throttle > 0 {
+			w = &shapedWriter{ResponseWriter: w, limit: failure.Truncate, rate: throttle}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shapedWriter throttles and/or truncates a response body. Truncation aborts
+// the handler so the client sees the connection drop mid-body.
+type shapedWriter struct {
+	http.ResponseWriter
+	limit   int
+	rate    int
+	written int
+}
+
+func (w *shapedWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		chunk := p
+		if w.rate > 0 && len(chunk) > w.rate/10+1 {
+			chunk = chunk[:w.rate/10+1]
+		}
+		if w.limit > 0 && w.written+len(chunk) > w.limit {
+			chunk = chunk[:w.limit-w.written]
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		total += n
+		w.written += n
+		if err != nil {
+			return total, err
+		}
+		if w.limit > 0 && w.written >= w.limit {
+			if f, ok := w.ResponseWriter.(http.Flusher); ok {
+				f.Flush()
+			}
+			panic(http.ErrAbortHandler)
+		}
+		if w.rate > 0 {
+			if f, ok := w.ResponseWriter.(http.Flusher); ok {
+				f.Flush()
+			}
+			time.Sleep(time.Duration(len(chunk)) * time.Second / time.Duration(w.rate))
+		}
+		p = p[len(chunk):]
+	}
+	return total, nil
+}
+
+func (m *MockProvider) trackJSON(t Track) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           t.ID,
+		"title":        t.Title,
+		"artist":       t.Artist,
+		"album":        t.Album,
+		"isrc":         t.ISRC,
+		"track_number": t.TrackNumber,
+		"duration_ms":  t.DurationMS,
+		"cover":        m.URL("/covers/" + t.ID + ".jpg"),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (m *MockProvider) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(r.URL.Query().Get("q"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	m.mu.Lock()
+	results := []interface{}{}
+	for _, id := range m.order {
+		t := m.tracks[id]
+		if query != "" && !strings.Contains(strings.ToLower(t.Title), query) && !strings.Contains(strings.ToLower(t.Artist), query) {
+			continue
+		}
+		results = append(results, m.trackJSON(t))
+		if limit > 0 && len(results) == limit {
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{"tracks": results})
+}
+
+func (m *MockProvider) handleTrack(w http.ResponseWriter, r *http.Request) {
+	t, ok := m.Track(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, m.trackJSON(t))
+}
+
+func (m *MockProvider) handleStream(w http.ResponseWriter, r *http.Request) {
+	t, ok := m.Track(r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	contentType := "audio/flac"
+	if t.Format == "mp3" {
+		contentType = "audio/mpeg"
+	}
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, t.ID+"."+t.Format, time.Unix(0, 0), bytes.NewReader(fixtureFor(m.ID, t)))
+}
+
+func (m *MockProvider) handleCover(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(r.PathValue("file"), ".jpg")
+	if _, ok := m.Track(id); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(CoverFixture(m.ID + "/" + id))
+}
+
+// providerDefinition is the provider.json the harness installs for m.
+func (m *MockProvider) providerDefinition() map[string]interface{} {
+	fields := map[string]string{
+		"id":           "$.id",
+		"name":         "$.title",
+		"artists":      "$.artist",
+		"album_name":   "$.album",
+		"isrc":         "$.isrc",
+		"track_number": "$.track_number",
+		"duration_ms":  "$.duration_ms",
+		"cover_url":    "$.cover",
+	}
+	return map[string]interface{}{
+		"search": map[string]interface{}{
+			"url":     m.URL("/search?q={query}&limit={limit}"),
+			"results": "$.tracks[*]",
+			"fields":  fields,
+		},
+		"track": map[string]interface{}{
+			"url":    m.URL("/tracks/{id}"),
+			"fields": fields,
+		},
+		"download": map[string]interface{}{
+			"url":    m.URL("/stream/{id}?quality={quality}"),
+			"format": "flac",
+		},
+	}
+}
+
+// Catalog returns the track IDs in insertion order.
+func (m *MockProvider) Catalog() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.order...)
+}
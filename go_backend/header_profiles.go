@@ -0,0 +1,257 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HeaderProfile is a named set of request headers (user agent, client
+// tokens, Accept-Language...) applied to extension HTTP calls. Headers the
+// extension sets explicitly on a request always win.
+type HeaderProfile struct {
+	UserAgent string            `json:"user_agent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+const (
+	HeaderProfileDefault = "default"
+
+	defaultExtensionUserAgent = "SpotiFLAC-Extension/1.0"
+	// The http.* bindings have always sent this casing; keep it so servers
+	// that key on the exact string see no change.
+	extensionHTTPUserAgent = "Spotiflac-Extension/1.0"
+
+	headerProfilesFile = "header_profiles.json"
+)
+
+// The default profile sets no user agent, so each binding keeps the one it
+// has always sent.
+var builtinHeaderProfiles = map[string]HeaderProfile{
+	HeaderProfileDefault: {},
+	"chrome-desktop": {
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36",
+		Headers: map[string]string{
+			"Accept-Language":    "en-US,en;q=0.9",
+			"Sec-Ch-Ua":          `"Google Chrome";v="141", "Chromium";v="141", "Not?A_Brand";v="24"`,
+			"Sec-Ch-Ua-Mobile":   "?0",
+			"Sec-Ch-Ua-Platform": `"Windows"`,
+		},
+	},
+	"chrome-android": {
+		UserAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Mobile Safari/537.36",
+		Headers: map[string]string{
+			"Accept-Language":    "en-US,en;q=0.9",
+			"Sec-Ch-Ua-Mobile":   "?1",
+			"Sec-Ch-Ua-Platform": `"Android"`,
+		},
+	},
+	"firefox-desktop": {
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:144.0) Gecko/20100101 Firefox/144.0",
+		Headers:   map[string]string{"Accept-Language": "en-US,en;q=0.5"},
+	},
+	"safari-ios": {
+		UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 18_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.6 Mobile/15E148 Safari/604.1",
+		Headers:   map[string]string{"Accept-Language": "en-US,en;q=0.9"},
+	},
+}
+
+// ExtensionHeaderConfig selects the profile an extension uses by default and
+// per host, and holds the extension's own custom profiles.
+type ExtensionHeaderConfig struct {
+	Profile      string                   `json:"profile,omitempty"`
+	HostProfiles map[string]string        `json:"host_profiles,omitempty"`
+	Custom       map[string]HeaderProfile `json:"custom,omitempty"`
+}
+
+var (
+	headerProfilesMu       sync.RWMutex
+	extensionHeaderConfigs = make(map[string]*ExtensionHeaderConfig)
+	headerProfilesDir      string
+)
+
+func (c *ExtensionHeaderConfig) lookup(name string) (HeaderProfile, bool) {
+	if profile, ok := c.Custom[name]; ok {
+		return profile, true
+	}
+	profile, ok := builtinHeaderProfiles[name]
+	return profile, ok
+}
+
+// Validate normalizes hosts and checks that every selected profile exists.
+func (c *ExtensionHeaderConfig) Validate() error {
+	if c.Profile == "" {
+		c.Profile = HeaderProfileDefault
+	}
+	if _, ok := c.lookup(c.Profile); !ok {
+		return fmt.Errorf("unknown header profile %q", c.Profile)
+	}
+	hosts := make(map[string]string, len(c.HostProfiles))
+	for host, name := range c.HostProfiles {
+		if _, ok := c.lookup(name); !ok {
+			return fmt.Errorf("unknown header profile %q for host %s", name, host)
+		}
+		if normalized := normalizeHostList([]string{host}); len(normalized) == 1 {
+			hosts[normalized[0]] = name
+		}
+	}
+	c.HostProfiles = hosts
+	return nil
+}
+
+func getExtensionHeaderConfig(extensionID string) ExtensionHeaderConfig {
+	headerProfilesMu.RLock()
+	defer headerProfilesMu.RUnlock()
+
+	config := ExtensionHeaderConfig{Profile: HeaderProfileDefault, HostProfiles: map[string]string{}, Custom: map[string]HeaderProfile{}}
+	if stored := extensionHeaderConfigs[extensionID]; stored != nil {
+		config.Profile = stored.Profile
+		for host, name := range stored.HostProfiles {
+			config.HostProfiles[host] = name
+		}
+		for name, profile := range stored.Custom {
+			config.Custom[name] = profile
+		}
+	}
+	return config
+}
+
+func setExtensionHeaderConfig(extensionID string, config ExtensionHeaderConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	headerProfilesMu.Lock()
+	defer headerProfilesMu.Unlock()
+	extensionHeaderConfigs[extensionID] = &config
+	return saveHeaderProfilesLocked()
+}
+
+// forgetExtensionHeaderConfig drops the header configuration of an
+// uninstalled extension.
+func forgetExtensionHeaderConfig(extensionID string) error {
+	headerProfilesMu.Lock()
+	defer headerProfilesMu.Unlock()
+	if _, ok := extensionHeaderConfigs[extensionID]; !ok {
+		return nil
+	}
+	delete(extensionHeaderConfigs, extensionID)
+	return saveHeaderProfilesLocked()
+}
+
+// loadHeaderProfiles reads persisted header configurations from dir. A
+// missing or corrupt file leaves every extension on the default profile.
+func loadHeaderProfiles(dir string) {
+	loaded := make(map[string]*ExtensionHeaderConfig)
+	if data, err := os.ReadFile(filepath.Join(dir, headerProfilesFile)); err == nil {
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			GoLog("[Extension] Ignoring corrupt %s: %v\n", headerProfilesFile, err)
+			loaded = make(map[string]*ExtensionHeaderConfig)
+		}
+	}
+	for extensionID, config := range loaded {
+		if config == nil || config.Validate() != nil {
+			GoLog("[Extension:%s] Dropping invalid stored header config\n", extensionID)
+			delete(loaded, extensionID)
+		}
+	}
+
+	headerProfilesMu.Lock()
+	headerProfilesDir = dir
+	extensionHeaderConfigs = loaded
+	headerProfilesMu.Unlock()
+}
+
+func saveHeaderProfilesLocked() error {
+	if headerProfilesDir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(extensionHeaderConfigs, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(headerProfilesDir, headerProfilesFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func GetExtensionHeaderConfigJSON(extensionID string) (string, error) {
+	jsonBytes, err := json.Marshal(getExtensionHeaderConfig(extensionID))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// SetExtensionHeaderConfigJSON replaces the header configuration of one
+// extension.
+func SetExtensionHeaderConfigJSON(extensionID, configJSON string) error {
+	var config ExtensionHeaderConfig
+	if err := json.Unmarshal([]byte(configJSON), &config); err != nil {
+		return fmt.Errorf("invalid header config: %w", err)
+	}
+	if err := setExtensionHeaderConfig(extensionID, config); err != nil {
+		return err
+	}
+	GoLog("[Extension:%s] Header profile set to %s (%d host overrides, %d custom)\n",
+		extensionID, config.Profile, len(config.HostProfiles), len(config.Custom))
+	return nil
+}
+
+// headerProfileNames lists built-in and custom profiles for extensionID.
+func headerProfileNames(extensionID string) []string {
+	config := getExtensionHeaderConfig(extensionID)
+	var names []string
+	for name := range builtinHeaderProfiles {
+		names = append(names, name)
+	}
+	for name := range config.Custom {
+		if _, builtin := builtinHeaderProfiles[name]; !builtin {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveHeaderProfile picks the profile for host: the most specific host
+// override, otherwise the extension's default profile.
+func resolveHeaderProfile(extensionID, host string) HeaderProfile {
+	config := getExtensionHeaderConfig(extensionID)
+
+	name, matchLen := config.Profile, -1
+	for entry, profile := range config.HostProfiles {
+		if hostInList(host, []string{entry}) && len(entry) > matchLen {
+			name, matchLen = profile, len(entry)
+		}
+	}
+	if profile, ok := config.lookup(name); ok {
+		return profile
+	}
+	return builtinHeaderProfiles[HeaderProfileDefault]
+}
+
+// applyHeaderProfile fills in the profile's headers that req does not set.
+// fallbackUA is the binding's own user agent, used when the profile has none.
+func applyHeaderProfile(extensionID string, req *http.Request, fallbackUA string) {
+	profile := resolveHeaderProfile(extensionID, req.URL.Hostname())
+	for k, v := range profile.Headers {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+	if req.Header.Get("User-Agent") == "" {
+		ua := profile.UserAgent
+		if strings.TrimSpace(ua) == "" {
+			ua = fallbackUA
+		}
+		req.Header.Set("User-Agent", ua)
+	}
+}
@@ -0,0 +1,97 @@
+package gobackend
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestApplyHeaderProfile(t *testing.T) {
+	const extID = "header-profile-test"
+	defer func() {
+		headerProfilesMu.Lock()
+		delete(extensionHeaderConfigs, extID)
+		headerProfilesMu.Unlock()
+	}()
+
+	req, _ := http.NewRequest("GET", "https://api.example.com/x", nil)
+	applyHeaderProfile(extID, req, extensionHTTPUserAgent)
+	if ua := req.Header.Get("User-Agent"); ua != "Spotiflac-Extension/1.0" {
+		t.Fatalf("default UA = %q", ua)
+	}
+	req, _ = http.NewRequest("GET", "https://api.example.com/x", nil)
+	applyHeaderProfile(extID, req, defaultExtensionUserAgent)
+	if ua := req.Header.Get("User-Agent"); ua != "SpotiFLAC-Extension/1.0" {
+		t.Fatalf("default file UA = %q", ua)
+	}
+
+	err := setExtensionHeaderConfig(extID, ExtensionHeaderConfig{
+		Profile:      "chrome-desktop",
+		HostProfiles: map[string]string{"*.Media.Example.com": "app"},
+		Custom: map[string]HeaderProfile{
+			"app": {UserAgent: "ExampleApp/9.1", Headers: map[string]string{"X-Client-Token": "abc"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("setExtensionHeaderConfig failed: %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", "https://api.example.com/x", nil)
+	req.Header.Set("Accept-Language", "de-DE")
+	applyHeaderProfile(extID, req, extensionHTTPUserAgent)
+	if !strings.Contains(req.Header.Get("User-Agent"), "Chrome/") {
+		t.Errorf("expected chrome UA, got %q", req.Header.Get("User-Agent"))
+	}
+	if req.Header.Get("Accept-Language") != "de-DE" {
+		t.Error("profile overwrote a header set by the extension")
+	}
+
+	req, _ = http.NewRequest("GET", "https://cdn.media.example.com/x", nil)
+	applyHeaderProfile(extID, req, extensionHTTPUserAgent)
+	if req.Header.Get("User-Agent") != "ExampleApp/9.1" || req.Header.Get("X-Client-Token") != "abc" {
+		t.Errorf("host profile not applied: %v", req.Header)
+	}
+}
+
+func TestExtensionHeaderConfigValidate(t *testing.T) {
+	config := ExtensionHeaderConfig{Profile: "netscape"}
+	if err := config.Validate(); err == nil {
+		t.Error("expected unknown profile to fail validation")
+	}
+
+	config = ExtensionHeaderConfig{HostProfiles: map[string]string{"a.com": "missing"}}
+	if err := config.Validate(); err == nil {
+		t.Error("expected unknown host profile to fail validation")
+	}
+
+	config = ExtensionHeaderConfig{}
+	if err := config.Validate(); err != nil || config.Profile != HeaderProfileDefault {
+		t.Errorf("empty config should default, got %q (%v)", config.Profile, err)
+	}
+}
+
+func TestHeaderProfilesPersist(t *testing.T) {
+	const extID = "header-profile-persist"
+	dir := t.TempDir()
+	loadHeaderProfiles(dir)
+	defer loadHeaderProfiles("")
+
+	if err := SetExtensionHeaderConfigJSON(extID, `{"profile":"firefox-desktop","host_profiles":{"API.example.com":"app"},"custom":{"app":{"user_agent":"ExampleApp/2"}}}`); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart reloads the stored configuration.
+	loadHeaderProfiles(dir)
+	config := getExtensionHeaderConfig(extID)
+	if config.Profile != "firefox-desktop" || config.HostProfiles["api.example.com"] != "app" || config.Custom["app"].UserAgent != "ExampleApp/2" {
+		t.Fatalf("reloaded config = %+v", config)
+	}
+
+	if err := forgetExtensionHeaderConfig(extID); err != nil {
+		t.Fatal(err)
+	}
+	loadHeaderProfiles(dir)
+	if config := getExtensionHeaderConfig(extID); config.Profile != HeaderProfileDefault || len(config.Custom) != 0 {
+		t.Errorf("config survived uninstall: %+v", config)
+	}
+}
@@ -1,6 +1,10 @@
 package gobackend
 
 import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -14,6 +18,8 @@ import (
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/andybalholm/brotli"
 )
 
 func getRandomUserAgent() string {
@@ -53,6 +59,7 @@ var sharedTransport = &http.Transport{
 		Timeout:   30 * time.Second,
 		KeepAlive: 30 * time.Second,
 	}).DialContext,
+	Proxy:                 configuredProxy,
 	MaxIdleConns:          100,
 	MaxIdleConnsPerHost:   10,
 	MaxConnsPerHost:       20,
@@ -74,6 +81,7 @@ var metadataTransport = &http.Transport{
 		Timeout:   30 * time.Second,
 		KeepAlive: 30 * time.Second,
 	}).DialContext,
+	Proxy:                 configuredProxy,
 	MaxIdleConns:          30,
 	MaxIdleConnsPerHost:   5,
 	MaxConnsPerHost:       10,
@@ -87,19 +95,74 @@ var metadataTransport = &http.Transport{
 	DisableCompression:    true,
 }
 
+// The transports above are only templates: requests go through the pools,
+// which swap in reconfigured clones when settings change.
+var (
+	sharedPool   = newTransportPool(sharedTransport, false)
+	metadataPool = newTransportPool(metadataTransport, true)
+
+	sharedRoundTripper   = &hostPolicyTransport{pool: sharedPool}
+	metadataRoundTripper = &hostPolicyTransport{pool: metadataPool}
+)
+
+// transportPool is one connection pool: an HTTP/2-capable transport and its
+// HTTP/1.1-only twin for hosts that have HTTP/2 disabled through
+// TransportTuning. A transport is never modified once requests can use it.
+type transportPool struct {
+	mu       sync.RWMutex
+	h2       *http.Transport
+	h1       *http.Transport
+	metadata bool
+}
+
+func newTransportPool(base *http.Transport, metadata bool) *transportPool {
+	return &transportPool{h2: base, h1: newHTTP1Transport(base), metadata: metadata}
+}
+
+func (p *transportPool) transports() (h2, h1 *http.Transport) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.h2, p.h1
+}
+
+// reconfigure lets configure adjust a clone of the pool's transport and swaps
+// it in. Requests already running finish on the old transports, whose idle
+// connections are closed.
+func (p *transportPool) reconfigure(configure func(transport *http.Transport, metadata bool)) {
+	p.mu.Lock()
+	oldH2, oldH1 := p.h2, p.h1
+	h2 := oldH2.Clone()
+	configure(h2, p.metadata)
+	p.h2, p.h1 = h2, newHTTP1Transport(h2)
+	p.mu.Unlock()
+
+	oldH2.CloseIdleConnections()
+	oldH1.CloseIdleConnections()
+}
+
+func (p *transportPool) closeIdleConnections() {
+	h2, h1 := p.transports()
+	h2.CloseIdleConnections()
+	h1.CloseIdleConnections()
+}
+
+func allTransportPools() []*transportPool {
+	return []*transportPool{sharedPool, metadataPool}
+}
+
 var sharedClient = &http.Client{
-	Transport: newCompatibilityTransport(sharedTransport),
+	Transport: newCompatibilityTransport(sharedRoundTripper),
 	Timeout:   DefaultTimeout,
 }
 
 var downloadClient = &http.Client{
-	Transport: newCompatibilityTransport(sharedTransport),
+	Transport: newCompatibilityTransport(sharedRoundTripper),
 	Timeout:   DownloadTimeout,
 }
 
 func NewHTTPClientWithTimeout(timeout time.Duration) *http.Client {
 	return &http.Client{
-		Transport: newCompatibilityTransport(sharedTransport),
+		Transport: newCompatibilityTransport(sharedRoundTripper),
 		Timeout:   timeout,
 	}
 }
@@ -108,22 +171,31 @@ func NewHTTPClientWithTimeout(timeout time.Duration) *http.Client {
 // Use this for API calls that should not be affected by download traffic.
 func NewMetadataHTTPClient(timeout time.Duration) *http.Client {
 	return &http.Client{
-		Transport: newCompatibilityTransport(metadataTransport),
+		Transport: newCompatibilityTransport(metadataRoundTripper),
 		Timeout:   timeout,
 	}
 }
 
+// GetSharedClient and GetDownloadClient honor timeouts from BackendConfig;
+// a fresh client still shares the pooled transport.
 func GetSharedClient() *http.Client {
+	if timeout := GetBackendConfig().HTTPTimeout(); timeout != DefaultTimeout {
+		return NewHTTPClientWithTimeout(timeout)
+	}
 	return sharedClient
 }
 
 func GetDownloadClient() *http.Client {
+	if timeout := GetBackendConfig().DownloadTimeout(); timeout != DownloadTimeout {
+		return NewHTTPClientWithTimeout(timeout)
+	}
 	return downloadClient
 }
 
 func CloseIdleConnections() {
-	sharedTransport.CloseIdleConnections()
-	metadataTransport.CloseIdleConnections()
+	for _, pool := range allTransportPools() {
+		pool.closeIdleConnections()
+	}
 }
 
 func SetNetworkCompatibilityOptions(allowHTTP, insecureTLS bool) {
@@ -134,9 +206,11 @@ func SetNetworkCompatibilityOptions(allowHTTP, insecureTLS bool) {
 	}
 	networkCompatibilityMu.Unlock()
 
-	applyTLSCompatibility(sharedTransport, insecureTLS)
-	applyTLSCompatibility(metadataTransport, insecureTLS)
-	CloseIdleConnections()
+	for _, pool := range allTransportPools() {
+		pool.reconfigure(func(transport *http.Transport, _ bool) {
+			applyTLSCompatibility(transport, insecureTLS)
+		})
+	}
 
 	GoLog("[HTTP] Network compatibility options updated: allow_http=%v insecure_tls=%v\n", allowHTTP, insecureTLS)
 }
@@ -148,12 +222,14 @@ func GetNetworkCompatibilityOptions() NetworkCompatibilityOptions {
 }
 
 func applyTLSCompatibility(transport *http.Transport, insecureTLS bool) {
-	if insecureTLS {
-		cfg := &tls.Config{InsecureSkipVerify: true}
+	sessionCache := currentTLSSessionCache()
+	if insecureTLS || sessionCache != nil {
+		cfg := &tls.Config{}
 		if transport.TLSClientConfig != nil {
 			cfg = transport.TLSClientConfig.Clone()
-			cfg.InsecureSkipVerify = true
 		}
+		cfg.InsecureSkipVerify = insecureTLS
+		cfg.ClientSessionCache = sessionCache
 		transport.TLSClientConfig = cfg
 		return
 	}
@@ -200,6 +276,123 @@ func (t *compatibilityTransport) RoundTrip(req *http.Request) (*http.Response, e
 	return t.base.RoundTrip(fallbackReq)
 }
 
+// extensionAcceptEncoding is advertised for extension requests that do not
+// set Accept-Encoding themselves. Setting it disables net/http's built-in
+// gzip handling, so contentDecodingTransport decodes every encoding.
+const extensionAcceptEncoding = "gzip, deflate, br"
+
+// contentDecodingTransport transparently decodes gzip, deflate and brotli
+// bodies. Extensions often have to send "Accept-Encoding: br" to please a
+// provider, but goja has no way to inflate the result.
+type contentDecodingTransport struct {
+	base http.RoundTripper
+}
+
+func newContentDecodingTransport(base http.RoundTripper) http.RoundTripper {
+	return &contentDecodingTransport{base: base}
+}
+
+func (t *contentDecodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" && req.Method != http.MethodHead {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", extensionAcceptEncoding)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.Uncompressed || resp.Body == nil || resp.Body == http.NoBody {
+		return resp, err
+	}
+	if req.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+
+	var encodings []string
+	for _, enc := range strings.Split(resp.Header.Get("Content-Encoding"), ",") {
+		if enc = strings.ToLower(strings.TrimSpace(enc)); enc != "" && enc != "identity" {
+			encodings = append(encodings, enc)
+		}
+	}
+	if len(encodings) == 0 {
+		return resp, nil
+	}
+
+	body, err := decodeContentEncodings(resp.Body, encodings)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to decode %s response: %w", strings.Join(encodings, ", "), err)
+	}
+	if body == nil {
+		GoLog("[HTTP] Unsupported Content-Encoding %q from %s, passing body through\n", resp.Header.Get("Content-Encoding"), req.URL.Host)
+		return resp, nil
+	}
+
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var firstErr error
+	for _, c := range b.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// decodeContentEncodings undoes encodings in reverse order of application.
+// It returns nil, nil when an encoding is not supported; that is checked
+// before any decoder reads from body, so the caller can pass it through.
+func decodeContentEncodings(body io.ReadCloser, encodings []string) (io.ReadCloser, error) {
+	for _, enc := range encodings {
+		switch enc {
+		case "gzip", "x-gzip", "deflate", "br":
+		default:
+			return nil, nil
+		}
+	}
+
+	decoded := &decodedBody{Reader: body, closers: []io.Closer{body}}
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encodings[i] {
+		case "gzip", "x-gzip":
+			zr, err := gzip.NewReader(decoded.Reader)
+			if err != nil {
+				return nil, err
+			}
+			decoded.Reader = zr
+			decoded.closers = append([]io.Closer{zr}, decoded.closers...)
+		case "deflate":
+			decoded.Reader = newDeflateReader(decoded.Reader)
+		case "br":
+			decoded.Reader = brotli.NewReader(decoded.Reader)
+		}
+	}
+	return decoded, nil
+}
+
+// newDeflateReader handles both zlib-wrapped deflate (what the RFC says) and
+// raw deflate (what many servers actually send).
+func newDeflateReader(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		if zr, err := zlib.NewReader(br); err == nil {
+			return zr
+		}
+	}
+	return flate.NewReader(br)
+}
+
 func canFallbackToHTTP(req *http.Request) bool {
 	if req == nil {
 		return false
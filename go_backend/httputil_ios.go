@@ -9,6 +9,12 @@ import (
 // iOS version: uTLS is not supported on iOS due to cgo DNS resolver issues
 // Fall back to standard HTTP client
 
+// utlsRoundTripper is unavailable on iOS; per-host uTLS settings fall back
+// to the standard transport.
+func utlsRoundTripper() http.RoundTripper {
+	return nil
+}
+
 // GetCloudflareBypassClient returns the standard HTTP client on iOS
 // uTLS is not available on iOS due to cgo DNS resolver compatibility issues
 func GetCloudflareBypassClient() *http.Client {
@@ -0,0 +1,91 @@
+package gobackend
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestContentDecodingTransport(t *testing.T) {
+	const payload = `{"hello":"world"}`
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+		"br": func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	}
+
+	var gotAccept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAccept = r.Header.Get("Accept-Encoding")
+		enc := r.URL.Query().Get("enc")
+		var buf bytes.Buffer
+		zw := encoders[enc](&buf)
+		zw.Write([]byte(payload))
+		zw.Close()
+		w.Header().Set("Content-Encoding", enc)
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newContentDecodingTransport(http.DefaultTransport)}
+	for enc := range encoders {
+		resp, err := client.Get(server.URL + "?enc=" + enc)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", enc, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: read failed: %v", enc, err)
+		}
+		if string(body) != payload {
+			t.Fatalf("%s: got %q, want %q", enc, body, payload)
+		}
+		if resp.Header.Get("Content-Encoding") != "" {
+			t.Fatalf("%s: Content-Encoding should be removed after decoding", enc)
+		}
+		if gotAccept != extensionAcceptEncoding {
+			t.Fatalf("%s: expected default Accept-Encoding, got %q", enc, gotAccept)
+		}
+	}
+}
+
+func TestContentDecodingTransportPassesThroughUnsupportedEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("payload"))
+	zw.Close()
+	encoded := buf.Bytes()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "zstd, gzip")
+		w.Write(encoded)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newContentDecodingTransport(http.DefaultTransport)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(body, encoded) {
+		t.Fatalf("unsupported encoding should leave the body untouched, got %d bytes, want %d", len(body), len(encoded))
+	}
+	if resp.Header.Get("Content-Encoding") != "zstd, gzip" {
+		t.Fatalf("Content-Encoding should be kept, got %q", resp.Header.Get("Content-Encoding"))
+	}
+}
@@ -36,7 +36,8 @@ func newUTLSTransport() *utlsTransport {
 
 func (t *utlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	if req.URL.Scheme != "https" {
-		return sharedTransport.RoundTrip(req)
+		h2, _ := sharedPool.transports()
+		return h2.RoundTrip(req)
 	}
 
 	host := req.URL.Hostname()
@@ -99,6 +100,12 @@ var cloudflareBypassClient = &http.Client{
 	Timeout:   DefaultTimeout,
 }
 
+// utlsRoundTripper is used for hosts opted into the uTLS fingerprint via
+// TransportTuning or an extension manifest.
+func utlsRoundTripper() http.RoundTripper {
+	return cloudflareBypassTransport
+}
+
 // GetCloudflareBypassClient returns an HTTP client that mimics Chrome's TLS fingerprint
 // Use this when requests are blocked by Cloudflare (common when using VPN)
 func GetCloudflareBypassClient() *http.Client {
@@ -0,0 +1,220 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ==================== Localized messages ====================
+//
+// Responses keep their English Error text and their structured ErrorType;
+// alongside them the backend fills localized_error / localized_message from
+// the catalog in i18n_catalog.go, keyed by the same codes:
+//
+//	error.<error_type>    download and stream error types, API error codes
+//	status.<name>         status lines such as status.download_complete
+//
+// A message is either a single form or CLDR plural forms ("one", "few",
+// "many", "other") chosen by the {count} argument. Lookups fall back from
+// the active locale to its base language and then to English.
+
+const defaultLocale = "en"
+
+type pluralForms map[string]string
+
+var (
+	localeMu      sync.RWMutex
+	currentLocale = defaultLocale
+)
+
+// normalizeLocaleTag turns "pt_BR", "PT-br" or "zh-Hant-TW" into BCP 47
+// casing: language lower case, region upper case.
+func normalizeLocaleTag(tag string) string {
+	parts := strings.FieldsFunc(strings.TrimSpace(tag), func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) == 0 {
+		return ""
+	}
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func localeLanguage(tag string) string {
+	lang, _, _ := strings.Cut(tag, "-")
+	return lang
+}
+
+// SetLocale selects the language of localized messages. Tags without a
+// catalog are rejected so the UI can tell the user; "" resets to English.
+func SetLocale(tag string) error {
+	tag = normalizeLocaleTag(tag)
+	if tag == "" {
+		tag = defaultLocale
+	}
+	if _, ok := messageCatalog[tag]; !ok {
+		if _, ok := messageCatalog[localeLanguage(tag)]; !ok {
+			return fmt.Errorf("unsupported locale: %s", tag)
+		}
+	}
+	localeMu.Lock()
+	currentLocale = tag
+	localeMu.Unlock()
+	GoLog("[I18n] Locale set to %s\n", tag)
+	return nil
+}
+
+func GetLocale() string {
+	localeMu.RLock()
+	defer localeMu.RUnlock()
+	return currentLocale
+}
+
+// SupportedLocales lists the languages with a message catalog.
+func SupportedLocales() []string {
+	locales := make([]string, 0, len(messageCatalog))
+	for tag := range messageCatalog {
+		locales = append(locales, tag)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// pluralCategory implements the CLDR cardinal rules for integer counts in
+// the catalog's languages.
+func pluralCategory(tag string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	switch localeLanguage(tag) {
+	case "ja", "ko", "zh", "id":
+		return "other"
+	case "fr", "hi":
+		if n <= 1 {
+			return "one"
+		}
+	case "pt":
+		// Brazilian Portuguese treats 0 as singular, European does not.
+		if n == 1 || n == 0 && tag != "pt-PT" {
+			return "one"
+		}
+	case "ru":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+func lookupMessage(tag, key string) pluralForms {
+	for _, candidate := range []string{tag, localeLanguage(tag), defaultLocale} {
+		if forms, ok := messageCatalog[candidate][key]; ok {
+			return forms
+		}
+	}
+	return nil
+}
+
+// Localize renders key in the active locale. args fill {name} placeholders;
+// a "count" argument also selects the plural form. Unknown keys return "".
+func Localize(key string, args map[string]interface{}) string {
+	return localizeIn(GetLocale(), key, args)
+}
+
+func localizeIn(tag, key string, args map[string]interface{}) string {
+	forms := lookupMessage(tag, key)
+	if forms == nil {
+		return ""
+	}
+
+	text := forms["other"]
+	if count, ok := args["count"]; ok {
+		n, _ := strconv.Atoi(fmt.Sprint(count))
+		if form, ok := forms[pluralCategory(tag, n)]; ok {
+			text = form
+		}
+	}
+	if text == "" {
+		text = forms["one"]
+	}
+
+	for name, value := range args {
+		text = strings.ReplaceAll(text, "{"+name+"}", fmt.Sprint(value))
+	}
+	return text
+}
+
+// LocalizeJSON is Localize for Flutter, with args as a JSON object.
+func LocalizeJSON(key, argsJSON string) (string, error) {
+	var args map[string]interface{}
+	if strings.TrimSpace(argsJSON) != "" {
+		decoder := json.NewDecoder(strings.NewReader(argsJSON))
+		decoder.UseNumber()
+		if err := decoder.Decode(&args); err != nil {
+			return "", fmt.Errorf("invalid args: %w", err)
+		}
+	}
+	text := Localize(key, args)
+	if text == "" {
+		return "", fmt.Errorf("unknown message: %s", key)
+	}
+	return text, nil
+}
+
+// localizedError returns the message for an error code. Codes without one,
+// such as unknown_method, get the generic "something went wrong" text.
+func localizedError(code string) string {
+	if code == "internal_error" {
+		code = "internal"
+	}
+	if text := Localize("error."+code, nil); text != "" {
+		return text
+	}
+	return Localize("error.internal", nil)
+}
+
+// localizeDownloadResponseJSON adds localized_error or localized_message to
+// a DownloadResponse. Fields are patched in place so keys DownloadResponse
+// does not declare survive.
+func localizeDownloadResponseJSON(respJSON string) string {
+	var resp DownloadResponse
+	var fields map[string]json.RawMessage
+	if json.Unmarshal([]byte(respJSON), &resp) != nil || json.Unmarshal([]byte(respJSON), &fields) != nil {
+		return respJSON
+	}
+	key, text := "localized_message", ""
+	switch {
+	case !resp.Success:
+		key, text = "localized_error", localizedError(firstNonEmpty(resp.ErrorType, "unknown"))
+	case resp.AlreadyExists || strings.HasPrefix(resp.FilePath, "EXISTS:"):
+		text = Localize("status.already_exists", nil)
+	default:
+		text = Localize("status.download_complete", nil)
+	}
+	encoded, _ := json.Marshal(text)
+	fields[key] = encoded
+	jsonBytes, err := json.Marshal(fields)
+	if err != nil {
+		return respJSON
+	}
+	return string(jsonBytes)
+}
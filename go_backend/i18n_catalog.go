@@ -0,0 +1,343 @@
+package gobackend
+
+// messageCatalog holds the backend's user-facing strings per language, for
+// the locales the app ships (lib/l10n). English is the fallback and must
+// define every key.
+var messageCatalog = map[string]map[string]pluralForms{
+	"en": {
+		"error.unknown":             {"other": "Download failed"},
+		"error.cancelled":           {"other": "Download cancelled"},
+		"error.not_found":           {"other": "Track not found on any service"},
+		"error.rate_limit":          {"other": "Too many requests. Wait a moment and try again"},
+		"error.network":             {"other": "Network error. Check your connection"},
+		"error.timeout":             {"other": "The request timed out"},
+		"error.isp_blocked":         {"other": "The service seems blocked by your provider. Try a VPN or another DNS"},
+		"error.permission":          {"other": "No permission to write to the download folder"},
+		"error.extension_error":     {"other": "The extension could not download this track"},
+		"error.invalid_request":     {"other": "Invalid download request"},
+		"error.not_implemented":     {"other": "Not supported by this provider"},
+		"error.encrypted_stream":    {"other": "This stream is encrypted and cannot be saved"},
+		"error.dash_proxy_required": {"other": "This stream needs the streaming proxy"},
+		"error.resolve_failed":      {"other": "Could not find a stream for this track"},
+		"error.oversize":            {"other": "The file is too large"},
+		"error.locked":              {"other": "Credentials are locked. Unlock to continue"},
+		"error.internal":            {"other": "Something went wrong"},
+		"status.download_complete":  {"other": "Download complete"},
+		"status.already_exists":     {"other": "Already in your library"},
+		"status.tracks_downloaded":  {"one": "{count} track downloaded", "other": "{count} tracks downloaded"},
+		"status.tracks_failed":      {"one": "{count} download failed", "other": "{count} downloads failed"},
+		"status.tracks_remaining":   {"one": "{count} track remaining", "other": "{count} tracks remaining"},
+	},
+	"de": {
+		"error.unknown":             {"other": "Download fehlgeschlagen"},
+		"error.cancelled":           {"other": "Download abgebrochen"},
+		"error.not_found":           {"other": "Titel bei keinem Dienst gefunden"},
+		"error.rate_limit":          {"other": "Zu viele Anfragen. Bitte warte einen Moment"},
+		"error.network":             {"other": "Netzwerkfehler. Prüfe deine Verbindung"},
+		"error.timeout":             {"other": "Zeitüberschreitung der Anfrage"},
+		"error.isp_blocked":         {"other": "Der Dienst scheint von deinem Anbieter blockiert zu sein. Versuche ein VPN oder einen anderen DNS"},
+		"error.permission":          {"other": "Keine Schreibberechtigung für den Download-Ordner"},
+		"error.extension_error":     {"other": "Die Erweiterung konnte diesen Titel nicht herunterladen"},
+		"error.invalid_request":     {"other": "Ungültige Download-Anfrage"},
+		"error.not_implemented":     {"other": "Von diesem Anbieter nicht unterstützt"},
+		"error.encrypted_stream":    {"other": "Dieser Stream ist verschlüsselt und kann nicht gespeichert werden"},
+		"error.dash_proxy_required": {"other": "Dieser Stream benötigt den Streaming-Proxy"},
+		"error.resolve_failed":      {"other": "Kein Stream für diesen Titel gefunden"},
+		"error.oversize":            {"other": "Die Datei ist zu groß"},
+		"error.locked":              {"other": "Zugangsdaten sind gesperrt. Zum Fortfahren entsperren"},
+		"error.internal":            {"other": "Etwas ist schiefgelaufen"},
+		"status.download_complete":  {"other": "Download abgeschlossen"},
+		"status.already_exists":     {"other": "Bereits in deiner Bibliothek"},
+		"status.tracks_downloaded":  {"one": "{count} Titel heruntergeladen", "other": "{count} Titel heruntergeladen"},
+		"status.tracks_failed":      {"one": "{count} Download fehlgeschlagen", "other": "{count} Downloads fehlgeschlagen"},
+		"status.tracks_remaining":   {"one": "{count} Titel verbleibend", "other": "{count} Titel verbleibend"},
+	},
+	"es": {
+		"error.unknown":             {"other": "Error en la descarga"},
+		"error.cancelled":           {"other": "Descarga cancelada"},
+		"error.not_found":           {"other": "No se encontró la canción en ningún servicio"},
+		"error.rate_limit":          {"other": "Demasiadas solicitudes. Espera un momento e inténtalo de nuevo"},
+		"error.network":             {"other": "Error de red. Comprueba tu conexión"},
+		"error.timeout":             {"other": "La solicitud agotó el tiempo de espera"},
+		"error.isp_blocked":         {"other": "Tu proveedor parece bloquear el servicio. Prueba una VPN u otro DNS"},
+		"error.permission":          {"other": "Sin permiso para escribir en la carpeta de descargas"},
+		"error.extension_error":     {"other": "La extensión no pudo descargar esta canción"},
+		"error.invalid_request":     {"other": "Solicitud de descarga no válida"},
+		"error.not_implemented":     {"other": "Este proveedor no lo admite"},
+		"error.encrypted_stream":    {"other": "Esta transmisión está cifrada y no se puede guardar"},
+		"error.dash_proxy_required": {"other": "Esta transmisión necesita el proxy de streaming"},
+		"error.resolve_failed":      {"other": "No se encontró una transmisión para esta canción"},
+		"error.oversize":            {"other": "El archivo es demasiado grande"},
+		"error.locked":              {"other": "Las credenciales están bloqueadas. Desbloquéalas para continuar"},
+		"error.internal":            {"other": "Algo salió mal"},
+		"status.download_complete":  {"other": "Descarga completada"},
+		"status.already_exists":     {"other": "Ya está en tu biblioteca"},
+		"status.tracks_downloaded":  {"one": "{count} canción descargada", "other": "{count} canciones descargadas"},
+		"status.tracks_failed":      {"one": "{count} descarga fallida", "other": "{count} descargas fallidas"},
+		"status.tracks_remaining":   {"one": "Queda {count} canción", "other": "Quedan {count} canciones"},
+	},
+	"fr": {
+		"error.unknown":             {"other": "Échec du téléchargement"},
+		"error.cancelled":           {"other": "Téléchargement annulé"},
+		"error.not_found":           {"other": "Titre introuvable sur tous les services"},
+		"error.rate_limit":          {"other": "Trop de requêtes. Patientez un instant puis réessayez"},
+		"error.network":             {"other": "Erreur réseau. Vérifiez votre connexion"},
+		"error.timeout":             {"other": "La requête a expiré"},
+		"error.isp_blocked":         {"other": "Le service semble bloqué par votre fournisseur. Essayez un VPN ou un autre DNS"},
+		"error.permission":          {"other": "Impossible d'écrire dans le dossier de téléchargement"},
+		"error.extension_error":     {"other": "L'extension n'a pas pu télécharger ce titre"},
+		"error.invalid_request":     {"other": "Requête de téléchargement invalide"},
+		"error.not_implemented":     {"other": "Non pris en charge par ce fournisseur"},
+		"error.encrypted_stream":    {"other": "Ce flux est chiffré et ne peut pas être enregistré"},
+		"error.dash_proxy_required": {"other": "Ce flux nécessite le proxy de streaming"},
+		"error.resolve_failed":      {"other": "Aucun flux trouvé pour ce titre"},
+		"error.oversize":            {"other": "Le fichier est trop volumineux"},
+		"error.locked":              {"other": "Les identifiants sont verrouillés. Déverrouillez pour continuer"},
+		"error.internal":            {"other": "Une erreur s'est produite"},
+		"status.download_complete":  {"other": "Téléchargement terminé"},
+		"status.already_exists":     {"other": "Déjà dans votre bibliothèque"},
+		"status.tracks_downloaded":  {"one": "{count} titre téléchargé", "other": "{count} titres téléchargés"},
+		"status.tracks_failed":      {"one": "{count} téléchargement échoué", "other": "{count} téléchargements échoués"},
+		"status.tracks_remaining":   {"one": "{count} titre restant", "other": "{count} titres restants"},
+	},
+	"pt": {
+		"error.unknown":             {"other": "Falha no download"},
+		"error.cancelled":           {"other": "Download cancelado"},
+		"error.not_found":           {"other": "Faixa não encontrada em nenhum serviço"},
+		"error.rate_limit":          {"other": "Muitas solicitações. Aguarde um momento e tente novamente"},
+		"error.network":             {"other": "Erro de rede. Verifique sua conexão"},
+		"error.timeout":             {"other": "A solicitação expirou"},
+		"error.isp_blocked":         {"other": "O serviço parece bloqueado pelo seu provedor. Tente uma VPN ou outro DNS"},
+		"error.permission":          {"other": "Sem permissão para gravar na pasta de downloads"},
+		"error.extension_error":     {"other": "A extensão não conseguiu baixar esta faixa"},
+		"error.invalid_request":     {"other": "Solicitação de download inválida"},
+		"error.not_implemented":     {"other": "Não suportado por este provedor"},
+		"error.encrypted_stream":    {"other": "Este stream é criptografado e não pode ser salvo"},
+		"error.dash_proxy_required": {"other": "Este stream precisa do proxy de streaming"},
+		"error.resolve_failed":      {"other": "Nenhum stream encontrado para esta faixa"},
+		"error.oversize":            {"other": "O arquivo é grande demais"},
+		"error.locked":              {"other": "As credenciais estão bloqueadas. Desbloqueie para continuar"},
+		"error.internal":            {"other": "Algo deu errado"},
+		"status.download_complete":  {"other": "Download concluído"},
+		"status.already_exists":     {"other": "Já está na sua biblioteca"},
+		"status.tracks_downloaded":  {"one": "{count} faixa baixada", "other": "{count} faixas baixadas"},
+		"status.tracks_failed":      {"one": "{count} download falhou", "other": "{count} downloads falharam"},
+		"status.tracks_remaining":   {"one": "{count} faixa restante", "other": "{count} faixas restantes"},
+	},
+	"nl": {
+		"error.unknown":             {"other": "Download mislukt"},
+		"error.cancelled":           {"other": "Download geannuleerd"},
+		"error.not_found":           {"other": "Nummer bij geen enkele dienst gevonden"},
+		"error.rate_limit":          {"other": "Te veel verzoeken. Wacht even en probeer het opnieuw"},
+		"error.network":             {"other": "Netwerkfout. Controleer je verbinding"},
+		"error.timeout":             {"other": "Er is een time-out opgetreden"},
+		"error.isp_blocked":         {"other": "De dienst lijkt door je provider geblokkeerd. Probeer een VPN of andere DNS"},
+		"error.permission":          {"other": "Geen toestemming om naar de downloadmap te schrijven"},
+		"error.extension_error":     {"other": "De extensie kon dit nummer niet downloaden"},
+		"error.invalid_request":     {"other": "Ongeldig downloadverzoek"},
+		"error.not_implemented":     {"other": "Niet ondersteund door deze provider"},
+		"error.encrypted_stream":    {"other": "Deze stream is versleuteld en kan niet worden opgeslagen"},
+		"error.dash_proxy_required": {"other": "Deze stream heeft de streamingproxy nodig"},
+		"error.resolve_failed":      {"other": "Geen stream gevonden voor dit nummer"},
+		"error.oversize":            {"other": "Het bestand is te groot"},
+		"error.locked":              {"other": "Inloggegevens zijn vergrendeld. Ontgrendel om door te gaan"},
+		"error.internal":            {"other": "Er is iets misgegaan"},
+		"status.download_complete":  {"other": "Download voltooid"},
+		"status.already_exists":     {"other": "Staat al in je bibliotheek"},
+		"status.tracks_downloaded":  {"one": "{count} nummer gedownload", "other": "{count} nummers gedownload"},
+		"status.tracks_failed":      {"one": "{count} download mislukt", "other": "{count} downloads mislukt"},
+		"status.tracks_remaining":   {"one": "Nog {count} nummer", "other": "Nog {count} nummers"},
+	},
+	"ru": {
+		"error.unknown":             {"other": "Ошибка загрузки"},
+		"error.cancelled":           {"other": "Загрузка отменена"},
+		"error.not_found":           {"other": "Трек не найден ни в одном сервисе"},
+		"error.rate_limit":          {"other": "Слишком много запросов. Подождите немного и повторите"},
+		"error.network":             {"other": "Ошибка сети. Проверьте подключение"},
+		"error.timeout":             {"other": "Время ожидания запроса истекло"},
+		"error.isp_blocked":         {"other": "Похоже, сервис заблокирован провайдером. Попробуйте VPN или другой DNS"},
+		"error.permission":          {"other": "Нет доступа на запись в папку загрузок"},
+		"error.extension_error":     {"other": "Расширению не удалось загрузить этот трек"},
+		"error.invalid_request":     {"other": "Неверный запрос на загрузку"},
+		"error.not_implemented":     {"other": "Не поддерживается этим провайдером"},
+		"error.encrypted_stream":    {"other": "Поток зашифрован и не может быть сохранён"},
+		"error.dash_proxy_required": {"other": "Для этого потока нужен стриминг-прокси"},
+		"error.resolve_failed":      {"other": "Не удалось найти поток для этого трека"},
+		"error.oversize":            {"other": "Файл слишком большой"},
+		"error.locked":              {"other": "Учётные данные заблокированы. Разблокируйте, чтобы продолжить"},
+		"error.internal":            {"other": "Что-то пошло не так"},
+		"status.download_complete":  {"other": "Загрузка завершена"},
+		"status.already_exists":     {"other": "Уже в вашей библиотеке"},
+		"status.tracks_downloaded":  {"one": "Загружен {count} трек", "few": "Загружено {count} трека", "many": "Загружено {count} треков", "other": "Загружено {count} трека"},
+		"status.tracks_failed":      {"one": "{count} загрузка не удалась", "few": "{count} загрузки не удались", "many": "{count} загрузок не удалось", "other": "{count} загрузки не удались"},
+		"status.tracks_remaining":   {"one": "Остался {count} трек", "few": "Осталось {count} трека", "many": "Осталось {count} треков", "other": "Осталось {count} трека"},
+	},
+	"tr": {
+		"error.unknown":             {"other": "İndirme başarısız"},
+		"error.cancelled":           {"other": "İndirme iptal edildi"},
+		"error.not_found":           {"other": "Parça hiçbir serviste bulunamadı"},
+		"error.rate_limit":          {"other": "Çok fazla istek. Biraz bekleyip tekrar deneyin"},
+		"error.network":             {"other": "Ağ hatası. Bağlantınızı kontrol edin"},
+		"error.timeout":             {"other": "İstek zaman aşımına uğradı"},
+		"error.isp_blocked":         {"other": "Servis sağlayıcınız tarafından engellenmiş görünüyor. VPN veya farklı bir DNS deneyin"},
+		"error.permission":          {"other": "İndirme klasörüne yazma izni yok"},
+		"error.extension_error":     {"other": "Eklenti bu parçayı indiremedi"},
+		"error.invalid_request":     {"other": "Geçersiz indirme isteği"},
+		"error.not_implemented":     {"other": "Bu sağlayıcı tarafından desteklenmiyor"},
+		"error.encrypted_stream":    {"other": "Bu akış şifreli ve kaydedilemez"},
+		"error.dash_proxy_required": {"other": "Bu akış için akış proxy'si gerekli"},
+		"error.resolve_failed":      {"other": "Bu parça için akış bulunamadı"},
+		"error.oversize":            {"other": "Dosya çok büyük"},
+		"error.locked":              {"other": "Kimlik bilgileri kilitli. Devam etmek için kilidi açın"},
+		"error.internal":            {"other": "Bir şeyler ters gitti"},
+		"status.download_complete":  {"other": "İndirme tamamlandı"},
+		"status.already_exists":     {"other": "Zaten kitaplığınızda"},
+		"status.tracks_downloaded":  {"one": "{count} parça indirildi", "other": "{count} parça indirildi"},
+		"status.tracks_failed":      {"one": "{count} indirme başarısız", "other": "{count} indirme başarısız"},
+		"status.tracks_remaining":   {"one": "{count} parça kaldı", "other": "{count} parça kaldı"},
+	},
+	"id": {
+		"error.unknown":             {"other": "Unduhan gagal"},
+		"error.cancelled":           {"other": "Unduhan dibatalkan"},
+		"error.not_found":           {"other": "Lagu tidak ditemukan di layanan mana pun"},
+		"error.rate_limit":          {"other": "Terlalu banyak permintaan. Tunggu sebentar lalu coba lagi"},
+		"error.network":             {"other": "Kesalahan jaringan. Periksa koneksi Anda"},
+		"error.timeout":             {"other": "Permintaan kehabisan waktu"},
+		"error.isp_blocked":         {"other": "Layanan tampaknya diblokir oleh penyedia Anda. Coba VPN atau DNS lain"},
+		"error.permission":          {"other": "Tidak ada izin menulis ke folder unduhan"},
+		"error.extension_error":     {"other": "Ekstensi tidak dapat mengunduh lagu ini"},
+		"error.invalid_request":     {"other": "Permintaan unduhan tidak valid"},
+		"error.not_implemented":     {"other": "Tidak didukung oleh penyedia ini"},
+		"error.encrypted_stream":    {"other": "Stream ini terenkripsi dan tidak dapat disimpan"},
+		"error.dash_proxy_required": {"other": "Stream ini memerlukan proxy streaming"},
+		"error.resolve_failed":      {"other": "Tidak ada stream untuk lagu ini"},
+		"error.oversize":            {"other": "Berkas terlalu besar"},
+		"error.locked":              {"other": "Kredensial terkunci. Buka kunci untuk melanjutkan"},
+		"error.internal":            {"other": "Terjadi kesalahan"},
+		"status.download_complete":  {"other": "Unduhan selesai"},
+		"status.already_exists":     {"other": "Sudah ada di pustaka Anda"},
+		"status.tracks_downloaded":  {"other": "{count} lagu diunduh"},
+		"status.tracks_failed":      {"other": "{count} unduhan gagal"},
+		"status.tracks_remaining":   {"other": "{count} lagu tersisa"},
+	},
+	"hi": {
+		"error.unknown":             {"other": "डाउनलोड विफल रहा"},
+		"error.cancelled":           {"other": "डाउनलोड रद्द किया गया"},
+		"error.not_found":           {"other": "ट्रैक किसी भी सेवा पर नहीं मिला"},
+		"error.rate_limit":          {"other": "बहुत अधिक अनुरोध। कुछ देर रुककर फिर कोशिश करें"},
+		"error.network":             {"other": "नेटवर्क त्रुटि। अपना कनेक्शन जाँचें"},
+		"error.timeout":             {"other": "अनुरोध का समय समाप्त हो गया"},
+		"error.isp_blocked":         {"other": "लगता है आपके प्रदाता ने सेवा को ब्लॉक किया है। VPN या दूसरा DNS आज़माएँ"},
+		"error.permission":          {"other": "डाउनलोड फ़ोल्डर में लिखने की अनुमति नहीं है"},
+		"error.extension_error":     {"other": "एक्सटेंशन यह ट्रैक डाउनलोड नहीं कर सका"},
+		"error.invalid_request":     {"other": "अमान्य डाउनलोड अनुरोध"},
+		"error.not_implemented":     {"other": "यह प्रदाता इसका समर्थन नहीं करता"},
+		"error.encrypted_stream":    {"other": "यह स्ट्रीम एन्क्रिप्टेड है और सहेजी नहीं जा सकती"},
+		"error.dash_proxy_required": {"other": "इस स्ट्रीम के लिए स्ट्रीमिंग प्रॉक्सी चाहिए"},
+		"error.resolve_failed":      {"other": "इस ट्रैक के लिए कोई स्ट्रीम नहीं मिली"},
+		"error.oversize":            {"other": "फ़ाइल बहुत बड़ी है"},
+		"error.locked":              {"other": "क्रेडेंशियल लॉक हैं। जारी रखने के लिए अनलॉक करें"},
+		"error.internal":            {"other": "कुछ गलत हो गया"},
+		"status.download_complete":  {"other": "डाउनलोड पूरा हुआ"},
+		"status.already_exists":     {"other": "पहले से आपकी लाइब्रेरी में है"},
+		"status.tracks_downloaded":  {"one": "{count} ट्रैक डाउनलोड हुआ", "other": "{count} ट्रैक डाउनलोड हुए"},
+		"status.tracks_failed":      {"one": "{count} डाउनलोड विफल", "other": "{count} डाउनलोड विफल"},
+		"status.tracks_remaining":   {"one": "{count} ट्रैक बाकी", "other": "{count} ट्रैक बाकी"},
+	},
+	"ja": {
+		"error.unknown":             {"other": "ダウンロードに失敗しました"},
+		"error.cancelled":           {"other": "ダウンロードをキャンセルしました"},
+		"error.not_found":           {"other": "どのサービスでもトラックが見つかりません"},
+		"error.rate_limit":          {"other": "リクエストが多すぎます。しばらく待ってから再試行してください"},
+		"error.network":             {"other": "ネットワークエラー。接続を確認してください"},
+		"error.timeout":             {"other": "リクエストがタイムアウトしました"},
+		"error.isp_blocked":         {"other": "プロバイダーによってブロックされているようです。VPN または別の DNS をお試しください"},
+		"error.permission":          {"other": "ダウンロードフォルダーへの書き込み権限がありません"},
+		"error.extension_error":     {"other": "拡張機能がこのトラックをダウンロードできませんでした"},
+		"error.invalid_request":     {"other": "無効なダウンロードリクエストです"},
+		"error.not_implemented":     {"other": "このプロバイダーではサポートされていません"},
+		"error.encrypted_stream":    {"other": "このストリームは暗号化されているため保存できません"},
+		"error.dash_proxy_required": {"other": "このストリームにはストリーミングプロキシが必要です"},
+		"error.resolve_failed":      {"other": "このトラックのストリームが見つかりません"},
+		"error.oversize":            {"other": "ファイルが大きすぎます"},
+		"error.locked":              {"other": "認証情報がロックされています。続行するにはロックを解除してください"},
+		"error.internal":            {"other": "問題が発生しました"},
+		"status.download_complete":  {"other": "ダウンロード完了"},
+		"status.already_exists":     {"other": "すでにライブラリにあります"},
+		"status.tracks_downloaded":  {"other": "{count} 曲をダウンロードしました"},
+		"status.tracks_failed":      {"other": "{count} 件のダウンロードに失敗しました"},
+		"status.tracks_remaining":   {"other": "残り {count} 曲"},
+	},
+	"ko": {
+		"error.unknown":             {"other": "다운로드 실패"},
+		"error.cancelled":           {"other": "다운로드가 취소되었습니다"},
+		"error.not_found":           {"other": "어떤 서비스에서도 트랙을 찾을 수 없습니다"},
+		"error.rate_limit":          {"other": "요청이 너무 많습니다. 잠시 후 다시 시도하세요"},
+		"error.network":             {"other": "네트워크 오류. 연결을 확인하세요"},
+		"error.timeout":             {"other": "요청 시간이 초과되었습니다"},
+		"error.isp_blocked":         {"other": "통신사에서 서비스를 차단한 것 같습니다. VPN이나 다른 DNS를 사용해 보세요"},
+		"error.permission":          {"other": "다운로드 폴더에 쓸 권한이 없습니다"},
+		"error.extension_error":     {"other": "확장 프로그램이 이 트랙을 다운로드하지 못했습니다"},
+		"error.invalid_request":     {"other": "잘못된 다운로드 요청입니다"},
+		"error.not_implemented":     {"other": "이 제공자는 지원하지 않습니다"},
+		"error.encrypted_stream":    {"other": "암호화된 스트림이라 저장할 수 없습니다"},
+		"error.dash_proxy_required": {"other": "이 스트림에는 스트리밍 프록시가 필요합니다"},
+		"error.resolve_failed":      {"other": "이 트랙의 스트림을 찾을 수 없습니다"},
+		"error.oversize":            {"other": "파일이 너무 큽니다"},
+		"error.locked":              {"other": "자격 증명이 잠겨 있습니다. 계속하려면 잠금을 해제하세요"},
+		"error.internal":            {"other": "문제가 발생했습니다"},
+		"status.download_complete":  {"other": "다운로드 완료"},
+		"status.already_exists":     {"other": "이미 라이브러리에 있습니다"},
+		"status.tracks_downloaded":  {"other": "{count}곡 다운로드됨"},
+		"status.tracks_failed":      {"other": "{count}개 다운로드 실패"},
+		"status.tracks_remaining":   {"other": "{count}곡 남음"},
+	},
+	"zh": {
+		"error.unknown":             {"other": "下载失败"},
+		"error.cancelled":           {"other": "下载已取消"},
+		"error.not_found":           {"other": "在所有服务中都未找到该曲目"},
+		"error.rate_limit":          {"other": "请求过多，请稍后再试"},
+		"error.network":             {"other": "网络错误，请检查网络连接"},
+		"error.timeout":             {"other": "请求超时"},
+		"error.isp_blocked":         {"other": "该服务似乎被您的网络运营商屏蔽，请尝试 VPN 或更换 DNS"},
+		"error.permission":          {"other": "没有写入下载文件夹的权限"},
+		"error.extension_error":     {"other": "扩展无法下载此曲目"},
+		"error.invalid_request":     {"other": "无效的下载请求"},
+		"error.not_implemented":     {"other": "此提供方不支持该操作"},
+		"error.encrypted_stream":    {"other": "此音频流已加密，无法保存"},
+		"error.dash_proxy_required": {"other": "此音频流需要流媒体代理"},
+		"error.resolve_failed":      {"other": "未找到此曲目的音频流"},
+		"error.oversize":            {"other": "文件过大"},
+		"error.locked":              {"other": "凭据已锁定，请解锁后继续"},
+		"error.internal":            {"other": "出现问题"},
+		"status.download_complete":  {"other": "下载完成"},
+		"status.already_exists":     {"other": "已在您的音乐库中"},
+		"status.tracks_downloaded":  {"other": "已下载 {count} 首曲目"},
+		"status.tracks_failed":      {"other": "{count} 个下载失败"},
+		"status.tracks_remaining":   {"other": "剩余 {count} 首曲目"},
+	},
+	"zh-TW": {
+		"error.unknown":             {"other": "下載失敗"},
+		"error.cancelled":           {"other": "下載已取消"},
+		"error.not_found":           {"other": "在所有服務中都找不到此曲目"},
+		"error.rate_limit":          {"other": "請求過多，請稍後再試"},
+		"error.network":             {"other": "網路錯誤，請檢查連線"},
+		"error.timeout":             {"other": "請求逾時"},
+		"error.isp_blocked":         {"other": "此服務似乎遭到您的網路業者封鎖，請嘗試 VPN 或其他 DNS"},
+		"error.permission":          {"other": "沒有寫入下載資料夾的權限"},
+		"error.extension_error":     {"other": "擴充功能無法下載此曲目"},
+		"error.invalid_request":     {"other": "無效的下載請求"},
+		"error.not_implemented":     {"other": "此提供者不支援"},
+		"error.encrypted_stream":    {"other": "此串流已加密，無法儲存"},
+		"error.dash_proxy_required": {"other": "此串流需要串流代理"},
+		"error.resolve_failed":      {"other": "找不到此曲目的串流"},
+		"error.oversize":            {"other": "檔案過大"},
+		"error.locked":              {"other": "憑證已鎖定，請解鎖後繼續"},
+		"error.internal":            {"other": "發生問題"},
+		"status.download_complete":  {"other": "下載完成"},
+		"status.already_exists":     {"other": "已在您的音樂庫中"},
+		"status.tracks_downloaded":  {"other": "已下載 {count} 首曲目"},
+		"status.tracks_failed":      {"other": "{count} 個下載失敗"},
+		"status.tracks_remaining":   {"other": "剩餘 {count} 首曲目"},
+	},
+}
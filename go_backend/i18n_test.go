@@ -0,0 +1,114 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func withLocale(t *testing.T, tag string) {
+	t.Helper()
+	prev := GetLocale()
+	if err := SetLocale(tag); err != nil {
+		t.Fatalf("SetLocale(%q): %v", tag, err)
+	}
+	t.Cleanup(func() { SetLocale(prev) })
+}
+
+func TestPluralCategory(t *testing.T) {
+	cases := []struct {
+		tag  string
+		n    int
+		want string
+	}{
+		{"en", 0, "other"},
+		{"en", 1, "one"},
+		{"en", 2, "other"},
+		{"fr", 0, "one"},
+		{"fr", 2, "other"},
+		{"pt", 0, "one"},
+		{"pt-PT", 0, "other"},
+		{"ja", 1, "other"},
+		{"ru", 1, "one"},
+		{"ru", 3, "few"},
+		{"ru", 5, "many"},
+		{"ru", 11, "many"},
+		{"ru", 21, "one"},
+		{"ru", 22, "few"},
+		{"ru", 112, "many"},
+	}
+	for _, c := range cases {
+		if got := pluralCategory(c.tag, c.n); got != c.want {
+			t.Errorf("pluralCategory(%s, %d) = %s, want %s", c.tag, c.n, got, c.want)
+		}
+	}
+}
+
+func TestLocalizePlurals(t *testing.T) {
+	withLocale(t, "ru")
+	if got := Localize("status.tracks_downloaded", map[string]interface{}{"count": 5}); got != "Загружено 5 треков" {
+		t.Errorf("ru 5 = %q", got)
+	}
+	if got := Localize("status.tracks_downloaded", map[string]interface{}{"count": 21}); got != "Загружен 21 трек" {
+		t.Errorf("ru 21 = %q", got)
+	}
+
+	withLocale(t, "en")
+	if got, err := LocalizeJSON("status.tracks_downloaded", `{"count": 1}`); err != nil || got != "1 track downloaded" {
+		t.Errorf("en 1 = %q, %v", got, err)
+	}
+	if _, err := LocalizeJSON("status.nope", ""); err == nil {
+		t.Error("expected error for unknown key")
+	}
+}
+
+func TestSetLocaleFallback(t *testing.T) {
+	withLocale(t, "pt_br")
+	if GetLocale() != "pt-BR" {
+		t.Fatalf("locale = %s", GetLocale())
+	}
+	if got := localizedError("cancelled"); got != "Download cancelado" {
+		t.Errorf("pt-BR cancelled = %q", got)
+	}
+	if err := SetLocale("xx"); err == nil {
+		t.Error("expected unsupported locale error")
+	}
+	if GetLocale() != "pt-BR" {
+		t.Errorf("rejected locale changed the active one: %s", GetLocale())
+	}
+}
+
+func TestMessageCatalogComplete(t *testing.T) {
+	for tag, messages := range messageCatalog {
+		for key := range messageCatalog[defaultLocale] {
+			forms, ok := messages[key]
+			if !ok {
+				t.Errorf("%s: missing %s", tag, key)
+				continue
+			}
+			if forms["other"] == "" {
+				t.Errorf("%s: %s has no other form", tag, key)
+			}
+		}
+	}
+}
+
+func TestLocalizeDownloadResponse(t *testing.T) {
+	withLocale(t, "de")
+	out := localizeDownloadResponseJSON(`{"success":false,"message":"","error":"rate limited","error_type":"rate_limit","extra":1}`)
+	var resp map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resp["localized_error"].(string), "Zu viele Anfragen") {
+		t.Errorf("localized_error = %v", resp["localized_error"])
+	}
+	if resp["error"] != "rate limited" || resp["extra"] == nil {
+		t.Errorf("original fields not kept: %s", out)
+	}
+
+	out = localizeDownloadResponseJSON(`{"success":true,"message":"ok","already_exists":true}`)
+	if !strings.Contains(out, `"localized_message":"Bereits in deiner Bibliothek"`) {
+		t.Errorf("already exists = %s", out)
+	}
+}
@@ -0,0 +1,196 @@
+package gobackend
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ==================== ICY (Shoutcast/Icecast) metadata ====================
+//
+// A client that sends "Icy-MetaData: 1" gets an icy-metaint header and,
+// every metaint bytes of audio, one length byte (x16) followed by a block
+// like "StreamTitle='Artist - Title';StreamUrl='';" padded with NULs. A
+// zero length means nothing changed. icyReader strips the blocks out so
+// the rest of the code only sees audio.
+
+const icyProbeTimeout = 20 * time.Second
+
+// ICYMetadata is one parsed metadata block. Artist and Title are split from
+// StreamTitle when it has the usual "Artist - Title" form.
+type ICYMetadata struct {
+	StreamTitle string `json:"stream_title"`
+	StreamURL   string `json:"stream_url,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+// ICYNowPlaying is what ProbeICYNowPlaying found on a station.
+type ICYNowPlaying struct {
+	Station     string      `json:"station,omitempty"`
+	Genre       string      `json:"genre,omitempty"`
+	ContentType string      `json:"content_type,omitempty"`
+	Bitrate     int         `json:"bitrate,omitempty"`
+	Metadata    ICYMetadata `json:"metadata"`
+}
+
+type icyReader struct {
+	r         io.Reader
+	metaint   int
+	remaining int
+	onMeta    func(ICYMetadata)
+}
+
+// newICYReader returns r without the metadata blocks, calling onMeta for
+// each non-empty one. A metaint of 0 means the server sends none.
+func newICYReader(r io.Reader, metaint int, onMeta func(ICYMetadata)) io.Reader {
+	if metaint <= 0 {
+		return r
+	}
+	return &icyReader{r: r, metaint: metaint, remaining: metaint, onMeta: onMeta}
+}
+
+func (ir *icyReader) Read(p []byte) (int, error) {
+	if ir.remaining == 0 {
+		if err := ir.readBlock(); err != nil {
+			return 0, err
+		}
+		ir.remaining = ir.metaint
+	}
+	if len(p) > ir.remaining {
+		p = p[:ir.remaining]
+	}
+	n, err := ir.r.Read(p)
+	ir.remaining -= n
+	return n, err
+}
+
+func (ir *icyReader) readBlock() error {
+	var size [1]byte
+	if _, err := io.ReadFull(ir.r, size[:]); err != nil {
+		return err
+	}
+	if size[0] == 0 {
+		return nil
+	}
+	block := make([]byte, int(size[0])*16)
+	if _, err := io.ReadFull(ir.r, block); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return io.EOF
+		}
+		return err
+	}
+	if ir.onMeta != nil {
+		ir.onMeta(parseICYMetadata(block))
+	}
+	return nil
+}
+
+// parseICYMetadata reads the key='value'; pairs of a block. Values may
+// contain quotes, so a value only ends at "';". Servers that are not UTF-8
+// almost always send Latin-1.
+func parseICYMetadata(block []byte) ICYMetadata {
+	block = bytes.TrimRight(block, "\x00")
+	text := string(block)
+	if !utf8.Valid(block) {
+		runes := make([]rune, len(block))
+		for i, b := range block {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	var meta ICYMetadata
+	for text != "" {
+		key, rest, ok := strings.Cut(text, "='")
+		if !ok {
+			break
+		}
+		value, next, found := strings.Cut(rest, "';")
+		if !found {
+			value, next = strings.TrimSuffix(rest, "'"), ""
+		}
+		switch strings.TrimSpace(key) {
+		case "StreamTitle":
+			meta.StreamTitle = strings.TrimSpace(value)
+		case "StreamUrl":
+			meta.StreamURL = strings.TrimSpace(value)
+		}
+		text = next
+	}
+	meta.Artist, meta.Title = splitICYStreamTitle(meta.StreamTitle)
+	return meta
+}
+
+func splitICYStreamTitle(streamTitle string) (artist, title string) {
+	for _, sep := range []string{" - ", " – ", " — "} {
+		if a, t, ok := strings.Cut(streamTitle, sep); ok {
+			return strings.TrimSpace(a), strings.TrimSpace(t)
+		}
+	}
+	return "", streamTitle
+}
+
+// openICYStream requests a stream with metadata and returns the response
+// and its metaint.
+func openICYStream(ctx context.Context, client *http.Client, streamURL string) (*http.Response, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", getRandomUserAgent())
+	req.Header.Set("Icy-MetaData", "1")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("stream returned HTTP %d", resp.StatusCode)
+	}
+	metaint, _ := strconv.Atoi(resp.Header.Get("Icy-Metaint"))
+	return resp, metaint, nil
+}
+
+// ProbeICYNowPlaying connects to a station, reads up to its first metadata
+// block and disconnects.
+func ProbeICYNowPlaying(streamURL string) (*ICYNowPlaying, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), icyProbeTimeout)
+	defer cancel()
+	resp, metaint, err := openICYStream(ctx, NewHTTPClientWithTimeout(0), strings.TrimSpace(streamURL))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	bitrate, _ := strconv.Atoi(resp.Header.Get("Icy-Br"))
+	result := &ICYNowPlaying{
+		Station:     strings.TrimSpace(resp.Header.Get("Icy-Name")),
+		Genre:       strings.TrimSpace(resp.Header.Get("Icy-Genre")),
+		ContentType: contentType,
+		Bitrate:     bitrate,
+	}
+	if metaint <= 0 {
+		return nil, fmt.Errorf("stream does not send ICY metadata")
+	}
+
+	found := false
+	reader := newICYReader(resp.Body, metaint, func(meta ICYMetadata) {
+		result.Metadata, found = meta, true
+	})
+	buf := make([]byte, 16<<10)
+	for !found {
+		if _, err := reader.Read(buf); err != nil && !found {
+			return nil, fmt.Errorf("no metadata before the stream ended: %w", err)
+		}
+	}
+	return result, nil
+}
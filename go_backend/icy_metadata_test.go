@@ -0,0 +1,69 @@
+package gobackend
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseICYMetadata(t *testing.T) {
+	meta := parseICYMetadata([]byte("StreamTitle='Guns N' Roses - Don't Cry';StreamUrl='https://radio.test/now';\x00\x00"))
+	if meta.StreamTitle != "Guns N' Roses - Don't Cry" || meta.Artist != "Guns N' Roses" || meta.Title != "Don't Cry" || meta.StreamURL != "https://radio.test/now" {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+
+	if meta := parseICYMetadata([]byte("StreamTitle='Beyonc\xe9 - Halo';")); meta.Artist != "Beyoncé" {
+		t.Fatalf("Latin-1 title decoded as %q", meta.StreamTitle)
+	}
+	if meta := parseICYMetadata([]byte("StreamTitle='Sigur Rós – Hoppípolla';")); meta.Artist != "Sigur Rós" || meta.Title != "Hoppípolla" {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+	if meta := parseICYMetadata([]byte("StreamTitle='Station jingle';")); meta.Artist != "" || meta.Title != "Station jingle" {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+}
+
+func TestICYReaderStripsMetadata(t *testing.T) {
+	block := []byte("StreamTitle='A - B';")
+	block = append(block, make([]byte, 32-len(block))...)
+	var stream bytes.Buffer
+	stream.WriteString("abcd")
+	stream.WriteByte(2)
+	stream.Write(block)
+	stream.WriteString("efgh")
+	stream.WriteByte(0)
+	stream.WriteString("ij")
+
+	var titles []string
+	audio, err := io.ReadAll(newICYReader(&stream, 4, func(meta ICYMetadata) { titles = append(titles, meta.StreamTitle) }))
+	if err != nil || string(audio) != "abcdefghij" {
+		t.Fatalf("audio = %q (%v)", audio, err)
+	}
+	if len(titles) != 1 || titles[0] != "A - B" {
+		t.Fatalf("titles = %v", titles)
+	}
+}
+
+func TestProbeICYNowPlaying(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("Icy-Name", "Test FM")
+		w.Header().Set("Icy-Br", "128")
+		w.Header().Set("Icy-Metaint", "8")
+		w.Write([]byte("audio..."))
+		block := make([]byte, 32)
+		copy(block, "StreamTitle='X - Y';")
+		w.Write(append([]byte{2}, block...))
+	}))
+	defer server.Close()
+
+	now, err := ProbeICYNowPlaying(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if now.Station != "Test FM" || now.Bitrate != 128 || now.Metadata.Artist != "X" {
+		t.Fatalf("unexpected result %+v", now)
+	}
+}
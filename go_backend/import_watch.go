@@ -0,0 +1,377 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	importProcessedDir     = ".imported"
+	defaultImportPollEvery = 10 * time.Second
+	minImportPollEvery     = 2 * time.Second
+	maxImportFileSize      = 2 * 1024 * 1024
+	maxQueuedImportItems   = 5000
+)
+
+var (
+	importURLPattern   = regexp.MustCompile(`(?i)\b(?:https?://[^\s"'<>,]+|spotify:(?:track|album|playlist|artist):[A-Za-z0-9]+)`)
+	importFileSuffixes = map[string]bool{".txt": true, ".csv": true, ".json": true}
+)
+
+// ImportItem is one link (or free-text query) picked up from a request file.
+type ImportItem struct {
+	URL        string `json:"url,omitempty"`
+	Query      string `json:"query,omitempty"`
+	Source     string `json:"source"`
+	Type       string `json:"type,omitempty"`
+	SourceFile string `json:"source_file,omitempty"`
+	AddedAt    int64  `json:"added_at"`
+}
+
+type importWatcher struct {
+	dir      string
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	sizes    map[string]int64
+}
+
+var (
+	importQueueMu sync.Mutex
+	importQueue   []ImportItem
+
+	importWatcherMu sync.Mutex
+	activeWatcher   *importWatcher
+)
+
+// classifyImportURL guesses the service and entity type of a link so Flutter
+// can route it to the right resolver.
+func classifyImportURL(raw string) (source, itemType string) {
+	if parsed, err := parseSpotifyURI(raw); err == nil {
+		return "spotify", parsed.Type
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "unknown", ""
+	}
+	host := strings.ToLower(strings.TrimPrefix(u.Hostname(), "www."))
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	typeFromPath := func() string {
+		for _, seg := range segments {
+			switch seg {
+			case "track", "album", "playlist", "artist":
+				return seg
+			}
+		}
+		return ""
+	}
+
+	switch {
+	case strings.HasSuffix(host, "deezer.com") || host == "deezer.page.link" || host == "link.deezer.com":
+		return "deezer", typeFromPath()
+	case strings.HasSuffix(host, "tidal.com"):
+		return "tidal", typeFromPath()
+	case strings.HasSuffix(host, "qobuz.com"):
+		return "qobuz", typeFromPath()
+	case strings.HasSuffix(host, "music.apple.com"):
+		return "apple_music", typeFromPath()
+	case IsYouTubeURL(raw):
+		return "youtube", "track"
+	case strings.HasSuffix(host, "song.link") || strings.HasSuffix(host, "album.link") || host == "odesli.co":
+		return "songlink", ""
+	default:
+		return "unknown", ""
+	}
+}
+
+func newImportItem(rawURL, query, sourceFile string, now int64) ImportItem {
+	item := ImportItem{SourceFile: sourceFile, AddedAt: now}
+	if rawURL != "" {
+		item.URL = strings.TrimRight(rawURL, ".);]")
+		item.Source, item.Type = classifyImportURL(item.URL)
+	} else {
+		item.Query = query
+		item.Source = "search"
+		item.Type = "track"
+	}
+	return item
+}
+
+// ParseImportContent extracts links from a text, CSV or JSON request file.
+// CSV rows without a link fall back to "artist - title" search queries.
+func ParseImportContent(name string, content []byte) ([]ImportItem, error) {
+	now := time.Now().Unix()
+	ext := strings.ToLower(filepath.Ext(name))
+	seen := make(map[string]bool)
+	var items []ImportItem
+
+	add := func(item ImportItem) {
+		key := item.URL + "|" + item.Query
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		items = append(items, item)
+	}
+	addURLs := func(text string) int {
+		matches := importURLPattern.FindAllString(text, -1)
+		for _, m := range matches {
+			add(newImportItem(m, "", name, now))
+		}
+		return len(matches)
+	}
+
+	switch ext {
+	case ".json":
+		var decoded interface{}
+		if err := json.Unmarshal(content, &decoded); err != nil {
+			return nil, fmt.Errorf("invalid JSON request file: %w", err)
+		}
+		collectImportJSONStrings(decoded, func(s string) { addURLs(s) })
+	case ".csv":
+		reader := csv.NewReader(bytes.NewReader(content))
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		header := true
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid CSV request file: %w", err)
+			}
+			if addURLs(strings.Join(record, " ")) > 0 {
+				header = false
+				continue
+			}
+			// First link-less row is treated as a header (e.g. "artist,title").
+			if header {
+				header = false
+				if len(record) >= 2 && strings.EqualFold(strings.TrimSpace(record[0]), "artist") {
+					continue
+				}
+			}
+			if len(record) >= 2 {
+				artist, title := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+				if artist != "" && title != "" {
+					add(newImportItem("", artist+" - "+title, name, now))
+				}
+			}
+		}
+	default:
+		addURLs(string(content))
+	}
+
+	return items, nil
+}
+
+func collectImportJSONStrings(v interface{}, fn func(string)) {
+	switch val := v.(type) {
+	case string:
+		fn(val)
+	case []interface{}:
+		for _, item := range val {
+			collectImportJSONStrings(item, fn)
+		}
+	case map[string]interface{}:
+		for _, item := range val {
+			collectImportJSONStrings(item, fn)
+		}
+	}
+}
+
+func enqueueImportItems(items []ImportItem) {
+	if len(items) == 0 {
+		return
+	}
+	importQueueMu.Lock()
+	importQueue = append(importQueue, items...)
+	if len(importQueue) > maxQueuedImportItems {
+		importQueue = importQueue[len(importQueue)-maxQueuedImportItems:]
+	}
+	importQueueMu.Unlock()
+
+	emitBackendEvent("import", items)
+}
+
+// PushImportFile accepts a request file shared to the app (e.g. via the share
+// sheet) and enqueues its links. Returns the number of items added.
+func PushImportFile(name string, content string) (int, error) {
+	items, err := ParseImportContent(name, []byte(content))
+	if err != nil {
+		return 0, err
+	}
+	enqueueImportItems(items)
+	GoLog("[Import] %s: queued %d items\n", name, len(items))
+	return len(items), nil
+}
+
+// PollImportedItemsJSON returns and clears items waiting to be enqueued.
+func PollImportedItemsJSON() (string, error) {
+	importQueueMu.Lock()
+	items := importQueue
+	importQueue = nil
+	importQueueMu.Unlock()
+
+	if items == nil {
+		items = []ImportItem{}
+	}
+	jsonBytes, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// scan processes request files whose size was stable since the previous poll,
+// so files still being copied in are not read half-written.
+func (w *importWatcher) scan() {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		GoLog("[Import] Cannot read watch folder: %v\n", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || !importFileSuffixes[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		name := entry.Name()
+		seen[name] = true
+
+		prevSize, known := w.sizes[name]
+		w.sizes[name] = info.Size()
+		if !known || prevSize != info.Size() {
+			continue
+		}
+		w.processFile(name, info.Size())
+		delete(w.sizes, name)
+	}
+
+	for name := range w.sizes {
+		if !seen[name] {
+			delete(w.sizes, name)
+		}
+	}
+}
+
+func (w *importWatcher) processFile(name string, size int64) {
+	path := filepath.Join(w.dir, name)
+	if size > maxImportFileSize {
+		GoLog("[Import] Skipping %s: file too large (%d bytes)\n", name, size)
+		w.archive(path, name)
+		return
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		GoLog("[Import] Failed to read %s: %v\n", name, err)
+		return
+	}
+
+	items, err := ParseImportContent(name, content)
+	if err != nil {
+		GoLog("[Import] Failed to parse %s: %v\n", name, err)
+	} else {
+		enqueueImportItems(items)
+		GoLog("[Import] %s: queued %d items\n", name, len(items))
+	}
+	w.archive(path, name)
+}
+
+// archive moves a handled file into .imported/ so it is not picked up again.
+func (w *importWatcher) archive(path, name string) {
+	archiveDir := filepath.Join(w.dir, importProcessedDir)
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		GoLog("[Import] Failed to create archive folder: %v\n", err)
+		return
+	}
+	target := filepath.Join(archiveDir, fmt.Sprintf("%d_%s", time.Now().Unix(), name))
+	if err := os.Rename(path, target); err != nil {
+		GoLog("[Import] Failed to archive %s: %v\n", name, err)
+		os.Remove(path)
+	}
+}
+
+func (w *importWatcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	w.scan()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.scan()
+		}
+	}
+}
+
+// StartImportWatchFolder polls dir for .txt/.csv/.json request files. Only one
+// folder is watched at a time; starting again replaces the previous watcher.
+func StartImportWatchFolder(dir string, intervalSeconds int) error {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return fmt.Errorf("watch folder is required")
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("watch folder does not exist: %s", dir)
+	}
+
+	interval := time.Duration(intervalSeconds) * time.Second
+	if intervalSeconds <= 0 {
+		interval = defaultImportPollEvery
+	}
+	interval = max(interval, minImportPollEvery)
+
+	StopImportWatchFolder()
+
+	w := &importWatcher{
+		dir:      dir,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		sizes:    make(map[string]int64),
+	}
+
+	importWatcherMu.Lock()
+	activeWatcher = w
+	importWatcherMu.Unlock()
+
+	go w.run()
+	GoLog("[Import] Watching %s every %s\n", dir, interval)
+	return nil
+}
+
+func StopImportWatchFolder() {
+	importWatcherMu.Lock()
+	w := activeWatcher
+	activeWatcher = nil
+	importWatcherMu.Unlock()
+
+	if w != nil {
+		close(w.stop)
+		<-w.done
+		GoLog("[Import] Stopped watching %s\n", w.dir)
+	}
+}
@@ -0,0 +1,38 @@
+package gobackend
+
+import "testing"
+
+func TestParseImportContent(t *testing.T) {
+	text := "check https://open.spotify.com/track/abc123, and\nhttps://www.deezer.com/en/album/42\nspotify:playlist:xyz\nhttps://open.spotify.com/track/abc123"
+	items, err := ParseImportContent("links.txt", []byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("expected 3 unique items, got %d: %+v", len(items), items)
+	}
+	if items[0].Source != "spotify" || items[0].Type != "track" {
+		t.Fatalf("unexpected first item: %+v", items[0])
+	}
+	if items[1].Source != "deezer" || items[1].Type != "album" {
+		t.Fatalf("unexpected deezer item: %+v", items[1])
+	}
+
+	csvContent := "artist,title\nDaft Punk,One More Time\n,https://tidal.com/browse/track/1\n"
+	items, err = ParseImportContent("batch.csv", []byte(csvContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Query != "Daft Punk - One More Time" || items[1].Source != "tidal" {
+		t.Fatalf("unexpected CSV items: %+v", items)
+	}
+
+	jsonContent := `{"tracks": [{"url": "https://music.apple.com/us/album/x/1"}, "https://youtu.be/dQw4w9WgXcQ"]}`
+	items, err = ParseImportContent("batch.json", []byte(jsonContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 JSON items, got %+v", items)
+	}
+}
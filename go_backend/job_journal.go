@@ -0,0 +1,476 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ==================== Job journal ====================
+//
+// job_journal.wal in the history dir is a write-ahead log of download job
+// state transitions: started, finalizing, then completed or failed. Each
+// record is one line, "<crc32 hex> <json>", written with a single append so
+// a process kill leaves at most one torn record at the tail. A completed
+// record carries the history record and is written before the history
+// append, which makes the append replayable.
+//
+// Every download entry point journals its job; an entry point called by
+// another one (DownloadByStrategy routing to DownloadTrack) leaves the job
+// to its caller.
+//
+// SetDownloadHistoryDir recovers the journal: the damaged tail (and a torn
+// last line of the history file) is dropped, completed jobs missing from the
+// history are appended again, and jobs that never reached a final state are
+// marked interrupted. The journal is then compacted down to the interrupted
+// records. Interrupted records stay, across any number of recoveries, until
+// the app re-queues the job under the same ID or acknowledges it with
+// AcknowledgeInterruptedJob; GetInterruptedJobs lists them with their
+// requests. While the app runs, the journal is compacted the same way every
+// jobJournalCompactEvery records, keeping the jobs still running.
+// CheckJobJournal re-reads the journal for diagnostics without changing it.
+
+const (
+	jobJournalFile = "job_journal.wal"
+
+	JobStarted      = "started"
+	JobFinalizing   = "finalizing"
+	JobCompleted    = "completed"
+	JobFailed       = "failed"
+	JobInterrupted  = "interrupted"
+	JobAcknowledged = "acknowledged"
+
+	jobJournalCompactEvery = 256
+)
+
+// JobJournalRecord is one state transition. Request is kept on started and
+// interrupted records so an interrupted download can be queued again.
+type JobJournalRecord struct {
+	Seq     uint64                 `json:"seq"`
+	JobID   string                 `json:"job_id"`
+	State   string                 `json:"state"`
+	At      int64                  `json:"at"`
+	Request json.RawMessage        `json:"request,omitempty"`
+	History *DownloadHistoryRecord `json:"history,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// JobJournalReport is the result of CheckJobJournal.
+type JobJournalReport struct {
+	Path         string             `json:"path"`
+	Records      int                `json:"records"`
+	Jobs         int                `json:"jobs"`
+	Running      []string           `json:"running,omitempty"`
+	Interrupted  []JobJournalRecord `json:"interrupted,omitempty"`
+	DamagedBytes int                `json:"damaged_bytes,omitempty"`
+	Problems     []string           `json:"problems,omitempty"`
+	Consistent   bool               `json:"consistent"`
+}
+
+var (
+	jobJournalMu  sync.Mutex
+	jobJournalDir string
+	jobJournalSeq uint64
+	// jobJournalLive holds the last record of jobs this process started and
+	// has not finished, with the request of their started record.
+	jobJournalLive = make(map[string]JobJournalRecord)
+	// jobJournalInterrupted holds interrupted jobs not yet re-queued or
+	// acknowledged.
+	jobJournalInterrupted = make(map[string]JobJournalRecord)
+	// jobJournalAppended counts records written since the last compaction.
+	jobJournalAppended int
+)
+
+func jobStateTerminal(state string) bool {
+	return state == JobCompleted || state == JobFailed || state == JobInterrupted || state == JobAcknowledged
+}
+
+// validJobTransition reports whether to may follow from. A compacted
+// journal starts with interrupted records, so those may come first.
+func validJobTransition(from, to string) bool {
+	switch to {
+	case JobStarted:
+		return from == "" || jobStateTerminal(from)
+	case JobFinalizing:
+		return from == JobStarted
+	case JobCompleted, JobFailed:
+		return from == JobStarted || from == JobFinalizing
+	case JobInterrupted:
+		return from == "" || from == JobStarted || from == JobFinalizing
+	case JobAcknowledged:
+		return from == JobInterrupted
+	}
+	return false
+}
+
+func encodeJournalRecord(rec JobJournalRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return fmt.Appendf(nil, "%08x %s\n", crc32.ChecksumIEEE(payload), payload), nil
+}
+
+func decodeJournalRecord(line []byte) (JobJournalRecord, error) {
+	var rec JobJournalRecord
+	if len(line) < 10 || line[8] != ' ' {
+		return rec, fmt.Errorf("malformed record")
+	}
+	sum, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil {
+		return rec, fmt.Errorf("malformed checksum")
+	}
+	if crc32.ChecksumIEEE(line[9:]) != uint32(sum) {
+		return rec, fmt.Errorf("checksum mismatch")
+	}
+	return rec, json.Unmarshal(line[9:], &rec)
+}
+
+// readJobJournal decodes records up to the first damaged one; good is the
+// length of the intact prefix.
+func readJobJournal(data []byte) (records []JobJournalRecord, good int, err error) {
+	for good < len(data) {
+		end := bytes.IndexByte(data[good:], '\n')
+		if end < 0 {
+			return records, good, fmt.Errorf("torn record at offset %d", good)
+		}
+		rec, err := decodeJournalRecord(data[good : good+end])
+		if err != nil {
+			return records, good, fmt.Errorf("record at offset %d: %w", good, err)
+		}
+		records = append(records, rec)
+		good += end + 1
+	}
+	return records, good, nil
+}
+
+func historyRecordKey(record DownloadHistoryRecord) string {
+	return fmt.Sprintf("%s|%d", record.ItemID, record.DownloadedAt)
+}
+
+// repairHistoryTailLocked cuts a torn last line off the history file so the
+// next append starts on a fresh line.
+func repairHistoryTailLocked() error {
+	path := filepath.Join(downloadHistoryDir, downloadHistoryFile)
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+	keep := bytes.LastIndexByte(data, '\n') + 1
+	GoLog("[Journal] Dropping %d bytes of torn history\n", len(data)-keep)
+	return os.Truncate(path, int64(keep))
+}
+
+// recoverJobJournalLocked replays the journal in downloadHistoryDir. The
+// caller holds downloadHistoryMu.
+func recoverJobJournalLocked() error {
+	jobJournalMu.Lock()
+	defer jobJournalMu.Unlock()
+	jobJournalDir, jobJournalSeq, jobJournalAppended = "", 0, 0
+	jobJournalLive = make(map[string]JobJournalRecord)
+	jobJournalInterrupted = make(map[string]JobJournalRecord)
+
+	if err := repairHistoryTailLocked(); err != nil {
+		return fmt.Errorf("failed to repair history: %w", err)
+	}
+	path := filepath.Join(downloadHistoryDir, jobJournalFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	records, good, damage := readJobJournal(data)
+	if damage != nil {
+		GoLog("[Journal] Dropping %d bytes after a damaged record: %v\n", len(data)-good, damage)
+	}
+
+	var order []string
+	last := make(map[string]JobJournalRecord)
+	requests := make(map[string]json.RawMessage)
+	seq := uint64(0)
+	for _, rec := range records {
+		if _, ok := last[rec.JobID]; !ok {
+			order = append(order, rec.JobID)
+		}
+		last[rec.JobID] = rec
+		if len(rec.Request) > 0 {
+			requests[rec.JobID] = rec.Request
+		}
+		seq = max(seq, rec.Seq)
+	}
+
+	have := make(map[string]bool)
+	for _, record := range loadDownloadHistoryLocked() {
+		have[historyRecordKey(record)] = true
+	}
+	var replay []DownloadHistoryRecord
+	var kept []JobJournalRecord
+	now := time.Now().UnixMilli()
+	for _, id := range order {
+		rec := last[id]
+		switch {
+		case rec.State == JobCompleted && rec.History != nil && !have[historyRecordKey(*rec.History)]:
+			replay = append(replay, *rec.History)
+		case rec.State == JobInterrupted:
+			seq++
+			kept = append(kept, JobJournalRecord{Seq: seq, JobID: id, State: JobInterrupted, At: rec.At, Request: requests[id]})
+		case !jobStateTerminal(rec.State):
+			seq++
+			kept = append(kept, JobJournalRecord{Seq: seq, JobID: id, State: JobInterrupted, At: now, Request: requests[id]})
+		}
+	}
+	if len(replay) > 0 {
+		if err := appendDownloadHistoryLocked(replay); err != nil {
+			return fmt.Errorf("failed to replay history: %w", err)
+		}
+		GoLog("[Journal] Replayed %d history records\n", len(replay))
+	}
+	if len(kept) > 0 {
+		GoLog("[Journal] %d downloads were interrupted\n", len(kept))
+	}
+
+	if len(data) > 0 || len(kept) > 0 {
+		if err := writeJobJournal(path, kept); err != nil {
+			return fmt.Errorf("failed to compact journal: %w", err)
+		}
+	}
+	for _, rec := range kept {
+		jobJournalInterrupted[rec.JobID] = rec
+	}
+	jobJournalDir, jobJournalSeq = downloadHistoryDir, seq
+	return nil
+}
+
+func writeJobJournal(path string, records []JobJournalRecord) error {
+	var data []byte
+	for _, rec := range records {
+		line, err := encodeJournalRecord(rec)
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+	}
+	return writeStoreFile(path, data)
+}
+
+// compactJobJournal rewrites the journal down to the interrupted jobs and
+// the jobs still running, once jobJournalCompactEvery records were written.
+// It takes downloadHistoryMu so no completed record whose history append is
+// still pending is dropped.
+func compactJobJournal() {
+	downloadHistoryMu.Lock()
+	defer downloadHistoryMu.Unlock()
+	jobJournalMu.Lock()
+	defer jobJournalMu.Unlock()
+	if jobJournalDir == "" || jobJournalAppended < jobJournalCompactEvery {
+		return
+	}
+
+	var records []JobJournalRecord
+	seq := jobJournalSeq
+	next := func(rec JobJournalRecord) {
+		seq++
+		rec.Seq = seq
+		records = append(records, rec)
+	}
+	for _, rec := range sortedJournalRecords(jobJournalInterrupted) {
+		next(rec)
+	}
+	for _, rec := range sortedJournalRecords(jobJournalLive) {
+		next(JobJournalRecord{JobID: rec.JobID, State: JobStarted, At: rec.At, Request: rec.Request})
+		if rec.State != JobStarted {
+			next(JobJournalRecord{JobID: rec.JobID, State: rec.State, At: rec.At})
+		}
+	}
+	if err := writeJobJournal(filepath.Join(jobJournalDir, jobJournalFile), records); err != nil {
+		GoLog("[Journal] Failed to compact journal: %v\n", err)
+		return
+	}
+	jobJournalSeq, jobJournalAppended = seq, 0
+}
+
+func sortedJournalRecords(records map[string]JobJournalRecord) []JobJournalRecord {
+	sorted := make([]JobJournalRecord, 0, len(records))
+	for _, rec := range records {
+		sorted = append(sorted, rec)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Seq < sorted[j].Seq })
+	return sorted
+}
+
+// appendJobJournal writes rec with the next sequence number and reports
+// whether it did. Transitions of jobs that were never started (or already
+// finished) are dropped, as is a second start of a running job. Journal
+// failures are logged; they never fail the download itself.
+func appendJobJournal(rec JobJournalRecord) bool {
+	jobJournalMu.Lock()
+	defer jobJournalMu.Unlock()
+	if jobJournalDir == "" || rec.JobID == "" {
+		return false
+	}
+	prev, live := jobJournalLive[rec.JobID]
+	switch {
+	case rec.State == JobStarted:
+		if live {
+			return false
+		}
+	case rec.State == JobAcknowledged:
+		if _, ok := jobJournalInterrupted[rec.JobID]; !ok {
+			return false
+		}
+	case !live:
+		return false
+	}
+	rec.Seq = jobJournalSeq + 1
+	rec.At = time.Now().UnixMilli()
+	line, err := encodeJournalRecord(rec)
+	if err != nil {
+		return false
+	}
+	f, err := os.OpenFile(filepath.Join(jobJournalDir, jobJournalFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err == nil {
+		_, err = f.Write(line)
+		if err == nil && durabilityPolicy() != DurabilityOff {
+			err = f.Sync()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		GoLog("[Journal] Failed to record %s for %s: %v\n", rec.State, rec.JobID, err)
+		return false
+	}
+	jobJournalSeq = rec.Seq
+	jobJournalAppended++
+	delete(jobJournalInterrupted, rec.JobID)
+	if jobStateTerminal(rec.State) {
+		delete(jobJournalLive, rec.JobID)
+	} else {
+		if rec.Request == nil {
+			rec.Request = prev.Request
+		}
+		jobJournalLive[rec.JobID] = rec
+	}
+	return true
+}
+
+// journalJobStarted records the start of a job. It returns false when the
+// job is already running, i.e. for an entry point called by another one,
+// which then leaves finishing the job to its caller.
+func journalJobStarted(jobID, requestJSON string) bool {
+	rec := JobJournalRecord{JobID: jobID, State: JobStarted}
+	if json.Valid([]byte(requestJSON)) {
+		rec.Request = json.RawMessage(requestJSON)
+	}
+	return appendJobJournal(rec)
+}
+
+func journalJobState(jobID, state string) {
+	appendJobJournal(JobJournalRecord{JobID: jobID, State: state})
+}
+
+// finishJournaledJob records the outcome of a job that is still open; jobs
+// already completed by recordDownloadHistory are left alone.
+func finishJournaledJob(jobID, respJSON string, err error) {
+	rec := JobJournalRecord{JobID: jobID, State: JobCompleted}
+	if err != nil {
+		rec.State, rec.Error = JobFailed, err.Error()
+	} else {
+		var resp DownloadResponse
+		if json.Unmarshal([]byte(respJSON), &resp) != nil || !resp.Success {
+			rec.State, rec.Error = JobFailed, resp.Error
+		}
+	}
+	appendJobJournal(rec)
+	compactJobJournal()
+}
+
+// GetInterruptedJobs returns the jobs a crash interrupted that were neither
+// re-queued nor acknowledged yet, oldest first, with their requests.
+func GetInterruptedJobs() []JobJournalRecord {
+	jobJournalMu.Lock()
+	defer jobJournalMu.Unlock()
+	return sortedJournalRecords(jobJournalInterrupted)
+}
+
+// AcknowledgeInterruptedJob drops an interrupted job the app will not
+// re-queue under the same ID.
+func AcknowledgeInterruptedJob(jobID string) error {
+	if !appendJobJournal(JobJournalRecord{JobID: jobID, State: JobAcknowledged}) {
+		return fmt.Errorf("no interrupted job %q", jobID)
+	}
+	return nil
+}
+
+// CheckJobJournal verifies the journal: record checksums and order, legal
+// state transitions, unfinished jobs that are not running in this process,
+// and completed jobs missing from the download history.
+func CheckJobJournal() (*JobJournalReport, error) {
+	downloadHistoryMu.Lock()
+	defer downloadHistoryMu.Unlock()
+	jobJournalMu.Lock()
+	defer jobJournalMu.Unlock()
+	if jobJournalDir == "" {
+		return nil, fmt.Errorf("history dir not set")
+	}
+
+	report := &JobJournalReport{Path: filepath.Join(jobJournalDir, jobJournalFile)}
+	data, err := os.ReadFile(report.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	records, good, damage := readJobJournal(data)
+	if damage != nil {
+		report.DamagedBytes = len(data) - good
+		report.Problems = append(report.Problems, damage.Error())
+	}
+	report.Records = len(records)
+
+	var order []string
+	last := make(map[string]JobJournalRecord)
+	prevSeq := uint64(0)
+	for _, rec := range records {
+		if rec.Seq <= prevSeq {
+			report.Problems = append(report.Problems, fmt.Sprintf("sequence %d follows %d", rec.Seq, prevSeq))
+		}
+		prevSeq = rec.Seq
+		prev, seen := last[rec.JobID]
+		if !seen {
+			order = append(order, rec.JobID)
+		}
+		if !validJobTransition(prev.State, rec.State) {
+			report.Problems = append(report.Problems, fmt.Sprintf("job %s: %q after %q", rec.JobID, rec.State, prev.State))
+		}
+		last[rec.JobID] = rec
+	}
+	report.Jobs = len(order)
+
+	have := make(map[string]bool)
+	for _, record := range loadDownloadHistoryLocked() {
+		have[historyRecordKey(record)] = true
+	}
+	for _, id := range order {
+		rec := last[id]
+		switch {
+		case rec.State == JobInterrupted:
+			report.Interrupted = append(report.Interrupted, rec)
+		case !jobStateTerminal(rec.State):
+			if _, live := jobJournalLive[id]; live {
+				report.Running = append(report.Running, id)
+			} else {
+				report.Problems = append(report.Problems, fmt.Sprintf("job %s is %s but not running", id, rec.State))
+			}
+		case rec.State == JobCompleted && rec.History != nil && !have[historyRecordKey(*rec.History)]:
+			report.Problems = append(report.Problems, fmt.Sprintf("job %s completed but is missing from the history", id))
+		}
+	}
+	report.Consistent = len(report.Problems) == 0
+	return report, nil
+}
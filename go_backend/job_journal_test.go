@@ -0,0 +1,195 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJobJournalRecovery(t *testing.T) {
+	dir := t.TempDir()
+	defer SetDownloadHistoryDir(t.TempDir())
+
+	kept := DownloadHistoryRecord{ItemID: "a", Title: "Kept", DownloadedAt: 100}
+	lost := DownloadHistoryRecord{ItemID: "b", Title: "Lost", DownloadedAt: 200}
+	keptLine, _ := json.Marshal(kept)
+	history := append(keptLine, '\n')
+	os.WriteFile(filepath.Join(dir, downloadHistoryFile), append(history, `{"item_id":"torn","ti`...), 0644)
+
+	// b was killed between the journal write and the history append, c in
+	// the middle of finalizing, and the last record was torn.
+	var journal []byte
+	for i, rec := range []JobJournalRecord{
+		{JobID: "a", State: JobStarted},
+		{JobID: "b", State: JobStarted},
+		{JobID: "a", State: JobCompleted, History: &kept},
+		{JobID: "c", State: JobStarted, Request: json.RawMessage(`{"item_id":"c","track_name":"Song"}`)},
+		{JobID: "b", State: JobCompleted, History: &lost},
+		{JobID: "c", State: JobFinalizing},
+	} {
+		rec.Seq = uint64(i + 1)
+		line, err := encodeJournalRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		journal = append(journal, line...)
+	}
+	torn, _ := encodeJournalRecord(JobJournalRecord{Seq: 7, JobID: "d", State: JobStarted})
+	journal = append(journal, torn[:len(torn)/2]...)
+	os.WriteFile(filepath.Join(dir, jobJournalFile), journal, 0644)
+
+	if err := SetDownloadHistoryDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, downloadHistoryFile))
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"title":"Lost"`) {
+		t.Fatalf("history after recovery:\n%s", data)
+	}
+
+	report, err := CheckJobJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent || report.Records != 1 || len(report.Interrupted) != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	interrupted := report.Interrupted[0]
+	if interrupted.JobID != "c" || interrupted.Seq != 7 || !strings.Contains(string(interrupted.Request), "Song") {
+		t.Errorf("interrupted = %+v", interrupted)
+	}
+
+	// A second recovery finds nothing left to replay but keeps c until the
+	// app acknowledges it.
+	if err := SetDownloadHistoryDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(filepath.Join(dir, downloadHistoryFile)); string(again) != string(data) {
+		t.Error("history changed on the second recovery")
+	}
+	if report, _ := CheckJobJournal(); report.Records != 1 || len(report.Interrupted) != 1 {
+		t.Errorf("interrupted job dropped: %+v", report)
+	}
+	if jobs := GetInterruptedJobs(); len(jobs) != 1 || jobs[0].JobID != "c" || jobs[0].At != interrupted.At {
+		t.Errorf("interrupted jobs = %+v", jobs)
+	}
+	if err := AcknowledgeInterruptedJob("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AcknowledgeInterruptedJob("c"); err == nil {
+		t.Error("acknowledged c twice")
+	}
+	if err := SetDownloadHistoryDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if report, _ := CheckJobJournal(); report.Records != 0 || len(GetInterruptedJobs()) != 0 {
+		t.Errorf("journal not compacted: %+v", report)
+	}
+}
+
+func TestJobJournalRequeueAndCompaction(t *testing.T) {
+	dir := t.TempDir()
+	if err := SetDownloadHistoryDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDownloadHistoryDir(t.TempDir())
+
+	journalJobStarted("crashed", `{"item_id":"crashed"}`)
+	if err := SetDownloadHistoryDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	// Re-queued under the same ID: no longer interrupted, and a nested
+	// entry point does not start it twice.
+	if !journalJobStarted("crashed", `{"item_id":"crashed"}`) || journalJobStarted("crashed", "") {
+		t.Fatal("re-queued job not journaled exactly once")
+	}
+	if jobs := GetInterruptedJobs(); len(jobs) != 0 {
+		t.Errorf("re-queued job still interrupted: %+v", jobs)
+	}
+
+	for i := 0; i < jobJournalCompactEvery; i++ {
+		id := fmt.Sprintf("job-%d", i)
+		journalJobStarted(id, "")
+		finishJournaledJob(id, `{"success": true}`, nil)
+	}
+	report, err := CheckJobJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent || report.Records >= jobJournalCompactEvery || len(report.Running) != 1 || report.Running[0] != "crashed" {
+		t.Fatalf("journal not compacted around the running job: %+v", report)
+	}
+
+	// The running job still becomes interrupted, with its request.
+	if err := SetDownloadHistoryDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := GetInterruptedJobs(); len(jobs) != 1 || string(jobs[0].Request) != `{"item_id":"crashed"}` {
+		t.Errorf("interrupted jobs after compaction = %+v", jobs)
+	}
+}
+
+func TestDownloadEntryPointsAreJournaled(t *testing.T) {
+	dir := t.TempDir()
+	if err := SetDownloadHistoryDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDownloadHistoryDir(t.TempDir())
+
+	DownloadTrack(`{"item_id":"direct","service":"nowhere"}`)
+	report, err := CheckJobJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent || report.Records != 2 || len(report.Running) != 0 {
+		t.Errorf("direct DownloadTrack not journaled: %+v", report)
+	}
+}
+
+func TestJobJournalCheck(t *testing.T) {
+	dir := t.TempDir()
+	if err := SetDownloadHistoryDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDownloadHistoryDir(t.TempDir())
+
+	journalJobStarted("x", `{"item_id":"x"}`)
+	journalJobState("x", JobFinalizing)
+	recordDownloadHistory(DownloadRequest{ItemID: "x"}, `{"success": true, "file_path": "/m/x.flac"}`)
+	finishJournaledJob("x", `{"success": true}`, nil)
+	journalJobStarted("y", "")
+	finishJournaledJob("y", `{"success": false, "error": "not found"}`, nil)
+	journalJobStarted("z", "")
+	// Transitions of unknown jobs are dropped.
+	journalJobState("never-started", JobFinalizing)
+
+	report, err := CheckJobJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent || report.Records != 6 || report.Jobs != 3 || len(report.Running) != 1 || report.Running[0] != "z" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// Lose the history append and damage the tail.
+	path := filepath.Join(dir, jobJournalFile)
+	os.WriteFile(filepath.Join(dir, downloadHistoryFile), nil, 0644)
+	downloadHistoryMu.Lock()
+	downloadHistoryLoaded, downloadHistoryRecords = false, nil
+	downloadHistoryMu.Unlock()
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString("00000000 {\"seq\":99}\n")
+	f.Close()
+
+	report, err = CheckJobJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Consistent || report.DamagedBytes == 0 || len(report.Problems) != 2 ||
+		!strings.Contains(report.Problems[1], "job x completed but is missing") {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
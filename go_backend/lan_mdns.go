@@ -0,0 +1,309 @@
+package gobackend
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+// ==================== mDNS responder ====================
+//
+// A minimal DNS-SD responder for the LAN transfer server: it answers PTR
+// queries for _spotiflac._tcp.local. and the SRV/TXT/A records that follow,
+// announces itself twice on start and sends a goodbye on stop. It does no
+// probing or conflict resolution; the instance and host names carry a random
+// label picked per session, which keeps collisions unlikely. Nothing derived
+// from the session token is ever announced.
+
+const (
+	lanTransferServiceType = "_spotiflac._tcp.local."
+	mdnsServicesEnumName   = "_services._dns-sd._udp.local."
+	mdnsPort               = 5353
+	mdnsTTL                = 120
+	mdnsUnicastResponseBit = 1 << 15
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+
+// mdnsService holds the records announced for one server.
+type mdnsService struct {
+	instance string // "SpotiFLAC 1a2b._spotiflac._tcp.local."
+	host     string // "spotiflac-1a2b3c4d.local."
+	port     int
+	ips      []net.IP
+	txt      []string
+}
+
+func newMDNSService(instance, host string, port int, ips []net.IP) *mdnsService {
+	return &mdnsService{
+		instance: strings.ReplaceAll(instance, ".", "-") + "." + lanTransferServiceType,
+		host:     host + ".local.",
+		port:     port,
+		ips:      ips,
+		txt:      []string{"v=" + strconv.Itoa(lanTransferAPIVersion), "path=/files", "auth=token"},
+	}
+}
+
+type mdnsRecordSet struct {
+	enum, ptr, srv, txt, a bool
+}
+
+// respond answers a query packet. It returns nil when the packet is not a
+// query or asks for nothing this service owns. unicast reports whether the
+// reply should go back to the sender instead of the group: legacy resolvers
+// query from a port other than 5353 and expect the ID and question echoed.
+func (s *mdnsService) respond(packet []byte, fromPort int) (reply []byte, unicast bool) {
+	var p dnsmessage.Parser
+	header, err := p.Start(packet)
+	if err != nil || header.Response || header.OpCode != 0 {
+		return nil, false
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil, false
+	}
+
+	legacy := fromPort != mdnsPort
+	unicast = legacy
+	var want, additional mdnsRecordSet
+	var asked []dnsmessage.Question
+	for _, q := range questions {
+		class := q.Class &^ mdnsUnicastResponseBit
+		if class != dnsmessage.ClassINET && class != dnsmessage.ClassANY {
+			continue
+		}
+		name := q.Name.String()
+		all := q.Type == dnsmessage.TypeALL
+		matched := true
+		switch {
+		case strings.EqualFold(name, mdnsServicesEnumName) && (all || q.Type == dnsmessage.TypePTR):
+			want.enum = true
+		case strings.EqualFold(name, lanTransferServiceType) && (all || q.Type == dnsmessage.TypePTR):
+			want.ptr = true
+			additional = mdnsRecordSet{srv: true, txt: true, a: true}
+		case strings.EqualFold(name, s.instance) && (all || q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeTXT):
+			want.srv = want.srv || all || q.Type == dnsmessage.TypeSRV
+			want.txt = want.txt || all || q.Type == dnsmessage.TypeTXT
+			additional.a = true
+		case strings.EqualFold(name, s.host) && (all || q.Type == dnsmessage.TypeA):
+			want.a = true
+		default:
+			matched = false
+		}
+		if matched {
+			asked = append(asked, q)
+			if q.Class&mdnsUnicastResponseBit != 0 {
+				unicast = true
+			}
+		}
+	}
+	if len(asked) == 0 {
+		return nil, false
+	}
+	// Records already in the answer section are not repeated.
+	additional.srv = additional.srv && !want.srv
+	additional.txt = additional.txt && !want.txt
+	additional.a = additional.a && !want.a
+
+	var id uint16
+	if legacy {
+		id = header.ID
+	} else {
+		asked = nil
+	}
+	reply, err = s.build(id, asked, want, additional, mdnsTTL)
+	if err != nil {
+		return nil, false
+	}
+	return reply, unicast
+}
+
+// announcement is the unsolicited response sent on start (ttl mdnsTTL)
+// and on stop (ttl 0, a goodbye).
+func (s *mdnsService) announcement(ttl uint32) ([]byte, error) {
+	return s.build(0, nil, mdnsRecordSet{ptr: true, srv: true, txt: true, a: true}, mdnsRecordSet{}, ttl)
+}
+
+func (s *mdnsService) build(id uint16, questions []dnsmessage.Question, answers, additional mdnsRecordSet, ttl uint32) ([]byte, error) {
+	serviceType := dnsmessage.MustNewName(lanTransferServiceType)
+	instance, err := dnsmessage.NewName(s.instance)
+	if err != nil {
+		return nil, err
+	}
+	host, err := dnsmessage.NewName(s.host)
+	if err != nil {
+		return nil, err
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, Authoritative: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	for _, q := range questions {
+		if err := b.Question(q); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unique records set the cache-flush bit; shared PTRs must not.
+	header := func(name dnsmessage.Name, unique bool) dnsmessage.ResourceHeader {
+		class := dnsmessage.ClassINET
+		if unique && id == 0 {
+			class |= mdnsUnicastResponseBit
+		}
+		return dnsmessage.ResourceHeader{Name: name, Class: class, TTL: ttl}
+	}
+	write := func(set mdnsRecordSet) error {
+		if set.enum {
+			if err := b.PTRResource(header(dnsmessage.MustNewName(mdnsServicesEnumName), false), dnsmessage.PTRResource{PTR: serviceType}); err != nil {
+				return err
+			}
+		}
+		if set.ptr {
+			if err := b.PTRResource(header(serviceType, false), dnsmessage.PTRResource{PTR: instance}); err != nil {
+				return err
+			}
+		}
+		if set.srv {
+			if err := b.SRVResource(header(instance, true), dnsmessage.SRVResource{Port: uint16(s.port), Target: host}); err != nil {
+				return err
+			}
+		}
+		if set.txt {
+			if err := b.TXTResource(header(instance, true), dnsmessage.TXTResource{TXT: s.txt}); err != nil {
+				return err
+			}
+		}
+		if set.a {
+			for _, ip := range s.ips {
+				var a [4]byte
+				copy(a[:], ip.To4())
+				if err := b.AResource(header(host, true), dnsmessage.AResource{A: a}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	if err := write(answers); err != nil {
+		return nil, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	if err := write(additional); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+type mdnsResponder struct {
+	service *mdnsService
+	conn    *net.UDPConn
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// startMDNSResponder joins the mDNS group on every multicast-capable LAN
+// interface (never mobile data) and starts answering queries for the
+// service.
+func startMDNSResponder(instance, host string, port int) (*mdnsResponder, error) {
+	var ifaces []net.Interface
+	var ips []net.IP
+	for _, addr := range lanInterfaceAddrs() {
+		ips = append(ips, addr.ip)
+		if addr.iface.Flags&net.FlagMulticast != 0 {
+			ifaces = append(ifaces, addr.iface)
+		}
+	}
+	if len(ifaces) == 0 {
+		return nil, fmt.Errorf("no multicast-capable LAN interface")
+	}
+	conn, err := net.ListenMulticastUDP("udp4", &ifaces[0], mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	pc := ipv4.NewPacketConn(conn)
+	for i := range ifaces[1:] {
+		// An interface with several addresses is listed more than once;
+		// joining it again fails harmlessly.
+		_ = pc.JoinGroup(&ifaces[i+1], &net.UDPAddr{IP: mdnsGroup.IP})
+	}
+
+	r := &mdnsResponder{
+		service: newMDNSService(instance, host, port, ips),
+		conn:    conn,
+		done:    make(chan struct{}),
+	}
+	r.wg.Add(2)
+	go r.serve()
+	go r.announce()
+	return r, nil
+}
+
+func (r *mdnsResponder) serve() {
+	defer r.wg.Done()
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+			GoLog("[mDNS] Read failed: %v\n", err)
+			return
+		}
+		reply, unicast := r.service.respond(buf[:n], from.Port)
+		if reply == nil {
+			continue
+		}
+		to := mdnsGroup
+		if unicast {
+			to = from
+		}
+		if _, err := r.conn.WriteToUDP(reply, to); err != nil {
+			GoLog("[mDNS] Reply failed: %v\n", err)
+		}
+	}
+}
+
+// announce sends the two start-up announcements RFC 6762 asks for.
+func (r *mdnsResponder) announce() {
+	defer r.wg.Done()
+	packet, err := r.service.announcement(mdnsTTL)
+	if err != nil {
+		GoLog("[mDNS] Failed to build announcement: %v\n", err)
+		return
+	}
+	for i := 0; i < 2; i++ {
+		r.conn.WriteToUDP(packet, mdnsGroup)
+		select {
+		case <-r.done:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Close sends a goodbye so browsers drop the service right away.
+func (r *mdnsResponder) Close() {
+	if packet, err := r.service.announcement(0); err == nil {
+		r.conn.WriteToUDP(packet, mdnsGroup)
+	}
+	close(r.done)
+	r.conn.Close()
+	r.wg.Wait()
+}
@@ -0,0 +1,370 @@
+package gobackend
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== LAN transfer ====================
+//
+// An opt-in HTTP server that lets a desktop on the same network pull
+// finished downloads off the phone. It is announced over mDNS as
+// _spotiflac._tcp (see lan_mdns.go) so a desktop client can find it without
+// typing an IP; on Android Flutter must hold a WifiManager.MulticastLock
+// while the server runs or the announcements never leave the device.
+//
+//	GET /info          device name and API version
+//	GET /files         completed downloads, ?since=UNIX for newer ones only
+//	GET /files/{id}    the file itself; Range requests resume transfers
+//
+// Every request needs the session token shown in the app, as
+// "Authorization: Bearer TOKEN" or ?token=TOKEN. Only files recorded in the
+// download history are served. The server only listens on Wi-Fi/LAN
+// addresses, never on mobile data, and the mDNS names use a random label
+// that has nothing to do with the token.
+
+const (
+	defaultLANTransferPort = 48221
+	lanTransferAPIVersion  = 1
+)
+
+type LANTransferStatus struct {
+	Running   bool     `json:"running"`
+	Port      int      `json:"port,omitempty"`
+	URLs      []string `json:"urls,omitempty"`
+	Token     string   `json:"token,omitempty"`
+	Instance  string   `json:"instance,omitempty"`
+	MDNS      bool     `json:"mdns"`
+	MDNSError string   `json:"mdns_error,omitempty"`
+	Started   int64    `json:"started,omitempty"`
+}
+
+// LANTransferFile is one entry of GET /files.
+type LANTransferFile struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Title        string `json:"title,omitempty"`
+	Artist       string `json:"artist,omitempty"`
+	Album        string `json:"album,omitempty"`
+	SizeBytes    int64  `json:"size_bytes"`
+	DownloadedAt int64  `json:"downloaded_at"`
+}
+
+var (
+	lanTransferMu     sync.Mutex
+	lanTransferServer *http.Server
+	lanTransferMDNS   *mdnsResponder
+	lanTransferStatus LANTransferStatus
+)
+
+// lanTransferFileID is stable for a path so a desktop can resume or skip
+// files it already pulled.
+func lanTransferFileID(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:12])
+}
+
+// lanTransferIndex maps file IDs to paths for one server session, so a
+// download does not walk and stat the whole history again. It is filled by
+// GET /files and rebuilt only when an unknown ID is asked for.
+type lanTransferIndex struct {
+	mu    sync.Mutex
+	paths map[string]string
+}
+
+func (x *lanTransferIndex) merge(paths map[string]string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.paths == nil {
+		x.paths = make(map[string]string, len(paths))
+	}
+	for id, path := range paths {
+		x.paths[id] = path
+	}
+}
+
+func (x *lanTransferIndex) lookup(id string) (string, bool) {
+	x.mu.Lock()
+	path, ok := x.paths[id]
+	x.mu.Unlock()
+	if ok {
+		return path, true
+	}
+	_, paths := lanTransferFiles(0)
+	x.merge(paths)
+	path, ok = paths[id]
+	return path, ok
+}
+
+// lanTransferFiles lists history records whose files still exist, newest
+// last. A file downloaded twice is listed once.
+func lanTransferFiles(since int64) ([]LANTransferFile, map[string]string) {
+	downloadHistoryMu.Lock()
+	records := append([]DownloadHistoryRecord(nil), loadDownloadHistoryLocked()...)
+	downloadHistoryMu.Unlock()
+
+	paths := make(map[string]string)
+	files := []LANTransferFile{}
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		id := lanTransferFileID(record.FilePath)
+		if record.FilePath == "" || paths[id] != "" || record.DownloadedAt <= since {
+			continue
+		}
+		info, err := os.Stat(record.FilePath)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		paths[id] = record.FilePath
+		files = append(files, LANTransferFile{
+			ID:           id,
+			Name:         filepath.Base(record.FilePath),
+			Title:        record.Title,
+			Artist:       record.Artist,
+			Album:        record.Album,
+			SizeBytes:    info.Size(),
+			DownloadedAt: record.DownloadedAt,
+		})
+	}
+	for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
+		files[i], files[j] = files[j], files[i]
+	}
+	return files, paths
+}
+
+func newLANTransferHandler(token, instance string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info", func(w http.ResponseWriter, r *http.Request) {
+		writeDebugJSON(w, http.StatusOK, map[string]interface{}{"name": instance, "api_version": lanTransferAPIVersion})
+	})
+	index := &lanTransferIndex{}
+	mux.HandleFunc("GET /files", func(w http.ResponseWriter, r *http.Request) {
+		since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		files, paths := lanTransferFiles(since)
+		index.merge(paths)
+		writeDebugJSON(w, http.StatusOK, files)
+	})
+	mux.HandleFunc("GET /files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		serveLANTransferFile(w, r, index)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			provided = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			writeDebugJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid transfer token"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func serveLANTransferFile(w http.ResponseWriter, r *http.Request, index *lanTransferIndex) {
+	path, ok := index.lookup(r.PathValue("id"))
+	if !ok {
+		writeDebugJSON(w, http.StatusNotFound, map[string]string{"error": "file not found"})
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		writeDebugJSON(w, http.StatusNotFound, map[string]string{"error": "file not found"})
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeDebugJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	name := filepath.Base(path)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	// ServeContent answers Range and If-Range, which is what makes an
+	// interrupted transfer resumable.
+	http.ServeContent(w, r, name, info.ModTime(), f)
+	GoLog("[LANTransfer] Served %s to %s\n", name, r.RemoteAddr)
+}
+
+// lanTransferURLs lists http://IP:port for every LAN address, which is
+// what the user types or the QR code carries.
+func lanTransferURLs(ips []net.IP, port int) []string {
+	var urls []string
+	for _, ip := range ips {
+		urls = append(urls, "http://"+net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	}
+	return urls
+}
+
+// mobileDataInterfacePrefixes are the names Android and Linux give cellular
+// interfaces (including the 464xlat clat and v4- stacked ones).
+var mobileDataInterfacePrefixes = []string{"rmnet", "ccmni", "pdp", "wwan", "clat", "v4-", "usb_rmnet", "seth_lte"}
+
+func isMobileDataInterface(name string) bool {
+	name = strings.ToLower(name)
+	for _, prefix := range mobileDataInterfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// lanInterfaceAddr is a private IPv4 address on an up, non-loopback,
+// non-cellular interface.
+type lanInterfaceAddr struct {
+	iface net.Interface
+	ip    net.IP
+}
+
+func lanInterfaceAddrs() []lanInterfaceAddr {
+	var addrs []lanInterfaceAddr
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || isMobileDataInterface(iface.Name) {
+			continue
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaceAddrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				if ip4 := ipNet.IP.To4(); ip4 != nil && ip4.IsPrivate() {
+					addrs = append(addrs, lanInterfaceAddr{iface: iface, ip: ip4})
+				}
+			}
+		}
+	}
+	return addrs
+}
+
+func localIPv4Addresses() []net.IP {
+	var ips []net.IP
+	for _, addr := range lanInterfaceAddrs() {
+		ips = append(ips, addr.ip)
+	}
+	return ips
+}
+
+// StartLANTransferServer listens on the Wi-Fi/LAN addresses (port 0 picks
+// the default), announces the server over mDNS and returns the session
+// token. mDNS failures are reported in the status but do not stop the
+// server.
+func StartLANTransferServer(port int) (*LANTransferStatus, error) {
+	if port == 0 {
+		port = defaultLANTransferPort
+	}
+	if port < 1024 || port > 65535 {
+		return nil, fmt.Errorf("transfer port must be between 1024 and 65535")
+	}
+
+	lanTransferMu.Lock()
+	defer lanTransferMu.Unlock()
+	if lanTransferServer != nil {
+		return nil, fmt.Errorf("LAN transfer is already running on port %d", lanTransferStatus.Port)
+	}
+
+	token, err := newDebugToken()
+	if err != nil {
+		return nil, err
+	}
+	ips := localIPv4Addresses()
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no Wi-Fi or LAN connection to share downloads on")
+	}
+	var listeners []net.Listener
+	for _, ip := range ips {
+		listener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to start LAN transfer: %w", err)
+		}
+		listeners = append(listeners, listener)
+	}
+	label := newTraceID(4)
+	instance := "SpotiFLAC " + label[:4]
+
+	server := &http.Server{
+		Handler:           newLANTransferHandler(token, instance),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	lanTransferServer = server
+	lanTransferStatus = LANTransferStatus{
+		Running:  true,
+		Port:     port,
+		URLs:     lanTransferURLs(ips, port),
+		Token:    token,
+		Instance: instance,
+		Started:  time.Now().Unix(),
+	}
+
+	responder, err := startMDNSResponder(instance, "spotiflac-"+label, port)
+	if err != nil {
+		lanTransferStatus.MDNSError = err.Error()
+		GoLog("[LANTransfer] mDNS unavailable: %v\n", err)
+	} else {
+		lanTransferMDNS = responder
+		lanTransferStatus.MDNS = true
+	}
+
+	for _, listener := range listeners {
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				GoLog("[LANTransfer] Server stopped: %v\n", err)
+			}
+		}()
+	}
+	GoLog("[LANTransfer] Listening on port %d (%s)\n", port, strings.Join(lanTransferStatus.URLs, ", "))
+
+	status := lanTransferStatus
+	return &status, nil
+}
+
+func StopLANTransferServer() error {
+	lanTransferMu.Lock()
+	server, responder := lanTransferServer, lanTransferMDNS
+	lanTransferServer, lanTransferMDNS = nil, nil
+	lanTransferStatus = LANTransferStatus{}
+	lanTransferMu.Unlock()
+
+	if responder != nil {
+		responder.Close()
+	}
+	if server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		// A desktop may be halfway through a large file.
+		return server.Close()
+	}
+	GoLog("[LANTransfer] Stopped\n")
+	return nil
+}
+
+func GetLANTransferStatus() LANTransferStatus {
+	lanTransferMu.Lock()
+	defer lanTransferMu.Unlock()
+	return lanTransferStatus
+}
@@ -0,0 +1,169 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestLANTransferHandler(t *testing.T) {
+	if err := SetDownloadHistoryDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer SetDownloadHistoryDir(t.TempDir())
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "01 - First.flac")
+	if err := os.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	history := []DownloadHistoryRecord{
+		{ItemID: "a", Title: "First", FilePath: path, DownloadedAt: 10},
+		{ItemID: "gone", FilePath: filepath.Join(dir, "gone.flac"), DownloadedAt: 11},
+		{ItemID: "again", Title: "First", FilePath: path, DownloadedAt: 12},
+	}
+	data, _ := json.Marshal(history)
+	if _, err := ImportDownloadHistoryJSON(string(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(newLANTransferHandler("secret", "SpotiFLAC test"))
+	defer server.Close()
+	get := func(path string, header http.Header) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := get("/files?token=wrong", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong token: status %d", resp.StatusCode)
+	}
+
+	resp = get("/files", http.Header{"Authorization": {"Bearer secret"}})
+	var files []LANTransferFile
+	json.NewDecoder(resp.Body).Decode(&files)
+	resp.Body.Close()
+	if len(files) != 1 || files[0].ID != lanTransferFileID(path) || files[0].SizeBytes != 10 || files[0].DownloadedAt != 12 {
+		t.Fatalf("unexpected listing: %+v", files)
+	}
+
+	resp = get("/files?token=secret&since=12", nil)
+	json.NewDecoder(resp.Body).Decode(&files)
+	resp.Body.Close()
+	if len(files) != 0 {
+		t.Fatalf("since filter ignored: %+v", files)
+	}
+
+	resp = get("/files/"+lanTransferFileID(path)+"?token=secret", http.Header{"Range": {"bytes=4-"}})
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "456789" {
+		t.Fatalf("range request: status %d body %q", resp.StatusCode, body)
+	}
+
+	// A download finished after the listing is still found by its ID.
+	later := filepath.Join(dir, "02 - Second.flac")
+	if err := os.WriteFile(later, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = json.Marshal([]DownloadHistoryRecord{{ItemID: "b", Title: "Second", FilePath: later, DownloadedAt: 13}})
+	if _, err := ImportDownloadHistoryJSON(string(data)); err != nil {
+		t.Fatal(err)
+	}
+	resp = get("/files/"+lanTransferFileID(later)+"?token=secret", nil)
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "abc" {
+		t.Fatalf("new download: status %d body %q", resp.StatusCode, body)
+	}
+
+	resp = get("/files/"+lanTransferFileID("/etc/passwd")+"?token=secret", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("path outside history served: status %d", resp.StatusCode)
+	}
+}
+
+func TestIsMobileDataInterface(t *testing.T) {
+	for name, want := range map[string]bool{
+		"wlan0": false, "eth0": false, "ap0": false,
+		"rmnet_data0": true, "ccmni1": true, "v4-rmnet_data2": true, "clat4": true, "wwan0": true,
+	} {
+		if got := isMobileDataInterface(name); got != want {
+			t.Errorf("isMobileDataInterface(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestMDNSServiceRespond(t *testing.T) {
+	service := newMDNSService("SpotiFLAC ab12", "spotiflac-ab12cd34", 48221, []net.IP{net.IPv4(192, 168, 1, 20)})
+
+	query := func(name string, qtype dnsmessage.Type) []byte {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 7})
+		b.StartQuestions()
+		b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET})
+		packet, err := b.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packet
+	}
+
+	reply, unicast := service.respond(query(lanTransferServiceType, dnsmessage.TypePTR), mdnsPort)
+	if reply == nil || unicast {
+		t.Fatalf("PTR query: reply=%v unicast=%v", reply != nil, unicast)
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Questions) != 0 || len(msg.Answers) != 1 || len(msg.Additionals) != 3 {
+		t.Fatalf("unexpected sections: %+v", msg)
+	}
+	if ptr := msg.Answers[0].Body.(*dnsmessage.PTRResource); ptr.PTR.String() != "SpotiFLAC ab12."+lanTransferServiceType {
+		t.Fatalf("PTR points to %s", ptr.PTR)
+	}
+	var sawSRV, sawA bool
+	for _, r := range msg.Additionals {
+		switch body := r.Body.(type) {
+		case *dnsmessage.SRVResource:
+			sawSRV = body.Port == 48221 && body.Target.String() == "spotiflac-ab12cd34.local."
+		case *dnsmessage.AResource:
+			sawA = body.A == [4]byte{192, 168, 1, 20}
+		}
+	}
+	if !sawSRV || !sawA {
+		t.Fatalf("missing SRV or A record: %+v", msg.Additionals)
+	}
+
+	// Legacy one-shot resolvers get a unicast reply echoing ID and question.
+	reply, unicast = service.respond(query("spotiflac-ab12cd34.local.", dnsmessage.TypeA), 53000)
+	if reply == nil || !unicast {
+		t.Fatal("legacy A query not answered by unicast")
+	}
+	if err := msg.Unpack(reply); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 7 || len(msg.Questions) != 1 || len(msg.Answers) != 1 {
+		t.Fatalf("unexpected legacy reply: %+v", msg)
+	}
+
+	if reply, _ := service.respond(query("_other._tcp.local.", dnsmessage.TypePTR), mdnsPort); reply != nil {
+		t.Fatal("answered a query for another service")
+	}
+}
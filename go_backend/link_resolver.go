@@ -0,0 +1,171 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ==================== Universal link resolver ====================
+//
+// ResolveMusicLink turns a track link from Apple Music, YouTube (Music),
+// Tidal, Qobuz, Deezer or Spotify into canonical track metadata so it can be
+// downloaded through whatever providers the user has configured. Deezer links
+// are read directly. Everything else is cross-looked-up through SongLink
+// (Odesli), and the Deezer match it returns supplies the metadata and ISRC,
+// with Spotify as the fallback when SongLink has no Deezer match.
+
+const linkResolveTimeout = 20 * time.Second
+
+type ResolvedMusicLink struct {
+	Input        string             `json:"input"`
+	Service      string             `json:"service"`
+	Type         string             `json:"type"`
+	Via          string             `json:"via"`
+	SpotifyID    string             `json:"spotify_id,omitempty"`
+	DeezerID     string             `json:"deezer_id,omitempty"`
+	ISRC         string             `json:"isrc,omitempty"`
+	Track        *TrackMetadata     `json:"track,omitempty"`
+	Availability *TrackAvailability `json:"availability,omitempty"`
+}
+
+// classifyMusicLink extends classifyImportURL with the track forms it
+// reports as albums: Apple Music album URLs with ?i=<track id>.
+func classifyMusicLink(raw string) (service, itemType string) {
+	service, itemType = classifyImportURL(raw)
+	if service == "apple_music" {
+		if u, err := url.Parse(raw); err == nil {
+			if u.Query().Get("i") != "" || strings.Contains(u.Path, "/song/") {
+				itemType = "track"
+			}
+		}
+	}
+	return service, itemType
+}
+
+func resolveDeezerTrackLink(ctx context.Context, resolved *ResolvedMusicLink, trackID string) error {
+	track, err := GetDeezerClient().GetTrack(ctx, trackID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch Deezer track %s: %w", trackID, err)
+	}
+	resolved.DeezerID = trackID
+	resolved.Track = &track.Track
+	resolved.ISRC = track.Track.ISRC
+	return nil
+}
+
+func resolveSpotifyTrackLink(ctx context.Context, resolved *ResolvedMusicLink) error {
+	client, err := NewSpotifyMetadataClient()
+	if err != nil {
+		return err
+	}
+	data, err := client.GetFilteredData(ctx, "spotify:track:"+resolved.SpotifyID, false, 0)
+	if err != nil {
+		return fmt.Errorf("failed to fetch Spotify track %s: %w", resolved.SpotifyID, err)
+	}
+	track, ok := data.(*TrackResponse)
+	if !ok {
+		return fmt.Errorf("unexpected Spotify response for track %s", resolved.SpotifyID)
+	}
+	resolved.Track = &track.Track
+	if resolved.ISRC == "" {
+		resolved.ISRC = track.Track.ISRC
+	}
+	return nil
+}
+
+func resolveMusicLink(ctx context.Context, input string) (*ResolvedMusicLink, error) {
+	input = strings.TrimRight(strings.TrimSpace(input), ".,;)]")
+	if input == "" {
+		return nil, fmt.Errorf("link is required")
+	}
+
+	service, itemType := classifyMusicLink(input)
+	resolved := &ResolvedMusicLink{Input: input, Service: service, Type: itemType}
+
+	switch service {
+	case "unknown":
+		return nil, fmt.Errorf("unsupported link: %s", input)
+	case "songlink":
+		// song.link pages wrap another link; SongLink resolves them itself.
+		resolved.Type = "track"
+	case "spotify":
+		link, err := parseSpotifyLink(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		resolved.Type = link.Type
+		resolved.SpotifyID = link.ID
+	}
+	if resolved.Type != "track" {
+		return nil, fmt.Errorf("only track links can be resolved, got %q", resolved.Type)
+	}
+
+	if service == "deezer" {
+		if kind, id, err := parseDeezerURL(input); err == nil && kind == "track" {
+			resolved.Via = "deezer"
+			if err := resolveDeezerTrackLink(ctx, resolved, id); err != nil {
+				return nil, err
+			}
+			return resolved, nil
+		}
+	}
+
+	client := NewSongLinkClient()
+	var availability *TrackAvailability
+	var err error
+	if resolved.SpotifyID != "" {
+		availability, err = client.CheckAvailabilityByPlatform("spotify", "song", resolved.SpotifyID)
+	} else {
+		availability, err = client.CheckAvailabilityFromURL(input)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve link: %w", err)
+	}
+	resolved.Via = "songlink"
+	resolved.Availability = availability
+	if resolved.SpotifyID == "" {
+		resolved.SpotifyID = availability.SpotifyID
+	}
+
+	if availability.DeezerID != "" && isNumeric(availability.DeezerID) {
+		if err := resolveDeezerTrackLink(ctx, resolved, availability.DeezerID); err != nil {
+			GoLog("[LinkResolver] %v\n", err)
+		} else {
+			resolved.Via = "songlink+deezer"
+		}
+	}
+	if resolved.Track == nil && resolved.SpotifyID != "" {
+		if err := resolveSpotifyTrackLink(ctx, resolved); err != nil {
+			GoLog("[LinkResolver] %v\n", err)
+		} else {
+			resolved.Via = "songlink+spotify"
+		}
+	}
+	if resolved.Track == nil {
+		return nil, fmt.Errorf("no Deezer or Spotify metadata for %s", input)
+	}
+
+	GoLog("[LinkResolver] %s link resolved via %s (deezer=%s spotify=%s isrc=%s)\n",
+		service, resolved.Via, resolved.DeezerID, resolved.SpotifyID, resolved.ISRC)
+	return resolved, nil
+}
+
+// ResolveMusicLink returns a ResolvedMusicLink as JSON.
+func ResolveMusicLink(input string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), linkResolveTimeout)
+	defer cancel()
+
+	resolved, err := resolveMusicLink(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(resolved)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,33 @@
+package gobackend
+
+import (
+	"context"
+	"testing"
+)
+
+func TestClassifyMusicLink(t *testing.T) {
+	cases := []struct {
+		input, service, itemType string
+	}{
+		{"https://music.apple.com/us/album/some-album/1440857781?i=1440857795", "apple_music", "track"},
+		{"https://music.apple.com/us/song/some-song/1440857795", "apple_music", "track"},
+		{"https://music.apple.com/us/album/some-album/1440857781", "apple_music", "album"},
+		{"https://tidal.com/browse/track/77646170", "tidal", "track"},
+		{"https://www.deezer.com/en/track/3135556", "deezer", "track"},
+		{"https://music.youtube.com/watch?v=dQw4w9WgXcQ", "youtube", "track"},
+	}
+	for _, tc := range cases {
+		service, itemType := classifyMusicLink(tc.input)
+		if service != tc.service || itemType != tc.itemType {
+			t.Errorf("%s = %s/%s, want %s/%s", tc.input, service, itemType, tc.service, tc.itemType)
+		}
+	}
+}
+
+func TestResolveMusicLinkRejectsNonTracks(t *testing.T) {
+	for _, input := range []string{"", "https://example.com/x", "https://tidal.com/browse/album/77646168"} {
+		if _, err := resolveMusicLink(context.Background(), input); err == nil {
+			t.Errorf("%q resolved without error", input)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package gobackend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== ListenBrainz ====================
+//
+// With record_downloads on, every finished download is logged as a
+// ListenBrainz listen (one JSON object per line, the format ListenBrainz
+// exports and imports) tagged "downloaded". The log can be exported as is
+// or submitted to ListenBrainz, or a self-hosted instance, as an "import";
+// with auto_submit the pending listens go out when a download batch
+// finishes. These are not real plays, so the feature is off by default.
+//
+// The log, a submitted-count cursor and the encrypted user token live in
+// <integrations dir>/listenbrainz.
+
+const (
+	defaultListenBrainzAPIURL  = "https://api.listenbrainz.org"
+	listenBrainzCredentialsID  = "listenbrainz"
+	listenBrainzLogFile        = "listens.jsonl"
+	listenBrainzCursorFile     = "submitted"
+	listenBrainzSubmitChunk    = 100
+	listenBrainzRequestTimeout = 30 * time.Second
+)
+
+// ListenBrainzConfig lives in BackendConfig under listenbrainz.
+type ListenBrainzConfig struct {
+	RecordDownloads bool   `json:"record_downloads"`
+	AutoSubmit      bool   `json:"auto_submit"`
+	APIURL          string `json:"api_url"`
+}
+
+func defaultListenBrainzConfig() ListenBrainzConfig {
+	return ListenBrainzConfig{APIURL: defaultListenBrainzAPIURL}
+}
+
+func (c *ListenBrainzConfig) validate() error {
+	c.APIURL = strings.TrimRight(strings.TrimSpace(c.APIURL), "/")
+	if c.APIURL == "" {
+		c.APIURL = defaultListenBrainzAPIURL
+	}
+	parsed, err := url.Parse(c.APIURL)
+	if err != nil || parsed.Host == "" || parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return fmt.Errorf("listenbrainz.api_url must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// ListenBrainzListen is one listen in ListenBrainz's JSON format.
+type ListenBrainzListen struct {
+	ListenedAt    int64                     `json:"listened_at"`
+	TrackMetadata ListenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type ListenBrainzTrackMetadata struct {
+	ArtistName     string                 `json:"artist_name"`
+	TrackName      string                 `json:"track_name"`
+	ReleaseName    string                 `json:"release_name,omitempty"`
+	AdditionalInfo map[string]interface{} `json:"additional_info,omitempty"`
+}
+
+type ListenBrainzExportResult struct {
+	Listens      int   `json:"listens"`
+	BytesWritten int64 `json:"bytes_written"`
+}
+
+type ListenBrainzSubmitResult struct {
+	Submitted int `json:"submitted"`
+	Pending   int `json:"pending"`
+}
+
+var (
+	// listenBrainzMu guards the log and cursor files.
+	listenBrainzMu       sync.Mutex
+	listenBrainzSubmitMu sync.Mutex
+)
+
+func listenBrainzDir() (string, error) {
+	integrationsMu.Lock()
+	dir := integrationsDir
+	integrationsMu.Unlock()
+	if dir == "" {
+		return "", fmt.Errorf("integrations dir not set")
+	}
+	dir = filepath.Join(dir, listenBrainzCredentialsID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// listenFromDownload builds the listen for a finished download, or nil when
+// the download produced no new file.
+func listenFromDownload(req DownloadRequest, resp DownloadResponse, at time.Time) *ListenBrainzListen {
+	if !resp.Success || resp.AlreadyExists || strings.HasPrefix(resp.FilePath, "EXISTS:") {
+		return nil
+	}
+	title := firstNonEmpty(resp.Title, req.TrackName)
+	artist := firstNonEmpty(resp.Artist, req.ArtistName)
+	if title == "" || artist == "" {
+		return nil
+	}
+
+	info := map[string]interface{}{
+		"submission_client": "SpotiFLAC",
+		"media_player":      "SpotiFLAC",
+		"tags":              []string{"downloaded"},
+	}
+	if isrc := firstNonEmpty(resp.ISRC, req.ISRC); isrc != "" {
+		info["isrc"] = isrc
+	}
+	if duration := max(resp.DurationMS, req.DurationMS); duration > 0 {
+		info["duration_ms"] = duration
+	}
+	if req.TrackNumber > 0 {
+		info["tracknumber"] = strconv.Itoa(req.TrackNumber)
+	}
+	if req.DiscNumber > 0 {
+		info["discnumber"] = strconv.Itoa(req.DiscNumber)
+	}
+	if req.SpotifyID != "" {
+		info["spotify_id"] = "https://open.spotify.com/track/" + req.SpotifyID
+	}
+	if service := strings.ToLower(firstNonEmpty(resp.Service, req.Service)); service != "" {
+		info["music_service_name"] = service
+	}
+
+	return &ListenBrainzListen{
+		ListenedAt: at.Unix(),
+		TrackMetadata: ListenBrainzTrackMetadata{
+			ArtistName:     artist,
+			TrackName:      title,
+			ReleaseName:    firstNonEmpty(resp.Album, req.AlbumName),
+			AdditionalInfo: info,
+		},
+	}
+}
+
+// recordListenBrainzDownload appends a "downloaded" listen to the log.
+func recordListenBrainzDownload(req DownloadRequest, respJSON string) {
+	if !GetBackendConfig().ListenBrainz.RecordDownloads {
+		return
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil {
+		return
+	}
+	listen := listenFromDownload(req, resp, statsNow())
+	if listen == nil {
+		return
+	}
+	line, err := json.Marshal(listen)
+	if err != nil {
+		return
+	}
+
+	listenBrainzMu.Lock()
+	defer listenBrainzMu.Unlock()
+	dir, err := listenBrainzDir()
+	if err != nil {
+		GoLog("[ListenBrainz] Not recording download: %v\n", err)
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(dir, listenBrainzLogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		GoLog("[ListenBrainz] Failed to record download: %v\n", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(line, '\n'))
+}
+
+// loadListenBrainzLogLocked returns the logged listens and how many of them
+// were already submitted.
+func loadListenBrainzLogLocked() ([]ListenBrainzListen, int, error) {
+	dir, err := listenBrainzDir()
+	if err != nil {
+		return nil, 0, err
+	}
+	var listens []ListenBrainzListen
+	f, err := os.Open(filepath.Join(dir, listenBrainzLogFile))
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var listen ListenBrainzListen
+			if json.Unmarshal(scanner.Bytes(), &listen) == nil {
+				listens = append(listens, listen)
+			}
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, 0, err
+	}
+
+	submitted := 0
+	if data, err := os.ReadFile(filepath.Join(dir, listenBrainzCursorFile)); err == nil {
+		submitted, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	return listens, min(max(submitted, 0), len(listens)), nil
+}
+
+func saveListenBrainzCursorLocked(submitted int) error {
+	dir, err := listenBrainzDir()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, listenBrainzCursorFile), []byte(strconv.Itoa(submitted)), 0644)
+}
+
+// ExportListenBrainzListens writes the logged listens newer than since (unix
+// seconds, 0 for all) as JSON lines to outputPath or outputFD.
+func ExportListenBrainzListens(outputPath string, outputFD int, since int64) (*ListenBrainzExportResult, error) {
+	adoptOutputFD(outputFD, "")
+	defer closeOwnedOutputFD(outputFD)
+
+	if strings.TrimSpace(outputPath) == "" && !isFDOutput(outputFD) {
+		return nil, fmt.Errorf("output_path or output_fd is required")
+	}
+	listenBrainzMu.Lock()
+	listens, _, err := loadListenBrainzLogLocked()
+	listenBrainzMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := openOutputForWrite(outputPath, outputFD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open export output: %w", err)
+	}
+	counter := &countingWriter{w: out}
+	w := bufio.NewWriter(counter)
+	result := &ListenBrainzExportResult{}
+	for _, listen := range listens {
+		if listen.ListenedAt <= since {
+			continue
+		}
+		line, err := json.Marshal(listen)
+		if err != nil {
+			continue
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+		result.Listens++
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		cleanupOutputOnError(outputPath, outputFD)
+		return nil, fmt.Errorf("failed to write export: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		cleanupOutputOnError(outputPath, outputFD)
+		return nil, fmt.Errorf("failed to close export: %w", err)
+	}
+	result.BytesWritten = counter.n
+	return result, nil
+}
+
+type listenBrainzClient struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+func newListenBrainzClient(token string) *listenBrainzClient {
+	return &listenBrainzClient{
+		apiURL: GetBackendConfig().ListenBrainz.APIURL,
+		token:  token,
+		client: NewHTTPClientWithTimeout(listenBrainzRequestTimeout),
+	}
+}
+
+func (c *listenBrainzClient) do(method, path string, body interface{}, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.apiURL+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Error string `json:"error"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		json.NewDecoder(resp.Body).Decode(&result)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return fmt.Errorf("%s: rate limited, retry in %ss", path, firstNonEmpty(resp.Header.Get("X-RateLimit-Reset-In"), "?"))
+		}
+		return fmt.Errorf("%s: HTTP %d %s", path, resp.StatusCode, result.Error)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// SetListenBrainzToken checks token against the server and stores it
+// encrypted. It returns the ListenBrainz user name.
+func SetListenBrainzToken(token string) (string, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("token is required")
+	}
+	var result struct {
+		Valid    bool   `json:"valid"`
+		UserName string `json:"user_name"`
+	}
+	if err := newListenBrainzClient(token).do(http.MethodGet, "/1/validate-token", nil, &result); err != nil {
+		return "", err
+	}
+	if !result.Valid {
+		return "", fmt.Errorf("invalid ListenBrainz token")
+	}
+	dir, err := listenBrainzDir()
+	if err != nil {
+		return "", err
+	}
+	if err := writeCredentialsFile(listenBrainzCredentialsID, dir, map[string]interface{}{"token": token}); err != nil {
+		return "", err
+	}
+	return result.UserName, nil
+}
+
+func loadListenBrainzToken() (string, error) {
+	dir, err := listenBrainzDir()
+	if err != nil {
+		return "", err
+	}
+	creds, err := readCredentialsFile(listenBrainzCredentialsID, dir)
+	if err != nil {
+		return "", err
+	}
+	token, _ := creds["token"].(string)
+	if token == "" {
+		return "", fmt.Errorf("no ListenBrainz token stored")
+	}
+	return token, nil
+}
+
+// SubmitListenBrainzListens submits the listens logged since the last
+// submission. The cursor advances per accepted chunk, so after a failure
+// halfway only the rejected chunk and the rest are sent again.
+func SubmitListenBrainzListens() (*ListenBrainzSubmitResult, error) {
+	token, err := loadListenBrainzToken()
+	if err != nil {
+		return nil, err
+	}
+	client := newListenBrainzClient(token)
+
+	// Downloads keep appending to the log while a submission is on the
+	// network; only the cursor needs to be serialized.
+	listenBrainzSubmitMu.Lock()
+	defer listenBrainzSubmitMu.Unlock()
+	listenBrainzMu.Lock()
+	listens, submitted, err := loadListenBrainzLogLocked()
+	listenBrainzMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	result := &ListenBrainzSubmitResult{Pending: len(listens) - submitted}
+	for submitted < len(listens) {
+		chunk := listens[submitted:min(submitted+listenBrainzSubmitChunk, len(listens))]
+		body := map[string]interface{}{"listen_type": "import", "payload": chunk}
+		if err := client.do(http.MethodPost, "/1/submit-listens", body, nil); err != nil {
+			return result, err
+		}
+		submitted += len(chunk)
+		listenBrainzMu.Lock()
+		err := saveListenBrainzCursorLocked(submitted)
+		listenBrainzMu.Unlock()
+		if err != nil {
+			return result, err
+		}
+		result.Submitted += len(chunk)
+		result.Pending -= len(chunk)
+	}
+	if result.Submitted > 0 {
+		GoLog("[ListenBrainz] Submitted %d listens\n", result.Submitted)
+	}
+	return result, nil
+}
+
+// runListenBrainzIntegration submits pending listens after a batch when
+// auto_submit is on. It returns nil when there was nothing to do.
+func runListenBrainzIntegration(summary *BatchSummary) *IntegrationStatus {
+	cfg := GetBackendConfig().ListenBrainz
+	if !cfg.RecordDownloads || !cfg.AutoSubmit || summary.Completed == 0 {
+		return nil
+	}
+	status := &IntegrationStatus{Name: "listenbrainz", Status: IntegrationOK}
+	result, err := SubmitListenBrainzListens()
+	if result != nil {
+		status.Submitted = result.Submitted
+	}
+	if err != nil {
+		status.Status = IntegrationFailed
+		if status.Submitted > 0 {
+			status.Status = IntegrationPartial
+		}
+		status.Error = err.Error()
+		GoLog("[ListenBrainz] %v\n", err)
+	}
+	return status
+}
@@ -0,0 +1,156 @@
+package gobackend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListenBrainzRecordExportAndSubmit(t *testing.T) {
+	var mu sync.Mutex
+	var submitted []ListenBrainzListen
+	rateLimited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Token lb-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":401,"error":"Invalid authorization token."}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/1/validate-token":
+			w.Write([]byte(`{"code":200,"valid":true,"user_name":"alpha"}`))
+		case "/1/submit-listens":
+			if rateLimited {
+				w.Header().Set("X-RateLimit-Reset-In", "7")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			var body struct {
+				ListenType string               `json:"listen_type"`
+				Payload    []ListenBrainzListen `json:"payload"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.ListenType != "import" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			submitted = append(submitted, body.Payload...)
+			w.Write([]byte(`{"status":"ok"}`))
+		}
+	}))
+	defer server.Close()
+
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+	cfg := original
+	cfg.ListenBrainz = ListenBrainzConfig{RecordDownloads: true, APIURL: server.URL + "/"}
+	if err := UpdateBackendConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetIntegrationsDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	prevNow := statsNow
+	now := time.Unix(1700000000, 0)
+	statsNow = func() time.Time { return now }
+	defer func() { statsNow = prevNow }()
+
+	record := func(title string, resp DownloadResponse) {
+		resp.Title = title
+		data, _ := json.Marshal(resp)
+		recordListenBrainzDownload(DownloadRequest{ArtistName: "Alpha", AlbumName: "One", SpotifyID: "abc", TrackNumber: 3, DurationMS: 61000}, string(data))
+		now = now.Add(time.Minute)
+	}
+	record("First", DownloadResponse{Success: true, FilePath: "/music/first.flac", ISRC: "USAAA0000001"})
+	record("Skipped", DownloadResponse{Success: true, FilePath: "EXISTS:/music/skipped.flac"})
+	record("Failed", DownloadResponse{Success: false})
+	record("Second", DownloadResponse{Success: true, FilePath: "/music/second.flac"})
+
+	exportPath := filepath.Join(t.TempDir(), "listens.jsonl")
+	result, err := ExportListenBrainzListens(exportPath, 0, 1700000000)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if result.Listens != 1 {
+		t.Fatalf("since filter: exported %d listens", result.Listens)
+	}
+	f, err := os.Open(exportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	var listen ListenBrainzListen
+	if err := json.Unmarshal(scanner.Bytes(), &listen); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	info := listen.TrackMetadata.AdditionalInfo
+	if listen.TrackMetadata.TrackName != "Second" || listen.TrackMetadata.ArtistName != "Alpha" || listen.TrackMetadata.ReleaseName != "One" ||
+		info["spotify_id"] != "https://open.spotify.com/track/abc" || info["tracknumber"] != "3" || info["duration_ms"] != float64(61000) {
+		t.Fatalf("unexpected listen: %+v", listen)
+	}
+
+	if _, err := SetListenBrainzToken("bad"); err == nil {
+		t.Fatal("invalid token accepted")
+	}
+	if user, err := SetListenBrainzToken("lb-token"); err != nil || user != "alpha" {
+		t.Fatalf("SetListenBrainzToken = %q, %v", user, err)
+	}
+
+	got, err := SubmitListenBrainzListens()
+	if err != nil || got.Submitted != 2 || got.Pending != 0 || len(submitted) != 2 || submitted[0].TrackMetadata.TrackName != "First" {
+		t.Fatalf("first submit: %+v, %v, %+v", got, err, submitted)
+	}
+
+	record("Third", DownloadResponse{Success: true, FilePath: "/music/third.flac"})
+	rateLimited = true
+	got, err = SubmitListenBrainzListens()
+	if err == nil || got.Pending != 1 {
+		t.Fatalf("rate limited submit: %+v, %v", got, err)
+	}
+	rateLimited = false
+	got, err = SubmitListenBrainzListens()
+	if err != nil || got.Submitted != 1 || len(submitted) != 3 || submitted[2].TrackMetadata.TrackName != "Third" {
+		t.Fatalf("resumed submit: %+v, %v", got, err)
+	}
+}
+
+func TestListenBrainzTokenFollowsLock(t *testing.T) {
+	loadCredentialLock(t.TempDir())
+	defer loadCredentialLock(t.TempDir())
+	defer SetCredentialUnlocker(nil)
+
+	if err := SetIntegrationsDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := listenBrainzDir()
+	if err := writeCredentialsFile(listenBrainzCredentialsID, dir, map[string]interface{}{"token": "lb-token"}); err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, credentialUnlockKeySize))
+	SetCredentialUnlocker(&fakeUnlocker{key: key})
+	if err := EnableCredentialLock(key, 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(credentialsFilePath(dir)); !isLockedCredentials(data) {
+		t.Fatal("ListenBrainz token was not sealed under the lock")
+	}
+	if err := DisableCredentialLock(); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := loadListenBrainzToken(); err != nil || token != "lb-token" {
+		t.Fatalf("token unreadable after unlocking: %q %v", token, err)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build android && cgo
+
+package gobackend
+
+/*
+#cgo LDFLAGS: -llog
+#include <android/log.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import "unsafe"
+
+type logcatSink struct {
+	tag *C.char
+}
+
+func newLogcatSink(tag string) (LogSink, error) {
+	return &logcatSink{tag: C.CString(tag)}, nil
+}
+
+func (s *logcatSink) Write(entry LogEntry) {
+	msg := C.CString("[" + entry.Tag + "] " + entry.Message)
+	C.__android_log_write(C.int(logcatPriority(entry.Level)), s.tag, msg)
+	C.free(unsafe.Pointer(msg))
+}
+
+func (s *logcatSink) Close() error {
+	if s.tag != nil {
+		C.free(unsafe.Pointer(s.tag))
+		s.tag = nil
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !android || !cgo
+
+package gobackend
+
+import "errors"
+
+func newLogcatSink(tag string) (LogSink, error) {
+	return nil, errors.New("logcat sink is only available on Android")
+}
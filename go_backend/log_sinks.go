@@ -0,0 +1,446 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Log sinks ====================
+//
+// Every entry that passes the LogBuffer gate is handed to the active sinks:
+//
+//	memory  the ring buffer behind GetLogs and the UI console (default on)
+//	stdout  fmt.Printf, which gomobile forwards to logcat as INFO (default on)
+//	file    a rotating file, rotated by size and pruned by age and count
+//	logcat  __android_log_write with the entry's priority (Android only)
+//	events  "log" events on the event bus, dropped first when the sink lags
+//
+// Sinks are reconfigured at runtime with SetLogSinksJSON. When logcat is
+// enabled, stdout should usually be disabled so lines are not logged twice.
+
+const (
+	defaultLogFileMaxSizeMB = 5
+	defaultLogFileMaxFiles  = 5
+	defaultLogcatTag        = "SpotiFLAC"
+
+	// maxPendingLogLines bounds what the file sink queues while the disk
+	// is slow; lines beyond it are counted and reported as dropped.
+	maxPendingLogLines = 4096
+	logFileTimeFormat  = "2006-01-02 15:04:05.000"
+)
+
+var logLevelRank = map[string]int{"DEBUG": 0, "INFO": 1, "WARN": 2, "ERROR": 3, "FATAL": 4}
+
+// LogSink receives sanitized entries; Write is called with the LogBuffer
+// lock held, so entries arrive in order and Write must not block on I/O.
+type LogSink interface {
+	Write(entry LogEntry)
+	Close() error
+}
+
+// logSinkFlusher is implemented by sinks that write in the background.
+type logSinkFlusher interface {
+	Flush()
+}
+
+type MemoryLogSinkConfig struct {
+	Enabled    bool `json:"enabled"`
+	MaxEntries int  `json:"max_entries,omitempty"`
+}
+
+type StdoutLogSinkConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+type FileLogSinkConfig struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path,omitempty"`
+	// MinLevel drops entries below DEBUG, INFO, WARN or ERROR.
+	MinLevel   string `json:"min_level,omitempty"`
+	MaxSizeMB  int    `json:"max_size_mb,omitempty"`
+	MaxFiles   int    `json:"max_files,omitempty"`
+	MaxAgeDays int    `json:"max_age_days,omitempty"`
+}
+
+type LogcatSinkConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Tag      string `json:"tag,omitempty"`
+	MinLevel string `json:"min_level,omitempty"`
+}
+
+type EventsLogSinkConfig struct {
+	Enabled  bool   `json:"enabled"`
+	MinLevel string `json:"min_level,omitempty"`
+}
+
+type LogSinkConfig struct {
+	Memory MemoryLogSinkConfig `json:"memory"`
+	Stdout StdoutLogSinkConfig `json:"stdout"`
+	File   FileLogSinkConfig   `json:"file"`
+	Logcat LogcatSinkConfig    `json:"logcat"`
+	Events EventsLogSinkConfig `json:"events"`
+}
+
+func defaultLogSinkConfig() LogSinkConfig {
+	return LogSinkConfig{
+		Memory: MemoryLogSinkConfig{Enabled: true, MaxEntries: defaultLogBufferSize},
+		Stdout: StdoutLogSinkConfig{Enabled: true},
+	}
+}
+
+var (
+	logSinkConfigMu sync.Mutex
+	logSinkConfig   = defaultLogSinkConfig()
+)
+
+func logLevelAtLeast(level, min string) bool {
+	if min == "" {
+		return true
+	}
+	return logLevelRank[level] >= logLevelRank[min]
+}
+
+// levelFilterSink drops entries below a minimum level.
+type levelFilterSink struct {
+	LogSink
+	min string
+}
+
+func (s levelFilterSink) Write(entry LogEntry) {
+	if logLevelAtLeast(entry.Level, s.min) {
+		s.LogSink.Write(entry)
+	}
+}
+
+func (s levelFilterSink) Flush() {
+	if flusher, ok := s.LogSink.(logSinkFlusher); ok {
+		flusher.Flush()
+	}
+}
+
+type stdoutLogSink struct{}
+
+func (stdoutLogSink) Write(entry LogEntry) { fmt.Printf("[%s] %s\n", entry.Tag, entry.Message) }
+func (stdoutLogSink) Close() error         { return nil }
+
+type eventsLogSink struct{}
+
+func (eventsLogSink) Write(entry LogEntry) { emitBackendEvent("log", entry) }
+func (eventsLogSink) Close() error         { return nil }
+
+// ---- Rotating file sink ----
+
+// fileLogSink appends to a rotating file from its own goroutine. Write only
+// queues the formatted line, so a slow disk or a rotation never holds up
+// the LogBuffer lock and every other logger with it.
+type fileLogSink struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	maxAge   time.Duration
+
+	// file and size belong to the writer goroutine.
+	file *os.File
+	size int64
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	pending   []string
+	dropped   int
+	queued    int64
+	processed int64
+	closed    bool
+	done      chan struct{}
+}
+
+func newFileLogSink(cfg FileLogSinkConfig) (*fileLogSink, error) {
+	if cfg.MaxSizeMB <= 0 {
+		cfg.MaxSizeMB = defaultLogFileMaxSizeMB
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = defaultLogFileMaxFiles
+	}
+	s := &fileLogSink{
+		path:     cfg.Path,
+		maxSize:  int64(cfg.MaxSizeMB) << 20,
+		maxFiles: cfg.MaxFiles,
+		maxAge:   time.Duration(cfg.MaxAgeDays) * 24 * time.Hour,
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, err
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	s.prune()
+
+	s.cond = sync.NewCond(&s.mu)
+	s.done = make(chan struct{})
+	go s.run()
+	return s, nil
+}
+
+func (s *fileLogSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+func (s *fileLogSink) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
+
+// rotate shifts backend.log.N to .N+1, dropping the oldest, and starts a
+// fresh file.
+func (s *fileLogSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+	os.Remove(s.rotatedPath(s.maxFiles - 1))
+	for n := s.maxFiles - 2; n >= 1; n-- {
+		os.Rename(s.rotatedPath(n), s.rotatedPath(n+1))
+	}
+	if s.maxFiles > 1 {
+		os.Rename(s.path, s.rotatedPath(1))
+	} else {
+		os.Remove(s.path)
+	}
+	s.prune()
+	return s.open()
+}
+
+// prune removes rotated files older than maxAge.
+func (s *fileLogSink) prune() {
+	if s.maxAge <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-s.maxAge)
+	for n := 1; n < s.maxFiles; n++ {
+		if info, err := os.Stat(s.rotatedPath(n)); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(s.rotatedPath(n))
+		}
+	}
+}
+
+func (s *fileLogSink) Write(entry LogEntry) {
+	line := fmt.Sprintf("%s %-5s [%s] %s\n", entry.at.Format(logFileTimeFormat), entry.Level, entry.Tag, entry.Message)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if len(s.pending) < maxPendingLogLines {
+		s.pending = append(s.pending, line)
+	} else {
+		s.dropped++
+	}
+	s.queued++
+	s.cond.Broadcast()
+}
+
+// run writes queued lines in batches until the sink is closed.
+func (s *fileLogSink) run() {
+	defer close(s.done)
+
+	s.mu.Lock()
+	for {
+		for len(s.pending) == 0 && s.dropped == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		lines, dropped, closed, queued := s.pending, s.dropped, s.closed, s.queued
+		s.pending, s.dropped = nil, 0
+		s.mu.Unlock()
+
+		if dropped > 0 {
+			s.writeLine(fmt.Sprintf("%s WARN  [Log] %d lines dropped, the log file could not keep up\n", time.Now().Format(logFileTimeFormat), dropped))
+		}
+		for _, line := range lines {
+			s.writeLine(line)
+		}
+
+		s.mu.Lock()
+		s.processed = queued
+		s.cond.Broadcast()
+		if closed {
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (s *fileLogSink) writeLine(line string) {
+	if s.file == nil {
+		return
+	}
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			fmt.Printf("[Log] Failed to rotate %s: %v\n", s.path, err)
+			return
+		}
+	}
+	n, _ := s.file.WriteString(line)
+	s.size += int64(n)
+}
+
+// Flush waits until every line queued so far is on disk.
+func (s *fileLogSink) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for target := s.queued; s.processed < target; {
+		s.cond.Wait()
+	}
+}
+
+func (s *fileLogSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	<-s.done
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// logcatPriority maps a level to android/log.h's android_LogPriority.
+func logcatPriority(level string) int {
+	switch level {
+	case "DEBUG":
+		return 3
+	case "WARN":
+		return 5
+	case "ERROR":
+		return 6
+	case "FATAL":
+		return 7
+	}
+	return 4
+}
+
+func validateLogLevel(level string) (string, error) {
+	level = strings.ToUpper(strings.TrimSpace(level))
+	if _, ok := logLevelRank[level]; level != "" && !ok {
+		return "", fmt.Errorf("unknown log level: %q", level)
+	}
+	return level, nil
+}
+
+// SetLogSinks replaces the sink configuration. Sinks are built before the
+// old ones are closed, so a bad file path leaves logging unchanged.
+func SetLogSinks(cfg LogSinkConfig) error {
+	var err error
+	if cfg.File.MinLevel, err = validateLogLevel(cfg.File.MinLevel); err != nil {
+		return err
+	}
+	if cfg.Logcat.MinLevel, err = validateLogLevel(cfg.Logcat.MinLevel); err != nil {
+		return err
+	}
+	if cfg.Events.MinLevel, err = validateLogLevel(cfg.Events.MinLevel); err != nil {
+		return err
+	}
+	if cfg.Memory.MaxEntries <= 0 {
+		cfg.Memory.MaxEntries = defaultLogBufferSize
+	}
+	cfg.File.Path = strings.TrimSpace(cfg.File.Path)
+	if cfg.File.Enabled && cfg.File.Path == "" {
+		return fmt.Errorf("file sink needs a path")
+	}
+	if cfg.Logcat.Tag == "" {
+		cfg.Logcat.Tag = defaultLogcatTag
+	}
+
+	var sinks []LogSink
+	closeAll := func() {
+		for _, sink := range sinks {
+			sink.Close()
+		}
+	}
+	if cfg.Stdout.Enabled {
+		sinks = append(sinks, stdoutLogSink{})
+	}
+	if cfg.File.Enabled {
+		sink, err := newFileLogSink(cfg.File)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		sinks = append(sinks, levelFilterSink{LogSink: sink, min: cfg.File.MinLevel})
+	}
+	if cfg.Logcat.Enabled {
+		sink, err := newLogcatSink(cfg.Logcat.Tag)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		sinks = append(sinks, levelFilterSink{LogSink: sink, min: cfg.Logcat.MinLevel})
+	}
+	if cfg.Events.Enabled {
+		sinks = append(sinks, levelFilterSink{LogSink: eventsLogSink{}, min: cfg.Events.MinLevel})
+	}
+
+	logSinkConfigMu.Lock()
+	logSinkConfig = cfg
+	logSinkConfigMu.Unlock()
+
+	for _, old := range GetLogBuffer().setSinks(cfg.Memory, sinks) {
+		old.Close()
+	}
+	return nil
+}
+
+func GetLogSinks() LogSinkConfig {
+	logSinkConfigMu.Lock()
+	defer logSinkConfigMu.Unlock()
+	return logSinkConfig
+}
+
+func SetLogSinksJSON(configJSON string) error {
+	cfg := defaultLogSinkConfig()
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return fmt.Errorf("invalid log sink config: %w", err)
+	}
+	return SetLogSinks(cfg)
+}
+
+// LogFiles lists the file sink's current and rotated files, newest first.
+// Queued lines are flushed first so the files are complete when shared.
+func LogFiles() []string {
+	cfg := GetLogSinks()
+	if !cfg.File.Enabled {
+		return []string{}
+	}
+	GetLogBuffer().flushSinks()
+	matches, _ := filepath.Glob(cfg.File.Path + "*")
+	files := []string{}
+	for _, path := range matches {
+		if path == cfg.File.Path || strings.HasPrefix(path, cfg.File.Path+".") {
+			files = append(files, path)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return len(files[i]) < len(files[j]) || len(files[i]) == len(files[j]) && files[i] < files[j]
+	})
+	return files
+}
@@ -0,0 +1,83 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogSinks_FileRotationAndLevels(t *testing.T) {
+	lb := GetLogBuffer()
+	logging := lb.IsLoggingEnabled()
+	lb.SetLoggingEnabled(true)
+	defer lb.SetLoggingEnabled(logging)
+	defer SetLogSinks(defaultLogSinkConfig())
+
+	path := filepath.Join(t.TempDir(), "logs", "backend.log")
+	err := SetLogSinksJSON(`{"memory": {"enabled": true, "max_entries": 3}, "stdout": {"enabled": false},
+		"file": {"enabled": true, "path": "` + path + `", "min_level": "info", "max_files": 3}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg := GetLogSinks(); cfg.File.MinLevel != "INFO" || cfg.Stdout.Enabled {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	LogDebug("Sinks", "debug line")
+	LogInfo("Sinks", "access_token=secret123")
+	for i := 0; i < 4; i++ {
+		LogWarn("Sinks", "warn %d", i)
+	}
+
+	var entries []LogEntry
+	json.Unmarshal([]byte(GetLogs()), &entries)
+	if len(entries) != 3 || entries[2].Message != "warn 3" {
+		t.Errorf("memory sink kept %+v, want the last 3 entries", entries)
+	}
+
+	GetLogBuffer().flushSinks()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	if strings.Contains(content, "debug line") || strings.Contains(content, "secret123") {
+		t.Errorf("file sink wrote filtered or unredacted lines:\n%s", content)
+	}
+	if !strings.Contains(content, "INFO  [Sinks] access_token=[REDACTED]") || !strings.Contains(content, "WARN  [Sinks] warn 3") {
+		t.Errorf("file sink content:\n%s", content)
+	}
+
+	// Force rotation with a tiny limit: every line starts a new file and
+	// only max_files are kept.
+	sink, err := newFileLogSink(FileLogSinkConfig{Path: path, MaxFiles: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.maxSize = 10
+	for i := 0; i < 5; i++ {
+		sink.Write(LogEntry{Level: "INFO", Tag: "Rotate", Message: "line"})
+	}
+	sink.Close()
+	if files := LogFiles(); len(files) != 3 || files[0] != path || files[2] != path+".2" {
+		t.Errorf("log files = %v", files)
+	}
+}
+
+func TestLogSinks_RejectsBadConfig(t *testing.T) {
+	defer SetLogSinks(defaultLogSinkConfig())
+	for _, cfg := range []string{
+		`{"file": {"enabled": true}}`,
+		`{"file": {"enabled": true, "path": "/tmp/x.log", "min_level": "LOUD"}}`,
+		`{"logcat": {"enabled": true}}`, // not Android
+	} {
+		if err := SetLogSinksJSON(cfg); err == nil {
+			t.Errorf("expected %s to be rejected", cfg)
+		}
+	}
+	if logcatPriority("ERROR") != 6 || logcatPriority("whatever") != 4 {
+		t.Error("unexpected logcat priorities")
+	}
+}
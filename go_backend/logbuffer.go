@@ -14,6 +14,9 @@ type LogEntry struct {
 	Level     string `json:"level"`
 	Tag       string `json:"tag"`
 	Message   string `json:"message"`
+	Extension string `json:"extension,omitempty"`
+
+	at time.Time
 }
 
 type LogBuffer struct {
@@ -21,6 +24,9 @@ type LogBuffer struct {
 	maxSize        int
 	mu             sync.RWMutex
 	loggingEnabled bool
+	subscribers    map[chan LogEntry]struct{}
+	memoryEnabled  bool
+	sinks          []LogSink
 }
 
 const (
@@ -33,18 +39,26 @@ var (
 	logBufferOnce   sync.Once
 
 	authorizationBearerPattern = regexp.MustCompile(`(?i)\bAuthorization\b\s*[:=]\s*Bearer\s+[A-Za-z0-9._~+/\-]+=*`)
-	genericKeyValuePattern     = regexp.MustCompile(`(?i)\b(access[_\s-]?token|refresh[_\s-]?token|id[_\s-]?token|client[_\s-]?secret|authorization|password|api[_\s-]?key)\b(\s*[:=]\s*)([^\s,;]+)`)
-	queryTokenPattern          = regexp.MustCompile(`(?i)([?&](?:access_token|refresh_token|id_token|token|client_secret|api_key|apikey|password)=)[^&\s]+`)
+	genericKeyValuePattern     = regexp.MustCompile(`(?i)\b(access[_\s-]?token|refresh[_\s-]?token|id[_\s-]?token|client[_\s-]?secret|code[_\s-]?verifier|authorization|password|api[_\s-]?key|x-api-key)\b(\s*[:=]\s*)([^\s,;]+)`)
+	queryTokenPattern          = regexp.MustCompile(`(?i)([?&](?:access_token|refresh_token|id_token|token|client_secret|api_key|apikey|password|code|code_verifier|code_challenge|state|sig|signature|x-amz-signature|x-amz-credential|x-amz-security-token|policy|key-pair-id|hdnts|__token__)=)[^&\s"']+`)
+	jsonSecretPattern          = regexp.MustCompile(`(?i)("(?:access_token|refresh_token|id_token|client_secret|code_verifier|code_challenge|verifier|password|api_key|authorization|cookie)"\s*:\s*")[^"]*"`)
+	cookieHeaderPattern        = regexp.MustCompile(`(?i)\b((?:set-)?cookie\s*:\s*)[^\n]+`)
 	bearerTokenPattern         = regexp.MustCompile(`(?i)\bBearer\s+[A-Za-z0-9._~+/\-]+=*`)
 )
 
+// sanitizeSensitiveLogText redacts tokens, PKCE values, signed-URL query
+// parameters, cookies, secret-looking JSON fields and values held in an
+// extension's secrets vault. Every log entry passes through it before it is
+// buffered or printed.
 func sanitizeSensitiveLogText(message string) string {
 	redacted := message
 	redacted = authorizationBearerPattern.ReplaceAllString(redacted, "Authorization: Bearer [REDACTED]")
+	redacted = jsonSecretPattern.ReplaceAllString(redacted, `${1}[REDACTED]"`)
+	redacted = cookieHeaderPattern.ReplaceAllString(redacted, `${1}[REDACTED]`)
 	redacted = genericKeyValuePattern.ReplaceAllString(redacted, `${1}${2}[REDACTED]`)
 	redacted = queryTokenPattern.ReplaceAllString(redacted, `${1}[REDACTED]`)
 	redacted = bearerTokenPattern.ReplaceAllString(redacted, "Bearer [REDACTED]")
-	return redacted
+	return redactKnownSecrets(redacted)
 }
 
 func GetLogBuffer() *LogBuffer {
@@ -53,6 +67,8 @@ func GetLogBuffer() *LogBuffer {
 			entries:        make([]LogEntry, 0, defaultLogBufferSize),
 			maxSize:        defaultLogBufferSize,
 			loggingEnabled: false, // Default: disabled for performance (user can enable in settings)
+			memoryEnabled:  true,
+			sinks:          []LogSink{stdoutLogSink{}},
 		}
 	})
 	return globalLogBuffer
@@ -79,6 +95,11 @@ func (lb *LogBuffer) IsLoggingEnabled() bool {
 }
 
 func (lb *LogBuffer) Add(level, tag, message string) {
+	lb.AddFor(level, tag, "", message)
+}
+
+// AddFor is Add with the entry attributed to an extension.
+func (lb *LogBuffer) AddFor(level, tag, extensionID, message string) {
 	lb.mu.Lock()
 	defer lb.mu.Unlock()
 
@@ -89,19 +110,85 @@ func (lb *LogBuffer) Add(level, tag, message string) {
 	message = sanitizeSensitiveLogText(message)
 	message = truncateLogMessage(message)
 
+	now := time.Now()
 	entry := LogEntry{
-		Timestamp: time.Now().Format("15:04:05.000"),
+		Timestamp: now.Format("15:04:05.000"),
 		Level:     level,
 		Tag:       tag,
 		Message:   message,
+		Extension: extensionID,
+		at:        now,
 	}
 
-	if len(lb.entries) >= lb.maxSize {
-		lb.entries = lb.entries[1:]
+	if lb.memoryEnabled {
+		if len(lb.entries) >= lb.maxSize {
+			lb.entries = lb.entries[len(lb.entries)-lb.maxSize+1:]
+		}
+		lb.entries = append(lb.entries, entry)
+	}
+	for ch := range lb.subscribers {
+		select {
+		case ch <- entry:
+		default: // slow reader, drop rather than block logging
+		}
 	}
-	lb.entries = append(lb.entries, entry)
+	for _, sink := range lb.sinks {
+		sink.Write(entry)
+	}
+}
+
+// setSinks applies the memory settings and swaps the output sinks,
+// returning the previous ones for the caller to close.
+func (lb *LogBuffer) setSinks(memory MemoryLogSinkConfig, sinks []LogSink) []LogSink {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
 
-	fmt.Printf("[%s] %s\n", tag, message)
+	lb.memoryEnabled = memory.Enabled
+	lb.maxSize = memory.MaxEntries
+	if !memory.Enabled {
+		lb.entries = lb.entries[:0]
+	} else if len(lb.entries) > lb.maxSize {
+		lb.entries = append([]LogEntry(nil), lb.entries[len(lb.entries)-lb.maxSize:]...)
+	}
+	old := lb.sinks
+	lb.sinks = sinks
+	return old
+}
+
+// flushSinks waits for sinks that write in the background. The sinks are
+// flushed outside the lock so logging continues meanwhile.
+func (lb *LogBuffer) flushSinks() {
+	lb.mu.RLock()
+	sinks := append([]LogSink(nil), lb.sinks...)
+	lb.mu.RUnlock()
+
+	for _, sink := range sinks {
+		if flusher, ok := sink.(logSinkFlusher); ok {
+			flusher.Flush()
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every entry added from now on, and
+// a function that unsubscribes and closes it.
+func (lb *LogBuffer) Subscribe(buffer int) (<-chan LogEntry, func()) {
+	ch := make(chan LogEntry, buffer)
+	lb.mu.Lock()
+	if lb.subscribers == nil {
+		lb.subscribers = make(map[chan LogEntry]struct{})
+	}
+	lb.subscribers[ch] = struct{}{}
+	lb.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			lb.mu.Lock()
+			delete(lb.subscribers, ch)
+			lb.mu.Unlock()
+			close(ch)
+		})
+	}
 }
 
 func (lb *LogBuffer) GetAll() string {
@@ -51,6 +51,11 @@ type LyricsFetchOptions struct {
 	IncludeRomanizationNetease bool   `json:"include_romanization_netease"`
 	MultiPersonWordByWord      bool   `json:"multi_person_word_by_word"`
 	MusixmatchLanguage         string `json:"musixmatch_language,omitempty"`
+	// SecondaryLyrics embeds a "romanized" or "translated" version next to
+	// the original when the provider has one; SecondaryLyricsPrimary swaps
+	// which of the two lands in the main LYRICS tag.
+	SecondaryLyrics        string `json:"secondary_lyrics,omitempty"`
+	SecondaryLyricsPrimary bool   `json:"secondary_lyrics_primary,omitempty"`
 }
 
 var defaultLyricsFetchOptions = LyricsFetchOptions{
@@ -128,6 +133,10 @@ func normalizeLyricsFetchOptions(opts LyricsFetchOptions) LyricsFetchOptions {
 	if len(opts.MusixmatchLanguage) > 16 {
 		opts.MusixmatchLanguage = opts.MusixmatchLanguage[:16]
 	}
+	opts.SecondaryLyrics = normalizeSecondaryLyrics(opts.SecondaryLyrics)
+	if opts.SecondaryLyrics == "" {
+		opts.SecondaryLyricsPrimary = false
+	}
 	return opts
 }
 
@@ -139,11 +148,13 @@ func SetLyricsFetchOptions(opts LyricsFetchOptions) {
 	defer lyricsFetchOptionsMu.Unlock()
 	lyricsFetchOptions = normalized
 
-	GoLog("[Lyrics] Fetch options set: translation=%v romanization=%v multi_person=%v musixmatch_lang=%q\n",
+	GoLog("[Lyrics] Fetch options set: translation=%v romanization=%v multi_person=%v musixmatch_lang=%q secondary=%q secondary_primary=%v\n",
 		normalized.IncludeTranslationNetease,
 		normalized.IncludeRomanizationNetease,
 		normalized.MultiPersonWordByWord,
 		normalized.MusixmatchLanguage,
+		normalized.SecondaryLyrics,
+		normalized.SecondaryLyricsPrimary,
 	)
 }
 
@@ -258,6 +269,10 @@ type LyricsResponse struct {
 	PlainLyrics  string       `json:"plainLyrics"`
 	Provider     string       `json:"provider"`
 	Source       string       `json:"source"`
+	// Romanized and Translated hold alternate versions when the provider
+	// returns them; see splitDualLyrics.
+	Romanized  []LyricsLine `json:"romanizedLines,omitempty"`
+	Translated []LyricsLine `json:"translatedLines,omitempty"`
 }
 
 type LyricsClient struct {
@@ -411,15 +426,29 @@ func (c *LyricsClient) FetchLyricsAllSources(spotifyID, trackName, artistName st
 		return lyricsHasUsableText(l)
 	}
 
-	// Try extension lyrics providers first
+	// Ask every extension source first; their results are ranked together
+	// with the built-in cascade below rather than winning on arrival.
+	var extensionResults []*LyricsResponse
 	if len(extensionProviders) > 0 {
+		track := map[string]interface{}{
+			"id":          spotifyID,
+			"name":        trackName,
+			"artists":     artistName,
+			"duration_ms": int(durationSec * 1000),
+		}
 		for _, provider := range extensionProviders {
 			GoLog("[Lyrics] Trying extension lyrics provider: %s\n", provider.extension.ID)
-			lyrics, err := provider.FetchLyrics(trackName, artistName, "", durationSec)
+			var lyrics *LyricsResponse
+			var err error
+			if provider.extension.Manifest.HasLyricsSource() {
+				lyrics, err = provider.GetLyrics(track)
+			} else {
+				lyrics, err = provider.FetchLyrics(trackName, artistName, "", durationSec)
+			}
 			if err == nil && isValidResult(lyrics) {
 				GoLog("[Lyrics] Got lyrics from extension: %s\n", provider.extension.ID)
-				globalLyricsCache.Set(artistName, trackName, durationSec, lyrics)
-				return lyrics, nil
+				extensionResults = append(extensionResults, lyrics)
+				continue
 			}
 			if err != nil {
 				GoLog("[Lyrics] Extension %s failed: %v\n", provider.extension.ID, err)
@@ -427,7 +456,20 @@ func (c *LyricsClient) FetchLyricsAllSources(spotifyID, trackName, artistName st
 		}
 	}
 
+	if best := bestLyrics(extensionResults, durationSec); best != nil && lyricsIsConfident(best, durationSec) {
+		globalLyricsCache.Set(artistName, trackName, durationSec, best)
+		return best, nil
+	}
+
 	if cachedNonExtension != nil {
+		if len(extensionResults) > 0 {
+			cachedCopy := *cachedNonExtension
+			best := bestLyrics(append(extensionResults, &cachedCopy), durationSec)
+			if best != &cachedCopy {
+				globalLyricsCache.Set(artistName, trackName, durationSec, best)
+				return best, nil
+			}
+		}
 		cachedCopy := *cachedNonExtension
 		cachedCopy.Source = cachedNonExtension.Source + " (cached fallback)"
 		GoLog("[Lyrics] Extension providers unavailable for this track, using cached built-in lyrics\n")
@@ -453,20 +495,21 @@ func (c *LyricsClient) FetchLyricsAllSources(spotifyID, trackName, artistName st
 
 		case LyricsProviderNetease:
 			neteaseClient := NewNeteaseClient()
+			includeTranslation, includeRomanization := neteaseStackFlags(fetchOptions)
 			lyrics, err = neteaseClient.FetchLyrics(
 				trackName,
 				primaryArtist,
 				durationSec,
-				fetchOptions.IncludeTranslationNetease,
-				fetchOptions.IncludeRomanizationNetease,
+				includeTranslation,
+				includeRomanization,
 			)
 			if err != nil && primaryArtist != artistName {
 				lyrics, err = neteaseClient.FetchLyrics(
 					trackName,
 					artistName,
 					durationSec,
-					fetchOptions.IncludeTranslationNetease,
-					fetchOptions.IncludeRomanizationNetease,
+					includeTranslation,
+					includeRomanization,
 				)
 			}
 			if err != nil && simplifiedTrack != trackName {
@@ -474,8 +517,8 @@ func (c *LyricsClient) FetchLyricsAllSources(spotifyID, trackName, artistName st
 					simplifiedTrack,
 					primaryArtist,
 					durationSec,
-					fetchOptions.IncludeTranslationNetease,
-					fetchOptions.IncludeRomanizationNetease,
+					includeTranslation,
+					includeRomanization,
 				)
 			}
 
@@ -517,8 +560,9 @@ func (c *LyricsClient) FetchLyricsAllSources(spotifyID, trackName, artistName st
 
 		if err == nil && isValidResult(lyrics) {
 			GoLog("[Lyrics] Got lyrics from: %s\n", providerName)
-			globalLyricsCache.Set(artistName, trackName, durationSec, lyrics)
-			return lyrics, nil
+			best := bestLyrics(append(extensionResults, lyrics), durationSec)
+			globalLyricsCache.Set(artistName, trackName, durationSec, best)
+			return best, nil
 		}
 
 		if err != nil {
@@ -526,6 +570,11 @@ func (c *LyricsClient) FetchLyricsAllSources(spotifyID, trackName, artistName st
 		}
 	}
 
+	if best := bestLyrics(extensionResults, durationSec); best != nil {
+		globalLyricsCache.Set(artistName, trackName, durationSec, best)
+		return best, nil
+	}
+
 	return nil, fmt.Errorf("lyrics not found from any source")
 }
 
@@ -685,6 +734,100 @@ func lyricsHasUsableText(lyrics *LyricsResponse) bool {
 	return false
 }
 
+// lyricsIsSynced reports whether the lines carry real timestamps.
+func lyricsIsSynced(lyrics *LyricsResponse) bool {
+	if lyrics == nil || lyrics.SyncType == "UNSYNCED" {
+		return false
+	}
+	for _, line := range lyrics.Lines {
+		if line.StartTimeMs > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// lyricsLengthPlausibility scores from 0 to 1 how well the amount of text and,
+// for synced lyrics, the last timestamp fit a track of durationSec. Low scores
+// usually mean a snippet, a different version or the wrong song.
+func lyricsLengthPlausibility(lyrics *LyricsResponse, durationSec float64) float64 {
+	var lines, chars int
+	var lastStartMs int64
+	for _, line := range lyrics.Lines {
+		words := strings.TrimSpace(line.Words)
+		if words == "" {
+			continue
+		}
+		lines++
+		chars += len([]rune(words))
+		if line.StartTimeMs > lastStartMs {
+			lastStartMs = line.StartTimeMs
+		}
+	}
+	if lines == 0 {
+		for _, line := range strings.Split(lyrics.PlainLyrics, "\n") {
+			if words := strings.TrimSpace(line); words != "" {
+				lines++
+				chars += len([]rune(words))
+			}
+		}
+	}
+
+	score := 1.0
+	if lines < 4 {
+		score -= 0.5
+	}
+	if durationSec > 0 {
+		if float64(lastStartMs)/1000 > durationSec+durationToleranceSec {
+			score -= 0.5
+		}
+		charsPerSec := float64(chars) / durationSec
+		if charsPerSec < 0.3 || charsPerSec > 40 {
+			score -= 0.5
+		}
+	}
+	return math.Max(score, 0)
+}
+
+// scoreLyrics ranks a lyrics result: synced beats plain, instrumental markers
+// rank last, and implausible lengths are pushed down within each group.
+func scoreLyrics(lyrics *LyricsResponse, durationSec float64) float64 {
+	if !lyricsHasUsableText(lyrics) {
+		return -1
+	}
+	if lyrics.Instrumental {
+		return 0
+	}
+	plausibility := lyricsLengthPlausibility(lyrics, durationSec)
+	score := 10 + 20*plausibility
+	// Synced lyrics that fail the length checks (timestamps past the end of
+	// the track, a few stray lines) are usually another cut of the song, so
+	// they do not earn the synced bonus.
+	if lyricsIsSynced(lyrics) && plausibility > 0.5 {
+		score += 100
+	}
+	return score
+}
+
+// lyricsIsConfident reports whether a result is good enough to skip the
+// built-in cascade: synced and fully plausible.
+func lyricsIsConfident(lyrics *LyricsResponse, durationSec float64) bool {
+	return lyricsIsSynced(lyrics) && lyricsLengthPlausibility(lyrics, durationSec) == 1
+}
+
+// bestLyrics returns the highest scoring candidate; earlier candidates win
+// ties so extension and provider order still break even scores.
+func bestLyrics(candidates []*LyricsResponse, durationSec float64) *LyricsResponse {
+	var best *LyricsResponse
+	bestScore := -1.0
+	for _, candidate := range candidates {
+		if score := scoreLyrics(candidate, durationSec); score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
 // detectLyricsErrorPayload extracts human-readable error messages from
 // JSON payloads returned by lyrics proxies when no lyric is available.
 func detectLyricsErrorPayload(raw string) (string, bool) {
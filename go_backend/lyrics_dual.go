@@ -0,0 +1,107 @@
+package gobackend
+
+import "strings"
+
+// ==================== Dual lyrics ====================
+//
+// Some providers (Netease) return a romanized and/or translated version next
+// to the original lyrics. With SecondaryLyrics set, that version is embedded
+// as well: the primary text goes to LYRICS/UNSYNCEDLYRICS as before and the
+// other one to its own tag, so players that only read LYRICS keep working.
+// Go writes the tags into FLAC; for other formats they travel in
+// lyrics_tags of the download response for Dart's FFmpeg tagging. The
+// version that gets its own tag is not stacked into the main text as well.
+
+const (
+	SecondaryLyricsRomanized  = "romanized"
+	SecondaryLyricsTranslated = "translated"
+
+	LyricsTagRomaji      = "LYRICS:ROMAJI"
+	LyricsTagTranslation = "LYRICS:TRANSLATION"
+	LyricsTagOriginal    = "LYRICS:ORIGINAL"
+)
+
+func normalizeSecondaryLyrics(kind string) string {
+	switch kind = strings.ToLower(strings.TrimSpace(kind)); kind {
+	case SecondaryLyricsRomanized, SecondaryLyricsTranslated:
+		return kind
+	case "romaji", "romanization":
+		return SecondaryLyricsRomanized
+	case "translation":
+		return SecondaryLyricsTranslated
+	}
+	return ""
+}
+
+// secondaryLyricsLines returns the requested alternate version and its tag.
+func secondaryLyricsLines(lyrics *LyricsResponse, kind string) ([]LyricsLine, string) {
+	switch kind {
+	case SecondaryLyricsRomanized:
+		return lyrics.Romanized, LyricsTagRomaji
+	case SecondaryLyricsTranslated:
+		return lyrics.Translated, LyricsTagTranslation
+	}
+	return nil, ""
+}
+
+// splitDualLyrics returns the lyrics to render into the main LYRICS tag and
+// the extra tags holding the other version as LRC. Without a secondary
+// version (or with the option off) it returns lyrics unchanged and no tags.
+func splitDualLyrics(lyrics *LyricsResponse, opts LyricsFetchOptions) (*LyricsResponse, map[string]string) {
+	if lyrics == nil || lyrics.Instrumental {
+		return lyrics, nil
+	}
+	lines, tag := secondaryLyricsLines(lyrics, opts.SecondaryLyrics)
+	if len(lines) == 0 {
+		return lyrics, nil
+	}
+
+	secondary := *lyrics
+	secondary.Lines = lines
+	secondary.PlainLyrics = ""
+	if !opts.SecondaryLyricsPrimary {
+		return lyrics, map[string]string{tag: lyricsBodyLRC(&secondary)}
+	}
+	return &secondary, map[string]string{LyricsTagOriginal: lyricsBodyLRC(lyrics)}
+}
+
+// lyricsBodyLRC renders lines like convertToLRCWithMetadata, minus the
+// [ti:]/[ar:] header, which only the main LYRICS tag carries.
+func lyricsBodyLRC(lyrics *LyricsResponse) string {
+	full := convertToLRCWithMetadata(lyrics, "", "")
+	if idx := strings.Index(full, "\n\n"); idx >= 0 {
+		return full[idx+2:]
+	}
+	return full
+}
+
+// neteaseStackFlags returns which Netease variants to stack into the main
+// LRC: the ones asked for, minus the one embedded as SecondaryLyrics.
+func neteaseStackFlags(opts LyricsFetchOptions) (translation, romanization bool) {
+	translation = opts.IncludeTranslationNetease && opts.SecondaryLyrics != SecondaryLyricsTranslated
+	romanization = opts.IncludeRomanizationNetease && opts.SecondaryLyrics != SecondaryLyricsRomanized
+	return translation, romanization
+}
+
+// renderLyricsForEmbed returns the main LRC text and the extra tags for the
+// current lyrics options.
+func renderLyricsForEmbed(lyrics *LyricsResponse, trackName, artistName string) (string, map[string]string) {
+	primary, extra := splitDualLyrics(lyrics, GetLyricsFetchOptions())
+	return convertToLRCWithMetadata(primary, trackName, artistName), extra
+}
+
+// secondaryLyricsTags returns the extra lyrics tags of lyrics under the
+// current options, or nil.
+func secondaryLyricsTags(lyrics *LyricsResponse) map[string]string {
+	_, extra := splitDualLyrics(lyrics, GetLyricsFetchOptions())
+	return extra
+}
+
+// embedSecondaryLyrics writes the extra lyrics tags of lyrics to a FLAC file.
+func embedSecondaryLyrics(filePath string, lyrics *LyricsResponse) error {
+	extra := secondaryLyricsTags(lyrics)
+	if len(extra) == 0 {
+		return nil
+	}
+	return EmbedLyricsTags(filePath, extra)
+}
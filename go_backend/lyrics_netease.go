@@ -103,6 +103,40 @@ func (c *NeteaseClient) SearchSong(trackName, artistName string) (int64, error)
 
 // FetchLyricsByID fetches synced lyrics for a given Netease song ID.
 func (c *NeteaseClient) FetchLyricsByID(songID int64, includeTranslation, includeRomanization bool) (string, error) {
+	lyricsResp, err := c.fetchLyricsParts(songID)
+	if err != nil {
+		return "", err
+	}
+	return stackNeteaseLyrics(lyricsResp, includeTranslation, includeRomanization), nil
+}
+
+// stackNeteaseLyrics appends the requested translation and romanization to
+// the original LRC, which is how they end up in a single LYRICS tag.
+func stackNeteaseLyrics(lyricsResp *neteaseLyricsResponse, includeTranslation, includeRomanization bool) string {
+	lyric := lyricsResp.LRC.Lyric
+
+	if includeTranslation && lyricsResp.TLyric != nil && strings.TrimSpace(lyricsResp.TLyric.Lyric) != "" {
+		lyric += "\n\n" + lyricsResp.TLyric.Lyric
+	}
+
+	if includeRomanization && lyricsResp.RomaLRC != nil && strings.TrimSpace(lyricsResp.RomaLRC.Lyric) != "" {
+		lyric += "\n\n" + lyricsResp.RomaLRC.Lyric
+	}
+
+	return lyric
+}
+
+// neteaseVariantLines parses a translation/romanization field, or nil.
+func neteaseVariantLines(field *neteaseLyricField) []LyricsLine {
+	if field == nil || strings.TrimSpace(field.Lyric) == "" {
+		return nil
+	}
+	return parseSyncedLyrics(field.Lyric)
+}
+
+// fetchLyricsParts returns the original, translated and romanized lyrics of
+// a Netease song as the API delivers them.
+func (c *NeteaseClient) fetchLyricsParts(songID int64) (*neteaseLyricsResponse, error) {
 	lyricsURL := "http://music.163.com/api/song/lyric"
 	params := url.Values{}
 	params.Set("id", fmt.Sprintf("%d", songID))
@@ -114,7 +148,7 @@ func (c *NeteaseClient) FetchLyricsByID(songID int64, includeTranslation, includ
 
 	req, err := http.NewRequest("GET", fullURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	for k, v := range neteaseHeaders {
@@ -124,34 +158,24 @@ func (c *NeteaseClient) FetchLyricsByID(songID int64, includeTranslation, includ
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("netease lyrics fetch failed: %w", err)
+		return nil, fmt.Errorf("netease lyrics fetch failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("netease lyrics returned HTTP %d", resp.StatusCode)
+		return nil, fmt.Errorf("netease lyrics returned HTTP %d", resp.StatusCode)
 	}
 
 	var lyricsResp neteaseLyricsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&lyricsResp); err != nil {
-		return "", fmt.Errorf("failed to decode netease lyrics: %w", err)
+		return nil, fmt.Errorf("failed to decode netease lyrics: %w", err)
 	}
 
 	if lyricsResp.LRC == nil || strings.TrimSpace(lyricsResp.LRC.Lyric) == "" {
-		return "", fmt.Errorf("no lyrics available on netease")
-	}
-
-	lyric := lyricsResp.LRC.Lyric
-
-	if includeTranslation && lyricsResp.TLyric != nil && strings.TrimSpace(lyricsResp.TLyric.Lyric) != "" {
-		lyric += "\n\n" + lyricsResp.TLyric.Lyric
-	}
-
-	if includeRomanization && lyricsResp.RomaLRC != nil && strings.TrimSpace(lyricsResp.RomaLRC.Lyric) != "" {
-		lyric += "\n\n" + lyricsResp.RomaLRC.Lyric
+		return nil, fmt.Errorf("no lyrics available on netease")
 	}
 
-	return lyric, nil
+	return &lyricsResp, nil
 }
 
 // FetchLyrics searches for a track and returns parsed LyricsResponse.
@@ -167,10 +191,11 @@ func (c *NeteaseClient) FetchLyrics(
 		return nil, err
 	}
 
-	lrcText, err := c.FetchLyricsByID(songID, includeTranslation, includeRomanization)
+	lyricsResp, err := c.fetchLyricsParts(songID)
 	if err != nil {
 		return nil, err
 	}
+	lrcText := stackNeteaseLyrics(lyricsResp, includeTranslation, includeRomanization)
 
 	// Parse the LRC text into LyricsResponse
 	lines := parseSyncedLyrics(lrcText)
@@ -201,9 +226,11 @@ func (c *NeteaseClient) FetchLyrics(
 	}
 
 	return &LyricsResponse{
-		Lines:    lines,
-		SyncType: "LINE_SYNCED",
-		Provider: "Netease",
-		Source:   "Netease",
+		Lines:      lines,
+		SyncType:   "LINE_SYNCED",
+		Provider:   "Netease",
+		Source:     "Netease",
+		Romanized:  neteaseVariantLines(lyricsResp.RomaLRC),
+		Translated: neteaseVariantLines(lyricsResp.TLyric),
 	}, nil
 }
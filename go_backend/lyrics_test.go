@@ -0,0 +1,99 @@
+package gobackend
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func makeSyncedLyrics(source string, lines int, stepMs int64) *LyricsResponse {
+	lyrics := &LyricsResponse{SyncType: "LINE_SYNCED", Source: source}
+	for i := 0; i < lines; i++ {
+		lyrics.Lines = append(lyrics.Lines, LyricsLine{
+			StartTimeMs: int64(i+1) * stepMs,
+			Words:       fmt.Sprintf("line number %d of the song", i),
+		})
+	}
+	return lyrics
+}
+
+func TestBestLyricsPrefersPlausibleSynced(t *testing.T) {
+	plain := &LyricsResponse{
+		SyncType:    "UNSYNCED",
+		PlainLyrics: strings.Repeat("a plain line of the chorus\n", 24),
+		Source:      "Extension: plain",
+	}
+	synced := makeSyncedLyrics("LRCLIB", 30, 6000)
+	overrun := makeSyncedLyrics("Extension: long", 30, 20000)
+
+	if got := bestLyrics([]*LyricsResponse{plain, synced}, 200); got != synced {
+		t.Errorf("expected synced lyrics to win, got %s", got.Source)
+	}
+	// Timestamps ending at 600s cannot belong to a 200s track.
+	if got := bestLyrics([]*LyricsResponse{overrun, plain}, 200); got != plain {
+		t.Errorf("expected plain lyrics over overrunning synced lyrics, got %s", got.Source)
+	}
+	if !lyricsIsConfident(synced, 200) || lyricsIsConfident(overrun, 200) || lyricsIsConfident(plain, 200) {
+		t.Error("unexpected confidence results")
+	}
+}
+
+func TestBestLyricsTieKeepsOrder(t *testing.T) {
+	first := makeSyncedLyrics("Extension: a", 20, 5000)
+	second := makeSyncedLyrics("Extension: b", 20, 5000)
+	if got := bestLyrics([]*LyricsResponse{first, second}, 180); got != first {
+		t.Errorf("expected first candidate on tie, got %s", got.Source)
+	}
+	instrumental := &LyricsResponse{Instrumental: true}
+	if got := bestLyrics([]*LyricsResponse{instrumental, second}, 180); got != second {
+		t.Errorf("expected lyrics over instrumental marker, got %+v", got)
+	}
+	if bestLyrics(nil, 180) != nil {
+		t.Error("expected nil for no candidates")
+	}
+}
+
+func TestSplitDualLyrics(t *testing.T) {
+	lyrics := &LyricsResponse{
+		SyncType:  "LINE_SYNCED",
+		Lines:     []LyricsLine{{StartTimeMs: 1000, Words: "君の名は"}},
+		Romanized: []LyricsLine{{StartTimeMs: 1000, Words: "kimi no na wa"}},
+	}
+
+	primary, extra := splitDualLyrics(lyrics, LyricsFetchOptions{})
+	if primary != lyrics || extra != nil {
+		t.Fatalf("expected no secondary lyrics when disabled, got %v", extra)
+	}
+
+	primary, extra = splitDualLyrics(lyrics, LyricsFetchOptions{SecondaryLyrics: SecondaryLyricsRomanized})
+	if primary != lyrics || extra[LyricsTagRomaji] != "[00:01.00]kimi no na wa\n" {
+		t.Errorf("unexpected romaji tag: %q", extra[LyricsTagRomaji])
+	}
+
+	primary, extra = splitDualLyrics(lyrics, LyricsFetchOptions{SecondaryLyrics: SecondaryLyricsRomanized, SecondaryLyricsPrimary: true})
+	if primary.Lines[0].Words != "kimi no na wa" || extra[LyricsTagOriginal] != "[00:01.00]君の名は\n" {
+		t.Errorf("expected romaji as primary, got %q / %v", primary.Lines[0].Words, extra)
+	}
+
+	// No translation available: nothing extra, original stays primary.
+	primary, extra = splitDualLyrics(lyrics, LyricsFetchOptions{SecondaryLyrics: SecondaryLyricsTranslated, SecondaryLyricsPrimary: true})
+	if primary != lyrics || extra != nil {
+		t.Errorf("expected original lyrics without translation, got %v", extra)
+	}
+
+	if got := normalizeLyricsFetchOptions(LyricsFetchOptions{SecondaryLyrics: " Romaji ", SecondaryLyricsPrimary: true}); got.SecondaryLyrics != SecondaryLyricsRomanized || !got.SecondaryLyricsPrimary {
+		t.Errorf("unexpected normalized options: %+v", got)
+	}
+	// The version that gets its own tag is not stacked into the main text.
+	if tl, rm := neteaseStackFlags(LyricsFetchOptions{IncludeTranslationNetease: true, IncludeRomanizationNetease: true, SecondaryLyrics: SecondaryLyricsRomanized}); !tl || rm {
+		t.Errorf("stack flags = %v/%v, want translation only", tl, rm)
+	}
+
+	prev := GetLyricsFetchOptions()
+	defer SetLyricsFetchOptions(prev)
+	SetLyricsFetchOptions(LyricsFetchOptions{SecondaryLyrics: SecondaryLyricsRomanized, SecondaryLyricsPrimary: true})
+	lrc, tags := renderLyricsForEmbed(lyrics, "Song", "Artist")
+	if !strings.Contains(lrc, "kimi no na wa") || strings.Contains(lrc, "君の名は") || tags[LyricsTagOriginal] == "" {
+		t.Errorf("render with romaji primary = %q / %v", lrc, tags)
+	}
+}
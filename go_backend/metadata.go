@@ -69,6 +69,7 @@ func buildPictureBlock(coverPath string, coverData []byte) (flac.MetaDataBlock,
 	if len(coverData) == 0 {
 		return flac.MetaDataBlock{}, fmt.Errorf("empty cover data")
 	}
+	coverData = prepareEmbeddedCover("flac", coverData)
 
 	mime := detectCoverMIME(coverPath, coverData)
 	picture := &flacpicture.MetadataBlockPicture{
@@ -104,6 +105,7 @@ type Metadata struct {
 	TrackNumber int
 	TotalTracks int
 	DiscNumber  int
+	TotalDiscs  int
 	ISRC        string
 	Description string
 	Lyrics      string
@@ -112,6 +114,8 @@ type Metadata struct {
 	Copyright   string
 	Composer    string
 	Comment     string
+	Compilation bool
+	Chapters    []Chapter
 }
 
 func EmbedMetadata(filePath string, metadata Metadata, coverPath string) error {
@@ -156,6 +160,17 @@ func EmbedMetadata(filePath string, metadata Metadata, coverPath string) error {
 		setComment(cmt, "DISCNUMBER", strconv.Itoa(metadata.DiscNumber))
 	}
 
+	if metadata.TotalDiscs > 0 {
+		setComment(cmt, "DISCTOTAL", strconv.Itoa(metadata.TotalDiscs))
+		setComment(cmt, "TOTALDISCS", strconv.Itoa(metadata.TotalDiscs))
+	}
+
+	if metadata.Compilation {
+		setComment(cmt, "COMPILATION", "1")
+	} else {
+		removeComment(cmt, "COMPILATION")
+	}
+
 	if metadata.ISRC != "" {
 		setComment(cmt, "ISRC", metadata.ISRC)
 	}
@@ -189,6 +204,10 @@ func EmbedMetadata(filePath string, metadata Metadata, coverPath string) error {
 		setComment(cmt, "COMMENT", metadata.Comment)
 	}
 
+	if chapters := normalizeChapters(metadata.Chapters, 0); len(chapters) > 0 {
+		setVorbisChapters(cmt, chapters)
+	}
+
 	cmtBlock := cmt.Marshal()
 	if cmtIdx >= 0 {
 		f.Meta[cmtIdx] = &cmtBlock
@@ -265,6 +284,17 @@ func EmbedMetadataWithCoverData(filePath string, metadata Metadata, coverData []
 		setComment(cmt, "DISCNUMBER", strconv.Itoa(metadata.DiscNumber))
 	}
 
+	if metadata.TotalDiscs > 0 {
+		setComment(cmt, "DISCTOTAL", strconv.Itoa(metadata.TotalDiscs))
+		setComment(cmt, "TOTALDISCS", strconv.Itoa(metadata.TotalDiscs))
+	}
+
+	if metadata.Compilation {
+		setComment(cmt, "COMPILATION", "1")
+	} else {
+		removeComment(cmt, "COMPILATION")
+	}
+
 	if metadata.ISRC != "" {
 		setComment(cmt, "ISRC", metadata.ISRC)
 	}
@@ -298,6 +328,10 @@ func EmbedMetadataWithCoverData(filePath string, metadata Metadata, coverData []
 		setComment(cmt, "COMMENT", metadata.Comment)
 	}
 
+	if chapters := normalizeChapters(metadata.Chapters, 0); len(chapters) > 0 {
+		setVorbisChapters(cmt, chapters)
+	}
+
 	cmtBlock := cmt.Marshal()
 	if cmtIdx >= 0 {
 		f.Meta[cmtIdx] = &cmtBlock
@@ -373,6 +407,19 @@ func ReadMetadata(filePath string) (*Metadata, error) {
 				}
 			}
 
+			compilation := strings.ToLower(getComment(cmt, "COMPILATION"))
+			metadata.Compilation = compilation == "1" || compilation == "true"
+
+			discTotal := getComment(cmt, "DISCTOTAL")
+			if discTotal == "" {
+				discTotal = getComment(cmt, "TOTALDISCS")
+			}
+			if discTotal != "" {
+				fmt.Sscanf(discTotal, "%d", &metadata.TotalDiscs)
+			} else if slash := strings.Index(discNum, "/"); slash >= 0 {
+				fmt.Sscanf(discNum[slash+1:], "%d", &metadata.TotalDiscs)
+			}
+
 			if metadata.Date == "" {
 				metadata.Date = getComment(cmt, "YEAR")
 			}
@@ -394,6 +441,11 @@ func setComment(cmt *flacvorbis.MetaDataBlockVorbisComment, key, value string) {
 	if value == "" {
 		return
 	}
+	removeComment(cmt, key)
+	cmt.Comments = append(cmt.Comments, key+"="+value)
+}
+
+func removeComment(cmt *flacvorbis.MetaDataBlockVorbisComment, key string) {
 	keyUpper := strings.ToUpper(key)
 	for i := len(cmt.Comments) - 1; i >= 0; i-- {
 		comment := cmt.Comments[i]
@@ -405,7 +457,6 @@ func setComment(cmt *flacvorbis.MetaDataBlockVorbisComment, key, value string) {
 			}
 		}
 	}
-	cmt.Comments = append(cmt.Comments, key+"="+value)
 }
 
 func getComment(cmt *flacvorbis.MetaDataBlockVorbisComment, key string) string {
@@ -496,6 +547,46 @@ func EmbedLyrics(filePath string, lyrics string) error {
 	return f.Save(filePath)
 }
 
+// EmbedLyricsTags writes extra lyrics comments such as LYRICS:ROMAJI,
+// leaving LYRICS/UNSYNCEDLYRICS untouched.
+func EmbedLyricsTags(filePath string, tags map[string]string) error {
+	f, err := flac.ParseFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to parse FLAC file: %w", err)
+	}
+
+	var cmtIdx int = -1
+	var cmt *flacvorbis.MetaDataBlockVorbisComment
+
+	for idx, meta := range f.Meta {
+		if meta.Type == flac.VorbisComment {
+			cmtIdx = idx
+			cmt, err = flacvorbis.ParseFromMetaDataBlock(*meta)
+			if err != nil {
+				return fmt.Errorf("failed to parse vorbis comment: %w", err)
+			}
+			break
+		}
+	}
+
+	if cmt == nil {
+		cmt = flacvorbis.New()
+	}
+
+	for key, value := range tags {
+		setComment(cmt, key, value)
+	}
+
+	cmtBlock := cmt.Marshal()
+	if cmtIdx >= 0 {
+		f.Meta[cmtIdx] = &cmtBlock
+	} else {
+		f.Meta = append(f.Meta, &cmtBlock)
+	}
+
+	return f.Save(filePath)
+}
+
 func EmbedGenreLabel(filePath string, genre, label string) error {
 	if genre == "" && label == "" {
 		return nil
@@ -0,0 +1,427 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	stdimage "image"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-flac/flacpicture/v2"
+	"github.com/go-flac/go-flac/v2"
+)
+
+// ==================== Mobile copies ====================
+//
+// With BackendConfig.MobileCopy enabled, every FLAC download also gets a
+// small lossy companion under MobileCopy.Dir, so the hi-res master stays in
+// the archive and the phone syncs a folder it can actually hold. The copy
+// mirrors the master's path relative to LibraryRoot; without a root (or for
+// a file outside it) only the album folder is mirrored:
+//
+//	<library_root>/Artist/Album/01 - Song.flac
+//	<dir>/Artist/Album/01 - Song.opus
+//
+// FFmpeg carries the tags over. The master's front cover is first fitted to
+// the cover_embed rule of the companion's container. FFmpeg cannot put
+// artwork into Ogg, so for Opus the cover is added to the comment header
+// afterwards as METADATA_BLOCK_PICTURE; for AAC it is handed to FFmpeg as a
+// second input and muxed as an attached picture. A companion older than its
+// master (retagged, re-downloaded, new cover) is encoded again.
+
+const (
+	MobileCopyOpus = "opus"
+	MobileCopyAAC  = "aac"
+
+	defaultMobileCopyOpusKbps = 128
+	defaultMobileCopyAACKbps  = 256
+	minMobileCopyKbps         = 32
+	maxMobileCopyKbps         = 512
+	mobileCopyTimeout         = 10 * time.Minute
+)
+
+var mobileCopyExtensions = map[string]string{
+	MobileCopyOpus: ".opus",
+	MobileCopyAAC:  ".m4a",
+}
+
+// MobileCopyConfig lives in BackendConfig under mobile_copy.
+type MobileCopyConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Format      string `json:"format"`
+	BitrateKbps int    `json:"bitrate_kbps,omitempty"`
+	Dir         string `json:"dir,omitempty"`
+	LibraryRoot string `json:"library_root,omitempty"`
+}
+
+func defaultMobileCopyConfig() MobileCopyConfig {
+	return MobileCopyConfig{Format: MobileCopyOpus}
+}
+
+func (c *MobileCopyConfig) validate() error {
+	c.Format = strings.ToLower(strings.TrimSpace(c.Format))
+	if c.Format == "" {
+		c.Format = MobileCopyOpus
+	}
+	if _, ok := mobileCopyExtensions[c.Format]; !ok {
+		return fmt.Errorf("unsupported mobile_copy.format: %s", c.Format)
+	}
+	if c.BitrateKbps != 0 && (c.BitrateKbps < minMobileCopyKbps || c.BitrateKbps > maxMobileCopyKbps) {
+		return fmt.Errorf("mobile_copy.bitrate_kbps must be between %d and %d", minMobileCopyKbps, maxMobileCopyKbps)
+	}
+	c.Dir = strings.TrimSpace(c.Dir)
+	c.LibraryRoot = strings.TrimSpace(c.LibraryRoot)
+	if c.Enabled && c.Dir == "" {
+		return fmt.Errorf("mobile_copy.dir is required")
+	}
+	return nil
+}
+
+func (c MobileCopyConfig) bitrate() int {
+	if c.BitrateKbps > 0 {
+		return c.BitrateKbps
+	}
+	if c.Format == MobileCopyAAC {
+		return defaultMobileCopyAACKbps
+	}
+	return defaultMobileCopyOpusKbps
+}
+
+// MobileCopyResult describes the companion file written for a download.
+type MobileCopyResult struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// mobileCopyPath maps a master to its companion path.
+func mobileCopyPath(cfg MobileCopyConfig, masterPath string) string {
+	rel := ""
+	if cfg.LibraryRoot != "" {
+		if r, err := filepath.Rel(cfg.LibraryRoot, masterPath); err == nil && !strings.HasPrefix(r, "..") && !filepath.IsAbs(r) {
+			rel = r
+		}
+	}
+	if rel == "" {
+		rel = filepath.Join(filepath.Base(filepath.Dir(masterPath)), filepath.Base(masterPath))
+	}
+	rel = strings.TrimSuffix(rel, filepath.Ext(rel)) + mobileCopyExtensions[cfg.Format]
+	return filepath.Join(cfg.Dir, rel)
+}
+
+// buildMobileCopyCommand encodes inputPath to outputPath. coverPath, when
+// set, is the already prepared cover for an AAC copy; the master's own
+// picture stream is never copied.
+func buildMobileCopyCommand(cfg MobileCopyConfig, inputPath, coverPath, outputPath string, sampleRate int) string {
+	parts := []string{"-y", "-i", fmt.Sprintf("%q", inputPath)}
+	bitrate := fmt.Sprintf("%dk", cfg.bitrate())
+	if cfg.Format == MobileCopyAAC {
+		if coverPath != "" {
+			parts = append(parts, "-i", fmt.Sprintf("%q", coverPath), "-map", "0:a:0", "-map", "1:v:0",
+				"-c:v", "copy", "-disposition:v", "attached_pic")
+		} else {
+			parts = append(parts, "-map", "0:a:0")
+		}
+		parts = append(parts, "-map_metadata", "0", "-c:a", "aac", "-b:a", bitrate, "-movflags", "+faststart")
+		// The native AAC encoder tops out at 96 kHz and gains nothing above 48.
+		if sampleRate > 48000 {
+			parts = append(parts, "-ar", "48000")
+		}
+	} else {
+		parts = append(parts, "-map", "0:a:0", "-map_metadata", "0", "-c:a", "libopus", "-b:a", bitrate, "-vbr", "on")
+	}
+	return strings.Join(append(parts, fmt.Sprintf("%q", outputPath)), " ")
+}
+
+// flacFrontCover returns the body of the FLAC's front cover PICTURE block,
+// or of its first picture when none is marked as the front cover.
+func flacFrontCover(path string) []byte {
+	f, blocks, _, err := openFLACAudio(path)
+	if err != nil {
+		return nil
+	}
+	f.Close()
+	var cover []byte
+	for _, block := range blocks {
+		if block[0]&0x7f != flacBlockPicture || len(block) < 8 {
+			continue
+		}
+		if binary.BigEndian.Uint32(block[4:]) == 3 {
+			return block[4:]
+		}
+		if cover == nil {
+			cover = block[4:]
+		}
+	}
+	return cover
+}
+
+// mobileCopyCover returns the master's front cover fitted to the cover_embed
+// rule of format, or nil when the master has none.
+func mobileCopyCover(masterPath, format string) *flacpicture.MetadataBlockPicture {
+	body := flacFrontCover(masterPath)
+	if body == nil {
+		return nil
+	}
+	picture, err := flacpicture.ParseFromMetaDataBlock(flac.MetaDataBlock{Type: flac.Picture, Data: body})
+	if err != nil || len(picture.ImageData) == 0 {
+		return nil
+	}
+	data := prepareEmbeddedCover(format, picture.ImageData)
+	if !bytes.Equal(data, picture.ImageData) {
+		picture.ImageData = data
+		picture.MIME = detectCoverMIME("", data)
+		if cfg, _, err := stdimage.DecodeConfig(bytes.NewReader(data)); err == nil {
+			picture.Width, picture.Height = uint32(cfg.Width), uint32(cfg.Height)
+		}
+	}
+	return picture
+}
+
+// coverFileExt names a cover file so FFmpeg's image demuxer picks the
+// right decoder.
+func coverFileExt(mime string) string {
+	switch mime {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	return ".jpg"
+}
+
+// buildOggPages laces one packet into pages starting at sequence. The page
+// that completes the packet carries granule; the others carry -1.
+func buildOggPages(serial, sequence uint32, granule int64, packet []byte) [][]byte {
+	var pages [][]byte
+	for seq := sequence; ; seq++ {
+		var lacing []byte
+		size, closed := 0, false
+		for len(lacing) < 255 {
+			lace := min(255, len(packet)-size)
+			lacing = append(lacing, byte(lace))
+			size += lace
+			// A lace below 255 ends the packet, so one that is an exact
+			// multiple of 255 bytes gets a trailing 0.
+			if lace < 255 {
+				closed = true
+				break
+			}
+		}
+		var flags byte
+		if seq != sequence {
+			flags = oggFlagContinued
+		}
+		pageGranule := int64(-1)
+		if closed {
+			pageGranule = granule
+		}
+		page := []byte("OggS\x00")
+		page = append(page, flags)
+		page = binary.LittleEndian.AppendUint64(page, uint64(pageGranule))
+		page = binary.LittleEndian.AppendUint32(page, serial)
+		page = binary.LittleEndian.AppendUint32(page, seq)
+		page = append(page, 0, 0, 0, 0, byte(len(lacing)))
+		page = append(page, lacing...)
+		page = append(page, packet[:size]...)
+		binary.LittleEndian.PutUint32(page[22:], oggChecksum(page))
+		pages = append(pages, page)
+		packet = packet[size:]
+		if closed {
+			return pages
+		}
+	}
+}
+
+// addOpusTagsComment appends "key=value" to an OpusTags packet, keeping any
+// binary data that follows the comment list.
+func addOpusTagsComment(packet []byte, comment string) ([]byte, error) {
+	if len(packet) < 16 || string(packet[:8]) != "OpusTags" {
+		return nil, fmt.Errorf("not an OpusTags packet")
+	}
+	pos := 8 + 4 + int(binary.LittleEndian.Uint32(packet[8:]))
+	if pos+4 > len(packet) {
+		return nil, fmt.Errorf("OpusTags vendor string is cut off")
+	}
+	countAt := pos
+	count := binary.LittleEndian.Uint32(packet[pos:])
+	pos += 4
+	for i := uint32(0); i < count; i++ {
+		if pos+4 > len(packet) {
+			return nil, fmt.Errorf("OpusTags comment list is cut off")
+		}
+		pos += 4 + int(binary.LittleEndian.Uint32(packet[pos:]))
+	}
+	if pos > len(packet) {
+		return nil, fmt.Errorf("OpusTags comment list is cut off")
+	}
+
+	out := append([]byte(nil), packet[:pos]...)
+	binary.LittleEndian.PutUint32(out[countAt:], count+1)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(comment)))
+	out = append(out, comment...)
+	return append(out, packet[pos:]...), nil
+}
+
+// embedOpusPicture adds a METADATA_BLOCK_PICTURE comment holding picture
+// (a FLAC PICTURE block body) to an Ogg Opus file, re-paging the comment
+// header and renumbering the pages after it.
+func embedOpusPicture(path string, picture []byte) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	pages, err := splitOggPages(data)
+	if err != nil {
+		return err
+	}
+	if len(pages) < 2 || string(oggPageBody(pages[0])[:min(8, len(oggPageBody(pages[0])))]) != "OpusHead" {
+		return fmt.Errorf("not an Ogg Opus file")
+	}
+
+	// OpusTags starts on the second page and ends where a page closes it.
+	var tags []byte
+	end := 1
+	for ; end < len(pages); end++ {
+		tags = append(tags, oggPageBody(pages[end])...)
+		if !oggPacketOpen(pages[end]) {
+			break
+		}
+	}
+	if end == len(pages) {
+		return fmt.Errorf("OpusTags packet is cut off")
+	}
+	tags, err = addOpusTagsComment(tags, "METADATA_BLOCK_PICTURE="+base64.StdEncoding.EncodeToString(picture))
+	if err != nil {
+		return err
+	}
+
+	serial := binary.LittleEndian.Uint32(pages[0][14:])
+	tagPages := buildOggPages(serial, 1, 0, tags)
+	shift := uint32(len(tagPages) - end)
+
+	out := make([]byte, 0, len(data)+len(tags))
+	out = append(out, pages[0]...)
+	for _, page := range tagPages {
+		out = append(out, page...)
+	}
+	for _, page := range pages[end+1:] {
+		page = append([]byte(nil), page...)
+		binary.LittleEndian.PutUint32(page[18:], binary.LittleEndian.Uint32(page[18:])+shift)
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		binary.LittleEndian.PutUint32(page[22:], oggChecksum(page))
+		out = append(out, page...)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, out, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// CreateMobileCopy writes the companion of masterPath and returns it. An
+// existing companion is left alone unless the master changed after it was
+// written.
+func CreateMobileCopy(masterPath string, cfg MobileCopyConfig) (*MobileCopyResult, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("mobile_copy.dir is required")
+	}
+	target := mobileCopyPath(cfg, masterPath)
+	result := &MobileCopyResult{Path: target, Format: cfg.Format}
+	if info, err := os.Stat(target); err == nil {
+		if master, err := os.Stat(masterPath); err == nil && !master.ModTime().After(info.ModTime()) {
+			result.Bytes = info.Size()
+			return result, nil
+		}
+	}
+	quality, err := GetAudioQuality(masterPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mobile copy dir: %w", err)
+	}
+
+	coverFormat := "opus"
+	if cfg.Format == MobileCopyAAC {
+		coverFormat = "m4a"
+	}
+	cover := mobileCopyCover(masterPath, coverFormat)
+
+	tmpPath := target + ".part" + mobileCopyExtensions[cfg.Format]
+	defer os.Remove(tmpPath)
+	coverPath := ""
+	if cover != nil && cfg.Format == MobileCopyAAC {
+		coverPath = target + ".cover" + coverFileExt(cover.MIME)
+		if err := os.WriteFile(coverPath, cover.ImageData, 0644); err != nil {
+			GoLog("[MobileCopy] Cover not added to %s: %v\n", filepath.Base(target), err)
+			coverPath = ""
+		} else {
+			defer os.Remove(coverPath)
+		}
+	}
+	cmd, err := runQueuedFFmpeg("mobile_copy", buildMobileCopyCommand(cfg, masterPath, coverPath, tmpPath, quality.SampleRate), masterPath, tmpPath, mobileCopyTimeout)
+	if err == nil && !cmd.Success {
+		err = fmt.Errorf("%s", firstNonEmpty(cmd.Error, "FFmpeg encode failed"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cover != nil && cfg.Format == MobileCopyOpus {
+		if err := embedOpusPicture(tmpPath, cover.Marshal().Data); err != nil {
+			GoLog("[MobileCopy] Cover not added to %s: %v\n", filepath.Base(target), err)
+		}
+	}
+	if err := os.Rename(tmpPath, target); err != nil {
+		return nil, fmt.Errorf("failed to move mobile copy: %w", err)
+	}
+	if info, err := os.Stat(target); err == nil {
+		result.Bytes = info.Size()
+	}
+	return result, nil
+}
+
+// attachMobileCopy creates the companion for a FLAC path output when the
+// mode is on. Re-downloads of an existing master get a copy too if theirs
+// is missing.
+func attachMobileCopy(req DownloadRequest, respJSON string) string {
+	cfg := GetBackendConfig().MobileCopy
+	if !cfg.Enabled || isFDOutput(req.OutputFD) {
+		return respJSON
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success {
+		return respJSON
+	}
+	path := strings.TrimPrefix(strings.TrimSpace(resp.FilePath), "EXISTS:")
+	if !strings.EqualFold(filepath.Ext(path), ".flac") || strings.HasPrefix(path, "content://") {
+		return respJSON
+	}
+	result, err := CreateMobileCopy(path, cfg)
+	if err != nil {
+		GoLog("[MobileCopy] %s: %v\n", filepath.Base(path), err)
+		return respJSON
+	}
+	resp.MobileCopy = result
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return respJSON
+	}
+	return string(jsonBytes)
+}
@@ -0,0 +1,205 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMobileCopyPath(t *testing.T) {
+	cfg := MobileCopyConfig{Format: MobileCopyOpus, Dir: "/mobile", LibraryRoot: "/music"}
+	tests := []struct {
+		master string
+		want   string
+	}{
+		{"/music/Artist/Album/01 - Song.flac", "/mobile/Artist/Album/01 - Song.opus"},
+		{"/music/Single.flac", "/mobile/Single.opus"},
+		{"/elsewhere/Artist/Album/02 - Other.flac", "/mobile/Album/02 - Other.opus"},
+	}
+	for _, tt := range tests {
+		if got := mobileCopyPath(cfg, tt.master); got != tt.want {
+			t.Errorf("mobileCopyPath(%q) = %q, want %q", tt.master, got, tt.want)
+		}
+	}
+	cfg.Format, cfg.LibraryRoot = MobileCopyAAC, ""
+	if got := mobileCopyPath(cfg, "/music/Artist/Album/01 - Song.flac"); got != "/mobile/Album/01 - Song.m4a" {
+		t.Errorf("without a root = %q", got)
+	}
+}
+
+func testOpusTagsPacket(comments ...string) []byte {
+	packet := []byte("OpusTags")
+	packet = binary.LittleEndian.AppendUint32(packet, 6)
+	packet = append(packet, "ffmpeg"...)
+	packet = binary.LittleEndian.AppendUint32(packet, uint32(len(comments)))
+	for _, c := range comments {
+		packet = binary.LittleEndian.AppendUint32(packet, uint32(len(c)))
+		packet = append(packet, c...)
+	}
+	return packet
+}
+
+func TestCreateMobileCopy_EmbedsOpusCover(t *testing.T) {
+	dir := t.TempDir()
+	encoded := append(testOggPage(oggFlagBOS, 0, 0, []byte("OpusHead\x01\x02\x38\x01")), buildOggPages(0x1234, 1, 0, testOpusTagsPacket("TITLE=Song"))[0]...)
+	encoded = append(encoded, testOggPage(0, 960, 2, []byte("audio"))...)
+	encoded = append(encoded, testOggPage(oggFlagEOS, 1920, 3, []byte("audio"))...)
+	var commands []string
+	fakeFFmpegWorker(t, func(cmd *FFmpegCommand) {
+		commands = append(commands, cmd.Command)
+		cmd.Success = os.WriteFile(cmd.OutputPath, encoded, 0644) == nil
+	})
+
+	// A cover big enough that the comment header spans several pages.
+	image := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, bytes.Repeat([]byte{0x42}, 100<<10)...)
+	master := filepath.Join(dir, "library", "Artist", "Album", "01 - Song.flac")
+	testFLACWithCover(t, master, "image/jpeg", image)
+
+	cfg := MobileCopyConfig{Enabled: true, Dir: filepath.Join(dir, "mobile"), LibraryRoot: filepath.Join(dir, "library")}
+	result, err := CreateMobileCopy(master, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "mobile", "Artist", "Album", "01 - Song.opus")
+	if result.Path != want || result.Format != MobileCopyOpus || result.Bytes == 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(commands) != 1 || !strings.Contains(commands[0], "-c:a libopus -b:a 128k") {
+		t.Errorf("commands = %q", commands)
+	}
+
+	out, _ := os.ReadFile(want)
+	pages, err := splitOggPages(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) < 5 {
+		t.Fatalf("comment header was not re-paged: %d pages", len(pages))
+	}
+	for i, page := range pages {
+		page = append([]byte(nil), page...)
+		crc := binary.LittleEndian.Uint32(page[22:])
+		binary.LittleEndian.PutUint32(page[22:], 0)
+		if binary.LittleEndian.Uint32(page[18:]) != uint32(i) || oggChecksum(page) != crc {
+			t.Errorf("page %d has sequence %d or a bad checksum", i, binary.LittleEndian.Uint32(page[18:]))
+		}
+	}
+	if last := pages[len(pages)-1]; last[5] != oggFlagEOS || !bytes.Equal(oggPageBody(last), []byte("audio")) {
+		t.Error("audio pages were not carried over")
+	}
+	cover, mime, err := extractOggCoverArt(want)
+	if err != nil || mime != "image/jpeg" || !bytes.Equal(cover, image) {
+		t.Fatalf("cover = %d bytes %q, %v", len(cover), mime, err)
+	}
+	if meta, err := ReadOggVorbisComments(want); err != nil || meta.Title != "Song" {
+		t.Errorf("tags = %+v, %v", meta, err)
+	}
+
+	// A second run keeps the existing copy.
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+	cfgJSON, _ := json.Marshal(map[string]interface{}{"mobile_copy": cfg})
+	if err := SetBackendConfigJSON(string(cfgJSON)); err != nil {
+		t.Fatal(err)
+	}
+	var resp DownloadResponse
+	respJSON := attachMobileCopy(DownloadRequest{}, `{"success":true,"message":"ok","file_path":"`+master+`"}`)
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.MobileCopy == nil || resp.MobileCopy.Path != want || len(commands) != 1 {
+		t.Errorf("unexpected response %s", respJSON)
+	}
+
+	// A master changed after its copy was written gets a new one.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(master, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateMobileCopy(master, cfg); err != nil || len(commands) != 2 {
+		t.Errorf("stale copy not refreshed: %v, %d commands", err, len(commands))
+	}
+}
+
+// testFLACWithCover writes a FLAC album track whose only picture is a front
+// cover holding image.
+func testFLACWithCover(t *testing.T, path, mime string, image []byte) {
+	t.Helper()
+	picture := binary.BigEndian.AppendUint32(nil, 3)
+	picture = binary.BigEndian.AppendUint32(picture, uint32(len(mime)))
+	picture = append(picture, mime...)
+	picture = append(picture, make([]byte, 4+16)...)
+	picture = binary.BigEndian.AppendUint32(picture, uint32(len(image)))
+	picture = append(picture, image...)
+
+	os.MkdirAll(filepath.Dir(path), 0755)
+	testFLACAlbum(t, path, 4)
+	data, _ := os.ReadFile(path)
+	data[4] = 0
+	block := append([]byte{0x80 | flacBlockPicture, byte(len(picture) >> 16), byte(len(picture) >> 8), byte(len(picture))}, picture...)
+	data = append(data[:8+34], append(block, data[8+34:]...)...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateMobileCopy_AACCoverFollowsEmbedRule(t *testing.T) {
+	dir := t.TempDir()
+	var commands []string
+	var embedded []byte
+	fakeFFmpegWorker(t, func(cmd *FFmpegCommand) {
+		commands = append(commands, cmd.Command)
+		if i := strings.Index(cmd.Command, ".cover.jpg"); i >= 0 {
+			start := strings.LastIndex(cmd.Command[:i], `"`) + 1
+			embedded, _ = os.ReadFile(cmd.Command[start : i+len(".cover.jpg")])
+		}
+		cmd.Success = os.WriteFile(cmd.OutputPath, []byte("m4a"), 0644) == nil
+	})
+
+	// A noisy PNG that compresses badly, well over the 500 KB M4A cap.
+	var cover bytes.Buffer
+	if err := png.Encode(&cover, testCoverImage(600, true)); err != nil {
+		t.Fatal(err)
+	}
+	if cover.Len() <= 500<<10 {
+		t.Fatalf("test cover is only %d bytes", cover.Len())
+	}
+	master := filepath.Join(dir, "Album", "01 - Song.flac")
+	testFLACWithCover(t, master, "image/png", cover.Bytes())
+
+	cfg := MobileCopyConfig{Enabled: true, Format: MobileCopyAAC, Dir: filepath.Join(dir, "mobile")}
+	if _, err := CreateMobileCopy(master, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 1 || !strings.Contains(commands[0], "-map 1:v:0") || strings.Contains(commands[0], "0:v") {
+		t.Fatalf("commands = %q", commands)
+	}
+	if detectCoverMIME("", embedded) != "image/jpeg" || len(embedded) > 500<<10 {
+		t.Errorf("embedded cover: %s, %d bytes", detectCoverMIME("", embedded), len(embedded))
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "mobile", "Album", "*.cover.*")); len(matches) != 0 {
+		t.Errorf("cover files left behind: %v", matches)
+	}
+}
+
+func TestMobileCopyConfigValidate(t *testing.T) {
+	cfg := MobileCopyConfig{Enabled: true, Format: " AAC ", Dir: "/mobile"}
+	if err := cfg.validate(); err != nil || cfg.Format != MobileCopyAAC || cfg.bitrate() != defaultMobileCopyAACKbps {
+		t.Fatalf("validate = %v, %+v", err, cfg)
+	}
+	for _, bad := range []MobileCopyConfig{
+		{Enabled: true},
+		{Format: "mp3"},
+		{BitrateKbps: 8},
+	} {
+		if err := bad.validate(); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NetworkTypeWifi     = "wifi"
+	NetworkTypeEthernet = "ethernet"
+	NetworkTypeCellular = "cellular"
+	NetworkTypeNone     = "none"
+	NetworkTypeUnknown  = "unknown"
+
+	networkWaitPoll = 500 * time.Millisecond
+)
+
+// NetworkState mirrors what Flutter's connectivity plugin reports.
+type NetworkState struct {
+	Connected bool   `json:"connected"`
+	Type      string `json:"type"`
+	UpdatedAt int64  `json:"updated_at,omitempty"`
+}
+
+var (
+	networkStateMu sync.RWMutex
+	// Until Flutter reports otherwise, assume we are online so nothing
+	// blocks on platforms that never call SetNetworkState.
+	networkState   = NetworkState{Connected: true, Type: NetworkTypeUnknown}
+	networkChanged = make(chan struct{})
+)
+
+func normalizeNetworkType(networkType string) string {
+	switch t := strings.ToLower(strings.TrimSpace(networkType)); t {
+	case NetworkTypeWifi, NetworkTypeEthernet, NetworkTypeCellular, NetworkTypeNone:
+		return t
+	case "mobile":
+		return NetworkTypeCellular
+	default:
+		return NetworkTypeUnknown
+	}
+}
+
+// SetNetworkState is called by Flutter on every connectivity change. Waiting
+// downloads are woken up and re-check whether they may start.
+func SetNetworkState(connected bool, networkType string) {
+	state := NetworkState{
+		Connected: connected,
+		Type:      normalizeNetworkType(networkType),
+		UpdatedAt: time.Now().Unix(),
+	}
+	if state.Type == NetworkTypeNone {
+		state.Connected = false
+	}
+
+	networkStateMu.Lock()
+	changed := networkState.Connected != state.Connected || networkState.Type != state.Type
+	networkState = state
+	if changed {
+		close(networkChanged)
+		networkChanged = make(chan struct{})
+	}
+	networkStateMu.Unlock()
+
+	if changed {
+		GoLog("[Network] State changed: connected=%v type=%s\n", state.Connected, state.Type)
+		emitBackendEvent("network", state)
+	}
+}
+
+func GetNetworkState() NetworkState {
+	networkStateMu.RLock()
+	defer networkStateMu.RUnlock()
+	return networkState
+}
+
+func GetNetworkStateJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetNetworkState())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// downloadsAllowed reports whether downloads may run on the current network
+// and, if not, why. An unknown network type passes the Wi-Fi-only check
+// because we cannot tell it is metered.
+func downloadsAllowed(state NetworkState, wifiOnly bool) (bool, string) {
+	if !state.Connected {
+		return false, "waiting_network"
+	}
+	if wifiOnly && state.Type == NetworkTypeCellular {
+		return false, "waiting_wifi"
+	}
+	return true, ""
+}
+
+// waitForDownloadNetwork blocks a queued download until the network allows
+// it to start, exposing the wait as the item's progress status. It returns
+// ErrDownloadCancelled if the item is cancelled or the backend shuts down.
+func waitForDownloadNetwork(itemID string) error {
+	waiting := false
+	defer func() {
+		if waiting && itemID != "" {
+			RemoveItemProgress(itemID)
+		}
+	}()
+
+	for {
+		networkStateMu.RLock()
+		state := networkState
+		changed := networkChanged
+		networkStateMu.RUnlock()
+
+		allowed, status := downloadsAllowed(state, GetBackendConfig().WifiOnly)
+		if allowed {
+			if waiting {
+				GoLog("[Network] Resuming %s\n", itemID)
+			}
+			return nil
+		}
+
+		if !waiting {
+			waiting = true
+			GoLog("[Network] %s is %s\n", itemID, status)
+		}
+		if itemID != "" {
+			setItemWaiting(itemID, status)
+		}
+		if isDownloadCancelled(itemID) || backendShuttingDown.Load() {
+			clearDownloadCancel(itemID)
+			return ErrDownloadCancelled
+		}
+
+		select {
+		case <-changed:
+		case <-time.After(networkWaitPoll):
+		}
+	}
+}
+
+func setItemWaiting(itemID, status string) {
+	multiMu.Lock()
+	defer multiMu.Unlock()
+
+	item, ok := multiProgress.Items[itemID]
+	if !ok {
+		item = &ItemProgress{ItemID: itemID, ETASeconds: -1}
+		multiProgress.Items[itemID] = item
+	}
+	item.IsDownloading = false
+	item.Status = status
+}
@@ -0,0 +1,44 @@
+package gobackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaitForDownloadNetworkResumes(t *testing.T) {
+	defer SetNetworkState(true, NetworkTypeUnknown)
+
+	SetNetworkState(false, NetworkTypeNone)
+	done := make(chan error, 1)
+	go func() { done <- waitForDownloadNetwork("net-wait") }()
+
+	time.Sleep(50 * time.Millisecond)
+	var status string
+	multiMu.RLock()
+	if item, ok := multiProgress.Items["net-wait"]; ok {
+		status = item.Status
+	}
+	multiMu.RUnlock()
+	if status != "waiting_network" {
+		t.Fatalf("expected waiting_network status, got %q", status)
+	}
+
+	SetNetworkState(true, NetworkTypeWifi)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("download did not resume after connectivity returned")
+	}
+}
+
+func TestDownloadsAllowedWifiOnly(t *testing.T) {
+	if ok, status := downloadsAllowed(NetworkState{Connected: true, Type: NetworkTypeCellular}, true); ok || status != "waiting_wifi" {
+		t.Fatalf("cellular should wait for wifi, got %v %q", ok, status)
+	}
+	if ok, _ := downloadsAllowed(NetworkState{Connected: true, Type: NetworkTypeUnknown}, true); !ok {
+		t.Fatal("unknown network type should not block wifi-only downloads")
+	}
+}
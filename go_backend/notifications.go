@@ -0,0 +1,242 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DownloadEventCompleted = "download_completed"
+	DownloadEventFailed    = "download_failed"
+
+	webhookTimeout      = 15 * time.Second
+	webhookMaxRetries   = 2
+	maxQueuedDownloadEv = 100
+)
+
+// NotificationOptions controls what happens when a download finishes.
+// Webhooks are meant for home servers (e.g. triggering a Navidrome/Plex
+// ingest); events are queued for Flutter to turn into system notifications.
+type NotificationOptions struct {
+	WebhookURL     string            `json:"webhook_url,omitempty"`
+	WebhookHeaders map[string]string `json:"webhook_headers,omitempty"`
+	NotifySuccess  bool              `json:"notify_success"`
+	NotifyFailure  bool              `json:"notify_failure"`
+	QueueEvents    bool              `json:"queue_events"`
+}
+
+type DownloadEvent struct {
+	Type        string `json:"type"`
+	ItemID      string `json:"item_id,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	AlbumArtist string `json:"album_artist,omitempty"`
+	ISRC        string `json:"isrc,omitempty"`
+	Service     string `json:"service,omitempty"`
+	FilePath    string `json:"file_path,omitempty"`
+	CoverURL    string `json:"cover_url,omitempty"`
+	MD5         string `json:"md5,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+	Error       string `json:"error,omitempty"`
+	ErrorType   string `json:"error_type,omitempty"`
+	Action      string `json:"action,omitempty"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+var (
+	notificationOptionsMu sync.RWMutex
+	notificationOptions   = defaultNotificationOptions()
+
+	downloadEventsMu sync.Mutex
+	downloadEvents   []DownloadEvent
+)
+
+func defaultNotificationOptions() NotificationOptions {
+	return NotificationOptions{
+		NotifySuccess: true,
+		NotifyFailure: true,
+	}
+}
+
+func SetNotificationOptions(opts NotificationOptions) error {
+	opts.WebhookURL = strings.TrimSpace(opts.WebhookURL)
+	if opts.WebhookURL != "" {
+		parsed, err := url.Parse(opts.WebhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("webhook URL must be an absolute http(s) URL")
+		}
+	}
+
+	notificationOptionsMu.Lock()
+	notificationOptions = opts
+	notificationOptionsMu.Unlock()
+
+	GoLog("[Notify] Options updated: webhook=%v events=%v success=%v failure=%v\n",
+		opts.WebhookURL != "", opts.QueueEvents, opts.NotifySuccess, opts.NotifyFailure)
+	return nil
+}
+
+func GetNotificationOptions() NotificationOptions {
+	notificationOptionsMu.RLock()
+	defer notificationOptionsMu.RUnlock()
+
+	opts := notificationOptions
+	opts.WebhookHeaders = make(map[string]string, len(notificationOptions.WebhookHeaders))
+	for k, v := range notificationOptions.WebhookHeaders {
+		opts.WebhookHeaders[k] = v
+	}
+	return opts
+}
+
+func buildDownloadEvent(req DownloadRequest, resp DownloadResponse) DownloadEvent {
+	event := DownloadEvent{
+		ItemID:      req.ItemID,
+		Title:       firstNonEmpty(resp.Title, req.TrackName),
+		Artist:      firstNonEmpty(resp.Artist, req.ArtistName),
+		Album:       firstNonEmpty(resp.Album, req.AlbumName),
+		AlbumArtist: firstNonEmpty(resp.AlbumArtist, req.AlbumArtist),
+		ISRC:        firstNonEmpty(resp.ISRC, req.ISRC),
+		Service:     firstNonEmpty(resp.Service, req.Service),
+		CoverURL:    firstNonEmpty(resp.CoverURL, req.CoverURL),
+		Timestamp:   time.Now().Unix(),
+	}
+
+	if resp.Success {
+		event.Type = DownloadEventCompleted
+		event.FilePath = resp.FilePath
+		event.MD5 = resp.MD5
+		event.SHA256 = resp.SHA256
+		event.Action = "play"
+	} else {
+		event.Type = DownloadEventFailed
+		event.Error = resp.Error
+		event.ErrorType = resp.ErrorType
+		event.Action = "retry"
+	}
+	return event
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// notifyDownloadFinished dispatches the configured hooks for a finished
+// download. It never blocks the download path: webhooks run in the background.
+func notifyDownloadFinished(req DownloadRequest, respJSON string) {
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil {
+		return
+	}
+	if !resp.Success && resp.ErrorType == "cancelled" {
+		return
+	}
+
+	opts := GetNotificationOptions()
+	if resp.Success && !opts.NotifySuccess || !resp.Success && !opts.NotifyFailure {
+		return
+	}
+
+	event := buildDownloadEvent(req, resp)
+	emitBackendEvent("download", event)
+	if opts.QueueEvents {
+		queueDownloadEvent(event)
+	}
+	if opts.WebhookURL != "" {
+		go postDownloadWebhook(opts, event)
+	}
+}
+
+func queueDownloadEvent(event DownloadEvent) {
+	downloadEventsMu.Lock()
+	defer downloadEventsMu.Unlock()
+
+	downloadEvents = append(downloadEvents, event)
+	if len(downloadEvents) > maxQueuedDownloadEv {
+		downloadEvents = downloadEvents[len(downloadEvents)-maxQueuedDownloadEv:]
+	}
+}
+
+func postDownloadWebhook(opts NotificationOptions, event DownloadEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	client := NewHTTPClientWithTimeout(webhookTimeout)
+	for attempt := 0; attempt <= webhookMaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+
+		req, err := http.NewRequest("POST", opts.WebhookURL, bytes.NewReader(body))
+		if err != nil {
+			GoLog("[Notify] Invalid webhook request: %v\n", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range opts.WebhookHeaders {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := DoRequestWithUserAgent(client, req)
+		if err != nil {
+			GoLog("[Notify] Webhook attempt %d failed: %v\n", attempt+1, err)
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			GoLog("[Notify] Webhook delivered (%s, HTTP %d)\n", event.Type, resp.StatusCode)
+			return
+		}
+		GoLog("[Notify] Webhook attempt %d returned HTTP %d\n", attempt+1, resp.StatusCode)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+	}
+}
+
+// PollDownloadEventsJSON returns and clears queued completion events.
+func PollDownloadEventsJSON() (string, error) {
+	downloadEventsMu.Lock()
+	events := downloadEvents
+	downloadEvents = nil
+	downloadEventsMu.Unlock()
+
+	if events == nil {
+		events = []DownloadEvent{}
+	}
+	jsonBytes, err := json.Marshal(events)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func SetNotificationOptionsJSON(optionsJSON string) error {
+	opts := defaultNotificationOptions()
+	if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+		return fmt.Errorf("invalid notification options: %w", err)
+	}
+	return SetNotificationOptions(opts)
+}
+
+func GetNotificationOptionsJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetNotificationOptions())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
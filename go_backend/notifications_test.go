@@ -0,0 +1,24 @@
+package gobackend
+
+import "testing"
+
+func TestSetNotificationOptionsJSONKeepsDefaults(t *testing.T) {
+	prev := GetNotificationOptions()
+	defer SetNotificationOptions(prev)
+
+	if err := SetNotificationOptionsJSON(`{"queue_events":true}`); err != nil {
+		t.Fatalf("SetNotificationOptionsJSON failed: %v", err)
+	}
+	opts := GetNotificationOptions()
+	if !opts.QueueEvents || !opts.NotifySuccess || !opts.NotifyFailure {
+		t.Fatalf("partial options did not merge over defaults: %+v", opts)
+	}
+
+	if err := SetNotificationOptionsJSON(`{"notify_failure":false}`); err != nil {
+		t.Fatalf("SetNotificationOptionsJSON failed: %v", err)
+	}
+	opts = GetNotificationOptions()
+	if !opts.NotifySuccess || opts.NotifyFailure {
+		t.Fatalf("explicit false was not applied: %+v", opts)
+	}
+}
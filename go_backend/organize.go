@@ -0,0 +1,440 @@
+package gobackend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ==================== Library organize ====================
+//
+// OrganizeLibrary moves already-downloaded files to the path a new folder
+// and filename template gives them. A rename that crosses storage volumes
+// (EXDEV, e.g. internal storage to SD card under scoped storage) falls back to
+// copy+delete. Moves are journaled, and the first failure rolls every move
+// of the batch back so the library is never left half-organized. A copy is
+// read back and compared with the source before the source is deleted.
+// Files behind SAF descriptors cannot be deleted from Go: a readable
+// /proc/self/fd source is copied and verified like any other, then reported
+// as "saf_copied" for Flutter to delete through DocumentsContract. A rolled
+// back batch removes those copies and leaves the documents alone. Content
+// URIs Go cannot read are reported as "saf" for Flutter to handle.
+
+const (
+	OrganizeStatusPlanned    = "planned"
+	OrganizeStatusMoved      = "moved"
+	OrganizeStatusCopied     = "copied"
+	OrganizeStatusUnchanged  = "unchanged"
+	OrganizeStatusConflict   = "conflict"
+	OrganizeStatusFailed     = "failed"
+	OrganizeStatusRolledBack = "rolled_back"
+	OrganizeStatusSAF        = "saf"
+	OrganizeStatusSAFCopied  = "saf_copied"
+)
+
+var organizeSidecarExts = []string{".lrc"}
+
+type OrganizeRequest struct {
+	Files            []string `json:"files"`
+	RootDir          string   `json:"root_dir"`
+	FolderTemplate   string   `json:"folder_template,omitempty"`
+	FilenameTemplate string   `json:"filename_template,omitempty"`
+	DryRun           bool     `json:"dry_run"`
+	PruneEmptyDirs   bool     `json:"prune_empty_dirs"`
+}
+
+type OrganizeMove struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// SAF marks a source behind a SAF descriptor; the app deletes it once
+	// the move reports saf_copied.
+	SAF bool `json:"saf,omitempty"`
+}
+
+type OrganizeReport struct {
+	DryRun     bool           `json:"dry_run"`
+	Moves      []OrganizeMove `json:"moves"`
+	Moved      int            `json:"moved"`
+	Skipped    int            `json:"skipped"`
+	RolledBack bool           `json:"rolled_back"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// organizeStep is one completed rename or copy, kept for rollback. A step
+// that kept its source is undone by removing the copy.
+type organizeStep struct {
+	from, to   string
+	keepSource bool
+}
+
+func isSAFPath(path string) bool {
+	return strings.HasPrefix(path, "/proc/self/fd/") || strings.Contains(path, "://")
+}
+
+// safDescriptorExt sniffs the audio format behind a SAF descriptor, whose
+// path has no extension. It returns "" when the format is not recognized.
+func safDescriptorExt(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	header := make([]byte, 64)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return ".flac"
+	case bytes.HasPrefix(header, []byte("OggS")):
+		if bytes.Contains(header, []byte("OpusHead")) {
+			return ".opus"
+		}
+		return ".ogg"
+	case len(header) >= 8 && string(header[4:8]) == "ftyp":
+		return ".m4a"
+	case bytes.HasPrefix(header, []byte("ID3")), len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		return ".mp3"
+	}
+	return ""
+}
+
+func organizeTemplateMetadata(m *Metadata) map[string]interface{} {
+	return map[string]interface{}{
+		"title":        m.Title,
+		"artist":       m.Artist,
+		"album":        m.Album,
+		"album_artist": m.AlbumArtist,
+		"date":         m.Date,
+		"track":        m.TrackNumber,
+		"disc":         m.DiscNumber,
+		"disc_total":   m.TotalDiscs,
+	}
+}
+
+// organizeTarget builds the path of a file with extension ext below rootDir.
+// Every folder segment is sanitized on its own so tags cannot add directory
+// levels.
+func organizeTarget(req OrganizeRequest, ext string, meta *Metadata) string {
+	values := organizeTemplateMetadata(meta)
+
+	parts := []string{req.RootDir}
+	if req.FolderTemplate != "" {
+		for _, segment := range strings.Split(buildFilenameFromTemplate(req.FolderTemplate, values), "/") {
+			if strings.TrimSpace(segment) != "" {
+				parts = append(parts, sanitizeFilename(segment))
+			}
+		}
+	}
+	name := sanitizeFilename(buildFilenameFromTemplate(req.FilenameTemplate, values))
+	parts = append(parts, name+ext)
+	return filepath.Join(parts...)
+}
+
+// planOrganize computes every target and marks conflicts: an existing
+// different file at the target or two files mapping to the same path.
+func planOrganize(req OrganizeRequest) []OrganizeMove {
+	moves := make([]OrganizeMove, 0, len(req.Files))
+	claimed := make(map[string]bool)
+
+	for _, file := range req.Files {
+		file = strings.TrimSpace(file)
+		move := OrganizeMove{From: file}
+		ext := strings.ToLower(filepath.Ext(file))
+		if isSAFPath(file) {
+			if !strings.HasPrefix(file, "/proc/self/fd/") {
+				move.Status, move.Error = OrganizeStatusSAF, "SAF documents are moved by the app"
+				moves = append(moves, move)
+				continue
+			}
+			move.SAF = true
+			ext = safDescriptorExt(file)
+		}
+
+		meta, err := readRetagMetadataAs(file, ext)
+		if err != nil {
+			move.Status, move.Error = OrganizeStatusFailed, err.Error()
+			moves = append(moves, move)
+			continue
+		}
+		move.To = organizeTarget(req, ext, meta)
+
+		switch {
+		case !move.SAF && move.To == filepath.Clean(file):
+			move.Status = OrganizeStatusUnchanged
+		case claimed[strings.ToLower(move.To)]:
+			move.Status, move.Error = OrganizeStatusConflict, "another file maps to the same path"
+		default:
+			move.Status = OrganizeStatusPlanned
+			if targetInfo, err := os.Stat(move.To); err == nil {
+				if srcInfo, err := os.Stat(file); err != nil || move.SAF || !os.SameFile(srcInfo, targetInfo) {
+					move.Status, move.Error = OrganizeStatusConflict, "target already exists"
+				}
+			}
+		}
+		if move.Status == OrganizeStatusPlanned {
+			claimed[strings.ToLower(move.To)] = true
+		}
+		moves = append(moves, move)
+	}
+	return moves
+}
+
+// copyVerified copies src to a new file dst, syncs it and reads it back to
+// compare with what was read from src. dst is removed on any failure.
+func copyVerified(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	srcHash := sha256.New()
+	written, err := io.Copy(out, io.TeeReader(in, srcHash))
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if info, statErr := in.Stat(); statErr == nil && info.Mode().IsRegular() && info.Size() != written {
+			err = fmt.Errorf("copied %d of %d bytes", written, info.Size())
+		}
+	}
+	if err == nil {
+		err = verifyCopy(dst, written, srcHash.Sum(nil))
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+func verifyCopy(path string, size int64, sum []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("failed to read back copy: %w", err)
+	}
+	if n != size || !bytes.Equal(h.Sum(nil), sum) {
+		return fmt.Errorf("copy of %d bytes does not match the source", n)
+	}
+	return nil
+}
+
+// copyThenDelete moves src to dst across volumes. The source is only removed
+// after the copy is verified.
+func copyThenDelete(src, dst string) error {
+	if err := copyVerified(src, dst); err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("failed to remove source after copy: %w", err)
+	}
+	return nil
+}
+
+// moveLibraryFile renames src to dst, falling back to copy+delete when the
+// rename crosses a volume.
+func moveLibraryFile(src, dst string) (copied bool, err error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, fmt.Errorf("failed to create directory: %w", err)
+	}
+	err = os.Rename(src, dst)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return false, err
+	}
+	GoLog("[Organize] Cross-volume move, copying %s\n", filepath.Base(src))
+	return true, copyThenDelete(src, dst)
+}
+
+// copySAFDocument copies a SAF source to dst and verifies it. The document
+// itself stays; the app deletes it after the report says saf_copied.
+func copySAFDocument(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return copyVerified(src, dst)
+}
+
+func emitOrganizeProgress(i, total int, move *OrganizeMove) {
+	emitBackendEvent("organize", map[string]interface{}{
+		"done":   i + 1,
+		"total":  total,
+		"from":   move.From,
+		"to":     move.To,
+		"status": move.Status,
+	})
+}
+
+func rollbackOrganize(steps []organizeStep) error {
+	var errs []error
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i].keepSource {
+			if err := os.Remove(steps[i].to); err != nil && !os.IsNotExist(err) {
+				GoLog("[Organize] Rollback of %s failed: %v\n", steps[i].to, err)
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if _, err := moveLibraryFile(steps[i].to, steps[i].from); err != nil {
+			GoLog("[Organize] Rollback of %s failed: %v\n", steps[i].to, err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pruneEmptyDirs removes dir and its empty parents, stopping at rootDir.
+func pruneEmptyDirs(dir, rootDir string) {
+	for dir != rootDir && isPathWithinBase(rootDir, dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// OrganizeLibrary plans and, unless DryRun is set, performs the moves. It
+// emits an "organize" event after each file.
+func OrganizeLibrary(req OrganizeRequest) (*OrganizeReport, error) {
+	req.RootDir = strings.TrimSpace(req.RootDir)
+	if req.RootDir == "" {
+		return nil, fmt.Errorf("root_dir is required")
+	}
+	req.RootDir = filepath.Clean(req.RootDir)
+	if strings.TrimSpace(req.FilenameTemplate) == "" {
+		req.FilenameTemplate = GetBackendConfig().FilenameTemplate
+	}
+
+	report := &OrganizeReport{DryRun: req.DryRun, Moves: planOrganize(req)}
+	if req.DryRun {
+		for _, move := range report.Moves {
+			if move.Status != OrganizeStatusPlanned {
+				report.Skipped++
+			}
+		}
+		return report, nil
+	}
+
+	var steps []organizeStep
+	var failure error
+	for i := range report.Moves {
+		move := &report.Moves[i]
+		if move.Status != OrganizeStatusPlanned {
+			report.Skipped++
+			continue
+		}
+
+		if move.SAF {
+			if err := copySAFDocument(move.From, move.To); err != nil {
+				move.Status, move.Error = OrganizeStatusFailed, err.Error()
+				failure = fmt.Errorf("failed to copy %s: %w", move.From, err)
+				break
+			}
+			steps = append(steps, organizeStep{from: move.From, to: move.To, keepSource: true})
+			move.Status = OrganizeStatusSAFCopied
+			report.Moved++
+			emitOrganizeProgress(i, len(report.Moves), move)
+			continue
+		}
+
+		copied, err := moveLibraryFile(move.From, move.To)
+		if err != nil {
+			move.Status, move.Error = OrganizeStatusFailed, err.Error()
+			failure = fmt.Errorf("failed to move %s: %w", move.From, err)
+			break
+		}
+		steps = append(steps, organizeStep{from: move.From, to: move.To})
+		move.Status = OrganizeStatusMoved
+		if copied {
+			move.Status = OrganizeStatusCopied
+		}
+		report.Moved++
+
+		srcBase := strings.TrimSuffix(move.From, filepath.Ext(move.From))
+		dstBase := strings.TrimSuffix(move.To, filepath.Ext(move.To))
+		for _, ext := range organizeSidecarExts {
+			if !fileExists(srcBase + ext) {
+				continue
+			}
+			if _, err := moveLibraryFile(srcBase+ext, dstBase+ext); err != nil {
+				GoLog("[Organize] Failed to move %s: %v\n", srcBase+ext, err)
+			} else {
+				steps = append(steps, organizeStep{from: srcBase + ext, to: dstBase + ext})
+			}
+		}
+
+		emitOrganizeProgress(i, len(report.Moves), move)
+	}
+
+	if failure != nil {
+		GoLog("[Organize] %v, rolling back %d moves\n", failure, len(steps))
+		report.Error = failure.Error()
+		if err := rollbackOrganize(steps); err != nil {
+			report.Error += "; rollback incomplete: " + err.Error()
+		}
+		report.RolledBack = true
+		report.Moved = 0
+		for i := range report.Moves {
+			if status := report.Moves[i].Status; status == OrganizeStatusMoved || status == OrganizeStatusCopied || status == OrganizeStatusSAFCopied {
+				report.Moves[i].Status = OrganizeStatusRolledBack
+			}
+		}
+		for _, step := range steps {
+			pruneEmptyDirs(filepath.Dir(step.to), req.RootDir)
+		}
+		return report, nil
+	}
+
+	if req.PruneEmptyDirs {
+		for _, step := range steps {
+			if !step.keepSource {
+				pruneEmptyDirs(filepath.Dir(step.from), req.RootDir)
+			}
+		}
+	}
+	GoLog("[Organize] Moved %d files, skipped %d\n", report.Moved, report.Skipped)
+	return report, nil
+}
+
+func OrganizeLibraryJSON(requestJSON string) (string, error) {
+	var req OrganizeRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid organize request: %w", err)
+	}
+	report, err := OrganizeLibrary(req)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(report)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
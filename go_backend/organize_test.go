@@ -0,0 +1,170 @@
+package gobackend
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTaggedTestFLAC(t *testing.T, path string, meta Metadata) {
+	t.Helper()
+	writeTestFLAC(t, path)
+	if err := EmbedMetadata(path, meta, ""); err != nil {
+		t.Fatalf("EmbedMetadata failed: %v", err)
+	}
+}
+
+func TestOrganizeLibraryMovesFiles(t *testing.T) {
+	root := t.TempDir()
+	first := filepath.Join(root, "a.flac")
+	second := filepath.Join(root, "b.flac")
+	writeTaggedTestFLAC(t, first, Metadata{Title: "One", Artist: "Artist", Album: "Album", TrackNumber: 1})
+	writeTaggedTestFLAC(t, second, Metadata{Title: "Two", Artist: "Artist", Album: "Album", TrackNumber: 2})
+	if err := os.WriteFile(filepath.Join(root, "a.lrc"), []byte("[00:01.00]x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := OrganizeRequest{
+		Files:            []string{first, second},
+		RootDir:          root,
+		FolderTemplate:   "{album_artist}/{album}",
+		FilenameTemplate: "{track} {title}",
+		DryRun:           true,
+	}
+	report, err := OrganizeLibrary(req)
+	if err != nil {
+		t.Fatalf("OrganizeLibrary failed: %v", err)
+	}
+	want := filepath.Join(root, "Artist", "Album", "01 One.flac")
+	if report.Moves[0].To != want || report.Moves[0].Status != OrganizeStatusPlanned {
+		t.Fatalf("dry run plan = %+v", report.Moves[0])
+	}
+	if !fileExists(first) {
+		t.Fatal("dry run moved a file")
+	}
+
+	req.DryRun = false
+	report, err = OrganizeLibrary(req)
+	if err != nil || report.Moved != 2 || report.RolledBack {
+		t.Fatalf("report = %+v, err = %v", report, err)
+	}
+	if !fileExists(want) || fileExists(first) {
+		t.Error("file was not moved")
+	}
+	if !fileExists(filepath.Join(root, "Artist", "Album", "01 One.lrc")) {
+		t.Error("lyrics sidecar was not moved")
+	}
+}
+
+func TestOrganizeLibraryRollsBack(t *testing.T) {
+	root := t.TempDir()
+	first := filepath.Join(root, "a.flac")
+	second := filepath.Join(root, "b.flac")
+	writeTaggedTestFLAC(t, first, Metadata{Title: "One", Artist: "Artist", Album: "A"})
+	writeTaggedTestFLAC(t, second, Metadata{Title: "Two", Artist: "Artist", Album: "B"})
+	// A regular file where the second target folder should go.
+	if err := os.WriteFile(filepath.Join(root, "B"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := OrganizeLibrary(OrganizeRequest{
+		Files:            []string{first, second},
+		RootDir:          root,
+		FolderTemplate:   "{album}",
+		FilenameTemplate: "{title}",
+	})
+	if err != nil {
+		t.Fatalf("OrganizeLibrary failed: %v", err)
+	}
+	if !report.RolledBack || report.Error == "" || report.Moved != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Moves[0].Status != OrganizeStatusRolledBack || report.Moves[1].Status != OrganizeStatusFailed {
+		t.Errorf("statuses = %s, %s", report.Moves[0].Status, report.Moves[1].Status)
+	}
+	if !fileExists(first) || !fileExists(second) {
+		t.Error("rollback did not restore the original files")
+	}
+	if fileExists(filepath.Join(root, "A")) {
+		t.Error("rollback left the created folder behind")
+	}
+}
+
+func TestOrganizeLibraryConflicts(t *testing.T) {
+	root := t.TempDir()
+	first := filepath.Join(root, "a.flac")
+	second := filepath.Join(root, "b.flac")
+	writeTaggedTestFLAC(t, first, Metadata{Title: "Same", Artist: "Artist"})
+	writeTaggedTestFLAC(t, second, Metadata{Title: "Same", Artist: "Artist"})
+
+	moves := planOrganize(OrganizeRequest{Files: []string{first, second, "content://media/doc/42"}, RootDir: root, FilenameTemplate: "{title}"})
+	if moves[0].Status != OrganizeStatusPlanned || moves[1].Status != OrganizeStatusConflict {
+		t.Errorf("statuses = %s, %s", moves[0].Status, moves[1].Status)
+	}
+	if moves[2].Status != OrganizeStatusSAF {
+		t.Errorf("SAF path status = %s", moves[2].Status)
+	}
+}
+
+func TestOrganizeLibraryCopiesSAFDocuments(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("no /proc/self/fd")
+	}
+	root := t.TempDir()
+	docs := t.TempDir()
+	src := filepath.Join(docs, "document")
+	writeTaggedTestFLAC(t, src, Metadata{Title: "One", Artist: "Artist", Album: "A"})
+	broken := filepath.Join(root, "b.flac")
+	writeTaggedTestFLAC(t, broken, Metadata{Title: "Two", Artist: "Artist", Album: "B"})
+
+	f, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	safPath := fmt.Sprintf("/proc/self/fd/%d", f.Fd())
+
+	req := OrganizeRequest{Files: []string{safPath}, RootDir: root, FolderTemplate: "{album}", FilenameTemplate: "{title}"}
+	report, err := OrganizeLibrary(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(root, "A", "One.flac")
+	if move := report.Moves[0]; move.Status != OrganizeStatusSAFCopied || !move.SAF || move.To != want {
+		t.Fatalf("move = %+v", move)
+	}
+	original, _ := os.ReadFile(src)
+	copied, _ := os.ReadFile(want)
+	if !bytes.Equal(original, copied) {
+		t.Error("copy differs from the document")
+	}
+	if err := os.Remove(want); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later failure removes the copy and leaves the document in place.
+	if err := os.WriteFile(filepath.Join(root, "B"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	req.Files = []string{safPath, broken}
+	report, err = OrganizeLibrary(req)
+	if err != nil || !report.RolledBack {
+		t.Fatalf("report = %+v, err = %v", report, err)
+	}
+	if report.Moves[0].Status != OrganizeStatusRolledBack || fileExists(want) || !fileExists(src) {
+		t.Errorf("rollback left status %s, copy=%v, source=%v", report.Moves[0].Status, fileExists(want), fileExists(src))
+	}
+}
+
+func TestCopyVerifiedRejectsMismatch(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "copy")
+	if err := os.WriteFile(dst, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCopy(dst, 3, []byte("not the sum")); err == nil {
+		t.Error("accepted a copy whose content differs")
+	}
+}
@@ -1,30 +1,284 @@
 package gobackend
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// ==================== Output FD registry ====================
+//
+// On SAF targets Flutter detaches a descriptor and hands its number to Go,
+// which owns it until the download returns. Every provider attempt writes
+// through its own dup, so a failed attempt closing its file cannot take the
+// descriptor away from the next one in a fallback chain.
+//
+// Descriptor numbers are reused by the kernel as soon as they are closed, so
+// closing one twice, or dup'ing one after it was closed, hits whatever
+// unrelated resource now holds that number; on Android fdsan aborts the
+// process for it. The registry records every detached descriptor and each
+// dup made from it:
+//
+//   - owners adopt the detached FD; it is closed once the last owner is done
+//   - a second close, or a dup after close, is refused and logged with the
+//     FD's full lineage instead of reaching the kernel
+//   - dups are followed until their *os.File is closed, so leaks show up in
+//     OutputFDReport
+//
+// The lineage of the most recent detached FDs is kept for the report.
+
+const (
+	maxOutputFDHistory = 64
+	minPreallocBytes   = 1 << 20
+)
+
+// OutputFDRecord describes a detached FD (ParentFD 0) or a dup of one.
+type OutputFDRecord struct {
+	FD           int              `json:"fd"`
+	ParentFD     int              `json:"parent_fd,omitempty"`
+	Attempt      int              `json:"attempt,omitempty"`
+	Owner        string           `json:"owner"`
+	OpenedAt     time.Time        `json:"opened_at"`
+	ClosedAt     time.Time        `json:"closed_at,omitzero"`
+	DoubleCloses int              `json:"double_closes,omitempty"`
+	Dups         []OutputFDRecord `json:"dups,omitempty"`
+}
+
+type OutputFDReport struct {
+	// Open lists detached FDs that are still owned.
+	Open []OutputFDRecord `json:"open"`
+	// Leaked lists dups whose file was never closed although their detached
+	// FD already was.
+	Leaked        []OutputFDRecord `json:"leaked"`
+	DoubleCloses  int              `json:"double_closes"`
+	UseAfterClose int              `json:"use_after_close"`
+	Recent        []OutputFDRecord `json:"recent"`
+}
+
+type outputFDEntry struct {
+	OutputFDRecord
+	owners int
+	file   *os.File
+	dups   []*outputFDEntry
+}
+
+var (
+	outputFDMu        sync.Mutex
+	outputFDOpen      = make(map[int]*outputFDEntry)
+	outputFDClosed    = make(map[int]*outputFDEntry)
+	outputFDHistory   []*outputFDEntry
+	outputFDDoubles   int
+	outputFDUseClosed int
+)
+
+// fileClosed reports whether f was closed, without touching its blocking
+// mode the way Fd() does.
+func fileClosed(f *os.File) bool {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return true
+	}
+	return rc.Control(func(uintptr) {}) != nil
+}
+
+// sweepDupsLocked marks dups whose file has been closed.
+func (e *outputFDEntry) sweepDupsLocked() {
+	for _, dup := range e.dups {
+		if dup.file != nil && fileClosed(dup.file) {
+			dup.ClosedAt = time.Now()
+			dup.file = nil
+		}
+	}
+}
+
+func (e *outputFDEntry) record() OutputFDRecord {
+	r := e.OutputFDRecord
+	r.Dups = nil
+	for _, dup := range e.dups {
+		r.Dups = append(r.Dups, dup.OutputFDRecord)
+	}
+	return r
+}
+
+func (e *outputFDEntry) lineage() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "fd %d (owner %s, opened %s", e.FD, e.Owner, e.OpenedAt.Format("15:04:05.000"))
+	if !e.ClosedAt.IsZero() {
+		fmt.Fprintf(&b, ", closed %s", e.ClosedAt.Format("15:04:05.000"))
+	}
+	b.WriteString(")")
+	for _, dup := range e.dups {
+		state := "open"
+		if !dup.ClosedAt.IsZero() {
+			state = "closed " + dup.ClosedAt.Format("15:04:05.000")
+		}
+		fmt.Fprintf(&b, " -> dup %d #%d by %s (%s)", dup.FD, dup.Attempt, dup.Owner, state)
+	}
+	return b.String()
+}
+
+func callerLocation(skip int) string {
+	_, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+}
+
+// adoptOutputFD registers owner as a user of the detached outputFD. Each
+// adoption must be paired with one closeOwnedOutputFD.
+func adoptOutputFD(outputFD int, owner string) {
+	if !isFDOutput(outputFD) {
+		return
+	}
+	if owner == "" {
+		owner = callerLocation(1)
+	}
+	outputFDMu.Lock()
+	defer outputFDMu.Unlock()
+	if e, ok := outputFDOpen[outputFD]; ok {
+		e.owners++
+		return
+	}
+	delete(outputFDClosed, outputFD)
+	e := &outputFDEntry{OutputFDRecord: OutputFDRecord{FD: outputFD, Owner: owner, OpenedAt: time.Now()}, owners: 1}
+	outputFDOpen[outputFD] = e
+	appendOutputFDHistoryLocked(e)
+}
+
+func appendOutputFDHistoryLocked(e *outputFDEntry) {
+	outputFDHistory = append(outputFDHistory, e)
+	if len(outputFDHistory) > maxOutputFDHistory {
+		outputFDHistory = outputFDHistory[len(outputFDHistory)-maxOutputFDHistory:]
+	}
+}
+
+// dupOutputFDForAttempt dups a detached FD for one provider attempt and, when
+// the FD was adopted, tracks the dup until its file is closed. A dup of an FD
+// nobody adopted is not tracked: its caller owns the detached FD.
+//
+// A closed number is refused only while it is still closed. Once the kernel
+// has handed it out again the old entry is stale and is dropped.
+func dupOutputFDForAttempt(outputFD int) (*os.File, error) {
+	owner := callerLocation(2)
+
+	dupFD, err := dupOutputFD(outputFD)
+	outputFDMu.Lock()
+	if e, closed := outputFDClosed[outputFD]; closed {
+		if err != nil && isBadFD(err) {
+			outputFDUseClosed++
+			GoLog("[OutputFD] refusing dup of closed fd %d by %s: %s\n", outputFD, owner, e.lineage())
+			outputFDMu.Unlock()
+			return nil, fmt.Errorf("output fd %d was already closed: %w", outputFD, syscall.EBADF)
+		}
+		if err == nil {
+			GoLog("[OutputFD] fd %d reused by %s after %s\n", outputFD, owner, e.lineage())
+			delete(outputFDClosed, outputFD)
+		}
+	}
+	parent := outputFDOpen[outputFD]
+	outputFDMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to duplicate output fd %d: %w", outputFD, err)
+	}
+	if err := prepareDupFDForWrite(dupFD, outputFD); err != nil {
+		_ = closeFD(dupFD)
+		return nil, err
+	}
+	file := os.NewFile(uintptr(dupFD), fmt.Sprintf("saf_fd_%d_dup_%d", outputFD, dupFD))
+
+	if parent == nil {
+		return file, nil
+	}
+
+	outputFDMu.Lock()
+	parent.sweepDupsLocked()
+	parent.dups = append(parent.dups, &outputFDEntry{
+		OutputFDRecord: OutputFDRecord{
+			FD:       dupFD,
+			ParentFD: outputFD,
+			Attempt:  len(parent.dups) + 1,
+			Owner:    owner,
+			OpenedAt: time.Now(),
+		},
+		file: file,
+	})
+	outputFDMu.Unlock()
+	return file, nil
+}
+
+// OutputFDReportSnapshot returns the registry state for debugging fdsan
+// aborts and descriptor leaks.
+func OutputFDReportSnapshot() OutputFDReport {
+	outputFDMu.Lock()
+	defer outputFDMu.Unlock()
+
+	report := OutputFDReport{
+		Open:          []OutputFDRecord{},
+		Leaked:        []OutputFDRecord{},
+		DoubleCloses:  outputFDDoubles,
+		UseAfterClose: outputFDUseClosed,
+		Recent:        make([]OutputFDRecord, 0, len(outputFDHistory)),
+	}
+	for i := len(outputFDHistory) - 1; i >= 0; i-- {
+		e := outputFDHistory[i]
+		e.sweepDupsLocked()
+		if e.ClosedAt.IsZero() {
+			report.Open = append(report.Open, e.record())
+		} else {
+			for _, dup := range e.dups {
+				if dup.ClosedAt.IsZero() {
+					report.Leaked = append(report.Leaked, dup.OutputFDRecord)
+				}
+			}
+		}
+		report.Recent = append(report.Recent, e.record())
+	}
+	return report
+}
+
+func GetOutputFDReportJSON() (string, error) {
+	jsonBytes, err := json.Marshal(OutputFDReportSnapshot())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
 func isFDOutput(outputFD int) bool {
 	return outputFD > 0
 }
 
+// readableOutputPath returns where the finished output of req can be read
+// back from: SAF outputs through their descriptor, local files directly.
+// Content URIs cannot be read from Go.
+func readableOutputPath(req DownloadRequest, path string) (string, error) {
+	if isFDOutput(req.OutputFD) {
+		return fmt.Sprintf("/proc/self/fd/%d", req.OutputFD), nil
+	}
+	if path == "" || strings.Contains(path, "://") {
+		return "", fmt.Errorf("output is not readable: %q", path)
+	}
+	return path, nil
+}
+
 func openOutputForWrite(outputPath string, outputFD int) (*os.File, error) {
+	if err := injectFault(faultStageOutput, outputPath); err != nil {
+		return nil, err
+	}
 	if isFDOutput(outputFD) {
 		// Never hand the original detached FD directly to a provider attempt.
 		// Fallback chains may retry with another provider after a failure.
 		// If the first attempt closes the original FD, its numeric ID can be
 		// reused by unrelated resources and a later close may trigger fdsan abort.
-		dupFD, err := dupOutputFD(outputFD)
-		if err != nil {
-			return nil, fmt.Errorf("failed to duplicate output fd %d: %w", outputFD, err)
-		}
-		if err := prepareDupFDForWrite(dupFD, outputFD); err != nil {
-			_ = closeFD(dupFD)
-			return nil, err
-		}
-		return os.NewFile(uintptr(dupFD), fmt.Sprintf("saf_fd_%d_dup_%d", outputFD, dupFD)), nil
+		return dupOutputFDForAttempt(outputFD)
 	}
 
 	path := strings.TrimSpace(outputPath)
@@ -44,6 +298,41 @@ func openOutputForWrite(outputPath string, outputFD int) (*os.File, error) {
 	return os.Create(outputPath)
 }
 
+// preallocateOutput reserves size bytes for a download whose length is
+// known, so large files are not fragmented on FAT32 SD cards and a full card
+// fails before any data is fetched. Only a lack of space is returned as an
+// error; unsupported filesystems just skip the step.
+func preallocateOutput(out *os.File, size int64) error {
+	if size < minPreallocBytes || !GetBackendConfig().PreallocateOutput {
+		return nil
+	}
+	err := fallocateOutput(out, size)
+	switch {
+	case err == nil:
+		return nil
+	case isPreallocNoSpace(err):
+		return fmt.Errorf("not enough free space for %d MB: %w", size>>20, err)
+	case !isPreallocUnsupported(err):
+		GoLog("[OutputFD] preallocation of %d bytes failed on %s: %v\n", size, out.Name(), err)
+	}
+	return nil
+}
+
+// closeOutput closes a download's output after cutting off the part of a
+// preallocated length that was never written, so a short or failed download
+// into an FD does not end in zero bytes. Unseekable outputs are just closed.
+func closeOutput(out *os.File) error {
+	if pos, err := out.Seek(0, io.SeekCurrent); err == nil {
+		if info, err := out.Stat(); err == nil && info.Size() > pos {
+			if err := out.Truncate(pos); err != nil {
+				out.Close()
+				return fmt.Errorf("failed to trim preallocated space: %w", err)
+			}
+		}
+	}
+	return out.Close()
+}
+
 func prepareDupFDForWrite(dupFD, originalFD int) error {
 	// Best-effort reset so retries start writing from byte 0.
 	if err := truncateFD(dupFD); err != nil {
@@ -59,11 +348,46 @@ func prepareDupFDForWrite(dupFD, originalFD int) error {
 	return nil
 }
 
+// closeOwnedOutputFD releases one adoption of outputFD and closes it when
+// the last owner is done. Closing an FD the registry already closed is
+// refused and logged.
 func closeOwnedOutputFD(outputFD int) {
 	if !isFDOutput(outputFD) {
 		return
 	}
 
+	outputFDMu.Lock()
+	if e, closed := outputFDClosed[outputFD]; closed {
+		e.DoubleCloses++
+		outputFDDoubles++
+		GoLog("[OutputFD] refusing second close of fd %d by %s: %s\n", outputFD, callerLocation(1), e.lineage())
+		outputFDMu.Unlock()
+		return
+	}
+	e, ok := outputFDOpen[outputFD]
+	if !ok {
+		// Never adopted: record the close so a second one is still caught.
+		e = &outputFDEntry{OutputFDRecord: OutputFDRecord{FD: outputFD, Owner: callerLocation(1), OpenedAt: time.Now()}, owners: 1}
+		appendOutputFDHistoryLocked(e)
+	}
+	e.owners--
+	if e.owners > 0 {
+		outputFDMu.Unlock()
+		return
+	}
+	e.ClosedAt = time.Now()
+	e.sweepDupsLocked()
+	delete(outputFDOpen, outputFD)
+	outputFDClosed[outputFD] = e
+	for _, dup := range e.dups {
+		if dup.ClosedAt.IsZero() {
+			GoLog("[OutputFD] closing fd %d with dup %d still open: %s\n", outputFD, dup.FD, e.lineage())
+			break
+		}
+	}
+	outputFDMu.Unlock()
+
+	syncOutputFDBeforeClose(outputFD)
 	if err := closeFD(outputFD); err != nil {
 		if !isBadFD(err) {
 			GoLog("[OutputFD] failed to close detached fd %d: %v\n", outputFD, err)
@@ -0,0 +1,156 @@
+//go:build !windows
+
+package gobackend
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func detachedTestFD(t *testing.T) int {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+func fdIsOpen(fd int) bool {
+	var st syscall.Stat_t
+	return syscall.Fstat(fd, &st) == nil
+}
+
+func TestOutputFDRegistryLifecycle(t *testing.T) {
+	before := OutputFDReportSnapshot()
+	fd := detachedTestFD(t)
+	adoptOutputFD(fd, "item-1")
+
+	first, err := openOutputForWrite("", fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+	second, err := openOutputForWrite("", fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closeOwnedOutputFD(fd)
+	if fdIsOpen(fd) {
+		t.Fatal("detached fd still open after its owner closed it")
+	}
+	report := OutputFDReportSnapshot()
+	if len(report.Recent) == 0 || report.Recent[0].FD != fd || len(report.Recent[0].Dups) != 2 {
+		t.Fatalf("unexpected lineage: %+v", report.Recent)
+	}
+	if report.Recent[0].Dups[0].ClosedAt.IsZero() || report.Recent[0].Dups[1].Attempt != 2 {
+		t.Errorf("unexpected dups: %+v", report.Recent[0].Dups)
+	}
+	leaked := false
+	for _, r := range report.Leaked {
+		leaked = leaked || r.ParentFD == fd
+	}
+	if !leaked {
+		t.Error("open second attempt not reported as leaked")
+	}
+	second.Close()
+
+	closeOwnedOutputFD(fd)
+	if _, err := openOutputForWrite("", fd); !errors.Is(err, syscall.EBADF) {
+		t.Fatalf("expected dup after close to be refused, got %v", err)
+	}
+	report = OutputFDReportSnapshot()
+	if report.DoubleCloses != before.DoubleCloses+1 || report.UseAfterClose != before.UseAfterClose+1 {
+		t.Errorf("double closes %d, use after close %d", report.DoubleCloses-before.DoubleCloses, report.UseAfterClose-before.UseAfterClose)
+	}
+}
+
+func TestOutputFDClosedByLastOwner(t *testing.T) {
+	fd := detachedTestFD(t)
+	adoptOutputFD(fd, "outer")
+	adoptOutputFD(fd, "inner")
+
+	closeOwnedOutputFD(fd)
+	if !fdIsOpen(fd) {
+		t.Fatal("fd closed while an owner remains")
+	}
+	closeOwnedOutputFD(fd)
+	if fdIsOpen(fd) {
+		t.Fatal("fd left open after the last owner")
+	}
+
+	// The kernel may hand the number out again; a new adoption starts fresh.
+	adoptOutputFD(fd, "reused")
+	outputFDMu.Lock()
+	_, closed := outputFDClosed[fd]
+	outputFDMu.Unlock()
+	if closed {
+		t.Error("re-adopted fd still marked closed")
+	}
+	outputFDMu.Lock()
+	delete(outputFDOpen, fd)
+	outputFDMu.Unlock()
+}
+
+func TestOutputFDDupWithoutAdoption(t *testing.T) {
+	fd := detachedTestFD(t)
+	f, err := openOutputForWrite("", fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	outputFDMu.Lock()
+	_, tracked := outputFDOpen[fd]
+	outputFDMu.Unlock()
+	if tracked {
+		t.Error("dup of an unadopted fd registered an owner")
+	}
+	if !fdIsOpen(fd) {
+		t.Fatal("unadopted fd closed by the registry")
+	}
+	syscall.Close(fd)
+}
+
+func TestOutputFDReusedNumberIsAccepted(t *testing.T) {
+	fd := detachedTestFD(t)
+	adoptOutputFD(fd, "first")
+	closeOwnedOutputFD(fd)
+
+	// The kernel hands out the lowest free number; fill lower holes until it
+	// gives back fd.
+	path := filepath.Join(t.TempDir(), "next.flac")
+	reused := -1
+	for i := 0; i < 64 && reused != fd; i++ {
+		next, err := syscall.Open(path, syscall.O_CREAT|syscall.O_RDWR, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer syscall.Close(next)
+		reused = next
+	}
+	if reused != fd {
+		t.Skipf("fd %d was not handed out again", fd)
+	}
+
+	f, err := openOutputForWrite("", reused)
+	if err != nil {
+		t.Fatalf("valid reused fd refused: %v", err)
+	}
+	f.Close()
+	outputFDMu.Lock()
+	_, closed := outputFDClosed[fd]
+	outputFDMu.Unlock()
+	if closed {
+		t.Error("stale closed entry kept after reuse")
+	}
+}
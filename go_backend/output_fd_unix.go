@@ -17,6 +17,10 @@ func seekFDStart(fd int) error {
 	return err
 }
 
+func syncFD(fd int) error {
+	return syscall.Fsync(fd)
+}
+
 func closeFD(fd int) error {
 	return syscall.Close(fd)
 }
@@ -16,6 +16,10 @@ func seekFDStart(fd int) error {
 	return nil
 }
 
+func syncFD(fd int) error {
+	return nil
+}
+
 func closeFD(fd int) error {
 	return nil
 }
@@ -0,0 +1,195 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ==================== Mirror output ====================
+//
+// A download can be written to a second target, e.g. an SD card copy of the
+// internal library. DownloadRequest.MirrorPath or MirrorFD names it; the
+// provider copy loops tee the HTTP body into it next to the primary output.
+// The mirror never fails the download: its write errors are recorded, the
+// partial copy is removed and the response's "mirror" field reports why.
+//
+// The teed bytes are only what the provider sent: tags are written after
+// the copy loop (often into padding, keeping the size), Amazon streams are
+// still encrypted and some providers (DASH, extensions) have no tee at all.
+// So a successful download always rewrites the mirror from the finished
+// primary, reading SAF primaries back through their descriptor. When the
+// primary cannot be read the mirror is removed rather than left stale.
+
+var errMirrorNotWritten = errors.New("mirror could not be refreshed: the primary is not readable")
+
+// OutputMirrorResult describes the mirror in a DownloadResponse.
+type OutputMirrorResult struct {
+	Path         string `json:"path,omitempty"`
+	FD           int    `json:"fd,omitempty"`
+	BytesWritten int64  `json:"bytes_written"`
+	Resynced     bool   `json:"resynced,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type outputMirrorTarget struct {
+	path    string
+	fd      int
+	opened  bool
+	written int64
+	err     error
+}
+
+// outputMirror is the mirror of one download attempt. A nil *outputMirror is
+// valid and mirrors nothing.
+type outputMirror struct {
+	target  *outputMirrorTarget
+	file    *os.File
+	written int64
+	err     error
+}
+
+var (
+	outputMirrorsMu sync.Mutex
+	outputMirrors   = make(map[string]*outputMirrorTarget)
+)
+
+func registerOutputMirror(itemID, path string, fd int) {
+	path = strings.TrimSpace(path)
+	if itemID == "" || path == "" && !isFDOutput(fd) {
+		return
+	}
+	outputMirrorsMu.Lock()
+	outputMirrors[itemID] = &outputMirrorTarget{path: path, fd: fd}
+	outputMirrorsMu.Unlock()
+}
+
+func takeOutputMirror(itemID string) *outputMirrorTarget {
+	outputMirrorsMu.Lock()
+	defer outputMirrorsMu.Unlock()
+	target := outputMirrors[itemID]
+	delete(outputMirrors, itemID)
+	return target
+}
+
+// openOutputMirror starts the item's mirror for a new attempt, truncating
+// whatever an earlier attempt left. It returns nil when there is no mirror or
+// it cannot be opened; the error is kept for the response.
+func openOutputMirror(itemID string) *outputMirror {
+	if itemID == "" {
+		return nil
+	}
+	outputMirrorsMu.Lock()
+	target := outputMirrors[itemID]
+	outputMirrorsMu.Unlock()
+	if target == nil {
+		return nil
+	}
+
+	file, err := openMirrorFile(target.path, target.fd)
+	outputMirrorsMu.Lock()
+	defer outputMirrorsMu.Unlock()
+	target.opened, target.written, target.err = true, 0, err
+	if err != nil {
+		GoLog("[Mirror] Failed to open mirror for %s: %v\n", itemID, err)
+		return nil
+	}
+	return &outputMirror{target: target, file: file}
+}
+
+func openMirrorFile(path string, fd int) (*os.File, error) {
+	if !isFDOutput(fd) && !strings.HasPrefix(path, "/proc/self/fd/") {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return openOutputForWrite(path, fd)
+}
+
+// Write always reports success so io.MultiWriter keeps feeding the primary
+// after the mirror failed.
+func (m *outputMirror) Write(p []byte) (int, error) {
+	if m.err == nil {
+		n, err := m.file.Write(p)
+		m.written += int64(n)
+		if err != nil {
+			m.err = err
+			GoLog("[Mirror] Write to mirror failed, continuing with primary only: %v\n", err)
+		}
+	}
+	return len(p), nil
+}
+
+// tee returns a writer feeding both primary and the mirror.
+func (m *outputMirror) tee(primary io.Writer) io.Writer {
+	if m == nil {
+		return primary
+	}
+	return io.MultiWriter(primary, m)
+}
+
+// close ends the attempt and records its outcome on the item's target.
+func (m *outputMirror) close() {
+	if m == nil {
+		return
+	}
+	err := m.file.Close()
+	if m.err != nil {
+		err = m.err
+	}
+	outputMirrorsMu.Lock()
+	m.target.written, m.target.err = m.written, err
+	outputMirrorsMu.Unlock()
+}
+
+// finishOutputMirror settles the item's mirror once the download is over:
+// a failed download removes it, a successful one copies the finished primary
+// into it and reports it in the response.
+func finishOutputMirror(req DownloadRequest, respJSON string) string {
+	target := takeOutputMirror(req.ItemID)
+	if target == nil {
+		return respJSON
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success {
+		if target.opened {
+			cleanupOutputOnError(target.path, target.fd)
+		}
+		return respJSON
+	}
+	if resp.AlreadyExists || strings.HasPrefix(resp.FilePath, "EXISTS:") {
+		return respJSON
+	}
+
+	result := &OutputMirrorResult{Path: target.path, FD: target.fd, BytesWritten: target.written}
+	var err error
+	if primary, readErr := readableOutputPath(req, strings.TrimSpace(resp.FilePath)); readErr != nil {
+		err = errMirrorNotWritten
+	} else if info, statErr := os.Stat(primary); statErr != nil || !info.Mode().IsRegular() {
+		err = errMirrorNotWritten
+	} else if copyErr := copyFileToOutput(primary, target.path, target.fd); copyErr != nil {
+		err = fmt.Errorf("failed to copy the finished file: %w", copyErr)
+	} else {
+		result.BytesWritten, result.Resynced = info.Size(), true
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		cleanupOutputOnError(target.path, target.fd)
+		GoLog("[Mirror] Mirror for %s failed: %v\n", req.ItemID, err)
+	} else if !isFDOutput(target.fd) {
+		syncOutputPath(target.path)
+	}
+
+	resp.Mirror = result
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return respJSON
+	}
+	return string(jsonBytes)
+}
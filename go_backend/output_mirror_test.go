@@ -0,0 +1,127 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mirrorTestResponse(t *testing.T, respJSON string) DownloadResponse {
+	t.Helper()
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestOutputMirrorTeesAndResyncs(t *testing.T) {
+	dir := t.TempDir()
+	primaryPath := filepath.Join(dir, "internal", "track.flac")
+	mirrorPath := filepath.Join(dir, "sdcard", "Music", "track.flac")
+	if err := os.MkdirAll(filepath.Dir(primaryPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	registerOutputMirror("mirror-item", mirrorPath, 0)
+	primary, err := os.Create(primaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := openOutputMirror("mirror-item")
+	if mirror == nil {
+		t.Fatal("expected a mirror")
+	}
+	if _, err := io.Copy(mirror.tee(primary), strings.NewReader("fLaC audio")); err != nil {
+		t.Fatal(err)
+	}
+	primary.Close()
+	mirror.close()
+
+	// Tagging into padding rewrites the primary after the copy loop without
+	// changing its size.
+	if err := os.WriteFile(primaryPath, []byte("fLaC AUDIO"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	respJSON, _ := json.Marshal(DownloadResponse{Success: true, FilePath: primaryPath})
+	resp := mirrorTestResponse(t, finishOutputMirror(DownloadRequest{ItemID: "mirror-item"}, string(respJSON)))
+	if resp.Mirror == nil || resp.Mirror.Error != "" || !resp.Mirror.Resynced {
+		t.Fatalf("unexpected mirror result: %+v", resp.Mirror)
+	}
+	got, err := os.ReadFile(mirrorPath)
+	if err != nil || !bytes.Equal(got, []byte("fLaC AUDIO")) {
+		t.Fatalf("mirror = %q, %v", got, err)
+	}
+}
+
+func TestOutputMirrorFailureKeepsPrimary(t *testing.T) {
+	dir := t.TempDir()
+	mirrorPath := filepath.Join(dir, "mirror.flac")
+	registerOutputMirror("mirror-fail", mirrorPath, 0)
+	mirror := openOutputMirror("mirror-fail")
+	mirror.file.Close() // simulate the SD card going away
+
+	var primary bytes.Buffer
+	n, err := io.Copy(mirror.tee(&primary), strings.NewReader("audio"))
+	if err != nil || n != 5 || primary.String() != "audio" {
+		t.Fatalf("primary write affected by mirror: n=%d err=%v", n, err)
+	}
+	mirror.close()
+
+	resp := mirrorTestResponse(t, finishOutputMirror(DownloadRequest{ItemID: "mirror-fail"}, `{"success":true,"file_path":"content://track"}`))
+	if resp.Mirror == nil || resp.Mirror.Error == "" {
+		t.Fatalf("expected mirror error, got %+v", resp.Mirror)
+	}
+	if _, err := os.Stat(mirrorPath); !os.IsNotExist(err) {
+		t.Fatalf("partial mirror was not removed: %v", err)
+	}
+}
+
+func TestOutputMirrorRemovedOnFailedDownload(t *testing.T) {
+	mirrorPath := filepath.Join(t.TempDir(), "mirror.flac")
+	registerOutputMirror("mirror-failed-download", mirrorPath, 0)
+	openOutputMirror("mirror-failed-download").close()
+
+	out := finishOutputMirror(DownloadRequest{ItemID: "mirror-failed-download"}, `{"success":false,"error":"boom"}`)
+	if strings.Contains(out, `"mirror"`) {
+		t.Fatalf("failed download should not report a mirror: %s", out)
+	}
+	if _, err := os.Stat(mirrorPath); !os.IsNotExist(err) {
+		t.Fatalf("mirror of failed download was not removed: %v", err)
+	}
+	if openOutputMirror("mirror-failed-download") != nil {
+		t.Fatal("mirror should be forgotten after finishing")
+	}
+}
+
+func TestOutputMirrorCopiesFromSAFPrimary(t *testing.T) {
+	dir := t.TempDir()
+	primaryPath := filepath.Join(dir, "primary.flac")
+	if err := os.WriteFile(primaryPath, []byte("fLaC decrypted and tagged"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	primary, err := os.Open(primaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+
+	mirrorPath := filepath.Join(dir, "mirror.flac")
+	registerOutputMirror("mirror-saf", mirrorPath, 0)
+	mirror := openOutputMirror("mirror-saf")
+	io.Copy(mirror.tee(io.Discard), strings.NewReader("encrypted bytes!!!!!!!!!"))
+	mirror.close()
+
+	req := DownloadRequest{ItemID: "mirror-saf", OutputFD: int(primary.Fd())}
+	resp := mirrorTestResponse(t, finishOutputMirror(req, `{"success":true,"file_path":"content://track"}`))
+	if resp.Mirror == nil || resp.Mirror.Error != "" || !resp.Mirror.Resynced {
+		t.Fatalf("unexpected mirror result: %+v", resp.Mirror)
+	}
+	if got, _ := os.ReadFile(mirrorPath); string(got) != "fLaC decrypted and tagged" {
+		t.Fatalf("mirror = %q", got)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build linux
+
+package gobackend
+
+import (
+	"os"
+	"syscall"
+)
+
+// FALLOC_FL_KEEP_SIZE reserves blocks without changing the file size, so a
+// download that stops early leaves no trailing zeros behind.
+const fallocKeepSize = 0x1
+
+func fallocateOutput(f *os.File, size int64) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var allocErr error
+	if err := rc.Control(func(fd uintptr) {
+		allocErr = syscall.Fallocate(int(fd), fallocKeepSize, 0, size)
+		if allocErr != nil && isPreallocUnsupported(allocErr) {
+			// FUSE-backed SD cards often lack fallocate. Extending the file
+			// still makes FAT32 allocate its clusters up front; closeOutput
+			// trims whatever the download does not fill.
+			allocErr = syscall.Ftruncate(int(fd), size)
+		}
+	}); err != nil {
+		return err
+	}
+	return allocErr
+}
+
+func isPreallocUnsupported(err error) bool {
+	switch err {
+	case syscall.EOPNOTSUPP, syscall.ENOSYS, syscall.EINVAL, syscall.EPERM, syscall.EACCES, syscall.ESPIPE, syscall.ENODEV:
+		return true
+	default:
+		return false
+	}
+}
+
+func isPreallocNoSpace(err error) bool {
+	return err == syscall.ENOSPC || err == syscall.EFBIG
+}
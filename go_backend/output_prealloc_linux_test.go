@@ -0,0 +1,86 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestPreallocateOutputReservesBlocks(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	const size = 4 << 20
+	if err := preallocateOutput(f, size); err != nil {
+		t.Fatalf("preallocateOutput: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	// Either KEEP_SIZE reserved blocks or the fallback extended the file.
+	if info.Size() != 0 && info.Size() != size {
+		t.Fatalf("size = %d, want 0 or %d", info.Size(), size)
+	}
+	if info.Size() == 0 && st.Blocks*512 < size {
+		t.Skipf("filesystem did not reserve blocks (%d)", st.Blocks*512)
+	}
+}
+
+func TestPreallocateOutputSkipsSmallAndDisabled(t *testing.T) {
+	original := GetBackendConfig()
+	defer UpdateBackendConfig(original)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := preallocateOutput(f, minPreallocBytes-1); err != nil {
+		t.Fatal(err)
+	}
+	disabled := original
+	disabled.PreallocateOutput = false
+	UpdateBackendConfig(disabled)
+	if err := preallocateOutput(f, 8<<20); err != nil {
+		t.Fatal(err)
+	}
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(f.Fd()), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Size != 0 || st.Blocks != 0 {
+		t.Fatalf("expected untouched file, got size=%d blocks=%d", st.Size, st.Blocks)
+	}
+}
+
+func TestCloseOutputTrimsUnwrittenPreallocation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.flac")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same state the ftruncate fallback leaves behind.
+	if err := f.Truncate(4 << 20); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("fLaC partial")); err != nil {
+		t.Fatal(err)
+	}
+	if err := closeOutput(f); err != nil {
+		t.Fatalf("closeOutput: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "fLaC partial" {
+		t.Fatalf("file holds %d bytes, want only the written ones", len(data))
+	}
+}
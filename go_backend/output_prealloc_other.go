@@ -0,0 +1,24 @@
+//go:build !linux
+
+package gobackend
+
+import (
+	"errors"
+	"os"
+)
+
+var errPreallocUnsupported = errors.New("preallocation not supported on this platform")
+
+// fallocateOutput is a no-op outside Linux/Android: iOS writes into the app
+// container on APFS, where fragmentation is not a concern.
+func fallocateOutput(f *os.File, size int64) error {
+	return errPreallocUnsupported
+}
+
+func isPreallocUnsupported(err error) bool {
+	return errors.Is(err, errPreallocUnsupported)
+}
+
+func isPreallocNoSpace(err error) bool {
+	return false
+}
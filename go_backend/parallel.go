@@ -142,10 +142,24 @@ type ParallelDownloadResult struct {
 	CoverData  []byte
 	LyricsData *LyricsResponse
 	LyricsLRC  string
+	LyricsTags map[string]string
 	CoverErr   error
 	LyricsErr  error
 }
 
+// maxConcurrentAssetFetches bounds cover/lyrics requests across all tracks so
+// a large playlist downloading several tracks at once does not flood the
+// cover CDNs and lyrics providers.
+const maxConcurrentAssetFetches = 6
+
+var assetFetchSlots = make(chan struct{}, maxConcurrentAssetFetches)
+
+func withAssetFetchSlot(fn func()) {
+	assetFetchSlots <- struct{}{}
+	defer func() { <-assetFetchSlots }()
+	fn()
+}
+
 func FetchCoverAndLyricsParallel(
 	coverURL string,
 	maxQualityCover bool,
@@ -163,7 +177,7 @@ func FetchCoverAndLyricsParallel(
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			data, err := downloadCoverToMemory(coverURL, maxQualityCover)
+			data, err := fetchTrackCover(coverURL, maxQualityCover)
 			resultMu.Lock()
 			if err != nil {
 				result.CoverErr = err
@@ -178,17 +192,14 @@ func FetchCoverAndLyricsParallel(
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			client := NewLyricsClient()
-			durationSec := float64(durationMs) / 1000.0
-			lyrics, err := client.FetchLyricsAllSources(spotifyID, trackName, artistName, durationSec)
+			lyrics, lrc, tags, err := fetchTrackLyrics(spotifyID, trackName, artistName, durationMs)
 			resultMu.Lock()
 			if err != nil {
 				result.LyricsErr = err
-			} else if lyrics != nil && len(lyrics.Lines) > 0 {
-				result.LyricsData = lyrics
-				result.LyricsLRC = convertToLRCWithMetadata(lyrics, trackName, artistName)
 			} else {
-				result.LyricsErr = fmt.Errorf("no lyrics found")
+				result.LyricsData = lyrics
+				result.LyricsLRC = lrc
+				result.LyricsTags = tags
 			}
 			resultMu.Unlock()
 		}()
@@ -198,6 +209,81 @@ func FetchCoverAndLyricsParallel(
 	return result
 }
 
+func fetchTrackCover(coverURL string, maxQualityCover bool) (data []byte, err error) {
+	withAssetFetchSlot(func() {
+		data, err = downloadCoverToMemory(coverURL, maxQualityCover)
+	})
+	return data, err
+}
+
+// fetchTrackLyrics returns the lyrics, their LRC rendering and secondary
+// lyrics tags, or an error when no source had synced or plain lines.
+func fetchTrackLyrics(spotifyID, trackName, artistName string, durationMs int64) (lyrics *LyricsResponse, lrc string, tags map[string]string, err error) {
+	withAssetFetchSlot(func() {
+		client := NewLyricsClient()
+		durationSec := float64(durationMs) / 1000.0
+		lyrics, err = client.FetchLyricsAllSources(spotifyID, trackName, artistName, durationSec)
+	})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if lyrics == nil || len(lyrics.Lines) == 0 {
+		return nil, "", nil, fmt.Errorf("no lyrics found")
+	}
+	lrc, tags = renderLyricsForEmbed(lyrics, trackName, artistName)
+	return lyrics, lrc, tags, nil
+}
+
+// TrackAssetFetch runs the cover and lyrics fetch for one track in the
+// background so it overlaps with the audio download; Wait joins it before
+// tagging.
+type TrackAssetFetch struct {
+	done   chan struct{}
+	result *ParallelDownloadResult
+}
+
+// StartTrackAssetFetch begins fetching assets for req. With embedOnly set,
+// nothing is fetched unless the request embeds metadata, which is what the
+// tagging providers want; YouTube returns assets to Flutter regardless.
+func StartTrackAssetFetch(req DownloadRequest, embedOnly bool) *TrackAssetFetch {
+	hasCover := req.CoverURL != "" || len(req.CoverCandidates) > 0
+	embedLyrics := req.EmbedLyrics
+	if embedOnly && !req.EmbedMetadata {
+		hasCover = false
+		embedLyrics = false
+	}
+
+	f := &TrackAssetFetch{done: make(chan struct{})}
+	if !hasCover && !embedLyrics {
+		f.result = &ParallelDownloadResult{}
+		close(f.done)
+		return f
+	}
+
+	go func() {
+		defer close(f.done)
+		coverURL := ""
+		if hasCover {
+			coverURL = resolveTrackCoverURL(req)
+		}
+		f.result = FetchCoverAndLyricsParallel(
+			coverURL,
+			req.EmbedMaxQualityCover,
+			req.SpotifyID,
+			req.matchTitle(),
+			req.matchArtist(),
+			embedLyrics,
+			int64(req.DurationMS),
+		)
+	}()
+	return f
+}
+
+func (f *TrackAssetFetch) Wait() *ParallelDownloadResult {
+	<-f.done
+	return f.result
+}
+
 type PreWarmCacheRequest struct {
 	ISRC       string
 	TrackName  string
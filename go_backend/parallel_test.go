@@ -0,0 +1,12 @@
+package gobackend
+
+import "testing"
+
+func TestStartTrackAssetFetchSkipsWhenNotEmbedding(t *testing.T) {
+	req := DownloadRequest{CoverURL: "https://example.invalid/cover.jpg", EmbedLyrics: true}
+
+	result := StartTrackAssetFetch(req, true).Wait()
+	if result == nil || result.CoverData != nil || result.CoverErr != nil || result.LyricsErr != nil {
+		t.Fatalf("expected empty result without network access, got %+v", result)
+	}
+}
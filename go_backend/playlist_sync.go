@@ -0,0 +1,421 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	playlistSyncStateFile = "playlist_sync.json"
+	playlistSyncTimeout   = 60 * time.Second
+
+	SyncRemovedFlag   = "flag"
+	SyncRemovedDelete = "delete"
+)
+
+// SyncKnownTrack is a track Flutter already has in its download history.
+type SyncKnownTrack struct {
+	SpotifyID string `json:"spotify_id,omitempty"`
+	ISRC      string `json:"isrc,omitempty"`
+	FilePath  string `json:"file_path,omitempty"`
+}
+
+type PlaylistSyncRequest struct {
+	SourceURL       string           `json:"source_url"`
+	OutputDir       string           `json:"output_dir,omitempty"`
+	KnownTracks     []SyncKnownTrack `json:"known_tracks,omitempty"`
+	RemovedMode     string           `json:"removed_mode,omitempty"`
+	IntervalMinutes int              `json:"interval_minutes,omitempty"`
+}
+
+type SyncRemovedTrack struct {
+	SpotifyID string `json:"spotify_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Artists   string `json:"artists,omitempty"`
+	ISRC      string `json:"isrc,omitempty"`
+	FilePath  string `json:"file_path,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+type PlaylistSyncReport struct {
+	SourceURL      string               `json:"source_url"`
+	SourceType     string               `json:"source_type"`
+	Name           string               `json:"name,omitempty"`
+	Total          int                  `json:"total"`
+	NewTracks      []AlbumTrackMetadata `json:"new_tracks"`
+	ExistingCount  int                  `json:"existing_count"`
+	Removed        []SyncRemovedTrack   `json:"removed"`
+	FirstSync      bool                 `json:"first_sync"`
+	SyncedAt       int64                `json:"synced_at"`
+	NextSyncAt     int64                `json:"next_sync_at,omitempty"`
+	LibraryMatched int                  `json:"library_matched"`
+}
+
+type playlistSyncTrack struct {
+	SpotifyID string `json:"spotify_id"`
+	Name      string `json:"name,omitempty"`
+	Artists   string `json:"artists,omitempty"`
+	ISRC      string `json:"isrc,omitempty"`
+}
+
+type playlistSyncEntry struct {
+	SourceURL       string              `json:"source_url"`
+	OutputDir       string              `json:"output_dir,omitempty"`
+	Name            string              `json:"name,omitempty"`
+	Tracks          []playlistSyncTrack `json:"tracks"`
+	LastSyncedAt    int64               `json:"last_synced_at"`
+	IntervalMinutes int                 `json:"interval_minutes,omitempty"`
+	RemovedMode     string              `json:"removed_mode,omitempty"`
+}
+
+type PlaylistSyncSchedule struct {
+	SourceURL       string `json:"source_url"`
+	Name            string `json:"name,omitempty"`
+	OutputDir       string `json:"output_dir,omitempty"`
+	IntervalMinutes int    `json:"interval_minutes"`
+	LastSyncedAt    int64  `json:"last_synced_at"`
+	NextSyncAt      int64  `json:"next_sync_at"`
+	Due             bool   `json:"due"`
+}
+
+var (
+	playlistSyncMu       sync.Mutex
+	playlistSyncStateDir string
+	playlistSyncEntries  map[string]*playlistSyncEntry
+)
+
+func SetPlaylistSyncStateDir(dir string) error {
+	playlistSyncMu.Lock()
+	defer playlistSyncMu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create sync state dir: %w", err)
+	}
+	if err := openStore(dir, playlistSyncStoreSchema); err != nil {
+		return err
+	}
+	playlistSyncStateDir = dir
+	playlistSyncEntries = nil
+	return nil
+}
+
+func loadPlaylistSyncStateLocked() map[string]*playlistSyncEntry {
+	if playlistSyncEntries != nil {
+		return playlistSyncEntries
+	}
+	playlistSyncEntries = make(map[string]*playlistSyncEntry)
+	if playlistSyncStateDir == "" {
+		return playlistSyncEntries
+	}
+
+	data, err := os.ReadFile(filepath.Join(playlistSyncStateDir, playlistSyncStateFile))
+	if err != nil {
+		return playlistSyncEntries
+	}
+	if err := json.Unmarshal(data, &playlistSyncEntries); err != nil {
+		GoLog("[PlaylistSync] Ignoring corrupt state file: %v\n", err)
+		playlistSyncEntries = make(map[string]*playlistSyncEntry)
+	}
+	return playlistSyncEntries
+}
+
+func savePlaylistSyncStateLocked() error {
+	if playlistSyncStateDir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(playlistSyncEntries, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(playlistSyncStateDir, playlistSyncStateFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func playlistSyncKey(parsed spotifyURI) string {
+	return parsed.Type + ":" + parsed.ID
+}
+
+// fetchSyncSource returns the current track list of a Spotify playlist or album.
+func fetchSyncSource(ctx context.Context, sourceURL string) (string, []AlbumTrackMetadata, error) {
+	var data interface{}
+	client, err := NewSpotifyMetadataClient()
+	if err == nil {
+		data, err = client.GetFilteredData(ctx, sourceURL, false, 0)
+	}
+	if err != nil {
+		if !shouldTrySpotFetchFallback(err) {
+			return "", nil, err
+		}
+		fallback, apiErr := GetSpotifyDataWithAPI(ctx, sourceURL, DefaultSpotFetchAPIBaseURL)
+		if apiErr != nil {
+			return "", nil, err
+		}
+		data = fallback
+	}
+
+	switch payload := data.(type) {
+	case *PlaylistResponsePayload:
+		return payload.PlaylistInfo.Owner.Name, payload.TrackList, nil
+	case PlaylistResponsePayload:
+		return payload.PlaylistInfo.Owner.Name, payload.TrackList, nil
+	case *AlbumResponsePayload:
+		return payload.AlbumInfo.Name, payload.TrackList, nil
+	default:
+		return "", nil, fmt.Errorf("sync supports only playlists and albums")
+	}
+}
+
+type syncLibraryIndex struct {
+	bySpotifyID map[string]string
+	byISRC      map[string]string
+	outputDir   string
+}
+
+func newSyncLibraryIndex(req PlaylistSyncRequest) *syncLibraryIndex {
+	idx := &syncLibraryIndex{
+		bySpotifyID: make(map[string]string),
+		byISRC:      make(map[string]string),
+		outputDir:   req.OutputDir,
+	}
+	for _, known := range req.KnownTracks {
+		if known.SpotifyID != "" {
+			idx.bySpotifyID[known.SpotifyID] = known.FilePath
+		}
+		if known.ISRC != "" {
+			idx.byISRC[strings.ToUpper(known.ISRC)] = known.FilePath
+		}
+	}
+	return idx
+}
+
+// find reports whether the track is already present, either in Flutter's
+// history or in the output folder's ISRC index.
+func (idx *syncLibraryIndex) find(spotifyID, isrc string) (string, bool) {
+	if path, ok := idx.bySpotifyID[spotifyID]; ok && spotifyID != "" {
+		return path, true
+	}
+	if isrc == "" {
+		return "", false
+	}
+	if path, ok := idx.byISRC[strings.ToUpper(isrc)]; ok {
+		return path, true
+	}
+	if idx.outputDir != "" {
+		if path, ok := checkISRCExistsInternal(idx.outputDir, isrc); ok {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+func diffSyncTracks(current []AlbumTrackMetadata, previous []playlistSyncTrack, library *syncLibraryIndex) ([]AlbumTrackMetadata, int, []SyncRemovedTrack) {
+	currentIDs := make(map[string]bool, len(current))
+	newTracks := make([]AlbumTrackMetadata, 0)
+	existing := 0
+
+	for _, track := range current {
+		currentIDs[track.SpotifyID] = true
+		if _, ok := library.find(track.SpotifyID, track.ISRC); ok {
+			existing++
+			continue
+		}
+		newTracks = append(newTracks, track)
+	}
+
+	removed := make([]SyncRemovedTrack, 0)
+	for _, prev := range previous {
+		if currentIDs[prev.SpotifyID] {
+			continue
+		}
+		filePath, _ := library.find(prev.SpotifyID, prev.ISRC)
+		removed = append(removed, SyncRemovedTrack{
+			SpotifyID: prev.SpotifyID,
+			Name:      prev.Name,
+			Artists:   prev.Artists,
+			ISRC:      prev.ISRC,
+			FilePath:  filePath,
+		})
+	}
+	return newTracks, existing, removed
+}
+
+// deleteRemovedTracks only deletes files inside the sync's output folder so a
+// stale history path can never point the sync at unrelated files.
+func deleteRemovedTracks(removed []SyncRemovedTrack, outputDir string) {
+	if outputDir == "" {
+		return
+	}
+	for i := range removed {
+		path := removed[i].FilePath
+		if path == "" || !isPathWithinBase(outputDir, path) {
+			continue
+		}
+		if err := trashOrRemove(path, TrashReasonSyncRemoved); err != nil {
+			GoLog("[PlaylistSync] Failed to delete %s: %v\n", path, err)
+			continue
+		}
+		removed[i].Deleted = true
+		if removed[i].ISRC != "" {
+			GetISRCIndex(outputDir).remove(removed[i].ISRC)
+		}
+	}
+}
+
+// SyncPlaylist diffs a Spotify playlist/album against the local library and
+// the previous sync snapshot. New tracks are returned for Flutter to enqueue;
+// tracks no longer in the source are flagged or deleted per RemovedMode.
+func SyncPlaylist(req PlaylistSyncRequest) (*PlaylistSyncReport, error) {
+	parsed, err := parseSpotifyURI(req.SourceURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source URL: %w", err)
+	}
+	if parsed.Type != "playlist" && parsed.Type != "album" {
+		return nil, fmt.Errorf("sync supports only playlists and albums, got %s", parsed.Type)
+	}
+	req.OutputDir = strings.TrimSpace(req.OutputDir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), playlistSyncTimeout)
+	defer cancel()
+
+	name, tracks, err := fetchSyncSource(ctx, req.SourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	key := playlistSyncKey(parsed)
+	playlistSyncMu.Lock()
+	defer playlistSyncMu.Unlock()
+
+	entries := loadPlaylistSyncStateLocked()
+	entry, hadEntry := entries[key]
+	var previous []playlistSyncTrack
+	if hadEntry {
+		previous = entry.Tracks
+		if req.OutputDir == "" {
+			req.OutputDir = entry.OutputDir
+		}
+		if req.RemovedMode == "" {
+			req.RemovedMode = entry.RemovedMode
+		}
+		if req.IntervalMinutes == 0 {
+			req.IntervalMinutes = entry.IntervalMinutes
+		}
+	}
+
+	library := newSyncLibraryIndex(req)
+	newTracks, existing, removed := diffSyncTracks(tracks, previous, library)
+	if req.RemovedMode == SyncRemovedDelete {
+		deleteRemovedTracks(removed, req.OutputDir)
+	}
+
+	now := time.Now()
+	snapshot := make([]playlistSyncTrack, 0, len(tracks))
+	for _, t := range tracks {
+		snapshot = append(snapshot, playlistSyncTrack{SpotifyID: t.SpotifyID, Name: t.Name, Artists: t.Artists, ISRC: t.ISRC})
+	}
+	entries[key] = &playlistSyncEntry{
+		SourceURL:       req.SourceURL,
+		OutputDir:       req.OutputDir,
+		Name:            name,
+		Tracks:          snapshot,
+		LastSyncedAt:    now.Unix(),
+		IntervalMinutes: req.IntervalMinutes,
+		RemovedMode:     req.RemovedMode,
+	}
+	if err := savePlaylistSyncStateLocked(); err != nil {
+		GoLog("[PlaylistSync] Warning: failed to save state: %v\n", err)
+	}
+
+	report := &PlaylistSyncReport{
+		SourceURL:      req.SourceURL,
+		SourceType:     parsed.Type,
+		Name:           name,
+		Total:          len(tracks),
+		NewTracks:      newTracks,
+		ExistingCount:  existing,
+		Removed:        removed,
+		FirstSync:      !hadEntry,
+		SyncedAt:       now.Unix(),
+		LibraryMatched: existing,
+	}
+	if req.IntervalMinutes > 0 {
+		report.NextSyncAt = now.Add(time.Duration(req.IntervalMinutes) * time.Minute).Unix()
+	}
+
+	GoLog("[PlaylistSync] %s: %d tracks, %d new, %d removed\n", key, len(tracks), len(newTracks), len(removed))
+	return report, nil
+}
+
+// GetPlaylistSyncSchedules lists scheduled syncs; Flutter's background worker
+// re-runs SyncPlaylist for entries marked due.
+func GetPlaylistSyncSchedules() []PlaylistSyncSchedule {
+	playlistSyncMu.Lock()
+	defer playlistSyncMu.Unlock()
+
+	now := time.Now().Unix()
+	schedules := make([]PlaylistSyncSchedule, 0)
+	for _, entry := range loadPlaylistSyncStateLocked() {
+		if entry.IntervalMinutes <= 0 {
+			continue
+		}
+		next := entry.LastSyncedAt + int64(entry.IntervalMinutes)*60
+		schedules = append(schedules, PlaylistSyncSchedule{
+			SourceURL:       entry.SourceURL,
+			Name:            entry.Name,
+			OutputDir:       entry.OutputDir,
+			IntervalMinutes: entry.IntervalMinutes,
+			LastSyncedAt:    entry.LastSyncedAt,
+			NextSyncAt:      next,
+			Due:             now >= next,
+		})
+	}
+	return schedules
+}
+
+func RemovePlaylistSync(sourceURL string) error {
+	parsed, err := parseSpotifyURI(sourceURL)
+	if err != nil {
+		return fmt.Errorf("invalid source URL: %w", err)
+	}
+
+	playlistSyncMu.Lock()
+	defer playlistSyncMu.Unlock()
+
+	delete(loadPlaylistSyncStateLocked(), playlistSyncKey(parsed))
+	return savePlaylistSyncStateLocked()
+}
+
+func SyncPlaylistJSON(requestJSON string) (string, error) {
+	var req PlaylistSyncRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid request: %w", err)
+	}
+
+	report, err := SyncPlaylist(req)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(report)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func GetPlaylistSyncSchedulesJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetPlaylistSyncSchedules())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
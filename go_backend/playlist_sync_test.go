@@ -0,0 +1,34 @@
+package gobackend
+
+import "testing"
+
+func TestDiffSyncTracks(t *testing.T) {
+	library := newSyncLibraryIndex(PlaylistSyncRequest{
+		KnownTracks: []SyncKnownTrack{
+			{SpotifyID: "a", FilePath: "/music/a.flac"},
+			{ISRC: "usabc0000002", FilePath: "/music/b.flac"},
+		},
+	})
+
+	current := []AlbumTrackMetadata{
+		{SpotifyID: "a", Name: "A"},
+		{SpotifyID: "b", Name: "B", ISRC: "USABC0000002"},
+		{SpotifyID: "c", Name: "C"},
+	}
+	previous := []playlistSyncTrack{
+		{SpotifyID: "a"},
+		{SpotifyID: "gone", Name: "Gone", ISRC: "USABC0000002"},
+	}
+
+	newTracks, existing, removed := diffSyncTracks(current, previous, library)
+
+	if existing != 2 {
+		t.Fatalf("expected 2 existing tracks, got %d", existing)
+	}
+	if len(newTracks) != 1 || newTracks[0].SpotifyID != "c" {
+		t.Fatalf("expected only track c to be new, got %+v", newTracks)
+	}
+	if len(removed) != 1 || removed[0].SpotifyID != "gone" || removed[0].FilePath != "/music/b.flac" {
+		t.Fatalf("unexpected removed tracks: %+v", removed)
+	}
+}
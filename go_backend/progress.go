@@ -2,6 +2,7 @@ package gobackend
 
 import (
 	"encoding/json"
+	"math"
 	"sync"
 	"time"
 )
@@ -17,13 +18,19 @@ type DownloadProgress struct {
 }
 
 type ItemProgress struct {
-	ItemID        string  `json:"item_id"`
-	BytesTotal    int64   `json:"bytes_total"`
-	BytesReceived int64   `json:"bytes_received"`
-	Progress      float64 `json:"progress"`
-	SpeedMBps     float64 `json:"speed_mbps"`
-	IsDownloading bool    `json:"is_downloading"`
-	Status        string  `json:"status"`
+	ItemID            string  `json:"item_id"`
+	BytesTotal        int64   `json:"bytes_total"`
+	BytesReceived     int64   `json:"bytes_received"`
+	Progress          float64 `json:"progress"`
+	SpeedMBps         float64 `json:"speed_mbps"`
+	SmoothedSpeedMBps float64 `json:"smoothed_speed_mbps"`
+	ETASeconds        int64   `json:"eta_seconds"`
+	IsDownloading     bool    `json:"is_downloading"`
+	Status            string  `json:"status"`
+	// Stages reports the per-task state when the track runs as a task graph.
+	Stages []TrackStage `json:"stages,omitempty"`
+	// NowPlaying is the live title of a stream being recorded.
+	NowPlaying string `json:"now_playing,omitempty"`
 }
 
 type MultiProgress struct {
@@ -48,6 +55,7 @@ func getProgress() DownloadProgress {
 			Progress:      item.Progress * 100,
 			BytesTotal:    item.BytesTotal,
 			BytesReceived: item.BytesReceived,
+			Speed:         item.SmoothedSpeedMBps,
 			IsDownloading: item.IsDownloading,
 			Status:        item.Status,
 		}
@@ -80,16 +88,42 @@ func GetItemProgress(itemID string) string {
 
 func StartItemProgress(itemID string) {
 	multiMu.Lock()
-	defer multiMu.Unlock()
-
-	multiProgress.Items[itemID] = &ItemProgress{
+	// Keep stages recorded before the audio task (re)started the item.
+	var stages []TrackStage
+	if existing, ok := multiProgress.Items[itemID]; ok {
+		stages = existing.Stages
+	}
+	item := &ItemProgress{
 		ItemID:        itemID,
 		BytesTotal:    0,
 		BytesReceived: 0,
 		Progress:      0,
+		ETASeconds:    -1,
 		IsDownloading: true,
 		Status:        "downloading",
+		Stages:        stages,
 	}
+	multiProgress.Items[itemID] = item
+	snapshot := *item
+	multiMu.Unlock()
+
+	emitItemProgress(&snapshot)
+}
+
+// updateItemProgress applies update to itemID, if it is tracked, and pushes
+// the new state once multiMu is released.
+func updateItemProgress(itemID string, update func(item *ItemProgress)) {
+	multiMu.Lock()
+	item, ok := multiProgress.Items[itemID]
+	if !ok {
+		multiMu.Unlock()
+		return
+	}
+	update(item)
+	snapshot := *item
+	multiMu.Unlock()
+
+	emitItemProgress(&snapshot)
 }
 
 func SetItemBytesTotal(itemID string, total int64) {
@@ -102,46 +136,68 @@ func SetItemBytesTotal(itemID string, total int64) {
 }
 
 func SetItemBytesReceived(itemID string, received int64) {
-	multiMu.Lock()
-	defer multiMu.Unlock()
-
-	if item, ok := multiProgress.Items[itemID]; ok {
+	updateItemProgress(itemID, func(item *ItemProgress) {
 		item.BytesReceived = received
 		if item.BytesTotal > 0 {
 			item.Progress = float64(received) / float64(item.BytesTotal)
 		}
-	}
+	})
 }
 
 func SetItemBytesReceivedWithSpeed(itemID string, received int64, speedMBps float64) {
-	multiMu.Lock()
-	defer multiMu.Unlock()
+	updateItemProgress(itemID, func(item *ItemProgress) {
+		item.BytesReceived = received
+		item.SpeedMBps = speedMBps
+		if item.BytesTotal > 0 {
+			item.Progress = float64(received) / float64(item.BytesTotal)
+		}
+	})
+}
 
-	if item, ok := multiProgress.Items[itemID]; ok {
+// SetItemTransferStats records both the instantaneous and the EWMA-smoothed
+// speed and derives the ETA from the smoothed value. ETA is -1 when unknown.
+func SetItemTransferStats(itemID string, received int64, speedMBps, smoothedMBps float64) {
+	updateItemProgress(itemID, func(item *ItemProgress) {
 		item.BytesReceived = received
 		item.SpeedMBps = speedMBps
+		item.SmoothedSpeedMBps = smoothedMBps
 		if item.BytesTotal > 0 {
 			item.Progress = float64(received) / float64(item.BytesTotal)
 		}
+		item.ETASeconds = estimateETASeconds(item.BytesTotal, received, smoothedMBps)
+	})
+}
+
+// maxETASeconds bounds the ETA; a transfer slow enough to need longer
+// (or a smoothed speed that decayed towards zero) reports it as unknown.
+const maxETASeconds = 7 * 24 * 3600
+
+func estimateETASeconds(total, received int64, speedMBps float64) int64 {
+	if total <= 0 || !(speedMBps > 0) {
+		return -1
 	}
+	remaining := total - received
+	if remaining <= 0 {
+		return 0
+	}
+	eta := math.Ceil(float64(remaining) / (speedMBps * 1024 * 1024))
+	if eta > maxETASeconds {
+		return -1
+	}
+	return int64(eta)
 }
 
 func CompleteItemProgress(itemID string) {
-	multiMu.Lock()
-	defer multiMu.Unlock()
-
-	if item, ok := multiProgress.Items[itemID]; ok {
+	updateItemProgress(itemID, func(item *ItemProgress) {
 		item.Progress = 1.0
+		item.ETASeconds = 0
 		item.IsDownloading = false
 		item.Status = "completed"
-	}
+	})
 }
 
 func SetItemProgress(itemID string, progress float64, bytesReceived, bytesTotal int64) {
-	multiMu.Lock()
-	defer multiMu.Unlock()
-
-	if item, ok := multiProgress.Items[itemID]; ok {
+	updateItemProgress(itemID, func(item *ItemProgress) {
 		item.Progress = progress
 		if bytesReceived > 0 {
 			item.BytesReceived = bytesReceived
@@ -149,24 +205,31 @@ func SetItemProgress(itemID string, progress float64, bytesReceived, bytesTotal
 		if bytesTotal > 0 {
 			item.BytesTotal = bytesTotal
 		}
-	}
+	})
 }
 
-func SetItemFinalizing(itemID string) {
+func SetItemNowPlaying(itemID, title string) {
 	multiMu.Lock()
 	defer multiMu.Unlock()
 
 	if item, ok := multiProgress.Items[itemID]; ok {
+		item.NowPlaying = title
+	}
+}
+
+func SetItemFinalizing(itemID string) {
+	updateItemProgress(itemID, func(item *ItemProgress) {
 		item.Progress = 1.0
 		item.Status = "finalizing"
-	}
+	})
 }
 
 func RemoveItemProgress(itemID string) {
 	multiMu.Lock()
-	defer multiMu.Unlock()
-
 	delete(multiProgress.Items, itemID)
+	multiMu.Unlock()
+
+	clearItemStages(itemID)
 }
 
 func ClearAllItemProgress() {
@@ -176,6 +239,13 @@ func ClearAllItemProgress() {
 	multiProgress.Items = make(map[string]*ItemProgress)
 }
 
+// emitItemProgress pushes a snapshot of an item on the coalescing
+// "progress" topic, keyed by item, so a slow sink only sees each item's
+// latest state. It is encoded without holding multiMu.
+func emitItemProgress(item *ItemProgress) {
+	emitKeyedBackendEvent("progress", item.ItemID, item)
+}
+
 func setDownloadDir(path string) error {
 	downloadDirMu.Lock()
 	defer downloadDirMu.Unlock()
@@ -183,6 +253,12 @@ func setDownloadDir(path string) error {
 	return nil
 }
 
+func getDownloadDir() string {
+	downloadDirMu.RLock()
+	defer downloadDirMu.RUnlock()
+	return downloadDir
+}
+
 type ItemProgressWriter struct {
 	writer       interface{ Write([]byte) (int, error) }
 	itemID       string
@@ -191,9 +267,16 @@ type ItemProgressWriter struct {
 	startTime    time.Time
 	lastTime     time.Time
 	lastBytes    int64
+	smoothedMBps float64
 }
 
-const progressUpdateThreshold = 64 * 1024
+const (
+	progressUpdateThreshold = 64 * 1024
+
+	// speedSmoothingAlpha is the EWMA weight given to the newest sample.
+	// Lower values are steadier but react more slowly to speed changes.
+	speedSmoothingAlpha = 0.2
+)
 
 func NewItemProgressWriter(w interface{ Write([]byte) (int, error) }, itemID string) *ItemProgressWriter {
 	now := time.Now()
@@ -225,12 +308,20 @@ func (pw *ItemProgressWriter) Write(p []byte) (int, error) {
 		if elapsed > 0 {
 			bytesInInterval := pw.current - pw.lastBytes
 			speedMBps = float64(bytesInInterval) / (1024 * 1024) / elapsed
+			pw.smoothedMBps = smoothSpeed(pw.smoothedMBps, speedMBps)
 		}
 
-		SetItemBytesReceivedWithSpeed(pw.itemID, pw.current, speedMBps)
+		SetItemTransferStats(pw.itemID, pw.current, speedMBps, pw.smoothedMBps)
 		pw.lastReported = pw.current
 		pw.lastTime = now
 		pw.lastBytes = pw.current
 	}
 	return n, nil
 }
+
+func smoothSpeed(previous, sample float64) float64 {
+	if previous <= 0 {
+		return sample
+	}
+	return speedSmoothingAlpha*sample + (1-speedSmoothingAlpha)*previous
+}
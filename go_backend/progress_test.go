@@ -0,0 +1,86 @@
+package gobackend
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSmoothSpeed(t *testing.T) {
+	tests := []struct {
+		name             string
+		previous, sample float64
+		want             float64
+	}{
+		{"first sample", 0, 4, 4},
+		{"alpha 0.2", 10, 5, 9},
+		{"speeding up", 1, 6, 2},
+		{"stalled", 10, 0, 8},
+	}
+	for _, tt := range tests {
+		if got := smoothSpeed(tt.previous, tt.sample); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: smoothSpeed(%v, %v) = %v, want %v", tt.name, tt.previous, tt.sample, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateETASeconds(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name            string
+		total, received int64
+		speedMBps       float64
+		want            int64
+	}{
+		{"known total", 10 * mb, 2 * mb, 2, 4},
+		{"rounds up", 10 * mb, 0, 3, 4},
+		{"finished", 10 * mb, 10 * mb, 2, 0},
+		{"past total", 10 * mb, 11 * mb, 2, 0},
+		{"zero total", 0, 2 * mb, 2, -1},
+		{"unknown total", -1, 2 * mb, 2, -1},
+		{"stalled", 10 * mb, 2 * mb, 0, -1},
+		{"decayed towards zero", 10 * mb, 2 * mb, 1e-300, -1},
+		{"longer than a week", 1 << 40, 0, 1.0 / 1024, -1},
+		{"NaN speed", 10 * mb, 2 * mb, math.NaN(), -1},
+	}
+	for _, tt := range tests {
+		if got := estimateETASeconds(tt.total, tt.received, tt.speedMBps); got != tt.want {
+			t.Errorf("%s: estimateETASeconds(%d, %d, %v) = %d, want %d", tt.name, tt.total, tt.received, tt.speedMBps, got, tt.want)
+		}
+	}
+}
+
+func TestSetItemTransferStats(t *testing.T) {
+	const itemID = "transfer-stats"
+	const mb = 1024 * 1024
+	defer RemoveItemProgress(itemID)
+
+	tests := []struct {
+		name        string
+		total       int64
+		received    int64
+		speed       float64
+		smoothed    float64
+		wantETA     int64
+		wantPercent float64
+	}{
+		{"first sample", 8 * mb, 1 * mb, 7, 7, 1, 0.125},
+		{"smoothed speed drives the ETA", 8 * mb, 2 * mb, 1, 5.8, 2, 0.25},
+		{"stalled", 8 * mb, 2 * mb, 0, 0, -1, 0.25},
+		{"unknown size", 0, 3 * mb, 2, 2, -1, 0},
+	}
+	for _, tt := range tests {
+		StartItemProgress(itemID)
+		SetItemBytesTotal(itemID, tt.total)
+		SetItemTransferStats(itemID, tt.received, tt.speed, tt.smoothed)
+
+		multiMu.RLock()
+		item := *multiProgress.Items[itemID]
+		multiMu.RUnlock()
+		if item.ETASeconds != tt.wantETA || item.Progress != tt.wantPercent {
+			t.Errorf("%s: eta %d, progress %v; want %d, %v", tt.name, item.ETASeconds, item.Progress, tt.wantETA, tt.wantPercent)
+		}
+		if item.BytesReceived != tt.received || item.SpeedMBps != tt.speed || item.SmoothedSpeedMBps != tt.smoothed {
+			t.Errorf("%s: stored %+v", tt.name, item)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+
+	defaultHealthWindow       = 5 * time.Minute
+	defaultHealthMinSamples   = 4
+	defaultHealthFailureRatio = 0.5
+	defaultCircuitOpenTime    = 60 * time.Second
+	maxCircuitOpenTime        = 10 * time.Minute
+	halfOpenProbeTimeout      = 3 * time.Minute
+)
+
+type CircuitBreakerOptions struct {
+	Enabled          bool    `json:"enabled"`
+	WindowSeconds    int     `json:"window_seconds"`
+	MinSamples       int     `json:"min_samples"`
+	FailureRatio     float64 `json:"failure_ratio"`
+	OpenSeconds      int     `json:"open_seconds"`
+	MaxOpenSeconds   int     `json:"max_open_seconds"`
+	ProbeTimeoutSecs int     `json:"probe_timeout_seconds"`
+}
+
+func defaultCircuitBreakerOptions() CircuitBreakerOptions {
+	return CircuitBreakerOptions{
+		Enabled:          true,
+		WindowSeconds:    int(defaultHealthWindow / time.Second),
+		MinSamples:       defaultHealthMinSamples,
+		FailureRatio:     defaultHealthFailureRatio,
+		OpenSeconds:      int(defaultCircuitOpenTime / time.Second),
+		MaxOpenSeconds:   int(maxCircuitOpenTime / time.Second),
+		ProbeTimeoutSecs: int(halfOpenProbeTimeout / time.Second),
+	}
+}
+
+type providerOutcome struct {
+	at      time.Time
+	success bool
+}
+
+type providerHealth struct {
+	outcomes      []providerOutcome
+	state         string
+	openedAt      time.Time
+	openFor       time.Duration
+	probeStarted  time.Time
+	probeInFlight bool
+	trips         int
+	lastError     string
+	lastFailure   time.Time
+	lastSuccess   time.Time
+}
+
+type ProviderHealthSnapshot struct {
+	Provider      string  `json:"provider"`
+	State         string  `json:"state"`
+	Samples       int     `json:"samples"`
+	Failures      int     `json:"failures"`
+	FailureRate   float64 `json:"failure_rate"`
+	Trips         int     `json:"trips"`
+	RetryInSec    int     `json:"retry_in_seconds,omitempty"`
+	LastError     string  `json:"last_error,omitempty"`
+	LastFailureAt int64   `json:"last_failure_at,omitempty"`
+	LastSuccessAt int64   `json:"last_success_at,omitempty"`
+}
+
+// ProviderHealthTracker keeps a sliding window of download outcomes per
+// provider and trips a circuit breaker when the failure ratio spikes, so
+// fallback chains stop wasting time on a provider that is currently down.
+type ProviderHealthTracker struct {
+	mu        sync.Mutex
+	opts      CircuitBreakerOptions
+	providers map[string]*providerHealth
+	now       func() time.Time
+}
+
+var (
+	globalProviderHealth     *ProviderHealthTracker
+	globalProviderHealthOnce sync.Once
+)
+
+func GetProviderHealthTracker() *ProviderHealthTracker {
+	globalProviderHealthOnce.Do(func() {
+		globalProviderHealth = newProviderHealthTracker(defaultCircuitBreakerOptions())
+	})
+	return globalProviderHealth
+}
+
+func newProviderHealthTracker(opts CircuitBreakerOptions) *ProviderHealthTracker {
+	return &ProviderHealthTracker{
+		opts:      normalizeCircuitBreakerOptions(opts),
+		providers: make(map[string]*providerHealth),
+		now:       time.Now,
+	}
+}
+
+func normalizeCircuitBreakerOptions(opts CircuitBreakerOptions) CircuitBreakerOptions {
+	def := defaultCircuitBreakerOptions()
+	if opts.WindowSeconds <= 0 {
+		opts.WindowSeconds = def.WindowSeconds
+	}
+	if opts.MinSamples <= 0 {
+		opts.MinSamples = def.MinSamples
+	}
+	if opts.FailureRatio <= 0 || opts.FailureRatio > 1 {
+		opts.FailureRatio = def.FailureRatio
+	}
+	if opts.OpenSeconds <= 0 {
+		opts.OpenSeconds = def.OpenSeconds
+	}
+	if opts.MaxOpenSeconds < opts.OpenSeconds {
+		opts.MaxOpenSeconds = max(def.MaxOpenSeconds, opts.OpenSeconds)
+	}
+	if opts.ProbeTimeoutSecs <= 0 {
+		opts.ProbeTimeoutSecs = def.ProbeTimeoutSecs
+	}
+	return opts
+}
+
+func (t *ProviderHealthTracker) SetOptions(opts CircuitBreakerOptions) {
+	t.mu.Lock()
+	t.opts = normalizeCircuitBreakerOptions(opts)
+	t.mu.Unlock()
+	GoLog("[ProviderHealth] Options updated: enabled=%v window=%ds ratio=%.2f open=%ds\n",
+		opts.Enabled, t.opts.WindowSeconds, t.opts.FailureRatio, t.opts.OpenSeconds)
+}
+
+func (t *ProviderHealthTracker) Options() CircuitBreakerOptions {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.opts
+}
+
+func (t *ProviderHealthTracker) get(provider string) *providerHealth {
+	key := strings.ToLower(strings.TrimSpace(provider))
+	h, ok := t.providers[key]
+	if !ok {
+		h = &providerHealth{state: CircuitClosed}
+		t.providers[key] = h
+	}
+	return h
+}
+
+func (t *ProviderHealthTracker) prune(h *providerHealth, now time.Time) {
+	cutoff := now.Add(-time.Duration(t.opts.WindowSeconds) * time.Second)
+	keep := 0
+	for keep < len(h.outcomes) && h.outcomes[keep].at.Before(cutoff) {
+		keep++
+	}
+	h.outcomes = h.outcomes[keep:]
+}
+
+// Allow reports whether the provider may be tried now. An open circuit moves
+// to half-open once its cool-down elapses and admits a single probe request.
+func (t *ProviderHealthTracker) Allow(provider string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.opts.Enabled {
+		return true
+	}
+
+	h := t.get(provider)
+	now := t.now()
+
+	switch h.state {
+	case CircuitOpen:
+		if now.Sub(h.openedAt) < h.openFor {
+			return false
+		}
+		h.state = CircuitHalfOpen
+		h.probeInFlight = true
+		h.probeStarted = now
+		GoLog("[ProviderHealth] %s half-open, probing\n", provider)
+		return true
+	case CircuitHalfOpen:
+		// A probe reservation can be abandoned (e.g. an earlier provider in the
+		// chain succeeded), so stale probes are allowed to be replaced.
+		if h.probeInFlight && now.Sub(h.probeStarted) < time.Duration(t.opts.ProbeTimeoutSecs)*time.Second {
+			return false
+		}
+		h.probeInFlight = true
+		h.probeStarted = now
+		return true
+	default:
+		return true
+	}
+}
+
+// isProviderHealthError filters out errors that say nothing about the
+// provider's availability: cancellations, missing tracks and local I/O.
+func isProviderHealthError(err error) bool {
+	if err == nil || errors.Is(err, ErrDownloadCancelled) {
+		return false
+	}
+	lower := strings.ToLower(err.Error())
+	for _, marker := range []string{
+		"cancel",
+		"not found",
+		"not available",
+		"no results",
+		"permission",
+		"operation not permitted",
+		"failed to create file",
+		"failed to create directory",
+		"no space left",
+	} {
+		if strings.Contains(lower, marker) {
+			return false
+		}
+	}
+	return true
+}
+
+// RecordOutcome feeds one attempt into the provider's window. Errors that do
+// not indicate provider trouble count as the provider being reachable.
+func (t *ProviderHealthTracker) RecordOutcome(provider string, err error) {
+	if errors.Is(err, ErrDownloadCancelled) {
+		t.ReleaseProbe(provider)
+		return
+	}
+	if isProviderHealthError(err) {
+		t.recordFailure(provider, err)
+		return
+	}
+	t.recordSuccess(provider)
+}
+
+// ReleaseProbe gives back the attempt Allow admitted without recording an
+// outcome, e.g. when the provider does not carry the track. A half-open
+// circuit stays half-open and admits the next probe.
+func (t *ProviderHealthTracker) ReleaseProbe(provider string) {
+	t.mu.Lock()
+	t.get(provider).probeInFlight = false
+	t.mu.Unlock()
+}
+
+func (t *ProviderHealthTracker) recordSuccess(provider string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(provider)
+	now := t.now()
+	h.lastSuccess = now
+	h.probeInFlight = false
+
+	if h.state != CircuitClosed {
+		GoLog("[ProviderHealth] %s recovered, closing circuit\n", provider)
+		h.state = CircuitClosed
+		h.outcomes = nil
+		h.trips = 0
+	}
+	h.outcomes = append(h.outcomes, providerOutcome{at: now, success: true})
+	t.prune(h, now)
+}
+
+func (t *ProviderHealthTracker) recordFailure(provider string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	h := t.get(provider)
+	now := t.now()
+	h.lastFailure = now
+	h.lastError = err.Error()
+	h.probeInFlight = false
+	h.outcomes = append(h.outcomes, providerOutcome{at: now, success: false})
+	t.prune(h, now)
+
+	if !t.opts.Enabled {
+		return
+	}
+
+	switch h.state {
+	case CircuitHalfOpen:
+		t.trip(provider, h, now)
+	case CircuitClosed:
+		failures := 0
+		for _, o := range h.outcomes {
+			if !o.success {
+				failures++
+			}
+		}
+		if len(h.outcomes) >= t.opts.MinSamples &&
+			float64(failures)/float64(len(h.outcomes)) >= t.opts.FailureRatio {
+			t.trip(provider, h, now)
+		}
+	}
+}
+
+// trip opens the circuit, doubling the cool-down on each consecutive trip.
+func (t *ProviderHealthTracker) trip(provider string, h *providerHealth, now time.Time) {
+	openFor := time.Duration(t.opts.OpenSeconds) * time.Second
+	for i := 0; i < h.trips && openFor < time.Duration(t.opts.MaxOpenSeconds)*time.Second; i++ {
+		openFor *= 2
+	}
+	openFor = min(openFor, time.Duration(t.opts.MaxOpenSeconds)*time.Second)
+
+	h.state = CircuitOpen
+	h.openedAt = now
+	h.openFor = openFor
+	h.trips++
+	GoLog("[ProviderHealth] Circuit opened for %s (%s): %s\n", provider, openFor, h.lastError)
+}
+
+func (t *ProviderHealthTracker) Reset(provider string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if provider == "" {
+		t.providers = make(map[string]*providerHealth)
+		return
+	}
+	delete(t.providers, strings.ToLower(strings.TrimSpace(provider)))
+}
+
+func (t *ProviderHealthTracker) Snapshot() []ProviderHealthSnapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	snapshots := make([]ProviderHealthSnapshot, 0, len(t.providers))
+	for name, h := range t.providers {
+		t.prune(h, now)
+		failures := 0
+		for _, o := range h.outcomes {
+			if !o.success {
+				failures++
+			}
+		}
+		snap := ProviderHealthSnapshot{
+			Provider:  name,
+			State:     h.state,
+			Samples:   len(h.outcomes),
+			Failures:  failures,
+			Trips:     h.trips,
+			LastError: h.lastError,
+		}
+		if len(h.outcomes) > 0 {
+			snap.FailureRate = float64(failures) / float64(len(h.outcomes))
+		}
+		if h.state == CircuitOpen {
+			if remaining := h.openFor - now.Sub(h.openedAt); remaining > 0 {
+				snap.RetryInSec = int(remaining.Seconds() + 0.5)
+			}
+		}
+		if !h.lastFailure.IsZero() {
+			snap.LastFailureAt = h.lastFailure.Unix()
+		}
+		if !h.lastSuccess.IsZero() {
+			snap.LastSuccessAt = h.lastSuccess.Unix()
+		}
+		snapshots = append(snapshots, snap)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Provider < snapshots[j].Provider })
+	return snapshots
+}
+
+func GetProviderHealthJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetProviderHealthTracker().Snapshot())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// ResetProviderHealth clears the breaker for one provider, or all when empty.
+func ResetProviderHealth(providerID string) {
+	GetProviderHealthTracker().Reset(providerID)
+}
+
+func SetCircuitBreakerOptionsJSON(optionsJSON string) error {
+	opts := defaultCircuitBreakerOptions()
+	if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+		return fmt.Errorf("invalid circuit breaker options: %w", err)
+	}
+	GetProviderHealthTracker().SetOptions(opts)
+	return nil
+}
+
+func GetCircuitBreakerOptionsJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetProviderHealthTracker().Options())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
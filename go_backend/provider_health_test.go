@@ -0,0 +1,85 @@
+package gobackend
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProviderHealthTracker_TripsAndRecovers(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tracker := newProviderHealthTracker(CircuitBreakerOptions{
+		Enabled:     true,
+		MinSamples:  3,
+		OpenSeconds: 30,
+	})
+	tracker.now = func() time.Time { return now }
+
+	serverErr := errors.New("HTTP 503 from upstream")
+	for i := 0; i < 3; i++ {
+		if !tracker.Allow("tidal") {
+			t.Fatalf("attempt %d: circuit opened too early", i)
+		}
+		tracker.RecordOutcome("tidal", serverErr)
+	}
+	if tracker.Allow("tidal") {
+		t.Fatal("expected circuit to be open after repeated failures")
+	}
+
+	now = now.Add(31 * time.Second)
+	if !tracker.Allow("tidal") {
+		t.Fatal("expected one half-open probe after cool-down")
+	}
+	if tracker.Allow("tidal") {
+		t.Fatal("expected only a single concurrent probe")
+	}
+
+	// Failed probe re-opens with a longer cool-down.
+	tracker.RecordOutcome("tidal", serverErr)
+	now = now.Add(31 * time.Second)
+	if tracker.Allow("tidal") {
+		t.Fatal("expected doubled cool-down after failed probe")
+	}
+
+	now = now.Add(31 * time.Second)
+	if !tracker.Allow("tidal") {
+		t.Fatal("expected probe after doubled cool-down")
+	}
+	tracker.RecordOutcome("tidal", nil)
+
+	snap := tracker.Snapshot()
+	if len(snap) != 1 || snap[0].State != CircuitClosed {
+		t.Fatalf("expected closed circuit after successful probe, got %+v", snap)
+	}
+}
+
+func TestProviderHealthTracker_IgnoresNonProviderErrors(t *testing.T) {
+	tracker := newProviderHealthTracker(CircuitBreakerOptions{Enabled: true, MinSamples: 2})
+
+	for i := 0; i < 5; i++ {
+		tracker.RecordOutcome("qobuz", errors.New("track not found on Qobuz"))
+		tracker.RecordOutcome("qobuz", ErrDownloadCancelled)
+	}
+	if !tracker.Allow("qobuz") {
+		t.Fatal("not-found and cancellation errors must not open the circuit")
+	}
+}
+
+func TestProviderHealthTracker_ReleasedProbeStaysHalfOpen(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tracker := newProviderHealthTracker(CircuitBreakerOptions{Enabled: true, MinSamples: 1, OpenSeconds: 30})
+	tracker.now = func() time.Time { return now }
+
+	tracker.RecordOutcome("ext", errors.New("HTTP 502"))
+	now = now.Add(31 * time.Second)
+	if !tracker.Allow("ext") {
+		t.Fatal("expected a half-open probe")
+	}
+	tracker.ReleaseProbe("ext")
+	if snap := tracker.Snapshot(); snap[0].State != CircuitHalfOpen {
+		t.Fatalf("released probe changed the circuit: %+v", snap)
+	}
+	if !tracker.Allow("ext") {
+		t.Fatal("released probe must admit the next attempt")
+	}
+}
@@ -1,7 +1,6 @@
 package gobackend
 
 import (
-	"bufio"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -150,6 +149,10 @@ func qobuzTitlesMatch(expectedTitle, foundTitle string) bool {
 		return true
 	}
 
+	if versionGuardRejects(expectedTitle, foundTitle, GetBackendConfig().StrictVersionMatch) {
+		return false
+	}
+
 	if strings.Contains(normExpected, normFound) || strings.Contains(normFound, normExpected) {
 		return true
 	}
@@ -1014,6 +1017,13 @@ func (q *QobuzDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 		return ErrDownloadCancelled
 	}
 
+	if handled, err := tryDownloadSegmented(ctx, q.client, downloadURL, outputPath, outputFD, itemID); handled {
+		if err != nil && isDownloadCancelled(itemID) {
+			return ErrDownloadCancelled
+		}
+		return err
+	}
+
 	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -1041,8 +1051,15 @@ func (q *QobuzDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 	if err != nil {
 		return err
 	}
+	if err := preallocateOutput(out, expectedSize); err != nil {
+		out.Close()
+		cleanupOutputOnError(outputPath, outputFD)
+		return err
+	}
 
-	bufWriter := bufio.NewWriterSize(out, 256*1024)
+	mirror := openOutputMirror(itemID)
+	bufWriter := acquireCopyWriter(hashedOutput(mirror.tee(out), itemID))
+	defer releaseCopyWriter(bufWriter)
 
 	var written int64
 	if itemID != "" {
@@ -1053,7 +1070,8 @@ func (q *QobuzDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 	}
 
 	flushErr := bufWriter.Flush()
-	closeErr := out.Close()
+	closeErr := closeOutput(out)
+	mirror.close()
 
 	if err != nil {
 		cleanupOutputOnError(outputPath, outputFD)
@@ -1075,6 +1093,7 @@ func (q *QobuzDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 		cleanupOutputOnError(outputPath, outputFD)
 		return fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
 	}
+	sealDownloadHash(itemID, outputPath, outputFD)
 
 	return nil
 }
@@ -1091,6 +1110,7 @@ type QobuzDownloadResult struct {
 	DiscNumber  int
 	ISRC        string
 	LyricsLRC   string
+	LyricsTags  map[string]string
 }
 
 func resolveQobuzTrackForRequest(req DownloadRequest, downloader *QobuzDownloader, logPrefix string) (*QobuzTrack, error) {
@@ -1162,13 +1182,13 @@ func resolveQobuzTrackForRequest(req DownloadRequest, downloader *QobuzDownloade
 		GoLog("[%s] Trying ISRC search: %s\n", logPrefix, req.ISRC)
 		track, err = downloader.SearchTrackByISRCWithDuration(req.ISRC, expectedDurationSec)
 		if track != nil {
-			if !qobuzArtistsMatch(req.ArtistName, track.Performer.Name) {
+			if !qobuzArtistsMatch(req.matchArtist(), track.Performer.Name) {
 				GoLog("[%s] Artist mismatch from ISRC search: expected '%s', got '%s'. Rejecting.\n",
-					logPrefix, req.ArtistName, track.Performer.Name)
+					logPrefix, req.matchArtist(), track.Performer.Name)
 				track = nil
-			} else if !qobuzTitlesMatch(req.TrackName, track.Title) {
+			} else if !qobuzTitlesMatch(req.matchTitle(), track.Title) {
 				GoLog("[%s] Title mismatch from ISRC search: expected '%s', got '%s'. Rejecting.\n",
-					logPrefix, req.TrackName, track.Title)
+					logPrefix, req.matchTitle(), track.Title)
 				track = nil
 			}
 		}
@@ -1176,11 +1196,11 @@ func resolveQobuzTrackForRequest(req DownloadRequest, downloader *QobuzDownloade
 
 	// Strategy 5: Metadata search with strict matching (duration tolerance: 10 seconds)
 	if track == nil {
-		GoLog("[%s] Trying metadata search: '%s' by '%s'\n", logPrefix, req.TrackName, req.ArtistName)
-		track, err = downloader.SearchTrackByMetadataWithDuration(req.TrackName, req.ArtistName, expectedDurationSec)
-		if track != nil && !qobuzArtistsMatch(req.ArtistName, track.Performer.Name) {
+		GoLog("[%s] Trying metadata search: '%s' by '%s'\n", logPrefix, req.matchTitle(), req.matchArtist())
+		track, err = downloader.SearchTrackByMetadataWithDuration(req.matchTitle(), req.matchArtist(), expectedDurationSec)
+		if track != nil && !qobuzArtistsMatch(req.matchArtist(), track.Performer.Name) {
 			GoLog("[%s] Artist mismatch from metadata search: expected '%s', got '%s'. Rejecting.\n",
-				logPrefix, req.ArtistName, track.Performer.Name)
+				logPrefix, req.matchArtist(), track.Performer.Name)
 			track = nil
 		}
 	}
@@ -1211,19 +1231,23 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 		}
 	}
 
+	match := startTraceSpan(req.ItemID, TraceSpanMatch, map[string]interface{}{"provider": "qobuz"})
 	track, err := resolveQobuzTrackForRequest(req, downloader, "Qobuz")
+	match.End(err)
 	if err != nil {
 		return QobuzDownloadResult{}, err
 	}
 
 	filename := buildFilenameFromTemplate(req.FilenameFormat, map[string]interface{}{
-		"title":  req.TrackName,
-		"artist": req.ArtistName,
-		"album":  req.AlbumName,
-		"track":  req.TrackNumber,
-		"year":   extractYear(req.ReleaseDate),
-		"date":   req.ReleaseDate,
-		"disc":   req.DiscNumber,
+		"title":        req.TrackName,
+		"artist":       req.ArtistName,
+		"album":        req.AlbumName,
+		"album_artist": req.AlbumArtist,
+		"track":        req.TrackNumber,
+		"year":         extractYear(req.ReleaseDate),
+		"date":         req.ReleaseDate,
+		"disc":         req.DiscNumber,
+		"disc_total":   req.TotalDiscs,
 	})
 	var outputPath string
 	if isSafOutput {
@@ -1254,46 +1278,13 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 	actualSampleRate := int(track.MaximumSamplingRate * 1000)
 	GoLog("[Qobuz] Actual quality: %d-bit/%.1fkHz\n", actualBitDepth, track.MaximumSamplingRate)
 
+	streamURL := startTraceSpan(req.ItemID, TraceSpanStreamURL, map[string]interface{}{"provider": "qobuz", "quality": qobuzQuality})
 	downloadURL, err := downloader.GetDownloadURL(track.ID, qobuzQuality)
+	streamURL.End(err)
 	if err != nil {
 		return QobuzDownloadResult{}, fmt.Errorf("failed to get download URL: %w", err)
 	}
 
-	var parallelResult *ParallelDownloadResult
-	parallelDone := make(chan struct{})
-	go func() {
-		defer close(parallelDone)
-		coverURL := req.CoverURL
-		embedLyrics := req.EmbedLyrics
-		if !req.EmbedMetadata {
-			coverURL = ""
-			embedLyrics = false
-		}
-		parallelResult = FetchCoverAndLyricsParallel(
-			coverURL,
-			req.EmbedMaxQualityCover,
-			req.SpotifyID,
-			req.TrackName,
-			req.ArtistName,
-			embedLyrics,
-			int64(req.DurationMS),
-		)
-	}()
-
-	if err := downloader.DownloadFile(downloadURL, outputPath, req.OutputFD, req.ItemID); err != nil {
-		if errors.Is(err, ErrDownloadCancelled) {
-			return QobuzDownloadResult{}, ErrDownloadCancelled
-		}
-		return QobuzDownloadResult{}, fmt.Errorf("download failed: %w", err)
-	}
-
-	<-parallelDone
-
-	if req.ItemID != "" {
-		SetItemProgress(req.ItemID, 1.0, 0, 0)
-		SetItemFinalizing(req.ItemID)
-	}
-
 	albumName := track.Album.Title
 	if req.AlbumName != "" {
 		albumName = req.AlbumName
@@ -1313,17 +1304,28 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 		TrackNumber: actualTrackNumber,
 		TotalTracks: req.TotalTracks,
 		DiscNumber:  req.DiscNumber,
+		TotalDiscs:  req.TotalDiscs,
+		Compilation: req.Compilation,
 		ISRC:        track.ISRC,
 		Genre:       req.Genre,
 		Label:       req.Label,
 		Copyright:   req.Copyright,
+		Chapters:    req.Chapters,
 	}
 
-	var coverData []byte
-	if parallelResult != nil && parallelResult.CoverData != nil {
-		coverData = parallelResult.CoverData
-		GoLog("[Qobuz] Using parallel-fetched cover (%d bytes)\n", len(coverData))
-	}
+	pipeline := newTrackPipeline(req, true, func() error {
+		if err := downloader.DownloadFile(downloadURL, outputPath, req.OutputFD, req.ItemID); err != nil {
+			if errors.Is(err, ErrDownloadCancelled) {
+				return ErrDownloadCancelled
+			}
+			return fmt.Errorf("download failed: %w", err)
+		}
+		if req.ItemID != "" {
+			SetItemProgress(req.ItemID, 1.0, 0, 0)
+			SetItemFinalizing(req.ItemID)
+		}
+		return nil
+	})
 
 	if isSafOutput || !req.EmbedMetadata {
 		if !req.EmbedMetadata {
@@ -1332,36 +1334,24 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 			GoLog("[Qobuz] SAF output detected - skipping in-backend metadata/lyrics embedding (handled in Flutter)\n")
 		}
 	} else {
-		if err := EmbedMetadataWithCoverData(outputPath, metadata, coverData); err != nil {
-			fmt.Printf("Warning: failed to embed metadata: %v\n", err)
-		}
-
-		if req.EmbedLyrics && parallelResult != nil && parallelResult.LyricsLRC != "" {
-			lyricsMode := req.LyricsMode
-			if lyricsMode == "" {
-				lyricsMode = "embed"
+		pipeline.Tag(func(assets *ParallelDownloadResult) error {
+			if assets.CoverData != nil {
+				GoLog("[Qobuz] Using parallel-fetched cover (%d bytes)\n", len(assets.CoverData))
 			}
-
-			if lyricsMode == "external" || lyricsMode == "both" {
-				GoLog("[Qobuz] Saving external LRC file...\n")
-				if lrcPath, lrcErr := SaveLRCFile(outputPath, parallelResult.LyricsLRC); lrcErr != nil {
-					GoLog("[Qobuz] Warning: failed to save LRC file: %v\n", lrcErr)
-				} else {
-					GoLog("[Qobuz] LRC file saved: %s\n", lrcPath)
-				}
+			if err := EmbedMetadataWithCoverData(outputPath, metadata, assets.CoverData); err != nil {
+				GoLog("[Qobuz] Warning: failed to embed metadata: %v\n", err)
+				return err
 			}
+			return nil
+		})
+		pipeline.WriteLyrics(func(lrc string, lyrics *LyricsResponse) error {
+			return writeLyricsOutputs("Qobuz", outputPath, lrc, lyrics, req.LyricsMode, true, true)
+		})
+	}
 
-			if lyricsMode == "embed" || lyricsMode == "both" {
-				GoLog("[Qobuz] Embedding parallel-fetched lyrics (%d lines)...\n", len(parallelResult.LyricsData.Lines))
-				if embedErr := EmbedLyrics(outputPath, parallelResult.LyricsLRC); embedErr != nil {
-					GoLog("[Qobuz] Warning: failed to embed lyrics: %v\n", embedErr)
-				} else {
-					fmt.Println("[Qobuz] Lyrics embedded successfully")
-				}
-			}
-		} else if req.EmbedLyrics {
-			fmt.Println("[Qobuz] No lyrics available from parallel fetch")
-		}
+	parallelResult, err := pipeline.Run()
+	if err != nil {
+		return QobuzDownloadResult{}, err
 	}
 
 	if !isSafOutput {
@@ -1369,8 +1359,10 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 	}
 
 	lyricsLRC := ""
+	var lyricsTags map[string]string
 	if req.EmbedMetadata && req.EmbedLyrics && parallelResult != nil && parallelResult.LyricsLRC != "" {
 		lyricsLRC = parallelResult.LyricsLRC
+		lyricsTags = parallelResult.LyricsTags
 	}
 
 	return QobuzDownloadResult{
@@ -1385,5 +1377,6 @@ func downloadFromQobuz(req DownloadRequest) (QobuzDownloadResult, error) {
 		DiscNumber:  req.DiscNumber,
 		ISRC:        track.ISRC,
 		LyricsLRC:   lyricsLRC,
+		LyricsTags:  lyricsTags,
 	}, nil
 }
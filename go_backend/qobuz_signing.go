@@ -0,0 +1,295 @@
+package gobackend
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Qobuz request signing ====================
+//
+// Qobuz signs "protected" calls (track/getFileUrl, userLibrary/...) with
+// request_sig = md5(object + method + sorted key/value pairs + request_ts +
+// app secret). The app id and the secrets are shipped in the web player's
+// bundle.js: the secret is assembled from a seed, an info and an extras
+// string per time zone. discoverQobuzCredentials scrapes them and, given a
+// user token, orders the secrets by which one Qobuz actually accepts.
+
+const (
+	qobuzCredentialsTTL   = 24 * time.Hour
+	qobuzDiscoveryTimeout = 20 * time.Second
+	// Any streamable track works for checking a secret.
+	qobuzSecretProbeTrackID = "5966783"
+)
+
+// Overridden in tests.
+var (
+	qobuzWebPlayerURL = "https://play.qobuz.com"
+	qobuzSignedAPIURL = "https://www.qobuz.com/api.json/0.2"
+)
+
+var (
+	qobuzBundleScriptRe = regexp.MustCompile(`<script src="(/resources/\d+\.\d+\.\d+-[a-z]\d{3}/bundle\.js)"></script>`)
+	qobuzBundleAppIDRe  = regexp.MustCompile(`production:\{api:\{appId:"(\d{9})",appSecret:"(\w{32})"`)
+	qobuzBundleSeedRe   = regexp.MustCompile(`[a-z]\.initialSeed\("([\w=]+)",window\.utimezone\.([a-z]+)\)`)
+)
+
+// QobuzAppCredentials are the web player's app id and candidate secrets,
+// the likeliest first.
+type QobuzAppCredentials struct {
+	AppID     string   `json:"app_id"`
+	Secrets   []string `json:"secrets"`
+	Validated bool     `json:"validated"`
+	FetchedAt int64    `json:"fetched_at"`
+}
+
+type QobuzSignedRequest struct {
+	AppID     string            `json:"app_id"`
+	Timestamp string            `json:"timestamp"`
+	Signature string            `json:"signature"`
+	Params    map[string]string `json:"params"`
+	Query     string            `json:"query"`
+	URL       string            `json:"url"`
+}
+
+var (
+	qobuzCredentialsMu    sync.Mutex
+	qobuzCredentialsCache *QobuzAppCredentials
+)
+
+// qobuzUnsignedParams are sent with the request but not signed.
+var qobuzUnsignedParams = map[string]bool{
+	"app_id":          true,
+	"user_auth_token": true,
+	"request_ts":      true,
+	"request_sig":     true,
+}
+
+// qobuzRequestSignature computes request_sig for endpoint ("track/getFileUrl").
+func qobuzRequestSignature(endpoint string, params map[string]string, timestamp, secret string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if !qobuzUnsignedParams[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(strings.ReplaceAll(strings.Trim(endpoint, "/"), "/", ""))
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteString(params[key])
+	}
+	b.WriteString(timestamp)
+	b.WriteString(secret)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// SignQobuzRequest returns params with app_id, request_ts and request_sig
+// added, plus the ready query string and URL. timestamp defaults to now.
+func SignQobuzRequest(endpoint string, params map[string]string, appID, secret, timestamp string) (*QobuzSignedRequest, error) {
+	endpoint = strings.Trim(strings.TrimSpace(endpoint), "/")
+	if endpoint == "" || !strings.Contains(endpoint, "/") {
+		return nil, fmt.Errorf("endpoint must look like object/method, got %q", endpoint)
+	}
+	if appID == "" || secret == "" {
+		return nil, fmt.Errorf("app id and secret are required")
+	}
+	if timestamp == "" {
+		timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	}
+
+	signed := make(map[string]string, len(params)+3)
+	for key, value := range params {
+		signed[key] = value
+	}
+	signature := qobuzRequestSignature(endpoint, params, timestamp, secret)
+	signed["app_id"] = appID
+	signed["request_ts"] = timestamp
+	signed["request_sig"] = signature
+
+	query := url.Values{}
+	for key, value := range signed {
+		query.Set(key, value)
+	}
+	encoded := query.Encode()
+	return &QobuzSignedRequest{
+		AppID:     appID,
+		Timestamp: timestamp,
+		Signature: signature,
+		Params:    signed,
+		Query:     encoded,
+		URL:       qobuzSignedAPIURL + "/" + endpoint + "?" + encoded,
+	}, nil
+}
+
+func fetchQobuzText(client *http.Client, target string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", getRandomUserAgent())
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned HTTP %d", target, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	return string(data), err
+}
+
+// parseQobuzBundle extracts the app id and the secrets in seed order.
+func parseQobuzBundle(bundle string) (*QobuzAppCredentials, error) {
+	app := qobuzBundleAppIDRe.FindStringSubmatch(bundle)
+	if app == nil {
+		return nil, fmt.Errorf("app id not found in Qobuz bundle")
+	}
+
+	var secrets []string
+	for _, seed := range qobuzBundleSeedRe.FindAllStringSubmatch(bundle, -1) {
+		zone := seed[2]
+		zoneRe, err := regexp.Compile(`name:"\w+/(` + strings.ToUpper(zone[:1]) + zone[1:] + `)",info:"([\w=]+)",extras:"([\w=]+)"`)
+		if err != nil {
+			continue
+		}
+		parts := zoneRe.FindStringSubmatch(bundle)
+		if parts == nil {
+			continue
+		}
+		joined := seed[1] + parts[2] + parts[3]
+		if len(joined) <= 44 {
+			continue
+		}
+		// The last 44 characters are padding.
+		decoded, err := base64.StdEncoding.DecodeString(joined[:len(joined)-44])
+		if err != nil || len(decoded) == 0 {
+			continue
+		}
+		secrets = append(secrets, string(decoded))
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no app secrets found in Qobuz bundle")
+	}
+	// The bundle has consistently listed the working seed second.
+	if len(secrets) > 1 {
+		secrets[0], secrets[1] = secrets[1], secrets[0]
+	}
+	return &QobuzAppCredentials{AppID: app[1], Secrets: secrets}, nil
+}
+
+// qobuzSecretWorks asks Qobuz for a file URL signed with secret. Only a 200
+// proves the secret; a bad signature is answered with 400, and any other
+// status (a rejected user token, a server error) says nothing about the
+// secret and is returned as an error.
+func qobuzSecretWorks(client *http.Client, appID, secret, userToken string) (bool, error) {
+	signed, err := SignQobuzRequest("track/getFileUrl", map[string]string{
+		"track_id":  qobuzSecretProbeTrackID,
+		"format_id": "5",
+		"intent":    "stream",
+	}, appID, secret, "")
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest(http.MethodGet, signed.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("X-App-Id", appID)
+	req.Header.Set("X-User-Auth-Token", userToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusBadRequest:
+		return false, nil
+	}
+	return false, fmt.Errorf("qobuz secret check returned status %d", resp.StatusCode)
+}
+
+// discoverQobuzCredentials returns the cached credentials or scrapes new
+// ones. With userToken the secrets are checked and the first accepted one
+// is moved to the front.
+func discoverQobuzCredentials(refresh bool, userToken string) (*QobuzAppCredentials, error) {
+	qobuzCredentialsMu.Lock()
+	defer qobuzCredentialsMu.Unlock()
+
+	cached := qobuzCredentialsCache
+	stale := cached == nil || time.Since(time.Unix(cached.FetchedAt, 0)) > qobuzCredentialsTTL
+	if !refresh && !stale && (userToken == "" || cached.Validated) {
+		return cached.copy(), nil
+	}
+
+	client := NewHTTPClientWithTimeout(qobuzDiscoveryTimeout)
+	creds := cached
+	if refresh || stale {
+		login, err := fetchQobuzText(client, qobuzWebPlayerURL+"/login")
+		if err != nil {
+			return nil, err
+		}
+		script := qobuzBundleScriptRe.FindStringSubmatch(login)
+		if script == nil {
+			return nil, fmt.Errorf("bundle.js not found on the Qobuz login page")
+		}
+		bundle, err := fetchQobuzText(client, qobuzWebPlayerURL+script[1])
+		if err != nil {
+			return nil, err
+		}
+		if creds, err = parseQobuzBundle(bundle); err != nil {
+			return nil, err
+		}
+		creds.FetchedAt = time.Now().Unix()
+		GoLog("[Qobuz] Discovered app id %s with %d secret(s)\n", creds.AppID, len(creds.Secrets))
+	} else {
+		creds = cached.copy()
+	}
+
+	if userToken != "" && !creds.Validated {
+		for i, secret := range creds.Secrets {
+			ok, err := qobuzSecretWorks(client, creds.AppID, secret, userToken)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				creds.Secrets[0], creds.Secrets[i] = creds.Secrets[i], creds.Secrets[0]
+				creds.Validated = true
+				break
+			}
+		}
+		if !creds.Validated {
+			return nil, fmt.Errorf("Qobuz accepted none of the %d discovered secrets", len(creds.Secrets))
+		}
+	}
+
+	qobuzCredentialsCache = creds
+	return creds.copy(), nil
+}
+
+func (c *QobuzAppCredentials) copy() *QobuzAppCredentials {
+	out := *c
+	out.Secrets = append([]string(nil), c.Secrets...)
+	return &out
+}
+
+// GetQobuzAppCredentials exposes discovery to the app.
+func GetQobuzAppCredentials(refresh bool, userToken string) (*QobuzAppCredentials, error) {
+	return discoverQobuzCredentials(refresh, strings.TrimSpace(userToken))
+}
@@ -0,0 +1,130 @@
+package gobackend
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+)
+
+func TestQobuzRequestSignature(t *testing.T) {
+	params := map[string]string{"track_id": "123", "format_id": "27", "intent": "stream", "user_auth_token": "ignored"}
+	sum := md5.Sum([]byte("trackgetFileUrlformat_id27intentstreamtrack_id1231700000000s3cret"))
+	want := hex.EncodeToString(sum[:])
+	if got := qobuzRequestSignature("/track/getFileUrl", params, "1700000000", "s3cret"); got != want {
+		t.Fatalf("signature = %s, want %s", got, want)
+	}
+
+	signed, err := SignQobuzRequest("track/getFileUrl", params, "123456789", "s3cret", "1700000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Params["request_sig"] != want || signed.Params["app_id"] != "123456789" || !strings.Contains(signed.URL, "/track/getFileUrl?") {
+		t.Fatalf("unexpected signed request: %+v", signed)
+	}
+	if _, err := SignQobuzRequest("getFileUrl", nil, "1", "s", ""); err == nil {
+		t.Fatal("endpoint without object accepted")
+	}
+}
+
+func TestQobuzCredentialDiscovery(t *testing.T) {
+	// Secrets are base64(seed+info+extras) with 44 characters of padding.
+	zoneSecret := func(zone, secret string) (string, string) {
+		encoded := base64.StdEncoding.EncodeToString([]byte(secret))
+		seed, info := encoded[:8], encoded[8:]
+		entry := fmt.Sprintf(`name:"Europe/%s",info:"%s",extras:"%s"`, strings.ToUpper(zone[:1])+zone[1:], info, strings.Repeat("x", 44))
+		return fmt.Sprintf(`a.initialSeed("%s",window.utimezone.%s)`, seed, zone), entry
+	}
+	seed1, zone1 := zoneSecret("berlin", "first-secret-000000000000000000")
+	seed2, zone2 := zoneSecret("london", "second-secret-00000000000000000")
+	bundle := `production:{api:{appId:"950096963",appSecret:"0123456789abcdef0123456789abcdef"` +
+		seed1 + ";" + seed2 + ";" + zone1 + "," + zone2
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Write([]byte(`<script src="/resources/7.1.2-b011/bundle.js"></script>`))
+		case "/resources/7.1.2-b011/bundle.js":
+			w.Write([]byte(bundle))
+		case "/track/getFileUrl":
+			q := r.URL.Query()
+			params := map[string]string{"track_id": q.Get("track_id"), "format_id": q.Get("format_id"), "intent": q.Get("intent")}
+			if q.Get("request_sig") != qobuzRequestSignature("track/getFileUrl", params, q.Get("request_ts"), "first-secret-000000000000000000") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"url":"https://example.test/a.flac"}`))
+		}
+	}))
+	defer server.Close()
+
+	prevPlayer, prevAPI := qobuzWebPlayerURL, qobuzSignedAPIURL
+	qobuzWebPlayerURL, qobuzSignedAPIURL = server.URL, server.URL
+	defer func() {
+		qobuzWebPlayerURL, qobuzSignedAPIURL = prevPlayer, prevAPI
+		qobuzCredentialsMu.Lock()
+		qobuzCredentialsCache = nil
+		qobuzCredentialsMu.Unlock()
+	}()
+
+	creds, err := GetQobuzAppCredentials(true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AppID != "950096963" || len(creds.Secrets) != 2 || creds.Secrets[0] != "second-secret-00000000000000000" {
+		t.Fatalf("unexpected credentials: %+v", creds)
+	}
+	if creds, err = GetQobuzAppCredentials(false, "user-token"); err != nil {
+		t.Fatal(err)
+	}
+	if !creds.Validated || creds.Secrets[0] != "first-secret-000000000000000000" {
+		t.Fatalf("working secret not moved first: %+v", creds)
+	}
+
+	vm := goja.New()
+	NewExtensionRuntime(&LoadedExtension{ID: "qobuz-test", Manifest: &ExtensionManifest{Name: "qobuz-test"}, DataDir: t.TempDir()}).RegisterAPIs(vm)
+	v, err := vm.RunString(`var s = qobuz.signRequest({endpoint: "track/getFileUrl", params: {track_id: 5966783, format_id: 27, intent: "stream"}, timestamp: "1700000000"});
+s.success && s.appId + ":" + s.params.request_ts + ":" + s.signature`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "950096963:1700000000:" + qobuzRequestSignature("track/getFileUrl",
+		map[string]string{"track_id": "5966783", "format_id": "27", "intent": "stream"}, "1700000000", "first-secret-000000000000000000")
+	if v.String() != want {
+		t.Fatalf("signRequest = %q, want %q", v.String(), want)
+	}
+}
+
+func TestQobuzSecretWorksNeedsSuccess(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	prevAPI := qobuzSignedAPIURL
+	qobuzSignedAPIURL = server.URL
+	defer func() { qobuzSignedAPIURL = prevAPI }()
+
+	for _, tc := range []struct {
+		status  int
+		ok      bool
+		wantErr bool
+	}{
+		{http.StatusOK, true, false},
+		{http.StatusBadRequest, false, false},
+		{http.StatusUnauthorized, false, true},
+		{http.StatusBadGateway, false, true},
+	} {
+		status = tc.status
+		ok, err := qobuzSecretWorks(server.Client(), "950096963", "secret", "user-token")
+		if ok != tc.ok || (err != nil) != tc.wantErr {
+			t.Errorf("status %d: ok = %v, err = %v", tc.status, ok, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ==================== Queued item metadata edits ====================
+//
+// The queue UI lets users fix a track's title, artist, numbering etc. before
+// it downloads. Edits are kept per item ID and applied to the DownloadRequest
+// when the item starts, so filename templating and tagging use them instead
+// of the values the provider or an extension reported. Provider searches
+// and match checks keep using the reported names (matchTitle, matchArtist,
+// matchAlbum), so an edit never changes which track is downloaded. A patch
+// is dropped once its item downloads successfully and kept across failed
+// attempts.
+
+// QueuedMetadataPatch holds the fields a user changed; nil means untouched.
+type QueuedMetadataPatch struct {
+	Title       *string `json:"title,omitempty"`
+	Artist      *string `json:"artist,omitempty"`
+	Album       *string `json:"album,omitempty"`
+	AlbumArtist *string `json:"album_artist,omitempty"`
+	ReleaseDate *string `json:"release_date,omitempty"`
+	Genre       *string `json:"genre,omitempty"`
+	TrackNumber *int    `json:"track_number,omitempty"`
+	DiscNumber  *int    `json:"disc_number,omitempty"`
+	TotalTracks *int    `json:"total_tracks,omitempty"`
+}
+
+var (
+	queuedMetadataMu sync.Mutex
+	queuedMetadata   = make(map[string]*QueuedMetadataPatch)
+)
+
+func (p *QueuedMetadataPatch) validate() error {
+	for name, value := range map[string]*int{
+		"track_number": p.TrackNumber,
+		"disc_number":  p.DiscNumber,
+		"total_tracks": p.TotalTracks,
+	} {
+		if value != nil && *value < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	if p.Title != nil && strings.TrimSpace(*p.Title) == "" {
+		return fmt.Errorf("title must not be empty")
+	}
+	if p.Artist != nil && strings.TrimSpace(*p.Artist) == "" {
+		return fmt.Errorf("artist must not be empty")
+	}
+	return nil
+}
+
+// merge copies the fields set in other over p.
+func (p *QueuedMetadataPatch) merge(other *QueuedMetadataPatch) {
+	mergeString := func(dst **string, src *string) {
+		if src != nil {
+			trimmed := strings.TrimSpace(*src)
+			*dst = &trimmed
+		}
+	}
+	mergeString(&p.Title, other.Title)
+	mergeString(&p.Artist, other.Artist)
+	mergeString(&p.Album, other.Album)
+	mergeString(&p.AlbumArtist, other.AlbumArtist)
+	mergeString(&p.ReleaseDate, other.ReleaseDate)
+	mergeString(&p.Genre, other.Genre)
+	if other.TrackNumber != nil {
+		p.TrackNumber = other.TrackNumber
+	}
+	if other.DiscNumber != nil {
+		p.DiscNumber = other.DiscNumber
+	}
+	if other.TotalTracks != nil {
+		p.TotalTracks = other.TotalTracks
+	}
+}
+
+func (p *QueuedMetadataPatch) applyToRequest(req *DownloadRequest) {
+	// A name that differs from the edit came from the provider (at entry, or
+	// rewritten by enrichment since); remember it for matching.
+	if p.Title != nil && req.TrackName != *p.Title {
+		req.matchTrackName = strings.TrimSpace(req.TrackName)
+	}
+	if p.Artist != nil && req.ArtistName != *p.Artist {
+		req.matchArtistName = strings.TrimSpace(req.ArtistName)
+	}
+	if p.Album != nil && req.AlbumName != *p.Album {
+		req.matchAlbumName = strings.TrimSpace(req.AlbumName)
+	}
+	if p.Title != nil {
+		req.TrackName = *p.Title
+	}
+	if p.Artist != nil {
+		req.ArtistName = *p.Artist
+	}
+	if p.Album != nil {
+		req.AlbumName = *p.Album
+	}
+	if p.AlbumArtist != nil {
+		req.AlbumArtist = *p.AlbumArtist
+	}
+	if p.ReleaseDate != nil {
+		req.ReleaseDate = *p.ReleaseDate
+	}
+	if p.Genre != nil {
+		req.Genre = *p.Genre
+	}
+	if p.TrackNumber != nil {
+		req.TrackNumber = *p.TrackNumber
+	}
+	if p.DiscNumber != nil {
+		req.DiscNumber = *p.DiscNumber
+	}
+	if p.TotalTracks != nil {
+		req.TotalTracks = *p.TotalTracks
+	}
+}
+
+func (p *QueuedMetadataPatch) applyToResponse(resp *DownloadResponse) {
+	if p.Title != nil {
+		resp.Title = *p.Title
+	}
+	if p.Artist != nil {
+		resp.Artist = *p.Artist
+	}
+	if p.Album != nil {
+		resp.Album = *p.Album
+	}
+	if p.AlbumArtist != nil {
+		resp.AlbumArtist = *p.AlbumArtist
+	}
+	if p.ReleaseDate != nil {
+		resp.ReleaseDate = *p.ReleaseDate
+	}
+	if p.Genre != nil {
+		resp.Genre = *p.Genre
+	}
+	if p.TrackNumber != nil {
+		resp.TrackNumber = *p.TrackNumber
+	}
+	if p.DiscNumber != nil {
+		resp.DiscNumber = *p.DiscNumber
+	}
+}
+
+// matchTitle, matchArtist and matchAlbum are the names provider searches
+// and match checks use: the reported ones when the user edited them.
+func (r *DownloadRequest) matchTitle() string {
+	return firstNonEmpty(r.matchTrackName, r.TrackName)
+}
+
+func (r *DownloadRequest) matchArtist() string {
+	return firstNonEmpty(r.matchArtistName, r.ArtistName)
+}
+
+func (r *DownloadRequest) matchAlbum() string {
+	return firstNonEmpty(r.matchAlbumName, r.AlbumName)
+}
+
+func getQueuedMetadataPatch(itemID string) *QueuedMetadataPatch {
+	if itemID == "" {
+		return nil
+	}
+	queuedMetadataMu.Lock()
+	defer queuedMetadataMu.Unlock()
+	if patch, ok := queuedMetadata[itemID]; ok {
+		copied := *patch
+		return &copied
+	}
+	return nil
+}
+
+// applyQueuedMetadataPatch overwrites req with the user's edits for its item.
+// Download entry points call it right after decoding the request; the
+// extension path calls it again after enrichment, which rewrites names.
+func applyQueuedMetadataPatch(req *DownloadRequest) {
+	if patch := getQueuedMetadataPatch(req.ItemID); patch != nil {
+		patch.applyToRequest(req)
+		GoLog("[Queue] Applied metadata edits for %s\n", req.ItemID)
+	}
+}
+
+// finishQueuedMetadata reports the edited values in a successful download
+// response and drops the item's patch. Failed responses keep the patch so a
+// retry still uses the edits.
+func finishQueuedMetadata(itemID, respJSON string) string {
+	patch := getQueuedMetadataPatch(itemID)
+	if patch == nil {
+		return respJSON
+	}
+	var resp DownloadResponse
+	if err := json.Unmarshal([]byte(respJSON), &resp); err != nil || !resp.Success {
+		return respJSON
+	}
+	ClearQueuedItemMetadata(itemID)
+	patch.applyToResponse(&resp)
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		return respJSON
+	}
+	return string(jsonBytes)
+}
+
+// UpdateQueuedItemMetadata merges patchJSON into the item's pending edits and
+// returns the merged patch. Only the keys present in patchJSON change.
+func UpdateQueuedItemMetadata(itemID, patchJSON string) (string, error) {
+	itemID = strings.TrimSpace(itemID)
+	if itemID == "" {
+		return "", fmt.Errorf("item id is required")
+	}
+	var patch QueuedMetadataPatch
+	if err := json.Unmarshal([]byte(patchJSON), &patch); err != nil {
+		return "", fmt.Errorf("invalid patch: %w", err)
+	}
+	if err := patch.validate(); err != nil {
+		return "", err
+	}
+
+	queuedMetadataMu.Lock()
+	merged, ok := queuedMetadata[itemID]
+	if !ok {
+		merged = &QueuedMetadataPatch{}
+		queuedMetadata[itemID] = merged
+	}
+	merged.merge(&patch)
+	jsonBytes, err := json.Marshal(merged)
+	queuedMetadataMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// GetQueuedItemMetadata returns the pending edits for itemID, or "{}".
+func GetQueuedItemMetadata(itemID string) (string, error) {
+	patch := getQueuedMetadataPatch(itemID)
+	if patch == nil {
+		patch = &QueuedMetadataPatch{}
+	}
+	jsonBytes, err := json.Marshal(patch)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func ClearQueuedItemMetadata(itemID string) {
+	queuedMetadataMu.Lock()
+	delete(queuedMetadata, itemID)
+	queuedMetadataMu.Unlock()
+}
@@ -0,0 +1,93 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestQueuedMetadataPatchAppliesToRequest(t *testing.T) {
+	defer ClearQueuedItemMetadata("item-1")
+
+	if _, err := UpdateQueuedItemMetadata("item-1", `{"title": " Fixed Title ", "track_number": 4}`); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := UpdateQueuedItemMetadata("item-1", `{"artist": "Right Artist"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(merged, `"title":"Fixed Title"`) || !strings.Contains(merged, `"artist":"Right Artist"`) {
+		t.Fatalf("expected patches to merge, got %s", merged)
+	}
+
+	req := DownloadRequest{
+		ItemID:         "item-1",
+		TrackName:      "Wrong Title",
+		ArtistName:     "Wrong Artist",
+		AlbumName:      "Album",
+		TrackNumber:    1,
+		OutputDir:      "/music",
+		OutputExt:      ".flac",
+		FilenameFormat: "{track} - {title}",
+	}
+	applyQueuedMetadataPatch(&req)
+	if req.TrackName != "Fixed Title" || req.ArtistName != "Right Artist" || req.TrackNumber != 4 {
+		t.Fatalf("patch not applied: %+v", req)
+	}
+	if req.AlbumName != "Album" {
+		t.Fatalf("untouched field changed: %q", req.AlbumName)
+	}
+	if path := buildOutputPath(req); !strings.Contains(path, "Fixed Title") {
+		t.Fatalf("expected edited title in filename, got %s", path)
+	}
+	// Searches still look for the track the provider reported.
+	if req.matchTitle() != "Wrong Title" || req.matchArtist() != "Wrong Artist" || req.matchAlbum() != "Album" {
+		t.Fatalf("match names = %q / %q / %q", req.matchTitle(), req.matchArtist(), req.matchAlbum())
+	}
+
+	// Enrichment rewrites the title; the next apply matches on its value.
+	req.TrackName = "Enriched Title"
+	applyQueuedMetadataPatch(&req)
+	if req.TrackName != "Fixed Title" || req.matchTitle() != "Enriched Title" || req.matchArtist() != "Wrong Artist" {
+		t.Fatalf("after enrichment: %q, match %q / %q", req.TrackName, req.matchTitle(), req.matchArtist())
+	}
+}
+
+func TestQueuedMetadataFinishedOnSuccessOnly(t *testing.T) {
+	defer ClearQueuedItemMetadata("item-2")
+	if _, err := UpdateQueuedItemMetadata("item-2", `{"album": "Edited"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := `{"success":false,"album":"Raw"}`
+	if got := finishQueuedMetadata("item-2", failed); got != failed {
+		t.Fatalf("failed response must pass through, got %s", got)
+	}
+	if getQueuedMetadataPatch("item-2") == nil {
+		t.Fatal("patch must survive a failed attempt")
+	}
+
+	var resp DownloadResponse
+	json.Unmarshal([]byte(finishQueuedMetadata("item-2", `{"success":true,"album":"Raw"}`)), &resp)
+	if resp.Album != "Edited" {
+		t.Fatalf("expected edited album in response, got %q", resp.Album)
+	}
+	if getQueuedMetadataPatch("item-2") != nil {
+		t.Fatal("patch must be dropped after success")
+	}
+}
+
+func TestQueuedMetadataRejectsInvalidPatch(t *testing.T) {
+	if _, err := UpdateQueuedItemMetadata("", `{"title": "x"}`); err == nil {
+		t.Fatal("expected error for missing item id")
+	}
+	if _, err := UpdateQueuedItemMetadata("item-3", `{"title": "  "}`); err == nil {
+		t.Fatal("expected error for blank title")
+	}
+	if _, err := UpdateQueuedItemMetadata("item-3", `{"disc_number": -1}`); err == nil {
+		t.Fatal("expected error for negative disc number")
+	}
+	if getQueuedMetadataPatch("item-3") != nil {
+		t.Fatal("rejected patch must not be stored")
+	}
+}
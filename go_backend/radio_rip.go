@@ -0,0 +1,586 @@
+package gobackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Radio ripping (experimental) ====================
+//
+// StartRadioRip records a web radio stream into one file per track. Tracks
+// are cut at ICY StreamTitle changes, at silence, or both:
+//
+//   - ICY: the server interleaves a metadata block every icy-metaint bytes;
+//     a new StreamTitle starts a new file at the next frame boundary.
+//   - Silence: MP3 only. Frames whose granules carry no spectral data or
+//     a global gain of at most radioSilenceGain (peaks below about -60
+//     dBFS) count as silent; the first loud frame after min_silence_ms of
+//     them starts a new track, once the current one is min_track_sec long.
+//
+// Title changes are published as "stream_title" events and, with item_id,
+// as now_playing in the item's progress. MP3 tracks get an Info/Xing header
+// through the segment stitcher. Each finished track is announced with a
+// "radio_rip" event carrying tags for FFmpeg, like re-tagging does for MP3:
+// taken from the ICY artist and title and, with search_online, completed by
+// the retag matcher. The first and last tracks are usually cut mid-song
+// and are flagged partial.
+
+const (
+	RadioSplitICY     = "icy"
+	RadioSplitSilence = "silence"
+	RadioSplitBoth    = "both"
+
+	defaultRadioMinSilence = 1500 * time.Millisecond
+	defaultRadioMinTrack   = 30 * time.Second
+	radioSilenceGain       = 100
+)
+
+var radioStreamExtensions = map[string]string{
+	"audio/mpeg":  ".mp3",
+	"audio/mp3":   ".mp3",
+	"audio/aac":   ".aac",
+	"audio/aacp":  ".aac",
+	"audio/x-aac": ".aac",
+}
+
+type RadioRipOptions struct {
+	URL            string `json:"url"`
+	OutputDir      string `json:"output_dir"`
+	Split          string `json:"split"`
+	MaxDurationSec int    `json:"max_duration_sec"`
+	MinSilenceMs   int    `json:"min_silence_ms"`
+	MinTrackSec    int    `json:"min_track_sec"`
+	SearchOnline   bool   `json:"search_online"`
+	// ItemID, when set, reports bytes and the current title as item progress.
+	ItemID string `json:"item_id"`
+}
+
+type RadioRipTrack struct {
+	Path        string `json:"path"`
+	StreamTitle string `json:"stream_title,omitempty"`
+	SplitBy     string `json:"split_by"`
+	DurationMs  int64  `json:"duration_ms,omitempty"`
+	Bytes       int64  `json:"bytes"`
+	Partial     bool   `json:"partial"`
+	Source      string `json:"source,omitempty"`
+
+	// Tags for Dart to write with FFmpeg.
+	Fields map[string]string `json:"fields"`
+}
+
+type RadioRipStatus struct {
+	Running     bool            `json:"running"`
+	URL         string          `json:"url,omitempty"`
+	Station     string          `json:"station,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	NowPlaying  ICYMetadata     `json:"now_playing"`
+	StartedAt   int64           `json:"started_at,omitempty"`
+	Bytes       int64           `json:"bytes"`
+	Tracks      []RadioRipTrack `json:"tracks"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// radioTrack is the file being recorded.
+type radioTrack struct {
+	file       *os.File
+	counter    *countingWriter
+	stitcher   segmentStitcher
+	meta       ICYMetadata
+	samples    int64
+	sampleRate int
+}
+
+type radioRipper struct {
+	opts       RadioRipOptions
+	minSilence time.Duration
+	minTrack   time.Duration
+	cancel     context.CancelFunc
+	done       chan struct{}
+	tagging    sync.WaitGroup
+
+	mu     sync.Mutex
+	status RadioRipStatus
+
+	// Owned by the recording goroutine.
+	ext        string
+	nowPlaying ICYMetadata
+	track      *radioTrack
+	index      int
+	pending    []byte
+	pendingCut string
+	silentFor  time.Duration
+}
+
+var (
+	radioRipMu     sync.Mutex
+	activeRadioRip *radioRipper
+	lastRadioRip   *radioRipper
+)
+
+func (o RadioRipOptions) splitsOnICY() bool {
+	return o.Split == "" || o.Split == RadioSplitICY || o.Split == RadioSplitBoth
+}
+
+func (o RadioRipOptions) splitsOnSilence() bool {
+	return o.Split == RadioSplitSilence || o.Split == RadioSplitBoth
+}
+
+// StartRadioRip starts recording in the background, replacing a running
+// recording.
+func StartRadioRip(opts RadioRipOptions) error {
+	opts.URL = strings.TrimSpace(opts.URL)
+	if opts.URL == "" {
+		return fmt.Errorf("stream url is required")
+	}
+	switch opts.Split {
+	case "", RadioSplitICY, RadioSplitSilence, RadioSplitBoth:
+	default:
+		return fmt.Errorf("unknown split mode %q", opts.Split)
+	}
+	if info, err := os.Stat(opts.OutputDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("output folder does not exist: %s", opts.OutputDir)
+	}
+
+	StopRadioRip()
+
+	r := &radioRipper{
+		opts:       opts,
+		minSilence: defaultRadioMinSilence,
+		minTrack:   defaultRadioMinTrack,
+		done:       make(chan struct{}),
+		status:     RadioRipStatus{Running: true, URL: opts.URL, StartedAt: time.Now().Unix(), Tracks: []RadioRipTrack{}},
+	}
+	if opts.MinSilenceMs > 0 {
+		r.minSilence = time.Duration(opts.MinSilenceMs) * time.Millisecond
+	}
+	if opts.MinTrackSec > 0 {
+		r.minTrack = time.Duration(opts.MinTrackSec) * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if opts.MaxDurationSec > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(opts.MaxDurationSec)*time.Second)
+	}
+	r.cancel = cancel
+
+	radioRipMu.Lock()
+	activeRadioRip, lastRadioRip = r, r
+	radioRipMu.Unlock()
+
+	go r.run(ctx)
+	GoLog("[Radio] Recording %s (split=%s)\n", opts.URL, opts.Split)
+	return nil
+}
+
+// StopRadioRip stops the recording and returns its final status.
+func StopRadioRip() *RadioRipStatus {
+	radioRipMu.Lock()
+	r := activeRadioRip
+	activeRadioRip = nil
+	radioRipMu.Unlock()
+
+	if r == nil {
+		return nil
+	}
+	r.cancel()
+	<-r.done
+	status := r.snapshot()
+	return &status
+}
+
+// GetRadioRipStatus returns the running recording, or the last one.
+func GetRadioRipStatus() RadioRipStatus {
+	radioRipMu.Lock()
+	r := lastRadioRip
+	radioRipMu.Unlock()
+	if r == nil {
+		return RadioRipStatus{Tracks: []RadioRipTrack{}}
+	}
+	return r.snapshot()
+}
+
+func (r *radioRipper) snapshot() RadioRipStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.status
+	status.Tracks = append([]RadioRipTrack(nil), r.status.Tracks...)
+	return status
+}
+
+func (r *radioRipper) run(ctx context.Context) {
+	defer close(r.done)
+	defer r.cancel()
+
+	if r.opts.ItemID != "" {
+		StartItemProgress(r.opts.ItemID)
+		defer CompleteItemProgress(r.opts.ItemID)
+	}
+	err := r.record(ctx)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		err = nil
+	}
+	if finishErr := r.finishTrack("end", true); err == nil {
+		err = finishErr
+	}
+	r.tagging.Wait()
+
+	radioRipMu.Lock()
+	if activeRadioRip == r {
+		activeRadioRip = nil
+	}
+	radioRipMu.Unlock()
+
+	r.mu.Lock()
+	r.status.Running = false
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	tracks, errText := len(r.status.Tracks), r.status.Error
+	r.mu.Unlock()
+
+	if err != nil {
+		GoLog("[Radio] Recording of %s stopped: %v\n", r.opts.URL, err)
+	} else {
+		GoLog("[Radio] Recording of %s finished with %d tracks\n", r.opts.URL, tracks)
+	}
+	emitBackendEvent("radio_rip", map[string]interface{}{"state": "stopped", "tracks": tracks, "error": errText})
+}
+
+func (r *radioRipper) record(ctx context.Context) error {
+	resp, metaint, err := openICYStream(ctx, NewHTTPClientWithTimeout(0), r.opts.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext, ok := radioStreamExtensions[contentType]
+	if !ok {
+		return fmt.Errorf("unsupported stream type %q", contentType)
+	}
+	r.ext = ext
+	if ext != ".mp3" && r.opts.splitsOnSilence() {
+		GoLog("[Radio] Silence splitting needs an MP3 stream; %s splits on ICY titles only\n", contentType)
+	}
+
+	r.mu.Lock()
+	r.status.Station = strings.TrimSpace(resp.Header.Get("Icy-Name"))
+	r.status.ContentType = contentType
+	r.mu.Unlock()
+
+	body := newICYReader(resp.Body, metaint, r.onMetadata)
+	buf := make([]byte, 16<<10)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if err := r.audio(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// onMetadata publishes a new title as progress and a "stream_title" event
+// and marks where the track changes.
+func (r *radioRipper) onMetadata(meta ICYMetadata) {
+	if meta.StreamTitle == r.nowPlaying.StreamTitle {
+		return
+	}
+	GoLog("[Radio] Now playing: %s\n", meta.StreamTitle)
+	r.nowPlaying = meta
+	r.mu.Lock()
+	r.status.NowPlaying = meta
+	r.mu.Unlock()
+	if r.opts.ItemID != "" {
+		SetItemNowPlaying(r.opts.ItemID, meta.StreamTitle)
+	}
+	emitKeyedBackendEvent("stream_title", r.opts.ItemID, map[string]interface{}{
+		"item_id":  r.opts.ItemID,
+		"url":      r.opts.URL,
+		"metadata": meta,
+	})
+
+	switch {
+	case r.track == nil:
+	case r.track.meta.StreamTitle == "":
+		// The first block arrives metaint bytes in; it names that audio.
+		r.track.meta = meta
+	case r.opts.splitsOnICY():
+		r.pendingCut = RadioSplitICY
+	}
+}
+
+func (r *radioRipper) audio(data []byte) error {
+	r.mu.Lock()
+	r.status.Bytes += int64(len(data))
+	received := r.status.Bytes
+	r.mu.Unlock()
+	if r.opts.ItemID != "" {
+		SetItemBytesReceived(r.opts.ItemID, received)
+	}
+
+	if r.ext != ".mp3" {
+		if r.pendingCut != "" {
+			// Cut AAC at the next ADTS frame so both files start clean.
+			i := adtsSyncIndex(data)
+			if i < 0 {
+				return r.write(data, nil)
+			}
+			if err := r.write(data[:i], nil); err != nil {
+				return err
+			}
+			if err := r.finishTrack(r.pendingCut, false); err != nil {
+				return err
+			}
+			data = data[i:]
+		}
+		return r.write(data, nil)
+	}
+
+	r.pending = append(r.pending, data...)
+	pos := 0
+	for pos < len(r.pending) {
+		h, ok := parseMP3FrameHeader(r.pending[pos:])
+		if !ok {
+			if len(r.pending)-pos < 4 {
+				break
+			}
+			pos++ // resync
+			continue
+		}
+		if pos+h.length > len(r.pending) {
+			break
+		}
+		frame := r.pending[pos : pos+h.length]
+		pos += h.length
+
+		duration := time.Duration(mp3FrameSamples(h)) * time.Second / time.Duration(h.sampleRate)
+		if mp3FrameSilent(frame, h) {
+			r.silentFor += duration
+		} else {
+			if r.opts.splitsOnSilence() && r.silentFor >= r.minSilence && r.track != nil && r.track.duration() >= r.minTrack {
+				r.pendingCut = RadioSplitSilence
+			}
+			r.silentFor = 0
+		}
+		if r.pendingCut != "" {
+			if err := r.finishTrack(r.pendingCut, false); err != nil {
+				return err
+			}
+		}
+		if err := r.write(frame, &h); err != nil {
+			return err
+		}
+	}
+	r.pending = append(r.pending[:0], r.pending[pos:]...)
+	return nil
+}
+
+// adtsSyncIndex returns the start of the first ADTS frame in data whose
+// header is plausible and which is followed by another sync word, so a
+// 0xFFF pattern inside a payload is not taken for a frame.
+func adtsSyncIndex(data []byte) int {
+	for i := 0; i+7 <= len(data); i++ {
+		if data[i] != 0xff || data[i+1]&0xf6 != 0xf0 || data[i+2]>>2&0x0f > 12 {
+			continue
+		}
+		headerLen := 7
+		if data[i+1]&0x01 == 0 {
+			headerLen = 9
+		}
+		frameLen := int(data[i+3]&0x03)<<11 | int(data[i+4])<<3 | int(data[i+5])>>5
+		next := i + frameLen
+		if frameLen <= headerLen || next+1 >= len(data) {
+			continue
+		}
+		if data[next] == 0xff && data[next+1]&0xf6 == 0xf0 {
+			return i
+		}
+	}
+	return -1
+}
+
+func mp3FrameSamples(h mp3FrameHeader) int {
+	if h.mpeg1 {
+		return 1152
+	}
+	return 576
+}
+
+// mp3FrameSilent reads part2_3_length and global_gain of every granule and
+// channel from the frame's side info.
+func mp3FrameSilent(frame []byte, h mp3FrameHeader) bool {
+	side := frame[4:]
+	if h.raw>>16&1 == 0 {
+		side = frame[6:] // CRC
+	}
+	if len(side) < h.sideInfoSize() {
+		return false
+	}
+	channels := 2
+	if h.mono {
+		channels = 1
+	}
+	granules, block, bit := 2, 59, 9+3+4*channels
+	if h.mono {
+		bit = 9 + 5 + 4
+	}
+	if !h.mpeg1 {
+		granules, block, bit = 1, 63, 8+2
+		if h.mono {
+			bit = 8 + 1
+		}
+	}
+	read := func(at, n int) int {
+		v := 0
+		for i := at; i < at+n; i++ {
+			v = v<<1 | int(side[i/8]>>(7-i%8)&1)
+		}
+		return v
+	}
+	for i := 0; i < granules*channels; i++ {
+		part23 := read(bit, 12)
+		gain := read(bit+21, 8)
+		if part23 != 0 && gain > radioSilenceGain {
+			return false
+		}
+		bit += block
+	}
+	return true
+}
+
+func (t *radioTrack) duration() time.Duration {
+	if t.sampleRate == 0 {
+		return 0
+	}
+	return time.Duration(t.samples) * time.Second / time.Duration(t.sampleRate)
+}
+
+// write appends to the current track, opening the next file first if
+// needed. h is set for MP3 frames.
+func (r *radioRipper) write(data []byte, h *mp3FrameHeader) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if r.track == nil {
+		r.index++
+		file, err := createRadioTrackFile(r.opts.OutputDir, fmt.Sprintf("%03d - %s", r.index, sanitizeFilename(r.trackName())), r.ext)
+		if err != nil {
+			return fmt.Errorf("failed to create track file: %w", err)
+		}
+		counter := &countingWriter{w: file}
+		container := StreamContainerAAC
+		if r.ext == ".mp3" {
+			container = StreamContainerMP3
+		}
+		r.track = &radioTrack{file: file, counter: counter, stitcher: newSegmentStitcher(container, file, counter), meta: r.nowPlaying}
+	}
+	if h != nil {
+		r.track.samples += int64(mp3FrameSamples(*h))
+		r.track.sampleRate = h.sampleRate
+	}
+	return r.track.stitcher.write(data)
+}
+
+// createRadioTrackFile creates base+ext in dir, or "base (n)ext" when an
+// earlier rip already left a file of that name.
+func createRadioTrackFile(dir, base, ext string) (*os.File, error) {
+	name := base + ext
+	for n := 2; ; n++ {
+		file, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			return file, err
+		}
+		name = fmt.Sprintf("%s (%d)%s", base, n, ext)
+	}
+}
+
+func (r *radioRipper) trackName() string {
+	if r.nowPlaying.StreamTitle != "" {
+		return r.nowPlaying.StreamTitle
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status.Station != "" {
+		return r.status.Station
+	}
+	return "Radio"
+}
+
+// finishTrack closes the current file and tags it in the background.
+func (r *radioRipper) finishTrack(splitBy string, last bool) error {
+	r.pendingCut = ""
+	t := r.track
+	if t == nil {
+		return nil
+	}
+	r.track = nil
+
+	err := t.stitcher.finish()
+	if closeErr := t.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish track: %w", err)
+	}
+
+	track := RadioRipTrack{
+		Path:        t.file.Name(),
+		StreamTitle: t.meta.StreamTitle,
+		SplitBy:     splitBy,
+		DurationMs:  t.duration().Milliseconds(),
+		Bytes:       t.counter.n,
+		Partial:     r.index == 1 || last,
+	}
+	r.mu.Lock()
+	slot := len(r.status.Tracks)
+	r.status.Tracks = append(r.status.Tracks, track)
+	r.mu.Unlock()
+
+	r.tagging.Add(1)
+	go func() {
+		defer r.tagging.Done()
+		// A cut-off track is shorter than the release, so its length says
+		// nothing.
+		durationMs := track.DurationMs
+		if track.Partial {
+			durationMs = 0
+		}
+		track.Fields, track.Source = radioTrackFields(t.meta, durationMs, r.opts.SearchOnline)
+		r.mu.Lock()
+		r.status.Tracks[slot] = track
+		r.mu.Unlock()
+		GoLog("[Radio] Saved %s (%s, %d ms)\n", filepath.Base(track.Path), splitBy, track.DurationMs)
+		emitBackendEvent("radio_rip", map[string]interface{}{"state": "track", "track": track})
+	}()
+	return nil
+}
+
+// radioTrackFields tags a track from its ICY title and, when asked, the
+// retag matcher; durationMs is the recorded length, or 0 when unknown.
+func radioTrackFields(icy ICYMetadata, durationMs int64, searchOnline bool) (map[string]string, string) {
+	meta := Metadata{Title: icy.Title, Artist: icy.Artist}
+	source := ""
+	if searchOnline && meta.Title != "" && meta.Artist != "" {
+		if match, err := lookupRetagMatch(meta, durationMs); err == nil {
+			meta, _ = mergeRetagMetadata(meta, match.Metadata, true)
+			source = match.Source
+		} else {
+			GoLog("[Radio] %s: %v\n", icy.StreamTitle, err)
+		}
+	}
+	return retagFFmpegFields(meta), source
+}
@@ -0,0 +1,156 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func waitRadioRip(t *testing.T) RadioRipStatus {
+	t.Helper()
+	radioRipMu.Lock()
+	r := lastRadioRip
+	radioRipMu.Unlock()
+	select {
+	case <-r.done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("recording did not finish")
+	}
+	return r.snapshot()
+}
+
+func assertRadioTrackFrames(t *testing.T, path string, frames int) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 417*(frames+1) {
+		t.Fatalf("%s is %d bytes, want %d", filepath.Base(path), len(data), 417*(frames+1))
+	}
+	if info := data[4+32:]; string(info[:4]) != "Info" || binary.BigEndian.Uint32(info[8:]) != uint32(frames) {
+		t.Fatalf("%s has Info header % x, want %d frames", filepath.Base(path), info[:12], frames)
+	}
+}
+
+func TestRadioRip_SplitsOnICYTitles(t *testing.T) {
+	audio := testMP3Frames(20)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Icy-MetaData") != "1" {
+			t.Error("Icy-MetaData header missing")
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("Icy-Name", "Station")
+		w.Header().Set("Icy-Metaint", "1000")
+		for off := 0; off < len(audio); off += 1000 {
+			end := min(off+1000, len(audio))
+			w.Write(audio[off:end])
+			if end-off < 1000 {
+				break
+			}
+			title := "StreamTitle='Artist A - Song A';"
+			if end > 4170 {
+				title = "StreamTitle='Artist B - Song B';"
+			}
+			block := make([]byte, (len(title)+15)/16*16)
+			copy(block, title)
+			w.Write(append([]byte{byte(len(block) / 16)}, block...))
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := StartRadioRip(RadioRipOptions{URL: server.URL, OutputDir: dir, ItemID: "radio-test"}); err != nil {
+		t.Fatal(err)
+	}
+	defer RemoveItemProgress("radio-test")
+	status := waitRadioRip(t)
+	if status.Running || status.Error != "" || status.Station != "Station" || len(status.Tracks) != 2 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if status.NowPlaying.Artist != "Artist B" || !strings.Contains(GetItemProgress("radio-test"), `"now_playing":"Artist B - Song B"`) {
+		t.Errorf("now playing = %+v, progress %s", status.NowPlaying, GetItemProgress("radio-test"))
+	}
+
+	first, second := status.Tracks[0], status.Tracks[1]
+	if filepath.Base(first.Path) != "001 - Station.mp3" || first.StreamTitle != "Artist A - Song A" || first.SplitBy != RadioSplitICY || !first.Partial {
+		t.Errorf("unexpected first track %+v", first)
+	}
+	if filepath.Base(second.Path) != "002 - Artist B - Song B.mp3" || second.SplitBy != "end" || second.Fields["ARTIST"] != "Artist B" || second.Fields["TITLE"] != "Song B" {
+		t.Errorf("unexpected second track %+v", second)
+	}
+	if second.DurationMs != 9*1152*1000/44100 {
+		t.Errorf("second track duration = %d ms", second.DurationMs)
+	}
+	assertRadioTrackFrames(t, first.Path, 11)
+	assertRadioTrackFrames(t, second.Path, 9)
+}
+
+func TestRadioRip_SplitsOnSilence(t *testing.T) {
+	silent := append([]byte{0xff, 0xfb, 0x90, 0x00}, make([]byte, 413)...)
+	audio := append(testMP3Frames(50), bytes.Repeat(silent, 60)...)
+	audio = append(audio, testMP3Frames(20)...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write(audio)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := StartRadioRip(RadioRipOptions{URL: server.URL, OutputDir: dir, Split: RadioSplitSilence, MinTrackSec: 1}); err != nil {
+		t.Fatal(err)
+	}
+	status := waitRadioRip(t)
+	if len(status.Tracks) != 2 || status.Tracks[0].SplitBy != RadioSplitSilence {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	assertRadioTrackFrames(t, status.Tracks[0].Path, 110)
+	assertRadioTrackFrames(t, status.Tracks[1].Path, 20)
+}
+
+func testADTSFrame(size int) []byte {
+	frame := make([]byte, size)
+	frame[0], frame[1], frame[2] = 0xff, 0xf1, 0x50 // AAC LC, 44.1 kHz
+	frame[3] = 0x80 | byte(size>>11)&0x03
+	frame[4] = byte(size >> 3)
+	frame[5] = byte(size&0x07)<<5 | 0x1f
+	frame[6] = 0xfc
+	return frame
+}
+
+func TestADTSSyncIndexValidatesFrames(t *testing.T) {
+	// Payload bytes that look like a sync word but announce a frame length
+	// that does not land on the next header.
+	junk := []byte{0x00, 0xff, 0xf1, 0x50, 0x80, 0x02, 0x00, 0x00, 0x11}
+	data := append(append(junk, testADTSFrame(64)...), testADTSFrame(64)...)
+	if got := adtsSyncIndex(data); got != len(junk) {
+		t.Errorf("adtsSyncIndex = %d, want %d", got, len(junk))
+	}
+	if got := adtsSyncIndex(testADTSFrame(64)); got != -1 {
+		t.Errorf("frame without a following sync word = %d, want -1", got)
+	}
+}
+
+func TestCreateRadioTrackFileKeepsEarlierRips(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "001 - Station.mp3"), []byte("earlier"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := createRadioTrackFile(dir, "001 - Station", ".mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	if filepath.Base(file.Name()) != "001 - Station (2).mp3" {
+		t.Errorf("created %s", file.Name())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "001 - Station.mp3")); string(data) != "earlier" {
+		t.Error("earlier rip was overwritten")
+	}
+}
@@ -0,0 +1,440 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== New release watcher ====================
+//
+// Users follow artists; every BackendConfig.ReleaseCheckHours the watcher
+// fetches each artist's discography from Deezer or Spotify and emits a
+// "release" event for albums and singles it has not seen before. The first
+// check of an artist only records the existing catalogue. Artists with
+// AutoEnqueue set also get their new releases pushed to the import queue,
+// which Flutter already drains into downloads.
+
+const (
+	releaseWatchStateFile    = "release_watch.json"
+	releaseWatchTick         = 15 * time.Minute
+	releaseWatchCheckTimeout = 30 * time.Second
+	defaultReleaseCheckHours = 12
+	maxReleaseCheckHours     = 24 * 7
+
+	ReleaseProviderDeezer  = "deezer"
+	ReleaseProviderSpotify = "spotify"
+)
+
+type WatchArtistRequest struct {
+	// URL is a Spotify or Deezer artist link; Provider and ArtistID are used
+	// when it is empty.
+	URL         string `json:"url,omitempty"`
+	Provider    string `json:"provider,omitempty"`
+	ArtistID    string `json:"artist_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	AutoEnqueue bool   `json:"auto_enqueue"`
+}
+
+type WatchedArtist struct {
+	Provider      string   `json:"provider"`
+	ArtistID      string   `json:"artist_id"`
+	Name          string   `json:"name,omitempty"`
+	AutoEnqueue   bool     `json:"auto_enqueue"`
+	AddedAt       int64    `json:"added_at"`
+	LastCheckedAt int64    `json:"last_checked_at,omitempty"`
+	LastError     string   `json:"last_error,omitempty"`
+	KnownReleases []string `json:"known_releases,omitempty"`
+}
+
+type NewRelease struct {
+	Provider    string `json:"provider"`
+	ArtistID    string `json:"artist_id"`
+	ArtistName  string `json:"artist_name"`
+	AlbumID     string `json:"album_id"`
+	Name        string `json:"name"`
+	AlbumType   string `json:"album_type"`
+	ReleaseDate string `json:"release_date,omitempty"`
+	TotalTracks int    `json:"total_tracks,omitempty"`
+	Images      string `json:"images,omitempty"`
+	URL         string `json:"url"`
+	Enqueued    bool   `json:"enqueued,omitempty"`
+}
+
+type releaseWatcher struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	releaseWatchMu       sync.Mutex
+	releaseWatchStateDir string
+	releaseWatchArtists  map[string]*WatchedArtist
+
+	// releaseWatchCheckMu keeps a manual check and the background loop from
+	// fetching the same artists at once.
+	releaseWatchCheckMu sync.Mutex
+
+	releaseWatcherMu     sync.Mutex
+	activeReleaseWatcher *releaseWatcher
+
+	// fetchArtistReleases is swapped out by tests.
+	fetchArtistReleases = fetchArtistReleasesOnline
+)
+
+func releaseWatchKey(provider, artistID string) string {
+	return provider + ":" + artistID
+}
+
+func SetReleaseWatchStateDir(dir string) error {
+	releaseWatchMu.Lock()
+	defer releaseWatchMu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create release watch dir: %w", err)
+	}
+	if err := openStore(dir, releaseWatchStoreSchema); err != nil {
+		return err
+	}
+	releaseWatchStateDir = dir
+	releaseWatchArtists = nil
+	return nil
+}
+
+func loadReleaseWatchStateLocked() map[string]*WatchedArtist {
+	if releaseWatchArtists != nil {
+		return releaseWatchArtists
+	}
+	releaseWatchArtists = make(map[string]*WatchedArtist)
+	if releaseWatchStateDir == "" {
+		return releaseWatchArtists
+	}
+
+	data, err := os.ReadFile(filepath.Join(releaseWatchStateDir, releaseWatchStateFile))
+	if err != nil {
+		return releaseWatchArtists
+	}
+	if err := json.Unmarshal(data, &releaseWatchArtists); err != nil {
+		GoLog("[ReleaseWatch] Ignoring corrupt state file: %v\n", err)
+		releaseWatchArtists = make(map[string]*WatchedArtist)
+	}
+	return releaseWatchArtists
+}
+
+func saveReleaseWatchStateLocked() error {
+	if releaseWatchStateDir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(releaseWatchArtists, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(releaseWatchStateDir, releaseWatchStateFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// normalizeWatchArtistRequest fills Provider/ArtistID from URL.
+func normalizeWatchArtistRequest(req *WatchArtistRequest) error {
+	if url := strings.TrimSpace(req.URL); url != "" {
+		if parsed, err := parseSpotifyURI(url); err == nil && parsed.Type == "artist" {
+			req.Provider, req.ArtistID = ReleaseProviderSpotify, parsed.ID
+		} else if kind, id, err := parseDeezerURL(url); err == nil && kind == "artist" {
+			req.Provider, req.ArtistID = ReleaseProviderDeezer, id
+		} else {
+			return fmt.Errorf("not a Spotify or Deezer artist link: %s", url)
+		}
+	}
+
+	req.Provider = strings.ToLower(strings.TrimSpace(req.Provider))
+	req.ArtistID = strings.TrimPrefix(strings.TrimSpace(req.ArtistID), "deezer:")
+	switch req.Provider {
+	case ReleaseProviderDeezer, ReleaseProviderSpotify:
+	default:
+		return fmt.Errorf("unsupported provider: %q", req.Provider)
+	}
+	if req.ArtistID == "" {
+		return fmt.Errorf("artist_id is required")
+	}
+	return nil
+}
+
+// WatchArtist starts following an artist, or updates AutoEnqueue for one
+// already followed.
+func WatchArtist(req WatchArtistRequest) (*WatchedArtist, error) {
+	if err := normalizeWatchArtistRequest(&req); err != nil {
+		return nil, err
+	}
+
+	releaseWatchMu.Lock()
+	defer releaseWatchMu.Unlock()
+
+	artists := loadReleaseWatchStateLocked()
+	key := releaseWatchKey(req.Provider, req.ArtistID)
+	artist, ok := artists[key]
+	if !ok {
+		artist = &WatchedArtist{Provider: req.Provider, ArtistID: req.ArtistID, AddedAt: time.Now().Unix()}
+		artists[key] = artist
+	}
+	if req.Name != "" {
+		artist.Name = req.Name
+	}
+	artist.AutoEnqueue = req.AutoEnqueue
+	if err := saveReleaseWatchStateLocked(); err != nil {
+		return nil, fmt.Errorf("failed to save release watch state: %w", err)
+	}
+
+	copied := *artist
+	return &copied, nil
+}
+
+func UnwatchArtist(provider, artistID string) error {
+	releaseWatchMu.Lock()
+	defer releaseWatchMu.Unlock()
+
+	delete(loadReleaseWatchStateLocked(), releaseWatchKey(strings.ToLower(provider), strings.TrimPrefix(artistID, "deezer:")))
+	return saveReleaseWatchStateLocked()
+}
+
+// ListWatchedArtists returns followed artists sorted by name, without their
+// known release lists.
+func ListWatchedArtists() []WatchedArtist {
+	releaseWatchMu.Lock()
+	defer releaseWatchMu.Unlock()
+
+	list := make([]WatchedArtist, 0, len(releaseWatchArtists))
+	for _, artist := range loadReleaseWatchStateLocked() {
+		copied := *artist
+		copied.KnownReleases = nil
+		list = append(list, copied)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+	return list
+}
+
+func fetchArtistReleasesOnline(ctx context.Context, provider, artistID string) (*ArtistResponsePayload, error) {
+	if provider == ReleaseProviderDeezer {
+		return GetDeezerClient().GetArtist(ctx, artistID)
+	}
+
+	client, err := NewSpotifyMetadataClient()
+	if err != nil {
+		return nil, err
+	}
+	data, err := client.GetFilteredData(ctx, "https://open.spotify.com/artist/"+artistID, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	payload, ok := data.(*ArtistResponsePayload)
+	if !ok {
+		return nil, fmt.Errorf("unexpected artist response")
+	}
+	return payload, nil
+}
+
+func releaseURL(provider, albumID string) string {
+	if provider == ReleaseProviderDeezer {
+		return "https://www.deezer.com/album/" + strings.TrimPrefix(albumID, "deezer:")
+	}
+	return "https://open.spotify.com/album/" + albumID
+}
+
+// checkArtistReleases fetches one artist and returns releases not in its
+// known list. The caller holds releaseWatchCheckMu, not releaseWatchMu.
+func checkArtistReleases(ctx context.Context, artist WatchedArtist) ([]NewRelease, []string, string, error) {
+	payload, err := fetchArtistReleases(ctx, artist.Provider, artist.ArtistID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	known := make(map[string]bool, len(artist.KnownReleases))
+	for _, id := range artist.KnownReleases {
+		known[id] = true
+	}
+	baseline := artist.LastCheckedAt == 0
+
+	var releases []NewRelease
+	ids := make([]string, 0, len(payload.Albums))
+	for _, album := range payload.Albums {
+		ids = append(ids, album.ID)
+		if baseline || known[album.ID] {
+			continue
+		}
+		releases = append(releases, NewRelease{
+			Provider:    artist.Provider,
+			ArtistID:    artist.ArtistID,
+			ArtistName:  payload.ArtistInfo.Name,
+			AlbumID:     album.ID,
+			Name:        album.Name,
+			AlbumType:   album.AlbumType,
+			ReleaseDate: album.ReleaseDate,
+			TotalTracks: album.TotalTracks,
+			Images:      album.Images,
+			URL:         releaseURL(artist.Provider, album.ID),
+		})
+	}
+	return releases, ids, payload.ArtistInfo.Name, nil
+}
+
+// CheckNewReleases checks every followed artist that is due, or all of them
+// with force, and returns the new releases found.
+func CheckNewReleases(force bool) ([]NewRelease, error) {
+	releaseWatchCheckMu.Lock()
+	defer releaseWatchCheckMu.Unlock()
+
+	interval := int64(GetBackendConfig().ReleaseCheckHours) * 3600
+	now := time.Now().Unix()
+
+	releaseWatchMu.Lock()
+	var due []WatchedArtist
+	for _, artist := range loadReleaseWatchStateLocked() {
+		if force || artist.LastCheckedAt == 0 || (interval > 0 && now >= artist.LastCheckedAt+interval) {
+			due = append(due, *artist)
+		}
+	}
+	releaseWatchMu.Unlock()
+
+	found := make([]NewRelease, 0)
+	for _, artist := range due {
+		ctx, cancel := context.WithTimeout(context.Background(), releaseWatchCheckTimeout)
+		releases, ids, name, err := checkArtistReleases(ctx, artist)
+		cancel()
+
+		if err == nil && artist.AutoEnqueue && len(releases) > 0 {
+			items := make([]ImportItem, 0, len(releases))
+			for i := range releases {
+				items = append(items, ImportItem{
+					URL:        releases[i].URL,
+					Source:     releases[i].Provider,
+					Type:       "album",
+					SourceFile: "release_watch",
+					AddedAt:    time.Now().Unix(),
+				})
+				releases[i].Enqueued = true
+			}
+			enqueueImportItems(items)
+		}
+
+		releaseWatchMu.Lock()
+		if stored, ok := loadReleaseWatchStateLocked()[releaseWatchKey(artist.Provider, artist.ArtistID)]; ok {
+			stored.LastCheckedAt = time.Now().Unix()
+			if err != nil {
+				stored.LastError = err.Error()
+			} else {
+				stored.LastError = ""
+				stored.KnownReleases = ids
+				if stored.Name == "" {
+					stored.Name = name
+				}
+			}
+		}
+		if saveErr := saveReleaseWatchStateLocked(); saveErr != nil {
+			GoLog("[ReleaseWatch] Warning: failed to save state: %v\n", saveErr)
+		}
+		releaseWatchMu.Unlock()
+
+		if err != nil {
+			GoLog("[ReleaseWatch] %s:%s check failed: %v\n", artist.Provider, artist.ArtistID, err)
+			continue
+		}
+		for _, release := range releases {
+			emitBackendEvent("release", release)
+		}
+		found = append(found, releases...)
+	}
+
+	if len(due) > 0 {
+		GoLog("[ReleaseWatch] Checked %d artists, %d new releases\n", len(due), len(found))
+	}
+	return found, nil
+}
+
+func (w *releaseWatcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(releaseWatchTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if GetBackendConfig().ReleaseCheckHours == 0 || !GetNetworkState().Connected {
+				continue
+			}
+			CheckNewReleases(false)
+		}
+	}
+}
+
+// StartReleaseWatcher runs the periodic check in the background. Artists
+// are checked when their interval elapsed, so interval changes apply without
+// a restart.
+func StartReleaseWatcher() {
+	StopReleaseWatcher()
+
+	w := &releaseWatcher{stop: make(chan struct{}), done: make(chan struct{})}
+	releaseWatcherMu.Lock()
+	activeReleaseWatcher = w
+	releaseWatcherMu.Unlock()
+	go w.run()
+}
+
+func StopReleaseWatcher() {
+	releaseWatcherMu.Lock()
+	w := activeReleaseWatcher
+	activeReleaseWatcher = nil
+	releaseWatcherMu.Unlock()
+
+	if w != nil {
+		close(w.stop)
+		<-w.done
+	}
+}
+
+func WatchArtistJSON(requestJSON string) (string, error) {
+	var req WatchArtistRequest
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return "", fmt.Errorf("invalid request: %w", err)
+	}
+	artist, err := WatchArtist(req)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(artist)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func ListWatchedArtistsJSON() (string, error) {
+	jsonBytes, err := json.Marshal(ListWatchedArtists())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func CheckNewReleasesJSON(force bool) (string, error) {
+	releases, err := CheckNewReleases(force)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(releases)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,55 @@
+package gobackend
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckNewReleases(t *testing.T) {
+	prevFetch := fetchArtistReleases
+	defer func() { fetchArtistReleases = prevFetch }()
+	if err := SetReleaseWatchStateDir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer SetReleaseWatchStateDir(t.TempDir())
+
+	albums := []ArtistAlbumMetadata{{ID: "deezer:1", Name: "Debut", AlbumType: "album"}}
+	fetchArtistReleases = func(ctx context.Context, provider, artistID string) (*ArtistResponsePayload, error) {
+		return &ArtistResponsePayload{ArtistInfo: ArtistInfoMetadata{Name: "Artist"}, Albums: albums}, nil
+	}
+
+	if _, err := WatchArtist(WatchArtistRequest{URL: "https://www.deezer.com/en/artist/27", AutoEnqueue: true}); err != nil {
+		t.Fatalf("WatchArtist failed: %v", err)
+	}
+
+	// The first check only records the existing catalogue.
+	found, err := CheckNewReleases(false)
+	if err != nil || len(found) != 0 {
+		t.Fatalf("baseline check = %+v, %v", found, err)
+	}
+	if list := ListWatchedArtists(); len(list) != 1 || list[0].Name != "Artist" || list[0].ArtistID != "27" {
+		t.Fatalf("artists = %+v", list)
+	}
+
+	// Not due yet.
+	albums = append(albums, ArtistAlbumMetadata{ID: "deezer:2", Name: "Single", AlbumType: "single"})
+	if found, _ := CheckNewReleases(false); len(found) != 0 {
+		t.Fatalf("check before interval found %+v", found)
+	}
+
+	PollImportedItemsJSON()
+	found, err = CheckNewReleases(true)
+	if err != nil || len(found) != 1 {
+		t.Fatalf("forced check = %+v, %v", found, err)
+	}
+	if found[0].AlbumID != "deezer:2" || found[0].URL != "https://www.deezer.com/album/2" || !found[0].Enqueued {
+		t.Errorf("release = %+v", found[0])
+	}
+	if queued, _ := PollImportedItemsJSON(); queued == "[]" {
+		t.Error("auto-enqueue did not queue the release")
+	}
+
+	if err := UnwatchArtist("deezer", "27"); err != nil || len(ListWatchedArtists()) != 0 {
+		t.Errorf("UnwatchArtist left %d artists, err = %v", len(ListWatchedArtists()), err)
+	}
+}
@@ -0,0 +1,568 @@
+package gobackend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	stdimage "image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================== Library re-tagging ====================
+//
+// RetagFiles re-reads tags of files that are already in the library, looks
+// the tracks up again with the current providers and settings and rewrites
+// what improved. FLAC is rewritten in place (the FLAC writer reuses the open
+// file, so SAF /proc/self/fd paths work); MP3 and Opus are returned to Dart
+// for FFmpeg, like EditFileMetadata does.
+
+const (
+	RetagStatusUpdated     = "updated"
+	RetagStatusUnchanged   = "unchanged"
+	RetagStatusWouldUpdate = "would_update"
+	RetagStatusNeedsFFmpeg = "needs_ffmpeg"
+	RetagStatusFailed      = "failed"
+)
+
+// RetagOptions controls a batch. Existing values are only replaced when
+// Overwrite is set; otherwise online data only fills empty tags. Covers are
+// replaced when the file has none or the new one has more pixels.
+type RetagOptions struct {
+	DryRun       bool `json:"dry_run"`
+	SearchOnline bool `json:"search_online"`
+	Cover        bool `json:"cover"`
+	Lyrics       bool `json:"lyrics"`
+	Overwrite    bool `json:"overwrite"`
+}
+
+type RetagChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type RetagFileResult struct {
+	Path    string        `json:"path"`
+	Status  string        `json:"status"`
+	Source  string        `json:"source,omitempty"`
+	Changes []RetagChange `json:"changes"`
+	Error   string        `json:"error,omitempty"`
+
+	// Set for RetagStatusNeedsFFmpeg: tags and cover for Dart to write.
+	Fields    map[string]string `json:"fields,omitempty"`
+	CoverPath string            `json:"cover_path,omitempty"`
+}
+
+type RetagReport struct {
+	DryRun bool `json:"dry_run"`
+	// ScratchID names the scratch directory holding the covers of
+	// needs_ffmpeg results; release it with library.retag.release once
+	// FFmpeg wrote them.
+	ScratchID string            `json:"scratch_id,omitempty"`
+	Results   []RetagFileResult `json:"results"`
+	Updated   int               `json:"updated"`
+	Unchanged int               `json:"unchanged"`
+	Failed    int               `json:"failed"`
+}
+
+// retagMatch is the online metadata found for one file.
+type retagMatch struct {
+	Source     string
+	Metadata   Metadata
+	CoverURL   string
+	SpotifyID  string
+	DurationMs int64
+}
+
+type retagField struct {
+	name string
+	str  *string
+	num  *int
+}
+
+func (f retagField) value() string {
+	if f.num != nil {
+		if *f.num == 0 {
+			return ""
+		}
+		return strconv.Itoa(*f.num)
+	}
+	return *f.str
+}
+
+func (f retagField) set(value string) {
+	if f.num != nil {
+		*f.num, _ = strconv.Atoi(value)
+		return
+	}
+	*f.str = value
+}
+
+func retagFields(m *Metadata) []retagField {
+	return []retagField{
+		{name: "title", str: &m.Title},
+		{name: "artist", str: &m.Artist},
+		{name: "album", str: &m.Album},
+		{name: "album_artist", str: &m.AlbumArtist},
+		{name: "date", str: &m.Date},
+		{name: "track_number", num: &m.TrackNumber},
+		{name: "disc_number", num: &m.DiscNumber},
+		{name: "isrc", str: &m.ISRC},
+		{name: "genre", str: &m.Genre},
+		{name: "label", str: &m.Label},
+		{name: "copyright", str: &m.Copyright},
+	}
+}
+
+// mergeRetagMetadata applies found onto a copy of current and lists the
+// fields that changed.
+func mergeRetagMetadata(current, found Metadata, overwrite bool) (Metadata, []RetagChange) {
+	merged := current
+	var changes []RetagChange
+	mergedFields := retagFields(&merged)
+	for i, field := range retagFields(&found) {
+		newValue := strings.TrimSpace(field.value())
+		oldValue := mergedFields[i].value()
+		if newValue == "" || newValue == oldValue || (oldValue != "" && !overwrite) {
+			continue
+		}
+		mergedFields[i].set(newValue)
+		changes = append(changes, RetagChange{Field: field.name, Old: oldValue, New: newValue})
+	}
+	return merged, changes
+}
+
+// readRetagMetadata reads the tags RetagFiles can compare and rewrite.
+func readRetagMetadata(filePath string) (*Metadata, error) {
+	return readRetagMetadataAs(filePath, strings.ToLower(filepath.Ext(filePath)))
+}
+
+// readRetagMetadataAs is readRetagMetadata for a path without a usable
+// extension, such as a SAF descriptor.
+func readRetagMetadataAs(filePath, ext string) (*Metadata, error) {
+	switch ext {
+	case ".flac":
+		return ReadMetadata(filePath)
+	case ".mp3", ".opus", ".ogg":
+		var meta *AudioMetadata
+		var err error
+		if ext == ".mp3" {
+			meta, err = ReadID3Tags(filePath)
+		} else {
+			meta, err = ReadOggVorbisComments(filePath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		date := meta.Date
+		if date == "" {
+			date = meta.Year
+		}
+		return &Metadata{
+			Title:       meta.Title,
+			Artist:      meta.Artist,
+			Album:       meta.Album,
+			AlbumArtist: meta.AlbumArtist,
+			Date:        date,
+			TrackNumber: meta.TrackNumber,
+			DiscNumber:  meta.DiscNumber,
+			ISRC:        meta.ISRC,
+			Lyrics:      meta.Lyrics,
+			Genre:       meta.Genre,
+			Label:       meta.Label,
+			Copyright:   meta.Copyright,
+			Composer:    meta.Composer,
+			Comment:     meta.Comment,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported file format: %s", filePath)
+}
+
+// retagDurationTolerance is how far a search result's length may be from the
+// file's before it is taken for a different recording.
+const retagDurationTolerance = 10 * time.Second
+
+// retagCandidateMatches reports whether a search result is the same track as
+// the file: the titles (including the version guard) and primary artists must
+// match, and the lengths must agree when both are known.
+func retagCandidateMatches(current Metadata, durationMs int64, candidate *retagMatch) bool {
+	if !titlesMatch(current.Title, candidate.Metadata.Title) {
+		return false
+	}
+	artists := compareArtistLists(splitArtists(current.Artist), splitArtists(candidate.Metadata.Artist))
+	if !artists.PrimaryMatch {
+		return false
+	}
+	if durationMs > 0 && candidate.DurationMs > 0 {
+		diff := time.Duration(durationMs-candidate.DurationMs) * time.Millisecond
+		if diff < -retagDurationTolerance || diff > retagDurationTolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupRetagMatch finds the track online: by ISRC through the cached
+// catalog lookup first, then by title and artist on Deezer and the extension
+// metadata providers. Search results are only taken when
+// retagCandidateMatches accepts them; durationMs is the file's length, or 0
+// when unknown.
+func lookupRetagMatch(current Metadata, durationMs int64) (*retagMatch, error) {
+	deezerClient := GetDeezerClient()
+	var match *retagMatch
+
+	fromCatalog := func(track *TrackMetadata) *retagMatch {
+		source := "spotify"
+		if prefix, _, ok := strings.Cut(track.SpotifyID, ":"); ok {
+			source = prefix
+		}
+		return &retagMatch{
+			Source: source,
+			Metadata: Metadata{
+				Title:       track.Name,
+				Artist:      track.Artists,
+				Album:       track.AlbumName,
+				AlbumArtist: track.AlbumArtist,
+				Date:        track.ReleaseDate,
+				TrackNumber: track.TrackNumber,
+				DiscNumber:  track.DiscNumber,
+				ISRC:        track.ISRC,
+			},
+			CoverURL:   track.Images,
+			SpotifyID:  track.SpotifyID,
+			DurationMs: int64(track.DurationMS),
+		}
+	}
+	fromExtension := func(track *ExtTrackMetadata) *retagMatch {
+		return &retagMatch{
+			Source: track.ProviderID,
+			Metadata: Metadata{
+				Title:       track.Name,
+				Artist:      track.Artists,
+				Album:       track.AlbumName,
+				AlbumArtist: track.AlbumArtist,
+				Date:        track.ReleaseDate,
+				TrackNumber: track.TrackNumber,
+				DiscNumber:  track.DiscNumber,
+				ISRC:        track.ISRC,
+				Genre:       track.Genre,
+				Label:       track.Label,
+				Copyright:   track.Copyright,
+			},
+			CoverURL:   track.ResolvedCoverURL(),
+			SpotifyID:  track.SpotifyID,
+			DurationMs: int64(track.DurationMS),
+		}
+	}
+
+	if current.ISRC != "" {
+		if track := lookupISRCCached(current.ISRC); track != nil {
+			match = fromCatalog(track)
+		} else {
+			GoLog("[Retag] No catalog match for ISRC %s\n", current.ISRC)
+		}
+	}
+
+	if match == nil && current.Title != "" && current.Artist != "" {
+		query := current.Title + " " + current.Artist
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		results, err := deezerClient.SearchAll(ctx, query, 5, 0, "track")
+		cancel()
+		if err == nil {
+			for i := range results.Tracks {
+				if candidate := fromCatalog(&results.Tracks[i]); retagCandidateMatches(current, durationMs, candidate) {
+					match = candidate
+					break
+				}
+			}
+		}
+		if match == nil {
+			if extTracks, extErr := GetExtensionManager().SearchTracksWithExtensions(query, 5); extErr == nil {
+				for i := range extTracks {
+					if candidate := fromExtension(&extTracks[i]); retagCandidateMatches(current, durationMs, candidate) {
+						match = candidate
+						break
+					}
+				}
+			}
+		}
+	}
+
+	if match == nil {
+		return nil, fmt.Errorf("no online match")
+	}
+
+	if match.Metadata.ISRC != "" && (match.Metadata.Genre == "" || match.Metadata.Label == "") {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		extMeta, err := deezerClient.GetExtendedMetadataByISRC(ctx, match.Metadata.ISRC)
+		cancel()
+		if err == nil && extMeta != nil {
+			if match.Metadata.Genre == "" {
+				match.Metadata.Genre = extMeta.Genre
+			}
+			if match.Metadata.Label == "" {
+				match.Metadata.Label = extMeta.Label
+			}
+		}
+	}
+	return match, nil
+}
+
+// retagCoverImproves reports whether the cover at coverURL should replace
+// the embedded one, probing only the image header.
+func retagCoverImproves(filePath, coverURL string, overwrite bool) (bool, string) {
+	existing, _, err := extractAnyCoverArt(filePath)
+	if err != nil || len(existing) == 0 {
+		return true, "none"
+	}
+	oldDesc := fmt.Sprintf("%d bytes", len(existing))
+	oldPixels := 0
+	if cfg, _, err := stdimage.DecodeConfig(bytes.NewReader(existing)); err == nil {
+		oldPixels = cfg.Width * cfg.Height
+		oldDesc = fmt.Sprintf("%dx%d", cfg.Width, cfg.Height)
+	}
+	if overwrite {
+		return true, oldDesc
+	}
+
+	probe := probeCover(NewHTTPClientWithTimeout(coverProbeTimeout), CoverCandidate{URL: coverURL})
+	if probe.Error != "" {
+		return false, oldDesc
+	}
+	return probe.pixels() > oldPixels, oldDesc
+}
+
+// retagFile re-tags one file. coverDir returns the batch's scratch directory
+// for covers handed to FFmpeg.
+func retagFile(filePath string, opts RetagOptions, maxQualityCover bool, coverDir func() (string, error)) RetagFileResult {
+	result := RetagFileResult{Path: filePath, Changes: []RetagChange{}}
+	fail := func(err error) RetagFileResult {
+		result.Status = RetagStatusFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	current, err := readRetagMetadata(filePath)
+	if err != nil {
+		return fail(err)
+	}
+
+	updated := *current
+	var match *retagMatch
+	if opts.SearchOnline {
+		match, err = lookupRetagMatch(*current, retagFileDurationMs(filePath))
+		if err != nil {
+			GoLog("[Retag] %s: %v\n", filepath.Base(filePath), err)
+		} else {
+			result.Source = match.Source
+			var changes []RetagChange
+			updated, changes = mergeRetagMetadata(*current, match.Metadata, opts.Overwrite)
+			result.Changes = append(result.Changes, changes...)
+		}
+	}
+
+	coverURL := ""
+	if opts.Cover && match != nil && match.CoverURL != "" {
+		if improves, oldDesc := retagCoverImproves(filePath, match.CoverURL, opts.Overwrite); improves {
+			coverURL = match.CoverURL
+			result.Changes = append(result.Changes, RetagChange{Field: "cover", Old: oldDesc, New: coverURL})
+		}
+	}
+
+	lyricsLRC := ""
+	var lyricsTags map[string]string
+	if opts.Lyrics && (current.Lyrics == "" || opts.Overwrite) && updated.Title != "" && updated.Artist != "" {
+		var spotifyID string
+		var durationMs int64
+		if match != nil {
+			spotifyID, durationMs = match.SpotifyID, match.DurationMs
+		}
+		lyrics, lrc, tags, err := fetchTrackLyrics(spotifyID, updated.Title, updated.Artist, durationMs)
+		if err == nil && lrc != current.Lyrics {
+			lyricsLRC, lyricsTags = lrc, tags
+			updated.Lyrics = lrc
+			result.Changes = append(result.Changes, RetagChange{
+				Field: "lyrics",
+				Old:   retagLyricsSummary(current.Lyrics),
+				New:   fmt.Sprintf("%d lines", len(lyrics.Lines)),
+			})
+		}
+	}
+
+	if len(result.Changes) == 0 {
+		result.Status = RetagStatusUnchanged
+		return result
+	}
+	if opts.DryRun {
+		result.Status = RetagStatusWouldUpdate
+		return result
+	}
+
+	var coverData []byte
+	if coverURL != "" {
+		if coverData, err = fetchTrackCover(coverURL, maxQualityCover); err != nil {
+			GoLog("[Retag] Cover download failed for %s: %v\n", filepath.Base(filePath), err)
+		}
+	}
+
+	if !strings.HasSuffix(strings.ToLower(filePath), ".flac") {
+		result.Status = RetagStatusNeedsFFmpeg
+		result.Fields = retagFFmpegFields(updated)
+		if lyricsLRC != "" {
+			result.Fields["LYRICS"] = lyricsLRC
+			result.Fields["UNSYNCEDLYRICS"] = lyricsLRC
+		}
+		for tag, value := range lyricsTags {
+			result.Fields[tag] = value
+		}
+		if len(coverData) > 0 {
+			if dir, err := coverDir(); err == nil {
+				if tmpFile, err := os.CreateTemp(dir, "cover_*.jpg"); err == nil {
+					_, writeErr := tmpFile.Write(coverData)
+					tmpFile.Close()
+					if writeErr == nil {
+						result.CoverPath = tmpFile.Name()
+					} else {
+						os.Remove(tmpFile.Name())
+					}
+				}
+			}
+		}
+		return result
+	}
+
+	if len(coverData) > 0 {
+		err = EmbedMetadataWithCoverData(filePath, updated, coverData)
+	} else {
+		err = EmbedMetadata(filePath, updated, "")
+	}
+	if err != nil {
+		return fail(fmt.Errorf("failed to write tags: %w", err))
+	}
+	if len(lyricsTags) > 0 {
+		if err := EmbedLyricsTags(filePath, lyricsTags); err != nil {
+			GoLog("[Retag] Failed to embed secondary lyrics for %s: %v\n", filepath.Base(filePath), err)
+		}
+	}
+	result.Status = RetagStatusUpdated
+	return result
+}
+
+func retagFFmpegFields(m Metadata) map[string]string {
+	fields := map[string]string{
+		"TITLE":       m.Title,
+		"ARTIST":      m.Artist,
+		"ALBUM":       m.Album,
+		"ALBUMARTIST": m.AlbumArtist,
+		"DATE":        m.Date,
+		"ISRC":        m.ISRC,
+		"GENRE":       m.Genre,
+	}
+	if m.TrackNumber > 0 {
+		fields["TRACKNUMBER"] = strconv.Itoa(m.TrackNumber)
+	}
+	if m.DiscNumber > 0 {
+		fields["DISCNUMBER"] = strconv.Itoa(m.DiscNumber)
+	}
+	if m.Label != "" {
+		fields["ORGANIZATION"] = m.Label
+	}
+	if m.Copyright != "" {
+		fields["COPYRIGHT"] = m.Copyright
+	}
+	return fields
+}
+
+// retagFileDurationMs returns the length of the file, or 0 when it cannot be
+// read.
+func retagFileDurationMs(filePath string) int64 {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".mp3":
+		if quality, err := GetMP3Quality(filePath); err == nil {
+			return int64(quality.Duration) * 1000
+		}
+	case ".opus", ".ogg":
+		if quality, err := GetOggQuality(filePath); err == nil {
+			return int64(quality.Duration) * 1000
+		}
+	default:
+		if quality, err := GetAudioQuality(filePath); err == nil && quality.SampleRate > 0 {
+			return quality.TotalSamples * 1000 / int64(quality.SampleRate)
+		}
+	}
+	return 0
+}
+
+func retagLyricsSummary(lyrics string) string {
+	lines := 0
+	for _, line := range strings.Split(lyrics, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines++
+		}
+	}
+	if lines == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d lines", lines)
+}
+
+// RetagFiles re-tags paths one by one and emits a "retag" event after each
+// file so the app can show progress.
+func RetagFiles(paths []string, opts RetagOptions) *RetagReport {
+	maxQualityCover := GetBackendConfig().EmbedMaxQualityCover
+	report := &RetagReport{DryRun: opts.DryRun, Results: make([]RetagFileResult, 0, len(paths))}
+	scratchID := "retag_" + newTraceID(6)
+	coverDir := func() (string, error) {
+		report.ScratchID = scratchID
+		return AcquireScratchDir(scratchID)
+	}
+
+	for i, path := range paths {
+		result := retagFile(strings.TrimSpace(path), opts, maxQualityCover, coverDir)
+		switch result.Status {
+		case RetagStatusFailed:
+			report.Failed++
+			GoLog("[Retag] Failed %s: %s\n", path, result.Error)
+		case RetagStatusUnchanged:
+			report.Unchanged++
+		default:
+			report.Updated++
+		}
+		report.Results = append(report.Results, result)
+
+		emitBackendEvent("retag", map[string]interface{}{
+			"done":   i + 1,
+			"total":  len(paths),
+			"path":   result.Path,
+			"status": result.Status,
+		})
+	}
+
+	GoLog("[Retag] Done (dry_run=%v): %d updated, %d unchanged, %d failed\n",
+		opts.DryRun, report.Updated, report.Unchanged, report.Failed)
+	return report
+}
+
+func RetagFilesJSON(pathsJSON, optionsJSON string) (string, error) {
+	var paths []string
+	if err := json.Unmarshal([]byte(pathsJSON), &paths); err != nil {
+		return "", fmt.Errorf("invalid paths: %w", err)
+	}
+	var opts RetagOptions
+	if strings.TrimSpace(optionsJSON) != "" {
+		if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+			return "", fmt.Errorf("invalid retag options: %w", err)
+		}
+	}
+
+	jsonBytes, err := json.Marshal(RetagFiles(paths, opts))
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,162 @@
+package gobackend
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFLAC writes a FLAC file with a STREAMINFO block and a stub frame.
+func writeTestFLAC(t *testing.T, path string) {
+	t.Helper()
+	data := []byte("fLaC")
+	data = append(data, 0x80, 0x00, 0x00, 0x22) // last block, STREAMINFO, 34 bytes
+	streamInfo := make([]byte, 34)
+	streamInfo[0], streamInfo[1] = 0x10, 0x00 // min block size 4096
+	streamInfo[2], streamInfo[3] = 0x10, 0x00 // max block size 4096
+	// 44100 Hz, 2 channels, 16 bits per sample
+	streamInfo[10], streamInfo[11], streamInfo[12] = 0x0A, 0xC4, 0x42
+	streamInfo[13] = 0xF0
+	data = append(data, streamInfo...)
+	data = append(data, 0xFF, 0xF8, 0x69, 0x08, 0x00, 0x00) // start of an audio frame
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testFLACSpec describes a synthetic FLAC stream: a STREAMINFO block and
+// Frames frames of BlockSize samples with valid CRC-8 and CRC-16. Without
+// Subframes, frame i holds one constant subframe per channel of value i.
+type testFLACSpec struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	BlockSize     int
+	Frames        int
+	// Subframes returns frame i's channel assignment and its bit-packed,
+	// byte-aligned subframes.
+	Subframes func(i int) (assignment byte, subframes []byte)
+}
+
+var (
+	testFLACRateCodes = map[int]byte{88200: 1, 176400: 2, 192000: 3, 8000: 4, 16000: 5, 22050: 6, 24000: 7, 32000: 8, 44100: 9, 48000: 10, 96000: 11}
+	testFLACSizeCodes = map[int]byte{8: 1, 12: 2, 16: 4, 20: 5, 24: 6, 32: 7}
+)
+
+func (s testFLACSpec) bytes() []byte {
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint16(info[0:], uint16(s.BlockSize))
+	binary.BigEndian.PutUint16(info[2:], uint16(s.BlockSize))
+	binary.BigEndian.PutUint64(info[10:], uint64(s.SampleRate)<<44|uint64(s.Channels-1)<<41|uint64(s.BitsPerSample-1)<<36|uint64(s.Frames*s.BlockSize))
+
+	data := append([]byte("fLaC"), 0x80, 0, 0, 34)
+	data = append(data, info...)
+	for i := 0; i < s.Frames; i++ {
+		assignment, subframes := byte(s.Channels-1), []byte(nil)
+		if s.Subframes != nil {
+			assignment, subframes = s.Subframes(i)
+		} else {
+			var w testBitWriter
+			for ch := 0; ch < s.Channels; ch++ {
+				w.write(0, 8)
+				w.write(uint64(i), uint(s.BitsPerSample))
+			}
+			subframes = w.bytes()
+		}
+
+		// Block size code 7: the size follows the frame number.
+		header := []byte{0xFF, 0xF8, 7<<4 | testFLACRateCodes[s.SampleRate], assignment<<4 | testFLACSizeCodes[s.BitsPerSample]<<1}
+		header = append(header, encodeFLACFrameNumber(uint64(i))...)
+		header = binary.BigEndian.AppendUint16(header, uint16(s.BlockSize-1))
+		var crc8 uint8
+		for _, b := range header {
+			crc8 = flacCRC8Table[crc8^b]
+		}
+		frame := append(append(header, crc8), subframes...)
+		var crc16 uint16
+		for _, b := range frame {
+			crc16 = flacCRC16Update(crc16, b)
+		}
+		data = append(data, binary.BigEndian.AppendUint16(frame, crc16)...)
+	}
+	return data
+}
+
+func (s testFLACSpec) write(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, s.bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeRetagMetadata(t *testing.T) {
+	current := Metadata{Title: "Song", Artist: "Artist", Album: "Old Album", TrackNumber: 0}
+	found := Metadata{Title: "Song (Remastered)", Album: "New Album", TrackNumber: 4, Genre: "Rock"}
+
+	merged, changes := mergeRetagMetadata(current, found, false)
+	if merged.Title != "Song" || merged.Album != "Old Album" {
+		t.Errorf("existing values replaced without overwrite: %+v", merged)
+	}
+	if merged.TrackNumber != 4 || merged.Genre != "Rock" {
+		t.Errorf("empty values not filled: %+v", merged)
+	}
+	if len(changes) != 2 {
+		t.Errorf("changes = %+v, want track_number and genre", changes)
+	}
+
+	merged, changes = mergeRetagMetadata(current, found, true)
+	if merged.Title != "Song (Remastered)" || merged.Album != "New Album" || merged.Artist != "Artist" {
+		t.Errorf("overwrite merge = %+v", merged)
+	}
+	if len(changes) != 4 || changes[0].Field != "title" || changes[0].Old != "Song" {
+		t.Errorf("overwrite changes = %+v", changes)
+	}
+}
+
+func TestRetagFilesOffline(t *testing.T) {
+	dir := t.TempDir()
+	flacPath := filepath.Join(dir, "song.flac")
+	writeTestFLAC(t, flacPath)
+	if err := EmbedMetadata(flacPath, Metadata{Title: "Song", Artist: "Artist"}, ""); err != nil {
+		t.Fatalf("EmbedMetadata failed: %v", err)
+	}
+	before, _ := os.ReadFile(flacPath)
+
+	report := RetagFiles([]string{flacPath, filepath.Join(dir, "song.wav")}, RetagOptions{DryRun: true})
+	if report.Unchanged != 1 || report.Failed != 1 || len(report.Results) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.Results[1].Status != RetagStatusFailed || report.Results[1].Error == "" {
+		t.Errorf("unsupported file result = %+v", report.Results[1])
+	}
+
+	after, _ := os.ReadFile(flacPath)
+	if string(before) != string(after) {
+		t.Error("dry run modified the file")
+	}
+}
+
+func TestRetagCandidateMatches(t *testing.T) {
+	current := Metadata{Title: "Song", Artist: "Artist"}
+	for _, tc := range []struct {
+		name     string
+		title    string
+		artist   string
+		duration int64
+		want     bool
+	}{
+		{"same track", "Song", "Artist", 200000, true},
+		{"featured artist", "Song", "Artist, Guest", 205000, true},
+		{"unknown length", "Song", "Artist", 0, true},
+		{"other title", "Different Tune", "Artist", 200000, false},
+		{"other artist", "Song", "Somebody Else", 200000, false},
+		{"other length", "Song", "Artist", 260000, false},
+		{"live version", "Song (Live)", "Artist", 200000, false},
+	} {
+		candidate := &retagMatch{Metadata: Metadata{Title: tc.title, Artist: tc.artist}, DurationMs: tc.duration}
+		if got := retagCandidateMatches(current, 200000, candidate); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultScratchDirName = "spotiflac_scratch"
+	// scratchTempDirName holds loose temp files (cover art handed to
+	// FFmpeg); it counts as active so only a startup purge clears it.
+	scratchTempDirName = "_tmp"
+)
+
+// ScratchDirUsage reports one per-download scratch directory.
+type ScratchDirUsage struct {
+	Name      string `json:"name"`
+	Bytes     int64  `json:"bytes"`
+	Files     int    `json:"files"`
+	Active    bool   `json:"active"`
+	CreatedAt int64  `json:"created_at,omitempty"`
+}
+
+type ScratchUsage struct {
+	Root       string            `json:"root"`
+	TotalBytes int64             `json:"total_bytes"`
+	Dirs       []ScratchDirUsage `json:"dirs"`
+}
+
+var (
+	scratchMu     sync.Mutex
+	scratchRoot   string
+	scratchActive = make(map[string]time.Time)
+)
+
+func scratchRootLocked() string {
+	if scratchRoot == "" {
+		scratchRoot = filepath.Join(os.TempDir(), defaultScratchDirName)
+	}
+	return scratchRoot
+}
+
+// GetScratchRoot returns the scratch root, falling back to the OS temp dir
+// when Flutter has not set one.
+func GetScratchRoot() string {
+	scratchMu.Lock()
+	defer scratchMu.Unlock()
+	return scratchRootLocked()
+}
+
+// SetScratchRoot puts scratch space in its own directory under dir (usually
+// the app cache dir, since Android's os.TempDir is not always writable) and
+// removes leftovers of downloads that did not survive the previous run.
+// Only that subdirectory is ever purged, never dir itself.
+func SetScratchRoot(dir string) error {
+	if dir == "" {
+		return fmt.Errorf("scratch root is required")
+	}
+	root := filepath.Join(dir, defaultScratchDirName)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("failed to create scratch root: %w", err)
+	}
+
+	scratchMu.Lock()
+	scratchRoot = root
+	delete(scratchActive, scratchTempDirName)
+	scratchMu.Unlock()
+
+	removed := PurgeScratch()
+	GoLog("[Scratch] Root set to %s (removed %d stale entries)\n", root, removed)
+	return nil
+}
+
+func scratchDirName(itemID string) string {
+	if itemID == "" {
+		return fmt.Sprintf("anon_%d", time.Now().UnixNano())
+	}
+	return sanitizeFilename(itemID)
+}
+
+// AcquireScratchDir returns a private directory for one download. Calling it
+// again for the same item returns the same directory.
+func AcquireScratchDir(itemID string) (string, error) {
+	scratchMu.Lock()
+	defer scratchMu.Unlock()
+
+	name := scratchDirName(itemID)
+	dir := filepath.Join(scratchRootLocked(), name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create scratch dir: %w", err)
+	}
+	if _, ok := scratchActive[name]; !ok {
+		scratchActive[name] = time.Now()
+	}
+	return dir, nil
+}
+
+// ReleaseScratchDir deletes the item's scratch directory. Download entry
+// points defer it, so scratch space is reclaimed on success and failure.
+func ReleaseScratchDir(itemID string) {
+	if itemID == "" {
+		return
+	}
+	releaseScratchName(scratchDirName(itemID))
+}
+
+// releaseScratchPath deletes a directory returned by AcquireScratchDir. It
+// is the only handle on the anon_ directory of a download without an item ID.
+func releaseScratchPath(dir string) {
+	releaseScratchName(filepath.Base(dir))
+}
+
+func releaseScratchName(name string) {
+	scratchMu.Lock()
+	_, active := scratchActive[name]
+	delete(scratchActive, name)
+	dir := filepath.Join(scratchRootLocked(), name)
+	scratchMu.Unlock()
+
+	if !active {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		GoLog("[Scratch] Failed to remove %s: %v\n", dir, err)
+	}
+}
+
+// createScratchTemp is os.CreateTemp inside the scratch root, so stray temp
+// files are reclaimed with the rest of scratch space.
+func createScratchTemp(pattern string) (*os.File, error) {
+	scratchMu.Lock()
+	dir := filepath.Join(scratchRootLocked(), scratchTempDirName)
+	if _, ok := scratchActive[scratchTempDirName]; !ok {
+		scratchActive[scratchTempDirName] = time.Now()
+	}
+	scratchMu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create scratch dir: %w", err)
+	}
+	return os.CreateTemp(dir, pattern)
+}
+
+// PurgeScratch removes every entry under the root that no running download
+// owns and returns how many were removed.
+func PurgeScratch() int {
+	scratchMu.Lock()
+	root := scratchRootLocked()
+	active := make(map[string]bool, len(scratchActive))
+	for name := range scratchActive {
+		active[name] = true
+	}
+	scratchMu.Unlock()
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, entry := range entries {
+		if active[entry.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+			GoLog("[Scratch] Failed to purge %s: %v\n", entry.Name(), err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+func measureScratchDir(path string) (int64, int) {
+	var size int64
+	files := 0
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files
+}
+
+func GetScratchUsage() ScratchUsage {
+	scratchMu.Lock()
+	root := scratchRootLocked()
+	active := make(map[string]time.Time, len(scratchActive))
+	for name, created := range scratchActive {
+		active[name] = created
+	}
+	scratchMu.Unlock()
+
+	usage := ScratchUsage{Root: root, Dirs: []ScratchDirUsage{}}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return usage
+	}
+	for _, entry := range entries {
+		dir := ScratchDirUsage{Name: entry.Name()}
+		if entry.IsDir() {
+			dir.Bytes, dir.Files = measureScratchDir(filepath.Join(root, entry.Name()))
+		} else if info, err := entry.Info(); err == nil {
+			dir.Bytes, dir.Files = info.Size(), 1
+		}
+		if created, ok := active[entry.Name()]; ok {
+			dir.Active = true
+			dir.CreatedAt = created.Unix()
+		}
+		usage.TotalBytes += dir.Bytes
+		usage.Dirs = append(usage.Dirs, dir)
+	}
+	sort.Slice(usage.Dirs, func(i, j int) bool { return usage.Dirs[i].Bytes > usage.Dirs[j].Bytes })
+	return usage
+}
+
+func GetScratchUsageJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetScratchUsage())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,71 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScratchLifecycle(t *testing.T) {
+	cache := t.TempDir()
+	root := filepath.Join(cache, defaultScratchDirName)
+	stale := filepath.Join(root, "left-over")
+	os.MkdirAll(stale, 0755)
+	os.WriteFile(filepath.Join(stale, "part.bin"), []byte("xx"), 0644)
+	// Other files in the cache dir are not ours to purge.
+	unrelated := filepath.Join(cache, "image_cache")
+	os.MkdirAll(unrelated, 0755)
+
+	if err := SetScratchRoot(cache); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatal("expected stale scratch dir to be purged on startup")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Fatal("purge removed a directory outside the scratch root")
+	}
+	if GetScratchRoot() != root {
+		t.Fatalf("root = %s", GetScratchRoot())
+	}
+
+	dir, err := AcquireScratchDir("item/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "chunk"), make([]byte, 100), 0644)
+
+	if removed := PurgeScratch(); removed != 0 {
+		t.Fatalf("purge must keep active dirs, removed %d", removed)
+	}
+	usage := GetScratchUsage()
+	if usage.TotalBytes != 100 || len(usage.Dirs) != 1 || !usage.Dirs[0].Active {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+
+	ReleaseScratchDir("item/1")
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatal("expected scratch dir to be removed on release")
+	}
+
+	anon, err := AcquireScratchDir("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseScratchPath(anon)
+	if _, err := os.Stat(anon); !os.IsNotExist(err) {
+		t.Fatal("expected anonymous scratch dir to be removed on release")
+	}
+
+	tmp, err := createScratchTemp("cover_*.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+	if filepath.Dir(filepath.Dir(tmp.Name())) != root {
+		t.Fatalf("temp file %s is outside the scratch root", tmp.Name())
+	}
+	if removed := PurgeScratch(); removed != 0 {
+		t.Fatalf("purge removed %d entries while a temp file was handed out", removed)
+	}
+}
@@ -18,6 +18,49 @@ func TestSanitizeSensitiveLogText(t *testing.T) {
 	}
 }
 
+func TestSanitizeSensitiveLogTextCoversOAuthAndSignedURLs(t *testing.T) {
+	inputs := []string{
+		"https://auth.example.com/authorize?client_id=app&code_challenge=CHALLENGE1&state=STATE1",
+		"https://app.example.com/callback?code=AUTHCODE1",
+		`token response {"access_token":"JSONTOKEN1","token_type":"bearer"}`,
+		"Cookie: session=COOKIE1; other=COOKIE2",
+		"code_verifier=VERIFIER1",
+		"https://cdn.example.com/a.flac?X-Amz-Signature=SIG1&Expires=1",
+	}
+	for _, input := range inputs {
+		redacted := sanitizeSensitiveLogText(input)
+		for _, secret := range []string{"CHALLENGE1", "STATE1", "AUTHCODE1", "JSONTOKEN1", "COOKIE1", "COOKIE2", "VERIFIER1", "SIG1"} {
+			if strings.Contains(redacted, secret) {
+				t.Errorf("%s leaked in %q", secret, redacted)
+			}
+		}
+	}
+	if got := sanitizeSensitiveLogText("https://auth.example.com/authorize?client_id=app"); !strings.Contains(got, "client_id=app") {
+		t.Errorf("non-secret params should be kept, got %q", got)
+	}
+}
+
+func TestExtensionAuthStateWipe(t *testing.T) {
+	state := &ExtensionAuthState{
+		AccessToken:     "access",
+		RefreshToken:    "refresh",
+		PKCEVerifier:    "verifier",
+		IsAuthenticated: true,
+	}
+	state.wipe()
+	if *state != (ExtensionAuthState{}) {
+		t.Fatalf("expected wiped state, got %+v", state)
+	}
+
+	buf := []byte("secret")
+	zeroBytes(buf)
+	for _, b := range buf {
+		if b != 0 {
+			t.Fatalf("expected zeroed buffer, got %q", buf)
+		}
+	}
+}
+
 func TestValidateExtensionAuthURL(t *testing.T) {
 	if err := validateExtensionAuthURL("https://accounts.example.com/oauth/authorize"); err != nil {
 		t.Fatalf("expected valid auth URL, got error: %v", err)
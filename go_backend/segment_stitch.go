@@ -0,0 +1,365 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ==================== HLS audio stitching ====================
+//
+// SoundCloud-style HLS serves plain MP3 or Ogg Opus segments. Joined byte
+// for byte they play, but players get the duration wrong: the MP3 has no
+// Xing/Info frame counting its frames, and each Opus segment may be a
+// whole Ogg stream with its own headers, page numbers and end-of-stream
+// flag. The stitchers write one clean file instead:
+//
+//	MP3  -> ID3 tags and per-segment Xing/VBRI frames dropped, one
+//	        Info (CBR) or Xing (VBR) frame with the totals in front
+//	Opus -> repeated OpusHead/OpusTags pages dropped, every page moved
+//	        into the first stream with continuous sequence numbers and
+//	        granule positions, EOS only on the last page
+
+type segmentStitcher interface {
+	write(segment []byte) error
+	finish() error
+}
+
+type passthroughStitcher struct {
+	w io.Writer
+}
+
+func (s passthroughStitcher) write(segment []byte) error {
+	_, err := s.w.Write(segment)
+	return err
+}
+
+func (passthroughStitcher) finish() error { return nil }
+
+// newSegmentStitcher writes through w; out is the same file, used by the
+// MP3 stitcher to fill in its header at the end.
+func newSegmentStitcher(container string, out *os.File, w *countingWriter) segmentStitcher {
+	switch container {
+	case StreamContainerMP3:
+		return &mp3Stitcher{out: out, w: w}
+	case StreamContainerOpus:
+		return &oggStitcher{w: w}
+	}
+	return passthroughStitcher{w: w}
+}
+
+// sniffAudioSegmentContainer recognises MP3 and Ogg segments served under
+// a generic name; "" means keep the playlist's guess.
+func sniffAudioSegmentContainer(data []byte) string {
+	if bytes.HasPrefix(data, []byte("OggS")) {
+		return StreamContainerOpus
+	}
+	data = stripID3Header(data)
+	h, ok := parseMP3FrameHeader(data)
+	if !ok || h.length > len(data) {
+		return ""
+	}
+	// One valid-looking header can be chance; require the next one too.
+	if len(data) > h.length {
+		if _, ok := parseMP3FrameHeader(data[h.length:]); !ok {
+			return ""
+		}
+	}
+	return StreamContainerMP3
+}
+
+// ---------- MP3 ----------
+
+// mp3FrameHeader is a parsed MPEG audio Layer III frame header.
+type mp3FrameHeader struct {
+	raw          uint32
+	mpeg1        bool
+	bitrateIndex int
+	sampleRate   int
+	mono         bool
+	length       int
+}
+
+// mp3LayerIIIFrameLength is mp3FrameLength for a header being built.
+func mp3LayerIIIFrameLength(mpeg1 bool, bitrateIndex, sampleRate int, padding bool) int {
+	kbps := mp3BitratesV2L3[bitrateIndex]
+	coeff := 72
+	if mpeg1 {
+		kbps = mp3BitratesV1L3[bitrateIndex]
+		coeff = 144
+	}
+	length := coeff * kbps * 1000 / sampleRate
+	if padding {
+		length++
+	}
+	return length
+}
+
+func parseMP3FrameHeader(b []byte) (mp3FrameHeader, bool) {
+	if len(b) < 4 {
+		return mp3FrameHeader{}, false
+	}
+	raw := binary.BigEndian.Uint32(b)
+	// Only Layer III; this also keeps ADTS (layer 0) out.
+	length := mp3FrameLength(b)
+	if length == 0 || raw>>17&3 != 1 {
+		return mp3FrameHeader{}, false
+	}
+	version := raw >> 19 & 3
+	return mp3FrameHeader{
+		raw:          raw,
+		mpeg1:        version == 3,
+		bitrateIndex: int(raw >> 12 & 0xf),
+		sampleRate:   mp3SampleRates[version][raw>>10&3],
+		mono:         raw>>6&3 == 3,
+		length:       length,
+	}, true
+}
+
+// sideInfoSize is where a Xing/Info tag starts after the 4-byte header.
+func (h mp3FrameHeader) sideInfoSize() int {
+	switch {
+	case h.mpeg1 && h.mono:
+		return 17
+	case h.mpeg1:
+		return 32
+	case h.mono:
+		return 9
+	}
+	return 17
+}
+
+func isMP3InfoFrame(frame []byte, h mp3FrameHeader) bool {
+	if off := 4 + h.sideInfoSize(); len(frame) >= off+4 {
+		if tag := string(frame[off : off+4]); tag == "Xing" || tag == "Info" {
+			return true
+		}
+	}
+	return len(frame) >= 40 && string(frame[36:40]) == "VBRI"
+}
+
+// buildMP3InfoFrame returns a silent frame shaped like h carrying an
+// Info/Xing tag with frame and byte counts. Its size does not depend on
+// the counts, so a placeholder can be overwritten in place.
+func buildMP3InfoFrame(h mp3FrameHeader, frames int, totalBytes int64, vbr bool) []byte {
+	off := 4 + h.sideInfoSize()
+	bitrateIndex := h.bitrateIndex
+	for bitrateIndex < 14 && mp3LayerIIIFrameLength(h.mpeg1, bitrateIndex, h.sampleRate, false) < off+16 {
+		bitrateIndex++
+	}
+	raw := h.raw | 1<<16 // no CRC
+	raw &^= 1<<9 | 0xf<<12
+	raw |= uint32(bitrateIndex) << 12
+
+	frame := make([]byte, mp3LayerIIIFrameLength(h.mpeg1, bitrateIndex, h.sampleRate, false))
+	binary.BigEndian.PutUint32(frame, raw)
+	tag := "Info"
+	if vbr {
+		tag = "Xing"
+	}
+	copy(frame[off:], tag)
+	binary.BigEndian.PutUint32(frame[off+4:], 0x3) // frames and bytes present
+	binary.BigEndian.PutUint32(frame[off+8:], uint32(frames))
+	binary.BigEndian.PutUint32(frame[off+12:], uint32(totalBytes))
+	return frame
+}
+
+type mp3Stitcher struct {
+	out      *os.File
+	w        *countingWriter
+	first    *mp3FrameHeader
+	headerAt int64
+	header   int
+	frames   int
+	vbr      bool
+	lostSync bool
+}
+
+func (s *mp3Stitcher) write(segment []byte) error {
+	segment = stripID3Header(segment)
+	var buf bytes.Buffer
+	pos := 0
+	for pos < len(segment) {
+		h, ok := parseMP3FrameHeader(segment[pos:])
+		if !ok || pos+h.length > len(segment) {
+			break
+		}
+		frame := segment[pos : pos+h.length]
+		pos += h.length
+		if isMP3InfoFrame(frame, h) {
+			continue
+		}
+		if s.first == nil {
+			s.first = &h
+			s.headerAt = s.w.n
+			placeholder := buildMP3InfoFrame(h, 0, 0, false)
+			s.header = len(placeholder)
+			if _, err := s.w.Write(placeholder); err != nil {
+				return err
+			}
+		} else if h.bitrateIndex != s.first.bitrateIndex {
+			s.vbr = true
+		}
+		s.frames++
+		buf.Write(frame)
+	}
+	if rest := segment[pos:]; len(rest) > 0 && !isTrailingMP3Tag(rest) {
+		// Keep what could not be parsed, but do not trust the counts.
+		s.lostSync = true
+		buf.Write(rest)
+	}
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+func (s *mp3Stitcher) finish() error {
+	if s.first == nil {
+		return nil
+	}
+	if s.lostSync {
+		GoLog("[Stream] MP3 segments lost frame sync; leaving the duration header empty\n")
+		return nil
+	}
+	frame := buildMP3InfoFrame(*s.first, s.frames, s.w.n-s.headerAt, s.vbr)
+	if _, err := s.out.WriteAt(frame, s.headerAt); err != nil {
+		// Non-seekable outputs (pipes) keep the empty placeholder.
+		GoLog("[Stream] Could not write MP3 duration header: %v\n", err)
+	}
+	return nil
+}
+
+// ---------- Ogg Opus ----------
+
+const (
+	oggFlagContinued = 0x01
+	oggFlagBOS       = 0x02
+	oggFlagEOS       = 0x04
+	oggHeaderSize    = 27
+)
+
+func oggChecksum(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// splitOggPages cuts data into whole pages.
+func splitOggPages(data []byte) ([][]byte, error) {
+	var pages [][]byte
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < oggHeaderSize || string(data[pos:pos+4]) != "OggS" {
+			return nil, fmt.Errorf("invalid Ogg page at offset %d", pos)
+		}
+		segments := int(data[pos+26])
+		if len(data)-pos < oggHeaderSize+segments {
+			return nil, fmt.Errorf("truncated Ogg page at offset %d", pos)
+		}
+		size := oggHeaderSize + segments
+		for _, lace := range data[pos+oggHeaderSize : pos+oggHeaderSize+segments] {
+			size += int(lace)
+		}
+		if pos+size > len(data) {
+			return nil, fmt.Errorf("truncated Ogg page at offset %d", pos)
+		}
+		pages = append(pages, data[pos:pos+size])
+		pos += size
+	}
+	return pages, nil
+}
+
+func oggPageBody(page []byte) []byte {
+	return page[oggHeaderSize+int(page[26]):]
+}
+
+// oggPacketOpen reports whether the page's last packet continues on the
+// next page.
+func oggPacketOpen(page []byte) bool {
+	segments := int(page[26])
+	return segments > 0 && page[oggHeaderSize+segments-1] == 255
+}
+
+type oggStitcher struct {
+	w             *countingWriter
+	started       bool
+	serial        uint32
+	sequence      uint32
+	granuleOffset int64
+	lastGranule   int64
+	restarted     bool
+	droppingTags  bool
+	pending       []byte
+}
+
+func (s *oggStitcher) write(segment []byte) error {
+	pages, err := splitOggPages(segment)
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		flags := page[5]
+		body := oggPageBody(page)
+		if !s.started {
+			s.started = true
+			s.serial = binary.LittleEndian.Uint32(page[14:])
+		} else {
+			// A later segment that restarts the stream repeats its headers.
+			switch {
+			case flags&oggFlagBOS != 0:
+				s.restarted = true
+				continue
+			case bytes.HasPrefix(body, []byte("OpusTags")) && s.restarted:
+				s.droppingTags = oggPacketOpen(page)
+				continue
+			case s.droppingTags && flags&oggFlagContinued != 0:
+				s.droppingTags = oggPacketOpen(page)
+				continue
+			}
+		}
+		s.droppingTags = false
+
+		if granule := int64(binary.LittleEndian.Uint64(page[6:])); granule != -1 {
+			if s.restarted {
+				// The new stream counts from zero again.
+				s.granuleOffset = s.lastGranule
+				s.restarted = false
+			}
+			s.lastGranule = granule + s.granuleOffset
+		}
+		if err := s.flush(false); err != nil {
+			return err
+		}
+		s.pending = append([]byte(nil), page...)
+		if granule := int64(binary.LittleEndian.Uint64(page[6:])); granule != -1 {
+			binary.LittleEndian.PutUint64(s.pending[6:], uint64(s.lastGranule))
+		}
+	}
+	return nil
+}
+
+// flush writes the held-back page into the first stream.
+func (s *oggStitcher) flush(last bool) error {
+	if s.pending == nil {
+		return nil
+	}
+	page := s.pending
+	s.pending = nil
+	page[5] &^= oggFlagEOS
+	if last {
+		page[5] |= oggFlagEOS
+	}
+	binary.LittleEndian.PutUint32(page[14:], s.serial)
+	binary.LittleEndian.PutUint32(page[18:], s.sequence)
+	s.sequence++
+	binary.LittleEndian.PutUint32(page[22:], 0)
+	binary.LittleEndian.PutUint32(page[22:], oggChecksum(page))
+	_, err := s.w.Write(page)
+	return err
+}
+
+func (s *oggStitcher) finish() error {
+	return s.flush(true)
+}
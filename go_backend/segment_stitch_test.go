@@ -0,0 +1,138 @@
+package gobackend
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// serveSegments serves a media playlist over the given segments.
+func serveSegments(t *testing.T, ext string, segments [][]byte) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	playlist := "#EXTM3U\n"
+	for i, seg := range segments {
+		name := fmt.Sprintf("seg%d.%s", i, ext)
+		playlist += "#EXTINF:2.0,\n" + name + "\n"
+		mux.HandleFunc("/"+name, func(w http.ResponseWriter, r *http.Request) { w.Write(seg) })
+	}
+	mux.HandleFunc("/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, playlist+"#EXT-X-ENDLIST\n")
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testMP3Frames(n int) []byte {
+	// MPEG-1 Layer III, 128 kbps, 44.1 kHz, stereo, no CRC: 417 bytes.
+	frame := append([]byte{0xff, 0xfb, 0x90, 0x00}, bytes.Repeat([]byte{0x55}, 413)...)
+	return bytes.Repeat(frame, n)
+}
+
+func TestDownloadManifestStream_StitchesMP3(t *testing.T) {
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x0a"), make([]byte, 10)...)
+	segments := [][]byte{
+		append(append([]byte(nil), id3...), testMP3Frames(3)...),
+		append(append([]byte(nil), id3...), testMP3Frames(2)...),
+	}
+	server := serveSegments(t, "ts", segments)
+
+	outPath := filepath.Join(t.TempDir(), "out.mp3")
+	result, err := downloadManifestStream(context.Background(), http.DefaultClient, StreamDownloadOptions{
+		ManifestURL: server.URL + "/index.m3u8",
+		OutputPath:  outPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Container != StreamContainerMP3 {
+		t.Fatalf("container = %q, want mp3", result.Container)
+	}
+	got, _ := os.ReadFile(outPath)
+	if int64(len(got)) != result.Bytes || len(got) != 6*417 {
+		t.Fatalf("output is %d bytes (reported %d), want %d", len(got), result.Bytes, 6*417)
+	}
+	if !bytes.Equal(got[417:], testMP3Frames(5)) {
+		t.Fatal("audio frames were not copied verbatim")
+	}
+	info := got[4+32:]
+	if string(info[:4]) != "Info" || binary.BigEndian.Uint32(info[8:]) != 5 || binary.BigEndian.Uint32(info[12:]) != uint32(len(got)) {
+		t.Fatalf("unexpected Info header % x", info[:16])
+	}
+}
+
+func testOggPage(flags byte, granule int64, seq uint32, body []byte) []byte {
+	page := []byte("OggS\x00")
+	page = append(page, flags)
+	page = binary.LittleEndian.AppendUint64(page, uint64(granule))
+	page = binary.LittleEndian.AppendUint32(page, 0x1234)
+	page = binary.LittleEndian.AppendUint32(page, seq)
+	page = append(page, 0, 0, 0, 0, 1, byte(len(body)))
+	page = append(page, body...)
+	binary.LittleEndian.PutUint32(page[22:], oggChecksum(page))
+	return page
+}
+
+func testOggStream(audioPages int) []byte {
+	stream := append(testOggPage(oggFlagBOS, 0, 0, []byte("OpusHead\x01\x02\x38\x01")), testOggPage(0, 0, 1, []byte("OpusTags"))...)
+	for i := 1; i <= audioPages; i++ {
+		var flags byte
+		if i == audioPages {
+			flags = oggFlagEOS
+		}
+		stream = append(stream, testOggPage(flags, int64(960*i), uint32(1+i), []byte("audio"))...)
+	}
+	return stream
+}
+
+func TestDownloadManifestStream_StitchesOpus(t *testing.T) {
+	server := serveSegments(t, "opus", [][]byte{testOggStream(2), testOggStream(3)})
+
+	outPath := filepath.Join(t.TempDir(), "out.opus")
+	result, err := downloadManifestStream(context.Background(), http.DefaultClient, StreamDownloadOptions{
+		ManifestURL: server.URL + "/index.m3u8",
+		OutputPath:  outPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(outPath)
+	pages, err := splitOggPages(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Container != StreamContainerOpus || len(pages) != 7 {
+		t.Fatalf("container %q with %d pages, want opus with 7", result.Container, len(pages))
+	}
+	for i, page := range pages {
+		if seq := binary.LittleEndian.Uint32(page[18:]); seq != uint32(i) {
+			t.Errorf("page %d has sequence %d", i, seq)
+		}
+		if eos := page[5]&oggFlagEOS != 0; eos != (i == len(pages)-1) {
+			t.Errorf("page %d EOS = %v", i, eos)
+		}
+		crc := binary.LittleEndian.Uint32(page[22:])
+		check := append([]byte(nil), page...)
+		binary.LittleEndian.PutUint32(check[22:], 0)
+		if crc != oggChecksum(check) {
+			t.Errorf("page %d has a stale checksum", i)
+		}
+	}
+	if granule := binary.LittleEndian.Uint64(pages[6][6:]); granule != 960*5 {
+		t.Errorf("final granule = %d, want %d", granule, 960*5)
+	}
+}
+
+func TestOggChecksum(t *testing.T) {
+	// CRC-32 with polynomial 0x04c11db7, zero init, no reflection or xor.
+	if got := oggChecksum([]byte("123456789")); got != 0x89a1897f {
+		t.Fatalf("oggChecksum = %#x", got)
+	}
+}
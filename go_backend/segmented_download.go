@@ -0,0 +1,392 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultSegmentCount     = 4
+	maxSegmentCount         = 16
+	defaultSegmentChunkSize = 2 * 1024 * 1024
+	defaultSegmentMinSize   = 16 * 1024 * 1024
+)
+
+// errSegmentedUnsupported means the server does not honour Range requests
+// (or the file is too small to be worth splitting). Callers should fall back
+// to a regular single-connection download.
+var errSegmentedUnsupported = errors.New("segmented download not supported")
+
+type SegmentedDownloadOptions struct {
+	Enabled  bool            `json:"enabled"`
+	Segments int             `json:"segments"`
+	MinSize  int64           `json:"min_size"`
+	Hosts    map[string]bool `json:"hosts"`
+}
+
+var (
+	segmentedOptionsMu sync.RWMutex
+	segmentedOptions   = SegmentedDownloadOptions{
+		Segments: defaultSegmentCount,
+		MinSize:  defaultSegmentMinSize,
+		Hosts:    make(map[string]bool),
+	}
+)
+
+func SetSegmentedDownloadOptions(opts SegmentedDownloadOptions) {
+	if opts.Segments <= 0 {
+		opts.Segments = defaultSegmentCount
+	}
+	if opts.Segments > maxSegmentCount {
+		opts.Segments = maxSegmentCount
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = defaultSegmentMinSize
+	}
+	hosts := make(map[string]bool, len(opts.Hosts))
+	for host, enabled := range opts.Hosts {
+		hosts[strings.ToLower(strings.TrimSpace(host))] = enabled
+	}
+	opts.Hosts = hosts
+
+	segmentedOptionsMu.Lock()
+	segmentedOptions = opts
+	segmentedOptionsMu.Unlock()
+
+	GoLog("[Segmented] Options updated: enabled=%v segments=%d min_size=%d hosts=%d\n",
+		opts.Enabled, opts.Segments, opts.MinSize, len(hosts))
+}
+
+func GetSegmentedDownloadOptions() SegmentedDownloadOptions {
+	segmentedOptionsMu.RLock()
+	defer segmentedOptionsMu.RUnlock()
+
+	opts := segmentedOptions
+	opts.Hosts = make(map[string]bool, len(segmentedOptions.Hosts))
+	for host, enabled := range segmentedOptions.Hosts {
+		opts.Hosts[host] = enabled
+	}
+	return opts
+}
+
+// isSegmentedHostEnabled applies the per-host toggle. A host entry (exact or
+// "*.example.com" wildcard) of false always wins; true enables it.
+func isSegmentedHostEnabled(opts SegmentedDownloadOptions, host string) bool {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" {
+		return false
+	}
+	if enabled, ok := opts.Hosts[host]; ok {
+		return enabled
+	}
+	for pattern, enabled := range opts.Hosts {
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return enabled
+		}
+	}
+	return false
+}
+
+func shouldUseSegmentedDownload(downloadURL string) (SegmentedDownloadOptions, bool) {
+	opts := GetSegmentedDownloadOptions()
+	if !opts.Enabled {
+		return opts, false
+	}
+	parsed, err := url.Parse(downloadURL)
+	if err != nil {
+		return opts, false
+	}
+	return opts, isSegmentedHostEnabled(opts, parsed.Hostname())
+}
+
+type segmentChunk struct {
+	index int
+	data  []byte
+	err   error
+}
+
+// probeRangeSupport issues a one-byte Range request and returns the total size
+// reported by Content-Range.
+func probeRangeSupport(ctx context.Context, client *http.Client, downloadURL string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := DoRequestWithUserAgent(client, req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, errSegmentedUnsupported
+	}
+
+	total := parseContentRangeTotal(resp.Header.Get("Content-Range"))
+	if total <= 0 {
+		return 0, errSegmentedUnsupported
+	}
+	return total, nil
+}
+
+// parseContentRangeTotal extracts the total from "bytes 0-0/12345".
+func parseContentRangeTotal(header string) int64 {
+	slash := strings.LastIndex(header, "/")
+	if slash < 0 || slash == len(header)-1 {
+		return -1
+	}
+	total, err := strconv.ParseInt(strings.TrimSpace(header[slash+1:]), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
+
+func fetchSegment(ctx context.Context, client *http.Client, downloadURL string, start, end int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := DoRequestWithUserAgent(client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("segment %d-%d: unexpected HTTP %d", start, end, resp.StatusCode)
+	}
+
+	expected := end - start + 1
+	data := make([]byte, expected)
+	n, err := io.ReadFull(resp.Body, data)
+	if err != nil {
+		return nil, fmt.Errorf("segment %d-%d: read %d of %d bytes: %w", start, end, n, expected, err)
+	}
+	return data, nil
+}
+
+// segmentedDownloadSize probes downloadURL and returns its size, or
+// errSegmentedUnsupported when it cannot or should not be split.
+func segmentedDownloadSize(ctx context.Context, client *http.Client, downloadURL string, opts SegmentedDownloadOptions) (int64, error) {
+	total, err := probeRangeSupport(ctx, client, downloadURL)
+	if err != nil {
+		return 0, err
+	}
+	if total < opts.MinSize {
+		return 0, errSegmentedUnsupported
+	}
+	return total, nil
+}
+
+// downloadSegmented fetches the total bytes of downloadURL with up to
+// opts.Segments parallel Range requests and writes chunks to out strictly in
+// order. Only a bounded number of chunks is held in memory at once, and every
+// chunk is length-checked.
+func downloadSegmented(ctx context.Context, client *http.Client, downloadURL string, total int64, out io.Writer, itemID string, opts SegmentedDownloadOptions) (int64, error) {
+	chunkSize := int64(defaultSegmentChunkSize)
+	chunkCount := int((total + chunkSize - 1) / chunkSize)
+	workers := opts.Segments
+	if workers > chunkCount {
+		workers = chunkCount
+	}
+
+	GoLog("[Segmented] Downloading %d bytes in %d chunks over %d connections\n", total, chunkCount, workers)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	results := make(chan segmentChunk, workers)
+	// window bounds how far ahead of the writer the workers may run.
+	window := make(chan struct{}, workers*2)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				start := int64(idx) * chunkSize
+				end := min(start+chunkSize, total) - 1
+
+				var data []byte
+				var fetchErr error
+				for attempt := 0; attempt <= DefaultMaxRetries; attempt++ {
+					data, fetchErr = fetchSegment(ctx, client, downloadURL, start, end)
+					if fetchErr == nil || ctx.Err() != nil {
+						break
+					}
+					GoLog("[Segmented] Chunk %d failed (attempt %d/%d): %v\n", idx, attempt+1, DefaultMaxRetries+1, fetchErr)
+				}
+
+				select {
+				case results <- segmentChunk{index: idx, data: data, err: fetchErr}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for idx := 0; idx < chunkCount; idx++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- idx:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	dest := out
+	if itemID != "" {
+		dest = NewItemProgressWriter(dest, itemID)
+	}
+
+	written, err := flushSegmentsInOrder(results, window, chunkCount, dest)
+	if err != nil {
+		cancel()
+		return written, err
+	}
+	if written != total {
+		return written, fmt.Errorf("incomplete segmented download: expected %d bytes, got %d bytes", total, written)
+	}
+	return written, nil
+}
+
+func flushSegmentsInOrder(results <-chan segmentChunk, window <-chan struct{}, chunkCount int, dest io.Writer) (int64, error) {
+	pending := make(map[int][]byte)
+	next := 0
+	var written int64
+
+	for chunk := range results {
+		if chunk.err != nil {
+			return written, chunk.err
+		}
+		pending[chunk.index] = chunk.data
+
+		for {
+			data, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			n, err := dest.Write(data)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			<-window
+			next++
+		}
+	}
+
+	if next != chunkCount {
+		return written, fmt.Errorf("segmented download stopped after %d of %d chunks", next, chunkCount)
+	}
+	return written, nil
+}
+
+// tryDownloadSegmented runs a segmented download into outputPath/outputFD when
+// the host is enabled. handled is false when the caller should continue with
+// its regular single-stream download. The output goes through the same
+// preallocation, mirror, hashing and close steps as the single-stream path.
+func tryDownloadSegmented(ctx context.Context, client *http.Client, downloadURL, outputPath string, outputFD int, itemID string) (handled bool, err error) {
+	opts, ok := shouldUseSegmentedDownload(downloadURL)
+	if !ok {
+		return false, nil
+	}
+
+	total, err := segmentedDownloadSize(ctx, client, downloadURL, opts)
+	if errors.Is(err, errSegmentedUnsupported) {
+		GoLog("[Segmented] Range not supported for %s, using single connection\n", extractDomain(downloadURL))
+		return false, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	if itemID != "" {
+		SetItemBytesTotal(itemID, total)
+	}
+
+	out, err := openOutputForWrite(outputPath, outputFD)
+	if err != nil {
+		return true, err
+	}
+	if err := preallocateOutput(out, total); err != nil {
+		out.Close()
+		cleanupOutputOnError(outputPath, outputFD)
+		return true, err
+	}
+
+	mirror := openOutputMirror(itemID)
+	bufWriter := acquireCopyWriter(hashedOutput(mirror.tee(out), itemID))
+	defer releaseCopyWriter(bufWriter)
+	written, err := downloadSegmented(ctx, client, downloadURL, total, bufWriter, itemID, opts)
+
+	flushErr := bufWriter.Flush()
+	closeErr := closeOutput(out)
+	mirror.close()
+
+	if err != nil {
+		cleanupOutputOnError(outputPath, outputFD)
+		if isDownloadCancelled(itemID) {
+			return true, ErrDownloadCancelled
+		}
+		return true, err
+	}
+	if flushErr != nil {
+		cleanupOutputOnError(outputPath, outputFD)
+		return true, fmt.Errorf("failed to flush buffer: %w", flushErr)
+	}
+	if closeErr != nil {
+		cleanupOutputOnError(outputPath, outputFD)
+		return true, fmt.Errorf("failed to close file: %w", closeErr)
+	}
+	sealDownloadHash(itemID, outputPath, outputFD)
+
+	GoLog("[Segmented] Downloaded %d bytes\n", written)
+	return true, nil
+}
+
+func SetSegmentedDownloadOptionsJSON(optionsJSON string) error {
+	var opts SegmentedDownloadOptions
+	if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+		return fmt.Errorf("invalid segmented download options: %w", err)
+	}
+	SetSegmentedDownloadOptions(opts)
+	return nil
+}
+
+func GetSegmentedDownloadOptionsJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetSegmentedDownloadOptions())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,100 @@
+package gobackend
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadSegmented_InOrder(t *testing.T) {
+	payload := make([]byte, 5*defaultSegmentChunkSize+1234)
+	for i := range payload {
+		payload[i] = byte(i * 31)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "track.flac", time.Time{}, bytes.NewReader(payload))
+	}))
+	defer server.Close()
+
+	opts := SegmentedDownloadOptions{Enabled: true, Segments: 3, MinSize: 1}
+	total, err := segmentedDownloadSize(context.Background(), server.Client(), server.URL, opts)
+	if err != nil || total != int64(len(payload)) {
+		t.Fatalf("size = %d, %v", total, err)
+	}
+	var out bytes.Buffer
+	if _, err := downloadSegmented(context.Background(), server.Client(), server.URL, total, &out, "", opts); err != nil {
+		t.Fatalf("downloadSegmented failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), payload) {
+		t.Fatal("segmented output does not match source payload")
+	}
+}
+
+func TestTryDownloadSegmented_UsesOutputHelpers(t *testing.T) {
+	payload := make([]byte, 3*defaultSegmentChunkSize+77)
+	for i := range payload {
+		payload[i] = byte(i * 7)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "track.flac", time.Time{}, bytes.NewReader(payload))
+	}))
+	defer server.Close()
+
+	original := GetSegmentedDownloadOptions()
+	defer SetSegmentedDownloadOptions(original)
+	SetSegmentedDownloadOptions(SegmentedDownloadOptions{Enabled: true, Segments: 2, MinSize: 1, Hosts: map[string]bool{"127.0.0.1": true}})
+
+	path := filepath.Join(t.TempDir(), "track.flac")
+	handled, err := tryDownloadSegmented(context.Background(), server.Client(), server.URL, path, 0, "seg-1")
+	if !handled || err != nil {
+		t.Fatalf("handled = %v, err = %v", handled, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(data, payload) {
+		t.Fatalf("output does not match payload (%v)", err)
+	}
+
+	// The hash streamed during the download is sealed for the finalize step.
+	hashes, ok := streamedDownloadHashes(DownloadRequest{ItemID: "seg-1"}, path)
+	sum := sha256.Sum256(payload)
+	if !ok || hashes.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("streamed hashes = %+v, %v", hashes, ok)
+	}
+}
+
+func TestDownloadSegmented_NoRangeSupport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("no ranges here"))
+	}))
+	defer server.Close()
+
+	opts := SegmentedDownloadOptions{Enabled: true, Segments: 2, MinSize: 1}
+	if _, err := segmentedDownloadSize(context.Background(), server.Client(), server.URL, opts); err != errSegmentedUnsupported {
+		t.Fatalf("expected errSegmentedUnsupported, got %v", err)
+	}
+}
+
+func TestIsSegmentedHostEnabled(t *testing.T) {
+	opts := SegmentedDownloadOptions{Hosts: map[string]bool{
+		"*.cdn.example.com":    true,
+		"slow.cdn.example.com": false,
+	}}
+
+	tests := map[string]bool{
+		"a.cdn.example.com":    true,
+		"slow.cdn.example.com": false,
+		"other.com":            false,
+	}
+	for host, expected := range tests {
+		if got := isSegmentedHostEnabled(opts, host); got != expected {
+			t.Errorf("isSegmentedHostEnabled(%s) = %v, expected %v", host, got, expected)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package gobackend
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encryptAES128Segment(t *testing.T, plain, key, iv []byte) []byte {
+	t.Helper()
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	padded := append(append([]byte(nil), plain...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, padded)
+	return out
+}
+
+func testTSPackets(n int, fill byte) []byte {
+	packet := append([]byte{0x47}, bytes.Repeat([]byte{fill}, tsPacketSize-1)...)
+	return bytes.Repeat(packet, n)
+}
+
+func TestDownloadManifestStream_HLSMasterWithAES128(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	segments := [][]byte{testTSPackets(3, 1), testTSPackets(1, 2), testTSPackets(2, 3)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS=\"mp4a.40.5\"\nlow/index.m3u8\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=320000,CODECS=\"mp4a.40.2\"\nhigh/index.m3u8\n")
+	})
+	mux.HandleFunc("/high/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:7\n"+
+			"#EXT-X-KEY:METHOD=AES-128,URI=\"/key.bin\"\n"+
+			"#EXTINF:4.0,\nseg0.ts\n#EXTINF:4.0,\nseg1.ts\n#EXTINF:4.0,\nseg2.ts\n#EXT-X-ENDLIST\n")
+	})
+	mux.HandleFunc("/key.bin", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(key)
+	})
+	for i, plain := range segments {
+		enc := encryptAES128Segment(t, plain, key, sequenceIV(int64(7+i)))
+		mux.HandleFunc(fmt.Sprintf("/high/seg%d.ts", i), func(w http.ResponseWriter, r *http.Request) {
+			w.Write(enc)
+		})
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	outPath := filepath.Join(t.TempDir(), "out.ts")
+	var progress []int
+	result, err := downloadManifestStream(context.Background(), server.Client(), StreamDownloadOptions{
+		ManifestURL: server.URL + "/master.m3u8",
+		OutputPath:  outPath,
+		OnSegment:   func(done, total int, written int64) { progress = append(progress, done) },
+	})
+	if err != nil {
+		t.Fatalf("downloadManifestStream failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(outPath)
+	if want := bytes.Join(segments, nil); !bytes.Equal(got, want) {
+		t.Fatalf("output is %d bytes, want the %d segment bytes in order", len(got), len(want))
+	}
+	if result.Container != StreamContainerTS || result.Segments != 3 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(progress) != 3 || progress[2] != 3 {
+		t.Errorf("unexpected progress callbacks %v", progress)
+	}
+}
+
+func TestDownloadManifestStream_WrongKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.m3u8" {
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"skd://k\",IV=0x00000000000000000000000000000001\n#EXTINF:4,\nseg.ts\n#EXT-X-ENDLIST\n")
+			return
+		}
+		w.Write(encryptAES128Segment(t, []byte("payload"), []byte("0123456789abcdef"), sequenceIV(1)))
+	}))
+	defer server.Close()
+
+	_, err := downloadManifestStream(context.Background(), server.Client(), StreamDownloadOptions{
+		ManifestURL: server.URL + "/index.m3u8",
+		OutputPath:  filepath.Join(t.TempDir(), "out.ts"),
+		Key:         []byte("fedcba9876543210"),
+	})
+	if err == nil {
+		t.Fatal("expected decryption to fail with the wrong key")
+	}
+}
+
+func TestDownloadManifestStream_RejectsBrokenSegments(t *testing.T) {
+	mp4Box := func(typ string, payload int) []byte {
+		box := binary.BigEndian.AppendUint32(nil, uint32(8+payload))
+		return append(append(box, typ...), make([]byte, payload)...)
+	}
+	adtsFrame := append([]byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x7f, 0xfc}, make([]byte, 4)...)
+
+	tests := []struct {
+		name     string
+		ext      string
+		segments [][]byte
+		wantErr  string
+	}{
+		{"ts", "ts", [][]byte{testTSPackets(2, 0)}, ""},
+		{"ts error page", "ts", [][]byte{testTSPackets(2, 0), []byte("<html>403 Forbidden</html>")}, "segment 2/2"},
+		{"ts lost sync", "ts", [][]byte{append(testTSPackets(1, 0), bytes.Repeat([]byte{0}, tsPacketSize)...)}, "lost TS sync"},
+		{"mp4", "m4s", [][]byte{append(mp4Box("ftyp", 8), mp4Box("moov", 16)...), append(mp4Box("moof", 8), mp4Box("mdat", 32)...)}, ""},
+		{"mp4 without moov", "m4s", [][]byte{append(mp4Box("moof", 8), mp4Box("mdat", 32)...)}, "before the movie header"},
+		{"mp4 truncated", "m4s", [][]byte{append(mp4Box("ftyp", 8), mp4Box("moov", 16)...), mp4Box("moof", 8)[:6]}, "truncated box header"},
+		{"aac", "aac", [][]byte{bytes.Repeat(adtsFrame, 3)}, ""},
+		{"aac truncated", "aac", [][]byte{append(bytes.Repeat(adtsFrame, 2), adtsFrame[:9]...)}, "truncated ADTS frame"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := serveSegments(t, tt.ext, tt.segments)
+			_, err := downloadManifestStream(context.Background(), http.DefaultClient, StreamDownloadOptions{
+				ManifestURL: server.URL + "/index.m3u8",
+				OutputPath:  filepath.Join(t.TempDir(), "out"),
+			})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDownloadManifestStream_StopsWhenItemIsCancelled(t *testing.T) {
+	const itemID = "stream-cancel"
+	initDownloadCancel(itemID)
+	defer clearDownloadCancel(itemID)
+
+	server := serveSegments(t, "ts", [][]byte{testTSPackets(1, 0), testTSPackets(1, 1), testTSPackets(1, 2)})
+	_, err := downloadManifestStream(downloadContext(itemID), http.DefaultClient, StreamDownloadOptions{
+		ManifestURL: server.URL + "/index.m3u8",
+		OutputPath:  filepath.Join(t.TempDir(), "out.ts"),
+		OnSegment: func(done, total int, written int64) {
+			if done == 1 {
+				cancelDownload(itemID)
+			}
+		},
+	})
+	if err == nil {
+		t.Fatal("download finished although its item was cancelled")
+	}
+	if ctx := downloadContext("stream-unknown"); ctx.Err() != nil {
+		t.Errorf("unknown item context is done: %v", ctx.Err())
+	}
+}
+
+func TestParseHLSPlaylist_MapAndByteRange(t *testing.T) {
+	body := "#EXTM3U\n#EXT-X-MAP:URI=\"main.mp4\",BYTERANGE=\"720@0\"\n" +
+		"#EXT-X-BYTERANGE:1000@720\n#EXTINF:4,\nmain.mp4\n" +
+		"#EXT-X-BYTERANGE:500\n#EXTINF:4,\nmain.mp4\n#EXT-X-ENDLIST\n"
+	playlist, variant, err := parseHLSPlaylist([]byte(body), "https://cdn.example.com/a/index.m3u8")
+	if err != nil || variant != "" {
+		t.Fatalf("parse failed: %v (variant %q)", err, variant)
+	}
+	if playlist.Container != StreamContainerMP4 || playlist.Init == nil || playlist.Init.Range.Length != 720 {
+		t.Fatalf("unexpected init segment %+v", playlist.Init)
+	}
+	if r := playlist.Segments[1].Range; r == nil || r.Offset != 1720 || r.Length != 500 {
+		t.Errorf("second byte range = %+v, want 500@1720", r)
+	}
+	if playlist.Segments[0].URL != "https://cdn.example.com/a/main.mp4" {
+		t.Errorf("segment URL not resolved: %s", playlist.Segments[0].URL)
+	}
+}
+
+func TestParseDASHManifest_SegmentTimeline(t *testing.T) {
+	mpd := `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT12S">
+  <Period>
+    <AdaptationSet contentType="audio" mimeType="audio/mp4">
+      <SegmentTemplate initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/$Number%03d$.m4s" startNumber="1" timescale="44100">
+        <SegmentTimeline><S t="0" d="176400" r="2"/></SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="flac" bandwidth="900000" codecs="flac"/>
+      <Representation id="aac" bandwidth="128000" codecs="mp4a.40.2"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+	playlist, err := parseDASHManifest([]byte(mpd), "https://cdn.example.com/t/manifest.mpd")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if playlist.Codecs != "flac" || playlist.Init.URL != "https://cdn.example.com/t/flac/init.mp4" {
+		t.Fatalf("picked wrong representation: %s %+v", playlist.Codecs, playlist.Init)
+	}
+	if len(playlist.Segments) != 3 || playlist.Segments[2].URL != "https://cdn.example.com/t/flac/003.m4s" {
+		t.Errorf("unexpected segments %+v", playlist.Segments)
+	}
+}
+
+func TestParseDASHManifest_SegmentDuration(t *testing.T) {
+	mpd := `<MPD mediaPresentationDuration="PT1M0.5S"><Period><AdaptationSet mimeType="audio/mp4">
+<Representation id="a" bandwidth="1"><SegmentTemplate media="s-$Number$.m4s" duration="10" timescale="1"/></Representation>
+</AdaptationSet></Period></MPD>`
+	playlist, err := parseDASHManifest([]byte(mpd), "https://cdn.example.com/m.mpd")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(playlist.Segments) != 7 {
+		t.Errorf("got %d segments, want 7", len(playlist.Segments))
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"PT12S":      12 * time.Second,
+		"PT1H2M3.5S": time.Hour + 2*time.Minute + 3500*time.Millisecond,
+		"P1DT1S":     24*time.Hour + time.Second,
+	}
+	for input, expected := range tests {
+		if got, err := parseISODuration(input); err != nil || got != expected {
+			t.Errorf("parseISODuration(%q) = %v, %v; want %v", input, got, err, expected)
+		}
+	}
+}
+
+func TestDecryptSampleAESADTS(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	iv := []byte("abcdefghijklmnop")
+
+	payload := make([]byte, 16+32+5)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	frameLen := 7 + len(payload)
+	header := []byte{0xff, 0xf1, 0x50, byte(0x80 | frameLen>>11), byte(frameLen >> 3), byte(frameLen<<5) | 0x1f, 0xfc}
+	plainFrame := append(append([]byte(nil), header...), payload...)
+
+	encFrame := append([]byte(nil), plainFrame...)
+	block, _ := aes.NewCipher(key)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encFrame[7+16:7+48], encFrame[7+16:7+48])
+
+	segment := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x02ab"), append(encFrame, encFrame...)...)
+	got, err := decryptSampleAESADTS(segment, key, iv)
+	if err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if want := append(append([]byte(nil), plainFrame...), plainFrame...); !bytes.Equal(got, want) {
+		t.Fatal("decrypted frames do not match the clear input")
+	}
+}
@@ -0,0 +1,248 @@
+package gobackend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	stdimage "image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ==================== Spectrogram ====================
+//
+// GenerateSpectrogram renders time (x) against frequency (y, 0 Hz at the
+// bottom up to Nyquist) so a user can spot a lossy transcode: MP3 encoders
+// low-pass at 16-20 kHz, which shows as a hard shelf above which the image
+// goes dark. Everything runs in Go (flac_decode.go, a radix-2 FFT) so it
+// works without FFmpeg.
+
+const (
+	spectrogramFFTSize       = 4096
+	spectrogramFloorDB       = -120.0
+	defaultSpectrogramWidth  = 1024
+	defaultSpectrogramHeight = 512
+	maxSpectrogramWidth      = 4096
+	maxSpectrogramHeight     = 2048
+)
+
+// spectrogramColors is a black-purple-red-yellow-white ramp, quiet to loud.
+var spectrogramColors = []color.RGBA{
+	{0, 0, 0, 255},
+	{40, 10, 90, 255},
+	{150, 20, 110, 255},
+	{230, 80, 40, 255},
+	{250, 200, 40, 255},
+	{255, 255, 230, 255},
+}
+
+// pcmSource yields blocks of per-channel samples at bps bits.
+type pcmSource interface {
+	next() ([][]int32, error)
+	Close() error
+}
+
+type wavSource struct {
+	f        *os.File
+	r        *bufio.Reader
+	channels int
+	buf      []byte
+}
+
+func (w *wavSource) next() ([][]int32, error) {
+	n, err := io.ReadFull(w.r, w.buf)
+	frames := n / (2 * w.channels)
+	if frames == 0 {
+		if err == nil || err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	out := make([][]int32, w.channels)
+	for ch := range out {
+		out[ch] = make([]int32, frames)
+		for i := range out[ch] {
+			out[ch][i] = int32(int16(binary.LittleEndian.Uint16(w.buf[2*(i*w.channels+ch):])))
+		}
+	}
+	return out, nil
+}
+
+func (w *wavSource) Close() error {
+	return w.f.Close()
+}
+
+// openPCMSource returns a decoder for path with its bit depth and total
+// sample count (0 when unknown).
+func openPCMSource(path string) (pcmSource, int, uint64, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		d, err := openFLACDecoder(path)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		return d, d.bps, d.total, nil
+	case ".wav":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		r := bufio.NewReaderSize(f, 1<<16)
+		_, channels, err := readWAVHeader(r)
+		if err != nil {
+			f.Close()
+			return nil, 0, 0, err
+		}
+		var total uint64
+		if stat, err := f.Stat(); err == nil {
+			pos, _ := f.Seek(0, io.SeekCurrent)
+			total = uint64(stat.Size()-pos+int64(r.Buffered())) / uint64(2*channels)
+		}
+		return &wavSource{f: f, r: r, channels: channels, buf: make([]byte, 4096*2*channels)}, 16, total, nil
+	}
+	return nil, 0, 0, fmt.Errorf("spectrograms need a FLAC or WAV file")
+}
+
+// fft is an in-place iterative radix-2 transform; len(x) is a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+func spectrogramColor(db float64) color.RGBA {
+	t := (db - spectrogramFloorDB) / -spectrogramFloorDB
+	t = math.Max(0, math.Min(1, t)) * float64(len(spectrogramColors)-1)
+	i := min(int(t), len(spectrogramColors)-2)
+	f := t - float64(i)
+	a, b := spectrogramColors[i], spectrogramColors[i+1]
+	mix := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*f + 0.5) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// spectrogramColumns computes one dB column (height rows, low to high
+// frequency) per output pixel. Column c analyzes the window starting at
+// c*(total-N)/(width-1), so the whole track is covered in a single pass.
+func spectrogramColumns(src pcmSource, bps int, total uint64, width, height int) ([][]float64, error) {
+	const n = spectrogramFFTSize
+	if total < n {
+		return nil, fmt.Errorf("track is too short for a spectrogram")
+	}
+	window := make([]float64, n)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+	}
+	// A full-scale sine peaks at N/4 through a Hann window.
+	scale := 1 / (float64(uint64(1)<<(bps-1)) * n / 4)
+
+	ring := make([]float64, n)
+	spectrum := make([]complex128, n)
+	columns := make([][]float64, 0, width)
+	stride := float64(total-n) / float64(max(width-1, 1))
+	var pos uint64
+	for len(columns) < width {
+		block, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := range block[0] {
+			var sum float64
+			for ch := range block {
+				sum += float64(block[ch][i])
+			}
+			ring[pos%n] = sum / float64(len(block))
+			pos++
+
+			for len(columns) < width && pos >= n && float64(pos-n) >= math.Round(float64(len(columns))*stride) {
+				for k := range spectrum {
+					spectrum[k] = complex(ring[(pos+uint64(k))%n]*window[k], 0)
+				}
+				fft(spectrum)
+				column := make([]float64, height)
+				for row := range column {
+					lo := row * (n / 2) / height
+					hi := max((row+1)*(n/2)/height, lo+1)
+					peak := 0.0
+					for _, c := range spectrum[lo:hi] {
+						peak = math.Max(peak, cmplx.Abs(c))
+					}
+					column[row] = math.Max(20*math.Log10(peak*scale+1e-12), spectrogramFloorDB)
+				}
+				columns = append(columns, column)
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no audio decoded")
+	}
+	return columns, nil
+}
+
+// GenerateSpectrogram returns a PNG spectrogram of a FLAC or WAV file.
+// Zero width or height picks the default size.
+func GenerateSpectrogram(path string, width, height int) ([]byte, error) {
+	if width <= 0 {
+		width = defaultSpectrogramWidth
+	}
+	if height <= 0 {
+		height = defaultSpectrogramHeight
+	}
+	if width > maxSpectrogramWidth || height > maxSpectrogramHeight {
+		return nil, fmt.Errorf("spectrogram size is limited to %dx%d", maxSpectrogramWidth, maxSpectrogramHeight)
+	}
+
+	src, bps, total, err := openPCMSource(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if total == 0 {
+		return nil, fmt.Errorf("track length is unknown")
+	}
+	columns, err := spectrogramColumns(src, bps, total, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, width, height))
+	// A truncated file leaves the right edge black.
+	for x, column := range columns {
+		for row, db := range column {
+			img.SetRGBA(x, height-1-row, spectrogramColor(db))
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
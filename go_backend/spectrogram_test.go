@@ -0,0 +1,251 @@
+package gobackend
+
+import (
+	"bytes"
+	"image/png"
+	"io"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+type testBitWriter struct {
+	buf []byte
+	acc byte
+	n   uint
+}
+
+func (w *testBitWriter) write(v uint64, k uint) {
+	for i := int(k) - 1; i >= 0; i-- {
+		w.acc = w.acc<<1 | byte(v>>uint(i)&1)
+		if w.n++; w.n == 8 {
+			w.buf, w.acc, w.n = append(w.buf, w.acc), 0, 0
+		}
+	}
+}
+
+func (w *testBitWriter) writeSigned(v int64, k uint) {
+	w.write(uint64(v)&(1<<k-1), k)
+}
+
+func (w *testBitWriter) writeRice(v int64, param uint) {
+	u := uint64(v<<1) ^ uint64(v>>63)
+	for q := u >> param; q > 0; q-- {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+	w.write(u, param)
+}
+
+func (w *testBitWriter) bytes() []byte {
+	if w.n > 0 {
+		w.write(0, 8-w.n)
+	}
+	return w.buf
+}
+
+// testSubframe encodes x with the given kind: "constant", "verbatim",
+// "wasted" (verbatim with 2 wasted bits), "fixedN" or "lpc".
+func testSubframe(w *testBitWriter, x []int32, bps uint, kind string) {
+	switch kind {
+	case "constant":
+		w.write(0x00, 8)
+		w.writeSigned(int64(x[0]), bps)
+	case "verbatim":
+		w.write(0x02, 8)
+		for _, v := range x {
+			w.writeSigned(int64(v), bps)
+		}
+	case "wasted":
+		w.write(0x03, 8)
+		w.write(0b01, 2)
+		for _, v := range x {
+			w.writeSigned(int64(v>>2), bps-2)
+		}
+	case "lpc":
+		coefs, shift := []int64{1900, -950}, uint(10)
+		w.write((32+1)<<1, 8)
+		w.writeSigned(int64(x[0]), bps)
+		w.writeSigned(int64(x[1]), bps)
+		w.write(11, 4)
+		w.write(uint64(shift), 5)
+		for _, c := range coefs {
+			w.writeSigned(c, 12)
+		}
+		// Method 1, partition order 1: the first half escaped to raw
+		// 20-bit values, the second Rice-coded.
+		w.write(1, 2)
+		w.write(1, 4)
+		for i := 2; i < len(x); i++ {
+			if i == 2 {
+				w.write(31, 5)
+				w.write(20, 5)
+			} else if i == len(x)/2 {
+				w.write(12, 5)
+			}
+			pred := (coefs[0]*int64(x[i-1]) + coefs[1]*int64(x[i-2])) >> shift
+			if i < len(x)/2 {
+				w.writeSigned(int64(x[i])-pred, 20)
+			} else {
+				w.writeRice(int64(x[i])-pred, 12)
+			}
+		}
+	default:
+		order := int(kind[len(kind)-1] - '0')
+		w.write(uint64(8+order)<<1, 8)
+		for _, v := range x[:order] {
+			w.writeSigned(int64(v), bps)
+		}
+		w.write(0, 2)
+		w.write(0, 4)
+		w.write(14, 4)
+		residual := append([]int32(nil), x...)
+		for o := 0; o < order; o++ {
+			for i := len(residual) - 1; i > o; i-- {
+				residual[i] -= residual[i-1]
+			}
+		}
+		for _, r := range residual[order:] {
+			w.writeRice(int64(r), 14)
+		}
+	}
+}
+
+type testFLACFrame struct {
+	assignment  byte
+	left, right []int32
+	kinds       [2]string
+}
+
+// testFLACStream writes a 44.1 kHz 16-bit stereo FLAC of the given
+// equally sized frames.
+func testFLACStream(t *testing.T, path string, frames []testFLACFrame) {
+	t.Helper()
+	testFLACSpec{
+		SampleRate:    44100,
+		Channels:      2,
+		BitsPerSample: 16,
+		BlockSize:     len(frames[0].left),
+		Frames:        len(frames),
+		Subframes: func(i int) (byte, []byte) {
+			f := frames[i]
+			ch0, ch1 := f.left, f.right
+			bits0, bits1 := uint(16), uint(16)
+			side := make([]int32, len(f.left))
+			mid := make([]int32, len(f.left))
+			for i := range side {
+				side[i] = f.left[i] - f.right[i]
+				mid[i] = (f.left[i] + f.right[i]) >> 1
+			}
+			switch f.assignment {
+			case 8:
+				ch1, bits1 = side, 17
+			case 9:
+				ch0, bits0 = side, 17
+			case 10:
+				ch0, ch1, bits1 = mid, side, 17
+			}
+			var w testBitWriter
+			testSubframe(&w, ch0, bits0, f.kinds[0])
+			testSubframe(&w, ch1, bits1, f.kinds[1])
+			return f.assignment, w.bytes()
+		},
+	}.write(t, path)
+}
+
+func testSine(start, n int, hz, amp float64) []int32 {
+	out := make([]int32, n)
+	for i := range out {
+		out[i] = int32(math.Round(amp * math.Sin(2*math.Pi*hz*float64(start+i)/44100)))
+	}
+	return out
+}
+
+func TestFLACDecoder_AllSubframeTypes(t *testing.T) {
+	const n = 4096
+	constant := make([]int32, n)
+	for i := range constant {
+		constant[i] = 7
+	}
+	wasted := testSine(4*n, n, 1000, 12000)
+	for i := range wasted {
+		wasted[i] &^= 3
+	}
+	frames := []testFLACFrame{
+		{1, testSine(0, n, 1000, 10000), constant, [2]string{"verbatim", "constant"}},
+		{8, testSine(n, n, 1000, 10000), testSine(n, n, 1000, -9000), [2]string{"fixed2", "lpc"}},
+		{9, testSine(2*n, n, 1000, 10000), testSine(2*n, n, 440, 5000), [2]string{"verbatim", "fixed0"}},
+		{10, testSine(3*n, n, 1000, 10000), testSine(3*n, n, 440, 5001), [2]string{"fixed1", "verbatim"}},
+		{1, wasted, testSine(4*n, n, 1000, 3000), [2]string{"wasted", "fixed4"}},
+	}
+	path := filepath.Join(t.TempDir(), "stream.flac")
+	testFLACStream(t, path, frames)
+
+	d, err := openFLACDecoder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if d.sampleRate != 44100 || d.channels != 2 || d.bps != 16 || d.total != 5*n {
+		t.Fatalf("stream info %+v", d)
+	}
+	for i, want := range frames {
+		got, err := d.next()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		for ch, samples := range [][]int32{want.left, want.right} {
+			for j := range samples {
+				if got[ch][j] != samples[j] {
+					t.Fatalf("frame %d (%v) channel %d sample %d = %d, want %d", i, want.kinds, ch, j, got[ch][j], samples[j])
+				}
+			}
+		}
+	}
+	if _, err := d.next(); err != io.EOF {
+		t.Errorf("after the last frame: %v", err)
+	}
+}
+
+func TestGenerateSpectrogram(t *testing.T) {
+	const n = 4096
+	var frames []testFLACFrame
+	for i := 0; i < 8; i++ {
+		tone := testSine(i*n, n, 1000, 16000)
+		frames = append(frames, testFLACFrame{1, tone, tone, [2]string{"fixed2", "verbatim"}})
+	}
+	path := filepath.Join(t.TempDir(), "tone.flac")
+	testFLACStream(t, path, frames)
+
+	data, err := GenerateSpectrogram(path, 32, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 32 || b.Dy() != 64 {
+		t.Fatalf("image is %v", b)
+	}
+	// 1 kHz of 22.05 kHz on 64 rows lands in row 2 from the bottom.
+	for _, x := range []int{0, 16, 31} {
+		brightest, level := -1, uint32(0)
+		for y := 0; y < 64; y++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			if r+g+b > level {
+				brightest, level = y, r+g+b
+			}
+		}
+		if brightest != 61 {
+			t.Errorf("column %d peaks at row %d", x, brightest)
+		}
+		if r, g, b, _ := img.At(x, 0).RGBA(); r+g+b > level/4 {
+			t.Errorf("column %d is bright at the top", x)
+		}
+	}
+
+	if _, err := GenerateSpectrogram(filepath.Join(t.TempDir(), "a.mp3"), 0, 0); err == nil {
+		t.Error("expected an error for MP3")
+	}
+}
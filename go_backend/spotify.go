@@ -1000,8 +1000,13 @@ func parseSpotifyURI(input string) (spotifyURI, error) {
 		return spotifyURI{}, errInvalidSpotifyURL
 	}
 
-	if strings.HasPrefix(trimmed, "spotify:") {
-		parts := strings.Split(trimmed, ":")
+	if strings.HasPrefix(strings.ToLower(trimmed), "spotify:") {
+		uri, _, _ := strings.Cut(trimmed, "?")
+		parts := strings.Split(uri, ":")
+		// spotify:user:<owner>:playlist:<id> is the legacy playlist form.
+		if len(parts) == 5 && parts[1] == "user" && parts[3] == "playlist" {
+			return spotifyURI{Type: "playlist", ID: parts[4]}, nil
+		}
 		if len(parts) == 3 {
 			switch parts[1] {
 			case "album", "track", "playlist", "artist":
@@ -1010,10 +1015,19 @@ func parseSpotifyURI(input string) (spotifyURI, error) {
 		}
 	}
 
+	lower := strings.ToLower(trimmed)
+	for _, host := range []string{"open.spotify.com/", "play.spotify.com/", "www.open.spotify.com/"} {
+		if strings.HasPrefix(lower, host) {
+			trimmed = "https://" + trimmed
+			break
+		}
+	}
+
 	parsed, err := url.Parse(trimmed)
 	if err != nil {
 		return spotifyURI{}, err
 	}
+	parsed.Host = strings.TrimPrefix(strings.ToLower(parsed.Host), "www.")
 
 	if parsed.Host == "embed.spotify.com" {
 		if parsed.RawQuery == "" {
@@ -0,0 +1,159 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ==================== Spotify link parsing ====================
+//
+// ParseSpotifyLink is the single entry point for links pasted or shared into
+// the app. It accepts share text with a link somewhere inside, open.spotify.com
+// URLs (locale prefixes, ?si= and other query junk), spotify: URIs and the
+// spotify.link/spoti.fi short links, which are resolved by following their
+// redirects.
+
+var (
+	spotifyLinkInTextPattern = regexp.MustCompile(`(?i)(?:https?://)?(?:[a-z0-9-]+\.)*(?:spotify\.com|spotify\.link|spoti\.fi|spotify\.app\.link)/[^\s"'<>]+|spotify:[a-z]+:[A-Za-z0-9:]+`)
+	spotifyOpenURLPattern    = regexp.MustCompile(`https://open\.spotify\.com/[^\s"'<>\\]+`)
+	spotifyIDPattern         = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+
+	spotifyShortLinkHosts = map[string]bool{
+		"spotify.link":     true,
+		"spoti.fi":         true,
+		"spotify.app.link": true,
+	}
+)
+
+const spotifyShortLinkTimeout = 10 * time.Second
+
+type SpotifyLink struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	URI  string `json:"uri"`
+	URL  string `json:"url"`
+}
+
+func newSpotifyLink(parsed spotifyURI) SpotifyLink {
+	return SpotifyLink{
+		Type: parsed.Type,
+		ID:   parsed.ID,
+		URI:  "spotify:" + parsed.Type + ":" + parsed.ID,
+		URL:  "https://open.spotify.com/" + parsed.Type + "/" + parsed.ID,
+	}
+}
+
+// extractSpotifyLinkText pulls the first Spotify link out of share text such
+// as "Listen to X on Spotify: https://...". Trailing punctuation is dropped.
+func extractSpotifyLinkText(input string) string {
+	match := spotifyLinkInTextPattern.FindString(input)
+	if match == "" {
+		return strings.TrimSpace(input)
+	}
+	return strings.TrimRight(match, ".,;:!?)]}")
+}
+
+func isSpotifyShortLink(link string) bool {
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return spotifyShortLinkHosts[strings.ToLower(u.Hostname())]
+}
+
+// resolveSpotifyShortLink follows redirects until they reach open.spotify.com.
+// Some short links land on an HTML page instead; the first open.spotify.com
+// URL in its body is used then.
+func resolveSpotifyShortLink(ctx context.Context, client *http.Client, link string) (string, error) {
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	var resolved string
+	redirectClient := *client
+	redirectClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if strings.EqualFold(req.URL.Hostname(), "open.spotify.com") {
+			resolved = req.URL.String()
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("too many redirects")
+		}
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", getRandomUserAgent())
+
+	resp, err := redirectClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve short link: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resolved != "" {
+		return resolved, nil
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		return location, nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 256*1024))
+	if match := spotifyOpenURLPattern.Find(body); match != nil {
+		return string(match), nil
+	}
+	return "", fmt.Errorf("short link did not lead to a Spotify URL")
+}
+
+func parseSpotifyLink(ctx context.Context, input string) (SpotifyLink, error) {
+	link := extractSpotifyLinkText(input)
+	if link == "" {
+		return SpotifyLink{}, errInvalidSpotifyURL
+	}
+
+	if isSpotifyShortLink(link) {
+		resolved, err := resolveSpotifyShortLink(ctx, NewMetadataHTTPClient(spotifyShortLinkTimeout), link)
+		if err != nil {
+			return SpotifyLink{}, err
+		}
+		GoLog("[SpotifyLink] Resolved %s -> %s\n", link, resolved)
+		link = resolved
+	}
+
+	parsed, err := parseSpotifyURI(link)
+	if err != nil {
+		return SpotifyLink{}, errInvalidSpotifyURL
+	}
+	if !spotifyIDPattern.MatchString(parsed.ID) {
+		return SpotifyLink{}, fmt.Errorf("%w: bad id %q", errInvalidSpotifyURL, parsed.ID)
+	}
+	return newSpotifyLink(parsed), nil
+}
+
+// ParseSpotifyLink returns {type, id, uri, url} for any Spotify link form.
+func ParseSpotifyLink(input string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), spotifyShortLinkTimeout)
+	defer cancel()
+
+	link, err := parseSpotifyLink(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(link)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
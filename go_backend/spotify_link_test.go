@@ -0,0 +1,62 @@
+package gobackend
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseSpotifyLinkForms(t *testing.T) {
+	const id = "4uLU6hMCjMI75M1A2tKUQC"
+	cases := []struct {
+		input, wantType string
+	}{
+		{"https://open.spotify.com/track/" + id + "?si=abc123&utm_source=copy-link", "track"},
+		{"https://open.spotify.com/intl-de/album/" + id, "album"},
+		{"open.spotify.com/playlist/" + id, "playlist"},
+		{"HTTPS://OPEN.SPOTIFY.COM/artist/" + id, "artist"},
+		{"spotify:track:" + id, "track"},
+		{"spotify:user:someone:playlist:" + id, "playlist"},
+		{"Listen to this on Spotify: https://open.spotify.com/track/" + id + "?si=x.", "track"},
+	}
+	for _, tc := range cases {
+		link, err := parseSpotifyLink(context.Background(), tc.input)
+		if err != nil {
+			t.Errorf("%q: %v", tc.input, err)
+			continue
+		}
+		if link.Type != tc.wantType || link.ID != id || link.URI != "spotify:"+tc.wantType+":"+id {
+			t.Errorf("%q = %+v", tc.input, link)
+		}
+	}
+
+	for _, bad := range []string{"", "https://example.com/track/" + id, "https://open.spotify.com/track/short"} {
+		if _, err := parseSpotifyLink(context.Background(), bad); err == nil {
+			t.Errorf("%q parsed without error", bad)
+		}
+	}
+}
+
+func TestResolveSpotifyShortLink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC?si=1", http.StatusTemporaryRedirect)
+		default:
+			w.Write([]byte(`<html><a href="https://open.spotify.com/album/4uLU6hMCjMI75M1A2tKUQC">open</a></html>`))
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resolved, err := resolveSpotifyShortLink(context.Background(), client, server.URL+"/redirect")
+	if err != nil || resolved != "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC?si=1" {
+		t.Errorf("redirect resolved to %q, err = %v", resolved, err)
+	}
+	resolved, err = resolveSpotifyShortLink(context.Background(), client, server.URL+"/page")
+	if err != nil || resolved != "https://open.spotify.com/album/4uLU6hMCjMI75M1A2tKUQC" {
+		t.Errorf("landing page resolved to %q, err = %v", resolved, err)
+	}
+}
@@ -0,0 +1,228 @@
+package gobackend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ==================== Spotify anonymous token ====================
+//
+// The web player hands out short-lived anonymous access tokens. Extensions
+// used to scrape them on their own; the backend now fetches one shared token,
+// refreshes it shortly before it expires, and rotates it when Spotify answers
+// 401/429. Token fetches are rate limited and honour Retry-After so a
+// misbehaving extension cannot get the device blocked.
+
+const (
+	spotifyWebTokenURL        = "https://open.spotify.com/get_access_token?reason=transport&productType=web-player"
+	spotifyTokenRefreshMargin = 5 * time.Minute
+	spotifyTokenMinLifetime   = 30 * time.Second
+	spotifyTokenFetchLimit    = 4
+	spotifyTokenFetchWindow   = time.Minute
+	// A Retry-After longer than this is not trusted; Spotify tokens stay
+	// unusable for at most this long.
+	spotifyTokenMaxBlock = 10 * time.Minute
+)
+
+var ErrSpotifyTokenRateLimited = errors.New("spotify token fetch is rate limited")
+
+type SpotifyAnonToken struct {
+	AccessToken string    `json:"access_token"`
+	ClientID    string    `json:"client_id,omitempty"`
+	ExpiresAt   time.Time `json:"-"`
+}
+
+type spotifyTokenSource struct {
+	endpoint string
+	client   *http.Client
+	limiter  *RateLimiter
+
+	fetchMu sync.Mutex // serializes fetches
+
+	mu           sync.Mutex
+	token        SpotifyAnonToken
+	fetchedAt    time.Time
+	blockedUntil time.Time
+	refreshing   bool
+}
+
+var spotifyAnonTokens = newSpotifyTokenSource(spotifyWebTokenURL)
+
+func newSpotifyTokenSource(endpoint string) *spotifyTokenSource {
+	return &spotifyTokenSource{
+		endpoint: endpoint,
+		client:   NewMetadataHTTPClient(15 * time.Second),
+		limiter:  NewRateLimiter(spotifyTokenFetchLimit, spotifyTokenFetchWindow),
+	}
+}
+
+func (s *spotifyTokenSource) usableLocked(now time.Time) bool {
+	return s.token.AccessToken != "" && now.Before(s.token.ExpiresAt.Add(-spotifyTokenMinLifetime))
+}
+
+// Get returns the cached token, fetching a new one when it is missing,
+// about to expire or force is set. A token inside the refresh margin is
+// returned as is while a background refresh replaces it.
+func (s *spotifyTokenSource) Get(ctx context.Context, force bool) (SpotifyAnonToken, error) {
+	requested := time.Now()
+
+	s.mu.Lock()
+	if !force && s.usableLocked(requested) {
+		token := s.token
+		if time.Until(token.ExpiresAt) < spotifyTokenRefreshMargin && !s.refreshing {
+			s.refreshing = true
+			go s.backgroundRefresh()
+		}
+		s.mu.Unlock()
+		return token, nil
+	}
+	s.mu.Unlock()
+
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	// Another caller may have fetched while we waited.
+	s.mu.Lock()
+	if s.usableLocked(time.Now()) && (!force || s.fetchedAt.After(requested)) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	if wait := time.Until(s.blockedUntil); wait > 0 {
+		s.mu.Unlock()
+		return SpotifyAnonToken{}, fmt.Errorf("%w, retry in %s", ErrSpotifyTokenRateLimited, wait.Round(time.Second))
+	}
+	s.mu.Unlock()
+
+	if !s.limiter.TryAcquire() {
+		return SpotifyAnonToken{}, ErrSpotifyTokenRateLimited
+	}
+
+	token, err := s.fetch(ctx)
+	if err != nil {
+		return SpotifyAnonToken{}, err
+	}
+
+	s.mu.Lock()
+	s.token = token
+	s.fetchedAt = time.Now()
+	s.mu.Unlock()
+	return token, nil
+}
+
+func (s *spotifyTokenSource) backgroundRefresh() {
+	defer func() {
+		s.mu.Lock()
+		s.refreshing = false
+		s.mu.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if _, err := s.Get(ctx, true); err != nil {
+		GoLog("[SpotifyToken] Background refresh failed: %v\n", err)
+	}
+}
+
+// blockLocked pauses fetching for retryAfter, clamped to
+// spotifyTokenMaxBlock. An earlier, longer block is kept.
+func (s *spotifyTokenSource) blockLocked(retryAfter time.Duration) time.Duration {
+	retryAfter = min(retryAfter, spotifyTokenMaxBlock)
+	if retryAfter <= 0 {
+		return 0
+	}
+	if until := time.Now().Add(retryAfter); until.After(s.blockedUntil) {
+		s.blockedUntil = until
+	}
+	return retryAfter
+}
+
+// Invalidate drops the token after Spotify rejected it so the next Get
+// rotates to a fresh one. A 429 with retryAfter longer than the token's
+// remaining life also pauses fetching.
+func (s *spotifyTokenSource) Invalidate(accessToken string, status int, retryAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if accessToken != "" && accessToken != s.token.AccessToken {
+		return // already rotated
+	}
+	switch status {
+	case http.StatusUnauthorized, http.StatusTooManyRequests:
+	default:
+		return
+	}
+	GoLog("[SpotifyToken] Token rejected with %d, rotating\n", status)
+	s.token = SpotifyAnonToken{}
+	if status == http.StatusTooManyRequests {
+		s.blockLocked(retryAfter)
+	}
+}
+
+func (s *spotifyTokenSource) fetch(ctx context.Context) (SpotifyAnonToken, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint, nil)
+	if err != nil {
+		return SpotifyAnonToken{}, err
+	}
+	req.Header.Set("User-Agent", getRandomUserAgent())
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Referer", "https://open.spotify.com/")
+	req.Header.Set("Origin", "https://open.spotify.com")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return SpotifyAnonToken{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		s.mu.Lock()
+		wait := s.blockLocked(getRetryAfterDuration(resp))
+		s.mu.Unlock()
+		GoLog("[SpotifyToken] Token endpoint rate limited, waiting %s\n", wait)
+		return SpotifyAnonToken{}, ErrSpotifyTokenRateLimited
+	}
+	if resp.StatusCode != http.StatusOK {
+		return SpotifyAnonToken{}, fmt.Errorf("spotify token endpoint returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return SpotifyAnonToken{}, err
+	}
+	var data struct {
+		AccessToken string `json:"accessToken"`
+		ClientID    string `json:"clientId"`
+		ExpiresAtMS int64  `json:"accessTokenExpirationTimestampMs"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return SpotifyAnonToken{}, fmt.Errorf("invalid token response: %w", err)
+	}
+	if data.AccessToken == "" {
+		return SpotifyAnonToken{}, fmt.Errorf("no access token in response")
+	}
+
+	token := SpotifyAnonToken{AccessToken: data.AccessToken, ClientID: data.ClientID}
+	if data.ExpiresAtMS > 0 {
+		token.ExpiresAt = time.UnixMilli(data.ExpiresAtMS)
+	} else {
+		token.ExpiresAt = time.Now().Add(time.Hour)
+	}
+	GoLog("[SpotifyToken] Fetched anonymous token, expires in %s\n", time.Until(token.ExpiresAt).Round(time.Second))
+	return token, nil
+}
+
+// GetSpotifyAnonToken returns the shared anonymous web player token.
+func GetSpotifyAnonToken(ctx context.Context, force bool) (SpotifyAnonToken, error) {
+	return spotifyAnonTokens.Get(ctx, force)
+}
+
+// InvalidateSpotifyAnonToken reports that Spotify rejected accessToken.
+func InvalidateSpotifyAnonToken(accessToken string, status int, retryAfter time.Duration) {
+	spotifyAnonTokens.Invalidate(accessToken, status, retryAfter)
+}
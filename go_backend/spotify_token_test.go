@@ -0,0 +1,87 @@
+package gobackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSpotifyTokenSourceCachesAndRotates(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := fetches.Add(1)
+		fmt.Fprintf(w, `{"accessToken":"token-%d","clientId":"cid","accessTokenExpirationTimestampMs":%d}`,
+			n, time.Now().Add(time.Hour).UnixMilli())
+	}))
+	defer server.Close()
+
+	source := newSpotifyTokenSource(server.URL)
+	ctx := context.Background()
+
+	first, err := source.Get(ctx, false)
+	if err != nil || first.AccessToken != "token-1" || first.ClientID != "cid" {
+		t.Fatalf("first token = %+v, err = %v", first, err)
+	}
+	if again, _ := source.Get(ctx, false); again.AccessToken != "token-1" || fetches.Load() != 1 {
+		t.Fatalf("token was not cached: %+v after %d fetches", again, fetches.Load())
+	}
+
+	// A stale token report does not drop the current one.
+	source.Invalidate("old-token", http.StatusUnauthorized, 0)
+	if again, _ := source.Get(ctx, false); again.AccessToken != "token-1" {
+		t.Fatalf("stale invalidation rotated the token: %+v", again)
+	}
+
+	source.Invalidate("token-1", http.StatusUnauthorized, 0)
+	if rotated, err := source.Get(ctx, false); err != nil || rotated.AccessToken != "token-2" {
+		t.Fatalf("rotated token = %+v, err = %v", rotated, err)
+	}
+}
+
+func TestSpotifyTokenSourceRateLimit(t *testing.T) {
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	source := newSpotifyTokenSource(server.URL)
+	if _, err := source.Get(context.Background(), false); !errors.Is(err, ErrSpotifyTokenRateLimited) {
+		t.Fatalf("err = %v, want rate limited", err)
+	}
+	if _, err := source.Get(context.Background(), true); !errors.Is(err, ErrSpotifyTokenRateLimited) {
+		t.Fatalf("err = %v, want rate limited", err)
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("endpoint was hit %d times during Retry-After", fetches.Load())
+	}
+}
+
+func TestSpotifyTokenSourceClampsRetryAfter(t *testing.T) {
+	source := newSpotifyTokenSource("http://127.0.0.1:0")
+	source.token = SpotifyAnonToken{AccessToken: "token-1", ExpiresAt: time.Now().Add(time.Hour)}
+	source.Invalidate("token-1", http.StatusTooManyRequests, 365*24*time.Hour)
+	if wait := time.Until(source.blockedUntil); wait > spotifyTokenMaxBlock || wait <= 0 {
+		t.Errorf("blocked for %s, want at most %s", wait, spotifyTokenMaxBlock)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "99999999")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	source = newSpotifyTokenSource(server.URL)
+	if _, err := source.Get(context.Background(), false); !errors.Is(err, ErrSpotifyTokenRateLimited) {
+		t.Fatalf("err = %v, want rate limited", err)
+	}
+	if wait := time.Until(source.blockedUntil); wait > spotifyTokenMaxBlock {
+		t.Errorf("endpoint Retry-After blocked for %s", wait)
+	}
+}
@@ -0,0 +1,223 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================== Store migrations ====================
+//
+// Backend state lives in small JSON files: the backend config, each
+// extension's settings, the trash index, playlist sync and release watch
+// state, and the download history. Each file's schema
+// version is kept in a <file>.version sidecar so the files themselves keep
+// the shape Flutter and older builds read; a file without one predates
+// versioning and counts as version 1. openStore runs when a store's dir is
+// set:
+//
+//   - a file at an older version is copied to <file>.v<N>.bak, migrated
+//     forward one step at a time, checked and only then written back, so a
+//     failed migration leaves the original untouched
+//   - a current file that fails its integrity check is moved aside to
+//     <file>.corrupt-<unix> instead of being overwritten by the next save
+//   - a file written by a newer build is left alone and the store refuses
+//     to open, so a downgrade cannot clobber data it does not understand
+//
+// Adding a migration means appending to the schema's migrations; its index
+// plus one is the version it upgrades from.
+
+const storeVersionSuffix = ".version"
+
+type storeMigration struct {
+	name    string
+	migrate func(data []byte) ([]byte, error)
+}
+
+type storeSchema struct {
+	file       string
+	migrations []storeMigration
+	check      func(data []byte) error
+}
+
+func (s storeSchema) version() int {
+	return len(s.migrations) + 1
+}
+
+var (
+	backendConfigStoreSchema = storeSchema{
+		file: backendConfigFile,
+		migrations: []storeMigration{
+			{name: "disable plain http cloud upload", migrate: migrateCloudUploadHTTP},
+		},
+		check: func(data []byte) error {
+			var cfg BackendConfig
+			return json.Unmarshal(data, &cfg)
+		},
+	}
+	extensionSettingsStoreSchema = storeSchema{
+		file: extensionSettingsFile,
+		check: func(data []byte) error {
+			var settings map[string]interface{}
+			return json.Unmarshal(data, &settings)
+		},
+	}
+	trashStoreSchema = storeSchema{
+		file: trashIndexFile,
+		check: func(data []byte) error {
+			var entries []TrashEntry
+			return json.Unmarshal(data, &entries)
+		},
+	}
+	playlistSyncStoreSchema = storeSchema{
+		file: playlistSyncStateFile,
+		check: func(data []byte) error {
+			var entries map[string]*playlistSyncEntry
+			return json.Unmarshal(data, &entries)
+		},
+	}
+	releaseWatchStoreSchema = storeSchema{
+		file: releaseWatchStateFile,
+		check: func(data []byte) error {
+			var artists map[string]*WatchedArtist
+			return json.Unmarshal(data, &artists)
+		},
+	}
+	downloadHistoryStoreSchema = storeSchema{
+		file:  downloadHistoryFile,
+		check: checkJSONLinesStore,
+	}
+)
+
+// migrateCloudUploadHTTP turns off a cloud upload that targets a plain http
+// endpoint without allow_http. Such a config no longer validates, and
+// loading it would otherwise drop every setting back to the defaults.
+func migrateCloudUploadHTTP(data []byte) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var upload map[string]interface{}
+	if err := json.Unmarshal(raw["cloud_upload"], &upload); err != nil || upload == nil {
+		return data, nil
+	}
+	var allowHTTP bool
+	json.Unmarshal(raw["allow_http"], &allowHTTP)
+	endpoint, _ := upload["endpoint"].(string)
+	if enabled, _ := upload["enabled"].(bool); !enabled || checkCloudUploadScheme(endpoint, allowHTTP) == nil {
+		return data, nil
+	}
+
+	upload["enabled"] = false
+	encoded, err := json.Marshal(upload)
+	if err != nil {
+		return nil, err
+	}
+	raw["cloud_upload"] = encoded
+	GoLog("[Store] Disabled cloud upload to plain http endpoint; enable allow_http to turn it back on\n")
+	return json.MarshalIndent(raw, "", "  ")
+}
+
+// checkJSONLinesStore accepts a JSONL file with at least one readable
+// record. Single bad lines (a torn append) are skipped by the loaders, so
+// only a file with nothing readable in it counts as corrupt.
+func checkJSONLinesStore(data []byte) error {
+	lines := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		lines++
+		var record map[string]interface{}
+		if json.Unmarshal(line, &record) == nil {
+			return nil
+		}
+	}
+	if lines == 0 {
+		return nil
+	}
+	return fmt.Errorf("none of %d lines is a JSON record", lines)
+}
+
+// readStoreVersion returns the recorded schema version of path, or 1 with
+// recorded false when there is no sidecar.
+func readStoreVersion(path string) (version int, recorded bool, err error) {
+	data, err := os.ReadFile(path + storeVersionSuffix)
+	if os.IsNotExist(err) {
+		return 1, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	version, err = strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || version < 1 {
+		return 0, false, fmt.Errorf("invalid schema version in %s", filepath.Base(path)+storeVersionSuffix)
+	}
+	return version, true, nil
+}
+
+func writeStoreFile(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// openStore checks and migrates schema's file in dir; see the section
+// comment. The caller holds the store's lock.
+func openStore(dir string, schema storeSchema) error {
+	path := filepath.Join(dir, schema.file)
+	version, recorded, err := readStoreVersion(path)
+	if err != nil {
+		return err
+	}
+	latest := schema.version()
+	if version > latest {
+		return fmt.Errorf("%s is schema version %d, this build reads up to %d", schema.file, version, latest)
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case version < latest:
+		backupPath := fmt.Sprintf("%s.v%d.bak", path, version)
+		if err := os.WriteFile(backupPath, data, 0644); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", schema.file, err)
+		}
+		for v := version; v < latest; v++ {
+			migration := schema.migrations[v-1]
+			if data, err = migration.migrate(data); err != nil {
+				return fmt.Errorf("%s migration to version %d (%s) failed: %w", schema.file, v+1, migration.name, err)
+			}
+		}
+		if err := schema.check(data); err != nil {
+			return fmt.Errorf("%s failed its check after migrating: %w", schema.file, err)
+		}
+		if err := writeStoreFile(path, data); err != nil {
+			return err
+		}
+		GoLog("[Store] Migrated %s from version %d to %d (backup: %s)\n", schema.file, version, latest, filepath.Base(backupPath))
+	default:
+		if err := schema.check(data); err != nil {
+			corruptPath := fmt.Sprintf("%s.corrupt-%d", path, time.Now().Unix())
+			if err := os.Rename(path, corruptPath); err != nil {
+				return fmt.Errorf("%s is corrupt and could not be moved aside: %w", schema.file, err)
+			}
+			GoLog("[Store] %s failed its check (%v), moved to %s\n", schema.file, err, filepath.Base(corruptPath))
+		}
+	}
+
+	if recorded && version == latest {
+		return nil
+	}
+	return writeStoreFile(path+storeVersionSuffix, []byte(strconv.Itoa(latest)))
+}
@@ -0,0 +1,207 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testStoreSchema() storeSchema {
+	return storeSchema{
+		file: "state.json",
+		migrations: []storeMigration{
+			{"wrap list", func(data []byte) ([]byte, error) {
+				var names []string
+				if err := json.Unmarshal(data, &names); err != nil {
+					return nil, err
+				}
+				return json.Marshal(map[string][]string{"names": names})
+			}},
+			{"add count", func(data []byte) ([]byte, error) {
+				var state map[string]interface{}
+				if err := json.Unmarshal(data, &state); err != nil {
+					return nil, err
+				}
+				state["count"] = len(state["names"].([]interface{}))
+				return json.Marshal(state)
+			}},
+		},
+		check: func(data []byte) error {
+			var state struct {
+				Names []string `json:"names"`
+				Count *int     `json:"count"`
+			}
+			if err := json.Unmarshal(data, &state); err != nil {
+				return err
+			}
+			if state.Count == nil {
+				return fmt.Errorf("count missing")
+			}
+			return nil
+		},
+	}
+}
+
+func TestOpenStore_MigratesWithBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	original := []byte(`["a","b"]`)
+	os.WriteFile(path, original, 0644)
+
+	if err := openStore(dir, testStoreSchema()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != `{"count":2,"names":["a","b"]}` {
+		t.Errorf("migrated = %s", got)
+	}
+	if got, _ := os.ReadFile(path + ".v1.bak"); !bytes.Equal(got, original) {
+		t.Errorf("backup = %s", got)
+	}
+	if version, recorded, _ := readStoreVersion(path); version != 3 || !recorded {
+		t.Errorf("version = %d, recorded %v", version, recorded)
+	}
+
+	// Opening again at the current version changes nothing.
+	if err := openStore(dir, testStoreSchema()); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("unexpected files after reopening: %d", len(entries))
+	}
+}
+
+func TestOpenStore_FailedMigrationKeepsOriginal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	os.WriteFile(path, []byte(`{"names":["a"]}`), 0644)
+	os.WriteFile(path+storeVersionSuffix, []byte("1"), 0644)
+
+	err := openStore(dir, testStoreSchema())
+	if err == nil || !strings.Contains(err.Error(), "wrap list") {
+		t.Fatalf("err = %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != `{"names":["a"]}` {
+		t.Errorf("original changed: %s", got)
+	}
+	if version, _, _ := readStoreVersion(path); version != 1 {
+		t.Errorf("version = %d", version)
+	}
+}
+
+func TestOpenStore_NewerVersionRefused(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	os.WriteFile(path, []byte(`{"shape":"from the future"}`), 0644)
+	os.WriteFile(path+storeVersionSuffix, []byte("7\n"), 0644)
+
+	if err := openStore(dir, testStoreSchema()); err == nil {
+		t.Fatal("expected a newer version to be refused")
+	}
+	if got, _ := os.ReadFile(path); string(got) != `{"shape":"from the future"}` {
+		t.Errorf("file changed: %s", got)
+	}
+}
+
+func TestOpenStore_QuarantinesCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, trashIndexFile)
+	os.WriteFile(path, []byte(`[{"id": "trunc`), 0644)
+
+	if err := SetTrashDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrashDir(t.TempDir())
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("corrupt index was left in place")
+	}
+	matches, _ := filepath.Glob(path + ".corrupt-*")
+	if len(matches) != 1 {
+		t.Fatalf("quarantined files = %v", matches)
+	}
+	if got, _ := os.ReadFile(matches[0]); string(got) != `[{"id": "trunc` {
+		t.Errorf("quarantined content = %s", got)
+	}
+	if version, recorded, _ := readStoreVersion(path); version != 1 || !recorded {
+		t.Errorf("version = %d, recorded %v", version, recorded)
+	}
+}
+
+func TestCheckJSONLinesStore(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		ok   bool
+	}{
+		{"", true},
+		{"{\"a\":1}\n{\"a\":2}\n{\"a\":", true},
+		{"\x00\x01\x02\n\xff", false},
+	} {
+		if err := checkJSONLinesStore([]byte(tt.data)); (err == nil) != tt.ok {
+			t.Errorf("checkJSONLinesStore(%q) = %v", tt.data, err)
+		}
+	}
+}
+
+func TestBackendConfigMigratesPlainHTTPUpload(t *testing.T) {
+	prev := GetBackendConfig()
+	defer func() {
+		backendConfigMu.Lock()
+		backendConfigDir = ""
+		backendConfigMu.Unlock()
+		UpdateBackendConfig(prev)
+	}()
+
+	dir := t.TempDir()
+	legacy := DefaultBackendConfig()
+	legacy.FilenameTemplate = "{artist} - {title} (kept)"
+	legacy.CloudUpload.Enabled = true
+	legacy.CloudUpload.Type = CloudUploadWebDAV
+	legacy.CloudUpload.Endpoint = "http://nas.local/dav"
+	data, _ := json.Marshal(legacy)
+	if err := os.WriteFile(filepath.Join(dir, backendConfigFile), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetBackendConfigDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	cfg := GetBackendConfig()
+	if cfg.FilenameTemplate != legacy.FilenameTemplate {
+		t.Errorf("config reset to defaults: template = %q", cfg.FilenameTemplate)
+	}
+	if cfg.CloudUpload.Enabled || cfg.CloudUpload.Endpoint != "http://nas.local/dav" {
+		t.Errorf("cloud upload = %+v", cfg.CloudUpload)
+	}
+	if _, err := os.Stat(filepath.Join(dir, backendConfigFile+".v1.bak")); err != nil {
+		t.Errorf("no backup before migrating: %v", err)
+	}
+	if version, _, _ := readStoreVersion(filepath.Join(dir, backendConfigFile)); version != backendConfigStoreSchema.version() {
+		t.Errorf("version = %d", version)
+	}
+}
+
+func TestExtensionSettingsStoreQuarantinesCorruptSettings(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "good"), 0755)
+	os.MkdirAll(filepath.Join(dir, "bad"), 0755)
+	os.WriteFile(filepath.Join(dir, "good", extensionSettingsFile), []byte(`{"region": "us"}`), 0644)
+	os.WriteFile(filepath.Join(dir, "bad", extensionSettingsFile), []byte(`{"region": `), 0644)
+
+	store := &ExtensionSettingsStore{settings: make(map[string]map[string]interface{})}
+	if err := store.SetDataDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if store.GetAll("good")["region"] != "us" {
+		t.Errorf("good settings = %v", store.GetAll("good"))
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "bad", extensionSettingsFile+".corrupt-*"))
+	if len(matches) != 1 {
+		t.Errorf("corrupt settings not moved aside: %v", matches)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "good", extensionSettingsFile+storeVersionSuffix)); err != nil {
+		t.Errorf("settings store not versioned: %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package gobackend
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/blowfish"
+)
+
+// ==================== Stream decryption ====================
+//
+// Protected provider formats are decrypted while the bytes stream to disk.
+// The caller (usually extension JS) derives the key, Go does the per-byte
+// work. Schemes are looked up by name; extensions may only use the schemes
+// they declare under "capabilities": {"decryption": [...]}.
+
+const (
+	DecryptionBlowfishChunked = "blowfish-cbc-chunked"
+	DecryptionAESCTR          = "aes-ctr"
+	DecryptionAESCBC          = "aes-cbc"
+)
+
+// DecryptionParams is the key material and layout for one stream. Key and
+// IV are hex unless KeyEncoding says "base64" or "raw".
+type DecryptionParams struct {
+	Scheme      string `json:"scheme"`
+	Key         string `json:"key"`
+	IV          string `json:"iv,omitempty"`
+	KeyEncoding string `json:"key_encoding,omitempty"`
+	ChunkSize   int    `json:"chunk_size,omitempty"`
+	Interval    int    `json:"interval,omitempty"`
+}
+
+// StreamDecryptor wraps an encrypted reader with one that yields plaintext.
+type StreamDecryptor func(src io.Reader, params DecryptionParams) (io.Reader, error)
+
+var (
+	decryptionSchemesMu sync.RWMutex
+	decryptionSchemes   = map[string]StreamDecryptor{
+		DecryptionBlowfishChunked: newBlowfishChunkedReader,
+		DecryptionAESCTR:          newAESCTRReader,
+		DecryptionAESCBC:          newAESCBCReader,
+	}
+)
+
+// RegisterDecryptionScheme adds or replaces a named scheme.
+func RegisterDecryptionScheme(name string, decryptor StreamDecryptor) {
+	decryptionSchemesMu.Lock()
+	defer decryptionSchemesMu.Unlock()
+	decryptionSchemes[strings.ToLower(name)] = decryptor
+}
+
+func GetDecryptionSchemes() []string {
+	decryptionSchemesMu.RLock()
+	defer decryptionSchemesMu.RUnlock()
+	names := make([]string, 0, len(decryptionSchemes))
+	for name := range decryptionSchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newDecryptingReader wraps src with the scheme named in params.
+func newDecryptingReader(src io.Reader, params DecryptionParams) (io.Reader, error) {
+	decryptionSchemesMu.RLock()
+	decryptor, ok := decryptionSchemes[strings.ToLower(params.Scheme)]
+	decryptionSchemesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown decryption scheme %q", params.Scheme)
+	}
+	return decryptor(src, params)
+}
+
+func (p DecryptionParams) decode(value string) ([]byte, error) {
+	switch strings.ToLower(p.KeyEncoding) {
+	case "", "hex":
+		return hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X"))
+	case "base64":
+		return base64.StdEncoding.DecodeString(value)
+	case "raw":
+		return []byte(value), nil
+	default:
+		return nil, fmt.Errorf("unknown key encoding %q", p.KeyEncoding)
+	}
+}
+
+func (p DecryptionParams) keyAndIV(defaultIV []byte) ([]byte, []byte, error) {
+	key, err := p.decode(p.Key)
+	if err != nil || len(key) == 0 {
+		return nil, nil, fmt.Errorf("invalid decryption key")
+	}
+	if p.IV == "" {
+		return key, defaultIV, nil
+	}
+	iv, err := p.decode(p.IV)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid decryption IV")
+	}
+	return key, iv, nil
+}
+
+// blowfishChunkedReader decrypts streams split into fixed-size chunks where
+// every Interval-th full chunk (starting with the first) is Blowfish-CBC
+// encrypted with the IV reset per chunk; the trailing partial chunk is
+// always clear.
+type blowfishChunkedReader struct {
+	src       io.Reader
+	block     cipher.Block
+	iv        []byte
+	chunk     []byte
+	pending   []byte
+	interval  int
+	index     int
+	sourceErr error
+}
+
+func newBlowfishChunkedReader(src io.Reader, params DecryptionParams) (io.Reader, error) {
+	key, iv, err := params.keyAndIV([]byte{0, 1, 2, 3, 4, 5, 6, 7})
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != blowfish.BlockSize {
+		return nil, fmt.Errorf("blowfish IV must be %d bytes", blowfish.BlockSize)
+	}
+	block, err := blowfish.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkSize, interval := params.ChunkSize, params.Interval
+	if chunkSize <= 0 {
+		chunkSize = 2048
+	}
+	if interval <= 0 {
+		interval = 3
+	}
+	if chunkSize%blowfish.BlockSize != 0 {
+		return nil, fmt.Errorf("chunk size must be a multiple of %d", blowfish.BlockSize)
+	}
+	return &blowfishChunkedReader{src: src, block: block, iv: iv, chunk: make([]byte, chunkSize), interval: interval}, nil
+}
+
+func (r *blowfishChunkedReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.sourceErr != nil {
+			return 0, r.sourceErr
+		}
+		n, err := io.ReadFull(r.src, r.chunk)
+		if n == len(r.chunk) && r.index%r.interval == 0 {
+			cipher.NewCBCDecrypter(r.block, r.iv).CryptBlocks(r.chunk, r.chunk)
+		}
+		r.index++
+		r.pending = r.chunk[:n]
+		switch err {
+		case nil:
+		case io.ErrUnexpectedEOF:
+			r.sourceErr = io.EOF
+		default:
+			r.sourceErr = err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func newAESCTRReader(src io.Reader, params DecryptionParams) (io.Reader, error) {
+	key, iv, err := params.keyAndIV(make([]byte, aes.BlockSize))
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("AES IV must be %d bytes", aes.BlockSize)
+	}
+	return &cipher.StreamReader{S: cipher.NewCTR(block, iv), R: src}, nil
+}
+
+// aesCBCReader decrypts a whole-stream AES-CBC body with PKCS#7 padding. The
+// last block is held back until EOF so the padding can be stripped.
+type aesCBCReader struct {
+	src     io.Reader
+	mode    cipher.BlockMode
+	buf     []byte
+	pending []byte
+	done    bool
+
+	// chunk and plain are reused across reads so decrypting a large file
+	// does not allocate per 32 KB.
+	chunk []byte
+	plain []byte
+}
+
+func newAESCBCReader(src io.Reader, params DecryptionParams) (io.Reader, error) {
+	key, iv, err := params.keyAndIV(nil)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("AES IV must be %d bytes", aes.BlockSize)
+	}
+	return &aesCBCReader{src: src, mode: cipher.NewCBCDecrypter(block, iv)}, nil
+}
+
+// stripPKCS7 removes the padding from a decrypted final block run. Every pad
+// byte must carry the pad length; checking only the last one would accept
+// most wrong-key output.
+func stripPKCS7(data []byte) ([]byte, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	pad := int(data[len(data)-1])
+	if pad == 0 || pad > aes.BlockSize || pad > len(data) {
+		return nil, false
+	}
+	for _, b := range data[len(data)-pad:] {
+		if int(b) != pad {
+			return nil, false
+		}
+	}
+	return data[:len(data)-pad], true
+}
+
+func (r *aesCBCReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if r.chunk == nil {
+			r.chunk = make([]byte, 32*1024)
+		}
+		n, err := io.ReadFull(r.src, r.chunk)
+		r.buf = append(r.buf, r.chunk[:n]...)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			r.done = true
+			if len(r.buf) == 0 || len(r.buf)%aes.BlockSize != 0 {
+				return 0, fmt.Errorf("AES-CBC stream is not block aligned")
+			}
+			r.mode.CryptBlocks(r.buf, r.buf)
+			plain, ok := stripPKCS7(r.buf)
+			if !ok {
+				return 0, fmt.Errorf("invalid padding (wrong key?)")
+			}
+			r.pending, r.buf = plain, nil
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		// Keep at least one block back for the padding check.
+		ready := (len(r.buf) - 1) / aes.BlockSize * aes.BlockSize
+		if ready > 0 {
+			if cap(r.plain) < ready {
+				r.plain = make([]byte, ready)
+			}
+			out := r.plain[:ready]
+			r.mode.CryptBlocks(out, r.buf[:ready])
+			r.pending = out
+			r.buf = append(r.buf[:0], r.buf[ready:]...)
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
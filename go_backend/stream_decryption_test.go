@@ -0,0 +1,140 @@
+package gobackend
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/blowfish"
+)
+
+func TestBlowfishChunkedReader(t *testing.T) {
+	key := []byte("g4el58wc0zvf9na1")
+	iv := []byte{0, 1, 2, 3, 4, 5, 6, 7}
+	plain := make([]byte, 2048*7+300)
+	for i := range plain {
+		plain[i] = byte(i * 7)
+	}
+
+	encrypted := append([]byte(nil), plain...)
+	block, _ := blowfish.NewCipher(key)
+	for i := 0; (i+1)*2048 <= len(encrypted); i++ {
+		if i%3 == 0 {
+			chunk := encrypted[i*2048 : (i+1)*2048]
+			cipher.NewCBCEncrypter(block, iv).CryptBlocks(chunk, chunk)
+		}
+	}
+
+	reader, err := newDecryptingReader(bytes.NewReader(encrypted), DecryptionParams{
+		Scheme:      DecryptionBlowfishChunked,
+		Key:         string(key),
+		KeyEncoding: "raw",
+	})
+	if err != nil {
+		t.Fatalf("newDecryptingReader failed: %v", err)
+	}
+	got, err := io.ReadAll(smallReads(reader))
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatal("decrypted output does not match plaintext")
+	}
+}
+
+// smallReads reads through small buffers to exercise partial reads.
+func smallReads(r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		if len(p) > 13 {
+			p = p[:13]
+		}
+		return r.Read(p)
+	})
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestAESCBCReader(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	iv := []byte("fedcba9876543210")
+	for _, size := range []int{0, 15, 16, 100000} {
+		plain := bytes.Repeat([]byte{0x5a}, size)
+		encrypted := encryptAES128Segment(t, plain, key, iv)
+
+		reader, err := newDecryptingReader(bytes.NewReader(encrypted), DecryptionParams{
+			Scheme: DecryptionAESCBC,
+			Key:    hex.EncodeToString(key),
+			IV:     hex.EncodeToString(iv),
+		})
+		if err != nil {
+			t.Fatalf("newDecryptingReader failed: %v", err)
+		}
+		got, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("size %d: read failed: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: decrypted output does not match plaintext", size)
+		}
+	}
+}
+
+func TestStripPKCS7(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want []byte
+		ok   bool
+	}{
+		{"valid", append([]byte("abcdefghijklm"), 3, 3, 3), []byte("abcdefghijklm"), true},
+		{"full block", bytes.Repeat([]byte{16}, 16), []byte{}, true},
+		{"mixed pad bytes", append([]byte("abcdefghijklm"), 1, 2, 3), nil, false},
+		{"zero pad", make([]byte, 16), nil, false},
+		{"pad longer than block", bytes.Repeat([]byte{17}, 32), nil, false},
+	}
+	for _, tc := range cases {
+		got, ok := stripPKCS7(tc.data)
+		if ok != tc.ok || (ok && !bytes.Equal(got, tc.want)) {
+			t.Errorf("%s: got %q, %v; want %q, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestAESCTRReader(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	plain := []byte("counter mode does not need padding")
+	block, _ := aes.NewCipher(key)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(encrypted, plain)
+
+	reader, err := newDecryptingReader(bytes.NewReader(encrypted), DecryptionParams{
+		Scheme:      DecryptionAESCTR,
+		Key:         "MDEyMzQ1Njc4OWFiY2RlZg==",
+		KeyEncoding: "base64",
+	})
+	if err != nil {
+		t.Fatalf("newDecryptingReader failed: %v", err)
+	}
+	if got, _ := io.ReadAll(reader); !bytes.Equal(got, plain) {
+		t.Fatalf("got %q, want %q", got, plain)
+	}
+}
+
+func TestDecryptionSchemes(t *testing.T) {
+	if _, err := newDecryptingReader(bytes.NewReader(nil), DecryptionParams{Scheme: "rot13"}); err == nil {
+		t.Error("expected unknown scheme to fail")
+	}
+
+	manifest := &ExtensionManifest{Capabilities: map[string]interface{}{
+		"decryption": []interface{}{"Blowfish-CBC-Chunked", "aes-ctr"},
+	}}
+	schemes := manifest.DecryptionSchemes()
+	if len(schemes) != 2 || schemes[0] != DecryptionBlowfishChunked {
+		t.Errorf("DecryptionSchemes() = %v", schemes)
+	}
+}
@@ -466,7 +466,7 @@ func resolveExtensionProviderStream(providerID string, req DownloadRequest) (*St
 
 	// For non-source providers, resolve proper provider-specific track ID first.
 	if !strings.EqualFold(providerID, req.Source) || trackID == "" {
-		availability, avErr := provider.CheckAvailability(req.ISRC, req.TrackName, req.ArtistName)
+		availability, avErr := provider.CheckAvailability(req.ISRC, req.matchTitle(), req.matchArtist())
 		if avErr == nil && availability != nil && availability.Available {
 			if availability.TrackID != "" {
 				trackID = availability.TrackID
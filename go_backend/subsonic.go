@@ -0,0 +1,317 @@
+package gobackend
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Subsonic integration ====================
+//
+// After a batch, a Subsonic-compatible server (Navidrome, Airsonic, gonic)
+// can be told to rescan its library so the new tracks show up right away.
+// With Verify on, the integration waits for the scan and searches for each
+// new track, reporting the ones the server did not pick up. The password
+// is stored encrypted in the integrations dir, never in BackendConfig.
+
+const (
+	subsonicAPIVersion         = "1.16.1"
+	subsonicClientName         = "SpotiFLAC"
+	subsonicCredentialsID      = "subsonic"
+	defaultSubsonicScanTimeout = 120
+	maxSubsonicScanTimeout     = 1800
+	maxSubsonicVerifyTracks    = 25
+	subsonicRequestTimeout     = 15 * time.Second
+)
+
+// SubsonicConfig lives in BackendConfig under subsonic.
+type SubsonicConfig struct {
+	Enabled            bool   `json:"enabled"`
+	ServerURL          string `json:"server_url,omitempty"`
+	Username           string `json:"username,omitempty"`
+	Verify             bool   `json:"verify"`
+	ScanTimeoutSeconds int    `json:"scan_timeout_seconds"`
+}
+
+func defaultSubsonicConfig() SubsonicConfig {
+	return SubsonicConfig{Verify: true, ScanTimeoutSeconds: defaultSubsonicScanTimeout}
+}
+
+func (c *SubsonicConfig) validate() error {
+	c.ServerURL = strings.TrimRight(strings.TrimSpace(c.ServerURL), "/")
+	c.Username = strings.TrimSpace(c.Username)
+	if c.ScanTimeoutSeconds < 0 || c.ScanTimeoutSeconds > maxSubsonicScanTimeout {
+		return fmt.Errorf("subsonic.scan_timeout_seconds must be between 0 and %d", maxSubsonicScanTimeout)
+	}
+	if !c.Enabled {
+		return nil
+	}
+	parsed, err := url.Parse(c.ServerURL)
+	if err != nil || parsed.Host == "" || parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return fmt.Errorf("subsonic.server_url must be an absolute http(s) URL")
+	}
+	if c.Username == "" {
+		return fmt.Errorf("subsonic.username is required")
+	}
+	return nil
+}
+
+var (
+	integrationsMu  sync.Mutex
+	integrationsDir string
+
+	// subsonicPollInterval is shortened by tests.
+	subsonicPollInterval = 2 * time.Second
+	// subsonicScanStartGrace is how long a "not scanning" status right
+	// after startScan is taken to mean the scan has not begun yet.
+	subsonicScanStartGrace = 10 * time.Second
+)
+
+func SetIntegrationsDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create integrations dir: %w", err)
+	}
+	integrationsMu.Lock()
+	integrationsDir = dir
+	integrationsMu.Unlock()
+	registerCredentialDir(subsonicCredentialsID, filepath.Join(dir, subsonicCredentialsID))
+	registerCredentialDir(deezerCredentialsID, filepath.Join(dir, deezerCredentialsID))
+	registerCredentialDir(listenBrainzCredentialsID, filepath.Join(dir, listenBrainzCredentialsID))
+	return nil
+}
+
+func subsonicCredentialsDir() (string, error) {
+	integrationsMu.Lock()
+	dir := integrationsDir
+	integrationsMu.Unlock()
+	if dir == "" {
+		return "", fmt.Errorf("integrations dir not set")
+	}
+	dir = filepath.Join(dir, subsonicCredentialsID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// SetSubsonicPassword encrypts and stores the Subsonic password.
+func SetSubsonicPassword(password string) error {
+	dir, err := subsonicCredentialsDir()
+	if err != nil {
+		return err
+	}
+	return writeCredentialsFile(subsonicCredentialsID, dir, map[string]interface{}{"password": password})
+}
+
+func loadSubsonicPassword() (string, error) {
+	dir, err := subsonicCredentialsDir()
+	if err != nil {
+		return "", err
+	}
+	creds, err := readCredentialsFile(subsonicCredentialsID, dir)
+	if err != nil {
+		return "", err
+	}
+	password, _ := creds["password"].(string)
+	if password == "" {
+		return "", fmt.Errorf("no subsonic password stored")
+	}
+	return password, nil
+}
+
+type subsonicClient struct {
+	cfg      SubsonicConfig
+	password string
+	client   *http.Client
+}
+
+type subsonicSong struct {
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Album  string `json:"album"`
+}
+
+type subsonicResponse struct {
+	Response struct {
+		Status string `json:"status"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		ScanStatus *struct {
+			Scanning bool `json:"scanning"`
+			Count    int  `json:"count"`
+		} `json:"scanStatus"`
+		SearchResult3 *struct {
+			Song []subsonicSong `json:"song"`
+		} `json:"searchResult3"`
+	} `json:"subsonic-response"`
+}
+
+// call runs a Subsonic REST method with token authentication.
+func (c *subsonicClient) call(method string, params url.Values) (*subsonicResponse, error) {
+	saltBytes := make([]byte, 6)
+	if _, err := rand.Read(saltBytes); err != nil {
+		return nil, err
+	}
+	salt := hex.EncodeToString(saltBytes)
+	token := md5.Sum([]byte(c.password + salt))
+
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("u", c.cfg.Username)
+	params.Set("t", hex.EncodeToString(token[:]))
+	params.Set("s", salt)
+	params.Set("v", subsonicAPIVersion)
+	params.Set("c", subsonicClientName)
+	params.Set("f", "json")
+
+	resp, err := c.client.Get(c.cfg.ServerURL + "/rest/" + method + ".view?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", method, resp.StatusCode)
+	}
+	var result subsonicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%s: invalid response: %w", method, err)
+	}
+	if result.Response.Status != "ok" {
+		if result.Response.Error != nil {
+			return nil, fmt.Errorf("%s: %s (code %d)", method, result.Response.Error.Message, result.Response.Error.Code)
+		}
+		return nil, fmt.Errorf("%s: status %q", method, result.Response.Status)
+	}
+	return &result, nil
+}
+
+// waitForScan polls getScanStatus until the scan is over or timeout passes.
+// Servers start the scan asynchronously, so "not scanning" only counts as
+// finished once a scan was seen running (in started, the startScan reply,
+// or a poll) or subsonicScanStartGrace has passed without one showing up.
+func (c *subsonicClient) waitForScan(started *subsonicResponse, timeout time.Duration) (bool, error) {
+	now := time.Now()
+	deadline := now.Add(timeout)
+	graceEnd := now.Add(subsonicScanStartGrace)
+	seen := started != nil && started.Response.ScanStatus != nil && started.Response.ScanStatus.Scanning
+	for {
+		result, err := c.call("getScanStatus", nil)
+		if err != nil {
+			return false, err
+		}
+		if result.Response.ScanStatus != nil && result.Response.ScanStatus.Scanning {
+			seen = true
+		} else if seen || time.Now().After(graceEnd) {
+			return true, nil
+		}
+		if time.Now().After(deadline) {
+			return false, nil
+		}
+		time.Sleep(subsonicPollInterval)
+	}
+}
+
+// hasTrack searches the server for a song with the track's title and artist.
+func (c *subsonicClient) hasTrack(track BatchTrack) (bool, error) {
+	result, err := c.call("search3", url.Values{
+		"query":       {track.Title},
+		"songCount":   {"20"},
+		"albumCount":  {"0"},
+		"artistCount": {"0"},
+	})
+	if err != nil {
+		return false, err
+	}
+	if result.Response.SearchResult3 == nil {
+		return false, nil
+	}
+	for _, song := range result.Response.SearchResult3.Song {
+		if !strings.EqualFold(strings.TrimSpace(song.Title), strings.TrimSpace(track.Title)) {
+			continue
+		}
+		if track.Artist == "" || strings.Contains(strings.ToLower(song.Artist), strings.ToLower(primaryArtist(track.Artist))) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// runSubsonicIntegration triggers a scan for a batch that produced new
+// files. It returns nil when the integration is off or there is nothing to
+// scan for.
+func runSubsonicIntegration(summary *BatchSummary) *IntegrationStatus {
+	cfg := GetBackendConfig().Subsonic
+	if !cfg.Enabled || summary.Completed == 0 {
+		return nil
+	}
+	status := &IntegrationStatus{Name: "subsonic", Status: IntegrationFailed}
+	password, err := loadSubsonicPassword()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	client := &subsonicClient{cfg: cfg, password: password, client: NewHTTPClientWithTimeout(subsonicRequestTimeout)}
+
+	started, err := client.call("startScan", nil)
+	if err != nil {
+		status.Error = err.Error()
+		GoLog("[Subsonic] %v\n", err)
+		return status
+	}
+	status.ScanStarted = true
+	status.Status = IntegrationOK
+	GoLog("[Subsonic] Library scan started on %s\n", cfg.ServerURL)
+	if !cfg.Verify {
+		return status
+	}
+
+	done, err := client.waitForScan(started, time.Duration(cfg.ScanTimeoutSeconds)*time.Second)
+	if err != nil || !done {
+		status.Status = IntegrationPartial
+		status.Error = "scan still running, tracks not verified"
+		if err != nil {
+			status.Error = err.Error()
+		}
+		return status
+	}
+	status.ScanCompleted = true
+
+	checked := 0
+	for _, track := range summary.Tracks {
+		if track.Error != "" || track.AlreadyExists || track.Title == "" {
+			continue
+		}
+		if checked == maxSubsonicVerifyTracks {
+			break
+		}
+		checked++
+		found, err := client.hasTrack(track)
+		if err != nil {
+			status.Status = IntegrationPartial
+			status.Error = err.Error()
+			return status
+		}
+		if found {
+			status.Verified++
+		} else {
+			status.Missing = append(status.Missing, strings.TrimPrefix(track.Artist+" - "+track.Title, " - "))
+		}
+	}
+	if len(status.Missing) > 0 {
+		status.Status = IntegrationPartial
+		GoLog("[Subsonic] %d of %d tracks not found after scan\n", len(status.Missing), checked)
+	}
+	return status
+}
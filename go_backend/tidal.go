@@ -1,7 +1,6 @@
 package gobackend
 
 import (
-	"bufio"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -45,6 +44,7 @@ type TidalTrack struct {
 	Album        struct {
 		Title       string `json:"title"`
 		Cover       string `json:"cover"`
+		VideoCover  string `json:"videoCover"`
 		ReleaseDate string `json:"releaseDate"`
 	} `json:"album"`
 	Artists []struct {
@@ -84,8 +84,12 @@ type MPD struct {
 	XMLName xml.Name `xml:"MPD"`
 	Period  struct {
 		AdaptationSet struct {
+			MimeType       string `xml:"mimeType,attr"`
 			Representation struct {
-				SegmentTemplate struct {
+				Codecs            string `xml:"codecs,attr"`
+				Bandwidth         int    `xml:"bandwidth,attr"`
+				AudioSamplingRate int    `xml:"audioSamplingRate,attr"`
+				SegmentTemplate   struct {
 					Initialization string `xml:"initialization,attr"`
 					Media          string `xml:"media,attr"`
 					Timeline       struct {
@@ -443,6 +447,7 @@ func (t *TidalDownloader) SearchTrackByMetadataWithISRC(trackName, artistName, a
 			GoLog("[Tidal] Found %d results for '%s'\n", len(result.Items), cleanQuery)
 
 			if spotifyISRC != "" {
+				var isrcMatches []*TidalTrack
 				for i := range result.Items {
 					if result.Items[i].ISRC == spotifyISRC {
 						track := &result.Items[i]
@@ -451,18 +456,19 @@ func (t *TidalDownloader) SearchTrackByMetadataWithISRC(trackName, artistName, a
 							if durationDiff < 0 {
 								durationDiff = -durationDiff
 							}
-							if durationDiff <= 3 {
-								GoLog("[Tidal] ISRC match: '%s' (duration verified)\n", track.Title)
-								return track, nil
+							if durationDiff > 3 {
+								GoLog("[Tidal] ISRC match but duration mismatch (expected %ds, got %ds), continuing...\n",
+									expectedDuration, track.Duration)
+								continue
 							}
-							GoLog("[Tidal] ISRC match but duration mismatch (expected %ds, got %ds), continuing...\n",
-								expectedDuration, track.Duration)
-						} else {
-							GoLog("[Tidal] ISRC match: '%s'\n", track.Title)
-							return track, nil
 						}
+						isrcMatches = append(isrcMatches, track)
 					}
 				}
+				if track := pickTidalAlbumMatch(isrcMatches, albumName, artistName); track != nil {
+					GoLog("[Tidal] ISRC match: '%s' on '%s'\n", track.Title, track.Album.Title)
+					return track, nil
+				}
 			}
 
 			allTracks = append(allTracks, result.Items...)
@@ -496,10 +502,10 @@ func (t *TidalDownloader) SearchTrackByMetadataWithISRC(trackName, artistName, a
 					}
 				}
 
-				if len(durationVerifiedMatches) > 0 {
+				if track := pickTidalAlbumMatch(durationVerifiedMatches, albumName, artistName); track != nil {
 					GoLog("[Tidal] ISRC match with duration verification: '%s' (expected %ds, found %ds)\n",
-						durationVerifiedMatches[0].Title, expectedDuration, durationVerifiedMatches[0].Duration)
-					return durationVerifiedMatches[0], nil
+						track.Title, expectedDuration, track.Duration)
+					return track, nil
 				}
 
 				GoLog("[Tidal] WARNING: ISRC %s found but duration mismatch. Expected=%ds, Found=%ds. Rejecting.\n",
@@ -508,8 +514,9 @@ func (t *TidalDownloader) SearchTrackByMetadataWithISRC(trackName, artistName, a
 					expectedDuration, isrcMatches[0].Duration)
 			}
 
-			GoLog("[Tidal] ISRC match (no duration verification): '%s'\n", isrcMatches[0].Title)
-			return isrcMatches[0], nil
+			track := pickTidalAlbumMatch(isrcMatches, albumName, artistName)
+			GoLog("[Tidal] ISRC match (no duration verification): '%s'\n", track.Title)
+			return track, nil
 		}
 
 		GoLog("[Tidal] No ISRC match found for: %s\n", spotifyISRC)
@@ -555,6 +562,36 @@ func (t *TidalDownloader) SearchTrackByMetadataWithISRC(trackName, artistName, a
 	return bestMatch, nil
 }
 
+// pickTidalAlbumMatch picks the ISRC match whose album fits the requested
+// one best. The same recording is often on both the standard and the deluxe
+// release, and the album_edition preference decides between them.
+func pickTidalAlbumMatch(tracks []*TidalTrack, albumName, artistName string) *TidalTrack {
+	if len(tracks) == 0 {
+		return nil
+	}
+	if len(tracks) == 1 || strings.TrimSpace(albumName) == "" {
+		return tracks[0]
+	}
+
+	target := AlbumMatchInput{Title: albumName}
+	if artistName != "" {
+		target.Artists = []string{artistName}
+	}
+	edition := GetBackendConfig().AlbumEdition
+
+	best, bestScore := tracks[0], -1.0
+	for _, track := range tracks {
+		candidate := AlbumMatchInput{
+			Title:   track.Album.Title,
+			Artists: splitArtists(tidalTrackArtistsDisplay(track)),
+		}
+		if score := compareAlbums(target, candidate, edition).Score; score > bestScore {
+			best, bestScore = track, score
+		}
+	}
+	return best
+}
+
 func containsQuery(queries []string, query string) bool {
 	for _, q := range queries {
 		if q == query {
@@ -966,6 +1003,13 @@ func (t *TidalDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 		return ErrDownloadCancelled
 	}
 
+	if handled, err := tryDownloadSegmented(ctx, t.client, downloadURL, outputPath, outputFD, itemID); handled {
+		if err != nil && isDownloadCancelled(itemID) {
+			return ErrDownloadCancelled
+		}
+		return err
+	}
+
 	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -993,8 +1037,15 @@ func (t *TidalDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 	if err != nil {
 		return err
 	}
+	if err := preallocateOutput(out, expectedSize); err != nil {
+		out.Close()
+		cleanupOutputOnError(outputPath, outputFD)
+		return err
+	}
 
-	bufWriter := bufio.NewWriterSize(out, 256*1024)
+	mirror := openOutputMirror(itemID)
+	bufWriter := acquireCopyWriter(hashedOutput(mirror.tee(out), itemID))
+	defer releaseCopyWriter(bufWriter)
 
 	var written int64
 	if itemID != "" {
@@ -1005,7 +1056,8 @@ func (t *TidalDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 	}
 
 	flushErr := bufWriter.Flush()
-	closeErr := out.Close()
+	closeErr := closeOutput(out)
+	mirror.close()
 
 	if err != nil {
 		cleanupOutputOnError(outputPath, outputFD)
@@ -1027,6 +1079,7 @@ func (t *TidalDownloader) DownloadFile(downloadURL, outputPath string, outputFD
 		cleanupOutputOnError(outputPath, outputFD)
 		return fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
 	}
+	sealDownloadHash(itemID, outputPath, outputFD)
 
 	return nil
 }
@@ -1080,16 +1133,24 @@ func (t *TidalDownloader) downloadFromManifest(ctx context.Context, manifestB64,
 		if err != nil {
 			return fmt.Errorf("failed to create file: %w", err)
 		}
+		if err := preallocateOutput(out, expectedSize); err != nil {
+			out.Close()
+			cleanupOutputOnError(outputPath, outputFD)
+			return err
+		}
 
+		mirror := openOutputMirror(itemID)
+		dst := hashedOutput(mirror.tee(out), itemID)
 		var written int64
 		if itemID != "" {
-			progressWriter := NewItemProgressWriter(out, itemID)
+			progressWriter := NewItemProgressWriter(dst, itemID)
 			written, err = io.Copy(progressWriter, resp.Body)
 		} else {
-			written, err = io.Copy(out, resp.Body)
+			written, err = io.Copy(dst, resp.Body)
 		}
 
-		closeErr := out.Close()
+		closeErr := closeOutput(out)
+		mirror.close()
 
 		if err != nil {
 			cleanupOutputOnError(outputPath, outputFD)
@@ -1107,6 +1168,7 @@ func (t *TidalDownloader) downloadFromManifest(ctx context.Context, manifestB64,
 			cleanupOutputOnError(outputPath, outputFD)
 			return fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
 		}
+		sealDownloadHash(itemID, outputPath, outputFD)
 
 		return nil
 	}
@@ -1130,6 +1192,7 @@ func (t *TidalDownloader) downloadFromManifest(ctx context.Context, manifestB64,
 		GoLog("[Tidal] Failed to create M4A file: %v\n", err)
 		return fmt.Errorf("failed to create M4A file: %w", err)
 	}
+	dst := hashedOutput(out, itemID)
 
 	GoLog("[Tidal] Downloading init segment...\n")
 	if isDownloadCancelled(itemID) {
@@ -1161,7 +1224,7 @@ func (t *TidalDownloader) downloadFromManifest(ctx context.Context, manifestB64,
 		GoLog("[Tidal] Init segment HTTP error: %d\n", resp.StatusCode)
 		return fmt.Errorf("init segment download failed with status %d", resp.StatusCode)
 	}
-	_, err = io.Copy(out, resp.Body)
+	_, err = io.Copy(dst, resp.Body)
 	resp.Body.Close()
 	if err != nil {
 		out.Close()
@@ -1214,7 +1277,7 @@ func (t *TidalDownloader) downloadFromManifest(ctx context.Context, manifestB64,
 			GoLog("[Tidal] Segment %d HTTP error: %d\n", i+1, resp.StatusCode)
 			return fmt.Errorf("segment %d download failed with status %d", i+1, resp.StatusCode)
 		}
-		_, err = io.Copy(out, resp.Body)
+		_, err = io.Copy(dst, resp.Body)
 		resp.Body.Close()
 		if err != nil {
 			out.Close()
@@ -1232,6 +1295,7 @@ func (t *TidalDownloader) downloadFromManifest(ctx context.Context, manifestB64,
 		GoLog("[Tidal] Failed to close M4A file: %v\n", err)
 		return fmt.Errorf("failed to close M4A file: %w", err)
 	}
+	sealDownloadHash(itemID, m4aPath, outputFD)
 
 	GoLog("[Tidal] DASH download completed: %s\n", m4aPath)
 	return nil
@@ -1249,6 +1313,7 @@ type TidalDownloadResult struct {
 	DiscNumber  int
 	ISRC        string
 	LyricsLRC   string // LRC content for embedding in converted files
+	LyricsTags  map[string]string
 }
 
 func artistsMatch(spotifyArtist, tidalArtist string) bool {
@@ -1353,6 +1418,10 @@ func titlesMatch(expectedTitle, foundTitle string) bool {
 		return true
 	}
 
+	if versionGuardRejects(expectedTitle, foundTitle, GetBackendConfig().StrictVersionMatch) {
+		return false
+	}
+
 	if strings.Contains(normExpected, normFound) || strings.Contains(normFound, normExpected) {
 		return true
 	}
@@ -1575,12 +1644,12 @@ func resolveTidalTrackForRequest(req DownloadRequest, downloader *TidalDownloade
 
 	if track == nil && req.ISRC != "" {
 		GoLog("[%s] Trying ISRC search: %s\n", logPrefix, req.ISRC)
-		track, err = downloader.SearchTrackByMetadataWithISRC(req.TrackName, req.ArtistName, req.AlbumName, req.ISRC, expectedDurationSec)
+		track, err = downloader.SearchTrackByMetadataWithISRC(req.matchTitle(), req.matchArtist(), req.matchAlbum(), req.ISRC, expectedDurationSec)
 		if track != nil {
 			tidalArtist := tidalTrackArtistsDisplay(track)
-			if !artistsMatch(req.ArtistName, tidalArtist) {
+			if !artistsMatch(req.matchArtist(), tidalArtist) {
 				GoLog("[%s] Artist mismatch from ISRC search: expected '%s', got '%s'. Rejecting.\n",
-					logPrefix, req.ArtistName, tidalArtist)
+					logPrefix, req.matchArtist(), tidalArtist)
 				track = nil
 			}
 		}
@@ -1651,9 +1720,9 @@ func resolveTidalTrackForRequest(req DownloadRequest, downloader *TidalDownloade
 			if track != nil {
 				tidalArtist := tidalTrackArtistsDisplay(track)
 
-				if !artistsMatch(req.ArtistName, tidalArtist) {
+				if !artistsMatch(req.matchArtist(), tidalArtist) {
 					GoLog("[%s] Artist mismatch from SongLink: expected '%s', got '%s'. Rejecting.\n",
-						logPrefix, req.ArtistName, tidalArtist)
+						logPrefix, req.matchArtist(), tidalArtist)
 					track = nil
 				}
 
@@ -1679,17 +1748,17 @@ func resolveTidalTrackForRequest(req DownloadRequest, downloader *TidalDownloade
 
 	if track == nil {
 		GoLog("[%s] Trying metadata search as last resort...\n", logPrefix)
-		track, err = downloader.SearchTrackByMetadataWithISRC(req.TrackName, req.ArtistName, req.AlbumName, "", expectedDurationSec)
+		track, err = downloader.SearchTrackByMetadataWithISRC(req.matchTitle(), req.matchArtist(), req.matchAlbum(), "", expectedDurationSec)
 		if track != nil {
 			tidalArtist := tidalTrackArtistsDisplay(track)
 
-			if !titlesMatch(req.TrackName, track.Title) {
+			if !titlesMatch(req.matchTitle(), track.Title) {
 				GoLog("[%s] Title mismatch from metadata search: expected '%s', got '%s'. Rejecting.\n",
-					logPrefix, req.TrackName, track.Title)
+					logPrefix, req.matchTitle(), track.Title)
 				track = nil
-			} else if !artistsMatch(req.ArtistName, tidalArtist) {
+			} else if !artistsMatch(req.matchArtist(), tidalArtist) {
 				GoLog("[%s] Artist mismatch from metadata search: expected '%s', got '%s'. Rejecting.\n",
-					logPrefix, req.ArtistName, tidalArtist)
+					logPrefix, req.matchArtist(), tidalArtist)
 				track = nil
 			}
 		}
@@ -1723,10 +1792,13 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 		}
 	}
 
+	match := startTraceSpan(req.ItemID, TraceSpanMatch, map[string]interface{}{"provider": "tidal"})
 	track, err := resolveTidalTrackForRequest(req, downloader, "Tidal")
+	match.End(err)
 	if err != nil {
 		return TidalDownloadResult{}, err
 	}
+	rememberAnimatedCover(req.ItemID, tidalAnimatedCoverURL(track.Album.VideoCover), AnimatedCoverScopeAlbum)
 
 	quality := req.Quality
 	if quality == "" {
@@ -1734,13 +1806,15 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 	}
 
 	filename := buildFilenameFromTemplate(req.FilenameFormat, map[string]interface{}{
-		"title":  req.TrackName,
-		"artist": req.ArtistName,
-		"album":  req.AlbumName,
-		"track":  req.TrackNumber,
-		"year":   extractYear(req.ReleaseDate),
-		"date":   req.ReleaseDate,
-		"disc":   req.DiscNumber,
+		"title":        req.TrackName,
+		"artist":       req.ArtistName,
+		"album":        req.AlbumName,
+		"album_artist": req.AlbumArtist,
+		"track":        req.TrackNumber,
+		"year":         extractYear(req.ReleaseDate),
+		"date":         req.ReleaseDate,
+		"disc":         req.DiscNumber,
+		"disc_total":   req.TotalDiscs,
 	})
 
 	outputExt := strings.TrimSpace(req.OutputExt)
@@ -1793,68 +1867,15 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 
 	GoLog("[Tidal] Using quality: %s\n", quality)
 
+	streamURL := startTraceSpan(req.ItemID, TraceSpanStreamURL, map[string]interface{}{"provider": "tidal", "quality": quality})
 	downloadInfo, err := downloader.GetDownloadURL(track.ID, quality)
+	streamURL.End(err)
 	if err != nil {
 		return TidalDownloadResult{}, fmt.Errorf("failed to get download URL: %w", err)
 	}
 
 	GoLog("[Tidal] Actual quality: %d-bit/%dHz\n", downloadInfo.BitDepth, downloadInfo.SampleRate)
 
-	var parallelResult *ParallelDownloadResult
-	parallelDone := make(chan struct{})
-	go func() {
-		defer close(parallelDone)
-		coverURL := req.CoverURL
-		embedLyrics := req.EmbedLyrics
-		if !req.EmbedMetadata {
-			coverURL = ""
-			embedLyrics = false
-		}
-		parallelResult = FetchCoverAndLyricsParallel(
-			coverURL,
-			req.EmbedMaxQualityCover,
-			req.SpotifyID,
-			req.TrackName,
-			req.ArtistName,
-			embedLyrics,
-			int64(req.DurationMS),
-		)
-	}()
-
-	GoLog("[Tidal] Starting download to: %s\n", outputPath)
-	GoLog("[Tidal] Download URL type: %s\n", func() string {
-		if strings.HasPrefix(downloadInfo.URL, "MANIFEST:") {
-			return "MANIFEST (DASH/BTS)"
-		}
-		return "Direct URL"
-	}())
-
-	if err := downloader.DownloadFile(downloadInfo.URL, outputPath, req.OutputFD, req.ItemID); err != nil {
-		if errors.Is(err, ErrDownloadCancelled) {
-			return TidalDownloadResult{}, ErrDownloadCancelled
-		}
-		GoLog("[Tidal] Download failed with error: %v\n", err)
-		return TidalDownloadResult{}, fmt.Errorf("download failed: %w", err)
-	}
-	fmt.Println("[Tidal] Download completed successfully")
-
-	<-parallelDone
-
-	if req.ItemID != "" {
-		SetItemProgress(req.ItemID, 1.0, 0, 0)
-		SetItemFinalizing(req.ItemID)
-	}
-
-	actualOutputPath := outputPath
-	if !isSafOutput {
-		if _, err := os.Stat(m4aPath); err == nil {
-			actualOutputPath = m4aPath
-			GoLog("[Tidal] File saved as M4A (DASH stream): %s\n", actualOutputPath)
-		} else if _, err := os.Stat(outputPath); err != nil {
-			return TidalDownloadResult{}, fmt.Errorf("download completed but file not found at %s or %s", outputPath, m4aPath)
-		}
-	}
-
 	releaseDate := req.ReleaseDate
 	if releaseDate == "" && track.Album.ReleaseDate != "" {
 		releaseDate = track.Album.ReleaseDate
@@ -1879,83 +1900,101 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 		TrackNumber: actualTrackNumber,
 		TotalTracks: req.TotalTracks,
 		DiscNumber:  actualDiscNumber,
+		TotalDiscs:  req.TotalDiscs,
+		Compilation: req.Compilation,
 		ISRC:        track.ISRC,
 		Genre:       req.Genre,
 		Label:       req.Label,
 		Copyright:   req.Copyright,
+		Chapters:    req.Chapters,
 	}
 
-	var coverData []byte
-	if parallelResult != nil && parallelResult.CoverData != nil {
-		coverData = parallelResult.CoverData
-		GoLog("[Tidal] Using parallel-fetched cover (%d bytes)\n", len(coverData))
-	}
-
+	// Set by the audio task; tag and lyrics tasks only run after it succeeded.
+	actualOutputPath := outputPath
 	actualExt := outputExt
-	if strings.HasPrefix(downloadInfo.URL, "MANIFEST:") {
-		actualExt = ".m4a"
+	isFlacOutput := func() bool {
+		return (isSafOutput && actualExt == ".flac") || (!isSafOutput && strings.HasSuffix(actualOutputPath, ".flac"))
 	}
-	if actualExt == "" && !isSafOutput {
-		actualExt = strings.ToLower(filepath.Ext(actualOutputPath))
+	isM4AOutput := func() bool {
+		return (isSafOutput && actualExt == ".m4a") || (!isSafOutput && strings.HasSuffix(actualOutputPath, ".m4a"))
 	}
 
-	if (isSafOutput && actualExt == ".flac") || (!isSafOutput && strings.HasSuffix(actualOutputPath, ".flac")) {
-		if req.EmbedMetadata {
-			if err := EmbedMetadataWithCoverData(actualOutputPath, metadata, coverData); err != nil {
-				fmt.Printf("Warning: failed to embed metadata: %v\n", err)
+	pipeline := newTrackPipeline(req, true, func() error {
+		GoLog("[Tidal] Starting download to: %s\n", outputPath)
+		GoLog("[Tidal] Download URL type: %s\n", func() string {
+			if strings.HasPrefix(downloadInfo.URL, "MANIFEST:") {
+				return "MANIFEST (DASH/BTS)"
 			}
-		} else {
-			GoLog("[Tidal] Metadata embedding disabled by settings, skipping FLAC metadata/lyrics embedding\n")
-		}
+			return "Direct URL"
+		}())
 
-		if req.EmbedMetadata && req.EmbedLyrics && parallelResult != nil && parallelResult.LyricsLRC != "" {
-			lyricsMode := req.LyricsMode
-			if lyricsMode == "" {
-				lyricsMode = "embed"
+		if err := downloader.DownloadFile(downloadInfo.URL, outputPath, req.OutputFD, req.ItemID); err != nil {
+			if errors.Is(err, ErrDownloadCancelled) {
+				return ErrDownloadCancelled
 			}
+			GoLog("[Tidal] Download failed with error: %v\n", err)
+			return fmt.Errorf("download failed: %w", err)
+		}
+		fmt.Println("[Tidal] Download completed successfully")
 
-			if !isSafOutput && (lyricsMode == "external" || lyricsMode == "both") {
-				GoLog("[Tidal] Saving external LRC file...\n")
-				if lrcPath, lrcErr := SaveLRCFile(actualOutputPath, parallelResult.LyricsLRC); lrcErr != nil {
-					GoLog("[Tidal] Warning: failed to save LRC file: %v\n", lrcErr)
-				} else {
-					GoLog("[Tidal] LRC file saved: %s\n", lrcPath)
-				}
-			}
+		if req.ItemID != "" {
+			SetItemProgress(req.ItemID, 1.0, 0, 0)
+			SetItemFinalizing(req.ItemID)
+		}
 
-			if lyricsMode == "embed" || lyricsMode == "both" {
-				GoLog("[Tidal] Embedding parallel-fetched lyrics (%d lines)...\n", len(parallelResult.LyricsData.Lines))
-				if embedErr := EmbedLyrics(actualOutputPath, parallelResult.LyricsLRC); embedErr != nil {
-					GoLog("[Tidal] Warning: failed to embed lyrics: %v\n", embedErr)
-				} else {
-					fmt.Println("[Tidal] Lyrics embedded successfully")
-				}
+		if !isSafOutput {
+			if _, err := os.Stat(m4aPath); err == nil {
+				actualOutputPath = m4aPath
+				GoLog("[Tidal] File saved as M4A (DASH stream): %s\n", actualOutputPath)
+			} else if _, err := os.Stat(outputPath); err != nil {
+				return fmt.Errorf("download completed but file not found at %s or %s", outputPath, m4aPath)
 			}
-		} else if req.EmbedMetadata && req.EmbedLyrics {
-			fmt.Println("[Tidal] No lyrics available from parallel fetch")
 		}
-	} else if (isSafOutput && actualExt == ".m4a") || (!isSafOutput && strings.HasSuffix(actualOutputPath, ".m4a")) {
-		if quality == "HIGH" {
-			GoLog("[Tidal] HIGH quality M4A - skipping metadata embedding (file from server is already valid)\n")
 
-			if req.EmbedMetadata && req.EmbedLyrics && parallelResult != nil && parallelResult.LyricsLRC != "" {
-				lyricsMode := req.LyricsMode
-				if lyricsMode == "" {
-					lyricsMode = "embed"
-				}
+		if strings.HasPrefix(downloadInfo.URL, "MANIFEST:") {
+			actualExt = ".m4a"
+		}
+		if actualExt == "" && !isSafOutput {
+			actualExt = strings.ToLower(filepath.Ext(actualOutputPath))
+		}
+		return nil
+	})
 
-				if !isSafOutput && (lyricsMode == "external" || lyricsMode == "both") {
-					GoLog("[Tidal] Saving external LRC file for M4A (mode: %s)...\n", lyricsMode)
-					if lrcPath, lrcErr := SaveLRCFile(actualOutputPath, parallelResult.LyricsLRC); lrcErr != nil {
-						GoLog("[Tidal] Warning: failed to save LRC file: %v\n", lrcErr)
-					} else {
-						GoLog("[Tidal] LRC file saved: %s\n", lrcPath)
-					}
-				}
+	pipeline.Tag(func(assets *ParallelDownloadResult) error {
+		switch {
+		case isFlacOutput():
+			if !req.EmbedMetadata {
+				GoLog("[Tidal] Metadata embedding disabled by settings, skipping FLAC metadata/lyrics embedding\n")
+				return nil
 			}
-		} else {
+			if assets.CoverData != nil {
+				GoLog("[Tidal] Using parallel-fetched cover (%d bytes)\n", len(assets.CoverData))
+			}
+			if err := EmbedMetadataWithCoverData(actualOutputPath, metadata, assets.CoverData); err != nil {
+				GoLog("[Tidal] Warning: failed to embed metadata: %v\n", err)
+				return err
+			}
+		case isM4AOutput() && quality == "HIGH":
+			GoLog("[Tidal] HIGH quality M4A - skipping metadata embedding (file from server is already valid)\n")
+		case isM4AOutput():
 			fmt.Println("[Tidal] Skipping metadata embedding for M4A file (will be handled after FFmpeg conversion)")
 		}
+		return nil
+	})
+
+	pipeline.WriteLyrics(func(lrc string, lyrics *LyricsResponse) error {
+		switch {
+		case isFlacOutput():
+			return writeLyricsOutputs("Tidal", actualOutputPath, lrc, lyrics, req.LyricsMode, !isSafOutput, true)
+		case isM4AOutput() && quality == "HIGH":
+			return writeLyricsOutputs("Tidal", actualOutputPath, lrc, lyrics, req.LyricsMode, !isSafOutput, false)
+		}
+		return nil
+	})
+
+	parallelResult, err := pipeline.Run()
+	if err != nil {
+		return TidalDownloadResult{}, err
 	}
 
 	if !isSafOutput {
@@ -1965,12 +2004,14 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 	bitDepth := downloadInfo.BitDepth
 	sampleRate := downloadInfo.SampleRate
 	lyricsLRC := ""
+	var lyricsTags map[string]string
 	if quality == "HIGH" {
 		bitDepth = 0
 		sampleRate = 44100
 	}
 	if req.EmbedMetadata && req.EmbedLyrics && parallelResult != nil && parallelResult.LyricsLRC != "" {
 		lyricsLRC = parallelResult.LyricsLRC
+		lyricsTags = parallelResult.LyricsTags
 	}
 
 	return TidalDownloadResult{
@@ -1985,6 +2026,7 @@ func downloadFromTidal(req DownloadRequest) (TidalDownloadResult, error) {
 		DiscNumber:  actualDiscNumber,
 		ISRC:        track.ISRC,
 		LyricsLRC:   lyricsLRC,
+		LyricsTags:  lyricsTags,
 	}, nil
 }
 
@@ -0,0 +1,97 @@
+package gobackend
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// TidalStreamManifest is a decoded playbackinfo "manifest": a BTS manifest
+// lists direct URLs, a DASH one an init segment and numbered segments.
+type TidalStreamManifest struct {
+	Type           string   `json:"type"`
+	MimeType       string   `json:"mime_type,omitempty"`
+	Codec          string   `json:"codec"`
+	Quality        string   `json:"quality,omitempty"`
+	EncryptionType string   `json:"encryption_type,omitempty"`
+	SampleRate     int      `json:"sample_rate,omitempty"`
+	Bandwidth      int      `json:"bandwidth,omitempty"`
+	URLs           []string `json:"urls,omitempty"`
+	InitURL        string   `json:"init_url,omitempty"`
+	SegmentURLs    []string `json:"segment_urls,omitempty"`
+}
+
+// tidalQualityForCodec maps a manifest codec to Tidal's audioQuality name.
+// AAC is only told apart by bandwidth, so BTS AAC stays unknown.
+func tidalQualityForCodec(codec string, sampleRate, bandwidth int) string {
+	codec = strings.ToLower(codec)
+	switch {
+	case codec == "flac":
+		if sampleRate > 48000 {
+			return "HI_RES_LOSSLESS"
+		}
+		return "LOSSLESS"
+	case strings.Contains(codec, "mqa"):
+		return "HI_RES"
+	case codec == "eac3" || codec == "ec-3" || strings.HasPrefix(codec, "ac-4") || strings.HasPrefix(codec, "ac4"):
+		return "DOLBY_ATMOS"
+	case strings.HasPrefix(codec, "mp4a") || codec == "aac":
+		if bandwidth >= 256000 {
+			return "HIGH"
+		}
+		if bandwidth > 0 {
+			return "LOW"
+		}
+	}
+	return ""
+}
+
+// DecodeTidalManifest decodes a base64 BTS or DASH manifest.
+func DecodeTidalManifest(manifestB64 string) (*TidalStreamManifest, error) {
+	manifestB64 = strings.TrimSpace(manifestB64)
+	data, err := base64.StdEncoding.DecodeString(manifestB64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		var bts TidalBTSManifest
+		if err := json.Unmarshal(data, &bts); err != nil {
+			return nil, fmt.Errorf("failed to parse BTS manifest: %w", err)
+		}
+		if len(bts.URLs) == 0 {
+			return nil, fmt.Errorf("no URLs in BTS manifest")
+		}
+		return &TidalStreamManifest{
+			Type:           "bts",
+			MimeType:       bts.MimeType,
+			Codec:          bts.Codecs,
+			Quality:        tidalQualityForCodec(bts.Codecs, 0, 0),
+			EncryptionType: bts.EncryptionType,
+			URLs:           bts.URLs,
+		}, nil
+	}
+
+	var mpd MPD
+	if err := xml.Unmarshal(data, &mpd); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest XML: %w", err)
+	}
+	_, initURL, segmentURLs, err := parseManifest(manifestB64)
+	if err != nil {
+		return nil, err
+	}
+	set := mpd.Period.AdaptationSet
+	rep := set.Representation
+	return &TidalStreamManifest{
+		Type:        "dash",
+		MimeType:    set.MimeType,
+		Codec:       rep.Codecs,
+		Quality:     tidalQualityForCodec(rep.Codecs, rep.AudioSamplingRate, rep.Bandwidth),
+		SampleRate:  rep.AudioSamplingRate,
+		Bandwidth:   rep.Bandwidth,
+		InitURL:     initURL,
+		SegmentURLs: segmentURLs,
+	}, nil
+}
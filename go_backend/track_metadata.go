@@ -0,0 +1,392 @@
+package gobackend
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// CanonicalTrack is the canonical shape of a track, independent of which
+// provider or extension produced it. (TrackMetadata is taken by the Spotify
+// wire format, which Flutter already depends on.) normalizeExtensionTrack
+// decodes extension objects into it and validates it against trackSchema.
+type CanonicalTrack struct {
+	ID          string   `json:"id,omitempty"`
+	Title       string   `json:"title"`
+	Artists     []string `json:"artists"`
+	Album       string   `json:"album,omitempty"`
+	AlbumArtist string   `json:"album_artist,omitempty"`
+	TrackNumber int      `json:"track_number,omitempty"`
+	DiscNumber  int      `json:"disc_number,omitempty"`
+	DurationMs  int64    `json:"duration_ms,omitempty"`
+	ISRC        string   `json:"isrc,omitempty"`
+	ReleaseDate string   `json:"release_date,omitempty"`
+	CoverURL    string   `json:"cover_url,omitempty"`
+	Explicit    bool     `json:"explicit,omitempty"`
+
+	// images is the legacy cover key, kept for ExtTrackMetadata.Images.
+	images string
+	// extra holds the keys the schema does not cover (provider IDs,
+	// chapters, item_type...), passed through to ExtTrackMetadata.
+	extra map[string]interface{}
+	// present marks the schema fields the object set, by wire key.
+	present map[string]bool
+}
+
+// MetadataFieldError points at one invalid field of an extension result.
+type MetadataFieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e MetadataFieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// TrackValidationError collects every problem found in one track object so
+// extension authors can fix them in one go.
+type TrackValidationError struct {
+	Errors []MetadataFieldError `json:"errors"`
+}
+
+func (e *TrackValidationError) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fe.Error()
+	}
+	return "invalid track metadata: " + strings.Join(parts, "; ")
+}
+
+type trackFieldKind int
+
+const (
+	fieldString trackFieldKind = iota
+	fieldID
+	fieldArtists
+	fieldCount
+	fieldDuration
+	fieldBool
+)
+
+// trackFieldSchema describes one field of the track schema. The first name
+// is the wire key ExtTrackMetadata expects; the rest are accepted aliases
+// that get rewritten to it. field points at where CanonicalTrack keeps it.
+type trackFieldSchema struct {
+	names    []string
+	kind     trackFieldKind
+	required bool
+	check    func(string) string
+	field    func(*CanonicalTrack) interface{}
+}
+
+var (
+	isrcPattern        = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}\d{7}$`)
+	releaseDatePattern = regexp.MustCompile(`^\d{4}(-\d{2}(-\d{2})?)?`)
+)
+
+const maxTrackDurationMs = 24 * 60 * 60 * 1000
+
+var trackSchema = []trackFieldSchema{
+	{names: []string{"id"}, kind: fieldID, field: func(t *CanonicalTrack) interface{} { return &t.ID }},
+	{names: []string{"name", "title"}, kind: fieldString, required: true, field: func(t *CanonicalTrack) interface{} { return &t.Title }},
+	{names: []string{"artists", "artist"}, kind: fieldArtists, required: true, field: func(t *CanonicalTrack) interface{} { return &t.Artists }},
+	{names: []string{"album_name", "album", "albumName"}, kind: fieldString, field: func(t *CanonicalTrack) interface{} { return &t.Album }},
+	{names: []string{"album_artist", "albumArtist"}, kind: fieldString, field: func(t *CanonicalTrack) interface{} { return &t.AlbumArtist }},
+	{names: []string{"duration_ms", "durationMs"}, kind: fieldDuration, field: func(t *CanonicalTrack) interface{} { return &t.DurationMs }},
+	{names: []string{"track_number", "trackNumber"}, kind: fieldCount, field: func(t *CanonicalTrack) interface{} { return &t.TrackNumber }},
+	{names: []string{"disc_number", "discNumber"}, kind: fieldCount, field: func(t *CanonicalTrack) interface{} { return &t.DiscNumber }},
+	{names: []string{"isrc"}, kind: fieldString, check: checkISRC, field: func(t *CanonicalTrack) interface{} { return &t.ISRC }},
+	{names: []string{"release_date", "releaseDate"}, kind: fieldString, check: checkReleaseDate, field: func(t *CanonicalTrack) interface{} { return &t.ReleaseDate }},
+	{names: []string{"cover_url", "coverUrl", "coverURL"}, kind: fieldString, check: checkCoverURL, field: func(t *CanonicalTrack) interface{} { return &t.CoverURL }},
+	{names: []string{"images"}, kind: fieldString, check: checkCoverURL, field: func(t *CanonicalTrack) interface{} { return &t.images }},
+	{names: []string{"explicit"}, kind: fieldBool, field: func(t *CanonicalTrack) interface{} { return &t.Explicit }},
+}
+
+func checkISRC(v string) string {
+	normalized := strings.ToUpper(strings.ReplaceAll(v, "-", ""))
+	if !isrcPattern.MatchString(normalized) {
+		return fmt.Sprintf("%q is not a valid ISRC", v)
+	}
+	return ""
+}
+
+func checkReleaseDate(v string) string {
+	if !releaseDatePattern.MatchString(v) {
+		return fmt.Sprintf("%q must start with YYYY, YYYY-MM or YYYY-MM-DD", v)
+	}
+	return ""
+}
+
+func checkCoverURL(v string) string {
+	if !strings.Contains(v, "://") && !strings.HasPrefix(v, "data:") {
+		return fmt.Sprintf("%q must be an absolute URL", v)
+	}
+	return ""
+}
+
+func jsType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func wholeNumber(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		if n != math.Trunc(n) || math.IsInf(n, 0) || math.IsNaN(n) {
+			return 0, false
+		}
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// decodeTrackArtists accepts a joined string or an array of names / {name}
+// objects and returns the individual names.
+func decodeTrackArtists(v interface{}) ([]string, string) {
+	var names []string
+	add := func(name string) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	switch a := v.(type) {
+	case string:
+		for _, name := range strings.Split(a, ",") {
+			add(name)
+		}
+	case []interface{}:
+		for i, item := range a {
+			switch entry := item.(type) {
+			case string:
+				add(entry)
+			case map[string]interface{}:
+				name, ok := entry["name"].(string)
+				if !ok {
+					return nil, fmt.Sprintf("[%d].name must be a string", i)
+				}
+				add(name)
+			default:
+				return nil, fmt.Sprintf("[%d] expected string or {name}, got %s", i, jsType(item))
+			}
+		}
+	default:
+		return nil, "expected string or array, got " + jsType(v)
+	}
+	return names, ""
+}
+
+// decodeTrackField stores value in dst, the CanonicalTrack field of kind.
+// It returns a message when the value has the wrong type.
+func decodeTrackField(kind trackFieldKind, value interface{}, dst interface{}) string {
+	switch kind {
+	case fieldString:
+		s, ok := value.(string)
+		if !ok {
+			return "expected string, got " + jsType(value)
+		}
+		*dst.(*string) = s
+	case fieldID:
+		if s, ok := value.(string); ok {
+			*dst.(*string) = s
+		} else if n, ok := wholeNumber(value); ok {
+			*dst.(*string) = fmt.Sprintf("%d", n)
+		} else {
+			return "expected string or integer, got " + jsType(value)
+		}
+	case fieldArtists:
+		names, msg := decodeTrackArtists(value)
+		if msg != "" {
+			return msg
+		}
+		*dst.(*[]string) = names
+	case fieldCount, fieldDuration:
+		n, ok := wholeNumber(value)
+		if !ok {
+			return "expected integer, got " + jsType(value)
+		}
+		if kind == fieldCount {
+			*dst.(*int) = int(n)
+		} else {
+			*dst.(*int64) = n
+		}
+	case fieldBool:
+		b, ok := value.(bool)
+		if !ok {
+			return "expected boolean, got " + jsType(value)
+		}
+		*dst.(*bool) = b
+	}
+	return ""
+}
+
+// checkTrackField validates a decoded field of t against its schema entry.
+func checkTrackField(field trackFieldSchema, t *CanonicalTrack) string {
+	switch v := field.field(t).(type) {
+	case *string:
+		if field.required && strings.TrimSpace(*v) == "" {
+			return "must not be empty"
+		}
+		if *v != "" && field.check != nil {
+			return field.check(*v)
+		}
+	case *[]string:
+		if len(*v) == 0 {
+			return "must not be empty"
+		}
+	case *int:
+		if *v < 0 {
+			return "must not be negative"
+		}
+	case *int64:
+		if *v < 0 {
+			return "must not be negative"
+		}
+		if field.kind == fieldDuration && *v > maxTrackDurationMs {
+			return fmt.Sprintf("%d is longer than 24h; durations are in milliseconds", *v)
+		}
+	}
+	return ""
+}
+
+// normalizeExtensionTrack decodes an object returned by an extension into a
+// CanonicalTrack, accepting aliases (title, durationMs, artists arrays...),
+// and validates the result against trackSchema. Non-track items from custom
+// search (albums, artists, playlists) do not require artists.
+func normalizeExtensionTrack(raw interface{}, path string) (*CanonicalTrack, error) {
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, &TrackValidationError{Errors: []MetadataFieldError{{Path: path, Message: "expected object, got " + jsType(raw)}}}
+	}
+
+	itemType, _ := obj["item_type"].(string)
+	isTrack := itemType == "" || itemType == "track"
+
+	t := &CanonicalTrack{extra: make(map[string]interface{}, len(obj)), present: make(map[string]bool)}
+	for k, v := range obj {
+		t.extra[k] = v
+	}
+
+	var errs []MetadataFieldError
+	fail := func(key, msg string) {
+		p := key
+		if path != "" {
+			p = path + "." + key
+		}
+		errs = append(errs, MetadataFieldError{Path: p, Message: msg})
+	}
+
+	keys := make(map[string]string, len(trackSchema))
+	for _, field := range trackSchema {
+		for _, name := range field.names {
+			delete(t.extra, name)
+		}
+		for _, name := range field.names {
+			value, ok := obj[name]
+			if !ok || value == nil {
+				continue
+			}
+			if msg := decodeTrackField(field.kind, value, field.field(t)); msg != "" {
+				fail(name, msg)
+				keys[field.names[0]] = ""
+			} else {
+				keys[field.names[0]] = name
+			}
+			break
+		}
+	}
+
+	for _, field := range trackSchema {
+		key, found := keys[field.names[0]]
+		switch {
+		case found && key == "":
+			// Already reported as a type error.
+		case !found:
+			if field.required && (isTrack || field.kind != fieldArtists) {
+				fail(field.names[0], "is required")
+			}
+		default:
+			if msg := checkTrackField(field, t); msg != "" {
+				fail(key, msg)
+				continue
+			}
+			t.present[field.names[0]] = true
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, &TrackValidationError{Errors: errs}
+	}
+	if t.CoverURL == "" {
+		t.CoverURL = t.images
+	}
+	return t, nil
+}
+
+// wireObject returns the track in the keys ExtTrackMetadata decodes,
+// together with the keys the schema does not cover.
+func (t *CanonicalTrack) wireObject() map[string]interface{} {
+	out := make(map[string]interface{}, len(t.extra)+len(t.present))
+	for k, v := range t.extra {
+		out[k] = v
+	}
+	for _, field := range trackSchema {
+		key := field.names[0]
+		if !t.present[key] {
+			continue
+		}
+		switch v := field.field(t).(type) {
+		case *string:
+			out[key] = *v
+		case *[]string:
+			out[key] = strings.Join(*v, ", ")
+		case *int:
+			out[key] = *v
+		case *int64:
+			out[key] = *v
+		case *bool:
+			out[key] = *v
+		}
+	}
+	return out
+}
+
+// normalizeExtensionTrackList validates every entry and drops the malformed
+// ones, logging why. It only fails when nothing valid is left.
+func normalizeExtensionTrackList(extensionID string, raw []interface{}, path string) ([]interface{}, error) {
+	valid := make([]interface{}, 0, len(raw))
+	var firstErr error
+	for i, item := range raw {
+		track, err := normalizeExtensionTrack(item, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			GoLog("[Extension] %s returned malformed track: %v\n", extensionID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		valid = append(valid, track.wireObject())
+	}
+	if len(valid) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return valid, nil
+}
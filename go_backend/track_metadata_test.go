@@ -0,0 +1,94 @@
+package gobackend
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeExtensionTrackRewritesAliases(t *testing.T) {
+	out, err := normalizeExtensionTrack(map[string]interface{}{
+		"id":         int64(42),
+		"title":      "Song",
+		"artists":    []interface{}{"A", map[string]interface{}{"name": "B"}},
+		"durationMs": float64(180000),
+		"isrc":       "us-rc1-17-00001",
+		"explicit":   true,
+	}, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Title != "Song" || strings.Join(out.Artists, "|") != "A|B" || out.DurationMs != 180000 || out.ID != "42" || !out.Explicit {
+		t.Fatalf("unexpected canonical track: %+v", out)
+	}
+
+	wire := out.wireObject()
+	if wire["name"] != "Song" || wire["artists"] != "A, B" || wire["duration_ms"] != int64(180000) || wire["id"] != "42" {
+		t.Fatalf("aliases not rewritten: %#v", wire)
+	}
+	if _, ok := wire["title"]; ok {
+		t.Fatal("alias key should be removed")
+	}
+}
+
+func TestNormalizeExtensionTrackKeepsUnknownKeys(t *testing.T) {
+	out, err := normalizeExtensionTrack(map[string]interface{}{
+		"name":        "Song",
+		"artists":     "A, B",
+		"images":      "https://x/cover.jpg",
+		"provider_id": "ext",
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Artists) != 2 || out.CoverURL != "https://x/cover.jpg" {
+		t.Fatalf("unexpected canonical track: %+v", out)
+	}
+	wire := out.wireObject()
+	if wire["provider_id"] != "ext" || wire["images"] != "https://x/cover.jpg" {
+		t.Fatalf("wire object dropped keys: %#v", wire)
+	}
+	if _, ok := wire["cover_url"]; ok {
+		t.Error("cover_url written although the object only had images")
+	}
+}
+
+func TestNormalizeExtensionTrackReportsEveryField(t *testing.T) {
+	_, err := normalizeExtensionTrack(map[string]interface{}{
+		"name":         "",
+		"duration_ms":  "3:00",
+		"track_number": float64(-1),
+		"release_date": "last year",
+	}, "tracks[2]")
+
+	var verr *TrackValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected TrackValidationError, got %v", err)
+	}
+	want := []string{
+		"tracks[2].name: must not be empty",
+		"tracks[2].artists: is required",
+		"tracks[2].duration_ms: expected integer, got string",
+		"tracks[2].track_number: must not be negative",
+		"tracks[2].release_date:",
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("error %q missing %q", err.Error(), w)
+		}
+	}
+}
+
+func TestNormalizeExtensionTrackListDropsMalformed(t *testing.T) {
+	list, err := normalizeExtensionTrackList("ext", []interface{}{
+		map[string]interface{}{"name": "Ok", "artists": "A"},
+		"not an object",
+	}, "tracks")
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected one valid track, got %d (%v)", len(list), err)
+	}
+
+	if _, err := normalizeExtensionTrackList("ext", []interface{}{"bad"}, "tracks"); err == nil {
+		t.Fatal("expected error when no track is valid")
+	}
+}
@@ -0,0 +1,462 @@
+package gobackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ==================== Per-track task graph ====================
+//
+// A track download is a small DAG:
+//
+//	audio ──┐
+//	cover ──┼──> tag ──> lyrics_write
+//	lyrics ─┘              ^
+//	lyrics ────────────────┘
+//
+// Each task has its own retry policy. Only required tasks (audio) fail the
+// track; an optional task failing is recorded and its dependents are
+// skipped. "after" edges only order tasks (tag waits for cover but still
+// runs without one), "requires" edges also propagate failure. Once a
+// required task fails the graph is cancelled: optional tasks stop retrying
+// and run returns without waiting for them.
+
+const (
+	TrackStageAudio       = "audio"
+	TrackStageCover       = "cover"
+	TrackStageLyrics      = "lyrics"
+	TrackStageTag         = "tag"
+	TrackStageLyricsWrite = "lyrics_write"
+
+	TaskStatusPending   = "pending"
+	TaskStatusRunning   = "running"
+	TaskStatusSucceeded = "succeeded"
+	TaskStatusFailed    = "failed"
+	TaskStatusSkipped   = "skipped"
+)
+
+type TaskRetryPolicy struct {
+	Attempts int
+	Delay    time.Duration
+}
+
+// TrackStage is the reported state of one task.
+type TrackStage struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Attempts   int    `json:"attempts,omitempty"`
+	Optional   bool   `json:"optional,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+}
+
+type trackTask struct {
+	name     string
+	requires []string
+	after    []string
+	optional bool
+	retry    TaskRetryPolicy
+	run      func() error
+
+	done  chan struct{}
+	stage TrackStage
+	err   error
+}
+
+type trackTaskGraph struct {
+	itemID string
+	tasks  []*trackTask
+	byName map[string]*trackTask
+	mu     sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newTrackTaskGraph(itemID string) *trackTaskGraph {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &trackTaskGraph{itemID: itemID, byName: make(map[string]*trackTask), ctx: ctx, cancel: cancel}
+}
+
+func (g *trackTaskGraph) add(task *trackTask) {
+	if task.retry.Attempts < 1 {
+		task.retry.Attempts = 1
+	}
+	task.done = make(chan struct{})
+	task.stage = TrackStage{Name: task.name, Status: TaskStatusPending, Optional: task.optional}
+	g.tasks = append(g.tasks, task)
+	g.byName[task.name] = task
+}
+
+// validate rejects unknown dependencies and cycles.
+func (g *trackTaskGraph) validate() error {
+	state := make(map[string]int) // 0 unvisited, 1 visiting, 2 done
+	var visit func(name string) error
+	visit = func(name string) error {
+		task, ok := g.byName[name]
+		if !ok {
+			return fmt.Errorf("unknown task %q", name)
+		}
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("task graph has a cycle through %q", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, dep := range append(append([]string{}, task.requires...), task.after...) {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	for _, task := range g.tasks {
+		if err := visit(task.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update changes a task's stage. Once the graph is cancelled run has
+// already published the final stages, so late updates from abandoned
+// tasks are kept local.
+func (g *trackTaskGraph) update(task *trackTask, fn func(*TrackStage)) {
+	g.mu.Lock()
+	fn(&task.stage)
+	g.mu.Unlock()
+	if g.ctx.Err() == nil {
+		g.publish()
+	}
+}
+
+// wait blocks until dep finishes or the graph is cancelled.
+func (g *trackTaskGraph) wait(dep *trackTask) bool {
+	select {
+	case <-dep.done:
+		return true
+	case <-g.ctx.Done():
+		return false
+	}
+}
+
+func (g *trackTaskGraph) skip(task *trackTask, err error) {
+	task.err = err
+	g.update(task, func(s *TrackStage) {
+		s.Status = TaskStatusSkipped
+		s.Error = err.Error()
+	})
+}
+
+func (g *trackTaskGraph) stages() []TrackStage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stages := make([]TrackStage, len(g.tasks))
+	for i, task := range g.tasks {
+		stages[i] = task.stage
+	}
+	return stages
+}
+
+func (g *trackTaskGraph) publish() {
+	if g.itemID != "" {
+		SetItemStages(g.itemID, g.stages())
+	}
+}
+
+func (g *trackTaskGraph) execute(task *trackTask) {
+	defer close(task.done)
+
+	for _, dep := range task.after {
+		if !g.wait(g.byName[dep]) {
+			g.skip(task, context.Canceled)
+			return
+		}
+	}
+	for _, dep := range task.requires {
+		depTask := g.byName[dep]
+		if !g.wait(depTask) {
+			g.skip(task, context.Canceled)
+			return
+		}
+		if depTask.err != nil {
+			g.skip(task, fmt.Errorf("%s did not complete", dep))
+			return
+		}
+	}
+
+	spanName := task.name
+	if spanName == TrackStageAudio {
+		spanName = TraceSpanFetch
+	}
+	span := startTraceSpan(g.itemID, spanName, map[string]interface{}{"optional": task.optional})
+	defer func() {
+		span.SetAttr("attempts", task.stage.Attempts)
+		span.End(task.err)
+	}()
+
+	start := time.Now()
+	for attempt := 1; attempt <= task.retry.Attempts; attempt++ {
+		g.update(task, func(s *TrackStage) {
+			s.Status = TaskStatusRunning
+			s.Attempts = attempt
+		})
+		task.err = task.run()
+		if task.err == nil || errors.Is(task.err, ErrDownloadCancelled) {
+			break
+		}
+		if attempt < task.retry.Attempts {
+			GoLog("[Tasks] %s attempt %d/%d failed: %v\n", task.name, attempt, task.retry.Attempts, task.err)
+			timer := time.NewTimer(task.retry.Delay * time.Duration(attempt))
+			select {
+			case <-timer.C:
+				continue
+			case <-g.ctx.Done():
+				timer.Stop()
+			}
+			break
+		}
+	}
+
+	g.update(task, func(s *TrackStage) {
+		s.DurationMs = time.Since(start).Milliseconds()
+		if task.err != nil {
+			s.Status = TaskStatusFailed
+			s.Error = task.err.Error()
+		} else {
+			s.Status = TaskStatusSucceeded
+		}
+	})
+}
+
+// run executes every task as soon as its dependencies finish and returns the
+// first required task's error. Optional failures are only reported. When a
+// required task fails the optional ones are cancelled and run returns
+// without waiting for their in-flight attempt.
+func (g *trackTaskGraph) run() error {
+	defer g.cancel()
+	if err := g.validate(); err != nil {
+		return err
+	}
+	g.publish()
+
+	var wg sync.WaitGroup
+	for _, task := range g.tasks {
+		wg.Add(1)
+		go func(task *trackTask) {
+			defer wg.Done()
+			g.execute(task)
+		}(task)
+	}
+
+	for _, task := range g.tasks {
+		if task.optional {
+			continue
+		}
+		<-task.done
+		if task.err == nil {
+			continue
+		}
+		g.cancel()
+		g.mu.Lock()
+		for _, other := range g.tasks {
+			if other.stage.Status == TaskStatusPending || other.stage.Status == TaskStatusRunning {
+				other.stage.Status = TaskStatusSkipped
+				other.stage.Error = fmt.Sprintf("cancelled, %s failed", task.name)
+			}
+		}
+		g.mu.Unlock()
+		g.publish()
+		if errors.Is(task.err, ErrDownloadCancelled) {
+			return ErrDownloadCancelled
+		}
+		return task.err
+	}
+	wg.Wait()
+	return nil
+}
+
+var (
+	coverTaskRetry  = TaskRetryPolicy{Attempts: 3, Delay: 500 * time.Millisecond}
+	lyricsTaskRetry = TaskRetryPolicy{Attempts: 2, Delay: time.Second}
+)
+
+// trackPipeline wires a provider's audio download, the shared cover and
+// lyrics fetches and the provider's tagging into one task graph.
+type trackPipeline struct {
+	graph  *trackTaskGraph
+	mu     sync.Mutex
+	assets ParallelDownloadResult
+}
+
+// newTrackPipeline adds the audio task and, when the request needs them
+// (see StartTrackAssetFetch for embedOnly), the cover and lyrics fetches.
+func newTrackPipeline(req DownloadRequest, embedOnly bool, audio func() error) *trackPipeline {
+	p := &trackPipeline{graph: newTrackTaskGraph(req.ItemID)}
+	p.graph.add(&trackTask{name: TrackStageAudio, run: audio})
+
+	hasCover, embedLyrics := req.CoverURL != "" || len(req.CoverCandidates) > 0, req.EmbedLyrics
+	if embedOnly && !req.EmbedMetadata {
+		hasCover, embedLyrics = false, false
+	}
+
+	if hasCover {
+		var coverURL string
+		var resolveCover sync.Once
+		p.graph.add(&trackTask{name: TrackStageCover, optional: true, retry: coverTaskRetry, run: func() error {
+			resolveCover.Do(func() { coverURL = resolveTrackCoverURL(req) })
+			data, err := fetchTrackCover(coverURL, req.EmbedMaxQualityCover)
+			p.mu.Lock()
+			p.assets.CoverData, p.assets.CoverErr = data, err
+			p.mu.Unlock()
+			return err
+		}})
+	}
+	if embedLyrics {
+		p.graph.add(&trackTask{name: TrackStageLyrics, optional: true, retry: lyricsTaskRetry, run: func() error {
+			lyrics, lrc, tags, err := fetchTrackLyrics(req.SpotifyID, req.matchTitle(), req.matchArtist(), int64(req.DurationMS))
+			p.mu.Lock()
+			p.assets.LyricsData, p.assets.LyricsLRC, p.assets.LyricsTags, p.assets.LyricsErr = lyrics, lrc, tags, err
+			p.mu.Unlock()
+			return err
+		}})
+	}
+	return p
+}
+
+func (p *trackPipeline) fetched(names ...string) []string {
+	var present []string
+	for _, name := range names {
+		if _, ok := p.graph.byName[name]; ok {
+			present = append(present, name)
+		}
+	}
+	return present
+}
+
+// Assets returns what the cover and lyrics tasks produced so far.
+func (p *trackPipeline) Assets() *ParallelDownloadResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	assets := p.assets
+	return &assets
+}
+
+// Tag runs after the audio succeeded and the asset fetches finished, with
+// or without a cover. Its failure does not fail the track.
+func (p *trackPipeline) Tag(run func(assets *ParallelDownloadResult) error) {
+	p.graph.add(&trackTask{
+		name:     TrackStageTag,
+		requires: []string{TrackStageAudio},
+		after:    p.fetched(TrackStageCover, TrackStageLyrics),
+		optional: true,
+		run:      func() error { return run(p.Assets()) },
+	})
+}
+
+// WriteLyrics embeds or saves the fetched lyrics once tagging is done (tag
+// rewrites the file, so lyrics go in afterwards). It is skipped when no
+// lyrics were found.
+func (p *trackPipeline) WriteLyrics(run func(lrc string, lyrics *LyricsResponse) error) {
+	if _, ok := p.graph.byName[TrackStageLyrics]; !ok {
+		return
+	}
+	p.graph.add(&trackTask{
+		name:     TrackStageLyricsWrite,
+		requires: []string{TrackStageAudio, TrackStageLyrics},
+		after:    p.fetched(TrackStageTag),
+		optional: true,
+		run: func() error {
+			assets := p.Assets()
+			return run(assets.LyricsLRC, assets.LyricsData)
+		},
+	})
+}
+
+// Run executes the graph. Only an audio failure is returned.
+func (p *trackPipeline) Run() (*ParallelDownloadResult, error) {
+	err := p.graph.run()
+	return p.Assets(), err
+}
+
+// writeLyricsOutputs applies the lyrics mode: "embed" (default), "external"
+// (.lrc next to the file) or "both". External files need a real path.
+func writeLyricsOutputs(logTag, outputPath, lrc string, lyrics *LyricsResponse, mode string, canSaveExternal, canEmbed bool) error {
+	if mode == "" {
+		mode = "embed"
+	}
+
+	var errs []error
+	if canSaveExternal && (mode == "external" || mode == "both") {
+		GoLog("[%s] Saving external LRC file...\n", logTag)
+		if lrcPath, err := SaveLRCFile(outputPath, lrc); err != nil {
+			GoLog("[%s] Warning: failed to save LRC file: %v\n", logTag, err)
+			errs = append(errs, err)
+		} else {
+			GoLog("[%s] LRC file saved: %s\n", logTag, lrcPath)
+		}
+	}
+
+	if canEmbed && (mode == "embed" || mode == "both") {
+		lines := 0
+		if lyrics != nil {
+			lines = len(lyrics.Lines)
+		}
+		GoLog("[%s] Embedding fetched lyrics (%d lines)...\n", logTag, lines)
+		if err := EmbedLyrics(outputPath, lrc); err != nil {
+			GoLog("[%s] Warning: failed to embed lyrics: %v\n", logTag, err)
+			errs = append(errs, err)
+		} else {
+			GoLog("[%s] Lyrics embedded successfully\n", logTag)
+			if err := embedSecondaryLyrics(outputPath, lyrics); err != nil {
+				GoLog("[%s] Warning: failed to embed secondary lyrics: %v\n", logTag, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	trackStagesMu sync.RWMutex
+	trackStages   = make(map[string][]TrackStage)
+)
+
+// SetItemStages records the per-task state of itemID for the status API.
+func SetItemStages(itemID string, stages []TrackStage) {
+	trackStagesMu.Lock()
+	trackStages[itemID] = stages
+	trackStagesMu.Unlock()
+
+	multiMu.Lock()
+	if item, ok := multiProgress.Items[itemID]; ok {
+		item.Stages = stages
+	}
+	multiMu.Unlock()
+}
+
+func GetItemStages(itemID string) []TrackStage {
+	trackStagesMu.RLock()
+	defer trackStagesMu.RUnlock()
+	return append([]TrackStage{}, trackStages[itemID]...)
+}
+
+// FailedStage names the first failed or skipped stage of itemID, or "".
+func FailedStage(itemID string) string {
+	for _, stage := range GetItemStages(itemID) {
+		if stage.Status == TaskStatusFailed || stage.Status == TaskStatusSkipped {
+			return stage.Name
+		}
+	}
+	return ""
+}
+
+func clearItemStages(itemID string) {
+	trackStagesMu.Lock()
+	delete(trackStages, itemID)
+	trackStagesMu.Unlock()
+}
@@ -0,0 +1,151 @@
+package gobackend
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTrackTaskGraph_OptionalFailureDoesNotFailTrack(t *testing.T) {
+	const itemID = "task-graph-optional"
+	defer clearItemStages(itemID)
+
+	var audioRuns, coverRuns int32
+	g := newTrackTaskGraph(itemID)
+	g.add(&trackTask{name: TrackStageAudio, run: func() error {
+		atomic.AddInt32(&audioRuns, 1)
+		return nil
+	}})
+	g.add(&trackTask{name: TrackStageCover, optional: true, retry: TaskRetryPolicy{Attempts: 3}, run: func() error {
+		if atomic.AddInt32(&coverRuns, 1) < 3 {
+			return errors.New("cover CDN 503")
+		}
+		return nil
+	}})
+	g.add(&trackTask{name: TrackStageLyrics, optional: true, run: func() error {
+		return errors.New("no lyrics found")
+	}})
+	tagged := false
+	g.add(&trackTask{name: TrackStageTag, requires: []string{TrackStageAudio}, after: []string{TrackStageCover, TrackStageLyrics}, optional: true, run: func() error {
+		tagged = true
+		return nil
+	}})
+	g.add(&trackTask{name: TrackStageLyricsWrite, requires: []string{TrackStageLyrics}, after: []string{TrackStageTag}, optional: true, run: func() error {
+		t.Error("lyrics_write ran although lyrics failed")
+		return nil
+	}})
+
+	if err := g.run(); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if audioRuns != 1 || coverRuns != 3 {
+		t.Errorf("audio ran %d times, cover %d times; want 1 and 3", audioRuns, coverRuns)
+	}
+	if !tagged {
+		t.Error("tag did not run")
+	}
+
+	statuses := map[string]string{}
+	for _, stage := range GetItemStages(itemID) {
+		statuses[stage.Name] = stage.Status
+	}
+	want := map[string]string{
+		TrackStageAudio:       TaskStatusSucceeded,
+		TrackStageCover:       TaskStatusSucceeded,
+		TrackStageLyrics:      TaskStatusFailed,
+		TrackStageTag:         TaskStatusSucceeded,
+		TrackStageLyricsWrite: TaskStatusSkipped,
+	}
+	for name, status := range want {
+		if statuses[name] != status {
+			t.Errorf("stage %s = %q, want %q", name, statuses[name], status)
+		}
+	}
+	if FailedStage(itemID) != TrackStageLyrics {
+		t.Errorf("FailedStage = %q, want lyrics", FailedStage(itemID))
+	}
+}
+
+func TestTrackTaskGraph_RequiredFailure(t *testing.T) {
+	g := newTrackTaskGraph("")
+	g.add(&trackTask{name: TrackStageAudio, retry: TaskRetryPolicy{Attempts: 5, Delay: time.Hour}, run: func() error {
+		return ErrDownloadCancelled
+	}})
+	g.add(&trackTask{name: TrackStageTag, requires: []string{TrackStageAudio}, optional: true, run: func() error {
+		t.Error("tag ran although audio failed")
+		return nil
+	}})
+
+	if err := g.run(); !errors.Is(err, ErrDownloadCancelled) {
+		t.Fatalf("run = %v, want ErrDownloadCancelled", err)
+	}
+	if attempts := g.byName[TrackStageAudio].stage.Attempts; attempts != 1 {
+		t.Errorf("cancelled task was retried %d times", attempts)
+	}
+}
+
+func TestTrackTaskGraph_Validate(t *testing.T) {
+	g := newTrackTaskGraph("")
+	g.add(&trackTask{name: "a", requires: []string{"b"}, run: func() error { return nil }})
+	g.add(&trackTask{name: "b", after: []string{"a"}, run: func() error { return nil }})
+	if err := g.run(); err == nil {
+		t.Error("expected cycle to be rejected")
+	}
+
+	g = newTrackTaskGraph("")
+	g.add(&trackTask{name: "a", requires: []string{"missing"}, run: func() error { return nil }})
+	if err := g.run(); err == nil {
+		t.Error("expected unknown dependency to be rejected")
+	}
+}
+
+func TestTrackTaskGraph_RequiredFailureCancelsOptional(t *testing.T) {
+	const itemID = "task-graph-cancel"
+	defer clearItemStages(itemID)
+
+	var coverRuns int32
+	g := newTrackTaskGraph(itemID)
+	g.add(&trackTask{name: TrackStageAudio, run: func() error {
+		time.Sleep(20 * time.Millisecond)
+		return errors.New("audio 404")
+	}})
+	g.add(&trackTask{name: TrackStageCover, optional: true, retry: TaskRetryPolicy{Attempts: 3, Delay: time.Hour}, run: func() error {
+		atomic.AddInt32(&coverRuns, 1)
+		return errors.New("cover CDN 503")
+	}})
+	lyricsRelease := make(chan struct{})
+	defer close(lyricsRelease)
+	g.add(&trackTask{name: TrackStageLyrics, optional: true, run: func() error {
+		<-lyricsRelease
+		return nil
+	}})
+	g.add(&trackTask{name: TrackStageTag, requires: []string{TrackStageAudio}, after: []string{TrackStageCover, TrackStageLyrics}, optional: true, run: func() error {
+		t.Error("tag ran although audio failed")
+		return nil
+	}})
+
+	start := time.Now()
+	if err := g.run(); err == nil || err.Error() != "audio 404" {
+		t.Fatalf("run = %v, want audio error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("run waited %v for optional tasks", elapsed)
+	}
+	if runs := atomic.LoadInt32(&coverRuns); runs != 1 {
+		t.Errorf("cover ran %d times after audio failed, want 1", runs)
+	}
+
+	statuses := map[string]string{}
+	for _, stage := range GetItemStages(itemID) {
+		statuses[stage.Name] = stage.Status
+	}
+	if statuses[TrackStageAudio] != TaskStatusFailed {
+		t.Errorf("audio stage = %q, want failed", statuses[TrackStageAudio])
+	}
+	for _, name := range []string{TrackStageCover, TrackStageLyrics, TrackStageTag} {
+		if statuses[name] != TaskStatusSkipped {
+			t.Errorf("stage %s = %q, want skipped", name, statuses[name])
+		}
+	}
+}
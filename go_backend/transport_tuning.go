@@ -0,0 +1,248 @@
+package gobackend
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransportTuning exposes the connection pool knobs of the shared and
+// metadata transports. Some provider CDNs throttle HTTP/1.1 while others
+// break on HTTP/2, so HTTP/2 can be turned off globally or per host. Hosts
+// that reject Go's TLS ClientHello can be sent through the uTLS Chrome
+// fingerprint instead.
+type TransportTuning struct {
+	MaxConnsPerHost        int      `json:"max_conns_per_host"`
+	MaxIdleConnsPerHost    int      `json:"max_idle_conns_per_host"`
+	IdleConnTimeoutSeconds int      `json:"idle_conn_timeout_seconds"`
+	HTTP2                  bool     `json:"http2"`
+	HTTP2DisabledHosts     []string `json:"http2_disabled_hosts,omitempty"`
+	TLSSessionCacheSize    int      `json:"tls_session_cache_size"`
+	UTLSHosts              []string `json:"utls_hosts,omitempty"`
+}
+
+const (
+	maxTuningConnsPerHost   = 64
+	maxTuningIdleSeconds    = 600
+	maxTuningTLSSessionSize = 1024
+)
+
+func DefaultTransportTuning() TransportTuning {
+	return TransportTuning{
+		MaxConnsPerHost:        20,
+		MaxIdleConnsPerHost:    10,
+		IdleConnTimeoutSeconds: 90,
+		HTTP2:                  true,
+		TLSSessionCacheSize:    64,
+	}
+}
+
+// Validate normalizes t in place and reports the first invalid field.
+func (t *TransportTuning) Validate() error {
+	if t.MaxConnsPerHost < 1 || t.MaxConnsPerHost > maxTuningConnsPerHost {
+		return fmt.Errorf("max_conns_per_host must be between 1 and %d", maxTuningConnsPerHost)
+	}
+	if t.MaxIdleConnsPerHost < 0 || t.MaxIdleConnsPerHost > t.MaxConnsPerHost {
+		return fmt.Errorf("max_idle_conns_per_host must be between 0 and max_conns_per_host")
+	}
+	if t.IdleConnTimeoutSeconds < 1 || t.IdleConnTimeoutSeconds > maxTuningIdleSeconds {
+		return fmt.Errorf("idle_conn_timeout_seconds must be between 1 and %d", maxTuningIdleSeconds)
+	}
+	if t.TLSSessionCacheSize < 0 || t.TLSSessionCacheSize > maxTuningTLSSessionSize {
+		return fmt.Errorf("tls_session_cache_size must be between 0 and %d", maxTuningTLSSessionSize)
+	}
+
+	t.HTTP2DisabledHosts = normalizeHostList(t.HTTP2DisabledHosts)
+	t.UTLSHosts = normalizeHostList(t.UTLSHosts)
+	return nil
+}
+
+// normalizeHostList lowercases hosts and strips "*." since every entry
+// already covers its subdomains.
+func normalizeHostList(hosts []string) []string {
+	var normalized []string
+	for _, host := range hosts {
+		host = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(host)), "*.")
+		if host != "" {
+			normalized = append(normalized, host)
+		}
+	}
+	return normalized
+}
+
+func hostInList(host string, hosts []string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range hosts {
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	transportTuningMu sync.RWMutex
+	transportTuning   = DefaultTransportTuning()
+	tlsSessionCache   = tls.NewLRUClientSessionCache(DefaultTransportTuning().TLSSessionCacheSize)
+)
+
+func init() {
+	// Install the default TLS session cache before the first request.
+	for _, pool := range allTransportPools() {
+		pool.reconfigure(func(transport *http.Transport, _ bool) {
+			applyTLSCompatibility(transport, false)
+		})
+	}
+}
+
+func GetTransportTuning() TransportTuning {
+	transportTuningMu.RLock()
+	defer transportTuningMu.RUnlock()
+	tuning := transportTuning
+	tuning.HTTP2DisabledHosts = append([]string(nil), transportTuning.HTTP2DisabledHosts...)
+	tuning.UTLSHosts = append([]string(nil), transportTuning.UTLSHosts...)
+	return tuning
+}
+
+func GetTransportTuningJSON() (string, error) {
+	jsonBytes, err := json.Marshal(GetTransportTuning())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+// SetTransportTuningJSON merges the given fields into the current tuning and
+// applies it. Idle connections are dropped so new limits take effect.
+func SetTransportTuningJSON(tuningJSON string) error {
+	tuning := GetTransportTuning()
+	if err := json.Unmarshal([]byte(tuningJSON), &tuning); err != nil {
+		return fmt.Errorf("invalid transport tuning: %w", err)
+	}
+	return SetTransportTuning(tuning)
+}
+
+func SetTransportTuning(tuning TransportTuning) error {
+	if err := tuning.Validate(); err != nil {
+		return err
+	}
+
+	transportTuningMu.Lock()
+	if tuning.TLSSessionCacheSize != transportTuning.TLSSessionCacheSize {
+		if tuning.TLSSessionCacheSize > 0 {
+			tlsSessionCache = tls.NewLRUClientSessionCache(tuning.TLSSessionCacheSize)
+		} else {
+			tlsSessionCache = nil
+		}
+	}
+	transportTuning = tuning
+	transportTuningMu.Unlock()
+
+	insecureTLS := GetNetworkCompatibilityOptions().InsecureTLS
+	for _, pool := range allTransportPools() {
+		pool.reconfigure(func(transport *http.Transport, metadata bool) {
+			applyTransportTuning(transport, tuning, metadata)
+			applyTLSCompatibility(transport, insecureTLS)
+		})
+	}
+
+	GoLog("[HTTP] Transport tuning updated: max_conns=%d max_idle=%d idle=%ds http2=%v h2_disabled=%v tls_cache=%d utls=%v\n",
+		tuning.MaxConnsPerHost, tuning.MaxIdleConnsPerHost, tuning.IdleConnTimeoutSeconds,
+		tuning.HTTP2, tuning.HTTP2DisabledHosts, tuning.TLSSessionCacheSize, tuning.UTLSHosts)
+	return nil
+}
+
+// applyTransportTuning scales the per-host limits. The metadata pool keeps
+// its smaller size relative to the shared pool.
+func applyTransportTuning(transport *http.Transport, tuning TransportTuning, metadata bool) {
+	maxConns, maxIdle := tuning.MaxConnsPerHost, tuning.MaxIdleConnsPerHost
+	if metadata {
+		maxConns, maxIdle = max(1, maxConns/2), maxIdle/2
+	}
+	transport.MaxConnsPerHost = maxConns
+	transport.MaxIdleConnsPerHost = maxIdle
+	transport.IdleConnTimeout = time.Duration(tuning.IdleConnTimeoutSeconds) * time.Second
+}
+
+func currentTLSSessionCache() tls.ClientSessionCache {
+	transportTuningMu.RLock()
+	defer transportTuningMu.RUnlock()
+	return tlsSessionCache
+}
+
+// http2AllowedForHost reports whether host (or a parent domain of it) may
+// use HTTP/2.
+func http2AllowedForHost(host string) bool {
+	transportTuningMu.RLock()
+	defer transportTuningMu.RUnlock()
+
+	return transportTuning.HTTP2 && !hostInList(host, transportTuning.HTTP2DisabledHosts)
+}
+
+// utlsEnabledForHost reports whether host is configured, in settings or by
+// the calling extension's manifest, to use the uTLS fingerprint.
+func utlsEnabledForHost(host string, extraHosts []string) bool {
+	if hostInList(host, extraHosts) {
+		return true
+	}
+	transportTuningMu.RLock()
+	defer transportTuningMu.RUnlock()
+	return hostInList(host, transportTuning.UTLSHosts)
+}
+
+// newHTTP1Transport clones base with HTTP/2 negotiation switched off.
+func newHTTP1Transport(base *http.Transport) *http.Transport {
+	t := base.Clone()
+	t.ForceAttemptHTTP2 = false
+	t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	return t
+}
+
+// hostPolicyTransport sends each request through the pool's HTTP/2-capable
+// transport, its HTTP/1.1-only twin, or the uTLS transport depending on the
+// host's policy. utlsHosts adds hosts on top of the global setting (used for
+// extensions that declare the tlsFingerprint capability).
+type hostPolicyTransport struct {
+	pool      *transportPool
+	utlsHosts []string
+}
+
+func (t *hostPolicyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL == nil {
+		h2, _ := t.pool.transports()
+		return h2.RoundTrip(req)
+	}
+	host := req.URL.Hostname()
+	if err := injectFault(faultStageRequest, host); err != nil {
+		return nil, err
+	}
+	resp, err := t.roundTrip(req, host)
+	if err == nil {
+		resp.Body = wrapFaultBody(host, resp.Body)
+	}
+	return resp, err
+}
+
+func (t *hostPolicyTransport) roundTrip(req *http.Request, host string) (*http.Response, error) {
+
+	if req.URL.Scheme == "https" && utlsEnabledForHost(host, t.utlsHosts) {
+		if rt := utlsRoundTripper(); rt == nil {
+			LogDebug("HTTP", "uTLS requested for %s but not available on this platform", host)
+		} else if proxyURL, _ := configuredProxy(req); proxyURL != nil {
+			// The uTLS dialer connects directly; honoring the proxy wins.
+			LogDebug("HTTP", "uTLS requested for %s but a proxy is configured, using standard TLS", host)
+		} else {
+			return rt.RoundTrip(req)
+		}
+	}
+
+	h2, h1 := t.pool.transports()
+	if !http2AllowedForHost(host) {
+		return h1.RoundTrip(req)
+	}
+	return h2.RoundTrip(req)
+}
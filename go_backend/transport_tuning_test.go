@@ -0,0 +1,71 @@
+package gobackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTransportTuningAppliesToPools(t *testing.T) {
+	prev := GetTransportTuning()
+	defer SetTransportTuning(prev)
+
+	before, _ := sharedPool.transports()
+	beforeConns := before.MaxConnsPerHost
+
+	if err := SetTransportTuningJSON(`{"max_conns_per_host":8,"max_idle_conns_per_host":4,"idle_conn_timeout_seconds":30,"http2_disabled_hosts":[" *.CDN.example.com "]}`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	shared, sharedH1 := sharedPool.transports()
+	if shared.MaxConnsPerHost != 8 || shared.IdleConnTimeout != 30*time.Second || sharedH1.MaxConnsPerHost != 8 {
+		t.Fatalf("shared pool not tuned: conns=%d idle=%s", shared.MaxConnsPerHost, shared.IdleConnTimeout)
+	}
+	if before == shared || before.MaxConnsPerHost != beforeConns {
+		t.Fatal("tuning must swap in a clone instead of changing the transport in use")
+	}
+	if metadata, _ := metadataPool.transports(); metadata.MaxConnsPerHost != 4 {
+		t.Fatalf("metadata pool should stay half size, got %d", metadata.MaxConnsPerHost)
+	}
+	if shared.TLSClientConfig == nil || shared.TLSClientConfig.ClientSessionCache == nil {
+		t.Fatal("expected TLS session cache to be installed")
+	}
+
+	if http2AllowedForHost("a.cdn.example.com") || http2AllowedForHost("cdn.example.com") {
+		t.Fatal("HTTP/2 should be disabled for the host and its subdomains")
+	}
+	if !http2AllowedForHost("example.com") {
+		t.Fatal("HTTP/2 should stay enabled for other hosts")
+	}
+
+	if err := SetTransportTuningJSON(`{"max_idle_conns_per_host":100}`); err == nil {
+		t.Fatal("expected error when idle limit exceeds conns limit")
+	}
+}
+
+func TestUTLSHostSelection(t *testing.T) {
+	prev := GetTransportTuning()
+	defer SetTransportTuning(prev)
+
+	if err := SetTransportTuningJSON(`{"utls_hosts":["*.Blocked.example"]}`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !utlsEnabledForHost("api.blocked.example", nil) {
+		t.Fatal("expected uTLS for configured host")
+	}
+	if utlsEnabledForHost("open.example", nil) {
+		t.Fatal("uTLS should be opt-in per host")
+	}
+
+	manifest := &ExtensionManifest{
+		Permissions:  ExtensionPermissions{Network: []string{"api.provider.example", "*.cdn.example"}},
+		Capabilities: map[string]interface{}{"tlsFingerprint": true},
+	}
+	hosts := manifest.TLSFingerprintHosts()
+	if !utlsEnabledForHost("img.cdn.example", hosts) || !utlsEnabledForHost("api.provider.example", hosts) {
+		t.Fatalf("manifest capability should cover its network permissions, got %v", hosts)
+	}
+
+	manifest.Capabilities["tlsFingerprint"] = []interface{}{"api.provider.example"}
+	if hosts := manifest.TLSFingerprintHosts(); utlsEnabledForHost("img.cdn.example", hosts) {
+		t.Fatalf("explicit list should narrow the hosts, got %v", hosts)
+	}
+}
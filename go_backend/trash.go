@@ -0,0 +1,384 @@
+package gobackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Trash ====================
+//
+// Files the backend would delete or overwrite go to a managed trash folder
+// and are purged after BackendConfig.TrashRetentionDays (0 turns the trash
+// off). Regular files are moved. SAF documents cannot be removed from Go:
+// their content is copied into the trash and the entry is marked
+// DocumentDeleteRequired so Flutter deletes the document itself, and they
+// can only be restored to a document Flutter creates (RestoreFromTrashTo).
+
+const (
+	trashIndexFile            = "trash.json"
+	defaultTrashRetentionDays = 30
+	maxTrashRetentionDays     = 3650
+
+	TrashReasonDeleted     = "deleted"
+	TrashReasonReplaced    = "replaced"
+	TrashReasonSyncRemoved = "sync_removed"
+)
+
+type TrashEntry struct {
+	ID                     string `json:"id"`
+	OriginalPath           string `json:"original_path"`
+	TrashPath              string `json:"trash_path"`
+	Reason                 string `json:"reason"`
+	Size                   int64  `json:"size"`
+	TrashedAt              int64  `json:"trashed_at"`
+	ExpiresAt              int64  `json:"expires_at"`
+	DocumentDeleteRequired bool   `json:"document_delete_required,omitempty"`
+}
+
+var (
+	trashMu      sync.Mutex
+	trashDir     string
+	trashEntries []TrashEntry
+)
+
+// SetTrashDir points the trash at dir, loads its index and purges expired
+// entries.
+func SetTrashDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create trash dir: %w", err)
+	}
+	trashMu.Lock()
+	if err := openStore(dir, trashStoreSchema); err != nil {
+		trashMu.Unlock()
+		return err
+	}
+
+	var entries []TrashEntry
+	if data, err := os.ReadFile(filepath.Join(dir, trashIndexFile)); err == nil {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			GoLog("[Trash] Ignoring corrupt %s: %v\n", trashIndexFile, err)
+			entries = nil
+		}
+	}
+	trashDir = dir
+	trashEntries = entries
+	trashMu.Unlock()
+
+	PurgeTrash(false)
+	return nil
+}
+
+func trashEnabled() bool {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	return trashDir != "" && GetBackendConfig().TrashRetentionDays > 0
+}
+
+func saveTrashIndexLocked() error {
+	if trashDir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(trashEntries, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(trashDir, trashIndexFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// copyFileContents copies src into the writer opened for dst.
+func copyFileContents(src string, dst *os.File) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	written, err := io.Copy(dst, in)
+	if err == nil {
+		err = dst.Sync()
+	}
+	return written, err
+}
+
+// MoveToTrash moves path into the trash. For SAF paths the content is copied
+// and the caller still has to delete the document.
+func MoveToTrash(path, reason string) (*TrashEntry, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	if !trashEnabled() {
+		return nil, fmt.Errorf("trash is not enabled")
+	}
+	if reason == "" {
+		reason = TrashReasonDeleted
+	}
+
+	trashMu.Lock()
+	dir := trashDir
+	trashMu.Unlock()
+
+	now := time.Now()
+	id := fmt.Sprintf("%d_%08x", now.UnixNano(), hashString(path))
+	entry := TrashEntry{
+		ID:           id,
+		OriginalPath: path,
+		TrashPath:    filepath.Join(dir, id+strings.ToLower(filepath.Ext(path))),
+		Reason:       reason,
+		TrashedAt:    now.Unix(),
+		ExpiresAt:    now.AddDate(0, 0, GetBackendConfig().TrashRetentionDays).Unix(),
+	}
+
+	if isSAFPath(path) {
+		out, err := os.OpenFile(entry.TrashPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return nil, err
+		}
+		entry.Size, err = copyFileContents(path, out)
+		out.Close()
+		if err != nil {
+			os.Remove(entry.TrashPath)
+			return nil, fmt.Errorf("failed to copy document to trash: %w", err)
+		}
+		entry.DocumentDeleteRequired = true
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("cannot trash a directory")
+		}
+		entry.Size = info.Size()
+		if _, err := moveLibraryFile(path, entry.TrashPath); err != nil {
+			return nil, fmt.Errorf("failed to move to trash: %w", err)
+		}
+	}
+
+	trashMu.Lock()
+	trashEntries = append(trashEntries, entry)
+	err := saveTrashIndexLocked()
+	trashMu.Unlock()
+	if err != nil {
+		GoLog("[Trash] Failed to save index: %v\n", err)
+	}
+
+	GoLog("[Trash] %s %s (%s)\n", reason, filepath.Base(path), id)
+	return &entry, nil
+}
+
+// trashOrRemove trashes path when the trash is on and deletes it otherwise.
+func trashOrRemove(path, reason string) error {
+	if trashEnabled() {
+		_, err := MoveToTrash(path, reason)
+		return err
+	}
+	return os.Remove(path)
+}
+
+func takeTrashEntry(id string) (TrashEntry, error) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	for i, entry := range trashEntries {
+		if entry.ID == id {
+			trashEntries = append(trashEntries[:i:i], trashEntries[i+1:]...)
+			return entry, saveTrashIndexLocked()
+		}
+	}
+	return TrashEntry{}, fmt.Errorf("trash entry not found: %s", id)
+}
+
+func findTrashEntry(id string) (TrashEntry, bool) {
+	trashMu.Lock()
+	defer trashMu.Unlock()
+	for _, entry := range trashEntries {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return TrashEntry{}, false
+}
+
+// RestoreFromTrash moves an entry back to its original path. It refuses to
+// overwrite a file that now lives there, and SAF entries need
+// RestoreFromTrashTo.
+func RestoreFromTrash(id string) (*TrashEntry, error) {
+	entry, ok := findTrashEntry(id)
+	if !ok {
+		return nil, fmt.Errorf("trash entry not found: %s", id)
+	}
+	if entry.DocumentDeleteRequired {
+		return nil, fmt.Errorf("document entries must be restored to a new document")
+	}
+	if _, err := os.Stat(entry.OriginalPath); err == nil {
+		return nil, fmt.Errorf("original path is in use: %s", entry.OriginalPath)
+	}
+	if _, err := moveLibraryFile(entry.TrashPath, entry.OriginalPath); err != nil {
+		return nil, fmt.Errorf("failed to restore: %w", err)
+	}
+	if _, err := takeTrashEntry(id); err != nil {
+		GoLog("[Trash] Failed to update index: %v\n", err)
+	}
+	GoLog("[Trash] Restored %s\n", entry.OriginalPath)
+	return &entry, nil
+}
+
+// RestoreFromTrashTo writes an entry's content to outputPath/outputFD (for
+// example a document Flutter created in the original folder).
+func RestoreFromTrashTo(id, outputPath string, outputFD int) (*TrashEntry, error) {
+	adoptOutputFD(outputFD, "")
+	defer closeOwnedOutputFD(outputFD)
+
+	entry, ok := findTrashEntry(id)
+	if !ok {
+		return nil, fmt.Errorf("trash entry not found: %s", id)
+	}
+	out, err := openOutputForWrite(outputPath, outputFD)
+	if err != nil {
+		return nil, err
+	}
+	_, err = copyFileContents(entry.TrashPath, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore: %w", err)
+	}
+
+	if _, err := takeTrashEntry(id); err != nil {
+		GoLog("[Trash] Failed to update index: %v\n", err)
+	}
+	os.Remove(entry.TrashPath)
+	return &entry, nil
+}
+
+// ListTrash returns entries, newest first.
+func ListTrash() []TrashEntry {
+	trashMu.Lock()
+	entries := append([]TrashEntry{}, trashEntries...)
+	trashMu.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].TrashedAt > entries[j].TrashedAt })
+	return entries
+}
+
+// PurgeTrash permanently deletes expired entries, or every entry with all
+// set. It returns the number removed.
+func PurgeTrash(all bool) int {
+	now := time.Now().Unix()
+
+	trashMu.Lock()
+	defer trashMu.Unlock()
+
+	kept := trashEntries[:0]
+	purged := 0
+	for _, entry := range trashEntries {
+		if !all && entry.ExpiresAt > now {
+			kept = append(kept, entry)
+			continue
+		}
+		if err := os.Remove(entry.TrashPath); err != nil && !os.IsNotExist(err) {
+			GoLog("[Trash] Failed to purge %s: %v\n", entry.TrashPath, err)
+			kept = append(kept, entry)
+			continue
+		}
+		purged++
+	}
+	trashEntries = kept
+	if purged > 0 {
+		if err := saveTrashIndexLocked(); err != nil {
+			GoLog("[Trash] Failed to save index: %v\n", err)
+		}
+		GoLog("[Trash] Purged %d entries\n", purged)
+	}
+	return purged
+}
+
+// replacedOutput remembers a file a download is about to overwrite so it
+// can be put back when the download fails.
+type replacedOutput struct {
+	entry *TrashEntry
+}
+
+// trashReplacedOutput trashes the existing file at an explicit output path
+// before a re-download overwrites it. SAF outputs are opened write-only by
+// Flutter, so their old content cannot be saved here; Flutter trashes the
+// document before handing over the descriptor.
+func trashReplacedOutput(req *DownloadRequest) *replacedOutput {
+	path := req.OutputPath
+	if path == "" || isFDOutput(req.OutputFD) || isSAFPath(path) || !trashEnabled() {
+		return &replacedOutput{}
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		return &replacedOutput{}
+	}
+	entry, err := MoveToTrash(path, TrashReasonReplaced)
+	if err != nil {
+		GoLog("[Trash] Could not trash %s before re-download: %v\n", path, err)
+		return &replacedOutput{}
+	}
+	return &replacedOutput{entry: entry}
+}
+
+// settle restores the trashed file when the download did not produce a new
+// one. resp is the JSON response of the download export.
+func (r *replacedOutput) settle(resp string, err error) {
+	if r.entry == nil {
+		return
+	}
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err == nil && json.Unmarshal([]byte(resp), &result) == nil && result.Success {
+		return
+	}
+	if info, statErr := os.Stat(r.entry.OriginalPath); statErr == nil && info.Size() > 0 {
+		return
+	}
+	os.Remove(r.entry.OriginalPath)
+	if _, restoreErr := RestoreFromTrash(r.entry.ID); restoreErr != nil {
+		GoLog("[Trash] Failed to restore %s after failed download: %v\n", r.entry.OriginalPath, restoreErr)
+	}
+}
+
+func ListTrashJSON() (string, error) {
+	jsonBytes, err := json.Marshal(ListTrash())
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func MoveToTrashJSON(path, reason string) (string, error) {
+	entry, err := MoveToTrash(path, reason)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
+
+func RestoreFromTrashJSON(id string) (string, error) {
+	entry, err := RestoreFromTrash(id)
+	if err != nil {
+		return "", err
+	}
+	jsonBytes, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonBytes), nil
+}
@@ -0,0 +1,95 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupTestTrash(t *testing.T) string {
+	t.Helper()
+	prevDir, prevEntries := trashDir, trashEntries
+	t.Cleanup(func() {
+		trashMu.Lock()
+		trashDir, trashEntries = prevDir, prevEntries
+		trashMu.Unlock()
+	})
+	dir := filepath.Join(t.TempDir(), "trash")
+	if err := SetTrashDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestMoveToTrashAndRestore(t *testing.T) {
+	trash := setupTestTrash(t)
+	path := filepath.Join(t.TempDir(), "song.flac")
+	if err := os.WriteFile(path, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := MoveToTrash(path, "")
+	if err != nil {
+		t.Fatalf("MoveToTrash failed: %v", err)
+	}
+	if fileExists(path) || !fileExists(entry.TrashPath) || entry.Reason != TrashReasonDeleted || entry.Size != 5 {
+		t.Fatalf("entry = %+v", entry)
+	}
+
+	// The index survives a reload.
+	if err := SetTrashDir(trash); err != nil {
+		t.Fatal(err)
+	}
+	if list := ListTrash(); len(list) != 1 || list[0].ID != entry.ID {
+		t.Fatalf("ListTrash = %+v", list)
+	}
+
+	if _, err := RestoreFromTrash(entry.ID); err != nil {
+		t.Fatalf("RestoreFromTrash failed: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "audio" {
+		t.Errorf("restored file = %q, %v", data, err)
+	}
+	if len(ListTrash()) != 0 {
+		t.Error("restored entry is still listed")
+	}
+}
+
+func TestPurgeTrashExpired(t *testing.T) {
+	setupTestTrash(t)
+	path := filepath.Join(t.TempDir(), "old.mp3")
+	if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := MoveToTrash(path, TrashReasonReplaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := PurgeTrash(false); n != 0 {
+		t.Fatalf("purged %d fresh entries", n)
+	}
+	trashMu.Lock()
+	trashEntries[0].ExpiresAt = 1
+	trashMu.Unlock()
+	if n := PurgeTrash(false); n != 1 || fileExists(entry.TrashPath) {
+		t.Errorf("purged %d, trash file left = %v", n, fileExists(entry.TrashPath))
+	}
+}
+
+func TestReplacedOutputRestoredOnFailure(t *testing.T) {
+	setupTestTrash(t)
+	path := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	replaced := trashReplacedOutput(&DownloadRequest{OutputPath: path})
+	if replaced.entry == nil || fileExists(path) {
+		t.Fatal("existing output was not trashed")
+	}
+	replaced.settle(`{"success":false,"error":"not found"}`, nil)
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Errorf("old file was not restored, got %q", data)
+	}
+}
@@ -0,0 +1,99 @@
+package gobackend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testVerifyFLAC is a 16-bit stereo FLAC of n 192-sample frames, each made
+// of two constant subframes.
+func testVerifyFLAC(n int) []byte {
+	return testFLACSpec{SampleRate: 44100, Channels: 2, BitsPerSample: 16, BlockSize: 192, Frames: n}.bytes()
+}
+
+func writeVerifyFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerifyAudioFileFLAC(t *testing.T) {
+	dir := t.TempDir()
+	stream := testVerifyFLAC(5)
+
+	result := VerifyAudioFile(writeVerifyFile(t, dir, "ok.flac", stream))
+	if result.Status != VerifyStatusOK || result.Frames != 5 {
+		t.Fatalf("intact file = %+v", result)
+	}
+
+	truncated := VerifyAudioFile(writeVerifyFile(t, dir, "cut.flac", stream[:len(stream)-5]))
+	if truncated.Status != VerifyStatusTruncated {
+		t.Errorf("truncated file = %+v", truncated)
+	}
+
+	damaged := append([]byte{}, stream...)
+	frameLen := (len(stream) - 42) / 5
+	damaged[42+3*frameLen-3] ^= 0x55 // last subframe byte of the third frame
+	corrupt := VerifyAudioFile(writeVerifyFile(t, dir, "bad.flac", damaged))
+	if corrupt.Status != VerifyStatusCorrupt || corrupt.BadFrames != 1 {
+		t.Errorf("damaged file = %+v", corrupt)
+	}
+
+	empty := VerifyAudioFile(writeVerifyFile(t, dir, "empty.flac", nil))
+	if empty.Status != VerifyStatusEmpty {
+		t.Errorf("empty file = %+v", empty)
+	}
+}
+
+func TestVerifyAudioFileMP3(t *testing.T) {
+	dir := t.TempDir()
+	// MPEG1 Layer III, 128 kbps, 44.1 kHz: 417-byte frames.
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x64})
+	var stream []byte
+	for i := 0; i < 4; i++ {
+		stream = append(stream, frame...)
+	}
+	stream = append(stream, []byte("TAG")...)
+
+	if result := VerifyAudioFile(writeVerifyFile(t, dir, "ok.mp3", stream)); result.Status != VerifyStatusOK || result.Frames != 4 {
+		t.Fatalf("intact mp3 = %+v", result)
+	}
+	if result := VerifyAudioFile(writeVerifyFile(t, dir, "cut.mp3", stream[:417*3+100])); result.Status != VerifyStatusTruncated {
+		t.Errorf("truncated mp3 = %+v", result)
+	}
+}
+
+func TestVerifyLibraryRepairPlan(t *testing.T) {
+	dir := t.TempDir()
+	writeVerifyFile(t, dir, "ok.flac", testVerifyFLAC(2))
+	broken := writeVerifyFile(t, dir, "broken.flac", testVerifyFLAC(2)[:60])
+	orphan := writeVerifyFile(t, dir, "orphan.mp3", nil)
+
+	report, err := VerifyLibrary(VerifyLibraryRequest{
+		RootDir: dir,
+		History: []VerifyHistoryRecord{{FilePath: broken, SpotifyID: "abc", TrackName: "Song"}},
+	})
+	if err != nil {
+		t.Fatalf("VerifyLibrary failed: %v", err)
+	}
+	if report.Checked != 3 || report.OK != 1 || len(report.RepairPlan) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	for _, candidate := range report.RepairPlan {
+		switch candidate.Path {
+		case broken:
+			if candidate.Action != RepairActionRedownload || candidate.History == nil || candidate.History.SpotifyID != "abc" {
+				t.Errorf("broken file candidate = %+v", candidate)
+			}
+		case orphan:
+			if candidate.Action != RepairActionManual {
+				t.Errorf("orphan candidate = %+v", candidate)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package gobackend
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Version tags mark recordings that are not interchangeable with the studio
+// track even when the base title matches.
+const (
+	VersionTagLive         = "live"
+	VersionTagRemix        = "remix"
+	VersionTagKaraoke      = "karaoke"
+	VersionTagInstrumental = "instrumental"
+	VersionTagSpedUp       = "sped_up"
+	VersionTagSlowed       = "slowed"
+	VersionTagNightcore    = "nightcore"
+	VersionTag8D           = "8d"
+)
+
+var versionTagPatterns = []struct {
+	tag     string
+	pattern *regexp.Regexp
+}{
+	{VersionTagLive, regexp.MustCompile(`\blive\b`)},
+	{VersionTagRemix, regexp.MustCompile(`\bremix(ed)?\b|\brmx\b`)},
+	{VersionTagKaraoke, regexp.MustCompile(`\bkaraoke\b`)},
+	{VersionTagInstrumental, regexp.MustCompile(`\binstrumental\b`)},
+	{VersionTagSpedUp, regexp.MustCompile(`\b(sped|speed)[\s-]?up\b`)},
+	{VersionTagSlowed, regexp.MustCompile(`\bslowed\b`)},
+	{VersionTagNightcore, regexp.MustCompile(`\bnightcore\b`)},
+	{VersionTag8D, regexp.MustCompile(`\b8d\b`)},
+}
+
+var titleQualifierPattern = regexp.MustCompile(`[\(\[]([^\)\]]*)[\)\]]|\s-\s(.+)$`)
+
+// titleQualifiers returns the parenthesised, bracketed and " - " suffixed
+// parts of a title. Only these are scanned so titles like "Live Forever"
+// are not mistaken for live recordings.
+func titleQualifiers(title string) []string {
+	var parts []string
+	for _, m := range titleQualifierPattern.FindAllStringSubmatch(strings.ToLower(title), -1) {
+		for _, group := range m[1:] {
+			if group = strings.TrimSpace(group); group != "" {
+				parts = append(parts, group)
+			}
+		}
+	}
+	return parts
+}
+
+// detectVersionTags lists the version tags found in title's qualifiers,
+// sorted and without duplicates.
+func detectVersionTags(title string) []string {
+	found := make(map[string]bool)
+	for _, part := range titleQualifiers(title) {
+		for _, vp := range versionTagPatterns {
+			if vp.pattern.MatchString(part) {
+				found[vp.tag] = true
+			}
+		}
+	}
+	tags := make([]string, 0, len(found))
+	for tag := range found {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// versionMismatch returns the tags present on only one of the two titles.
+// A studio request against a live result and a live request against a
+// studio result both count as mismatches.
+func versionMismatch(expectedTitle, foundTitle string) []string {
+	expected := detectVersionTags(expectedTitle)
+	found := detectVersionTags(foundTitle)
+
+	counts := make(map[string]int)
+	for _, tag := range expected {
+		counts[tag]++
+	}
+	for _, tag := range found {
+		counts[tag]--
+	}
+	var diff []string
+	for tag, n := range counts {
+		if n != 0 {
+			diff = append(diff, tag)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// versionGuardRejects reports whether the strict version guard should
+// reject foundTitle as a match for expectedTitle.
+func versionGuardRejects(expectedTitle, foundTitle string, strict bool) bool {
+	if !strict {
+		return false
+	}
+	if diff := versionMismatch(expectedTitle, foundTitle); len(diff) > 0 {
+		GoLog("[Matching] Version mismatch %v: '%s' vs '%s'\n", diff, expectedTitle, foundTitle)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package gobackend
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectVersionTags(t *testing.T) {
+	cases := map[string][]string{
+		"Live Forever":                           {},
+		"Live Forever (Live at Knebworth)":       {VersionTagLive},
+		"Blinding Lights - Sped Up":              {VersionTagSpedUp},
+		"Song [Nightcore] (8D Audio)":            {VersionTag8D, VersionTagNightcore},
+		"Track (Instrumental) [Karaoke Version]": {VersionTagInstrumental, VersionTagKaraoke},
+		"Hello (Remastered 2011)":                {},
+	}
+	for title, want := range cases {
+		got := detectVersionTags(title)
+		if len(want) == 0 && len(got) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("detectVersionTags(%q) = %v, want %v", title, got, want)
+		}
+	}
+}
+
+func TestTitlesMatchRejectsVersionMismatch(t *testing.T) {
+	if titlesMatch("Blinding Lights", "Blinding Lights (Live)") {
+		t.Fatal("studio track should not match live version")
+	}
+	if qobuzTitlesMatch("Blinding Lights", "Blinding Lights - Sped Up") {
+		t.Fatal("studio track should not match sped up version")
+	}
+	if !titlesMatch("Blinding Lights - Live", "Blinding Lights (Live)") {
+		t.Fatal("live request should match live version")
+	}
+
+	prev := GetBackendConfig()
+	defer func() { backendConfigMu.Lock(); backendConfig = prev; backendConfigMu.Unlock() }()
+	backendConfigMu.Lock()
+	backendConfig.StrictVersionMatch = false
+	backendConfigMu.Unlock()
+	if !titlesMatch("Blinding Lights", "Blinding Lights (Live)") {
+		t.Fatal("version guard should be off when not strict")
+	}
+}
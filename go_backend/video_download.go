@@ -0,0 +1,386 @@
+package gobackend
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ==================== Music video downloads ====================
+//
+// Extensions with "capabilities": {"video": true} export
+// getVideoStreams(id, quality). The video and audio streams are fetched in
+// parallel into the item's scratch dir, muxed to MP4 by Flutter's FFmpeg
+// (with the thumbnail as cover) and written to the usual output path or SAF
+// descriptor. Requests come through the normal queue with media_type "video".
+
+const (
+	MediaTypeVideo = "video"
+
+	videoMuxTimeout = 10 * time.Minute
+)
+
+// ExtVideoStreams is what getVideoStreams returns. AudioURL may be empty
+// when VideoURL already carries sound.
+type ExtVideoStreams struct {
+	VideoURL     string            `json:"video_url"`
+	AudioURL     string            `json:"audio_url,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	ThumbnailURL string            `json:"thumbnail_url,omitempty"`
+	DurationMS   int               `json:"duration_ms,omitempty"`
+	Width        int               `json:"width,omitempty"`
+	Height       int               `json:"height,omitempty"`
+}
+
+func (p *ExtensionProviderWrapper) GetVideoStreams(videoID, quality string) (*ExtVideoStreams, error) {
+	if !p.extension.Manifest.HasVideoDownload() {
+		return nil, fmt.Errorf("extension '%s' does not support video downloads", p.extension.ID)
+	}
+
+	if !p.extension.Enabled {
+		return nil, fmt.Errorf("extension '%s' is disabled", p.extension.ID)
+	}
+
+	release := acquireExtensionVM(p.extension)
+	defer release()
+
+	script := fmt.Sprintf(`
+		(function() {
+			if (typeof extension !== 'undefined' && typeof extension.getVideoStreams === 'function') {
+				return extension.getVideoStreams(%q, %q);
+			}
+			return null;
+		})()
+	`, videoID, quality)
+
+	result, err := RunWithTimeoutAndRecover(p.vm, script, DefaultJSTimeout)
+	if err != nil {
+		if IsTimeoutError(err) {
+			return nil, fmt.Errorf("getVideoStreams timeout: extension took too long to respond")
+		}
+		return nil, fmt.Errorf("getVideoStreams failed: %w", err)
+	}
+
+	if result == nil || goja.IsUndefined(result) || goja.IsNull(result) {
+		return nil, fmt.Errorf("getVideoStreams returned null")
+	}
+
+	jsonBytes, err := json.Marshal(result.Export())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	var streams ExtVideoStreams
+	if err := json.Unmarshal(jsonBytes, &streams); err != nil {
+		return nil, fmt.Errorf("failed to parse video streams: %w", err)
+	}
+	if streams.VideoURL == "" {
+		return nil, fmt.Errorf("getVideoStreams returned no video_url")
+	}
+
+	return &streams, nil
+}
+
+// videoProgress sums the bytes of the parallel stream downloads into the
+// item's progress entry.
+type videoProgress struct {
+	itemID   string
+	total    atomic.Int64
+	received atomic.Int64
+}
+
+type videoProgressWriter struct {
+	file     *os.File
+	progress *videoProgress
+}
+
+func (w *videoProgressWriter) Write(p []byte) (int, error) {
+	if w.progress.itemID != "" && isDownloadCancelled(w.progress.itemID) {
+		return 0, ErrDownloadCancelled
+	}
+	n, err := w.file.Write(p)
+	received := w.progress.received.Add(int64(n))
+	if w.progress.itemID != "" {
+		SetItemProgress(w.progress.itemID, videoProgressFraction(received, w.progress.total.Load()), received, w.progress.total.Load())
+	}
+	return n, err
+}
+
+// videoProgressFraction keeps the last 5% for muxing and output.
+func videoProgressFraction(received, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return 0.95 * float64(received) / float64(total)
+}
+
+func fetchVideoStream(client *http.Client, streamURL string, headers map[string]string, destPath string, progress *videoProgress) error {
+	req, err := http.NewRequest(http.MethodGet, streamURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", getRandomUserAgent())
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch stream: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("stream returned HTTP %d", resp.StatusCode)
+	}
+	if resp.ContentLength > 0 {
+		progress.total.Add(resp.ContentLength)
+	}
+
+	out, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(&videoProgressWriter{file: out, progress: progress}, resp.Body)
+	closeErr := out.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	return closeErr
+}
+
+// buildVideoMuxCommand stream-copies video (and the separate audio, if any)
+// into MP4 and attaches the thumbnail as cover art.
+func buildVideoMuxCommand(videoPath, audioPath, thumbPath, outputPath string, req DownloadRequest) string {
+	parts := []string{"-i", fmt.Sprintf("%q", videoPath)}
+	if audioPath != "" {
+		parts = append(parts, "-i", fmt.Sprintf("%q", audioPath))
+	}
+	if thumbPath != "" {
+		parts = append(parts, "-i", fmt.Sprintf("%q", thumbPath))
+	}
+
+	parts = append(parts, "-map", "0:v:0")
+	if audioPath != "" {
+		parts = append(parts, "-map", "1:a:0")
+	} else {
+		parts = append(parts, "-map", "0:a:0?")
+	}
+	if thumbPath != "" {
+		thumbInput := 1
+		if audioPath != "" {
+			thumbInput = 2
+		}
+		parts = append(parts, "-map", fmt.Sprintf("%d", thumbInput), "-disposition:v:1", "attached_pic")
+	}
+	parts = append(parts, "-c", "copy", "-movflags", "+faststart")
+
+	for _, tag := range [][2]string{
+		{"title", req.TrackName},
+		{"artist", req.ArtistName},
+		{"album", req.AlbumName},
+		{"album_artist", req.AlbumArtist},
+		{"date", req.ReleaseDate},
+	} {
+		if tag[1] != "" {
+			parts = append(parts, "-metadata", fmt.Sprintf("%q", tag[0]+"="+tag[1]))
+		}
+	}
+
+	parts = append(parts, "-f", "mp4", "-y", fmt.Sprintf("%q", outputPath))
+	return strings.Join(parts, " ")
+}
+
+// probeMP4DurationMS reads the movie duration from the moov/mvhd box.
+func probeMP4DurationMS(filePath string) (int, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	fileSize := info.Size()
+
+	moov, found, err := findAtomInRange(f, 0, fileSize, "moov", fileSize)
+	if err != nil || !found {
+		return 0, fmt.Errorf("moov atom not found")
+	}
+	mvhd, found, err := findAtomInRange(f, moov.offset+moov.headerSize, moov.size-moov.headerSize, "mvhd", fileSize)
+	if err != nil || !found {
+		return 0, fmt.Errorf("mvhd atom not found")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := f.ReadAt(buf, mvhd.offset+mvhd.headerSize); err != nil {
+		return 0, fmt.Errorf("failed to read mvhd: %w", err)
+	}
+	var timescale uint32
+	var duration uint64
+	if buf[0] == 1 {
+		timescale = binary.BigEndian.Uint32(buf[20:24])
+		duration = binary.BigEndian.Uint64(buf[24:32])
+	} else {
+		timescale = binary.BigEndian.Uint32(buf[12:16])
+		duration = uint64(binary.BigEndian.Uint32(buf[16:20]))
+	}
+	if timescale == 0 {
+		return 0, fmt.Errorf("mvhd has zero timescale")
+	}
+	return int(duration * 1000 / uint64(timescale)), nil
+}
+
+func copyFileToOutput(srcPath, outputPath string, outputFD int) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if outputPath != "" {
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	out, err := openOutputForWrite(outputPath, outputFD)
+	if err != nil {
+		return fmt.Errorf("failed to open output: %w", err)
+	}
+	_, copyErr := io.Copy(out, src)
+	closeErr := out.Close()
+	if copyErr == nil {
+		copyErr = closeErr
+	}
+	if copyErr != nil {
+		cleanupOutputOnError(outputPath, outputFD)
+	}
+	return copyErr
+}
+
+func downloadVideoWithExtension(req DownloadRequest) (*DownloadResponse, error) {
+	ext, err := GetExtensionManager().GetExtension(req.Source)
+	if err != nil {
+		return nil, err
+	}
+	if ext.Error != "" {
+		return nil, fmt.Errorf("extension '%s' failed to load: %s", ext.ID, ext.Error)
+	}
+	provider := NewExtensionProviderWrapper(ext)
+
+	streams, err := provider.GetVideoStreams(req.SpotifyID, req.Quality)
+	if err != nil {
+		return nil, err
+	}
+
+	scratch, err := AcquireScratchDir(req.ItemID)
+	if err != nil {
+		return nil, err
+	}
+	if req.ItemID == "" {
+		defer releaseScratchPath(scratch)
+	}
+	if req.ItemID != "" {
+		StartItemProgress(req.ItemID)
+	}
+
+	progress := &videoProgress{itemID: req.ItemID}
+	client := GetDownloadClient()
+	videoPath := filepath.Join(scratch, "video.stream")
+	audioPath := ""
+	if streams.AudioURL != "" {
+		audioPath = filepath.Join(scratch, "audio.stream")
+	}
+
+	var wg sync.WaitGroup
+	var videoErr, audioErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		videoErr = fetchVideoStream(client, streams.VideoURL, streams.Headers, videoPath, progress)
+	}()
+	if audioPath != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			audioErr = fetchVideoStream(client, streams.AudioURL, streams.Headers, audioPath, progress)
+		}()
+	}
+
+	thumbPath := ""
+	thumbURL := firstNonEmpty(streams.ThumbnailURL, req.CoverURL)
+	if thumbURL != "" {
+		if data, err := fetchTrackCover(thumbURL, false); err != nil {
+			GoLog("[Video] Thumbnail download failed: %v\n", err)
+		} else if err := os.WriteFile(filepath.Join(scratch, "thumb.jpg"), data, 0644); err == nil {
+			thumbPath = filepath.Join(scratch, "thumb.jpg")
+		}
+	}
+	wg.Wait()
+
+	if videoErr != nil {
+		return nil, fmt.Errorf("video stream: %w", videoErr)
+	}
+	if audioErr != nil {
+		return nil, fmt.Errorf("audio stream: %w", audioErr)
+	}
+
+	if req.ItemID != "" {
+		SetItemFinalizing(req.ItemID)
+	}
+	muxedPath := filepath.Join(scratch, "muxed.mp4")
+	cmd, err := runQueuedFFmpeg(ext.ID, buildVideoMuxCommand(videoPath, audioPath, thumbPath, muxedPath, req), videoPath, muxedPath, videoMuxTimeout)
+	if err == nil && !cmd.Success {
+		err = fmt.Errorf("%s", firstNonEmpty(cmd.Error, "FFmpeg mux failed"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to mux video: %w", err)
+	}
+
+	durationMS, err := probeMP4DurationMS(muxedPath)
+	if err != nil {
+		GoLog("[Video] Duration probe failed: %v\n", err)
+		durationMS = streams.DurationMS
+	}
+
+	outputPath := ""
+	if !isFDOutput(req.OutputFD) {
+		if req.OutputExt == "" {
+			req.OutputExt = ".mp4"
+		}
+		outputPath = buildOutputPath(req)
+	}
+	if err := copyFileToOutput(muxedPath, outputPath, req.OutputFD); err != nil {
+		return nil, fmt.Errorf("failed to write video: %w", err)
+	}
+	if req.ItemID != "" {
+		CompleteItemProgress(req.ItemID)
+	}
+
+	GoLog("[Video] Saved %s (%d ms) via %s\n", firstNonEmpty(outputPath, "SAF output"), durationMS, ext.ID)
+	return &DownloadResponse{
+		Success:     true,
+		Message:     "Download complete",
+		FilePath:    outputPath,
+		Service:     ext.ID,
+		Title:       req.TrackName,
+		Artist:      req.ArtistName,
+		Album:       req.AlbumName,
+		AlbumArtist: req.AlbumArtist,
+		ReleaseDate: req.ReleaseDate,
+		CoverURL:    thumbURL,
+		MediaType:   MediaTypeVideo,
+		DurationMS:  durationMS,
+	}, nil
+}
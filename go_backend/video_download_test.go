@@ -0,0 +1,61 @@
+package gobackend
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestMP4(t *testing.T, timescale, duration uint32) string {
+	t.Helper()
+	mvhd := make([]byte, 8+100)
+	binary.BigEndian.PutUint32(mvhd[0:4], uint32(len(mvhd)))
+	copy(mvhd[4:8], "mvhd")
+	binary.BigEndian.PutUint32(mvhd[8+12:8+16], timescale)
+	binary.BigEndian.PutUint32(mvhd[8+16:8+20], duration)
+
+	moov := make([]byte, 8, 8+len(mvhd))
+	binary.BigEndian.PutUint32(moov[0:4], uint32(8+len(mvhd)))
+	copy(moov[4:8], "moov")
+	moov = append(moov, mvhd...)
+
+	ftyp := []byte{0, 0, 0, 16, 'f', 't', 'y', 'p', 'i', 's', 'o', 'm', 0, 0, 2, 0}
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(path, append(ftyp, moov...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestProbeMP4DurationMS(t *testing.T) {
+	path := writeTestMP4(t, 600, 600*215+300)
+	got, err := probeMP4DurationMS(path)
+	if err != nil {
+		t.Fatalf("probeMP4DurationMS failed: %v", err)
+	}
+	if got != 215500 {
+		t.Errorf("duration = %d, want 215500", got)
+	}
+
+	if _, err := probeMP4DurationMS(writeTestMP4(t, 0, 100)); err == nil {
+		t.Error("expected zero timescale to fail")
+	}
+}
+
+func TestBuildVideoMuxCommand(t *testing.T) {
+	req := DownloadRequest{TrackName: "Song", ArtistName: "Artist"}
+
+	cmd := buildVideoMuxCommand("/s/video", "/s/audio", "/s/thumb.jpg", "/s/out.mp4", req)
+	for _, want := range []string{`-map 0:v:0 -map 1:a:0 -map 2 -disposition:v:1 attached_pic`, `-c copy`, `-metadata "title=Song"`, `-y "/s/out.mp4"`} {
+		if !strings.Contains(cmd, want) {
+			t.Errorf("command %q is missing %q", cmd, want)
+		}
+	}
+
+	cmd = buildVideoMuxCommand("/s/video", "", "/s/thumb.jpg", "/s/out.mp4", req)
+	if !strings.Contains(cmd, `-map 0:a:0? -map 1 -disposition:v:1 attached_pic`) {
+		t.Errorf("muxed-audio command has wrong maps: %q", cmd)
+	}
+}
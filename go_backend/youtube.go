@@ -2,7 +2,6 @@
 package gobackend
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -77,6 +76,7 @@ type YouTubeDownloadResult struct {
 	Format      string // "opus" or "mp3"
 	Bitrate     int
 	LyricsLRC   string
+	LyricsTags  map[string]string
 	CoverData   []byte
 }
 
@@ -421,8 +421,15 @@ func (y *YouTubeDownloader) DownloadFile(downloadURL, outputPath string, outputF
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
+	if err := preallocateOutput(out, expectedSize); err != nil {
+		out.Close()
+		cleanupOutputOnError(outputPath, outputFD)
+		return err
+	}
 
-	bufWriter := bufio.NewWriterSize(out, 256*1024)
+	mirror := openOutputMirror(itemID)
+	bufWriter := acquireCopyWriter(hashedOutput(mirror.tee(out), itemID))
+	defer releaseCopyWriter(bufWriter)
 
 	var written int64
 	if itemID != "" {
@@ -433,7 +440,8 @@ func (y *YouTubeDownloader) DownloadFile(downloadURL, outputPath string, outputF
 	}
 
 	flushErr := bufWriter.Flush()
-	closeErr := out.Close()
+	closeErr := closeOutput(out)
+	mirror.close()
 
 	if err != nil {
 		cleanupOutputOnError(outputPath, outputFD)
@@ -455,6 +463,7 @@ func (y *YouTubeDownloader) DownloadFile(downloadURL, outputPath string, outputF
 		cleanupOutputOnError(outputPath, outputFD)
 		return fmt.Errorf("incomplete download: expected %d bytes, got %d bytes", expectedSize, written)
 	}
+	sealDownloadHash(itemID, outputPath, outputFD)
 
 	GoLog("[YouTube] Download completed: %d bytes written\n", written)
 
@@ -646,30 +655,21 @@ func downloadFromYouTube(req DownloadRequest) (YouTubeDownloadResult, error) {
 
 	GoLog("[YouTube] Downloading to: %s\n", outputPath)
 
-	// Parallel fetch cover art + lyrics
-	var parallelResult *ParallelDownloadResult
-	if req.EmbedLyrics || req.CoverURL != "" {
-		GoLog("[YouTube] Starting parallel fetch for cover and lyrics...\n")
-		parallelResult = FetchCoverAndLyricsParallel(
-			req.CoverURL,
-			req.EmbedMaxQualityCover,
-			req.SpotifyID,
-			req.TrackName,
-			req.ArtistName,
-			req.EmbedLyrics,
-			int64(req.DurationMS),
-		)
-	}
+	// Fetch cover art + lyrics while the audio downloads
+	assets := StartTrackAssetFetch(req, false)
 
 	if err := downloader.DownloadFile(cobaltResp.URL, outputPath, req.OutputFD, req.ItemID); err != nil {
 		return YouTubeDownloadResult{}, fmt.Errorf("download failed: %w", err)
 	}
+	parallelResult := assets.Wait()
 
 	lyricsLRC := ""
+	var lyricsTags map[string]string
 	var coverData []byte
 	if parallelResult != nil {
 		if parallelResult.LyricsLRC != "" {
 			lyricsLRC = parallelResult.LyricsLRC
+			lyricsTags = parallelResult.LyricsTags
 			GoLog("[YouTube] Got lyrics from lrclib (%d lines)\n", len(parallelResult.LyricsData.Lines))
 		}
 		if parallelResult.CoverData != nil {
@@ -690,6 +690,7 @@ func downloadFromYouTube(req DownloadRequest) (YouTubeDownloadResult, error) {
 		Format:      format,
 		Bitrate:     bitrate,
 		LyricsLRC:   lyricsLRC,
+		LyricsTags:  lyricsTags,
 		CoverData:   coverData,
 	}, nil
 }
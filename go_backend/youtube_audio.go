@@ -0,0 +1,467 @@
+package gobackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================== YouTube audio ====================
+//
+// Download providers can hand back a YouTube video instead of a file by
+// returning {success: true, youtube_video_id: "..."} from
+// extension.download. Go then reads the player response (the extension's
+// own youtube_player_response, an Invidious instance given as
+// youtube_invidious_instance, or Innertube), picks the best audio-only
+// format and downloads it in ranged chunks, which googlevideo serves at
+// full speed where one long request gets throttled. Signature ciphers and
+// the "n" parameter change with every player release, so they stay in the
+// extension: Go calls extension.youtubeDecipher(s) and
+// extension.youtubeTransformN(n) when a format needs them.
+
+const (
+	youtubeMaxRetries     = 5
+	youtubeRetryBaseDelay = time.Second
+	youtubeHookTimeout    = 5 * time.Second
+	youtubePlayerTimeout  = 20 * time.Second
+	youtubeChunkTimeout   = 60 * time.Second
+)
+
+// Overridden in tests.
+var (
+	youtubeInnertubeURL   = "https://www.youtube.com/youtubei/v1/player?prettyPrint=false"
+	youtubeChunkSize      = int64(10 << 20)
+	youtubeRetryBaseSleep = youtubeRetryBaseDelay
+	youtubeIsPrivateHost  = isPrivateIP
+)
+
+var youtubeVideoIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+// YouTubeAudioFormat is one audio-only stream of a video.
+type YouTubeAudioFormat struct {
+	Itag            int    `json:"itag"`
+	MimeType        string `json:"mime_type"`
+	Codec           string `json:"codec"`
+	Container       string `json:"container"`
+	Bitrate         int    `json:"bitrate"`
+	SampleRate      int    `json:"sample_rate,omitempty"`
+	ContentLength   int64  `json:"content_length,omitempty"`
+	URL             string `json:"-"`
+	SignatureCipher string `json:"-"`
+}
+
+type YouTubePlayerInfo struct {
+	VideoID     string               `json:"video_id"`
+	Title       string               `json:"title"`
+	Author      string               `json:"author"`
+	DurationSec int                  `json:"duration_sec"`
+	Formats     []YouTubeAudioFormat `json:"formats"`
+}
+
+// youtubeHooks are the extension's cipher functions; either may be nil.
+type youtubeHooks struct {
+	decipher   func(string) (string, error)
+	transformN func(string) (string, error)
+}
+
+// splitYouTubeMimeType turns `audio/webm; codecs="opus"` into container
+// "webm" (mp4 audio is reported as "m4a") and codec "opus".
+func splitYouTubeMimeType(mimeType string) (string, string) {
+	base, params, _ := strings.Cut(mimeType, ";")
+	container := strings.TrimPrefix(strings.TrimSpace(base), "audio/")
+	if container == "mp4" {
+		container = "m4a"
+	}
+	codec := ""
+	if _, value, ok := strings.Cut(params, "codecs="); ok {
+		codec = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return container, codec
+}
+
+func atoiLoose(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+func parseYouTubePlayerResponse(data []byte) (*YouTubePlayerInfo, error) {
+	var resp struct {
+		PlayabilityStatus struct {
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+		} `json:"playabilityStatus"`
+		VideoDetails struct {
+			VideoID       string `json:"videoId"`
+			Title         string `json:"title"`
+			Author        string `json:"author"`
+			LengthSeconds string `json:"lengthSeconds"`
+		} `json:"videoDetails"`
+		StreamingData struct {
+			AdaptiveFormats []struct {
+				Itag            int    `json:"itag"`
+				URL             string `json:"url"`
+				SignatureCipher string `json:"signatureCipher"`
+				Cipher          string `json:"cipher"`
+				MimeType        string `json:"mimeType"`
+				Bitrate         int    `json:"bitrate"`
+				AverageBitrate  int    `json:"averageBitrate"`
+				ContentLength   string `json:"contentLength"`
+				AudioSampleRate string `json:"audioSampleRate"`
+			} `json:"adaptiveFormats"`
+		} `json:"streamingData"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid YouTube player response: %w", err)
+	}
+	if status := resp.PlayabilityStatus.Status; status != "" && status != "OK" {
+		return nil, fmt.Errorf("YouTube video not playable: %s %s", status, resp.PlayabilityStatus.Reason)
+	}
+
+	info := &YouTubePlayerInfo{
+		VideoID:     resp.VideoDetails.VideoID,
+		Title:       resp.VideoDetails.Title,
+		Author:      resp.VideoDetails.Author,
+		DurationSec: atoiLoose(resp.VideoDetails.LengthSeconds),
+	}
+	for _, f := range resp.StreamingData.AdaptiveFormats {
+		if !strings.HasPrefix(f.MimeType, "audio/") {
+			continue
+		}
+		container, codec := splitYouTubeMimeType(f.MimeType)
+		bitrate := f.AverageBitrate
+		if bitrate == 0 {
+			bitrate = f.Bitrate
+		}
+		length, _ := strconv.ParseInt(f.ContentLength, 10, 64)
+		info.Formats = append(info.Formats, YouTubeAudioFormat{
+			Itag:            f.Itag,
+			MimeType:        f.MimeType,
+			Codec:           codec,
+			Container:       container,
+			Bitrate:         bitrate,
+			SampleRate:      atoiLoose(f.AudioSampleRate),
+			ContentLength:   length,
+			URL:             f.URL,
+			SignatureCipher: firstNonEmpty(f.SignatureCipher, f.Cipher),
+		})
+	}
+	if len(info.Formats) == 0 {
+		return nil, fmt.Errorf("no audio formats in YouTube player response")
+	}
+	return info, nil
+}
+
+// parseInvidiousVideo reads /api/v1/videos/{id}; its URLs are deciphered.
+func parseInvidiousVideo(data []byte) (*YouTubePlayerInfo, error) {
+	var resp struct {
+		VideoID         string `json:"videoId"`
+		Title           string `json:"title"`
+		Author          string `json:"author"`
+		LengthSeconds   int    `json:"lengthSeconds"`
+		Error           string `json:"error"`
+		AdaptiveFormats []struct {
+			Itag            string `json:"itag"`
+			URL             string `json:"url"`
+			Type            string `json:"type"`
+			Bitrate         string `json:"bitrate"`
+			Clen            string `json:"clen"`
+			AudioSampleRate int    `json:"audioSampleRate"`
+		} `json:"adaptiveFormats"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid Invidious response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("Invidious: %s", resp.Error)
+	}
+	info := &YouTubePlayerInfo{
+		VideoID:     resp.VideoID,
+		Title:       resp.Title,
+		Author:      resp.Author,
+		DurationSec: resp.LengthSeconds,
+	}
+	for _, f := range resp.AdaptiveFormats {
+		if !strings.HasPrefix(f.Type, "audio/") || f.URL == "" {
+			continue
+		}
+		container, codec := splitYouTubeMimeType(f.Type)
+		length, _ := strconv.ParseInt(f.Clen, 10, 64)
+		info.Formats = append(info.Formats, YouTubeAudioFormat{
+			Itag:          atoiLoose(f.Itag),
+			MimeType:      f.Type,
+			Codec:         codec,
+			Container:     container,
+			Bitrate:       atoiLoose(f.Bitrate),
+			SampleRate:    f.AudioSampleRate,
+			ContentLength: length,
+			URL:           f.URL,
+		})
+	}
+	if len(info.Formats) == 0 {
+		return nil, fmt.Errorf("no audio formats in Invidious response")
+	}
+	return info, nil
+}
+
+// youtubePlayerSourceURL is where fetchYouTubePlayerInfo will go, so
+// callers can check it against the extension's permissions first.
+func youtubePlayerSourceURL(videoID, invidiousInstance string) string {
+	if invidiousInstance != "" {
+		return strings.TrimRight(invidiousInstance, "/") + "/api/v1/videos/" + url.PathEscape(videoID)
+	}
+	return youtubeInnertubeURL
+}
+
+func fetchYouTubePlayerInfo(videoID, invidiousInstance string) (*YouTubePlayerInfo, error) {
+	if !youtubeVideoIDRe.MatchString(videoID) {
+		return nil, fmt.Errorf("invalid YouTube video id %q", videoID)
+	}
+	client := NewHTTPClientWithTimeout(youtubePlayerTimeout)
+	target := youtubePlayerSourceURL(videoID, invidiousInstance)
+
+	var req *http.Request
+	var err error
+	if invidiousInstance != "" {
+		req, err = http.NewRequest(http.MethodGet, target, nil)
+	} else {
+		// The Android VR client gets unciphered URLs for most videos.
+		body, _ := json.Marshal(map[string]interface{}{
+			"videoId":        videoID,
+			"contentCheckOk": true,
+			"racyCheckOk":    true,
+			"context": map[string]interface{}{
+				"client": map[string]interface{}{
+					"clientName":        "ANDROID_VR",
+					"clientVersion":     "1.60.19",
+					"deviceMake":        "Oculus",
+					"deviceModel":       "Quest 3",
+					"androidSdkVersion": 32,
+					"osName":            "Android",
+					"osVersion":         "12L",
+					"hl":                "en",
+					"gl":                "US",
+				},
+			},
+		})
+		req, err = http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", "com.google.android.apps.youtube.vr.oculus/1.60.19 (Linux; U; Android 12L; eureka-user Build/SQ3A.220605.009.A1) gzip")
+			req.Header.Set("X-YouTube-Client-Name", "28")
+			req.Header.Set("X-YouTube-Client-Version", "1.60.19")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("YouTube player request failed: HTTP %d", resp.StatusCode)
+	}
+	if invidiousInstance != "" {
+		return parseInvidiousVideo(data)
+	}
+	return parseYouTubePlayerResponse(data)
+}
+
+// selectYouTubeAudioFormat picks the highest bitrate, opus on a tie.
+func selectYouTubeAudioFormat(formats []YouTubeAudioFormat) *YouTubeAudioFormat {
+	var best *YouTubeAudioFormat
+	for i := range formats {
+		f := &formats[i]
+		if best == nil || f.Bitrate > best.Bitrate || f.Bitrate == best.Bitrate && f.Codec == "opus" && best.Codec != "opus" {
+			best = f
+		}
+	}
+	return best
+}
+
+// resolveYouTubeFormatURL applies the extension's decipher and n hooks.
+func resolveYouTubeFormatURL(f *YouTubeAudioFormat, hooks youtubeHooks) (string, error) {
+	rawURL := f.URL
+	var sigParam, sig string
+	if rawURL == "" {
+		cipher, err := url.ParseQuery(f.SignatureCipher)
+		if err != nil || cipher.Get("url") == "" {
+			return "", fmt.Errorf("format %d has no URL", f.Itag)
+		}
+		if hooks.decipher == nil {
+			return "", fmt.Errorf("format %d is ciphered and the extension has no youtubeDecipher", f.Itag)
+		}
+		if sig, err = hooks.decipher(cipher.Get("s")); err != nil {
+			return "", fmt.Errorf("youtubeDecipher: %w", err)
+		}
+		rawURL = cipher.Get("url")
+		sigParam = firstNonEmpty(cipher.Get("sp"), "signature")
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := parsed.Query()
+	if sigParam != "" {
+		query.Set(sigParam, sig)
+	}
+	if n := query.Get("n"); n != "" && hooks.transformN != nil {
+		transformed, err := hooks.transformN(n)
+		if err != nil {
+			return "", fmt.Errorf("youtubeTransformN: %w", err)
+		}
+		query.Set("n", transformed)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// youtubeRetryDelay honours Retry-After, else backs off exponentially.
+func youtubeRetryDelay(resp *http.Response, attempt int) time.Duration {
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return youtubeRetryBaseSleep << attempt
+}
+
+func youtubeRetryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusForbidden || status >= 500
+}
+
+// youtubeChunkWriter remembers write errors so they are not mistaken for a
+// broken connection and retried.
+type youtubeChunkWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (c *youtubeChunkWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// fetchYouTubeChunk appends bytes [start, end] of streamURL to w, retrying
+// throttled or failed requests. A body that breaks off is resumed from the
+// last byte written. end < 0 reads to the end of the stream.
+func fetchYouTubeChunk(client *http.Client, streamURL string, start, end int64, w io.Writer) (int64, error) {
+	sep := "&"
+	if !strings.Contains(streamURL, "?") {
+		sep = "?"
+	}
+
+	var written int64
+	var lastErr error
+	for attempt := 0; attempt < youtubeMaxRetries; attempt++ {
+		target := streamURL
+		if offset := start + written; end >= 0 {
+			target = fmt.Sprintf("%s%srange=%d-%d", streamURL, sep, offset, end)
+		} else if offset > 0 {
+			target = fmt.Sprintf("%s%srange=%d-", streamURL, sep, offset)
+		}
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			return written, err
+		}
+		resp, err := DoRequestWithUserAgent(client, req)
+		if err != nil {
+			lastErr = err
+			time.Sleep(youtubeRetryDelay(nil, attempt))
+			continue
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("stream request failed: HTTP %d", resp.StatusCode)
+			if !youtubeRetryable(resp.StatusCode) {
+				return written, lastErr
+			}
+			GoLog("[YouTube] Chunk %d-%d got HTTP %d, retrying\n", start, end, resp.StatusCode)
+			time.Sleep(youtubeRetryDelay(resp, attempt))
+			continue
+		}
+		out := &youtubeChunkWriter{w: w}
+		n, err := io.Copy(out, resp.Body)
+		resp.Body.Close()
+		written += n
+		if err == nil {
+			return written, nil
+		}
+		if out.err != nil {
+			return written, out.err
+		}
+		lastErr = err
+		GoLog("[YouTube] Chunk %d-%d broke off after %d bytes, resuming: %v\n", start, end, written, err)
+		time.Sleep(youtubeRetryDelay(nil, attempt))
+	}
+	return written, lastErr
+}
+
+// downloadYouTubeStream writes the stream to outputPath in chunks of
+// youtubeChunkSize, or in one request when the length is unknown. cancelled
+// is checked between chunks.
+func downloadYouTubeStream(streamURL string, contentLength int64, outputPath string, onProgress func(percent int), cancelled func() bool) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	client := NewHTTPClientWithTimeout(youtubeChunkTimeout)
+
+	if contentLength <= 0 {
+		_, err = fetchYouTubeChunk(client, streamURL, 0, -1, file)
+	} else {
+		for start := int64(0); start < contentLength && err == nil; {
+			if cancelled != nil && cancelled() {
+				err = ErrDownloadCancelled
+				break
+			}
+			end := min(start+youtubeChunkSize, contentLength) - 1
+			var n int64
+			n, err = fetchYouTubeChunk(client, streamURL, start, end, file)
+			if err == nil && n == 0 {
+				err = fmt.Errorf("empty chunk at offset %d", start)
+			}
+			start += n
+			if onProgress != nil {
+				onProgress(int(start * 100 / contentLength))
+			}
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outputPath)
+	}
+	return err
+}
+
+// youtubeOutputPath swaps outputPath's extension for the format's.
+func youtubeOutputPath(outputPath string, f *YouTubeAudioFormat) string {
+	ext := ".webm"
+	if f.Container == "m4a" {
+		ext = ".m4a"
+	}
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ext
+}
@@ -0,0 +1,181 @@
+package gobackend
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestYouTubeHandbackDownload(t *testing.T) {
+	audio := bytes.Repeat([]byte("0123456789"), 250)
+	var mu sync.Mutex
+	throttled := false
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		q := r.URL.Query()
+		if q.Get("sig") != "cba" || q.Get("n") != "N-fixed" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if !throttled {
+			throttled = true
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		ranges = append(ranges, q.Get("range"))
+		start, end, _ := strings.Cut(q.Get("range"), "-")
+		from, _ := strconv.Atoi(start)
+		to, _ := strconv.Atoi(end)
+		w.Write(audio[from : to+1])
+	}))
+	defer server.Close()
+
+	prevChunk, prevSleep, prevPrivate := youtubeChunkSize, youtubeRetryBaseSleep, youtubeIsPrivateHost
+	youtubeChunkSize, youtubeRetryBaseSleep = 1000, time.Millisecond
+	youtubeIsPrivateHost = func(string) bool { return false }
+	defer func() {
+		youtubeChunkSize, youtubeRetryBaseSleep, youtubeIsPrivateHost = prevChunk, prevSleep, prevPrivate
+	}()
+
+	cipher := url.Values{"s": {"abc"}, "sp": {"sig"}, "url": {server.URL + "/videoplayback?n=N-raw&itag=251"}}.Encode()
+	player := fmt.Sprintf(`{"playabilityStatus":{"status":"OK"},"videoDetails":{"videoId":"dQw4w9WgXcQ","title":"Song","author":"Artist","lengthSeconds":"212"},
+"streamingData":{"adaptiveFormats":[
+ {"itag":137,"mimeType":"video/mp4; codecs=\"avc1\"","bitrate":4000000,"url":"https://example.test/video"},
+ {"itag":140,"mimeType":"audio/mp4; codecs=\"mp4a.40.2\"","bitrate":130000,"averageBitrate":128000,"contentLength":"999","url":"https://example.test/m4a"},
+ {"itag":251,"mimeType":"audio/webm; codecs=\"opus\"","bitrate":140000,"averageBitrate":135000,"contentLength":"%d","audioSampleRate":"48000","signatureCipher":%q}]}}`,
+		len(audio), cipher)
+
+	dir := t.TempDir()
+	script := fmt.Sprintf(`registerExtension({
+  download: function (id, quality, outputPath) {
+    return {success: true, youtube_video_id: "dQw4w9WgXcQ", youtube_player_response: %q};
+  },
+  youtubeDecipher: function (s) { return s.split("").reverse().join(""); },
+  youtubeTransformN: function (n) { return n.replace("raw", "fixed"); }
+});`, player)
+	if err := os.WriteFile(filepath.Join(dir, "index.js"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ext := &LoadedExtension{
+		ID: "youtube-test",
+		Manifest: &ExtensionManifest{Name: "youtube-test", Types: []ExtensionType{ExtensionTypeDownloadProvider},
+			Permissions: ExtensionPermissions{Network: []string{"127.0.0.1"}}},
+		DataDir:   t.TempDir(),
+		SourceDir: dir,
+		Enabled:   true,
+	}
+	if err := GetExtensionManager().initializeVM(ext); err != nil {
+		t.Fatal(err)
+	}
+	defer unregisterExtensionVM(ext.VM)
+
+	var progress []int
+	result, err := NewExtensionProviderWrapper(ext).Download("id", "best", filepath.Join(t.TempDir(), "Artist - Song.flac"), func(p int) {
+		progress = append(progress, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success {
+		t.Fatalf("download failed: %s", result.ErrorMessage)
+	}
+	if filepath.Ext(result.FilePath) != ".webm" || result.SampleRate != 48000 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	data, err := os.ReadFile(result.FilePath)
+	if err != nil || !bytes.Equal(data, audio) {
+		t.Fatalf("downloaded %d bytes, want %d (%v)", len(data), len(audio), err)
+	}
+	if len(ranges) != 3 || ranges[2] != "2000-2499" {
+		t.Fatalf("unexpected chunk ranges: %v", ranges)
+	}
+	if progress[len(progress)-1] != 100 {
+		t.Fatalf("progress = %v", progress)
+	}
+}
+
+func TestParseInvidiousVideo(t *testing.T) {
+	info, err := parseInvidiousVideo([]byte(`{"videoId":"dQw4w9WgXcQ","title":"Song","author":"Artist","lengthSeconds":212,
+"adaptiveFormats":[{"itag":"140","type":"audio/mp4; codecs=\"mp4a.40.2\"","bitrate":"130000","clen":"100","url":"https://inv.test/a"},
+{"itag":"251","type":"audio/webm; codecs=\"opus\"","bitrate":"130000","clen":"90","url":"https://inv.test/b"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	best := selectYouTubeAudioFormat(info.Formats)
+	if best.Itag != 251 || best.Container != "webm" || best.ContentLength != 90 {
+		t.Fatalf("unexpected format: %+v", best)
+	}
+	if err := youtubeSourceAllowed((&ExtensionManifest{}).IsDomainAllowed, "dQw4w9WgXcQ", "https://inv.test"); err == nil {
+		t.Fatal("undeclared Invidious instance allowed")
+	}
+}
+
+func TestYouTubeStreamHostChecks(t *testing.T) {
+	allowAll := func(string) bool { return true }
+	if err := youtubeURLAllowed(allowAll, "https://127.0.0.1/videoplayback"); err == nil {
+		t.Error("private stream host allowed")
+	}
+	if err := youtubeURLAllowed(func(string) bool { return false }, "https://rr1.googlevideo.com/videoplayback"); err == nil {
+		t.Error("undeclared stream host allowed")
+	}
+	if err := youtubeURLAllowed(allowAll, "https://rr1.googlevideo.com/videoplayback"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestYouTubeChunkResumesBrokenBody(t *testing.T) {
+	audio := bytes.Repeat([]byte("abcdefghij"), 50)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.URL.Query().Get("range")
+		ranges = append(ranges, rng)
+		start, end, _ := strings.Cut(rng, "-")
+		from, _ := strconv.Atoi(start)
+		to, _ := strconv.Atoi(end)
+		body := audio[from : to+1]
+		if len(ranges) == 1 {
+			// Promise the whole range, send half of it and hang up.
+			conn, buf, _ := w.(http.Hijacker).Hijack()
+			fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n", len(body))
+			buf.Write(body[:len(body)/2])
+			buf.Flush()
+			conn.Close()
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	prevSleep := youtubeRetryBaseSleep
+	youtubeRetryBaseSleep = time.Millisecond
+	defer func() { youtubeRetryBaseSleep = prevSleep }()
+
+	var out bytes.Buffer
+	n, err := fetchYouTubeChunk(server.Client(), server.URL+"/videoplayback?itag=251", 100, 299, &out)
+	if err != nil || n != 200 || !bytes.Equal(out.Bytes(), audio[100:300]) {
+		t.Fatalf("n = %d, err = %v, got %q", n, err, out.String())
+	}
+	if len(ranges) != 2 || ranges[1] != "200-299" {
+		t.Errorf("ranges = %v", ranges)
+	}
+
+	cancelled := func() bool { return true }
+	path := filepath.Join(t.TempDir(), "a.webm")
+	if err := downloadYouTubeStream(server.URL+"/v", int64(len(audio)), path, nil, cancelled); err != ErrDownloadCancelled {
+		t.Errorf("cancelled download returned %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("cancelled download left a file behind")
+	}
+}